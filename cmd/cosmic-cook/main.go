@@ -0,0 +1,62 @@
+// Command cosmic-cook cooks a tree of source assets into a build that loads
+// fast, see package cook. Usage:
+//
+//	cosmic-cook [flags] <source directory>
+//
+// Only files that changed since the last run are cooked again.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/lentus/cosmic-engine/cosmic/cook"
+	"os"
+	"strings"
+)
+
+func main() {
+	output := flag.String("o", "cooked", "directory the build is written to")
+	cache := flag.String("cache", "", "file the cache is kept in (default "+cook.CacheName+" in the output directory)")
+	compiler := flag.String("compiler", "", "command compiling GLSL to SPIR-V (default glslc or glslangValidator -V)")
+	force := flag.Bool("force", false, "cook all files, even when they did not change")
+	workers := flag.Int("j", 0, "number of files cooked in parallel (default the number of CPUs)")
+	verbose := flag.Bool("v", false, "list the files cooked and removed")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] <source directory>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	options := cook.Options{
+		Source:  flag.Arg(0),
+		Output:  *output,
+		Cache:   *cache,
+		Force:   *force,
+		Workers: *workers,
+	}
+	if *compiler != "" {
+		options.Compiler = strings.Fields(*compiler)
+	}
+
+	result, err := cook.Cook(options)
+	if result != nil {
+		if *verbose {
+			for _, name := range result.Cooked {
+				fmt.Printf("cooked  %s\n", name)
+			}
+			for _, name := range result.Removed {
+				fmt.Printf("removed %s\n", name)
+			}
+		}
+		fmt.Printf("%d cooked, %d up to date, %d removed\n", len(result.Cooked), len(result.Skipped), len(result.Removed))
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
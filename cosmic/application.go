@@ -1,19 +1,53 @@
 package cosmic
 
 import (
+	"errors"
+	"github.com/lentus/cosmic-engine/cosmic/asset"
+	"github.com/lentus/cosmic-engine/cosmic/audio"
 	"github.com/lentus/cosmic-engine/cosmic/event"
+	"github.com/lentus/cosmic-engine/cosmic/graphics"
 	"github.com/lentus/cosmic-engine/cosmic/input"
 	"github.com/lentus/cosmic-engine/cosmic/internal/glfw"
 	"github.com/lentus/cosmic-engine/cosmic/layer"
 	"github.com/lentus/cosmic-engine/cosmic/log"
+	"github.com/lentus/cosmic-engine/cosmic/physics2d"
+	"github.com/lentus/cosmic-engine/cosmic/vfs"
+	"io/fs"
+	"path/filepath"
+	"time"
 )
 
 type Application struct {
 	Name        string
 	WindowProps *WindowProperties
 
+	// Key that saves a screenshot of the next frame, none by default.
+	ScreenshotKey input.Key
+	// Directory screenshots are saved to, the working directory by default.
+	ScreenshotDirectory string
+
+	// Directory mounted at the root of the file system of the application,
+	// the working directory by default.
+	AssetDirectory string
+
+	// Watches the directories mounted in the file system of the application
+	// and reloads the assets whose files change, for development.
+	HotReloadAssets bool
+
+	// Device the audio of the application plays on, the default output of
+	// the system by default. audio.NewNullDevice silences the application.
+	AudioDevice audio.Device
+
+	// Ticks per second at which the game is simulated, independently of the
+	// frame rate, 60 by default.
+	TickRate int
+
 	layerStack layer.Stack
 	window     window
+	files      *vfs.FS
+	assets     *asset.Manager
+	mixer      *audio.Mixer
+	physics    *physics2d.World
 
 	// Signals whether the application should close. Setting this to false
 	// terminates the game loop next frame.
@@ -29,13 +63,47 @@ func (app *Application) PushOverlay(l layer.Layer) {
 }
 
 func (app *Application) run() {
+	defer app.FS().Close()
+
+	graphicsProperties := &app.WindowProps.GraphicsProperties
+	if graphicsProperties.ShaderDirectory == "" && graphicsProperties.ShaderFS == nil {
+		graphicsProperties.ShaderFS = app.shaderFS()
+	}
+
 	app.window = createWindow(app.WindowProps, app.onEvent)
 	defer app.window.Terminate()
 
+	assets := app.Assets()
+	assets.SetGraphics(app.window.GetContext())
+	defer assets.Terminate()
+
+	audioDevice := app.startAudio()
+	defer audioDevice.Close()
+
+	var changes <-chan string
+	if app.HotReloadAssets {
+		watcher := app.watchAssets()
+		defer watcher.Close()
+		changes = watcher.Changes()
+	}
+
+	ticks := newFixedTick(app.TickRate, time.Now())
+
 	app.running = true
 	for app.running {
 		app.window.OnUpdate()
 
+		// Complete the assets loaded in the background, replacing those that
+		// changed at the frame boundary
+		reloadChangedAssets(app.FS(), assets, changes)
+		assets.Update()
+
+		// Simulate the game at the fixed ticks that passed since the last
+		// frame
+		for n := ticks.advance(time.Now()); n > 0 && app.running; n-- {
+			app.tick(ticks.delta())
+		}
+
 		// Update all layers
 		for it := app.layerStack.Bottom(); it.Next(); {
 			it.Get().OnUpdate()
@@ -43,8 +111,28 @@ func (app *Application) run() {
 	}
 }
 
+// Assets returns the manager loading the assets of the application from its
+// file system. Assets can be loaded before the application runs, they are
+// completed and uploaded once it does. When the file system holds a cooked
+// build, its cooked files are loaded in place of the source assets.
+func (app *Application) Assets() *asset.Manager {
+	if app.assets == nil {
+		app.assets = asset.NewManager(asset.Options{FS: app.FS(), Events: app.onEvent})
+
+		manifest, err := asset.ReadManifest(app.FS(), asset.ManifestName)
+		if err == nil {
+			log.DebugfCore("Using the cooked assets of %s", asset.ManifestName)
+			app.assets.UseManifest(manifest)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			log.ErrorfCore("Failed to read the asset manifest, loading source assets - %s", err.Error())
+		}
+	}
+
+	return app.assets
+}
+
 func (app *Application) onEvent(e event.Event) {
-	if !event.IsInCategory(e, event.CategoryInput) {
+	if _, ok := e.(*event.AppTick); !ok && !event.IsInCategory(e, event.CategoryInput) {
 		log.DebugCore(e.String())
 	}
 
@@ -54,6 +142,12 @@ func (app *Application) onEvent(e event.Event) {
 		return
 	}
 
+	if e, ok := e.(*event.KeyPressed); ok && app.ScreenshotKey != 0 && e.Key == app.ScreenshotKey && e.RepeatCount == 0 {
+		app.Screenshot()
+		e.SetHandled()
+		return
+	}
+
 	// Otherwise, pass the event down the layerstack until it is handled.
 	for it := app.layerStack.Top(); it.Prev(); {
 		it.Get().OnEvent(e)
@@ -64,6 +158,28 @@ func (app *Application) onEvent(e event.Event) {
 	}
 }
 
+// Screenshot saves the next frame as a PNG in the screenshot directory. The
+// frame is read back and saved in the background, without stalling the game
+// loop.
+func (app *Application) Screenshot() {
+	frame := app.window.GetContext().Capture()
+	path := filepath.Join(app.ScreenshotDirectory, graphics.ScreenshotName(time.Now()))
+
+	go func() {
+		img, ok := <-frame
+		if !ok {
+			log.ErrorCore("Failed to capture screenshot")
+			return
+		}
+
+		if err := graphics.SavePNG(img, path); err != nil {
+			log.ErrorfCore("Failed to save screenshot - %s", err.Error())
+			return
+		}
+		log.InfofCore("Saved screenshot to %s", path)
+	}()
+}
+
 func (app *Application) getNativeWindow() interface{} {
 	return app.window.GetNativeWindow()
 }
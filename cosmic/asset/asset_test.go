@@ -0,0 +1,507 @@
+package asset
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"github.com/lentus/cosmic-engine/cosmic/audio"
+	"github.com/lentus/cosmic-engine/cosmic/event"
+	"github.com/lentus/cosmic-engine/cosmic/graphics"
+	"github.com/lentus/cosmic-engine/cosmic/log"
+	"github.com/lentus/cosmic-engine/cosmic/mesh"
+	"github.com/lentus/cosmic-engine/cosmic/texture"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMain(m *testing.M) {
+	log.Init(log.LevelWarn, log.LevelWarn)
+	os.Exit(m.Run())
+}
+
+type fakeTexture struct {
+	width, height int
+	destroyed     *int
+}
+
+func (t *fakeTexture) Size() (width, height int) {
+	return t.width, t.height
+}
+
+func (t *fakeTexture) Destroy() {
+	*t.destroyed++
+}
+
+type fakeBuffers struct {
+	vertices, indices int
+	destroyed         *int
+}
+
+func (b *fakeBuffers) VertexCount() int { return b.vertices }
+func (b *fakeBuffers) IndexCount() int  { return b.indices }
+func (b *fakeBuffers) Destroy()         { *b.destroyed++ }
+
+// fakeGraphics counts the resources created and destroyed.
+type fakeGraphics struct {
+	textures, destroyedTextures int
+	meshes, destroyedMeshes     int
+}
+
+func (g *fakeGraphics) CreateTexture(img *image.RGBA, filter graphics.TextureFilter, mipmaps ...*image.RGBA) graphics.Texture {
+	g.textures++
+	return &fakeTexture{img.Rect.Dx(), img.Rect.Dy(), &g.destroyedTextures}
+}
+
+func (g *fakeGraphics) DrawBatch2D(batch graphics.Batch2D) int { return 1 }
+
+func (g *fakeGraphics) MaxBatchTextures() int {
+	return graphics.MaxBatchTextures
+}
+
+func (g *fakeGraphics) UploadMesh(vertices []byte, stride int, indices []uint32) graphics.MeshBuffers {
+	g.meshes++
+	return &fakeBuffers{len(vertices) / stride, len(indices), &g.destroyedMeshes}
+}
+
+func encodePNG(width, height int) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	img.Set(0, 0, color.NRGBA{R: 255, A: 255})
+
+	var buffer bytes.Buffer
+	png.Encode(&buffer, img)
+	return buffer.Bytes()
+}
+
+func spirv() []byte {
+	code := make([]byte, 20)
+	binary.LittleEndian.PutUint32(code, spirvMagicNumber)
+	return code
+}
+
+func encodeWAV(samples ...float32) []byte {
+	var buffer bytes.Buffer
+	audio.WriteWAV(&buffer, &audio.Sound{Format: audio.Format{SampleRate: 8000, Channels: 1}, Samples: samples})
+	return buffer.Bytes()
+}
+
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"textures/crate.png":        {Data: encodePNG(4, 2)},
+		"textures/crate-normal.png": {Data: encodePNG(4, 2)},
+		"shaders/vert.spv":          {Data: spirv()},
+		"shaders/frag.spv":          {Data: spirv()},
+		"shaders/broken.spv":        {Data: []byte("void main() {}")},
+		"materials/crate.material": {Data: []byte(`{
+			"roughness": 0.5,
+			"alphaMode": "mask",
+			"baseColorTexture": "../textures/crate.png",
+			"normalTexture": "/textures/crate-normal.png",
+			"vertexShader": "/shaders/vert.spv",
+			"fragmentShader": "/shaders/frag.spv"
+		}`)},
+		"materials/broken.material": {Data: []byte(`{"baseColorTexture": "../textures/missing.png", "fragmentShader": "/shaders/frag.spv"}`)},
+		"models/triangle.obj":       {Data: []byte("v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 3\n")},
+		"sounds/beep.wav":           {Data: encodeWAV(0.5, -0.5, 0.25)},
+	}
+}
+
+func newTestManager() (*Manager, *fakeGraphics, *[]event.Event) {
+	g := &fakeGraphics{}
+	events := &[]event.Event{}
+	m := NewManager(Options{FS: testFS(), Graphics: g, Workers: 2, Events: func(e event.Event) {
+		*events = append(*events, e)
+	}})
+	return m, g, events
+}
+
+func TestLoad(t *testing.T) {
+	m, g, events := newTestManager()
+	defer m.Terminate()
+
+	h := Load[*Texture](m, "textures/crate.png")
+	if h.State() != Loading {
+		t.Errorf("expected the texture to be loading, got %s", h.State())
+	}
+	if _, ok := h.Get(); ok {
+		t.Errorf("expected no texture before it is loaded")
+	}
+
+	m.WaitAll()
+	texture, ok := h.Get()
+	if !ok || h.State() != Loaded || h.Err() != nil {
+		t.Fatalf("expected the texture to be loaded, got %s: %v", h.State(), h.Err())
+	}
+	if texture.Image.Rect.Dx() != 4 || texture.Image.RGBAAt(0, 0) != (color.RGBA{R: 255, A: 255}) {
+		t.Errorf("expected a 4x2 texture with a red corner")
+	}
+	if width, _ := texture.Texture.Size(); g.textures != 1 || width != 4 {
+		t.Errorf("expected the texture to be uploaded once")
+	}
+	if len(*events) != 1 || (*events)[0].(*event.AssetLoaded).Path != "textures/crate.png" {
+		t.Errorf("expected an AssetLoaded event for the texture, got %v", *events)
+	}
+
+	// Loading again shares the texture, which is unloaded with the last handle
+	same := Load[*Texture](m, "/textures/../textures/crate.png")
+	if other, _ := same.Get(); other != texture {
+		t.Errorf("expected a loaded asset to be shared")
+	}
+	h.Release()
+	if g.destroyedTextures != 0 || same.State() != Loaded {
+		t.Errorf("expected the texture to stay loaded while referenced")
+	}
+	same.Release()
+	if g.destroyedTextures != 1 || m.Pending() != 0 {
+		t.Errorf("expected the texture to be destroyed with the last reference")
+	}
+}
+
+func TestLoadSound(t *testing.T) {
+	m, _, _ := newTestManager()
+	defer m.Terminate()
+
+	h := Load[*audio.Sound](m, "sounds/beep.wav")
+	m.WaitAll()
+	sound, ok := h.Get()
+	if !ok {
+		t.Fatalf("expected the sound to be loaded, got %v", h.Err())
+	}
+	if sound.Format.SampleRate != 8000 || sound.Frames() != 3 {
+		t.Errorf("expected 3 frames at 8000 Hz, got %d at %d Hz", sound.Frames(), sound.Format.SampleRate)
+	}
+}
+
+func TestLoad_dependencies(t *testing.T) {
+	m, g, events := newTestManager()
+	defer m.Terminate()
+
+	var ready []string
+	h := Load[*Material](m, "materials/crate.material")
+	h.OnReady(func(material *Material, err error) {
+		if err != nil {
+			t.Errorf("expected the material to load, got %s", err.Error())
+		}
+		ready = append(ready, material.Parameters.Name)
+	})
+	m.WaitAll()
+
+	material, ok := h.Get()
+	if !ok {
+		t.Fatalf("expected the material to be loaded, got %v", h.Err())
+	}
+	if len(ready) != 1 || ready[0] != "crate" {
+		t.Errorf("expected the callback to be called once, got %v", ready)
+	}
+	if material.Parameters.Roughness != 0.5 || material.Parameters.Metallic != 0 || material.Parameters.AlphaCutoff != 0.5 {
+		t.Errorf("expected the parameters of the file over the defaults, got %+v", material.Parameters)
+	}
+	for _, texture := range []Handle[*Texture]{material.BaseColorTexture, material.NormalTexture} {
+		if texture.State() != Loaded {
+			t.Errorf("expected texture %s to be loaded with the material", texture.Path())
+		}
+	}
+	if material.MetallicRoughnessTexture.IsValid() || material.VertexShader.Path() != "shaders/vert.spv" {
+		t.Errorf("expected only the textures and shaders of the file to be loaded")
+	}
+
+	// The material completes after everything it depends on
+	if last := (*events)[len(*events)-1].(*event.AssetLoaded); len(*events) != 5 || last.Path != "materials/crate.material" {
+		t.Errorf("expected 5 loaded events ending with the material, got %v", *events)
+	}
+
+	// Dependencies shared with other users stay loaded with the material
+	texture := Load[*Texture](m, "textures/crate.png")
+	h.Release()
+	if g.destroyedTextures != 1 || texture.State() != Loaded || material.VertexShader.State() != Unloaded {
+		t.Errorf("expected the unshared dependencies to be unloaded with the material")
+	}
+	texture.Release()
+	if g.destroyedTextures != 2 {
+		t.Errorf("expected all textures to be destroyed")
+	}
+}
+
+func TestLoad_failures(t *testing.T) {
+	m, g, events := newTestManager()
+	defer m.Terminate()
+
+	var failed error
+	missing := Load[*Texture](m, "textures/missing.png")
+	broken := Load[*Shader](m, "shaders/broken.spv")
+	material := Load[*Material](m, "materials/broken.material")
+	material.OnReady(func(material *Material, err error) {
+		failed = err
+	})
+	unknown := Load[*Texture](m, "textures/crate.tga")
+	wrongType := Load[*Shader](m, "textures/crate.png")
+	m.WaitAll()
+
+	for _, h := range []Handle[*Texture]{missing, unknown} {
+		if h.State() != Failed || h.Err() == nil {
+			t.Errorf("expected %s to fail", h.Path())
+		}
+	}
+	if broken.State() != Failed || !strings.Contains(broken.Err().Error(), "SPIR-V") {
+		t.Errorf("expected the broken shader to fail validation, got %v", broken.Err())
+	}
+	if failed == nil || !strings.Contains(failed.Error(), "textures/missing.png") {
+		t.Errorf("expected the material to fail with its missing texture, got %v", failed)
+	}
+	if _, ok := wrongType.Get(); ok || wrongType.State() != Failed || wrongType.Err() == nil {
+		t.Errorf("expected a texture not to load as a shader")
+	}
+
+	failures := 0
+	for _, e := range *events {
+		if _, ok := e.(*event.AssetFailed); ok {
+			failures++
+		}
+	}
+	if failures != 4 {
+		t.Errorf("expected 4 failed events, got %v", *events)
+	}
+
+	// Callbacks of finished assets are called immediately
+	called := false
+	missing.OnReady(func(texture *Texture, err error) {
+		called = err != nil
+	})
+	if !called {
+		t.Errorf("expected the callback of a failed asset to be called immediately")
+	}
+
+	for _, h := range []Handle[*Texture]{missing, unknown} {
+		h.Release()
+	}
+	broken.Release()
+	material.Release()
+	wrongType.Release()
+	if g.textures != g.destroyedTextures {
+		t.Errorf("expected all %d textures to be destroyed, got %d", g.textures, g.destroyedTextures)
+	}
+}
+
+func TestLoad_releasedWhileLoading(t *testing.T) {
+	m, g, _ := newTestManager()
+	defer m.Terminate()
+
+	h := Load[*Material](m, "materials/crate.material")
+	h.Release()
+	m.WaitAll()
+
+	if g.textures != 0 || m.Pending() != 0 {
+		t.Errorf("expected nothing to be uploaded for a released asset")
+	}
+	if h := Load[*Material](m, "materials/crate.material"); h.State() != Loading {
+		t.Errorf("expected a released asset to load again")
+	}
+}
+
+// recursiveLoader loads a file naming the assets it depends on.
+type recursiveLoader struct{}
+
+func (recursiveLoader) Load(ctx *LoadContext) (interface{}, error) {
+	data, err := ctx.ReadFile()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range strings.Fields(string(data)) {
+		if name == "panic" {
+			panic(errors.New("broken loader"))
+		}
+		Depend[string](ctx, name)
+	}
+	return string(data), nil
+}
+
+func TestRegisterLoader(t *testing.T) {
+	m := NewManager(Options{FS: fstest.MapFS{
+		"a.deps":     {Data: []byte("b.deps")},
+		"b.deps":     {Data: []byte("c.deps")},
+		"c.deps":     {Data: []byte("a.deps")},
+		"leaf.deps":  {Data: []byte("")},
+		"panic.deps": {Data: []byte("panic")},
+	}})
+	defer m.Terminate()
+	m.RegisterLoader(recursiveLoader{}, ".deps")
+
+	cycle := Load[string](m, "a.deps")
+	leaf := Load[string](m, "leaf.deps")
+	panicking := Load[string](m, "panic.deps")
+	m.WaitAll()
+
+	if cycle.State() != Failed || !strings.Contains(cycle.Err().Error(), "cycle") {
+		t.Errorf("expected the dependency cycle to fail, got %s: %v", cycle.State(), cycle.Err())
+	}
+	if value, ok := leaf.Get(); !ok || value != "" {
+		t.Errorf("expected the custom loader to load the leaf, got %v", leaf.Err())
+	}
+	if panicking.State() != Failed {
+		t.Errorf("expected a panicking loader to fail")
+	}
+
+	cycle.Release()
+	if m.entries["b.deps"] != nil || m.entries["c.deps"] != nil {
+		t.Errorf("expected the assets in the cycle to be unloaded")
+	}
+}
+
+func TestLoadGUID(t *testing.T) {
+	m, _, _ := newTestManager()
+	defer m.Terminate()
+
+	m.RegisterGUID("5b0c6f1e", "models/triangle.obj")
+	h := LoadGUID[*Model](m, "5b0c6f1e")
+	m.WaitAll()
+
+	model, ok := h.Get()
+	if !ok || h.Path() != "models/triangle.obj" {
+		t.Fatalf("expected the model to load by its GUID, got %v", h.Err())
+	}
+	if len(model.Buffers) != 1 || model.Buffers[0].IndexCount() != 3 {
+		t.Errorf("expected the triangle to be uploaded")
+	}
+
+	unknown := LoadGUID[*Model](m, "deadbeef")
+	if unknown.State() != Failed {
+		t.Errorf("expected an unknown GUID to fail")
+	}
+	unknown.Release()
+}
+
+func TestReload(t *testing.T) {
+	files := testFS()
+	g := &fakeGraphics{}
+	var events []event.Event
+	m := NewManager(Options{FS: files, Graphics: g, Events: func(e event.Event) {
+		events = append(events, e)
+	}})
+	defer m.Terminate()
+
+	h := Load[*Material](m, "materials/crate.material")
+	reloads := 0
+	h.OnReload(func(material *Material) {
+		reloads++
+	})
+	m.WaitAll()
+	material, _ := h.Get()
+	events = nil
+
+	// The new texture replaces the old one behind the handle of the material
+	files["textures/crate.png"] = &fstest.MapFile{Data: encodePNG(8, 2)}
+	if n := m.Reload("textures/crate.png"); n != 1 {
+		t.Fatalf("expected 1 asset to reload, got %d", n)
+	}
+	m.WaitAll()
+
+	if texture, ok := material.BaseColorTexture.Get(); !ok || texture.Image.Rect.Dx() != 8 {
+		t.Errorf("expected the texture to be replaced")
+	}
+	if g.destroyedTextures != 1 || g.textures != 3 {
+		t.Errorf("expected the old texture to be destroyed")
+	}
+	if reloads != 1 || len(events) != 2 {
+		t.Fatalf("expected the material to be notified of its texture, got %d reloads and events %v", reloads, events)
+	}
+	for i, path := range []string{"textures/crate.png", "materials/crate.material"} {
+		if e := events[i].(*event.AssetReloaded); e.Path != path || e.Cause != "textures/crate.png" {
+			t.Errorf("expected %s to be reloaded because of the texture, got %s", path, e)
+		}
+	}
+
+	// A broken file keeps the last good version
+	files["textures/crate.png"] = &fstest.MapFile{Data: []byte("broken")}
+	m.Reload("textures/crate.png")
+	m.WaitAll()
+	if texture, ok := material.BaseColorTexture.Get(); !ok || texture.Image.Rect.Dx() != 8 || g.destroyedTextures != 1 {
+		t.Errorf("expected the texture to be kept when its file is broken")
+	}
+
+	// Fixing a file loads the asset that failed
+	missing := Load[*Texture](m, "textures/missing.png")
+	m.WaitAll()
+	files["textures/missing.png"] = &fstest.MapFile{Data: encodePNG(1, 1)}
+	m.Reload("/textures/missing.png")
+	m.WaitAll()
+	if missing.State() != Loaded {
+		t.Errorf("expected the fixed texture to load, got %v", missing.Err())
+	}
+
+	if n := m.Reload("textures/unused.png"); n != 0 {
+		t.Errorf("expected no asset to reload for an unused file, got %d", n)
+	}
+}
+
+func TestReload_relativeFiles(t *testing.T) {
+	files := fstest.MapFS{
+		"models/cube.obj": {Data: []byte("mtllib cube.mtl\nusemtl red\nv 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 3\n")},
+		"models/cube.mtl": {Data: []byte("newmtl red\nKd 1 0 0\n")},
+	}
+	m := NewManager(Options{FS: files})
+	defer m.Terminate()
+
+	h := Load[*Model](m, "models/cube.obj")
+	m.WaitAll()
+
+	files["models/cube.mtl"] = &fstest.MapFile{Data: []byte("newmtl red\nKd 0 1 0\n")}
+	if n := m.Reload("models/cube.mtl"); n != 1 {
+		t.Fatalf("expected the model to reload with its material library, got %d", n)
+	}
+	m.WaitAll()
+
+	if model, ok := h.Get(); !ok || model.Model.Materials[0].BaseColor != [4]float32{0, 1, 0, 1} {
+		t.Errorf("expected the model to have the new material")
+	}
+}
+
+func TestUseManifest(t *testing.T) {
+	var cookedTexture, cookedModel bytes.Buffer
+	texture.Encode(&cookedTexture, texture.Mipmaps(image.NewRGBA(image.Rect(0, 0, 4, 2))))
+	triangle, _ := mesh.ParseOBJ(strings.NewReader("v 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 3\n"), nil)
+	mesh.WriteBinary(&cookedModel, triangle)
+
+	files := fstest.MapFS{
+		"textures/crate.ctex":      {Data: cookedTexture.Bytes()},
+		"models/triangle.cmesh":    {Data: cookedModel.Bytes()},
+		"materials/crate.material": {Data: []byte(`{"baseColorTexture": "../textures/crate.png"}`)},
+		ManifestName: {Data: []byte(`{"version": 1, "assets": [
+			{"source": "textures/crate.png", "path": "textures/crate.ctex", "guid": "crate"},
+			{"source": "models/triangle.obj", "path": "models/triangle.cmesh", "guid": "triangle"},
+			{"source": "materials/crate.material", "path": "materials/crate.material", "guid": "material"}
+		]}`)},
+	}
+	manifest, err := ReadManifest(files, ManifestName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewManager(Options{FS: files})
+	defer m.Terminate()
+	m.UseManifest(manifest)
+
+	material := LoadGUID[*Material](m, "material")
+	model := Load[*Model](m, "models/triangle.obj")
+	m.WaitAll()
+
+	crate, _ := material.Get()
+	if texture, ok := crate.BaseColorTexture.Get(); !ok || len(texture.Mipmaps) != 2 || crate.BaseColorTexture.Path() != "textures/crate.ctex" {
+		t.Errorf("expected the cooked texture with its mipmaps, got %v", crate.BaseColorTexture.Err())
+	}
+	if triangle, ok := model.Get(); !ok || len(triangle.Model.Meshes[0].Indices) != 3 {
+		t.Errorf("expected the cooked model, got %v", model.Err())
+	}
+	if name, _ := m.Lookup("crate"); name != "textures/crate.ctex" {
+		t.Errorf("expected the GUID to refer to the cooked texture, got %s", name)
+	}
+
+	files[ManifestName] = &fstest.MapFile{Data: []byte(`{"version": 2}`)}
+	if _, err := ReadManifest(files, ManifestName); err == nil {
+		t.Errorf("expected an error for an unknown manifest version")
+	}
+}
@@ -0,0 +1,148 @@
+package asset
+
+import "fmt"
+
+// Handle refers to an asset of type T, which is shared with all other
+// handles to it. Every handle returned by Load, LoadGUID, Depend or Retain
+// holds a reference to the asset, which must be released once the handle is
+// no longer used.
+//
+// The zero Handle refers to no asset and is always Unloaded.
+type Handle[T any] struct {
+	e *entry
+}
+
+// Load returns a handle to the asset at the slash separated path, and starts
+// loading it in the background if it is not loaded yet.
+func Load[T any](m *Manager, name string) Handle[T] {
+	return Handle[T]{m.acquire(cleanPath(name))}
+}
+
+// LoadGUID is like Load, for an asset registered with RegisterGUID. The
+// handle fails to load when the GUID is not registered.
+func LoadGUID[T any](m *Manager, guid string) Handle[T] {
+	name, ok := m.Lookup(guid)
+	if !ok {
+		return Handle[T]{&entry{
+			manager: m,
+			path:    guid,
+			refs:    1,
+			state:   Failed,
+			err:     fmt.Errorf("unknown asset GUID %s", guid),
+		}}
+	}
+
+	return Load[T](m, name)
+}
+
+// Path returns the path of the asset relative to the root of the file
+// system.
+func (h Handle[T]) Path() string {
+	if h.e == nil {
+		return ""
+	}
+	return h.e.path
+}
+
+// IsValid returns whether the handle refers to an asset.
+func (h Handle[T]) IsValid() bool {
+	return h.e != nil
+}
+
+// State returns how far the asset got in loading. Assets that are not of
+// type T have failed.
+func (h Handle[T]) State() State {
+	if h.e == nil {
+		return Unloaded
+	}
+	if h.e.state == Loaded {
+		if _, ok := h.e.value.(T); !ok {
+			return Failed
+		}
+	}
+
+	return h.e.state
+}
+
+// Err returns why the asset failed to load.
+func (h Handle[T]) Err() error {
+	if h.e == nil {
+		return nil
+	}
+	if h.e.state == Loaded {
+		if _, ok := h.e.value.(T); !ok {
+			var expected T
+			return fmt.Errorf("asset %s is a %T, not a %T", h.e.path, h.e.value, expected)
+		}
+	}
+
+	return h.e.err
+}
+
+// Get returns the asset once it is loaded.
+func (h Handle[T]) Get() (T, bool) {
+	if h.e == nil || h.e.state != Loaded {
+		var zero T
+		return zero, false
+	}
+
+	asset, ok := h.e.value.(T)
+	return asset, ok
+}
+
+// OnReady calls f on the main thread once the asset has finished loading,
+// with the error when it failed. When it has finished already, f is called
+// immediately.
+func (h Handle[T]) OnReady(f func(asset T, err error)) {
+	if h.e == nil {
+		return
+	}
+
+	ready := func() {
+		asset, _ := h.Get()
+		f(asset, h.Err())
+	}
+	if h.e.state == Loading {
+		h.e.callbacks = append(h.e.callbacks, ready)
+	} else {
+		ready()
+	}
+}
+
+// OnReload calls f on the main thread every time the asset, or an asset it
+// depends on, is replaced by a new version, until the asset is unloaded. See
+// Manager.Reload.
+func (h Handle[T]) OnReload(f func(asset T)) {
+	if h.e == nil {
+		return
+	}
+
+	h.e.reloadCallbacks = append(h.e.reloadCallbacks, func() {
+		if asset, ok := h.Get(); ok {
+			f(asset)
+		}
+	})
+}
+
+// Retain returns a new handle to the asset, with its own reference.
+func (h Handle[T]) Retain() Handle[T] {
+	if h.e == nil {
+		return h
+	}
+
+	h.e.manager.mutex.Lock()
+	h.e.refs++
+	h.e.manager.mutex.Unlock()
+
+	return h
+}
+
+// Release removes the reference of the handle, which must not be used
+// afterwards. The asset is unloaded when no references are left.
+func (h Handle[T]) Release() {
+	if h.e == nil {
+		return
+	}
+
+	h.e.manager.release(h.e)
+}
@@ -0,0 +1,122 @@
+package asset
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// Loader decodes assets from their files. Loaders are registered per file
+// extension with Manager.RegisterLoader.
+type Loader interface {
+	// Load decodes the asset. It is called on a worker goroutine, so it must
+	// not use the graphics context, see Finalizer.
+	Load(ctx *LoadContext) (interface{}, error)
+}
+
+// Finalizer is implemented by loaders that complete their assets on the main
+// thread, like uploading them to the gpu. Finalize is called once all
+// dependencies of the asset are loaded.
+type Finalizer interface {
+	Finalize(m *Manager, asset interface{}) error
+}
+
+// Unloader is implemented by loaders that free the resources of their
+// assets, like gpu memory. Unload is called on the main thread, for assets
+// that were loaded successfully.
+type Unloader interface {
+	Unload(asset interface{})
+}
+
+// LoadContext gives a loader access to the file of its asset, the files next
+// to it and the assets it depends on.
+type LoadContext struct {
+	// Path of the asset, slash separated and relative to the root of the file
+	// system.
+	Path string
+
+	manager *Manager
+	entry   *entry
+	err     error
+}
+
+// Open opens the file of the asset.
+func (ctx *LoadContext) Open() (io.ReadCloser, error) {
+	return ctx.manager.fs.Open(ctx.Path)
+}
+
+// ReadFile returns the contents of the file of the asset.
+func (ctx *LoadContext) ReadFile() ([]byte, error) {
+	return fs.ReadFile(ctx.manager.fs, ctx.Path)
+}
+
+// OpenRelative opens a file by its path relative to the asset, like a buffer
+// of a model. Paths starting with a slash are relative to the root of the
+// file system instead.
+//
+// The asset is reloaded when the file changes, see Manager.Reload.
+func (ctx *LoadContext) OpenRelative(name string) (io.ReadCloser, error) {
+	name = ctx.resolve(name)
+	ctx.entry.files = append(ctx.entry.files, name)
+
+	return ctx.manager.fs.Open(name)
+}
+
+func (ctx *LoadContext) resolve(name string) string {
+	if strings.HasPrefix(name, "/") {
+		return cleanPath(name)
+	}
+	return cleanPath(path.Join(path.Dir(ctx.Path), name))
+}
+
+// Depend loads an asset the asset being loaded depends on, by its path
+// relative to the asset as for OpenRelative. The asset being loaded is only
+// completed once the dependency has loaded, and fails when it fails. The
+// dependency is released when the asset is unloaded, so the loader must not
+// release the returned handle itself.
+//
+// Assets depending on themselves, directly or indirectly, fail to load and
+// get the zero Handle.
+func Depend[T any](ctx *LoadContext, name string) Handle[T] {
+	m := ctx.manager
+
+	// The dependency is added before its loader can add its own, so cycles
+	// are always seen by the last loader closing them
+	m.mutex.Lock()
+	dep := m.acquireLocked(ctx.resolve(name))
+	cycle := dependsOn(dep, ctx.entry) || (ctx.entry.target != nil && dependsOn(dep, ctx.entry.target))
+	if !cycle {
+		ctx.entry.deps = append(ctx.entry.deps, dep)
+	}
+	m.mutex.Unlock()
+
+	// The asset would wait for itself forever. The dependency is still
+	// loading, as it waits for this asset, so it is not unloaded here.
+	if cycle {
+		if ctx.err == nil {
+			ctx.err = fmt.Errorf("dependency cycle through %s", dep.path)
+		}
+		m.release(dep)
+		return Handle[T]{}
+	}
+
+	return Handle[T]{dep}
+}
+
+// dependsOn returns whether e is target or depends on it, directly or
+// indirectly. The mutex of the manager must be locked.
+func dependsOn(e, target *entry) bool {
+	if e == target {
+		return true
+	}
+
+	for _, dep := range e.deps {
+		if dependsOn(dep, target) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,290 @@
+package asset
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lentus/cosmic-engine/cosmic/audio"
+	"github.com/lentus/cosmic-engine/cosmic/graphics"
+	"github.com/lentus/cosmic-engine/cosmic/math"
+	"github.com/lentus/cosmic-engine/cosmic/mesh"
+	"github.com/lentus/cosmic-engine/cosmic/texture"
+	"image"
+	"image/draw"
+	_ "image/jpeg"
+	_ "image/png"
+	"path"
+	"strings"
+)
+
+// Texture is an image that is uploaded to the gpu.
+type Texture struct {
+	Image *image.RGBA
+	// Mipmaps are the smaller levels of the image, for cooked textures,
+	// which come with their mipmaps, uploaded into the mip levels of the
+	// texture. Nil for other images.
+	Mipmaps []*image.RGBA
+	// Texture is the image in gpu memory, nil when the manager has no
+	// graphics context.
+	Texture graphics.Texture
+}
+
+// TextureLoader loads PNG and JPEG images and cooked textures as *Texture.
+type TextureLoader struct {
+	Filter graphics.TextureFilter
+}
+
+func (l TextureLoader) Load(ctx *LoadContext) (interface{}, error) {
+	file, err := ctx.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if strings.ToLower(path.Ext(ctx.Path)) == texture.Extension {
+		levels, err := texture.Decode(file)
+		if err != nil {
+			return nil, err
+		}
+		return &Texture{Image: levels[0], Mipmaps: levels[1:]}, nil
+	}
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, err
+	}
+
+	rgba, ok := img.(*image.RGBA)
+	if !ok {
+		rgba = image.NewRGBA(img.Bounds())
+		draw.Draw(rgba, rgba.Rect, img, img.Bounds().Min, draw.Src)
+	}
+
+	return &Texture{Image: rgba}, nil
+}
+
+func (l TextureLoader) Finalize(m *Manager, asset interface{}) error {
+	if g := m.Graphics(); g != nil {
+		t := asset.(*Texture)
+		t.Texture = g.CreateTexture(t.Image, l.Filter, t.Mipmaps...)
+	}
+
+	return nil
+}
+
+func (l TextureLoader) Unload(asset interface{}) {
+	if t := asset.(*Texture); t.Texture != nil {
+		t.Texture.Destroy()
+	}
+}
+
+// Shader is the SPIR-V code of a shader stage.
+type Shader struct {
+	Code []byte
+}
+
+const spirvMagicNumber = 0x07230203
+
+// ShaderLoader loads SPIR-V files as *Shader.
+type ShaderLoader struct{}
+
+func (ShaderLoader) Load(ctx *LoadContext) (interface{}, error) {
+	code, err := ctx.ReadFile()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(code) < 20 || len(code)%4 != 0 {
+		return nil, fmt.Errorf("invalid SPIR-V size of %d bytes", len(code))
+	}
+	if binary.LittleEndian.Uint32(code) != spirvMagicNumber {
+		return nil, errors.New("missing SPIR-V magic number")
+	}
+
+	return &Shader{Code: code}, nil
+}
+
+// SoundLoader loads WAV and Ogg Vorbis files as *audio.Sound, decoded into
+// memory. Long music tracks are better streamed with audio.NewStream.
+type SoundLoader struct{}
+
+func (SoundLoader) Load(ctx *LoadContext) (interface{}, error) {
+	file, err := ctx.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return audio.Decode(file)
+}
+
+// Material is a surface material whose textures and shaders are loaded with
+// it.
+type Material struct {
+	// Parameters of the material, without textures.
+	Parameters mesh.Material
+
+	BaseColorTexture         Handle[*Texture]
+	NormalTexture            Handle[*Texture]
+	MetallicRoughnessTexture Handle[*Texture]
+	EmissiveTexture          Handle[*Texture]
+
+	VertexShader   Handle[*Shader]
+	FragmentShader Handle[*Shader]
+}
+
+// materialFile is the JSON form of a material. Paths are relative to the
+// material file and empty when unused.
+type materialFile struct {
+	Name        string      `json:"name"`
+	BaseColor   *[4]float32 `json:"baseColor"`
+	Metallic    *float32    `json:"metallic"`
+	Roughness   *float32    `json:"roughness"`
+	Emissive    [3]float32  `json:"emissive"`
+	AlphaMode   string      `json:"alphaMode"`
+	AlphaCutoff *float32    `json:"alphaCutoff"`
+	DoubleSided bool        `json:"doubleSided"`
+
+	BaseColorTexture         string `json:"baseColorTexture"`
+	NormalTexture            string `json:"normalTexture"`
+	MetallicRoughnessTexture string `json:"metallicRoughnessTexture"`
+	EmissiveTexture          string `json:"emissiveTexture"`
+
+	VertexShader   string `json:"vertexShader"`
+	FragmentShader string `json:"fragmentShader"`
+}
+
+// MaterialLoader loads JSON material files as *Material. Parameters left out
+// of a file have the values of mesh.DefaultMaterial, for example:
+//
+//	{
+//	  "name": "crate",
+//	  "roughness": 0.8,
+//	  "baseColorTexture": "crate.png",
+//	  "vertexShader": "/shaders/vert.spv",
+//	  "fragmentShader": "/shaders/frag.spv"
+//	}
+type MaterialLoader struct{}
+
+func (MaterialLoader) Load(ctx *LoadContext) (interface{}, error) {
+	file, err := ctx.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var source materialFile
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&source); err != nil {
+		return nil, err
+	}
+
+	parameters := mesh.DefaultMaterial()
+	if source.Name != "" {
+		parameters.Name = source.Name
+	} else {
+		parameters.Name = strings.TrimSuffix(path.Base(ctx.Path), path.Ext(ctx.Path))
+	}
+	if source.BaseColor != nil {
+		parameters.BaseColor = *source.BaseColor
+	}
+	if source.Metallic != nil {
+		parameters.Metallic = *source.Metallic
+	}
+	if source.Roughness != nil {
+		parameters.Roughness = *source.Roughness
+	}
+	parameters.Emissive = math.Vec3{X: source.Emissive[0], Y: source.Emissive[1], Z: source.Emissive[2]}
+	if source.AlphaCutoff != nil {
+		parameters.AlphaCutoff = *source.AlphaCutoff
+	}
+	parameters.DoubleSided = source.DoubleSided
+
+	switch source.AlphaMode {
+	case "", "opaque":
+		parameters.AlphaMode = mesh.AlphaOpaque
+	case "mask":
+		parameters.AlphaMode = mesh.AlphaMask
+	case "blend":
+		parameters.AlphaMode = mesh.AlphaBlend
+	default:
+		return nil, fmt.Errorf("invalid alpha mode %q", source.AlphaMode)
+	}
+
+	material := &Material{Parameters: parameters}
+	depend := func(name string, handle *Handle[*Texture]) {
+		if name != "" {
+			*handle = Depend[*Texture](ctx, name)
+		}
+	}
+	depend(source.BaseColorTexture, &material.BaseColorTexture)
+	depend(source.NormalTexture, &material.NormalTexture)
+	depend(source.MetallicRoughnessTexture, &material.MetallicRoughnessTexture)
+	depend(source.EmissiveTexture, &material.EmissiveTexture)
+
+	if source.VertexShader != "" {
+		material.VertexShader = Depend[*Shader](ctx, source.VertexShader)
+	}
+	if source.FragmentShader != "" {
+		material.FragmentShader = Depend[*Shader](ctx, source.FragmentShader)
+	}
+
+	return material, nil
+}
+
+// Model is a model whose meshes are uploaded to the gpu.
+type Model struct {
+	Model *mesh.Model
+	// Buffers of the meshes of the model, by index. Nil when the manager has
+	// no graphics context.
+	Buffers []graphics.MeshBuffers
+}
+
+// ModelLoader loads OBJ, glTF, binary glTF and binary model files as *Model.
+// The textures of their materials are not loaded.
+type ModelLoader struct{}
+
+func (ModelLoader) Load(ctx *LoadContext) (interface{}, error) {
+	file, err := ctx.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var model *mesh.Model
+	switch extension := strings.ToLower(path.Ext(ctx.Path)); extension {
+	case ".obj":
+		model, err = mesh.ParseOBJ(file, ctx.OpenRelative)
+	case ".gltf", ".glb":
+		model, err = mesh.ParseGLTF(file, ctx.OpenRelative)
+	case mesh.BinaryExtension:
+		model, err = mesh.ParseBinary(file)
+	default:
+		return nil, fmt.Errorf("unsupported model format %s", extension)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Model{Model: model}, nil
+}
+
+func (ModelLoader) Finalize(m *Manager, asset interface{}) error {
+	if g := m.Graphics(); g != nil {
+		model := asset.(*Model)
+		model.Buffers = make([]graphics.MeshBuffers, len(model.Model.Meshes))
+		for i := range model.Model.Meshes {
+			model.Buffers[i] = model.Model.Meshes[i].Upload(g)
+		}
+	}
+
+	return nil
+}
+
+func (ModelLoader) Unload(asset interface{}) {
+	for _, buffers := range asset.(*Model).Buffers {
+		buffers.Destroy()
+	}
+}
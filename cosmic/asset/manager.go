@@ -0,0 +1,503 @@
+// Package asset loads the assets of a game, like textures and models, in the
+// background and shares them between their users.
+package asset
+
+import (
+	"fmt"
+	"github.com/lentus/cosmic-engine/cosmic/event"
+	"github.com/lentus/cosmic-engine/cosmic/graphics"
+	"github.com/lentus/cosmic-engine/cosmic/log"
+	"github.com/lentus/cosmic-engine/cosmic/mesh"
+	"github.com/lentus/cosmic-engine/cosmic/texture"
+	"io/fs"
+	"path"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// State is how far an asset got in loading.
+type State int
+
+const (
+	// Unloaded assets were released, or never loaded.
+	Unloaded State = iota
+	// Loading assets are decoded or wait for their dependencies.
+	Loading
+	// Loaded assets can be used.
+	Loaded
+	// Failed assets, or one of their dependencies, could not be loaded.
+	Failed
+)
+
+func (s State) String() string {
+	switch s {
+	case Unloaded:
+		return "unloaded"
+	case Loading:
+		return "loading"
+	case Loaded:
+		return "loaded"
+	case Failed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// Graphics is the part of a graphics context that assets are uploaded with.
+type Graphics interface {
+	graphics.Drawer2D
+	graphics.MeshUploader
+}
+
+type Options struct {
+	// File system the assets are loaded from, by slash separated paths.
+	FS fs.FS
+
+	// Context textures and meshes are uploaded with. Without it, assets are
+	// only loaded into memory, which is enough for tools validating them.
+	Graphics Graphics
+
+	// Number of assets decoded at the same time, the number of cpus by
+	// default.
+	Workers int
+
+	// Receives an AssetLoaded or AssetFailed event on the main thread for
+	// every asset that finishes loading, and AssetReloaded events for assets
+	// replaced by a new version.
+	Events func(e event.Event)
+}
+
+// entry is an asset shared by all handles to it.
+type entry struct {
+	manager *Manager
+	path    string
+	loader  Loader
+
+	// Guarded by the mutex of the manager, as loaders add references and
+	// dependencies from worker goroutines.
+	refs int
+	deps []*entry
+
+	// Set by the worker decoding the asset, then only used on the main thread.
+	value interface{}
+	err   error
+	// Files other than that of the asset read by its loader.
+	files []string
+
+	// Entry of the asset that an entry loading a new version of it replaces.
+	target *entry
+
+	// Main thread only
+	state           State
+	callbacks       []func()
+	reloadCallbacks []func()
+	// Whether a new version is loading, and whether to load another once it
+	// is done, as the file changed again.
+	reloading   bool
+	reloadAgain bool
+}
+
+// Manager loads assets on worker goroutines and completes them on the main
+// thread, once the assets they depend on are loaded. Every asset is loaded
+// once and shared by all handles to it, and unloaded when the last handle is
+// released.
+//
+// Except for loaders, which run on the workers, managers and handles may
+// only be used from the main thread.
+type Manager struct {
+	fs       fs.FS
+	graphics Graphics
+	events   func(e event.Event)
+
+	mutex   sync.Mutex
+	loaders map[string]Loader
+	entries map[string]*entry
+	guids   map[string]string
+	// Cooked files replacing source assets, by source path
+	cooked map[string]string
+	// Entries decoded by workers since the last update
+	decoded []*entry
+	// Number of entries still loading, including released ones
+	pending int
+	stopped bool
+
+	// Entries waiting for their dependencies. Main thread only.
+	waiting []*entry
+
+	workers chan struct{}
+	ready   chan struct{}
+	running sync.WaitGroup
+}
+
+// NewManager creates a manager with loaders for PNG, JPEG and cooked textures,
+// SPIR-V shaders, materials, OBJ, glTF and binary models and WAV and Ogg
+// Vorbis sounds.
+func NewManager(options Options) *Manager {
+	if options.Workers <= 0 {
+		options.Workers = runtime.NumCPU()
+	}
+
+	m := &Manager{
+		fs:       options.FS,
+		graphics: options.Graphics,
+		events:   options.Events,
+		loaders:  make(map[string]Loader),
+		entries:  make(map[string]*entry),
+		guids:    make(map[string]string),
+		cooked:   make(map[string]string),
+		workers:  make(chan struct{}, options.Workers),
+		ready:    make(chan struct{}, 1),
+	}
+
+	m.RegisterLoader(TextureLoader{}, ".png", ".jpg", ".jpeg", texture.Extension)
+	m.RegisterLoader(ShaderLoader{}, ".spv")
+	m.RegisterLoader(MaterialLoader{}, ".material")
+	m.RegisterLoader(ModelLoader{}, ".obj", ".gltf", ".glb", mesh.BinaryExtension)
+	m.RegisterLoader(SoundLoader{}, ".wav", ".ogg")
+
+	return m
+}
+
+// RegisterLoader loads files with the given extensions, including the dot,
+// with the loader. It replaces any loader registered for them before, and
+// applies to assets that start loading afterwards.
+func (m *Manager) RegisterLoader(loader Loader, extensions ...string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, extension := range extensions {
+		m.loaders[strings.ToLower(extension)] = loader
+	}
+}
+
+func (m *Manager) loader(name string) Loader {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.loaders[strings.ToLower(path.Ext(name))]
+}
+
+// RegisterGUID makes the asset at the path loadable by the GUID, which stays
+// the same when the asset is moved.
+func (m *Manager) RegisterGUID(guid, name string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.guids[guid] = cleanPath(name)
+}
+
+// Lookup returns the path of the asset with the GUID.
+func (m *Manager) Lookup(guid string) (string, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	name, ok := m.guids[guid]
+	return name, ok
+}
+
+// SetGraphics sets the context textures and meshes are uploaded with, for
+// when the manager is created before the context. Assets completed earlier
+// are not uploaded.
+func (m *Manager) SetGraphics(g Graphics) {
+	m.graphics = g
+}
+
+// Graphics returns the context assets are uploaded with, nil when they are
+// only loaded into memory.
+func (m *Manager) Graphics() Graphics {
+	return m.graphics
+}
+
+// Pending returns the number of assets still loading, for instance to show
+// a loading screen until it drops to zero.
+func (m *Manager) Pending() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.pending
+}
+
+// cleanPath makes the names of assets slash separated paths relative to the
+// root of the file system, so every asset has one name.
+func cleanPath(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(name, "\\", "/")), "/")
+}
+
+// acquire returns the entry of the asset at the path with a new reference,
+// and starts loading it when it is not loaded yet.
+func (m *Manager) acquire(name string) *entry {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.acquireLocked(name)
+}
+
+func (m *Manager) acquireLocked(name string) *entry {
+	if cooked, ok := m.cooked[name]; ok {
+		name = cooked
+	}
+
+	if e, ok := m.entries[name]; ok {
+		e.refs++
+		return e
+	}
+
+	e := &entry{manager: m, path: name, refs: 1, state: Loading}
+	m.entries[name] = e
+	m.start(e)
+
+	return e
+}
+
+// start decodes the entry on a worker. The mutex must be locked.
+func (m *Manager) start(e *entry) {
+	m.pending++
+
+	m.running.Add(1)
+	go m.decode(e)
+}
+
+// decode runs the loader of an entry on a worker.
+func (m *Manager) decode(e *entry) {
+	defer m.running.Done()
+
+	m.workers <- struct{}{}
+	value, loader, err := m.runLoader(e)
+	<-m.workers
+
+	m.mutex.Lock()
+	e.loader = loader
+	e.value, e.err = value, err
+	m.decoded = append(m.decoded, e)
+	m.mutex.Unlock()
+
+	select {
+	case m.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (m *Manager) runLoader(e *entry) (value interface{}, loader Loader, err error) {
+	m.mutex.Lock()
+	stopped := m.stopped
+	m.mutex.Unlock()
+	if stopped {
+		return nil, nil, fmt.Errorf("asset manager terminated")
+	}
+
+	loader = m.loader(e.path)
+	if loader == nil {
+		return nil, nil, fmt.Errorf("no loader for %q files", path.Ext(e.path))
+	}
+
+	// A broken file must not take down the game with a panicking loader
+	defer func() {
+		if r := recover(); r != nil {
+			value, err = nil, fmt.Errorf("loader panicked: %v", r)
+		}
+	}()
+
+	ctx := &LoadContext{Path: e.path, manager: m, entry: e}
+	value, err = loader.Load(ctx)
+	if err == nil {
+		err = ctx.err
+	}
+
+	return value, loader, err
+}
+
+// Update completes the assets decoded since the last update whose
+// dependencies are loaded, and calls their callbacks. It is called every
+// frame on the main thread.
+func (m *Manager) Update() {
+	m.mutex.Lock()
+	m.waiting = append(m.waiting, m.decoded...)
+	m.decoded = m.decoded[:0]
+	m.mutex.Unlock()
+
+	// Completing an asset can complete the assets waiting for it
+	for progress := true; progress; {
+		progress = false
+
+		waiting := m.waiting[:0]
+		for _, e := range m.waiting {
+			if m.finish(e) {
+				progress = true
+			} else {
+				waiting = append(waiting, e)
+			}
+		}
+		for i := len(waiting); i < len(m.waiting); i++ {
+			m.waiting[i] = nil
+		}
+		m.waiting = waiting
+	}
+}
+
+// finish completes or fails a decoded entry, and returns whether it is done
+// waiting.
+func (m *Manager) finish(e *entry) bool {
+	m.mutex.Lock()
+	refs := e.refs
+	deps := e.deps
+	m.mutex.Unlock()
+
+	// Released while loading
+	if refs == 0 {
+		m.mutex.Lock()
+		m.pending--
+		m.mutex.Unlock()
+		m.unload(e)
+		return true
+	}
+
+	if e.err == nil {
+		for _, dep := range deps {
+			if dep.state == Loading {
+				return false
+			}
+			if dep.state == Failed {
+				e.err = fmt.Errorf("dependency %s: %s", dep.path, dep.err.Error())
+				break
+			}
+		}
+	}
+
+	if f, ok := e.loader.(Finalizer); ok && e.err == nil {
+		e.err = f.Finalize(m, e.value)
+	}
+
+	if e.target != nil {
+		m.swap(e)
+	} else {
+		m.complete(e, e.err)
+	}
+	return true
+}
+
+func (m *Manager) complete(e *entry, err error) {
+	if err != nil {
+		e.state = Failed
+		e.err = err
+		e.value = nil
+		log.ErrorfCore("Failed to load asset %s - %s", e.path, err.Error())
+	} else {
+		e.state = Loaded
+		log.DebugfCore("Loaded asset %s", e.path)
+	}
+
+	m.mutex.Lock()
+	m.pending--
+	m.mutex.Unlock()
+
+	callbacks := e.callbacks
+	e.callbacks = nil
+	for _, f := range callbacks {
+		f()
+	}
+
+	if m.events != nil {
+		if err != nil {
+			m.events(&event.AssetFailed{Path: e.path, Err: err})
+		} else {
+			m.events(&event.AssetLoaded{Path: e.path})
+		}
+	}
+
+	// The file changed while it was loading
+	if e.reloadAgain {
+		e.reloadAgain = false
+		m.startReload(e)
+	}
+}
+
+// release removes a reference to the entry, and unloads it when it was the
+// last one.
+func (m *Manager) release(e *entry) {
+	m.mutex.Lock()
+	if e.refs <= 0 {
+		m.mutex.Unlock()
+		log.PanicfCore("Asset %s was released more often than it was loaded", e.path)
+	}
+	e.refs--
+	if e.refs > 0 {
+		m.mutex.Unlock()
+		return
+	}
+	if m.entries[e.path] == e {
+		delete(m.entries, e.path)
+	}
+	m.mutex.Unlock()
+
+	// Assets still loading are unloaded once decoded, see finish
+	if e.state != Loading {
+		m.unload(e)
+	}
+}
+
+// unload frees the asset of an entry without references, and releases the
+// assets it depends on.
+func (m *Manager) unload(e *entry) {
+	if e.state == Loaded {
+		if u, ok := e.loader.(Unloader); ok {
+			u.Unload(e.value)
+		}
+		log.DebugfCore("Unloaded asset %s", e.path)
+	}
+	e.state = Unloaded
+	e.value = nil
+	e.callbacks = nil
+	e.reloadCallbacks = nil
+
+	m.mutex.Lock()
+	deps := e.deps
+	e.deps = nil
+	m.mutex.Unlock()
+
+	for _, dep := range deps {
+		m.release(dep)
+	}
+}
+
+// WaitAll blocks until every asset has finished loading, for tools and
+// loading screens. It must be called on the main thread.
+func (m *Manager) WaitAll() {
+	for {
+		m.Update()
+		if m.Pending() == 0 {
+			return
+		}
+		<-m.ready
+	}
+}
+
+// Terminate waits for the workers and unloads all assets, whether or not
+// they were released.
+func (m *Manager) Terminate() {
+	m.mutex.Lock()
+	m.stopped = true
+	m.mutex.Unlock()
+
+	m.running.Wait()
+	m.Update()
+
+	m.mutex.Lock()
+	entries := m.entries
+	m.entries = make(map[string]*entry)
+	m.mutex.Unlock()
+
+	if len(entries) > 0 {
+		log.DebugfCore("Unloading %d assets that were not released", len(entries))
+	}
+	for _, e := range entries {
+		if e.state == Loaded {
+			if u, ok := e.loader.(Unloader); ok {
+				u.Unload(e.value)
+			}
+		}
+		e.state = Unloaded
+		e.value = nil
+	}
+}
@@ -0,0 +1,72 @@
+package asset
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+)
+
+// ManifestName is the name of the manifest in the root of a cooked build.
+const ManifestName = "manifest.json"
+
+// ManifestVersion is the version of the manifest format written by the
+// asset cooker.
+const ManifestVersion = 1
+
+// Manifest lists the files of a cooked build, which the asset cooker made
+// from a source asset tree.
+type Manifest struct {
+	Version int             `json:"version"`
+	Assets  []ManifestEntry `json:"assets"`
+}
+
+// ManifestEntry describes a cooked file.
+type ManifestEntry struct {
+	// Source is the path of the source asset the file was cooked from.
+	Source string `json:"source"`
+	// Path is the path of the cooked file, which differs from the source
+	// when cooking changed the format of the asset.
+	Path string `json:"path"`
+	// GUID identifies the asset, derived from the source path.
+	GUID string `json:"guid"`
+	// Hash is the SHA-256 hash of the cooked file, hex encoded.
+	Hash string `json:"hash"`
+	Size int64  `json:"size"`
+}
+
+// ReadManifest reads the manifest of a cooked build.
+func ReadManifest(files fs.FS, name string) (*Manifest, error) {
+	data, err := fs.ReadFile(files, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err.Error())
+	}
+	if manifest.Version != ManifestVersion {
+		return nil, fmt.Errorf("%s: unsupported manifest version %d", name, manifest.Version)
+	}
+
+	return &manifest, nil
+}
+
+// UseManifest loads the cooked files of a manifest in place of the source
+// assets they were made from, so assets are loaded by their source paths,
+// and registers their GUIDs. It applies to assets that start loading
+// afterwards.
+func (m *Manager) UseManifest(manifest *Manifest) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, asset := range manifest.Assets {
+		source, cooked := cleanPath(asset.Source), cleanPath(asset.Path)
+		if source != cooked {
+			m.cooked[source] = cooked
+		}
+		if asset.GUID != "" {
+			m.guids[asset.GUID] = cooked
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package asset
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/event"
+	"github.com/lentus/cosmic-engine/cosmic/log"
+)
+
+// Reload loads the asset at the path again, along with the assets whose
+// loaders read the file, like models reading their buffers. Each new version
+// replaces the old one behind its handles in a later Update, once it and its
+// dependencies are loaded, and the old version is unloaded. When the new
+// version fails to load, the old one is kept. Failed assets are loaded again
+// as well, so fixing a broken file makes them load.
+//
+// Reload returns the number of assets that are reloaded, which is zero when
+// the file is not used by any asset.
+func (m *Manager) Reload(name string) int {
+	name = cleanPath(name)
+
+	m.mutex.Lock()
+	if cooked, ok := m.cooked[name]; ok {
+		name = cooked
+	}
+	var targets []*entry
+	for _, e := range m.entries {
+		if e.path == name || contains(e.files, name) {
+			targets = append(targets, e)
+		}
+	}
+	m.mutex.Unlock()
+
+	for _, e := range targets {
+		if e.state == Loading || e.reloading {
+			// The file may have been read before it changed
+			e.reloadAgain = true
+		} else {
+			m.startReload(e)
+		}
+	}
+
+	return len(targets)
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// startReload loads a new version of the asset of an entry.
+func (m *Manager) startReload(e *entry) {
+	log.DebugfCore("Reloading asset %s", e.path)
+	e.reloading = true
+
+	m.mutex.Lock()
+	m.start(&entry{manager: m, path: e.path, refs: 1, state: Loading, target: e})
+	m.mutex.Unlock()
+}
+
+// swap replaces the asset of the target of a finished entry with the new
+// version it loaded.
+func (m *Manager) swap(next *entry) {
+	target := next.target
+
+	m.mutex.Lock()
+	m.pending--
+	stopped := m.stopped
+	m.mutex.Unlock()
+
+	target.reloading = false
+	switch {
+	case target.state == Unloaded:
+		// Released while reloading
+		if next.err == nil {
+			next.state = Loaded
+		}
+		m.unload(next)
+		return
+	case next.err != nil:
+		if !stopped {
+			log.ErrorfCore("Failed to reload asset %s, keeping the previous version - %s", target.path, next.err.Error())
+		}
+		if target.state == Failed {
+			target.err = next.err
+		}
+		m.unload(next)
+	default:
+		previous, previousLoader, previousState := target.value, target.loader, target.state
+
+		m.mutex.Lock()
+		previousDeps := target.deps
+		target.deps, next.deps = next.deps, nil
+		target.files = next.files
+		m.mutex.Unlock()
+
+		target.value, target.loader = next.value, next.loader
+		target.state, target.err = Loaded, nil
+
+		if u, ok := previousLoader.(Unloader); ok && previousState == Loaded {
+			u.Unload(previous)
+		}
+		for _, dep := range previousDeps {
+			m.release(dep)
+		}
+
+		log.InfofCore("Reloaded asset %s", target.path)
+		m.notifyReloaded(target)
+	}
+
+	if target.reloadAgain {
+		target.reloadAgain = false
+		m.startReload(target)
+	}
+}
+
+// notifyReloaded calls the reload callbacks of a reloaded asset and of the
+// loaded assets depending on it, directly or indirectly, and sends an
+// AssetReloaded event for each of them.
+func (m *Manager) notifyReloaded(reloaded *entry) {
+	m.mutex.Lock()
+	affected := []*entry{reloaded}
+	seen := map[*entry]bool{reloaded: true}
+	for i := 0; i < len(affected); i++ {
+		for _, e := range m.entries {
+			if !seen[e] && e.state == Loaded && hasDep(e, affected[i]) {
+				seen[e] = true
+				affected = append(affected, e)
+			}
+		}
+	}
+	m.mutex.Unlock()
+
+	for _, e := range affected {
+		for _, f := range e.reloadCallbacks {
+			f()
+		}
+
+		if m.events != nil {
+			m.events(&event.AssetReloaded{Path: e.path, Cause: reloaded.path})
+		}
+	}
+}
+
+func hasDep(e, dep *entry) bool {
+	for _, d := range e.deps {
+		if d == dep {
+			return true
+		}
+	}
+
+	return false
+}
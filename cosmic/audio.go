@@ -0,0 +1,39 @@
+package cosmic
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/audio"
+	"github.com/lentus/cosmic-engine/cosmic/log"
+)
+
+// Sample rate the audio of applications is mixed at.
+const audioSampleRate = 48000
+
+// Audio returns the mixer playing the audio of the application. Sounds can
+// be played before the application runs, they are heard once it does.
+func (app *Application) Audio() *audio.Mixer {
+	if app.mixer == nil {
+		app.mixer = audio.NewMixer(audioSampleRate)
+	}
+
+	return app.mixer
+}
+
+// startAudio plays the mixer of the application on its audio device, or the
+// default output of the system. Without one, audio is mixed and discarded.
+func (app *Application) startAudio() audio.Device {
+	device := app.AudioDevice
+	if device == nil {
+		var err error
+		if device, err = audio.OpenDevice(); err != nil {
+			log.WarnfCore("No audio output, playing silently - %s", err.Error())
+			device = audio.NewNullDevice()
+		}
+	}
+
+	if err := device.Start(app.Audio()); err != nil {
+		log.ErrorfCore("Failed to start audio, playing silently - %s", err.Error())
+		device = audio.NewNullDevice()
+		device.Start(app.Audio())
+	}
+	return device
+}
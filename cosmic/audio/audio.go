@@ -0,0 +1,163 @@
+// Package audio decodes, mixes and plays sound. WAV and Ogg Vorbis files are
+// decoded into sounds held in memory, or streamed while they play for long
+// tracks like music. A mixer plays them on voices with their own volume,
+// pitch, pan and looping, grouped in buses, and renders the result for an
+// output device: the sound server of the system, a file or nothing at all.
+// A spatializer places voices in 3D space around a listener following the
+// camera.
+package audio
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Format describes interleaved samples: every frame holds one sample of
+// each channel, and the sample rate is the number of frames per second.
+type Format struct {
+	SampleRate int
+	Channels   int
+}
+
+// Stream is a source of samples, which are floats between -1 and 1.
+type Stream interface {
+	Format() Format
+	// Read reads up to len(samples) samples, a whole number of frames. It
+	// returns io.EOF at the end of the stream.
+	Read(samples []float32) (int, error)
+}
+
+// Rewinder is implemented by streams that can start over, which is needed
+// to loop them.
+type Rewinder interface {
+	Rewind() error
+}
+
+// Sound is audio decoded into memory.
+type Sound struct {
+	Format Format
+	// Interleaved samples of every frame
+	Samples []float32
+}
+
+// Frames returns the number of frames of the sound.
+func (s *Sound) Frames() int {
+	return len(s.Samples) / s.Format.Channels
+}
+
+// Duration returns how long the sound plays at its sample rate.
+func (s *Sound) Duration() time.Duration {
+	return time.Duration(s.Frames()) * time.Second / time.Duration(s.Format.SampleRate)
+}
+
+// Stream returns a stream playing the sound.
+func (s *Sound) Stream() Stream {
+	return &soundStream{sound: s}
+}
+
+type soundStream struct {
+	sound    *Sound
+	position int
+}
+
+func (s *soundStream) Format() Format {
+	return s.sound.Format
+}
+
+func (s *soundStream) Read(samples []float32) (int, error) {
+	if s.position == len(s.sound.Samples) {
+		return 0, io.EOF
+	}
+	samples = samples[:len(samples)/s.sound.Format.Channels*s.sound.Format.Channels]
+	n := copy(samples, s.sound.Samples[s.position:])
+	s.position += n
+	return n, nil
+}
+
+func (s *soundStream) Rewind() error {
+	s.position = 0
+	return nil
+}
+
+// Decode reads a WAV or Ogg Vorbis file into memory.
+func Decode(r io.Reader) (*Sound, error) {
+	stream, err := NewStream(r)
+	if err != nil {
+		return nil, err
+	}
+
+	sound := &Sound{Format: stream.Format()}
+	buffer := make([]float32, 4096*sound.Format.Channels)
+	for {
+		n, err := stream.Read(buffer)
+		sound.Samples = append(sound.Samples, buffer[:n]...)
+		if err == io.EOF {
+			return sound, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// NewStream returns a stream decoding a WAV or Ogg Vorbis file while it is
+// read. Streams of files that are io.Seekers can be rewound, and streams of
+// files that are io.Closers close them when they are closed themselves.
+func NewStream(r io.Reader) (Stream, error) {
+	start := int64(-1)
+	seeker, ok := r.(io.Seeker)
+	if ok {
+		if position, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			start = position
+		}
+	}
+
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, errors.New("not a sound file")
+	}
+	source := &source{r: r, start: start}
+	source.closer, _ = r.(io.Closer)
+	if start >= 0 {
+		if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+			return nil, err
+		}
+	} else {
+		source.r = io.MultiReader(bytes.NewReader(magic), r)
+	}
+
+	switch string(magic) {
+	case "RIFF":
+		return newWAVStream(source)
+	case "OggS":
+		return newVorbisStream(source)
+	}
+	return nil, fmt.Errorf("unsupported sound file %q", magic)
+}
+
+// source is the file a stream decodes.
+type source struct {
+	r io.Reader
+	// Offset of the file in the reader, -1 when it cannot seek
+	start  int64
+	closer io.Closer
+}
+
+// rewind seeks to the start of the file.
+func (s *source) rewind(offset int64) error {
+	if s.start < 0 {
+		return errors.New("sound file cannot be rewound")
+	}
+	_, err := s.r.(io.Seeker).Seek(s.start+offset, io.SeekStart)
+	return err
+}
+
+func (s *source) Close() error {
+	if s.closer != nil {
+		return s.closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,296 @@
+package audio
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// bitReader reads the fields of a Vorbis packet, which are packed starting
+// at the least significant bit of each byte. Reading past the end of the
+// packet returns zeros and sets eop.
+type bitReader struct {
+	data []byte
+	pos  int
+	eop  bool
+}
+
+func (r *bitReader) read(n int) uint32 {
+	var v uint32
+	for i := 0; i < n; i++ {
+		if r.pos>>3 >= len(r.data) {
+			r.eop = true
+			return 0
+		}
+		v |= uint32(r.data[r.pos>>3]>>(r.pos&7)&1) << i
+		r.pos++
+	}
+
+	return v
+}
+
+func (r *bitReader) flag() bool {
+	return r.read(1) == 1
+}
+
+// ilog returns the number of bits needed to store v.
+func ilog(v int) int {
+	n := 0
+	for ; v > 0; v >>= 1 {
+		n++
+	}
+	return n
+}
+
+// float32Unpack converts a float in the format of Vorbis codebooks.
+func float32Unpack(v uint32) float32 {
+	mantissa := float64(v & 0x1fffff)
+	if v&0x80000000 != 0 {
+		mantissa = -mantissa
+	}
+	return float32(math.Ldexp(mantissa, int(v>>21&0x3ff)-788))
+}
+
+// lookup1Values returns the number of values per dimension of a codebook of
+// lookup type 1, the largest number whose power of dimensions does not
+// exceed entries.
+func lookup1Values(entries, dimensions int) int {
+	r := int(math.Floor(math.Pow(float64(entries), 1/float64(dimensions))))
+	for pow(r+1, dimensions) <= entries {
+		r++
+	}
+	for r > 0 && pow(r, dimensions) > entries {
+		r--
+	}
+	return r
+}
+
+func pow(v, n int) int {
+	result := 1
+	for i := 0; i < n; i++ {
+		result *= v
+		if result > 1<<24 {
+			break
+		}
+	}
+	return result
+}
+
+// codebook decodes the Huffman coded entries of a Vorbis stream, and their
+// vectors when the codebook has them.
+type codebook struct {
+	dimensions int
+	entries    int
+	// Binary tree of the codewords, as the indices of the children of every
+	// node. Leaves are stored as -(entry + 1), missing nodes as 0.
+	tree []int32
+	// The only entry of a codebook with one codeword, -1 otherwise
+	single       int
+	singleLength int
+	// Vectors of the entries, dimensions values each, nil without lookup
+	values []float32
+}
+
+func readCodebook(r *bitReader) (*codebook, error) {
+	if r.read(24) != 0x564342 {
+		return nil, errors.New("invalid codebook sync pattern")
+	}
+	b := &codebook{dimensions: int(r.read(16)), entries: int(r.read(24)), single: -1}
+	if b.entries == 0 {
+		return nil, errors.New("codebook without entries")
+	}
+
+	lengths := make([]uint8, b.entries)
+	if !r.flag() {
+		sparse := r.flag()
+		for i := range lengths {
+			if !sparse || r.flag() {
+				lengths[i] = uint8(r.read(5) + 1)
+			}
+		}
+	} else {
+		length := r.read(5) + 1
+		for entry := 0; entry < b.entries; length++ {
+			n := int(r.read(ilog(b.entries - entry)))
+			if entry+n > b.entries || length > 32 {
+				return nil, errors.New("invalid ordered codeword lengths")
+			}
+			for i := entry; i < entry+n; i++ {
+				lengths[i] = uint8(length)
+			}
+			entry += n
+		}
+	}
+	if r.eop {
+		return nil, errors.New("truncated codebook")
+	}
+	if err := b.buildTree(lengths); err != nil {
+		return nil, err
+	}
+
+	switch lookup := r.read(4); lookup {
+	case 0:
+	case 1, 2:
+		if b.dimensions == 0 || b.entries*b.dimensions > 1<<24 {
+			return nil, fmt.Errorf("invalid vector codebook dimensions %d", b.dimensions)
+		}
+		minimum := float32Unpack(r.read(32))
+		delta := float32Unpack(r.read(32))
+		bits := int(r.read(4)) + 1
+		sequence := r.flag()
+
+		count := b.entries * b.dimensions
+		if lookup == 1 {
+			count = lookup1Values(b.entries, b.dimensions)
+			if count == 0 {
+				return nil, errors.New("invalid codebook lookup values")
+			}
+		}
+		if r.pos+count*bits > len(r.data)*8 {
+			return nil, errors.New("truncated codebook multiplicands")
+		}
+		multiplicands := make([]float32, count)
+		for i := range multiplicands {
+			multiplicands[i] = float32(r.read(bits))*delta + minimum
+		}
+
+		b.values = make([]float32, b.entries*b.dimensions)
+		for entry := 0; entry < b.entries; entry++ {
+			var last float32
+			divisor := 1
+			for i := 0; i < b.dimensions; i++ {
+				offset := entry*b.dimensions + i
+				if lookup == 1 {
+					offset = entry / divisor % count
+					divisor *= count
+				}
+				v := multiplicands[offset] + last
+				if sequence {
+					last = v
+				}
+				b.values[entry*b.dimensions+i] = v
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported codebook lookup type %d", lookup)
+	}
+
+	return b, nil
+}
+
+// buildTree assigns the codewords to the entries, each getting the lowest
+// free codeword of its length in the order of the entries.
+func (b *codebook) buildTree(lengths []uint8) error {
+	used := 0
+	for entry, length := range lengths {
+		if length > 0 {
+			used++
+			b.single, b.singleLength = entry, int(length)
+		}
+	}
+	if used <= 1 {
+		// A single codeword is read without a tree
+		return nil
+	}
+	b.single = -1
+
+	// available[i] is the lowest free codeword of length i, aligned to the
+	// most significant bit, or 0 when there is none
+	var available [33]uint32
+	b.tree = make([]int32, 2, 4*used)
+	first := true
+	for entry, length := range lengths {
+		if length == 0 {
+			continue
+		}
+		if first {
+			first = false
+			for i := 1; i <= int(length); i++ {
+				available[i] = 1 << (32 - i)
+			}
+			if err := b.insert(0, int(length), entry); err != nil {
+				return err
+			}
+			continue
+		}
+
+		z := int(length)
+		for z > 0 && available[z] == 0 {
+			z--
+		}
+		if z == 0 {
+			return errors.New("overspecified codebook")
+		}
+		codeword := available[z]
+		available[z] = 0
+		for y := int(length); y > z; y-- {
+			available[y] = codeword + 1<<(32-y)
+		}
+		if err := b.insert(codeword, int(length), entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *codebook) insert(codeword uint32, length, entry int) error {
+	node := 0
+	for i := 0; i < length; i++ {
+		child := 2*node + int(codeword>>(31-i)&1)
+		if b.tree[child] < 0 {
+			return errors.New("overspecified codebook")
+		}
+		if i == length-1 {
+			if b.tree[child] != 0 {
+				return errors.New("overspecified codebook")
+			}
+			b.tree[child] = int32(-(entry + 1))
+			break
+		}
+		if b.tree[child] == 0 {
+			b.tree[child] = int32(len(b.tree) / 2)
+			b.tree = append(b.tree, 0, 0)
+		}
+		node = int(b.tree[child])
+	}
+
+	return nil
+}
+
+// decode reads the next entry from the packet, or returns -1 at the end of
+// the packet or for an invalid codeword.
+func (b *codebook) decode(r *bitReader) int {
+	if b.single >= 0 {
+		r.read(b.singleLength)
+		if r.eop {
+			return -1
+		}
+		return b.single
+	}
+	if b.tree == nil {
+		return -1
+	}
+
+	node := 0
+	for {
+		next := b.tree[2*node+int(r.read(1))]
+		if r.eop || next == 0 {
+			return -1
+		}
+		if next < 0 {
+			return int(-next - 1)
+		}
+		node = int(next)
+	}
+}
+
+// vector reads the next entry from the packet and returns its vector, or nil
+// at the end of the packet.
+func (b *codebook) vector(r *bitReader) []float32 {
+	entry := b.decode(r)
+	if entry < 0 || b.values == nil {
+		return nil
+	}
+	return b.values[entry*b.dimensions : (entry+1)*b.dimensions]
+}
@@ -0,0 +1,135 @@
+package audio
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Source renders audio for a device, like a Mixer.
+type Source interface {
+	Format() Format
+	// Mix renders the next samples, interleaved in the format of the source.
+	Mix(out []float32)
+}
+
+// Device plays the audio of a source.
+type Device interface {
+	// Start renders the source on a goroutine of the device, as fast as it
+	// plays, until the device is closed.
+	Start(source Source) error
+	Close() error
+}
+
+// Interval at which devices without hardware render the audio that played
+// in the meantime.
+const clockInterval = 10 * time.Millisecond
+
+// clockDevice renders audio at the pace of the wall clock, for devices that
+// have no hardware to set it.
+type clockDevice struct {
+	// Called with the samples rendered at every tick
+	output func(samples []float32) error
+	// Called once the device stopped rendering
+	finish func() error
+
+	stop chan struct{}
+	done sync.WaitGroup
+	once sync.Once
+}
+
+// NewNullDevice returns a device that renders audio in real time and
+// discards it, for machines without sound.
+func NewNullDevice() Device {
+	return &clockDevice{}
+}
+
+// fileDevice renders audio into a WAV file.
+type fileDevice struct {
+	clockDevice
+	name string
+}
+
+// NewFileDevice returns a device that renders audio in real time into a WAV
+// file, which is complete once the device is closed.
+func NewFileDevice(name string) Device {
+	return &fileDevice{name: name}
+}
+
+func (d *fileDevice) Start(source Source) error {
+	file, err := os.Create(d.name)
+	if err != nil {
+		return err
+	}
+
+	w := newWAVWriter(file, source.Format(), -1)
+	d.output = func(samples []float32) error {
+		w.write(samples)
+		return w.err
+	}
+	d.finish = func() error {
+		err := w.finish()
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	}
+	return d.clockDevice.Start(source)
+}
+
+func (d *clockDevice) Start(source Source) error {
+	d.stop = make(chan struct{})
+	format := source.Format()
+	samples := make([]float32, 0, format.SampleRate*format.Channels/10)
+
+	d.done.Add(1)
+	go func() {
+		defer d.done.Done()
+		ticker := time.NewTicker(clockInterval)
+		defer ticker.Stop()
+
+		start := time.Now()
+		rendered := int64(0)
+		for {
+			select {
+			case <-d.stop:
+				return
+			case now := <-ticker.C:
+				frames := int64(now.Sub(start)) * int64(format.SampleRate) / int64(time.Second)
+				n := int(frames - rendered)
+				if n*format.Channels > cap(samples) {
+					// Skip what played while the process was suspended
+					n = cap(samples) / format.Channels
+				}
+				rendered = frames
+
+				samples = samples[:n*format.Channels]
+				source.Mix(samples)
+				if d.output != nil {
+					if err := d.output(samples); err != nil {
+						log.ErrorfCore("Failed to output audio - %s", err.Error())
+						return
+					}
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (d *clockDevice) Close() error {
+	var err error
+	d.once.Do(func() {
+		if d.stop == nil {
+			return
+		}
+		close(d.stop)
+		d.done.Wait()
+		if d.finish != nil {
+			err = d.finish()
+		}
+	})
+	return err
+}
@@ -0,0 +1,139 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/lentus/cosmic-engine/cosmic/log"
+	"io"
+	"math"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Frames rendered at once for the sound server, and the latency asked of it.
+const (
+	pipePeriod       = 512
+	pipeLatencyMsecs = 40
+)
+
+// pipeCloseTimeout is how long Close waits for the program to exit before
+// killing it, in case the sound server hangs.
+const pipeCloseTimeout = time.Second
+
+// pipeDevice plays audio by writing it to the standard input of a program
+// of the sound server, pacat for PulseAudio and PipeWire or aplay for ALSA.
+type pipeDevice struct {
+	pipeProgram
+
+	command *exec.Cmd
+	input   io.WriteCloser
+	stop    chan struct{}
+	done    sync.WaitGroup
+	once    sync.Once
+}
+
+// pipeProgram is a program playing raw float samples from its standard
+// input, with the arguments it takes for a format.
+type pipeProgram struct {
+	program string
+	args    func(format Format) []string
+}
+
+var pipePrograms = []pipeProgram{
+	{program: "pacat", args: func(format Format) []string {
+		return []string{
+			"--playback", "--raw", "--client-name=cosmic", "--format=float32le",
+			"--rate=" + strconv.Itoa(format.SampleRate),
+			"--channels=" + strconv.Itoa(format.Channels),
+			"--latency-msec=" + strconv.Itoa(pipeLatencyMsecs),
+		}
+	}},
+	{program: "aplay", args: func(format Format) []string {
+		return []string{
+			"-q", "-t", "raw", "-f", "FLOAT_LE",
+			"-r", strconv.Itoa(format.SampleRate),
+			"-c", strconv.Itoa(format.Channels),
+			"--buffer-time=" + strconv.Itoa(pipeLatencyMsecs*1000),
+		}
+	}},
+}
+
+// OpenDevice returns the default output of the system, through PulseAudio
+// or ALSA, whichever is installed.
+func OpenDevice() (Device, error) {
+	for _, program := range pipePrograms {
+		if _, err := exec.LookPath(program.program); err == nil {
+			return &pipeDevice{pipeProgram: program}, nil
+		}
+	}
+	return nil, errors.New("neither pacat nor aplay is installed")
+}
+
+func (d *pipeDevice) Start(source Source) error {
+	format := source.Format()
+	d.command = exec.Command(d.program, d.args(format)...)
+	input, err := d.command.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := d.command.Start(); err != nil {
+		return err
+	}
+	d.input = input
+	d.stop = make(chan struct{})
+
+	d.done.Add(1)
+	go func() {
+		defer d.done.Done()
+		samples := make([]float32, pipePeriod*format.Channels)
+		data := make([]byte, len(samples)*4)
+		for {
+			select {
+			case <-d.stop:
+				return
+			default:
+			}
+
+			source.Mix(samples)
+			for i, v := range samples {
+				binary.LittleEndian.PutUint32(data[i*4:], math.Float32bits(v))
+			}
+			// Writing blocks while the sound server has enough audio
+			if _, err := input.Write(data); err != nil {
+				select {
+				case <-d.stop:
+					// Close closed the input to unblock the write
+				default:
+					log.ErrorfCore("Failed to play audio with %s - %s", d.program, err.Error())
+				}
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Close closes the input before waiting for the writer, which may be blocked
+// writing to it, and the program, which plays what it has left and exits at
+// the end of its input. The program is killed when it does not exit in time.
+func (d *pipeDevice) Close() error {
+	var err error
+	d.once.Do(func() {
+		if d.command == nil || d.stop == nil {
+			return
+		}
+		close(d.stop)
+		d.input.Close()
+		d.done.Wait()
+
+		kill := time.AfterFunc(pipeCloseTimeout, func() {
+			d.command.Process.Kill()
+		})
+		err = d.command.Wait()
+		kill.Stop()
+	})
+	return err
+}
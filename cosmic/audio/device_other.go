@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package audio
+
+import (
+	"errors"
+	"runtime"
+)
+
+// OpenDevice returns the default output of the system, which is not
+// supported on this platform yet.
+func OpenDevice() (Device, error) {
+	return nil, errors.New("no audio output on " + runtime.GOOS)
+}
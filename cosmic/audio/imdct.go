@@ -0,0 +1,103 @@
+package audio
+
+import "math"
+
+// imdct computes the inverse MDCT of Vorbis blocks,
+//
+//	y[i] = sum over k of X[k] * cos(2π/n * (i + 1/2 + n/4) * (k + 1/2))
+//
+// for n outputs from n/2 coefficients. It is computed as a DCT-IV of the
+// coefficients, which is unfolded into the block, and the DCT-IV with a
+// complex FFT of a quarter of the block size.
+type imdct struct {
+	n int
+	// Twiddles before and after the FFT
+	pre, post []complex128
+	// Roots of unity of the FFT and its bit reversal permutation
+	roots   []complex128
+	reverse []int
+
+	z []complex128
+	u []float64
+}
+
+func newIMDCT(n int) *imdct {
+	m := n / 2
+	size := m / 2
+	t := &imdct{
+		n:       n,
+		pre:     make([]complex128, size),
+		post:    make([]complex128, size),
+		roots:   make([]complex128, size/2),
+		reverse: make([]int, size),
+		z:       make([]complex128, size),
+		u:       make([]float64, m),
+	}
+
+	for p := range t.pre {
+		t.pre[p] = cis(-math.Pi * float64(p) / float64(m))
+		t.post[p] = cis(-math.Pi * (float64(p) + 0.25) / float64(m))
+	}
+	for k := range t.roots {
+		t.roots[k] = cis(-2 * math.Pi * float64(k) / float64(size))
+	}
+	bits := ilog(size) - 1
+	for i := range t.reverse {
+		r := 0
+		for b := 0; b < bits; b++ {
+			r |= (i >> b & 1) << (bits - 1 - b)
+		}
+		t.reverse[i] = r
+	}
+
+	return t
+}
+
+func cis(angle float64) complex128 {
+	return complex(math.Cos(angle), math.Sin(angle))
+}
+
+// inverse transforms the n/2 coefficients into n samples.
+func (t *imdct) inverse(coefficients, samples []float32) {
+	m := t.n / 2
+	size := m / 2
+
+	// Pair the even coefficients with the odd ones from the end
+	for p := 0; p < size; p++ {
+		c := complex(float64(coefficients[2*p]), float64(coefficients[m-1-2*p]))
+		t.z[t.reverse[p]] = c * t.pre[p]
+	}
+	t.fft()
+	for q := 0; q < size; q++ {
+		s := t.z[q] * t.post[q]
+		t.u[2*q] = real(s)
+		t.u[m-1-2*q] = -imag(s)
+	}
+
+	// Unfold the DCT-IV, which is odd around its end and even around its
+	// start
+	for i := 0; i < m/2; i++ {
+		samples[i] = float32(t.u[i+m/2])
+	}
+	for i := m / 2; i < 3*m/2; i++ {
+		samples[i] = float32(-t.u[3*m/2-1-i])
+	}
+	for i := 3 * m / 2; i < 2*m; i++ {
+		samples[i] = float32(-t.u[i-3*m/2])
+	}
+}
+
+// fft transforms z in place, which is in bit reversed order.
+func (t *imdct) fft() {
+	size := len(t.z)
+	for half := 1; half < size; half *= 2 {
+		stride := size / (2 * half)
+		for start := 0; start < size; start += 2 * half {
+			for k := 0; k < half; k++ {
+				a, b := &t.z[start+k], &t.z[start+k+half]
+				w := t.roots[k*stride] * *b
+				*a, *b = *a+w, *a-w
+			}
+		}
+	}
+}
@@ -0,0 +1,435 @@
+package audio
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Mixer plays voices and renders them as stereo samples at its sample rate,
+// for an output device. Voices are controlled by the game while the device
+// renders them on its own goroutine.
+type Mixer struct {
+	sampleRate int
+
+	mutex  sync.Mutex
+	master *Bus
+	buses  map[string]*Bus
+	// Voices being played
+	voices []*Voice
+}
+
+// NewMixer returns a mixer rendering at a sample rate, with only the master
+// bus.
+func NewMixer(sampleRate int) *Mixer {
+	m := &Mixer{sampleRate: sampleRate, buses: make(map[string]*Bus)}
+	m.master = &Bus{mixer: m, name: "master", volume: 1}
+	m.buses[m.master.name] = m.master
+	return m
+}
+
+// Format returns the format of the samples rendered by the mixer.
+func (m *Mixer) Format() Format {
+	return Format{SampleRate: m.sampleRate, Channels: 2}
+}
+
+// Master returns the bus all other buses and voices end up in.
+func (m *Mixer) Master() *Bus {
+	return m.master
+}
+
+// NewBus adds a bus, which is mixed into its parent, or the master bus when
+// the parent is nil.
+func (m *Mixer) NewBus(name string, parent *Bus) *Bus {
+	if parent == nil {
+		parent = m.master
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	b := &Bus{mixer: m, name: name, parent: parent, volume: 1}
+	m.buses[name] = b
+	return b
+}
+
+// Bus returns the bus with a name, or nil if there is none.
+func (m *Mixer) Bus(name string) *Bus {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.buses[name]
+}
+
+// NewVoice returns a voice for a sound, which starts when it is played.
+func (m *Mixer) NewVoice(sound *Sound) *Voice {
+	return m.newVoice(sound.Format, sound, nil)
+}
+
+// NewStreamVoice returns a voice for a stream, like a long music track. The
+// stream is decoded ahead on a goroutine while it plays, and closed when the
+// voice stops, if it is an io.Closer. Streams loop only if they are
+// Rewinders.
+func (m *Mixer) NewStreamVoice(stream Stream) *Voice {
+	return m.newVoice(stream.Format(), nil, newStreamer(stream))
+}
+
+func (m *Mixer) newVoice(format Format, sound *Sound, stream *streamer) *Voice {
+	return &Voice{mixer: m, format: format, sound: sound, stream: stream, bus: m.master, volume: 1, pitch: 1}
+}
+
+// Play plays a sound once on the master bus, and returns its voice.
+func (m *Mixer) Play(sound *Sound) *Voice {
+	v := m.NewVoice(sound)
+	v.Play()
+	return v
+}
+
+// Playing returns the number of voices being played.
+func (m *Mixer) Playing() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return len(m.voices)
+}
+
+// Mix renders the voices being played into out, interleaved stereo frames.
+func (m *Mixer) Mix(out []float32) {
+	for i := range out {
+		out[i] = 0
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	playing := m.voices[:0]
+	for _, v := range m.voices {
+		if v.state == voicePlaying {
+			v.mix(out)
+		}
+		if v.state == voicePlaying {
+			playing = append(playing, v)
+		} else {
+			v.listed = false
+		}
+	}
+	for i := len(playing); i < len(m.voices); i++ {
+		m.voices[i] = nil
+	}
+	m.voices = playing
+}
+
+// Render renders a number of frames of a source, like a mixer, at once
+// instead of in real time.
+func Render(source Source, frames int) *Sound {
+	format := source.Format()
+	sound := &Sound{Format: format, Samples: make([]float32, frames*format.Channels)}
+	source.Mix(sound.Samples)
+	return sound
+}
+
+// Bus groups voices, like the music or the sound effects of a game, to set
+// their volume together.
+type Bus struct {
+	mixer  *Mixer
+	name   string
+	parent *Bus
+	volume float32
+	muted  bool
+}
+
+func (b *Bus) Name() string {
+	return b.name
+}
+
+// SetVolume sets the gain applied to the voices of the bus, 1 by default.
+func (b *Bus) SetVolume(volume float32) {
+	b.mixer.mutex.Lock()
+	defer b.mixer.mutex.Unlock()
+	b.volume = volume
+}
+
+func (b *Bus) Volume() float32 {
+	b.mixer.mutex.Lock()
+	defer b.mixer.mutex.Unlock()
+	return b.volume
+}
+
+// SetMuted silences the voices of the bus, and those of the buses in it,
+// without changing its volume.
+func (b *Bus) SetMuted(muted bool) {
+	b.mixer.mutex.Lock()
+	defer b.mixer.mutex.Unlock()
+	b.muted = muted
+}
+
+func (b *Bus) Muted() bool {
+	b.mixer.mutex.Lock()
+	defer b.mixer.mutex.Unlock()
+	return b.muted
+}
+
+// gain returns the gain of the bus and the buses it is in.
+func (b *Bus) gain() float32 {
+	if b.muted {
+		return 0
+	}
+	if b.parent != nil {
+		return b.volume * b.parent.gain()
+	}
+	return b.volume
+}
+
+type voiceState int
+
+const (
+	voiceStopped voiceState = iota
+	voicePlaying
+	voicePaused
+)
+
+// Voice plays a sound or a stream in a mixer. Sources with more than two
+// channels play their first two.
+type Voice struct {
+	mixer  *Mixer
+	format Format
+	sound  *Sound
+	stream *streamer
+
+	bus    *Bus
+	volume float32
+	pitch  float32
+	pan    float32
+	loop   bool
+
+	state  voiceState
+	listed bool
+	// Position in the sound, or in the buffer of the stream, in frames of
+	// the source
+	position float64
+	// Gains of the last frame rendered, which changes are ramped from to
+	// avoid clicks, and whether there is one
+	gains    [2]float32
+	rendered bool
+	// Where a spatializer placed the voice, nil for voices without emitter
+	spatial *spatialState
+}
+
+// Play starts or resumes the voice.
+func (v *Voice) Play() {
+	v.mixer.mutex.Lock()
+	defer v.mixer.mutex.Unlock()
+
+	if v.stream != nil {
+		if v.stream.closed {
+			return
+		}
+		v.stream.play()
+	}
+	v.state = voicePlaying
+	if !v.listed {
+		v.listed = true
+		v.mixer.voices = append(v.mixer.voices, v)
+	}
+}
+
+// Pause pauses the voice, which resumes where it was when played again.
+func (v *Voice) Pause() {
+	v.mixer.mutex.Lock()
+	defer v.mixer.mutex.Unlock()
+
+	if v.state == voicePlaying {
+		v.state = voicePaused
+	}
+}
+
+// Stop stops the voice. Voices of sounds start over when played again, those
+// of streams cannot be played again.
+func (v *Voice) Stop() {
+	v.mixer.mutex.Lock()
+	defer v.mixer.mutex.Unlock()
+	v.stop()
+}
+
+func (v *Voice) stop() {
+	v.state = voiceStopped
+	v.position = 0
+	v.rendered = false
+	if v.spatial != nil {
+		v.spatial.reset()
+	}
+	if v.stream != nil {
+		v.stream.close()
+	}
+}
+
+// Playing returns whether the voice is being played, which it no longer is
+// once a sound that does not loop ends.
+func (v *Voice) Playing() bool {
+	v.mixer.mutex.Lock()
+	defer v.mixer.mutex.Unlock()
+	return v.state == voicePlaying
+}
+
+// SetVolume sets the gain of the voice, 1 by default.
+func (v *Voice) SetVolume(volume float32) {
+	v.mixer.mutex.Lock()
+	defer v.mixer.mutex.Unlock()
+	v.volume = volume
+}
+
+// SetPitch sets the speed the voice plays at, 1 by default. Doubling it
+// plays an octave higher, in half the time.
+func (v *Voice) SetPitch(pitch float32) {
+	v.mixer.mutex.Lock()
+	defer v.mixer.mutex.Unlock()
+	if pitch > 0 {
+		v.pitch = pitch
+	}
+}
+
+// SetPan places the voice between the left speaker at -1 and the right one
+// at 1, in the center by default. Mono sources are panned keeping their
+// power, stereo ones by turning down the other side. Voices placed by a
+// spatializer are panned by it instead.
+func (v *Voice) SetPan(pan float32) {
+	v.mixer.mutex.Lock()
+	defer v.mixer.mutex.Unlock()
+	v.pan = float32(math.Max(-1, math.Min(1, float64(pan))))
+}
+
+// SetLoop sets whether the voice starts over at the end of its sound.
+func (v *Voice) SetLoop(loop bool) {
+	v.mixer.mutex.Lock()
+	defer v.mixer.mutex.Unlock()
+	v.loop = loop
+	if v.stream != nil {
+		v.stream.setLoop(loop)
+	}
+}
+
+// SetBus sets the bus the voice plays in, the master bus by default.
+func (v *Voice) SetBus(bus *Bus) {
+	v.mixer.mutex.Lock()
+	defer v.mixer.mutex.Unlock()
+	v.bus = bus
+}
+
+// Position returns how far the voice is in its sound, or how long a stream
+// has been playing.
+func (v *Voice) Position() time.Duration {
+	v.mixer.mutex.Lock()
+	defer v.mixer.mutex.Unlock()
+
+	position := v.position
+	if v.stream != nil {
+		position += float64(v.stream.dropped)
+	}
+	return time.Duration(position * float64(time.Second) / float64(v.format.SampleRate))
+}
+
+// targetGains returns the gains of the left and right output.
+func (v *Voice) targetGains() [2]float32 {
+	gain := v.volume * v.bus.gain()
+	if v.spatial != nil {
+		return [2]float32{gain * v.spatial.target.gains[0], gain * v.spatial.target.gains[1]}
+	}
+	if v.format.Channels == 1 {
+		angle := (float64(v.pan) + 1) * math.Pi / 4
+		return [2]float32{gain * float32(math.Cos(angle)), gain * float32(math.Sin(angle))}
+	}
+
+	return [2]float32{gain * float32(math.Min(1, 1-float64(v.pan))), gain * float32(math.Min(1, 1+float64(v.pan)))}
+}
+
+// mix adds the voice to the output, resampling it to the rate of the mixer.
+func (v *Voice) mix(out []float32) {
+	target := v.targetGains()
+	if !v.rendered {
+		v.gains, v.rendered = target, true
+	}
+	if v.stream != nil {
+		v.position = v.stream.compact(v.position, v.format.Channels)
+	}
+
+	step := float64(v.pitch) * float64(v.format.SampleRate) / float64(v.mixer.sampleRate)
+	if v.spatial != nil {
+		step *= float64(v.spatial.target.pitch)
+	}
+	frames := len(out) / 2
+	for i := 0; i < frames; i++ {
+		var left, right float32
+		var status sampleStatus
+		if v.stream != nil {
+			left, right, status = v.stream.sample(v.position, v.format.Channels)
+		} else {
+			left, right, status = v.sample()
+		}
+		if status == finished {
+			v.stop()
+			return
+		}
+		if status == starved {
+			// The stream is late, it continues where it was
+			continue
+		}
+
+		t := float32(i+1) / float32(frames)
+		if v.spatial != nil {
+			left, right = v.spatial.render((left+right)/2, t)
+		}
+		out[2*i] += left * (v.gains[0] + (target[0]-v.gains[0])*t)
+		out[2*i+1] += right * (v.gains[1] + (target[1]-v.gains[1])*t)
+
+		v.position += step
+		if v.sound != nil && v.position >= float64(v.sound.Frames()) && v.loop {
+			v.position = math.Mod(v.position, float64(v.sound.Frames()))
+		}
+	}
+	v.gains = target
+	if v.spatial != nil {
+		v.spatial.finish()
+	}
+}
+
+type sampleStatus int
+
+const (
+	available sampleStatus = iota
+	starved
+	finished
+)
+
+// sample returns the sound at the position of the voice, interpolated
+// between the frames around it.
+func (v *Voice) sample() (float32, float32, sampleStatus) {
+	frames := v.sound.Frames()
+	i := int(v.position)
+	if i >= frames {
+		return 0, 0, finished
+	}
+
+	next := i + 1
+	if next == frames && v.loop {
+		next = 0
+	}
+	return interpolate(v.sound.Samples, v.format.Channels, i, next, float32(v.position-float64(i)))
+}
+
+// interpolate interpolates linearly between two frames of interleaved
+// samples, the second of which may be past the end and silent.
+func interpolate(samples []float32, channels, i, next int, t float32) (float32, float32, sampleStatus) {
+	left := samples[i*channels]
+	right := left
+	if channels > 1 {
+		right = samples[i*channels+1]
+	}
+
+	var nextLeft, nextRight float32
+	if next*channels < len(samples) {
+		nextLeft = samples[next*channels]
+		nextRight = nextLeft
+		if channels > 1 {
+			nextRight = samples[next*channels+1]
+		}
+	}
+
+	return left + (nextLeft-left)*t, right + (nextRight-right)*t, available
+}
@@ -0,0 +1,238 @@
+package audio
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/log"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	log.Init(log.LevelWarn, log.LevelWarn)
+	os.Exit(m.Run())
+}
+
+// constantSound returns a sound of a number of frames at a constant value.
+func constantSound(sampleRate, channels, frames int, value float32) *Sound {
+	sound := &Sound{Format: Format{SampleRate: sampleRate, Channels: channels}, Samples: make([]float32, frames*channels)}
+	for i := range sound.Samples {
+		sound.Samples[i] = value
+	}
+	return sound
+}
+
+func near(a, b float32) bool {
+	return math.Abs(float64(a-b)) < 1e-4
+}
+
+func TestMixerVolumeAndPan(t *testing.T) {
+	m := NewMixer(100)
+	center := float32(math.Sqrt(0.5))
+
+	for _, test := range []struct {
+		channels    int
+		volume, pan float32
+		left, right float32
+	}{
+		{1, 1, 0, center, center},
+		{1, 0.5, 0, 0.5 * center, 0.5 * center},
+		{1, 1, -1, 1, 0},
+		{1, 1, 1, 0, 1},
+		{2, 1, 0, 1, 1},
+		{2, 1, 0.5, 0.5, 1},
+		{2, 0.5, -1, 0.5, 0},
+	} {
+		v := m.NewVoice(constantSound(100, test.channels, 100, 1))
+		v.SetVolume(test.volume)
+		v.SetPan(test.pan)
+		v.Play()
+
+		out := Render(m, 10).Samples
+		if !near(out[0], test.left) || !near(out[1], test.right) {
+			t.Errorf("%d channels at volume %g and pan %g: expected %g %g, got %g %g",
+				test.channels, test.volume, test.pan, test.left, test.right, out[0], out[1])
+		}
+		v.Stop()
+	}
+}
+
+func TestMixerRamp(t *testing.T) {
+	m := NewMixer(100)
+	v := m.Play(constantSound(100, 2, 100, 1))
+	Render(m, 10)
+
+	// Changes in gain are spread over the next mix
+	v.SetVolume(0)
+	out := Render(m, 10).Samples
+	if !near(out[0], 0.9) || !near(out[18], 0) {
+		t.Errorf("expected the volume to ramp down from 0.9 to 0, got %g to %g", out[0], out[18])
+	}
+}
+
+func TestMixerPitchAndLoop(t *testing.T) {
+	m := NewMixer(100)
+	sound := constantSound(100, 1, 100, 1)
+
+	// The sound is played twice as fast, in half its duration
+	v := m.NewVoice(sound)
+	v.SetPitch(2)
+	v.Play()
+	Render(m, 49)
+	if !v.Playing() {
+		t.Errorf("expected the voice to be playing before its end")
+	}
+	Render(m, 2)
+	if v.Playing() || m.Playing() != 0 {
+		t.Errorf("expected the voice to stop at its end")
+	}
+	if v.Position() != 0 {
+		t.Errorf("expected a stopped voice to start over, got position %s", v.Position())
+	}
+
+	v.SetPitch(1)
+	v.SetLoop(true)
+	v.Play()
+	Render(m, 150)
+	if !v.Playing() {
+		t.Errorf("expected a looping voice to keep playing")
+	}
+	if position := v.Position(); position != 500*time.Millisecond {
+		t.Errorf("expected the voice to start over, at 0.5s, got %s", position)
+	}
+
+	v.Pause()
+	Render(m, 100)
+	if position := v.Position(); position != 500*time.Millisecond {
+		t.Errorf("expected a paused voice to keep its position, got %s", position)
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	samples := []float32{0, 10, 1, 20}
+	if left, right, _ := interpolate(samples, 2, 0, 1, 0.25); left != 0.25 || right != 12.5 {
+		t.Errorf("expected 0.25 12.5, got %g %g", left, right)
+	}
+	// Past the end is silent
+	if left, right, _ := interpolate(samples, 2, 1, 2, 0.5); left != 0.5 || right != 10 {
+		t.Errorf("expected 0.5 10, got %g %g", left, right)
+	}
+}
+
+func TestMixerBuses(t *testing.T) {
+	m := NewMixer(100)
+	effects := m.NewBus("effects", nil)
+	footsteps := m.NewBus("footsteps", effects)
+	if m.Bus("footsteps") != footsteps {
+		t.Errorf("expected to find the bus by name")
+	}
+
+	v := m.NewVoice(constantSound(100, 2, 100, 1))
+	v.SetBus(footsteps)
+	v.Play()
+
+	m.Master().SetVolume(0.5)
+	effects.SetVolume(0.5)
+	footsteps.SetVolume(0.5)
+	out := Render(m, 10).Samples
+	if !near(out[0], 0.125) {
+		t.Errorf("expected the volumes of the buses to multiply to 0.125, got %g", out[0])
+	}
+
+	effects.SetMuted(true)
+	Render(m, 10)
+	out = Render(m, 10).Samples
+	if out[0] != 0 || !effects.Muted() || effects.Volume() != 0.5 {
+		t.Errorf("expected muting a bus to silence the buses in it, got %g", out[0])
+	}
+}
+
+func TestMixerStream(t *testing.T) {
+	m := NewMixer(100)
+	sound := constantSound(100, 2, 3*streamChunk+10, 0)
+	for i := range sound.Samples {
+		sound.Samples[i] = float32(i%1000+1) / 1000
+	}
+
+	v := m.NewStreamVoice(sound.Stream())
+	v.Play()
+	var played []float32
+	for deadline := time.Now().Add(5 * time.Second); v.Playing() && time.Now().Before(deadline); {
+		out := Render(m, 1000).Samples
+		for i := 0; i < len(out); i += 2 {
+			// Frames are silent while the stream is late
+			if out[i] != 0 {
+				played = append(played, out[i:i+2]...)
+			}
+		}
+	}
+
+	if v.Playing() {
+		t.Fatalf("expected the stream to end")
+	}
+	if !equalSamples(played, sound.Samples) {
+		t.Errorf("expected %d samples of the stream, got %d different ones", len(sound.Samples), len(played))
+	}
+
+	// Streams cannot be played again once stopped
+	v.Play()
+	if v.Playing() {
+		t.Errorf("expected a stopped stream not to play")
+	}
+}
+
+func TestFileDevice(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "out.wav")
+	m := NewMixer(8000)
+	v := m.Play(constantSound(8000, 1, 8000, 0.5))
+	v.SetLoop(true)
+
+	device := NewFileDevice(name)
+	if err := device.Start(m); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if err := device.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	sound, err := Decode(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sound.Format != m.Format() || sound.Frames() == 0 {
+		t.Errorf("expected %v audio, got %d frames of %v", m.Format(), sound.Frames(), sound.Format)
+	}
+	if len(sound.Samples) > 0 && !near(sound.Samples[0], 0.5*float32(math.Sqrt(0.5))) {
+		t.Errorf("expected the mixed sound, got %g", sound.Samples[0])
+	}
+}
+
+func TestNullDevice(t *testing.T) {
+	device := NewNullDevice()
+	if err := device.Close(); err != nil {
+		t.Errorf("expected closing a device that did not start to succeed, got %s", err)
+	}
+
+	device = NewNullDevice()
+	m := NewMixer(8000)
+	v := m.Play(constantSound(8000, 1, 80, 1))
+	if err := device.Start(m); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); v.Playing() && time.Now().Before(deadline); {
+		time.Sleep(clockInterval)
+	}
+	if err := device.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if v.Playing() {
+		t.Errorf("expected the device to play the sound")
+	}
+}
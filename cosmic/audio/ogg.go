@@ -0,0 +1,178 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	oggContinued = 0x01
+	oggFirst     = 0x02
+	oggLast      = 0x04
+)
+
+// oggCRC is the lookup table of the CRC of Ogg pages, with the polynomial
+// 0x04c11db7 and without reflection.
+var oggCRC = func() (table [256]uint32) {
+	for i := range table {
+		r := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if r&0x80000000 != 0 {
+				r = r<<1 ^ 0x04c11db7
+			} else {
+				r <<= 1
+			}
+		}
+		table[i] = r
+	}
+	return table
+}()
+
+func oggChecksum(data []byte) uint32 {
+	var crc uint32
+	for _, b := range data {
+		crc = crc<<8 ^ oggCRC[byte(crc>>24)^b]
+	}
+	return crc
+}
+
+// oggReader reads the packets of the first logical stream of an Ogg file.
+// Pages of other streams, like the video of a movie, are skipped.
+type oggReader struct {
+	r       io.Reader
+	serial  uint32
+	started bool
+	done    bool
+
+	header   [27]byte
+	segments []byte
+	body     []byte
+	// Index of the next segment and its offset in the body
+	segment int
+	offset  int
+	// Index of the last segment ending a packet in the page
+	lastEnd int
+	granule int64
+	last    bool
+
+	packet []byte
+}
+
+func newOggReader(r io.Reader) *oggReader {
+	return &oggReader{r: r, segments: make([]byte, 0, 255)}
+}
+
+// readPage reads the next page of the stream.
+func (o *oggReader) readPage() error {
+	for {
+		if _, err := io.ReadFull(o.r, o.header[:]); err != nil {
+			return err
+		}
+		if string(o.header[:4]) != "OggS" || o.header[4] != 0 {
+			return errors.New("invalid Ogg page")
+		}
+
+		o.segments = o.segments[:o.header[26]]
+		if _, err := io.ReadFull(o.r, o.segments); err != nil {
+			return unexpectedEOF(err)
+		}
+		size := 0
+		for _, s := range o.segments {
+			size += int(s)
+		}
+		if cap(o.body) < size {
+			o.body = make([]byte, size)
+		}
+		o.body = o.body[:size]
+		if _, err := io.ReadFull(o.r, o.body); err != nil {
+			return unexpectedEOF(err)
+		}
+
+		crc := binary.LittleEndian.Uint32(o.header[22:])
+		binary.LittleEndian.PutUint32(o.header[22:], 0)
+		page := oggChecksum(o.header[:])
+		for _, b := range o.segments {
+			page = page<<8 ^ oggCRC[byte(page>>24)^b]
+		}
+		for _, b := range o.body {
+			page = page<<8 ^ oggCRC[byte(page>>24)^b]
+		}
+		if page != crc {
+			return errors.New("corrupt Ogg page")
+		}
+
+		serial := binary.LittleEndian.Uint32(o.header[14:])
+		flags := o.header[5]
+		if !o.started {
+			if flags&oggFirst == 0 {
+				return errors.New("missing first page of Ogg stream")
+			}
+			o.started = true
+			o.serial = serial
+		} else if serial != o.serial {
+			continue
+		}
+
+		if flags&oggContinued == 0 && len(o.packet) > 0 {
+			return errors.New("incomplete Ogg packet")
+		}
+
+		o.segment, o.offset = 0, 0
+		o.lastEnd = -1
+		for i, s := range o.segments {
+			if s < 255 {
+				o.lastEnd = i
+			}
+		}
+		o.granule = int64(binary.LittleEndian.Uint64(o.header[6:]))
+		o.last = flags&oggLast != 0
+		return nil
+	}
+}
+
+// nextPacket returns the next packet of the stream, which is valid until
+// the next call. Granule is the granule position of the page when the packet
+// is the last one completed on it, and -1 otherwise. Last is set for the
+// last packet of the stream.
+func (o *oggReader) nextPacket() (packet []byte, granule int64, last bool, err error) {
+	o.packet = o.packet[:0]
+	for {
+		if o.segment == len(o.segments) {
+			if o.done {
+				return nil, -1, false, io.EOF
+			}
+			if err := o.readPage(); err != nil {
+				if err == io.EOF && len(o.packet) > 0 {
+					err = io.ErrUnexpectedEOF
+				}
+				return nil, -1, false, err
+			}
+			if o.last {
+				o.done = true
+			}
+			continue
+		}
+
+		size := int(o.segments[o.segment])
+		o.packet = append(o.packet, o.body[o.offset:o.offset+size]...)
+		o.offset += size
+		o.segment++
+
+		if size < 255 {
+			granule = -1
+			end := o.segment-1 == o.lastEnd
+			if end {
+				granule = o.granule
+			}
+			return o.packet, granule, end && o.last, nil
+		}
+	}
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,364 @@
+package audio
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/camera"
+	"github.com/lentus/cosmic-engine/cosmic/math"
+	stdmath "math"
+)
+
+// AttenuationModel is how the volume of an emitter falls off with its
+// distance to the listener.
+type AttenuationModel int
+
+const (
+	// AttenuationInverse halves the volume every time the distance past the
+	// reference distance doubles, like sound in the open.
+	AttenuationInverse AttenuationModel = iota
+	// AttenuationLinear fades the volume out between the reference and the
+	// maximum distance.
+	AttenuationLinear
+	// AttenuationExponential falls off with the distance raised to the power
+	// of the rolloff.
+	AttenuationExponential
+)
+
+// Attenuation describes how an emitter fades with distance, with the models
+// of OpenAL.
+type Attenuation struct {
+	Model AttenuationModel
+	// Distance within which the emitter plays at full volume
+	Reference float32
+	// Distance past which the emitter gets no quieter, or is silent with the
+	// linear model
+	Max float32
+	// How fast the volume falls off, 1 for the physical inverse model
+	Rolloff float32
+}
+
+// DefaultAttenuation is the attenuation of new emitters.
+var DefaultAttenuation = Attenuation{Model: AttenuationInverse, Reference: 1, Max: 100, Rolloff: 1}
+
+// Gain returns the volume of an emitter at a distance from the listener.
+func (a Attenuation) Gain(distance float32) float32 {
+	d := float64(distance)
+	reference, max, rolloff := float64(a.Reference), float64(a.Max), float64(a.Rolloff)
+	if reference <= 0 {
+		reference = 1e-3
+	}
+	d = stdmath.Max(reference, stdmath.Min(d, stdmath.Max(reference, max)))
+
+	var gain float64
+	switch a.Model {
+	case AttenuationLinear:
+		if max <= reference {
+			return 1
+		}
+		gain = 1 - rolloff*(d-reference)/(max-reference)
+	case AttenuationExponential:
+		gain = stdmath.Pow(d/reference, -rolloff)
+	default:
+		gain = reference / (reference + rolloff*(d-reference))
+	}
+	return float32(stdmath.Max(0, stdmath.Min(1, gain)))
+}
+
+// Listener is the point the world is heard from. It faces -z with +y up,
+// like cameras.
+type Listener struct {
+	Position    math.Vec3
+	Orientation math.Quat
+	Velocity    math.Vec3
+}
+
+// Emitter places a voice in the world. Its position and velocity are set by
+// the game every frame, before the spatializer updates.
+type Emitter struct {
+	Position math.Vec3
+	// Velocity in world units per second, which shifts the pitch of the voice
+	// as it moves towards or away from the listener
+	Velocity    math.Vec3
+	Attenuation Attenuation
+
+	voice *Voice
+}
+
+// Voice returns the voice the emitter places.
+func (e *Emitter) Voice() *Voice {
+	return e.voice
+}
+
+// Occluder returns how much of the sound of an emitter is blocked on its way
+// to the listener, from 0 when nothing is in between to 1 when it is behind a
+// wall. Games implement it with raycasts into their world.
+type Occluder func(listener math.Vec3, emitter *Emitter) float32
+
+// Constants of the spatializer, for a human head.
+const (
+	// Speed of sound in air, in meters per second
+	speedOfSound = 343
+	// Radius of the head in meters, which delays the sound at the far ear
+	headRadius = 0.0875
+	// Share of the panning of sources to the side, as the far ear still hears
+	// them around the head
+	panWidth = 0.85
+	// Cutoffs of the low-pass filters, in Hz: none, at the ear facing away
+	// from a source, behind the listener and behind an occluder
+	openCutoff     = 20000.0
+	shadowCutoff   = 4000
+	behindCutoff   = 10000
+	occludedCutoff = 1000
+	// Gain of fully occluded emitters
+	occludedGain = 0.3
+)
+
+// Spatializer places the voices of a mixer in 3D space around a listener. It
+// turns the position of every emitter into its volume and pan, delays and
+// filters the ear facing away from it, shifts its pitch with its velocity
+// and muffles it behind occluders. Voices with an emitter are mixed down to
+// mono before they are placed.
+//
+// A spatializer is used from one goroutine, like the game loop, which feeds
+// it positions and calls Update every frame. The mixer interpolates between
+// updates.
+type Spatializer struct {
+	Listener Listener
+	// Camera the listener follows when not nil, like the active camera of
+	// the scene, see Update.
+	Camera camera.Camera
+	// Units per meter of the world, 1 by default
+	Scale float32
+	// Scales the pitch shift of moving emitters, 1 by default and 0 to turn
+	// it off
+	DopplerFactor float32
+	Occluder      Occluder
+
+	mixer    *Mixer
+	emitters []*Emitter
+	// Position of the camera at the previous update, to derive the velocity
+	// of the listener
+	cameraPosition math.Vec3
+	followed       camera.Camera
+}
+
+// NewSpatializer returns a spatializer for the voices of a mixer.
+func NewSpatializer(mixer *Mixer) *Spatializer {
+	return &Spatializer{
+		Listener:      Listener{Orientation: math.IdentityQuat()},
+		Scale:         1,
+		DopplerFactor: 1,
+		mixer:         mixer,
+	}
+}
+
+// NewEmitter places a voice of the mixer at a position, until the emitter is
+// removed.
+func (s *Spatializer) NewEmitter(voice *Voice, position math.Vec3) *Emitter {
+	e := &Emitter{Position: position, Attenuation: DefaultAttenuation, voice: voice}
+	s.emitters = append(s.emitters, e)
+
+	target := s.place(e, 0)
+	s.mixer.mutex.Lock()
+	defer s.mixer.mutex.Unlock()
+	voice.spatial = &spatialState{target: target}
+	return e
+}
+
+// Remove removes an emitter, its voice plays as it did before.
+func (s *Spatializer) Remove(e *Emitter) {
+	for i, other := range s.emitters {
+		if other == e {
+			s.emitters = append(s.emitters[:i], s.emitters[i+1:]...)
+			break
+		}
+	}
+
+	s.mixer.mutex.Lock()
+	defer s.mixer.mutex.Unlock()
+	e.voice.spatial = nil
+}
+
+// Emitters returns the emitters of the spatializer.
+func (s *Spatializer) Emitters() []*Emitter {
+	return s.emitters
+}
+
+// Update moves the listener with its camera and places the voices of the
+// emitters, with the time in seconds since the previous update.
+func (s *Spatializer) Update(delta float32) {
+	if s.Camera != nil {
+		s.followCamera(delta)
+	}
+
+	targets := make([]spatialTarget, len(s.emitters))
+	for i, e := range s.emitters {
+		var occlusion float32
+		if s.Occluder != nil {
+			occlusion = clamp(s.Occluder(s.Listener.Position, e), 0, 1)
+		}
+		targets[i] = s.place(e, occlusion)
+	}
+
+	s.mixer.mutex.Lock()
+	defer s.mixer.mutex.Unlock()
+	for i, e := range s.emitters {
+		e.voice.spatial.target = targets[i]
+	}
+}
+
+// followCamera moves the listener to the camera, deriving its velocity from
+// the distance it moved since the previous update.
+func (s *Spatializer) followCamera(delta float32) {
+	transform := s.Camera.GetTransform()
+	s.Listener.Velocity = math.Vec3{}
+	if s.followed == s.Camera && delta > 0 {
+		s.Listener.Velocity = transform.Position.Sub(s.cameraPosition).Scale(1 / delta)
+	}
+	s.Listener.Position = transform.Position
+	s.Listener.Orientation = transform.Orientation
+	s.cameraPosition, s.followed = transform.Position, s.Camera
+}
+
+// spatialTarget is where the spatializer placed a voice.
+type spatialTarget struct {
+	// Gains of the left and right ear
+	gains [2]float32
+	// Delays of the ears, in frames of the mixer, and the coefficients of
+	// their low-pass filters
+	delays       [2]float32
+	coefficients [2]float32
+	pitch        float32
+}
+
+// place returns the gains, delays, filters and pitch of an emitter.
+func (s *Spatializer) place(e *Emitter, occlusion float32) spatialTarget {
+	offset := e.Position.Sub(s.Listener.Position)
+	distance := offset.Len()
+	gain := e.Attenuation.Gain(distance) * (1 - occlusion*(1-occludedGain))
+
+	// Direction of the emitter in the space of the listener, to the right
+	// and behind
+	var lateral, behind float32
+	if distance > 1e-6 {
+		local := s.Listener.Orientation.Conjugate().Rotate(offset.Scale(1 / distance))
+		lateral = clamp(local.X, -1, 1)
+		behind = clamp(local.Z, 0, 1)
+	}
+
+	// Pan with constant power, and delay the far ear by the time sound takes
+	// around the head
+	angle := (float64(lateral*panWidth) + 1) * stdmath.Pi / 4
+	target := spatialTarget{
+		gains: [2]float32{gain * float32(stdmath.Cos(angle)), gain * float32(stdmath.Sin(angle))},
+		pitch: s.doppler(e, offset, distance),
+	}
+	theta := stdmath.Asin(stdmath.Abs(float64(lateral)))
+	delay := float32(headRadius / speedOfSound * (theta + stdmath.Sin(theta)) * float64(s.mixer.sampleRate))
+	far := 1
+	if lateral > 0 {
+		far = 0
+	}
+	target.delays[far] = delay
+
+	cutoff := openCutoff * stdmath.Pow(behindCutoff/openCutoff, float64(behind)) *
+		stdmath.Pow(occludedCutoff/openCutoff, float64(occlusion))
+	for ear := range target.coefficients {
+		earCutoff := cutoff
+		if ear == far {
+			earCutoff *= stdmath.Pow(shadowCutoff/openCutoff, stdmath.Abs(float64(lateral)))
+		}
+		target.coefficients[ear] = lowPass(earCutoff, s.mixer.sampleRate)
+	}
+
+	return target
+}
+
+// doppler returns the pitch shift of an emitter moving relative to the
+// listener, an octave at most either way.
+func (s *Spatializer) doppler(e *Emitter, offset math.Vec3, distance float32) float32 {
+	if s.DopplerFactor <= 0 || distance < 1e-6 {
+		return 1
+	}
+
+	// Speeds towards each other along the line between them, slower than
+	// sound
+	c := float32(speedOfSound)
+	if s.Scale > 0 {
+		c *= s.Scale
+	}
+	limit := c / s.DopplerFactor * 0.99
+	direction := offset.Scale(1 / distance)
+	listener := clamp(s.Listener.Velocity.Dot(direction), -limit, limit)
+	emitter := clamp(-e.Velocity.Dot(direction), -limit, limit)
+
+	pitch := (c + s.DopplerFactor*listener) / (c - s.DopplerFactor*emitter)
+	return clamp(pitch, 0.5, 2)
+}
+
+// lowPass returns the coefficient of a one-pole low-pass filter with a
+// cutoff, 1 when it is above what the sample rate can hold.
+func lowPass(cutoff float64, sampleRate int) float32 {
+	if cutoff >= float64(sampleRate)/2 {
+		return 1
+	}
+	return float32(1 - stdmath.Exp(-2*stdmath.Pi*cutoff/float64(sampleRate)))
+}
+
+func clamp(v, min, max float32) float32 {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+// Frames of the mono signal kept to delay the ears, more than the delay
+// around the head at 96 kHz.
+const spatialHistory = 128
+
+// spatialState renders a voice where the spatializer placed it. The target is
+// set by the spatializer, the rest belongs to the mixer.
+type spatialState struct {
+	target spatialTarget
+
+	history  [spatialHistory]float32
+	written  int
+	delays   [2]float32
+	filtered [2]float32
+	rendered bool
+}
+
+// render returns the ears hearing the next frame of the voice, ramping the
+// delays from the previous mix to the target at t.
+func (s *spatialState) render(sample float32, t float32) (float32, float32) {
+	if !s.rendered {
+		s.delays, s.rendered = s.target.delays, true
+	}
+
+	s.history[s.written%spatialHistory] = sample
+	var ears [2]float32
+	for ear := range ears {
+		delay := s.delays[ear] + (s.target.delays[ear]-s.delays[ear])*t
+		whole := int(delay)
+		fraction := delay - float32(whole)
+		current := s.history[(s.written-whole+spatialHistory)%spatialHistory]
+		previous := s.history[(s.written-whole-1+spatialHistory)%spatialHistory]
+		delayed := current + (previous-current)*fraction
+
+		s.filtered[ear] += s.target.coefficients[ear] * (delayed - s.filtered[ear])
+		ears[ear] = s.filtered[ear]
+	}
+	s.written = (s.written + 1) % spatialHistory
+	return ears[0], ears[1]
+}
+
+// finish ends a mix, the next one ramps from the target.
+func (s *spatialState) finish() {
+	s.delays = s.target.delays
+}
+
+// reset forgets what the voice played, when it stops.
+func (s *spatialState) reset() {
+	*s = spatialState{target: s.target}
+}
@@ -0,0 +1,190 @@
+package audio
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/camera"
+	"github.com/lentus/cosmic-engine/cosmic/math"
+	stdmath "math"
+	"testing"
+	"time"
+)
+
+func TestAttenuation(t *testing.T) {
+	for _, test := range []struct {
+		attenuation Attenuation
+		distance    float32
+		gain        float32
+	}{
+		{Attenuation{AttenuationInverse, 1, 100, 1}, 0.5, 1},
+		{Attenuation{AttenuationInverse, 1, 100, 1}, 2, 0.5},
+		{Attenuation{AttenuationInverse, 1, 100, 1}, 1000, 0.01},
+		{Attenuation{AttenuationInverse, 2, 100, 0.5}, 6, 0.5},
+		{Attenuation{AttenuationLinear, 1, 101, 1}, 51, 0.5},
+		{Attenuation{AttenuationLinear, 1, 101, 1}, 200, 0},
+		{Attenuation{AttenuationExponential, 1, 100, 0.5}, 4, 0.5},
+		{Attenuation{AttenuationExponential, 1, 100, 2}, 10, 0.01},
+	} {
+		if gain := test.attenuation.Gain(test.distance); !near(gain, test.gain) {
+			t.Errorf("%+v at %g: expected gain %g, got %g", test.attenuation, test.distance, test.gain, gain)
+		}
+	}
+}
+
+// renderEmitter renders a sound placed at a position around the listener of
+// a new spatializer.
+func renderEmitter(sound *Sound, position math.Vec3, frames int, setup func(s *Spatializer, e *Emitter)) *Sound {
+	m := NewMixer(48000)
+	s := NewSpatializer(m)
+	v := m.NewVoice(sound)
+	e := s.NewEmitter(v, position)
+	if setup != nil {
+		setup(s, e)
+	}
+	s.Update(0)
+	v.Play()
+	return Render(m, frames)
+}
+
+func TestSpatializerPan(t *testing.T) {
+	sound := constantSound(48000, 1, 48000, 1)
+	last := func(position math.Vec3) (float32, float32) {
+		out := renderEmitter(sound, position, 4800, nil).Samples
+		return out[len(out)-2], out[len(out)-1]
+	}
+
+	left, right := last(math.Vec3{Z: -1})
+	if !near(left, right) || !near(left, float32(stdmath.Sqrt(0.5))) {
+		t.Errorf("expected a source ahead to be centered, got %g %g", left, right)
+	}
+
+	left, right = last(math.Vec3{X: 1})
+	if right <= 2*left || left <= 0 {
+		t.Errorf("expected a source to the right to be louder in the right ear, got %g %g", left, right)
+	}
+	mirroredLeft, mirroredRight := last(math.Vec3{X: -1})
+	if !near(mirroredLeft, right) || !near(mirroredRight, left) {
+		t.Errorf("expected a source to the left to mirror one to the right, got %g %g", mirroredLeft, mirroredRight)
+	}
+
+	// Distance attenuates the source, without moving it
+	farLeft, farRight := last(math.Vec3{X: 4})
+	if !near(farLeft, left/4) || !near(farRight, right/4) {
+		t.Errorf("expected a source 4 times as far to be 4 times quieter, got %g %g", farLeft, farRight)
+	}
+}
+
+func TestSpatializerDelay(t *testing.T) {
+	impulse := &Sound{Format: Format{SampleRate: 48000, Channels: 1}, Samples: make([]float32, 200)}
+	impulse.Samples[0] = 1
+	out := renderEmitter(impulse, math.Vec3{X: 1}, 200, nil).Samples
+
+	peak := func(channel int) int {
+		best := 0
+		for i := channel; i < len(out); i += 2 {
+			if out[i] > out[best*2+channel] {
+				best = i / 2
+			}
+		}
+		return best
+	}
+
+	// Sound reaches the far ear after going around the head
+	delay := headRadius / speedOfSound * (stdmath.Pi/2 + 1) * 48000
+	if peak(1) != 0 {
+		t.Errorf("expected the right ear to hear the impulse first, got frame %d", peak(1))
+	}
+	if left := peak(0); stdmath.Abs(float64(left)-delay) > 1 {
+		t.Errorf("expected the left ear to hear the impulse after %.1f frames, got %d", delay, left)
+	}
+}
+
+func TestSpatializerCamera(t *testing.T) {
+	m := NewMixer(48000)
+	s := NewSpatializer(m)
+	c := camera.NewPerspective(1, 1, 0.1, 100)
+	c.Orientation = math.QuatAxisAngle(math.Vec3{Y: 1}, stdmath.Pi)
+	s.Camera = c
+
+	v := m.NewVoice(constantSound(48000, 1, 48000, 1))
+	s.NewEmitter(v, math.Vec3{X: 1})
+	v.Play()
+	s.Update(0)
+
+	// The camera faces +z, with +x to its left
+	out := Render(m, 4800).Samples
+	if left, right := out[len(out)-2], out[len(out)-1]; left <= right {
+		t.Errorf("expected a source at +x to be on the left of a camera turned around, got %g %g", left, right)
+	}
+
+	c.Position = math.Vec3{Z: 1}
+	s.Update(0.5)
+	if velocity := s.Listener.Velocity; !near(velocity.Z, 2) || s.Listener.Position != c.Position {
+		t.Errorf("expected the listener to follow the camera at 2 units per second, got %v", velocity)
+	}
+}
+
+func TestSpatializerDoppler(t *testing.T) {
+	sound := constantSound(48000, 1, 48000, 1)
+	for _, test := range []struct {
+		velocity math.Vec3
+		pitch    float64
+	}{
+		{math.Vec3{}, 1},
+		{math.Vec3{X: -34.3}, 343 / (343 - 34.3)},
+		{math.Vec3{X: 34.3}, 343 / (343 + 34.3)},
+		{math.Vec3{Y: 34.3}, 1},
+	} {
+		m := NewMixer(48000)
+		s := NewSpatializer(m)
+		v := m.Play(sound)
+		e := s.NewEmitter(v, math.Vec3{X: 10})
+		e.Velocity = test.velocity
+		s.Update(0)
+
+		Render(m, 4800)
+		expected := time.Duration(test.pitch * float64(100*time.Millisecond))
+		if position := v.Position(); (position - expected).Abs() > time.Millisecond/10 {
+			t.Errorf("moving at %v: expected to play %s, got %s", test.velocity, expected, position)
+		}
+	}
+}
+
+func TestSpatializerOcclusion(t *testing.T) {
+	sound := constantSound(48000, 1, 48000, 1)
+	open := renderEmitter(sound, math.Vec3{Z: -1}, 4800, nil).Samples
+
+	var occluded *Emitter
+	muffled := renderEmitter(sound, math.Vec3{Z: -1}, 4800, func(s *Spatializer, e *Emitter) {
+		s.Occluder = func(listener math.Vec3, emitter *Emitter) float32 {
+			occluded = emitter
+			return 1
+		}
+	}).Samples
+
+	if occluded == nil {
+		t.Fatalf("expected the occluder to be called for the emitter")
+	}
+	if ratio := muffled[len(muffled)-1] / open[len(open)-1]; !near(ratio, occludedGain) {
+		t.Errorf("expected an occluded source to be attenuated to %g, got %g", float32(occludedGain), ratio)
+	}
+	// The low-pass filter smooths the start of the sound
+	if muffled[0] >= open[0]*occludedGain {
+		t.Errorf("expected an occluded source to be muffled")
+	}
+}
+
+func TestSpatializerRemove(t *testing.T) {
+	m := NewMixer(48000)
+	s := NewSpatializer(m)
+	v := m.Play(constantSound(48000, 1, 48000, 1))
+	e := s.NewEmitter(v, math.Vec3{X: 1})
+	s.Update(0)
+	Render(m, 100)
+
+	s.Remove(e)
+	s.Update(0)
+	Render(m, 100)
+	out := Render(m, 100).Samples
+	if !near(out[0], out[1]) || len(s.Emitters()) != 0 {
+		t.Errorf("expected the voice to be centered once its emitter is removed, got %g %g", out[0], out[1])
+	}
+}
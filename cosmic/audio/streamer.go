@@ -0,0 +1,160 @@
+package audio
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/log"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// Frames decoded at once by streamers, and the number of such chunks they
+// decode ahead: about half a second at 44.1 kHz.
+const (
+	streamChunk  = 4096
+	streamChunks = 5
+)
+
+// streamer decodes a stream on a goroutine, ahead of the voice playing it,
+// from the first time it plays.
+type streamer struct {
+	stream  Stream
+	chunks  chan []float32
+	stop    chan struct{}
+	loop    int32
+	start   sync.Once
+	stopped sync.Once
+
+	// Owned by the mixer: the frames received, those dropped from the front
+	// so far, whether all were received and whether the voice stopped
+	buffer  []float32
+	dropped int64
+	ended   bool
+	closed  bool
+}
+
+func newStreamer(stream Stream) *streamer {
+	return &streamer{
+		stream: stream,
+		chunks: make(chan []float32, streamChunks),
+		stop:   make(chan struct{}),
+	}
+}
+
+func (s *streamer) play() {
+	s.start.Do(func() { go s.run() })
+}
+
+func (s *streamer) run() {
+	defer close(s.chunks)
+	defer func() {
+		if closer, ok := s.stream.(io.Closer); ok {
+			closer.Close()
+		}
+	}()
+
+	channels := s.stream.Format().Channels
+	read := 0
+	for {
+		chunk := make([]float32, streamChunk*channels)
+		n, err := readFull(s.stream, chunk)
+		read += n
+		if n > 0 {
+			select {
+			case s.chunks <- chunk[:n]:
+			case <-s.stop:
+				return
+			}
+		}
+
+		if err == io.EOF {
+			rewinder, ok := s.stream.(Rewinder)
+			if atomic.LoadInt32(&s.loop) == 0 || !ok || read == 0 {
+				return
+			}
+			if err := rewinder.Rewind(); err != nil {
+				log.ErrorfCore("Failed to loop stream - %s", err.Error())
+				return
+			}
+			read = 0
+		} else if err != nil {
+			log.ErrorfCore("Failed to decode stream - %s", err.Error())
+			return
+		}
+	}
+}
+
+// readFull reads until the samples are full or the stream ends.
+func readFull(stream Stream, samples []float32) (int, error) {
+	n := 0
+	for n < len(samples) {
+		read, err := stream.Read(samples[n:])
+		n += read
+		if err != nil {
+			return n, err
+		}
+		if read == 0 {
+			break
+		}
+	}
+	return n, nil
+}
+
+func (s *streamer) setLoop(loop bool) {
+	var v int32
+	if loop {
+		v = 1
+	}
+	atomic.StoreInt32(&s.loop, v)
+}
+
+// close stops decoding, and closes the stream.
+func (s *streamer) close() {
+	s.closed = true
+	s.stopped.Do(func() { close(s.stop) })
+	// The goroutine closes the stream once it started
+	s.start.Do(func() {
+		if closer, ok := s.stream.(io.Closer); ok {
+			closer.Close()
+		}
+	})
+}
+
+// compact drops the frames before a position from the buffer, and returns
+// the position in what is left.
+func (s *streamer) compact(position float64, channels int) float64 {
+	frames := int(position)
+	if frames*channels > len(s.buffer) {
+		frames = len(s.buffer) / channels
+	}
+	n := copy(s.buffer, s.buffer[frames*channels:])
+	s.buffer = s.buffer[:n]
+	s.dropped += int64(frames)
+	return position - float64(frames)
+}
+
+// sample returns the stream at a position in the buffer, receiving decoded
+// chunks as they are needed.
+func (s *streamer) sample(position float64, channels int) (float32, float32, sampleStatus) {
+	i := int(position)
+	for !s.ended && len(s.buffer) < (i+2)*channels {
+		select {
+		case chunk, ok := <-s.chunks:
+			if !ok {
+				s.ended = true
+				break
+			}
+			s.buffer = append(s.buffer, chunk...)
+		default:
+			if len(s.buffer) < (i+1)*channels {
+				return 0, 0, starved
+			}
+			// The next frame is late, hold the current one
+			return interpolate(s.buffer, channels, i, i, 0)
+		}
+	}
+
+	if len(s.buffer) < (i+1)*channels {
+		return 0, 0, finished
+	}
+	return interpolate(s.buffer, channels, i, i+1, float32(position-float64(i)))
+}
@@ -0,0 +1,335 @@
+package audio
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The setup of a Vorbis stream, read from its three header packets, as
+// described by the Vorbis I specification.
+
+type floor1 struct {
+	partitions []int
+	classes    []floor1Class
+	multiplier int
+	xs         []int
+	// Posts in order of x, and the neighbours of every post in the order of
+	// the stream
+	sorted []int
+	low    []int
+	high   []int
+}
+
+type floor1Class struct {
+	dimensions int
+	subclasses int
+	masterbook int
+	books      []int
+}
+
+type residue struct {
+	kind            int
+	begin, end      int
+	partitionSize   int
+	classifications int
+	classbook       int
+	// Book of every classification for each of the eight passes, -1 when the
+	// pass is skipped
+	books [][8]int
+}
+
+type couplingStep struct {
+	magnitude, angle int
+}
+
+type mapping struct {
+	coupling []couplingStep
+	// Submap of every channel, and the floor and residue of every submap
+	mux      []int
+	floors   []int
+	residues []int
+}
+
+type mode struct {
+	long    bool
+	mapping int
+}
+
+type vorbisSetup struct {
+	channels   int
+	sampleRate int
+	blocksize  [2]int
+
+	codebooks []*codebook
+	floors    []*floor1
+	residues  []*residue
+	mappings  []*mapping
+	modes     []mode
+}
+
+// readHeader checks the common header of Vorbis header packets.
+func readHeader(packet []byte, kind byte) (*bitReader, error) {
+	if len(packet) < 7 || packet[0] != kind || string(packet[1:7]) != "vorbis" {
+		return nil, fmt.Errorf("missing Vorbis header %d", kind)
+	}
+	return &bitReader{data: packet[7:]}, nil
+}
+
+// readIdentification reads the first header, with the format of the stream.
+func (s *vorbisSetup) readIdentification(packet []byte) error {
+	r, err := readHeader(packet, 1)
+	if err != nil {
+		return err
+	}
+
+	if version := r.read(32); version != 0 {
+		return fmt.Errorf("unsupported Vorbis version %d", version)
+	}
+	s.channels = int(r.read(8))
+	s.sampleRate = int(r.read(32))
+	r.read(32 * 3) // Bitrates
+	s.blocksize[0] = 1 << r.read(4)
+	s.blocksize[1] = 1 << r.read(4)
+	if !r.flag() || r.eop {
+		return errors.New("invalid Vorbis identification header")
+	}
+	if s.channels == 0 || s.sampleRate == 0 {
+		return errors.New("Vorbis stream without audio")
+	}
+	if s.blocksize[0] < 64 || s.blocksize[1] > 8192 || s.blocksize[0] > s.blocksize[1] {
+		return fmt.Errorf("invalid Vorbis block sizes %d and %d", s.blocksize[0], s.blocksize[1])
+	}
+
+	return nil
+}
+
+// readSetup reads the third header, with the codebooks and the configuration
+// of the decoder.
+func (s *vorbisSetup) readSetup(packet []byte) error {
+	r, err := readHeader(packet, 5)
+	if err != nil {
+		return err
+	}
+
+	s.codebooks = make([]*codebook, r.read(8)+1)
+	for i := range s.codebooks {
+		if s.codebooks[i], err = readCodebook(r); err != nil {
+			return fmt.Errorf("codebook %d: %s", i, err.Error())
+		}
+	}
+
+	// Time domain transforms are placeholders
+	for i := r.read(6) + 1; i > 0; i-- {
+		if r.read(16) != 0 {
+			return errors.New("invalid time domain transform")
+		}
+	}
+
+	s.floors = make([]*floor1, r.read(6)+1)
+	for i := range s.floors {
+		if kind := r.read(16); kind != 1 {
+			return fmt.Errorf("unsupported floor type %d", kind)
+		}
+		if s.floors[i], err = s.readFloor1(r); err != nil {
+			return fmt.Errorf("floor %d: %s", i, err.Error())
+		}
+	}
+
+	s.residues = make([]*residue, r.read(6)+1)
+	for i := range s.residues {
+		if s.residues[i], err = s.readResidue(r); err != nil {
+			return fmt.Errorf("residue %d: %s", i, err.Error())
+		}
+	}
+
+	s.mappings = make([]*mapping, r.read(6)+1)
+	for i := range s.mappings {
+		if s.mappings[i], err = s.readMapping(r); err != nil {
+			return fmt.Errorf("mapping %d: %s", i, err.Error())
+		}
+	}
+
+	s.modes = make([]mode, r.read(6)+1)
+	for i := range s.modes {
+		m := &s.modes[i]
+		m.long = r.flag()
+		if r.read(16) != 0 || r.read(16) != 0 {
+			return errors.New("invalid window or transform type")
+		}
+		m.mapping = int(r.read(8))
+		if m.mapping >= len(s.mappings) {
+			return fmt.Errorf("mode %d: invalid mapping %d", i, m.mapping)
+		}
+	}
+
+	if !r.flag() || r.eop {
+		return errors.New("invalid Vorbis setup header")
+	}
+	return nil
+}
+
+// book returns whether a codebook number is valid.
+func (s *vorbisSetup) book(n int) bool {
+	return n >= 0 && n < len(s.codebooks)
+}
+
+func (s *vorbisSetup) readFloor1(r *bitReader) (*floor1, error) {
+	f := &floor1{partitions: make([]int, r.read(5))}
+	classes := 0
+	for i := range f.partitions {
+		f.partitions[i] = int(r.read(4))
+		if f.partitions[i]+1 > classes {
+			classes = f.partitions[i] + 1
+		}
+	}
+
+	f.classes = make([]floor1Class, classes)
+	for i := range f.classes {
+		c := &f.classes[i]
+		c.dimensions = int(r.read(3)) + 1
+		c.subclasses = int(r.read(2))
+		if c.subclasses > 0 {
+			c.masterbook = int(r.read(8))
+			if !s.book(c.masterbook) {
+				return nil, fmt.Errorf("invalid masterbook %d", c.masterbook)
+			}
+		}
+		c.books = make([]int, 1<<c.subclasses)
+		for j := range c.books {
+			c.books[j] = int(r.read(8)) - 1
+			if c.books[j] >= 0 && !s.book(c.books[j]) {
+				return nil, fmt.Errorf("invalid subclass book %d", c.books[j])
+			}
+		}
+	}
+
+	f.multiplier = int(r.read(2)) + 1
+	bits := int(r.read(4))
+	f.xs = []int{0, 1 << bits}
+	for _, class := range f.partitions {
+		for j := 0; j < f.classes[class].dimensions; j++ {
+			f.xs = append(f.xs, int(r.read(bits)))
+		}
+	}
+	if len(f.xs) > 65 || r.eop {
+		return nil, errors.New("invalid floor posts")
+	}
+
+	// Sort the posts by x once, the order and neighbours do not change
+	f.sorted = make([]int, len(f.xs))
+	for i := range f.sorted {
+		f.sorted[i] = i
+	}
+	for i := 1; i < len(f.sorted); i++ {
+		for j := i; j > 0 && f.xs[f.sorted[j]] < f.xs[f.sorted[j-1]]; j-- {
+			f.sorted[j], f.sorted[j-1] = f.sorted[j-1], f.sorted[j]
+		}
+	}
+	for i := 1; i < len(f.sorted); i++ {
+		if f.xs[f.sorted[i]] == f.xs[f.sorted[i-1]] {
+			return nil, errors.New("duplicate floor posts")
+		}
+	}
+
+	f.low = make([]int, len(f.xs))
+	f.high = make([]int, len(f.xs))
+	for i := 2; i < len(f.xs); i++ {
+		low, high := 0, 1
+		for j := 0; j < i; j++ {
+			if f.xs[j] < f.xs[i] && f.xs[j] > f.xs[low] {
+				low = j
+			}
+			if f.xs[j] > f.xs[i] && f.xs[j] < f.xs[high] {
+				high = j
+			}
+		}
+		f.low[i], f.high[i] = low, high
+	}
+
+	return f, nil
+}
+
+func (s *vorbisSetup) readResidue(r *bitReader) (*residue, error) {
+	res := &residue{kind: int(r.read(16))}
+	if res.kind > 2 {
+		return nil, fmt.Errorf("unsupported residue type %d", res.kind)
+	}
+	res.begin = int(r.read(24))
+	res.end = int(r.read(24))
+	res.partitionSize = int(r.read(24)) + 1
+	res.classifications = int(r.read(6)) + 1
+	res.classbook = int(r.read(8))
+	if !s.book(res.classbook) || s.codebooks[res.classbook].dimensions == 0 {
+		return nil, fmt.Errorf("invalid classbook %d", res.classbook)
+	}
+
+	cascades := make([]uint32, res.classifications)
+	for i := range cascades {
+		cascades[i] = r.read(3)
+		if r.flag() {
+			cascades[i] |= r.read(5) << 3
+		}
+	}
+
+	res.books = make([][8]int, res.classifications)
+	for i, cascade := range cascades {
+		for pass := 0; pass < 8; pass++ {
+			res.books[i][pass] = -1
+			if cascade&(1<<pass) != 0 {
+				book := int(r.read(8))
+				if !s.book(book) || s.codebooks[book].values == nil {
+					return nil, fmt.Errorf("invalid residue book %d", book)
+				}
+				res.books[i][pass] = book
+			}
+		}
+	}
+
+	return res, nil
+}
+
+func (s *vorbisSetup) readMapping(r *bitReader) (*mapping, error) {
+	if kind := r.read(16); kind != 0 {
+		return nil, fmt.Errorf("unsupported mapping type %d", kind)
+	}
+
+	m := &mapping{mux: make([]int, s.channels)}
+	submaps := 1
+	if r.flag() {
+		submaps = int(r.read(4)) + 1
+	}
+	if r.flag() {
+		m.coupling = make([]couplingStep, r.read(8)+1)
+		bits := ilog(s.channels - 1)
+		for i := range m.coupling {
+			step := &m.coupling[i]
+			step.magnitude, step.angle = int(r.read(bits)), int(r.read(bits))
+			if step.magnitude == step.angle || step.magnitude >= s.channels || step.angle >= s.channels {
+				return nil, errors.New("invalid channel coupling")
+			}
+		}
+	}
+	if r.read(2) != 0 {
+		return nil, errors.New("invalid reserved field")
+	}
+
+	if submaps > 1 {
+		for i := range m.mux {
+			m.mux[i] = int(r.read(4))
+			if m.mux[i] >= submaps {
+				return nil, errors.New("invalid submap")
+			}
+		}
+	}
+	m.floors = make([]int, submaps)
+	m.residues = make([]int, submaps)
+	for i := 0; i < submaps; i++ {
+		r.read(8) // Unused time configuration
+		m.floors[i], m.residues[i] = int(r.read(8)), int(r.read(8))
+		if m.floors[i] >= len(s.floors) || m.residues[i] >= len(s.residues) {
+			return nil, errors.New("invalid floor or residue of submap")
+		}
+	}
+
+	return m, nil
+}
@@ -0,0 +1,668 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"strings"
+	"testing"
+)
+
+// The tests encode Vorbis streams themselves, with a small encoder using the
+// features of the format the decoder has to support: uniform and sparse
+// codebooks, vector lookups, floor classes, two residue passes, channel
+// coupling and switching block sizes.
+
+type bitWriter struct {
+	data []byte
+	bits int
+}
+
+func (w *bitWriter) write(v uint32, n int) {
+	for i := 0; i < n; i++ {
+		if w.bits%8 == 0 {
+			w.data = append(w.data, 0)
+		}
+		w.data[len(w.data)-1] |= byte(v>>i&1) << (w.bits % 8)
+		w.bits++
+	}
+}
+
+func (w *bitWriter) flag(b bool) {
+	if b {
+		w.write(1, 1)
+	} else {
+		w.write(0, 1)
+	}
+}
+
+// codeword writes an entry of a codebook whose codewords all have the same
+// length, so that entry i has codeword i.
+func (w *bitWriter) codeword(entry, length int) {
+	for b := length - 1; b >= 0; b-- {
+		w.write(uint32(entry>>b&1), 1)
+	}
+}
+
+func packFloat(v int) uint32 {
+	bits := uint32(788) << 21
+	if v < 0 {
+		return bits | 0x80000000 | uint32(-v)
+	}
+	return bits | uint32(v)
+}
+
+const (
+	testShort = 256
+	testLong  = 2048
+	// Posts of the floor, and the size of residue partitions
+	testPartition = 16
+)
+
+type testEncoder struct {
+	channels int
+	residue  int
+	// Floor value of every channel, and the amplitude it stands for
+	floorY int
+	scale  float64
+}
+
+func (e *testEncoder) header(kind byte) *bitWriter {
+	w := &bitWriter{}
+	w.write(uint32(kind), 8)
+	for _, c := range []byte("vorbis") {
+		w.write(uint32(c), 8)
+	}
+	return w
+}
+
+func (e *testEncoder) identification() []byte {
+	w := e.header(1)
+	w.write(0, 32)
+	w.write(uint32(e.channels), 8)
+	w.write(44100, 32)
+	w.write(0, 32*3)
+	w.write(8, 4)
+	w.write(11, 4)
+	w.flag(true)
+	return w.data
+}
+
+func (e *testEncoder) comment() []byte {
+	w := e.header(3)
+	w.write(0, 32)
+	w.write(0, 32)
+	w.flag(true)
+	return w.data
+}
+
+func (e *testEncoder) setup() []byte {
+	w := e.header(5)
+	w.write(4, 8)
+
+	book := func(dimensions, entries int) {
+		w.write(0x564342, 24)
+		w.write(uint32(dimensions), 16)
+		w.write(uint32(entries), 24)
+	}
+	uniform := func(entries, length int) {
+		w.flag(false)
+		w.flag(false)
+		for i := 0; i < entries; i++ {
+			w.write(uint32(length-1), 5)
+		}
+	}
+	lookup := func(kind, minimum, delta, values int) {
+		w.write(uint32(kind), 4)
+		w.write(packFloat(minimum), 32)
+		w.write(packFloat(delta), 32)
+		w.write(3, 4)
+		w.flag(false)
+		for i := 0; i < values; i++ {
+			w.write(uint32(i), 4)
+		}
+	}
+
+	// 0: floor values
+	book(1, 256)
+	uniform(256, 8)
+	w.write(0, 4)
+	// 1: floor subclasses, with ordered lengths
+	book(1, 2)
+	w.flag(true)
+	w.write(0, 5)
+	w.write(2, 2)
+	w.write(0, 4)
+	// 2: coarse residue pairs, multiples of 16
+	book(2, 256)
+	uniform(256, 8)
+	lookup(1, -128, 16, 16)
+	// 3: fine residue values
+	book(1, 16)
+	uniform(16, 4)
+	lookup(2, -8, 1, 16)
+	// 4: residue classifications of two partitions, with sparse lengths
+	book(2, 4)
+	w.flag(false)
+	w.flag(true)
+	for i := 0; i < 4; i++ {
+		w.flag(true)
+		w.write(1, 5)
+	}
+	w.write(0, 4)
+
+	// Time domain transforms
+	w.write(0, 6)
+	w.write(0, 16)
+
+	// Floor with two more posts in one class
+	w.write(0, 6)
+	w.write(1, 16)
+	w.write(1, 5)
+	w.write(0, 4)
+	w.write(1, 3)
+	w.write(1, 2)
+	w.write(1, 8)
+	w.write(0, 8)
+	w.write(1, 8)
+	w.write(0, 2)
+	w.write(8, 4)
+	w.write(64, 8)
+	w.write(128, 8)
+
+	// Residue with two classifications, silence and two passes
+	w.write(0, 6)
+	w.write(uint32(e.residue), 16)
+	w.write(0, 24)
+	w.write(uint32(testLong/2*e.channels), 24)
+	w.write(testPartition-1, 24)
+	w.write(1, 6)
+	w.write(4, 8)
+	w.write(0, 3)
+	w.flag(false)
+	w.write(3, 3)
+	w.flag(false)
+	w.write(2, 8)
+	w.write(3, 8)
+
+	// Mapping
+	w.write(0, 6)
+	w.write(0, 16)
+	w.flag(false)
+	w.flag(e.channels == 2)
+	if e.channels == 2 {
+		w.write(0, 8)
+		w.write(0, 1)
+		w.write(1, 1)
+	}
+	w.write(0, 2)
+	w.write(0, 8)
+	w.write(0, 8)
+	w.write(0, 8)
+
+	// Short and long mode
+	w.write(1, 6)
+	for _, long := range []bool{false, true} {
+		w.flag(long)
+		w.write(0, 16)
+		w.write(0, 16)
+		w.write(0, 8)
+	}
+
+	w.flag(true)
+	return w.data
+}
+
+// testWindow returns the window of a block, as given by the specification.
+func testWindow(n int, previousLong, nextLong bool) []float64 {
+	leftStart, leftEnd, leftN := 0, n/2, n/2
+	if n == testLong && !previousLong {
+		leftStart, leftEnd, leftN = n/4-testShort/4, n/4+testShort/4, testShort/2
+	}
+	rightStart, rightEnd, rightN := n/2, n, n/2
+	if n == testLong && !nextLong {
+		rightStart, rightEnd, rightN = n*3/4-testShort/4, n*3/4+testShort/4, testShort/2
+	}
+
+	window := make([]float64, n)
+	for i := range window {
+		switch {
+		case i >= leftStart && i < leftEnd:
+			s := math.Sin((float64(i-leftStart) + 0.5) / float64(leftN) * math.Pi / 2)
+			window[i] = math.Sin(math.Pi / 2 * s * s)
+		case i >= leftEnd && i < rightStart:
+			window[i] = 1
+		case i >= rightStart && i < rightEnd:
+			s := math.Sin((float64(i-rightStart)+0.5)/float64(rightN)*math.Pi/2 + math.Pi/2)
+			window[i] = math.Sin(math.Pi / 2 * s * s)
+		}
+	}
+	return window
+}
+
+// mdct is the forward transform matching the inverse of the decoder, which
+// is scaled like the one of the reference encoder.
+func mdct(block []float64) []float64 {
+	n := len(block)
+	coefficients := make([]float64, n/2)
+	for k := range coefficients {
+		var sum float64
+		for i, v := range block {
+			sum += v * math.Cos(2*math.Pi/float64(n)*(float64(i)+0.5+float64(n)/4)*(float64(k)+0.5))
+		}
+		coefficients[k] = sum * 4 / float64(n)
+	}
+	return coefficients
+}
+
+// audio encodes a block of the signals, centered on a sample.
+func (e *testEncoder) audio(signals []func(t int) float64, center, n int, previousLong, nextLong bool) []byte {
+	w := &bitWriter{}
+	w.write(0, 1)
+	w.flag(n == testLong)
+	if n == testLong {
+		w.flag(previousLong)
+		w.flag(nextLong)
+	}
+
+	window := testWindow(n, previousLong, nextLong)
+	quantized := make([][]int, e.channels)
+	for ch, signal := range signals {
+		block := make([]float64, n)
+		for i := range block {
+			block[i] = signal(center-n/2+i) * window[i]
+		}
+		for _, c := range mdct(block) {
+			quantized[ch] = append(quantized[ch], int(math.Round(c/e.scale)))
+		}
+
+		// Floor with the same value everywhere
+		w.flag(true)
+		w.write(uint32(e.floorY), 8)
+		w.write(uint32(e.floorY), 8)
+		w.codeword(1, 1)
+		w.codeword(0, 8)
+	}
+
+	if e.channels == 2 {
+		for j := range quantized[0] {
+			l, r := quantized[0][j], quantized[1][j]
+			switch {
+			case l > 0 && l > r:
+				quantized[0][j], quantized[1][j] = l, l-r
+			case r > 0 && l <= r:
+				quantized[0][j], quantized[1][j] = r, l-r
+			case l <= 0 && r > l:
+				quantized[0][j], quantized[1][j] = l, r-l
+			default:
+				quantized[0][j], quantized[1][j] = r, r-l
+			}
+		}
+	}
+	if e.residue == 2 {
+		var interleaved []int
+		for j := range quantized[0] {
+			for ch := range quantized {
+				interleaved = append(interleaved, quantized[ch][j])
+			}
+		}
+		quantized = [][]int{interleaved}
+	}
+	e.writeResidue(w, quantized)
+	return w.data
+}
+
+func (e *testEncoder) writeResidue(w *bitWriter, vectors [][]int) {
+	partitions := len(vectors[0]) / testPartition
+	class := func(v []int, p int) int {
+		if p >= partitions {
+			return 0
+		}
+		for _, value := range v[p*testPartition : (p+1)*testPartition] {
+			if value != 0 {
+				return 1
+			}
+		}
+		return 0
+	}
+	coarse := func(v int) int {
+		if v < -136 || v > 119 {
+			panic("residue value out of range")
+		}
+		return int(math.Floor(float64(v+8) / 16))
+	}
+
+	for pass := 0; pass < 2; pass++ {
+		for p := 0; p < partitions; p += 2 {
+			if pass == 0 {
+				for _, v := range vectors {
+					w.codeword(class(v, p)*2+class(v, p+1), 2)
+				}
+			}
+			for i := p; i < p+2 && i < partitions; i++ {
+				for _, v := range vectors {
+					if class(v, i) == 0 {
+						continue
+					}
+					partition := v[i*testPartition : (i+1)*testPartition]
+					if pass == 1 {
+						for _, value := range partition {
+							w.codeword(value-16*coarse(value)+8, 4)
+						}
+						continue
+					}
+					// Pairs are interleaved by residue type 0
+					step, stride := 1, 2
+					if e.residue == 0 {
+						step, stride = testPartition/2, 1
+					}
+					for j := 0; j < testPartition/2; j++ {
+						a, b := partition[j*stride], partition[j*stride+step]
+						w.codeword(coarse(a)+8+16*(coarse(b)+8), 8)
+					}
+				}
+			}
+		}
+	}
+}
+
+type oggPacket struct {
+	data    []byte
+	granule int64
+	// Whether the packet ends its page
+	flush bool
+}
+
+// writeOgg puts the packets in pages of at most the given number of
+// segments, so long packets continue on the next pages.
+func writeOgg(packets []oggPacket, maxSegments int) []byte {
+	var out bytes.Buffer
+	var segments []byte
+	var body []byte
+	sequence := uint32(0)
+	granule := int64(-1)
+	continued := false
+
+	page := func(last bool) {
+		header := make([]byte, 27)
+		copy(header, "OggS")
+		var flags byte
+		if continued {
+			flags |= oggContinued
+		}
+		if sequence == 0 {
+			flags |= oggFirst
+		}
+		if last {
+			flags |= oggLast
+		}
+		header[5] = flags
+		binary.LittleEndian.PutUint64(header[6:], uint64(granule))
+		binary.LittleEndian.PutUint32(header[14:], 1234)
+		binary.LittleEndian.PutUint32(header[18:], sequence)
+		header[26] = byte(len(segments))
+		page := append(append(header, segments...), body...)
+		binary.LittleEndian.PutUint32(page[22:], oggChecksum(page))
+		out.Write(page)
+
+		continued = len(segments) > 0 && segments[len(segments)-1] == 255
+		sequence++
+		segments, body, granule = segments[:0], body[:0], -1
+	}
+
+	for i, packet := range packets {
+		data := packet.data
+		for {
+			size := len(data)
+			if size > 255 {
+				size = 255
+			}
+			if len(segments) == maxSegments {
+				page(false)
+			}
+			segments = append(segments, byte(size))
+			body = append(body, data[:size]...)
+			data = data[size:]
+			if size < 255 {
+				break
+			}
+		}
+		granule = packet.granule
+		if packet.flush || i == len(packets)-1 {
+			page(i == len(packets)-1)
+		}
+	}
+
+	return out.Bytes()
+}
+
+// encodeTest encodes the signals with blocks of the given sizes, and returns
+// the file and the number of frames it holds.
+func encodeTest(e *testEncoder, signals []func(t int) float64, sizes []int) ([]byte, int) {
+	packets := []oggPacket{
+		{data: e.identification(), flush: true},
+		{data: e.comment()},
+		{data: e.setup(), flush: true},
+	}
+
+	center := 0
+	for i, n := range sizes {
+		if i > 0 {
+			center += sizes[i-1]/4 + n/4
+		}
+		previousLong := i == 0 || sizes[i-1] == testLong
+		nextLong := i == len(sizes)-1 || sizes[i+1] == testLong
+		packets = append(packets, oggPacket{data: e.audio(signals, center, n, previousLong, nextLong), granule: int64(center)})
+	}
+
+	// The stream ends before the end of the last block
+	frames := center - 100
+	packets[len(packets)-1].granule = int64(frames)
+	return writeOgg(packets, 3), frames
+}
+
+func sine(amplitude, frequency float64) func(t int) float64 {
+	return func(t int) float64 {
+		return amplitude * math.Sin(2*math.Pi*frequency*float64(t)/44100)
+	}
+}
+
+func TestDecodeVorbis(t *testing.T) {
+	sizes := []int{testLong, testLong, testShort, testShort, testShort, testLong, testShort, testLong, testLong}
+	tests := []struct {
+		name    string
+		encoder *testEncoder
+		signals []func(t int) float64
+	}{
+		{"mono residue 0", &testEncoder{channels: 1, residue: 0}, []func(int) float64{sine(0.5, 440)}},
+		{"mono residue 1", &testEncoder{channels: 1, residue: 1}, []func(int) float64{sine(0.5, 1000)}},
+		{"stereo residue 2", &testEncoder{channels: 2, residue: 2}, []func(int) float64{sine(0.5, 440), sine(0.3, 660)}},
+	}
+
+	for _, test := range tests {
+		e := test.encoder
+		e.floorY = 171
+		e.scale = float64(inverseDB[e.floorY])
+		file, frames := encodeTest(e, test.signals, sizes)
+
+		sound, err := Decode(bytes.NewReader(file))
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if sound.Format != (Format{SampleRate: 44100, Channels: e.channels}) || sound.Frames() != frames {
+			t.Fatalf("%s: expected %d frames of %d channels, got %d of %v", test.name, frames, e.channels, sound.Frames(), sound.Format)
+		}
+
+		// What is left is the noise of quantizing the spectrum
+		var noise, signal float64
+		for i := 0; i < frames; i++ {
+			for ch, f := range test.signals {
+				diff := float64(sound.Samples[i*e.channels+ch]) - f(i)
+				noise += diff * diff
+				signal += f(i) * f(i)
+			}
+		}
+		if snr := 10 * math.Log10(signal/noise); snr < 30 {
+			t.Errorf("%s: expected the signal back, got a signal to noise ratio of %.1f dB", test.name, snr)
+		}
+	}
+}
+
+func TestVorbisStream(t *testing.T) {
+	e := &testEncoder{channels: 1, residue: 1, floorY: 171}
+	e.scale = float64(inverseDB[e.floorY])
+	file, frames := encodeTest(e, []func(int) float64{sine(0.5, 440)}, []int{testLong, testShort, testLong, testLong})
+
+	stream, err := NewStream(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := func() []float32 {
+		var samples []float32
+		buffer := make([]float32, 100)
+		for {
+			n, err := stream.Read(buffer)
+			samples = append(samples, buffer[:n]...)
+			if err == io.EOF {
+				return samples
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	first := read()
+	if len(first) != frames {
+		t.Errorf("expected %d samples, got %d", frames, len(first))
+	}
+	if err := stream.(Rewinder).Rewind(); err != nil {
+		t.Fatal(err)
+	}
+	if second := read(); !equalSamples(first, second) {
+		t.Errorf("expected the same samples after rewinding")
+	}
+
+	// Pages are checked
+	file[len(file)-1] ^= 1
+	if _, err := Decode(bytes.NewReader(file)); err == nil || !strings.Contains(err.Error(), "corrupt") {
+		t.Errorf("expected an error for a corrupt page, got %v", err)
+	}
+}
+
+func equalSamples(a, b []float32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestCodebook(t *testing.T) {
+	// The example of the specification
+	lengths := []uint8{2, 4, 4, 4, 4, 2, 3, 3}
+	codewords := []string{"00", "0100", "0101", "0110", "0111", "10", "110", "111"}
+	b := &codebook{single: -1}
+	if err := b.buildTree(lengths); err != nil {
+		t.Fatal(err)
+	}
+
+	w := &bitWriter{}
+	for _, codeword := range codewords {
+		for _, c := range codeword {
+			w.write(uint32(c-'0'), 1)
+		}
+	}
+	r := &bitReader{data: w.data}
+	for entry := range codewords {
+		if decoded := b.decode(r); decoded != entry {
+			t.Errorf("expected entry %d, got %d", entry, decoded)
+		}
+	}
+
+	if err := (&codebook{single: -1}).buildTree([]uint8{1, 1, 1}); err == nil {
+		t.Errorf("expected an error for an overspecified codebook")
+	}
+}
+
+func TestIMDCT(t *testing.T) {
+	for _, n := range []int{64, 256} {
+		coefficients := make([]float32, n/2)
+		for i := range coefficients {
+			coefficients[i] = float32(math.Sin(float64(i*i) * 0.1))
+		}
+		samples := make([]float32, n)
+		newIMDCT(n).inverse(coefficients, samples)
+
+		for i := range samples {
+			var expected float64
+			for k, x := range coefficients {
+				expected += float64(x) * math.Cos(2*math.Pi/float64(n)*(float64(i)+0.5+float64(n)/4)*(float64(k)+0.5))
+			}
+			if math.Abs(expected-float64(samples[i])) > 1e-3 {
+				t.Fatalf("%d: expected sample %d to be %f, got %f", n, i, expected, samples[i])
+			}
+		}
+	}
+}
+
+func TestFloor(t *testing.T) {
+	e := &testEncoder{channels: 1, residue: 1}
+	setup := &vorbisSetup{}
+	if err := setup.readIdentification(e.identification()); err != nil {
+		t.Fatal(err)
+	}
+	if err := setup.readSetup(e.setup()); err != nil {
+		t.Fatal(err)
+	}
+	d := newVorbisDecoder(setup)
+
+	// The post at 64 is one above its prediction, the one at 128 follows it
+	w := &bitWriter{}
+	w.flag(true)
+	w.write(100, 8)
+	w.write(100, 8)
+	w.codeword(1, 1)
+	w.codeword(2, 8)
+	curve := make([]float32, testLong/2)
+	if !d.decodeFloor(&bitReader{data: w.data}, setup.floors[0], curve) {
+		t.Fatal("expected the floor to be used")
+	}
+	for x, v := range curve {
+		expected := inverseDB[100]
+		if x >= 64 && x < 256 {
+			expected = inverseDB[101]
+		}
+		if v != expected {
+			t.Fatalf("expected %g at %d, got %g", expected, x, v)
+		}
+	}
+
+	if d.decodeFloor(&bitReader{data: []byte{0}}, setup.floors[0], curve) {
+		t.Errorf("expected the floor to be unused")
+	}
+}
+
+func TestRenderLine(t *testing.T) {
+	values := make([]int, 8)
+	renderLine(0, 0, 8, 3, values)
+	if expected := []int{0, 0, 0, 1, 1, 1, 2, 2}; !equalInts(values, expected) {
+		t.Errorf("expected %v, got %v", expected, values)
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
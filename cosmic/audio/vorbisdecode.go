@@ -0,0 +1,502 @@
+package audio
+
+import (
+	"errors"
+	"math"
+)
+
+// inverseDB converts the values of floor curves to amplitudes, 140 dB over
+// 256 steps.
+var inverseDB = func() (table [256]float32) {
+	for i := range table {
+		table[i] = float32(math.Pow(10, 7*float64(i-255)/256))
+	}
+	return table
+}()
+
+// vorbisDecoder decodes the audio packets of a Vorbis stream.
+type vorbisDecoder struct {
+	*vorbisSetup
+
+	// Rising half of the window of each block size
+	slopes [2][]float32
+	imdct  [2]*imdct
+
+	// Spectrum and then samples of every channel, blocksize[1] long, and
+	// the spectra as slices of them
+	buffers [][]float32
+	spectra [][]float32
+	// Floor curve of every channel
+	curves [][]float32
+	// Second half of the previous block of every channel, not yet overlapped
+	previous     [][]float32
+	previousSize int
+
+	// Scratch space of the floors and residues
+	floorY     []int
+	floorFinal []int
+	floorStep  []bool
+	curve      []int
+	noResidue  []bool
+	decodeMask []bool
+	classes    [][]int
+	interleave []float32
+}
+
+func newVorbisDecoder(setup *vorbisSetup) *vorbisDecoder {
+	d := &vorbisDecoder{vorbisSetup: setup}
+	for i, size := range setup.blocksize {
+		d.slopes[i] = windowSlope(size / 2)
+		d.imdct[i] = newIMDCT(size)
+	}
+
+	d.buffers = make([][]float32, setup.channels)
+	d.spectra = make([][]float32, setup.channels)
+	d.curves = make([][]float32, setup.channels)
+	d.previous = make([][]float32, setup.channels)
+	for i := range d.buffers {
+		d.buffers[i] = make([]float32, setup.blocksize[1])
+		d.curves[i] = make([]float32, setup.blocksize[1]/2)
+		d.previous[i] = make([]float32, setup.blocksize[1]/2)
+	}
+	d.floorY = make([]int, 65)
+	d.floorFinal = make([]int, 65)
+	d.floorStep = make([]bool, 65)
+	d.curve = make([]int, setup.blocksize[1]/2)
+	d.noResidue = make([]bool, setup.channels)
+	d.decodeMask = make([]bool, setup.channels)
+	d.classes = make([][]int, setup.channels)
+	return d
+}
+
+// windowSlope returns the rising half of the Vorbis window with n samples.
+func windowSlope(n int) []float32 {
+	slope := make([]float32, n)
+	for i := range slope {
+		s := math.Sin((float64(i) + 0.5) / float64(n) * math.Pi / 2)
+		slope[i] = float32(math.Sin(math.Pi / 2 * s * s))
+	}
+	return slope
+}
+
+// reset forgets the previous block, after seeking.
+func (d *vorbisDecoder) reset() {
+	d.previousSize = 0
+}
+
+// decode decodes an audio packet and appends the samples it completes to
+// out, interleaved. The first packet after a reset completes none.
+func (d *vorbisDecoder) decode(packet []byte, out []float32) ([]float32, error) {
+	r := &bitReader{data: packet}
+	if r.flag() {
+		return out, errors.New("not an audio packet")
+	}
+	modeNumber := int(r.read(ilog(len(d.modes) - 1)))
+	if modeNumber >= len(d.modes) || r.eop {
+		return out, errors.New("invalid mode")
+	}
+	m := d.modes[modeNumber]
+	block := 0
+	if m.long {
+		block = 1
+	}
+	n := d.blocksize[block]
+	previousLong, nextLong := true, true
+	if m.long {
+		previousLong, nextLong = r.flag(), r.flag()
+	}
+	mapping := d.mappings[m.mapping]
+
+	// Floors, where an unused floor means the channel is silent
+	spectra := d.spectra[:d.channels]
+	for ch := range spectra {
+		spectra[ch] = d.buffers[ch][:n/2]
+		for i := range spectra[ch] {
+			spectra[ch][i] = 0
+		}
+		floor := d.floors[mapping.floors[mapping.mux[ch]]]
+		d.noResidue[ch] = !d.decodeFloor(r, floor, d.curves[ch][:n/2])
+	}
+
+	// Coupled channels are decoded when either of them is used
+	for _, step := range mapping.coupling {
+		if !d.noResidue[step.magnitude] || !d.noResidue[step.angle] {
+			d.noResidue[step.magnitude], d.noResidue[step.angle] = false, false
+		}
+	}
+
+	for submap, res := range mapping.residues {
+		var vectors [][]float32
+		mask := d.decodeMask[:0]
+		for ch := range spectra {
+			if mapping.mux[ch] == submap {
+				vectors = append(vectors, spectra[ch])
+				mask = append(mask, d.noResidue[ch])
+			}
+		}
+		d.decodeResidue(r, d.residues[res], vectors, mask, n/2)
+	}
+
+	for i := len(mapping.coupling) - 1; i >= 0; i-- {
+		step := mapping.coupling[i]
+		magnitudes, angles := spectra[step.magnitude], spectra[step.angle]
+		for j := range magnitudes {
+			m, a := magnitudes[j], angles[j]
+			if m > 0 {
+				if a > 0 {
+					angles[j] = m - a
+				} else {
+					angles[j], magnitudes[j] = m, m+a
+				}
+			} else {
+				if a > 0 {
+					angles[j] = m + a
+				} else {
+					angles[j], magnitudes[j] = m, m-a
+				}
+			}
+		}
+	}
+
+	// Apply the floors, transform and window the blocks
+	for ch, spectrum := range spectra {
+		samples := d.buffers[ch][:n]
+		if d.noResidue[ch] {
+			for i := range samples {
+				samples[i] = 0
+			}
+			continue
+		}
+		for i, f := range d.curves[ch][:n/2] {
+			spectrum[i] *= f
+		}
+		d.imdct[block].inverse(spectrum, samples)
+		d.window(samples, block, previousLong, nextLong)
+	}
+
+	// Overlap the first half of the block with the second half of the
+	// previous one, aligning the quarters of the blocks
+	if d.previousSize > 0 {
+		count := d.previousSize/4 + n/4
+		offset := n/4 - d.previousSize/4
+		for t := 0; t < count; t++ {
+			for ch := range spectra {
+				var v float32
+				if t < d.previousSize/2 {
+					v = d.previous[ch][t]
+				}
+				if i := t + offset; i >= 0 && i < n/2 {
+					v += d.buffers[ch][i]
+				}
+				out = append(out, v)
+			}
+		}
+	}
+	for ch := range spectra {
+		copy(d.previous[ch], d.buffers[ch][n/2:n])
+	}
+	d.previousSize = n
+
+	return out, nil
+}
+
+// window applies the window to a block, whose slopes are short next to short
+// blocks.
+func (d *vorbisDecoder) window(samples []float32, block int, previousLong, nextLong bool) {
+	n := len(samples)
+	short := d.blocksize[0]
+
+	leftStart, leftSlope := 0, d.slopes[block]
+	if block == 1 && !previousLong {
+		leftStart, leftSlope = n/4-short/4, d.slopes[0]
+	}
+	rightStart, rightSlope := n/2, d.slopes[block]
+	if block == 1 && !nextLong {
+		rightStart, rightSlope = n*3/4-short/4, d.slopes[0]
+	}
+
+	for i := 0; i < leftStart; i++ {
+		samples[i] = 0
+	}
+	for i, w := range leftSlope {
+		samples[leftStart+i] *= w
+	}
+	for i, w := range rightSlope {
+		samples[rightStart+len(rightSlope)-1-i] *= w
+	}
+	for i := rightStart + len(rightSlope); i < n; i++ {
+		samples[i] = 0
+	}
+}
+
+// decodeFloor decodes the floor of a channel and renders its curve, or
+// returns false when the channel is unused.
+func (d *vorbisDecoder) decodeFloor(r *bitReader, f *floor1, curve []float32) bool {
+	if !r.flag() {
+		return false
+	}
+
+	yRange := [4]int{256, 128, 86, 64}[f.multiplier-1]
+	bits := ilog(yRange - 1)
+	y := d.floorY[:len(f.xs)]
+	y[0], y[1] = int(r.read(bits)), int(r.read(bits))
+	offset := 2
+	for _, class := range f.partitions {
+		c := &f.classes[class]
+		value := 0
+		if c.subclasses > 0 {
+			value = d.codebooks[c.masterbook].decode(r)
+		}
+		for j := 0; j < c.dimensions; j++ {
+			book := c.books[value&(1<<c.subclasses-1)]
+			value >>= c.subclasses
+			y[offset+j] = 0
+			if book >= 0 {
+				y[offset+j] = d.codebooks[book].decode(r)
+			}
+		}
+		offset += c.dimensions
+	}
+	for _, v := range y {
+		if v < 0 || r.eop {
+			return false
+		}
+	}
+
+	// Predict every post from its neighbours, the decoded values are offsets
+	// from the predictions
+	final, step := d.floorFinal[:len(f.xs)], d.floorStep[:len(f.xs)]
+	final[0], final[1] = y[0], y[1]
+	step[0], step[1] = true, true
+	for i := 2; i < len(f.xs); i++ {
+		low, high := f.low[i], f.high[i]
+		predicted := renderPoint(f.xs[low], final[low], f.xs[high], final[high], f.xs[i])
+		highRoom, lowRoom := yRange-predicted, predicted
+		room := lowRoom * 2
+		if highRoom < lowRoom {
+			room = highRoom * 2
+		}
+
+		value := y[i]
+		step[i] = value != 0
+		switch {
+		case value == 0:
+			final[i] = predicted
+		case value >= room:
+			if highRoom > lowRoom {
+				final[i] = value - lowRoom + predicted
+			} else {
+				final[i] = predicted - value + highRoom - 1
+			}
+		case value%2 == 1:
+			final[i] = predicted - (value+1)/2
+		default:
+			final[i] = predicted + value/2
+		}
+		if value != 0 {
+			step[low], step[high] = true, true
+		}
+	}
+
+	// Draw lines between the posts that were not predicted exactly
+	n := len(curve)
+	values := d.curve[:n]
+	lx, ly := 0, final[0]*f.multiplier
+	hx, hy := 0, 0
+	for _, i := range f.sorted[1:] {
+		if step[i] {
+			hx, hy = f.xs[i], final[i]*f.multiplier
+			renderLine(lx, ly, hx, hy, values)
+			lx, ly = hx, hy
+		}
+	}
+	if hx < n {
+		renderLine(hx, hy, n, hy, values)
+	}
+
+	for i, v := range values {
+		if v < 0 {
+			v = 0
+		} else if v > 255 {
+			v = 255
+		}
+		curve[i] = inverseDB[v]
+	}
+	return true
+}
+
+func renderPoint(x0, y0, x1, y1, x int) int {
+	dy := y1 - y0
+	adx := x1 - x0
+	ady := dy
+	if ady < 0 {
+		ady = -ady
+	}
+	off := ady * (x - x0) / adx
+	if dy < 0 {
+		return y0 - off
+	}
+	return y0 + off
+}
+
+// renderLine draws a line on the curve, up to but excluding x1, with only
+// integer arithmetic.
+func renderLine(x0, y0, x1, y1 int, values []int) {
+	dy := y1 - y0
+	adx := x1 - x0
+	ady := dy
+	if ady < 0 {
+		ady = -ady
+	}
+	base := dy / adx
+	sy := base + 1
+	if dy < 0 {
+		sy = base - 1
+	}
+	absBase := base
+	if absBase < 0 {
+		absBase = -absBase
+	}
+	ady -= absBase * adx
+
+	y, err := y0, 0
+	if x0 < len(values) {
+		values[x0] = y
+	}
+	for x := x0 + 1; x < x1 && x < len(values); x++ {
+		err += ady
+		if err >= adx {
+			err -= adx
+			y += sy
+		} else {
+			y += base
+		}
+		values[x] = y
+	}
+}
+
+// decodeResidue decodes the residues of the channels of a submap, adding
+// them to their spectra.
+func (d *vorbisDecoder) decodeResidue(r *bitReader, res *residue, vectors [][]float32, skip []bool, size int) {
+	if res.kind == 2 {
+		decode := false
+		for _, s := range skip {
+			decode = decode || !s
+		}
+		if !decode {
+			return
+		}
+
+		// Type 2 interleaves the channels into a single vector
+		total := size * len(vectors)
+		if cap(d.interleave) < total {
+			d.interleave = make([]float32, total)
+		}
+		interleaved := d.interleave[:total]
+		for i := range interleaved {
+			interleaved[i] = 0
+		}
+		d.decodePartitions(r, res, [][]float32{interleaved}, []bool{false}, total)
+		for i, v := range interleaved {
+			vectors[i%len(vectors)][i/len(vectors)] += v
+		}
+		return
+	}
+
+	d.decodePartitions(r, res, vectors, skip, size)
+}
+
+func (d *vorbisDecoder) decodePartitions(r *bitReader, res *residue, vectors [][]float32, skip []bool, size int) {
+	begin, end := res.begin, res.end
+	if begin > size {
+		begin = size
+	}
+	if end > size {
+		end = size
+	}
+	if end <= begin {
+		return
+	}
+	partitions := (end - begin) / res.partitionSize
+	classbook := d.codebooks[res.classbook]
+	perCodeword := classbook.dimensions
+
+	// Type 2 has one vector, the others one per channel of the submap
+	classes := d.classes[:len(vectors)]
+	for ch := range classes {
+		if cap(classes[ch]) < partitions+perCodeword {
+			classes[ch] = make([]int, partitions+perCodeword)
+		}
+		classes[ch] = classes[ch][:partitions+perCodeword]
+	}
+
+	for pass := 0; pass < 8; pass++ {
+		for partition := 0; partition < partitions; {
+			if pass == 0 {
+				for ch := range vectors {
+					if skip[ch] {
+						continue
+					}
+					value := classbook.decode(r)
+					if value < 0 {
+						return
+					}
+					for i := perCodeword - 1; i >= 0; i-- {
+						classes[ch][partition+i] = value % res.classifications
+						value /= res.classifications
+					}
+				}
+			}
+
+			for i := 0; i < perCodeword && partition < partitions; i++ {
+				for ch, vector := range vectors {
+					if skip[ch] {
+						continue
+					}
+					book := res.books[classes[ch][partition]][pass]
+					if book < 0 {
+						continue
+					}
+					offset := begin + partition*res.partitionSize
+					if !d.decodePartition(r, res, d.codebooks[book], vector[offset:offset+res.partitionSize]) {
+						return
+					}
+				}
+				partition++
+			}
+		}
+	}
+}
+
+// decodePartition adds the vectors of a partition, interleaved for residue
+// type 0 and one after the other otherwise.
+func (d *vorbisDecoder) decodePartition(r *bitReader, res *residue, book *codebook, v []float32) bool {
+	dimensions := book.dimensions
+	if res.kind == 0 {
+		step := len(v) / dimensions
+		for i := 0; i < step; i++ {
+			values := book.vector(r)
+			if values == nil {
+				return false
+			}
+			for j, value := range values {
+				v[i+j*step] += value
+			}
+		}
+		return true
+	}
+
+	for i := 0; i < len(v); {
+		values := book.vector(r)
+		if values == nil {
+			return false
+		}
+		for _, value := range values {
+			if i < len(v) {
+				v[i] += value
+			}
+			i++
+		}
+	}
+	return true
+}
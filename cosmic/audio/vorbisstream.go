@@ -0,0 +1,122 @@
+package audio
+
+import (
+	"fmt"
+	"io"
+)
+
+// vorbisStream decodes an Ogg Vorbis file while it is read.
+type vorbisStream struct {
+	*source
+	ogg     *oggReader
+	decoder *vorbisDecoder
+	// Decoded samples not yet read, and the frames decoded so far
+	pending  []float32
+	buffer   []float32
+	position int64
+	done     bool
+}
+
+func newVorbisStream(source *source) (*vorbisStream, error) {
+	s := &vorbisStream{source: source}
+	setup, err := s.readHeaders()
+	if err != nil {
+		return nil, fmt.Errorf("invalid Ogg Vorbis file: %s", err.Error())
+	}
+	s.decoder = newVorbisDecoder(setup)
+	return s, nil
+}
+
+// readHeaders reads the three header packets at the start of the stream.
+func (s *vorbisStream) readHeaders() (*vorbisSetup, error) {
+	s.ogg = newOggReader(s.r)
+	setup := &vorbisSetup{}
+	for i := 0; i < 3; i++ {
+		packet, _, _, err := s.ogg.nextPacket()
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+
+		switch i {
+		case 0:
+			err = setup.readIdentification(packet)
+		case 1:
+			// Comments are not used
+			_, err = readHeader(packet, 3)
+		case 2:
+			err = setup.readSetup(packet)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return setup, nil
+}
+
+func (s *vorbisStream) Format() Format {
+	return Format{SampleRate: s.decoder.sampleRate, Channels: s.decoder.channels}
+}
+
+func (s *vorbisStream) Read(samples []float32) (int, error) {
+	for len(s.pending) == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+		if err := s.decodePacket(); err != nil {
+			return 0, err
+		}
+	}
+
+	channels := s.decoder.channels
+	n := copy(samples[:len(samples)/channels*channels], s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+// decodePacket decodes the next audio packet into the pending samples.
+func (s *vorbisStream) decodePacket() error {
+	packet, granule, last, err := s.ogg.nextPacket()
+	if err == io.EOF {
+		s.done = true
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("invalid Ogg Vorbis file: %s", err.Error())
+	}
+	if len(packet) == 0 {
+		return nil
+	}
+
+	s.buffer, err = s.decoder.decode(packet, s.buffer[:0])
+	if err != nil {
+		// Damaged packets are skipped, like the players of the format do
+		s.decoder.reset()
+		return nil
+	}
+
+	channels := int64(s.decoder.channels)
+	frames := int64(len(s.buffer)) / channels
+	// The last page tells where the stream ends within its last block
+	if last {
+		s.done = true
+		if granule >= s.position && granule < s.position+frames {
+			frames = granule - s.position
+		}
+	}
+	s.position += frames
+	s.pending = s.buffer[:frames*channels]
+	return nil
+}
+
+func (s *vorbisStream) Rewind() error {
+	if err := s.rewind(0); err != nil {
+		return err
+	}
+	if _, err := s.readHeaders(); err != nil {
+		return err
+	}
+	s.decoder.reset()
+	s.pending, s.position, s.done = nil, 0, false
+	return nil
+}
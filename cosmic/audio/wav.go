@@ -0,0 +1,271 @@
+package audio
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Format tags of WAV files.
+const (
+	wavPCM        = 1
+	wavFloat      = 3
+	wavExtensible = 0xfffe
+)
+
+// wavStream decodes the samples of a WAV file while it is read.
+type wavStream struct {
+	*source
+	format Format
+	tag    int
+	bits   int
+	// Offset of the samples in the file, and the bytes of them left
+	offset    int64
+	size      int64
+	remaining int64
+	buffer    []byte
+}
+
+func newWAVStream(source *source) (*wavStream, error) {
+	s := &wavStream{source: source}
+	if err := s.readHeader(); err != nil {
+		return nil, fmt.Errorf("invalid WAV file: %s", err.Error())
+	}
+	return s, nil
+}
+
+func (s *wavStream) readHeader() error {
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(s.r, header); err != nil || string(header[8:]) != "WAVE" {
+		return errors.New("missing WAVE header")
+	}
+	offset := int64(len(header))
+
+	var chunk [8]byte
+	for hasFormat := false; ; {
+		if _, err := io.ReadFull(s.r, chunk[:]); err != nil {
+			return errors.New("missing data chunk")
+		}
+		offset += int64(len(chunk))
+		size := int64(binary.LittleEndian.Uint32(chunk[4:]))
+
+		switch string(chunk[:4]) {
+		case "fmt ":
+			if size < 16 || size > 1024 {
+				return errors.New("invalid format chunk")
+			}
+			data := make([]byte, size+size%2)
+			if _, err := io.ReadFull(s.r, data); err != nil {
+				return unexpectedEOF(err)
+			}
+			if err := s.readFormat(data[:size]); err != nil {
+				return err
+			}
+			hasFormat = true
+			offset += int64(len(data))
+		case "data":
+			if !hasFormat {
+				return errors.New("data before format chunk")
+			}
+			s.offset = offset
+			// Files written while recording may not know their size yet
+			if size == 0 || size == 0xffffffff {
+				size = math.MaxInt64
+			}
+			s.size, s.remaining = size, size
+			return nil
+		default:
+			if _, err := io.CopyN(io.Discard, s.r, size+size%2); err != nil {
+				return unexpectedEOF(err)
+			}
+			offset += size + size%2
+		}
+	}
+}
+
+func (s *wavStream) readFormat(data []byte) error {
+	s.tag = int(binary.LittleEndian.Uint16(data))
+	s.format.Channels = int(binary.LittleEndian.Uint16(data[2:]))
+	s.format.SampleRate = int(binary.LittleEndian.Uint32(data[4:]))
+	s.bits = int(binary.LittleEndian.Uint16(data[14:]))
+	if s.tag == wavExtensible {
+		if len(data) < 26 {
+			return errors.New("invalid extensible format")
+		}
+		s.tag = int(binary.LittleEndian.Uint16(data[24:]))
+	}
+
+	if s.format.Channels == 0 || s.format.SampleRate == 0 {
+		return errors.New("no channels or sample rate")
+	}
+	switch {
+	case s.tag == wavPCM && (s.bits == 8 || s.bits == 16 || s.bits == 24 || s.bits == 32):
+	case s.tag == wavFloat && (s.bits == 32 || s.bits == 64):
+	default:
+		return fmt.Errorf("unsupported sample format %d with %d bits", s.tag, s.bits)
+	}
+	return nil
+}
+
+func (s *wavStream) Format() Format {
+	return s.format
+}
+
+func (s *wavStream) Read(samples []float32) (int, error) {
+	width := s.bits / 8
+	frame := width * s.format.Channels
+	frames := len(samples) / s.format.Channels
+	if int64(frames*frame) > s.remaining {
+		frames = int(s.remaining / int64(frame))
+	}
+	if frames == 0 {
+		return 0, io.EOF
+	}
+
+	if len(s.buffer) < frames*frame {
+		s.buffer = make([]byte, frames*frame)
+	}
+	n, err := io.ReadFull(s.r, s.buffer[:frames*frame])
+	if err == io.ErrUnexpectedEOF || (err == io.EOF && s.remaining != math.MaxInt64) {
+		// Truncated files play what they have
+		err = nil
+	}
+	s.remaining -= int64(n)
+	frames = n / frame
+	if frames == 0 {
+		s.remaining = 0
+		return 0, io.EOF
+	}
+
+	data := s.buffer[:frames*frame]
+	for i := range samples[:frames*s.format.Channels] {
+		b := data[i*width:]
+		switch {
+		case s.tag == wavFloat && width == 4:
+			samples[i] = math.Float32frombits(binary.LittleEndian.Uint32(b))
+		case s.tag == wavFloat:
+			samples[i] = float32(math.Float64frombits(binary.LittleEndian.Uint64(b)))
+		case width == 1:
+			samples[i] = float32(int(b[0])-128) / (1 << 7)
+		case width == 2:
+			samples[i] = float32(int16(binary.LittleEndian.Uint16(b))) / (1 << 15)
+		case width == 3:
+			samples[i] = float32(int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24)>>8) / (1 << 23)
+		default:
+			samples[i] = float32(int32(binary.LittleEndian.Uint32(b))) / (1 << 31)
+		}
+	}
+
+	if err == io.EOF {
+		err = nil
+	}
+	return frames * s.format.Channels, err
+}
+
+func (s *wavStream) Rewind() error {
+	if err := s.rewind(s.offset); err != nil {
+		return err
+	}
+	s.remaining = s.size
+	return nil
+}
+
+// WriteWAV writes a sound as a WAV file, with 32 bit float samples.
+func WriteWAV(out io.Writer, sound *Sound) error {
+	w := newWAVWriter(out, sound.Format, len(sound.Samples))
+	w.write(sound.Samples)
+	if w.err != nil {
+		return w.err
+	}
+	return w.w.Flush()
+}
+
+const wavHeaderSize = 44
+
+// wavWriter writes samples to a WAV file as they come.
+type wavWriter struct {
+	out     io.Writer
+	w       *bufio.Writer
+	format  Format
+	samples int64
+	err     error
+	scratch [4]byte
+}
+
+// newWAVWriter writes the header of a WAV file with the number of samples
+// that follow. When it is not known up front, -1, the sizes in the header
+// are fixed by finish.
+func newWAVWriter(out io.Writer, format Format, samples int) *wavWriter {
+	w := &wavWriter{out: out, w: bufio.NewWriter(out), format: format}
+	w.header(int64(samples) * 4)
+	return w
+}
+
+// header writes the header for a number of bytes of samples, which is
+// unknown when negative.
+func (w *wavWriter) header(dataSize int64) {
+	riffSize := dataSize + wavHeaderSize - 8
+	if dataSize < 0 || riffSize > math.MaxUint32 {
+		dataSize, riffSize = math.MaxUint32, math.MaxUint32
+	}
+
+	header := make([]byte, wavHeaderSize)
+	copy(header, "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(riffSize))
+	copy(header[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(header[16:], 16)
+	binary.LittleEndian.PutUint16(header[20:], wavFloat)
+	binary.LittleEndian.PutUint16(header[22:], uint16(w.format.Channels))
+	binary.LittleEndian.PutUint32(header[24:], uint32(w.format.SampleRate))
+	binary.LittleEndian.PutUint32(header[28:], uint32(w.format.SampleRate*w.format.Channels*4))
+	binary.LittleEndian.PutUint16(header[32:], uint16(w.format.Channels*4))
+	binary.LittleEndian.PutUint16(header[34:], 32)
+	copy(header[36:], "data")
+	binary.LittleEndian.PutUint32(header[40:], uint32(dataSize))
+	if _, err := w.w.Write(header); err != nil && w.err == nil {
+		w.err = err
+	}
+}
+
+func (w *wavWriter) write(samples []float32) {
+	if w.err != nil {
+		return
+	}
+	for _, v := range samples {
+		binary.LittleEndian.PutUint32(w.scratch[:], math.Float32bits(v))
+		if _, err := w.w.Write(w.scratch[:]); err != nil {
+			w.err = err
+			return
+		}
+	}
+	w.samples += int64(len(samples))
+}
+
+// finish writes the remaining samples and the sizes in the header, when the
+// file can seek.
+func (w *wavWriter) finish() error {
+	if err := w.w.Flush(); err != nil && w.err == nil {
+		w.err = err
+	}
+	if w.err != nil {
+		return w.err
+	}
+
+	seeker, ok := w.out.(io.WriteSeeker)
+	if !ok {
+		return nil
+	}
+	if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	w.w.Reset(seeker)
+	w.header(w.samples * 4)
+	if err := w.w.Flush(); err != nil {
+		return err
+	}
+	_, err := seeker.Seek(0, io.SeekEnd)
+	return err
+}
@@ -0,0 +1,125 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"testing"
+)
+
+// pcmWAV returns a WAV file with integer samples of a number of bits.
+func pcmWAV(format Format, bits int, samples []float32, extensible bool) []byte {
+	width := bits / 8
+	data := make([]byte, len(samples)*width)
+	for i, v := range samples {
+		scaled := int64(math.Round(float64(v) * float64(int64(1)<<(bits-1))))
+		if bits == 8 {
+			scaled += 128
+		}
+		for j := 0; j < width; j++ {
+			data[i*width+j] = byte(scaled >> (8 * j))
+		}
+	}
+
+	chunkData := make([]byte, 16, 40)
+	tag := uint16(wavPCM)
+	if extensible {
+		tag = wavExtensible
+	}
+	binary.LittleEndian.PutUint16(chunkData, tag)
+	binary.LittleEndian.PutUint16(chunkData[2:], uint16(format.Channels))
+	binary.LittleEndian.PutUint32(chunkData[4:], uint32(format.SampleRate))
+	binary.LittleEndian.PutUint32(chunkData[8:], uint32(format.SampleRate*format.Channels*width))
+	binary.LittleEndian.PutUint16(chunkData[12:], uint16(format.Channels*width))
+	binary.LittleEndian.PutUint16(chunkData[14:], uint16(bits))
+	if extensible {
+		extension := make([]byte, 24)
+		binary.LittleEndian.PutUint16(extension, 22)
+		binary.LittleEndian.PutUint16(extension[2:], uint16(bits))
+		binary.LittleEndian.PutUint16(extension[8:], wavPCM)
+		chunkData = append(chunkData, extension...)
+	}
+
+	var file bytes.Buffer
+	chunk := func(id string, data []byte) {
+		file.WriteString(id)
+		binary.Write(&file, binary.LittleEndian, uint32(len(data)))
+		file.Write(data)
+		if len(data)%2 == 1 {
+			file.WriteByte(0)
+		}
+	}
+	file.WriteString("RIFF\x00\x00\x00\x00WAVE")
+	chunk("fmt ", chunkData)
+	chunk("LIST", []byte("ignored"))
+	chunk("data", data)
+	return file.Bytes()
+}
+
+func TestDecodeWAV(t *testing.T) {
+	format := Format{SampleRate: 22050, Channels: 2}
+	samples := []float32{0, 0.5, -0.5, 0.25, -1, 0.75}
+
+	for _, test := range []struct {
+		bits       int
+		extensible bool
+	}{{8, false}, {16, false}, {24, false}, {32, false}, {16, true}} {
+		sound, err := Decode(bytes.NewReader(pcmWAV(format, test.bits, samples, test.extensible)))
+		if err != nil {
+			t.Errorf("%d bits: %s", test.bits, err)
+			continue
+		}
+		if sound.Format != format {
+			t.Errorf("%d bits: expected format %v, got %v", test.bits, format, sound.Format)
+		}
+		if !equalSamples(sound.Samples, samples) {
+			t.Errorf("%d bits: expected %v, got %v", test.bits, samples, sound.Samples)
+		}
+	}
+
+	if _, err := Decode(bytes.NewReader([]byte("RIFF\x00\x00\x00\x00WAVEdata"))); err == nil {
+		t.Errorf("expected an error for a WAV file without format")
+	}
+}
+
+func TestWriteWAV(t *testing.T) {
+	sound := &Sound{Format: Format{SampleRate: 8000, Channels: 1}, Samples: []float32{0.1, -0.2, 0.3, 1}}
+	var file bytes.Buffer
+	if err := WriteWAV(&file, sound); err != nil {
+		t.Fatal(err)
+	}
+
+	// Files that cannot seek are streamed, not rewound
+	stream, err := NewStream(io.MultiReader(&file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := make([]float32, 10)
+	n, err := readFull(stream, decoded)
+	if err != io.EOF || !equalSamples(decoded[:n], sound.Samples) {
+		t.Errorf("expected %v, got %v and %v", sound.Samples, decoded[:n], err)
+	}
+	if err := stream.(Rewinder).Rewind(); err == nil {
+		t.Errorf("expected an error rewinding a file that cannot seek")
+	}
+}
+
+func TestWAVUnknownSize(t *testing.T) {
+	format := Format{SampleRate: 8000, Channels: 2}
+	var file bytes.Buffer
+	w := newWAVWriter(&file, format, -1)
+	w.write([]float32{0.5, -0.5, 0.25, -0.25})
+	if err := w.finish(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Recordings that were cut short play to the end of the file
+	sound, err := Decode(bytes.NewReader(file.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sound.Frames() != 2 {
+		t.Errorf("expected 2 frames, got %d", sound.Frames())
+	}
+}
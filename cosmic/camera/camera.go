@@ -0,0 +1,135 @@
+// Package camera provides cameras producing matrices in Vulkan clip space,
+// and layers that control them with the mouse and keyboard.
+package camera
+
+import "github.com/lentus/cosmic-engine/cosmic/math"
+
+// Camera is a view into the world. The camera looks along the -z axis of its
+// transform, with +y pointing up.
+type Camera interface {
+	View() math.Mat4
+	Projection() math.Mat4
+	// ViewProjection returns the projection multiplied by the view.
+	ViewProjection() math.Mat4
+	// SetAspect sets the ratio of the width of the image to its height.
+	SetAspect(aspect float32)
+	GetTransform() *Transform
+}
+
+// Transform places a camera in the world.
+type Transform struct {
+	Position    math.Vec3
+	Orientation math.Quat
+}
+
+func (t *Transform) GetTransform() *Transform {
+	return t
+}
+
+// View returns the inverse of the transform, which moves the world in front
+// of the camera.
+func (t *Transform) View() math.Mat4 {
+	return t.Orientation.Conjugate().Mat4().Mul(math.Translation(t.Position.Scale(-1)))
+}
+
+func (t *Transform) Forward() math.Vec3 {
+	return t.Orientation.Rotate(math.Vec3{Z: -1})
+}
+
+func (t *Transform) Right() math.Vec3 {
+	return t.Orientation.Rotate(math.Vec3{X: 1})
+}
+
+func (t *Transform) Up() math.Vec3 {
+	return t.Orientation.Rotate(math.Vec3{Y: 1})
+}
+
+type Perspective struct {
+	Transform
+
+	// Vertical field of view in radians
+	FieldOfView float32
+	Aspect      float32
+	Near, Far   float32
+	// ReversedZ maps the near plane to depth 1 and the far plane to depth 0,
+	// see math.ReverseDepth.
+	ReversedZ bool
+}
+
+func NewPerspective(fieldOfView, aspect, near, far float32) *Perspective {
+	return &Perspective{
+		Transform:   Transform{Orientation: math.IdentityQuat()},
+		FieldOfView: fieldOfView,
+		Aspect:      aspect,
+		Near:        near,
+		Far:         far,
+	}
+}
+
+func (c *Perspective) Projection() math.Mat4 {
+	projection := math.Perspective(c.FieldOfView, c.Aspect, c.Near, c.Far)
+	if c.ReversedZ {
+		projection = math.ReverseDepth().Mul(projection)
+	}
+
+	return projection
+}
+
+func (c *Perspective) ViewProjection() math.Mat4 {
+	return c.Projection().Mul(c.View())
+}
+
+func (c *Perspective) SetAspect(aspect float32) {
+	c.Aspect = aspect
+}
+
+// Orthographic projects without perspective, so it also serves as the camera
+// of 2D scenes. The visible area is centered on the camera position.
+type Orthographic struct {
+	Transform
+
+	// Height of the visible area in world units, its width follows from the
+	// aspect ratio.
+	Height    float32
+	Aspect    float32
+	Near, Far float32
+	// ReversedZ maps the near plane to depth 1 and the far plane to depth 0,
+	// see math.ReverseDepth.
+	ReversedZ bool
+}
+
+func NewOrthographic(height, aspect, near, far float32) *Orthographic {
+	return &Orthographic{
+		Transform: Transform{Orientation: math.IdentityQuat()},
+		Height:    height,
+		Aspect:    aspect,
+		Near:      near,
+		Far:       far,
+	}
+}
+
+// Bounds returns the visible area relative to the camera position.
+func (c *Orthographic) Bounds() (left, right, bottom, top float32) {
+	halfHeight := c.Height / 2
+	halfWidth := halfHeight * c.Aspect
+
+	return -halfWidth, halfWidth, -halfHeight, halfHeight
+}
+
+func (c *Orthographic) Projection() math.Mat4 {
+	left, right, bottom, top := c.Bounds()
+	projection := math.Orthographic(left, right, bottom, top, c.Near, c.Far)
+	if c.ReversedZ {
+		projection = math.ReverseDepth().Mul(projection)
+	}
+
+	return projection
+}
+
+func (c *Orthographic) ViewProjection() math.Mat4 {
+	return c.Projection().Mul(c.View())
+}
+
+func (c *Orthographic) SetAspect(aspect float32) {
+	c.Aspect = aspect
+}
@@ -0,0 +1,170 @@
+package camera
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/event"
+	"github.com/lentus/cosmic-engine/cosmic/input"
+	"github.com/lentus/cosmic-engine/cosmic/math"
+	stdmath "math"
+	"testing"
+)
+
+func near(a, b float32) bool {
+	return a-b < 1e-4 && b-a < 1e-4
+}
+
+func nearVec3(a, b math.Vec3) bool {
+	return near(a.X, b.X) && near(a.Y, b.Y) && near(a.Z, b.Z)
+}
+
+// project returns the normalized device coordinates of a point.
+func project(c Camera, point math.Vec3) math.Vec3 {
+	clip := c.ViewProjection().MulVec4(math.Vec4{X: point.X, Y: point.Y, Z: point.Z, W: 1})
+	return math.Vec3{X: clip.X / clip.W, Y: clip.Y / clip.W, Z: clip.Z / clip.W}
+}
+
+func TestPerspective_ViewProjection(t *testing.T) {
+	c := NewPerspective(1.5707964, 1, 1, 100)
+	c.Position = math.Vec3{X: 10, Y: 0, Z: 0}
+	// Look along -x
+	c.Orientation = math.QuatAxisAngle(math.Vec3{Y: 1}, 1.5707964)
+
+	// Up in the world is up on screen, where y points down
+	if got := project(c, math.Vec3{X: 0, Y: 5, Z: 0}); !nearVec3(got, math.Vec3{X: 0, Y: -0.5, Z: got.Z}) {
+		t.Errorf("expected the point to be in the upper half of the screen, got %v", got)
+	}
+	if got := project(c, math.Vec3{X: 9, Y: 0, Z: 0}); !near(got.Z, 0) {
+		t.Errorf("expected a point on the near plane to have depth 0, got %f", got.Z)
+	}
+
+	c.ReversedZ = true
+	if got := project(c, math.Vec3{X: 9, Y: 0, Z: 0}); !near(got.Z, 1) {
+		t.Errorf("expected a point on the near plane to have reversed depth 1, got %f", got.Z)
+	}
+}
+
+func TestOrthographic_ViewProjection(t *testing.T) {
+	c := NewOrthographic(10, 2, -1, 1)
+	c.Position = math.Vec3{X: 5, Y: 5}
+
+	if got := project(c, math.Vec3{X: -5, Y: 10}); !nearVec3(got, math.Vec3{X: -1, Y: -1, Z: 0.5}) {
+		t.Errorf("expected the top left corner, got %v", got)
+	}
+}
+
+func TestControllers_WindowResize(t *testing.T) {
+	perspective := NewPerspective(1, 1, 0.1, 100)
+	orthographic := NewOrthographic(2, 1, -1, 1)
+
+	for _, test := range []struct {
+		controller interface{ OnEvent(event.Event) }
+		aspect     *float32
+	}{
+		{NewFlyController(perspective), &perspective.Aspect},
+		{NewOrbitController(perspective, math.Vec3{}, 5), &perspective.Aspect},
+		{NewPanZoomController(orthographic, 100, 100), &orthographic.Aspect},
+	} {
+		*test.aspect = 1
+		test.controller.OnEvent(&event.WindowResize{Width: 300, Height: 150})
+		if *test.aspect != 2 {
+			t.Errorf("expected %T to update the aspect ratio to 2, got %f", test.controller, *test.aspect)
+		}
+
+		// Minimized windows are ignored
+		test.controller.OnEvent(&event.WindowResize{})
+		if *test.aspect != 2 {
+			t.Errorf("expected %T to ignore minimized windows, got aspect ratio %f", test.controller, *test.aspect)
+		}
+	}
+}
+
+func TestFlyController(t *testing.T) {
+	c := NewPerspective(1, 1, 0.1, 100)
+	controller := NewFlyController(c)
+
+	controller.OnEvent(&event.KeyPressed{Key: input.KeyW})
+	controller.Update(2)
+	if !nearVec3(c.Position, math.Vec3{Z: -10}) {
+		t.Errorf("expected to fly forward to (0, 0, -10), got %v", c.Position)
+	}
+
+	// Dragging right turns right
+	controller.OnEvent(&event.KeyReleased{Key: input.KeyW})
+	controller.OnEvent(&event.MouseMoved{X: 0, Y: 0})
+	controller.OnEvent(&event.MouseButtonPressed{Button: input.MouseButtonRight})
+	controller.OnEvent(&event.MouseMoved{X: 100, Y: 0})
+	if forward := c.Forward(); forward.X <= 0 {
+		t.Errorf("expected to look to the right, got forward %v", forward)
+	}
+
+	// Losing focus releases the keys
+	controller.OnEvent(&event.KeyPressed{Key: input.KeyW})
+	controller.OnEvent(&event.WindowLostFocus{})
+	position := c.Position
+	controller.Update(1)
+	if c.Position != position {
+		t.Errorf("expected not to move after losing focus")
+	}
+}
+
+func TestOrbitController(t *testing.T) {
+	c := NewPerspective(1, 1, 0.1, 100)
+	target := math.Vec3{X: 1, Y: 2, Z: 3}
+	controller := NewOrbitController(c, target, 5)
+
+	controller.OnEvent(&event.MouseMoved{X: 0, Y: 0})
+	controller.OnEvent(&event.MouseButtonPressed{Button: input.MouseButtonLeft})
+	controller.OnEvent(&event.MouseMoved{X: 120, Y: -80})
+	controller.OnEvent(&event.MouseScrolled{OffsetY: 1})
+
+	if distance := c.Position.Sub(target).Len(); !near(distance, 4.5) {
+		t.Errorf("expected to zoom in to a distance of 4.5, got %f", distance)
+	}
+	if got := project(c, target); !near(got.X, 0) || !near(got.Y, 0) {
+		t.Errorf("expected the target in the center of the screen, got %v", got)
+	}
+}
+
+func TestPanZoomController(t *testing.T) {
+	c := NewOrthographic(100, 2, -1, 1)
+	controller := NewPanZoomController(c, 200, 100)
+
+	// Zooming keeps the point under the cursor in place
+	controller.OnEvent(&event.MouseMoved{X: 150, Y: 25})
+	before := controller.WorldPosition(150, 25)
+	controller.OnEvent(&event.MouseScrolled{OffsetY: 2})
+	after := controller.WorldPosition(150, 25)
+	if !near(c.Height, 81) {
+		t.Errorf("expected a height of 81 after zooming in, got %f", c.Height)
+	}
+	if !near(before.X, after.X) || !near(before.Y, after.Y) {
+		t.Errorf("expected %v to stay under the cursor, got %v", before, after)
+	}
+
+	// Dragging moves the point under the cursor with it
+	controller.OnEvent(&event.MouseButtonPressed{Button: input.MouseButtonMiddle})
+	controller.OnEvent(&event.MouseMoved{X: 100, Y: 50})
+	if got := controller.WorldPosition(100, 50); !near(got.X, before.X) || !near(got.Y, before.Y) {
+		t.Errorf("expected %v to be dragged to the cursor, got %v", before, got)
+	}
+}
+
+func TestScreenRay(t *testing.T) {
+	for _, reversed := range []bool{false, true} {
+		c := NewPerspective(stdmath.Pi/2, 2, 0.5, 100)
+		c.ReversedZ = reversed
+		c.Position = math.Vec3{Y: 1}
+
+		// The center of the screen looks straight ahead
+		ray := ScreenRay(c, 100, 50, 200, 100)
+		if !nearVec3(ray.Origin, math.Vec3{Y: 1, Z: -0.5}) || !nearVec3(ray.Direction, math.Vec3{Z: -1}) {
+			t.Errorf("expected a ray from the near plane along -z, got %+v", ray)
+		}
+
+		// The top right corner is 45 degrees up, and twice as far right
+		ray = ScreenRay(c, 200, 0, 200, 100)
+		expected := math.Vec3{X: 2, Y: 1, Z: -1}.Normalize()
+		if !nearVec3(ray.Direction, expected) {
+			t.Errorf("expected direction %v, got %v", expected, ray.Direction)
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package camera
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/event"
+	"github.com/lentus/cosmic-engine/cosmic/input"
+	"github.com/lentus/cosmic-engine/cosmic/math"
+	stdmath "math"
+)
+
+// maxPitch keeps cameras from looking straight up or down, where yaw would
+// rotate around the view direction.
+const maxPitch = stdmath.Pi/2 - 0.01
+
+var (
+	xAxis = math.Vec3{X: 1}
+	yAxis = math.Vec3{Y: 1}
+)
+
+// yawPitch returns the orientation that first pitches around the x axis and
+// then yaws around the world up axis.
+func yawPitch(yaw, pitch float32) math.Quat {
+	return math.QuatAxisAngle(yAxis, yaw).Mul(math.QuatAxisAngle(xAxis, pitch))
+}
+
+// toYawPitch is the inverse of yawPitch for the direction a transform looks
+// in, so controllers continue from the orientation a camera already has.
+func toYawPitch(t *Transform) (yaw, pitch float32) {
+	forward := t.Forward()
+	yaw = float32(stdmath.Atan2(-float64(forward.X), -float64(forward.Z)))
+	pitch = float32(stdmath.Asin(float64(forward.Y)))
+
+	return yaw, clampPitch(pitch)
+}
+
+func clampPitch(pitch float32) float32 {
+	return float32(stdmath.Max(-maxPitch, stdmath.Min(maxPitch, float64(pitch))))
+}
+
+// FlyController moves a camera freely: W, A, S and D move along the view
+// direction, E and Space move up, Q and left control move down and holding
+// left shift moves faster. Dragging with the look button turns the camera and
+// scrolling changes the speed.
+type FlyController struct {
+	Camera Camera
+
+	// Speed in world units per second
+	Speed            float32
+	SprintMultiplier float32
+	// Sensitivity in radians per pixel the cursor moves
+	Sensitivity float32
+	LookButton  input.MouseButton
+
+	yaw, pitch float32
+	input      inputState
+	clock      clock
+}
+
+func NewFlyController(camera Camera) *FlyController {
+	c := &FlyController{
+		Camera:           camera,
+		Speed:            5,
+		SprintMultiplier: 4,
+		Sensitivity:      0.0025,
+		LookButton:       input.MouseButtonRight,
+		input:            newInputState(),
+	}
+	c.yaw, c.pitch = toYawPitch(camera.GetTransform())
+
+	return c
+}
+
+func (c *FlyController) OnAttach() {}
+
+func (c *FlyController) OnDetach() {}
+
+func (c *FlyController) OnUpdate() {
+	c.Update(c.clock.elapsed())
+}
+
+func (c *FlyController) OnEvent(e event.Event) {
+	updateAspect(c.Camera, e)
+
+	moved := c.input.handle(e)
+	if c.input.buttons[c.LookButton] && moved != (math.Vec2{}) {
+		c.yaw -= moved.X * c.Sensitivity
+		c.pitch = clampPitch(c.pitch - moved.Y*c.Sensitivity)
+		c.Camera.GetTransform().Orientation = yawPitch(c.yaw, c.pitch)
+	}
+
+	if e, ok := e.(*event.MouseScrolled); ok {
+		c.Speed *= float32(stdmath.Pow(1.1, float64(e.OffsetY)))
+	}
+}
+
+// Update moves the camera by the keys held for the given number of seconds.
+func (c *FlyController) Update(elapsed float32) {
+	t := c.Camera.GetTransform()
+	t.Orientation = yawPitch(c.yaw, c.pitch)
+
+	forward := c.input.axis([]input.Key{input.KeyW}, []input.Key{input.KeyS})
+	right := c.input.axis([]input.Key{input.KeyD}, []input.Key{input.KeyA})
+	up := c.input.axis([]input.Key{input.KeyE, input.KeySpace}, []input.Key{input.KeyQ, input.KeyLeftControl})
+
+	direction := t.Forward().Scale(forward).Add(t.Right().Scale(right)).Add(yAxis.Scale(up)).Normalize()
+	speed := c.Speed
+	if c.input.keys[input.KeyLeftShift] {
+		speed *= c.SprintMultiplier
+	}
+
+	t.Position = t.Position.Add(direction.Scale(speed * elapsed))
+}
+
+// OrbitController turns a camera around a target it keeps looking at.
+// Dragging with the rotate button or holding the arrow keys orbits the
+// target, dragging with the pan button moves the target and scrolling zooms
+// in and out.
+type OrbitController struct {
+	Camera Camera
+
+	Target                   math.Vec3
+	Distance                 float32
+	MinDistance, MaxDistance float32
+	// ZoomStep is the fraction of the distance one scroll step zooms.
+	ZoomStep float32
+	// Sensitivity in radians per pixel the cursor moves
+	Sensitivity float32
+	// KeySpeed in radians per second the arrow keys orbit
+	KeySpeed     float32
+	RotateButton input.MouseButton
+	PanButton    input.MouseButton
+
+	yaw, pitch float32
+	input      inputState
+	clock      clock
+}
+
+func NewOrbitController(camera Camera, target math.Vec3, distance float32) *OrbitController {
+	c := &OrbitController{
+		Camera:       camera,
+		Target:       target,
+		Distance:     distance,
+		MinDistance:  0.1,
+		MaxDistance:  1000,
+		ZoomStep:     0.1,
+		Sensitivity:  0.005,
+		KeySpeed:     1.5,
+		RotateButton: input.MouseButtonLeft,
+		PanButton:    input.MouseButtonMiddle,
+		input:        newInputState(),
+	}
+	c.yaw, c.pitch = toYawPitch(camera.GetTransform())
+	c.place()
+
+	return c
+}
+
+func (c *OrbitController) OnAttach() {}
+
+func (c *OrbitController) OnDetach() {}
+
+func (c *OrbitController) OnUpdate() {
+	c.Update(c.clock.elapsed())
+}
+
+func (c *OrbitController) OnEvent(e event.Event) {
+	updateAspect(c.Camera, e)
+
+	moved := c.input.handle(e)
+	if moved != (math.Vec2{}) {
+		if c.input.buttons[c.RotateButton] {
+			c.yaw -= moved.X * c.Sensitivity
+			c.pitch = clampPitch(c.pitch - moved.Y*c.Sensitivity)
+		} else if c.input.buttons[c.PanButton] {
+			// Pan by roughly the distance the cursor moved over the target
+			t := c.Camera.GetTransform()
+			scale := c.Distance * c.Sensitivity / 2
+			c.Target = c.Target.Sub(t.Right().Scale(moved.X * scale)).Add(t.Up().Scale(moved.Y * scale))
+		}
+	}
+
+	if e, ok := e.(*event.MouseScrolled); ok {
+		c.Distance *= float32(stdmath.Pow(float64(1-c.ZoomStep), float64(e.OffsetY)))
+	}
+
+	c.place()
+}
+
+// Update orbits by the arrow keys held for the given number of seconds.
+func (c *OrbitController) Update(elapsed float32) {
+	c.yaw += c.input.axis([]input.Key{input.KeyLeft}, []input.Key{input.KeyRight}) * c.KeySpeed * elapsed
+	c.pitch = clampPitch(c.pitch + c.input.axis([]input.Key{input.KeyDown}, []input.Key{input.KeyUp})*c.KeySpeed*elapsed)
+
+	c.place()
+}
+
+// place moves the camera to its distance from the target, looking at it.
+func (c *OrbitController) place() {
+	c.Distance = float32(stdmath.Max(float64(c.MinDistance), stdmath.Min(float64(c.MaxDistance), float64(c.Distance))))
+
+	t := c.Camera.GetTransform()
+	t.Orientation = yawPitch(c.yaw, c.pitch)
+	t.Position = c.Target.Sub(t.Forward().Scale(c.Distance))
+}
+
+// PanZoomController moves an orthographic camera over a 2D scene. Dragging
+// with the pan button or holding W, A, S, D or the arrow keys pans the view,
+// scrolling zooms in and out around the cursor.
+type PanZoomController struct {
+	Camera *Orthographic
+
+	// ZoomStep is the fraction of the visible height one scroll step zooms.
+	ZoomStep             float32
+	MinHeight, MaxHeight float32
+	// KeySpeed in visible heights per second the keys pan
+	KeySpeed  float32
+	PanButton input.MouseButton
+
+	// Size of the window in pixels
+	viewport math.Vec2
+	input    inputState
+	clock    clock
+}
+
+// NewPanZoomController controls the camera of a window of the given size, to
+// convert the cursor position to world coordinates. The size is updated when
+// the window is resized.
+func NewPanZoomController(camera *Orthographic, width, height int) *PanZoomController {
+	return &PanZoomController{
+		Camera:    camera,
+		ZoomStep:  0.1,
+		MinHeight: 0.01,
+		MaxHeight: 1e6,
+		KeySpeed:  1,
+		PanButton: input.MouseButtonMiddle,
+		viewport:  math.Vec2{X: float32(width), Y: float32(height)},
+		input:     newInputState(),
+	}
+}
+
+func (c *PanZoomController) OnAttach() {}
+
+func (c *PanZoomController) OnDetach() {}
+
+func (c *PanZoomController) OnUpdate() {
+	c.Update(c.clock.elapsed())
+}
+
+func (c *PanZoomController) OnEvent(e event.Event) {
+	updateAspect(c.Camera, e)
+	if e, ok := e.(*event.WindowResize); ok && e.Width > 0 && e.Height > 0 {
+		c.viewport = math.Vec2{X: float32(e.Width), Y: float32(e.Height)}
+	}
+
+	moved := c.input.handle(e)
+	if c.input.buttons[c.PanButton] && moved != (math.Vec2{}) {
+		// Keep the point under the cursor under the cursor
+		c.pan(math.Vec2{X: -moved.X, Y: moved.Y}.Scale(c.pixelSize()))
+	}
+
+	if e, ok := e.(*event.MouseScrolled); ok {
+		c.zoom(float32(stdmath.Pow(float64(1-c.ZoomStep), float64(e.OffsetY))))
+	}
+}
+
+// Update pans by the keys held for the given number of seconds.
+func (c *PanZoomController) Update(elapsed float32) {
+	direction := math.Vec2{
+		X: c.input.axis([]input.Key{input.KeyD, input.KeyRight}, []input.Key{input.KeyA, input.KeyLeft}),
+		Y: c.input.axis([]input.Key{input.KeyW, input.KeyUp}, []input.Key{input.KeyS, input.KeyDown}),
+	}
+	c.pan(direction.Normalize().Scale(c.KeySpeed * c.Camera.Height * elapsed))
+}
+
+// WorldPosition returns the point of the xy plane under the given position in
+// the window, in pixels from the top left corner.
+func (c *PanZoomController) WorldPosition(x, y float32) math.Vec2 {
+	t := c.Camera.GetTransform()
+	offset := t.Right().Scale(x - c.viewport.X/2).Add(t.Up().Scale(c.viewport.Y/2 - y)).Scale(c.pixelSize())
+	position := t.Position.Add(offset)
+
+	return math.Vec2{X: position.X, Y: position.Y}
+}
+
+// pan moves the camera by the given distance along its right and up axes.
+func (c *PanZoomController) pan(distance math.Vec2) {
+	t := c.Camera.GetTransform()
+	t.Position = t.Position.Add(t.Right().Scale(distance.X)).Add(t.Up().Scale(distance.Y))
+}
+
+// zoom scales the visible height, keeping the point under the cursor in
+// place.
+func (c *PanZoomController) zoom(factor float32) {
+	height := c.Camera.Height * factor
+	height = float32(stdmath.Max(float64(c.MinHeight), stdmath.Min(float64(c.MaxHeight), float64(height))))
+
+	cursor := c.input.cursor
+	if !c.input.hasCursor {
+		cursor = c.viewport.Scale(0.5)
+	}
+	before := c.WorldPosition(cursor.X, cursor.Y)
+	c.Camera.Height = height
+	after := c.WorldPosition(cursor.X, cursor.Y)
+
+	t := c.Camera.GetTransform()
+	t.Position = t.Position.Add(math.Vec3{X: before.X - after.X, Y: before.Y - after.Y})
+}
+
+// pixelSize returns the size of a pixel in world units.
+func (c *PanZoomController) pixelSize() float32 {
+	if c.viewport.Y == 0 {
+		return 0
+	}
+
+	return c.Camera.Height / c.viewport.Y
+}
@@ -0,0 +1,97 @@
+package camera
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/event"
+	"github.com/lentus/cosmic-engine/cosmic/input"
+	"github.com/lentus/cosmic-engine/cosmic/math"
+	"time"
+)
+
+// inputState tracks the keys and mouse buttons held and the cursor position
+// from events, so controllers do not have to poll the window.
+type inputState struct {
+	keys    map[input.Key]bool
+	buttons map[input.MouseButton]bool
+
+	cursor    math.Vec2
+	hasCursor bool
+}
+
+func newInputState() inputState {
+	return inputState{
+		keys:    make(map[input.Key]bool),
+		buttons: make(map[input.MouseButton]bool),
+	}
+}
+
+// handle updates the state with an event, and returns how far the cursor
+// moved when it is a MouseMoved event.
+func (s *inputState) handle(e event.Event) (moved math.Vec2) {
+	switch e := e.(type) {
+	case *event.KeyPressed:
+		s.keys[e.Key] = true
+	case *event.KeyReleased:
+		delete(s.keys, e.Key)
+	case *event.MouseButtonPressed:
+		s.buttons[e.Button] = true
+	case *event.MouseButtonReleased:
+		delete(s.buttons, e.Button)
+	case *event.MouseMoved:
+		cursor := e.Position()
+		if s.hasCursor {
+			moved = cursor.Sub(s.cursor)
+		}
+		s.cursor, s.hasCursor = cursor, true
+	case *event.WindowLostFocus:
+		// Releases are not reported to unfocused windows
+		s.keys = make(map[input.Key]bool)
+		s.buttons = make(map[input.MouseButton]bool)
+	}
+
+	return moved
+}
+
+// axis returns 1 when only the positive key is held, -1 when only the
+// negative key is held and 0 otherwise.
+func (s *inputState) axis(positive, negative []input.Key) float32 {
+	var value float32
+	for _, key := range positive {
+		if s.keys[key] {
+			value++
+			break
+		}
+	}
+	for _, key := range negative {
+		if s.keys[key] {
+			value--
+			break
+		}
+	}
+
+	return value
+}
+
+// updateAspect sets the aspect ratio of the camera to the new size of the
+// window. Minimized windows have no size and are ignored.
+func updateAspect(camera Camera, e event.Event) {
+	if e, ok := e.(*event.WindowResize); ok && e.Width > 0 && e.Height > 0 {
+		camera.SetAspect(float32(e.Width) / float32(e.Height))
+	}
+}
+
+// clock measures the time between updates of a controller.
+type clock struct {
+	last time.Time
+}
+
+// elapsed returns the seconds since it was last called, 0 the first time.
+func (c *clock) elapsed() float32 {
+	now := time.Now()
+	defer func() { c.last = now }()
+
+	if c.last.IsZero() {
+		return 0
+	}
+
+	return float32(now.Sub(c.last).Seconds())
+}
@@ -0,0 +1,27 @@
+package camera
+
+import "github.com/lentus/cosmic-engine/cosmic/math"
+
+// ScreenRay returns the ray from the camera through a point on the screen, in
+// pixels from the top left corner of a screen of the given size. The ray
+// starts on the near plane, and is used to pick objects with the cursor.
+func ScreenRay(c Camera, x, y, width, height float32) math.Ray {
+	inverse, ok := c.ViewProjection().Inverse()
+	if !ok {
+		return math.Ray{}
+	}
+
+	// Vulkan clip space has y pointing down, like the screen
+	ndc := math.Vec2{X: 2*x/width - 1, Y: 2*y/height - 1}
+	a := inverse.Project(math.Vec3{X: ndc.X, Y: ndc.Y, Z: 0})
+	b := inverse.Project(math.Vec3{X: ndc.X, Y: ndc.Y, Z: 1})
+
+	// With reversed depth the near plane is at depth 1, further along the
+	// view direction means further down -z in view space
+	view := c.View()
+	if view.MulPoint(a).Z < view.MulPoint(b).Z {
+		a, b = b, a
+	}
+
+	return math.Ray{Origin: a, Direction: b.Sub(a).Normalize()}
+}
@@ -0,0 +1,60 @@
+package cook
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// cookerVersion changes whenever cooking gives other results, so files cooked
+// by earlier versions are cooked again.
+const cookerVersion = 1
+
+// cache remembers the files of the previous build, by the path of their
+// source.
+type cache struct {
+	// Settings the files were cooked with
+	Settings string                 `json:"settings"`
+	Entries  map[string]*cacheEntry `json:"entries"`
+}
+
+type cacheEntry struct {
+	Output string `json:"output"`
+	Hash   string `json:"hash"`
+	Size   int64  `json:"size"`
+	GUID   string `json:"guid"`
+	// Files read to cook the output, the source first
+	Inputs []cachedFile `json:"inputs"`
+}
+
+// cachedFile identifies the contents of an input by its hash. Inputs with
+// the size and modification time they had when cooked are not hashed again.
+type cachedFile struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	Hash    string    `json:"hash"`
+}
+
+// readCache reads the cache of the previous build. A missing or broken cache
+// is empty, so everything is cooked.
+func readCache(name string) *cache {
+	c := &cache{}
+	if data, err := os.ReadFile(name); err == nil {
+		json.Unmarshal(data, c)
+	}
+
+	for source, entry := range c.Entries {
+		if entry == nil || len(entry.Inputs) == 0 {
+			delete(c.Entries, source)
+		}
+	}
+
+	return c
+}
+
+func cacheSettings(options Options) string {
+	return fmt.Sprintf("%d %s", cookerVersion, strings.Join(options.Compiler, " "))
+}
@@ -0,0 +1,407 @@
+// Package cook turns a tree of source assets into a build that loads fast:
+// GLSL shaders are compiled to SPIR-V, images are converted to textures with
+// mipmaps and models to the binary model format. Other files are copied.
+// The build has a manifest listing its files, which the asset manager uses
+// to load the cooked files in place of their sources.
+//
+// Cooking is incremental. A cache remembers the inputs of every cooked file,
+// and files whose inputs did not change are not cooked again.
+package cook
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lentus/cosmic-engine/cosmic/asset"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// CacheName is the name of the cache in the output directory, by default.
+const CacheName = ".cook-cache.json"
+
+type Options struct {
+	// Directory with the source assets.
+	Source string
+	// Directory the build is written to. It may be inside the source
+	// directory, in which case it is not cooked itself.
+	Output string
+	// File the cache is kept in, CacheName in the output directory by
+	// default.
+	Cache string
+	// Command compiling GLSL to SPIR-V, which is called with the source file,
+	// "-o" and the output file appended. By default glslc or
+	// glslangValidator, when installed.
+	Compiler []string
+	// Cook every file, even when it did not change.
+	Force bool
+	// Number of files cooked in parallel, the number of CPUs by default.
+	Workers int
+}
+
+// Result lists the source files, by their slash separated path relative to
+// the source directory, and what happened to them.
+type Result struct {
+	Cooked  []string
+	Skipped []string
+	// Removed lists the files removed from the build, relative to the output
+	// directory, because their source no longer exists.
+	Removed  []string
+	Manifest *asset.Manifest
+}
+
+// job cooks one source file.
+type job struct {
+	source string
+	output string
+	cooker cooker
+	// Cache entry of the previous build, if any
+	cached   *cacheEntry
+	upToDate bool
+	// Entry of the next build, the cached one when up to date
+	entry *cacheEntry
+	err   error
+}
+
+// Cook cooks the source assets into the output directory, and writes the
+// manifest of the build. Files that fail to cook are left out of the build,
+// and their errors are returned together once all other files are cooked.
+func Cook(options Options) (*Result, error) {
+	if options.Cache == "" {
+		options.Cache = filepath.Join(options.Output, CacheName)
+	}
+	if options.Compiler == nil {
+		options.Compiler = findCompiler()
+	}
+	if options.Workers <= 0 {
+		options.Workers = runtime.NumCPU()
+	}
+
+	if err := os.MkdirAll(options.Output, 0775); err != nil {
+		return nil, err
+	}
+
+	sources, err := findSources(options.Source, options.Output)
+	if err != nil {
+		return nil, err
+	}
+
+	// Files cooked with other settings are cooked again, but keep their GUIDs
+	previous := readCache(options.Cache)
+	settings := cacheSettings(options)
+	c := &cook{options: options, sources: sources, force: options.Force || previous.Settings != settings}
+	jobs, err := c.plan(previous)
+	if err != nil {
+		return nil, err
+	}
+
+	// Files read by other assets are not copied on their own, unless they
+	// are assets themselves, so the other assets are cooked first
+	c.run(jobs, func(j *job) bool { return j.cooker != copyFile })
+	inputs := make(map[string]bool)
+	for _, j := range jobs {
+		if j.cooker != copyFile && j.err == nil {
+			for _, input := range j.entry.Inputs[1:] {
+				inputs[input.Path] = true
+			}
+		}
+	}
+	c.run(jobs, func(j *job) bool { return j.cooker == copyFile && !inputs[j.source] })
+
+	result := &Result{Manifest: &asset.Manifest{Version: asset.ManifestVersion}}
+	next := &cache{Settings: settings, Entries: make(map[string]*cacheEntry)}
+	var failures []string
+	for _, j := range jobs {
+		switch {
+		case j.err != nil:
+			failures = append(failures, fmt.Sprintf("%s: %s", j.source, j.err.Error()))
+			continue
+		case j.cooker == copyFile && inputs[j.source]:
+			continue
+		case j.upToDate:
+			result.Skipped = append(result.Skipped, j.source)
+		default:
+			result.Cooked = append(result.Cooked, j.source)
+		}
+
+		next.Entries[j.source] = j.entry
+		result.Manifest.Assets = append(result.Manifest.Assets, asset.ManifestEntry{
+			Source: j.source,
+			Path:   j.output,
+			GUID:   j.entry.GUID,
+			Hash:   j.entry.Hash,
+			Size:   j.entry.Size,
+		})
+	}
+
+	result.Removed = removeStale(options.Output, previous, next)
+
+	if err := writeJSON(filepath.Join(options.Output, asset.ManifestName), result.Manifest); err != nil {
+		return nil, err
+	}
+	if err := writeJSON(options.Cache, next); err != nil {
+		return nil, err
+	}
+
+	if len(failures) > 0 {
+		return result, fmt.Errorf("%d of %d files failed to cook:\n%s", len(failures), len(jobs), strings.Join(failures, "\n"))
+	}
+	return result, nil
+}
+
+type cook struct {
+	options Options
+	// Slash separated paths of the source files
+	sources []string
+	// Whether files are cooked even when they are up to date
+	force bool
+}
+
+// findSources lists the files in the source directory, except hidden files
+// and the output directory.
+func findSources(source, output string) ([]string, error) {
+	output, err := filepath.Abs(output)
+	if err != nil {
+		return nil, err
+	}
+
+	var sources []string
+	err = filepath.WalkDir(source, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name != source && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if abs, err := filepath.Abs(name); err == nil && abs == output {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		relative, err := filepath.Rel(source, name)
+		if err != nil {
+			return err
+		}
+		sources = append(sources, filepath.ToSlash(relative))
+		return nil
+	})
+
+	sort.Strings(sources)
+	return sources, err
+}
+
+// plan decides how every source file is cooked, and which of them are up to
+// date in the previous build.
+func (c *cook) plan(previous *cache) ([]*job, error) {
+	jobs := make([]*job, 0, len(c.sources))
+	outputs := make(map[string]string)
+	for _, source := range c.sources {
+		j := &job{source: source}
+		j.cooker, j.output = cookerFor(source)
+
+		if other, ok := outputs[j.output]; ok {
+			return nil, fmt.Errorf("%s and %s are both cooked to %s", other, source, j.output)
+		}
+		outputs[j.output] = source
+
+		j.cached = previous.Entries[source]
+		j.upToDate = !c.force && j.cached != nil && j.cached.Output == j.output && c.upToDate(j.cached)
+		jobs = append(jobs, j)
+	}
+
+	// Moved assets keep their GUID: a new source with the contents of one
+	// that is gone gets its GUID
+	moved := make(map[string]string)
+	for source, cached := range previous.Entries {
+		if i := sort.SearchStrings(c.sources, source); i == len(c.sources) || c.sources[i] != source {
+			moved[cached.Inputs[0].Hash] = cached.GUID
+		}
+	}
+
+	for _, j := range jobs {
+		switch {
+		case j.upToDate:
+			j.entry = j.cached
+		case j.cached != nil:
+			j.entry = &cacheEntry{GUID: j.cached.GUID}
+		default:
+			j.entry = &cacheEntry{GUID: guid(j.source)}
+			if hash, err := hashFile(c.sourcePath(j.source)); err == nil && moved[hash] != "" {
+				j.entry.GUID = moved[hash]
+				delete(moved, hash)
+			}
+		}
+	}
+
+	return jobs, nil
+}
+
+// upToDate returns whether the inputs of a cooked file did not change since
+// it was cooked, and the file itself is still there.
+func (c *cook) upToDate(cached *cacheEntry) bool {
+	for i := range cached.Inputs {
+		input := &cached.Inputs[i]
+		info, err := os.Stat(c.sourcePath(input.Path))
+		if err != nil {
+			return false
+		}
+		if info.Size() == input.Size && info.ModTime().Equal(input.ModTime) {
+			continue
+		}
+
+		// Touched, but maybe not changed
+		hash, err := hashFile(c.sourcePath(input.Path))
+		if err != nil || hash != input.Hash {
+			return false
+		}
+		input.Size, input.ModTime = info.Size(), info.ModTime()
+	}
+
+	info, err := os.Stat(filepath.Join(c.options.Output, filepath.FromSlash(cached.Output)))
+	return err == nil && info.Size() == cached.Size
+}
+
+// run cooks the selected jobs that are not up to date on the workers.
+func (c *cook) run(jobs []*job, selected func(j *job) bool) {
+	queue := make(chan *job)
+	var done sync.WaitGroup
+	for i := 0; i < c.options.Workers; i++ {
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			for j := range queue {
+				j.err = c.cook(j)
+			}
+		}()
+	}
+
+	for _, j := range jobs {
+		if !j.upToDate && selected(j) {
+			queue <- j
+		}
+	}
+	close(queue)
+	done.Wait()
+}
+
+// cook cooks the source file of a job and writes the result to the output
+// directory.
+func (c *cook) cook(j *job) error {
+	ctx := &context{cook: c, source: j.source}
+	data, err := j.cooker.cook(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := writeFile(filepath.Join(c.options.Output, filepath.FromSlash(j.output)), data); err != nil {
+		return err
+	}
+
+	hash := sha256.Sum256(data)
+	j.entry.Output = j.output
+	j.entry.Hash = hex.EncodeToString(hash[:])
+	j.entry.Size = int64(len(data))
+	j.entry.Inputs = ctx.inputs
+	return nil
+}
+
+func (c *cook) sourcePath(name string) string {
+	return filepath.Join(c.options.Source, filepath.FromSlash(name))
+}
+
+// removeStale removes the files of the previous build that are not part of
+// the next one, and the directories left empty.
+func removeStale(output string, previous, next *cache) []string {
+	outputs := make(map[string]bool)
+	for _, entry := range next.Entries {
+		outputs[entry.Output] = true
+	}
+
+	var removed []string
+	for _, entry := range previous.Entries {
+		if outputs[entry.Output] {
+			continue
+		}
+
+		name := filepath.Join(output, filepath.FromSlash(entry.Output))
+		if err := os.Remove(name); err == nil || errors.Is(err, fs.ErrNotExist) {
+			removed = append(removed, entry.Output)
+		}
+		for dir := path.Dir(entry.Output); dir != "."; dir = path.Dir(dir) {
+			if os.Remove(filepath.Join(output, filepath.FromSlash(dir))) != nil {
+				break
+			}
+		}
+	}
+
+	sort.Strings(removed)
+	return removed
+}
+
+// guid returns the GUID of a new asset, which is derived from its path so
+// that cooking the same tree twice gives the same GUIDs.
+func guid(source string) string {
+	hash := sha256.Sum256([]byte(source))
+	return hex.EncodeToString(hash[:16])
+}
+
+func hashFile(name string) (string, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// writeFile writes a file through a temporary file, so a build never holds a
+// partially written file.
+func writeFile(name string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0775); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(name), ".cook-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	// Temporary files are only readable by their owner
+	if err := file.Chmod(0664); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), name)
+}
+
+func writeJSON(name string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFile(name, append(data, '\n'))
+}
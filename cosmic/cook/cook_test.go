@@ -0,0 +1,232 @@
+package cook
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/lentus/cosmic-engine/cosmic/asset"
+	"github.com/lentus/cosmic-engine/cosmic/log"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The test binary stands in for the GLSL compiler when this variable is set.
+const fakeCompilerVariable = "COSMIC_COOK_FAKE_COMPILER"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(fakeCompilerVariable) != "" {
+		os.Exit(fakeCompiler(os.Args[1:]))
+	}
+
+	log.Init(log.LevelWarn, log.LevelWarn)
+	os.Exit(m.Run())
+}
+
+// fakeCompiler "compiles" a shader to the SPIR-V of the engine, unless the
+// source contains an error.
+func fakeCompiler(args []string) int {
+	source, err := os.ReadFile(args[0])
+	if err != nil || bytes.Contains(source, []byte("error")) {
+		os.Stderr.WriteString("shader.frag:1: error: syntax error\n")
+		return 1
+	}
+
+	code, err := os.ReadFile(filepath.Join("..", "internal", "vulkan", "shaders", "spirv", "shader.vert.spv"))
+	if err != nil {
+		return 1
+	}
+	if err := os.WriteFile(args[2], code, 0664); err != nil {
+		return 1
+	}
+	return 0
+}
+
+func encodePNG(width, height int) []byte {
+	var buffer bytes.Buffer
+	png.Encode(&buffer, image.NewRGBA(image.Rect(0, 0, width, height)))
+	return buffer.Bytes()
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, contents := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0775); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(contents), 0664); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func testOptions(t *testing.T) Options {
+	t.Setenv(fakeCompilerVariable, "1")
+
+	source := t.TempDir()
+	writeFiles(t, source, map[string]string{
+		"shaders/lit.vert":         "void main() {}",
+		"textures/crate.png":       string(encodePNG(4, 4)),
+		"models/quad.obj":          "mtllib quad.mtl\nusemtl red\nv 0 0 0\nv 1 0 0\nv 0 1 0\nf 1 2 3\n",
+		"models/quad.mtl":          "newmtl red\nKd 1 0 0\nmap_Kd ../textures/crate.png\n",
+		"materials/crate.material": `{"baseColorTexture": "../textures/crate.png", "vertexShader": "/shaders/lit.vert"}`,
+		".git/config":              "hidden",
+	})
+
+	// The build is inside the source directory, which must not cook it
+	return Options{Source: source, Output: filepath.Join(source, "build"), Compiler: []string{os.Args[0]}}
+}
+
+func manifestPaths(manifest *asset.Manifest) map[string]string {
+	paths := make(map[string]string)
+	for _, entry := range manifest.Assets {
+		paths[entry.Source] = entry.Path
+	}
+	return paths
+}
+
+func TestCook(t *testing.T) {
+	options := testOptions(t)
+
+	result, err := Cook(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"materials/crate.material": "materials/crate.material",
+		"models/quad.obj":          "models/quad.cmesh",
+		"shaders/lit.vert":         "shaders/lit.vert.spv",
+		"textures/crate.png":       "textures/crate.ctex",
+	}
+	if paths := manifestPaths(result.Manifest); !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected the material library to be part of the model only, got %v", paths)
+	}
+	if len(result.Cooked) != 4 || len(result.Skipped) != 0 {
+		t.Errorf("expected everything to be cooked, got %v", result.Cooked)
+	}
+
+	for _, entry := range result.Manifest.Assets {
+		data, err := os.ReadFile(filepath.Join(options.Output, entry.Path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hash := sha256.Sum256(data); hex.EncodeToString(hash[:]) != entry.Hash || int64(len(data)) != entry.Size {
+			t.Errorf("expected the hash and size of %s in the manifest", entry.Path)
+		}
+	}
+
+	// The build loads by the paths of the source assets
+	files := os.DirFS(options.Output)
+	manifest, err := asset.ReadManifest(files, asset.ManifestName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := asset.NewManager(asset.Options{FS: files})
+	defer m.Terminate()
+	m.UseManifest(manifest)
+	material := asset.Load[*asset.Material](m, "materials/crate.material")
+	model := asset.Load[*asset.Model](m, "models/quad.obj")
+	m.WaitAll()
+	crate, ok := material.Get()
+	if !ok || crate.VertexShader.State() != asset.Loaded {
+		t.Fatalf("expected the cooked material to load, got %v", material.Err())
+	}
+	if texture, ok := crate.BaseColorTexture.Get(); !ok || len(texture.Mipmaps) != 2 {
+		t.Errorf("expected the cooked texture with its mipmaps")
+	}
+	if quad, ok := model.Get(); !ok || quad.Model.Materials[0].BaseColorTexture.Path != "../textures/crate.png" {
+		t.Errorf("expected the cooked model to load, got %v", model.Err())
+	}
+}
+
+func TestCook_incremental(t *testing.T) {
+	options := testOptions(t)
+	first, err := Cook(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	guids := make(map[string]string)
+	for _, entry := range first.Manifest.Assets {
+		guids[entry.Source] = entry.GUID
+	}
+
+	result, err := Cook(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Cooked) != 0 || len(result.Skipped) != 4 {
+		t.Errorf("expected nothing to be cooked again, got %v", result.Cooked)
+	}
+
+	// Files read by a model are its inputs, files touched without changes
+	// are not cooked again
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(filepath.Join(options.Source, "textures", "crate.png"), later, later)
+	writeFiles(t, options.Source, map[string]string{"models/quad.mtl": "newmtl red\nKd 0 1 0\n"})
+	if result, err = Cook(options); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result.Cooked, []string{"models/quad.obj"}) {
+		t.Errorf("expected only the model to be cooked again, got %v", result.Cooked)
+	}
+
+	// Moved assets keep their GUID, and the files of removed ones are removed
+	source := filepath.Join(options.Source, "textures")
+	if err := os.Rename(filepath.Join(source, "crate.png"), filepath.Join(source, "wood.png")); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(filepath.Join(options.Source, "shaders", "lit.vert"))
+	if result, err = Cook(options); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result.Removed, []string{"shaders/lit.vert.spv", "textures/crate.ctex"}) {
+		t.Errorf("expected the files of the old sources to be removed, got %v", result.Removed)
+	}
+	if _, err := os.Stat(filepath.Join(options.Output, "shaders")); err == nil {
+		t.Errorf("expected the empty shader directory to be removed")
+	}
+	for _, entry := range result.Manifest.Assets {
+		if entry.Source == "textures/wood.png" && entry.GUID != guids["textures/crate.png"] {
+			t.Errorf("expected the moved texture to keep its GUID")
+		}
+	}
+
+	// Forcing cooks everything, with the same GUIDs
+	options.Force = true
+	if result, err = Cook(options); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Cooked) != 3 || result.Manifest.Assets[0].GUID != guids["materials/crate.material"] {
+		t.Errorf("expected everything to be cooked again, got %v", result.Cooked)
+	}
+}
+
+func TestCook_failures(t *testing.T) {
+	options := testOptions(t)
+	writeFiles(t, options.Source, map[string]string{"shaders/broken.frag": "error"})
+
+	result, err := Cook(options)
+	if err == nil || !strings.Contains(err.Error(), "shaders/broken.frag") || !strings.Contains(err.Error(), "syntax error") {
+		t.Errorf("expected the compiler error of the broken shader, got %v", err)
+	}
+	if _, ok := manifestPaths(result.Manifest)["shaders/broken.frag"]; ok || len(result.Cooked) != 4 {
+		t.Errorf("expected the other files to be cooked without the broken shader")
+	}
+
+	options.Compiler = []string{}
+	if _, err := Cook(options); err == nil || !strings.Contains(err.Error(), "no GLSL compiler") {
+		t.Errorf("expected shaders to fail without a compiler, got %v", err)
+	}
+
+	writeFiles(t, options.Source, map[string]string{"textures/crate.jpg": "jpeg"})
+	if _, err := Cook(options); err == nil || !strings.Contains(err.Error(), "textures/crate.ctex") {
+		t.Errorf("expected an error for two textures cooked to the same file, got %v", err)
+	}
+}
@@ -0,0 +1,224 @@
+package cook
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/lentus/cosmic-engine/cosmic/internal/vulkan/spirv"
+	"github.com/lentus/cosmic-engine/cosmic/mesh"
+	"github.com/lentus/cosmic-engine/cosmic/texture"
+	"image"
+	"image/draw"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+)
+
+// cooker turns a source file into the file in the build.
+type cooker interface {
+	cook(ctx *context) ([]byte, error)
+}
+
+// glslStages are the extensions of GLSL sources, which glslc uses to tell
+// the shader stage.
+var glslStages = map[string]bool{
+	".vert": true,
+	".tesc": true,
+	".tese": true,
+	".geom": true,
+	".frag": true,
+	".comp": true,
+}
+
+// cookerFor returns the cooker of a source file, and the path of the file it
+// cooks.
+func cookerFor(source string) (cooker, string) {
+	extension := strings.ToLower(path.Ext(source))
+	base := strings.TrimSuffix(source, path.Ext(source))
+
+	switch {
+	case glslStages[extension]:
+		return shaderCooker{}, source + ".spv"
+	case extension == ".spv":
+		return spirvCooker{}, source
+	case extension == ".png" || extension == ".jpg" || extension == ".jpeg":
+		return textureCooker{}, base + texture.Extension
+	case extension == ".obj" || extension == ".gltf" || extension == ".glb":
+		return modelCooker{}, base + mesh.BinaryExtension
+	default:
+		return copyFile, source
+	}
+}
+
+// context records the files read to cook a source file.
+type context struct {
+	cook   *cook
+	source string
+	inputs []cachedFile
+}
+
+// readFile reads a file in the source directory as an input of the cooked
+// file.
+func (ctx *context) readFile(name string) ([]byte, error) {
+	file := ctx.cook.sourcePath(name)
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256(data)
+	ctx.inputs = append(ctx.inputs, cachedFile{
+		Path:    name,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		Hash:    hex.EncodeToString(hash[:]),
+	})
+	return data, nil
+}
+
+type copier struct{}
+
+// copyFile copies files without a cooker to the build as they are.
+var copyFile cooker = copier{}
+
+func (copier) cook(ctx *context) ([]byte, error) {
+	return ctx.readFile(ctx.source)
+}
+
+// findCompiler returns the command used to compile GLSL to SPIR-V, or nil
+// when neither glslc nor glslangValidator is installed.
+func findCompiler() []string {
+	if path, err := exec.LookPath("glslc"); err == nil {
+		return []string{path}
+	}
+
+	if path, err := exec.LookPath("glslangValidator"); err == nil {
+		return []string{path, "-V"}
+	}
+
+	return nil
+}
+
+// shaderCooker compiles GLSL shaders to SPIR-V.
+type shaderCooker struct{}
+
+func (shaderCooker) cook(ctx *context) ([]byte, error) {
+	if _, err := ctx.readFile(ctx.source); err != nil {
+		return nil, err
+	}
+
+	compiler := ctx.cook.options.Compiler
+	if len(compiler) == 0 {
+		return nil, errors.New("no GLSL compiler found, install glslc or glslangValidator")
+	}
+
+	output, err := os.CreateTemp("", "cosmic-cook-*.spv")
+	if err != nil {
+		return nil, err
+	}
+	output.Close()
+	defer os.Remove(output.Name())
+
+	args := append(append([]string{}, compiler[1:]...), ctx.cook.sourcePath(ctx.source), "-o", output.Name())
+	var messages bytes.Buffer
+	cmd := exec.Command(compiler[0], args...)
+	cmd.Stdout = &messages
+	cmd.Stderr = &messages
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %s", err.Error(), bytes.TrimSpace(messages.Bytes()))
+	}
+
+	code, err := os.ReadFile(output.Name())
+	if err != nil {
+		return nil, err
+	}
+	if _, err := spirv.Parse(code); err != nil {
+		return nil, fmt.Errorf("compiled to invalid SPIR-V: %s", err.Error())
+	}
+
+	return code, nil
+}
+
+// spirvCooker copies SPIR-V shaders compiled by hand, once they are known to
+// be valid.
+type spirvCooker struct{}
+
+func (spirvCooker) cook(ctx *context) ([]byte, error) {
+	code, err := ctx.readFile(ctx.source)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := spirv.Parse(code); err != nil {
+		return nil, err
+	}
+	return code, nil
+}
+
+// textureCooker converts PNG and JPEG images to textures with mipmaps.
+type textureCooker struct{}
+
+func (textureCooker) cook(ctx *context) ([]byte, error) {
+	data, err := ctx.readFile(ctx.source)
+	if err != nil {
+		return nil, err
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	rgba := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(rgba, rgba.Rect, img, img.Bounds().Min, draw.Src)
+
+	var cooked bytes.Buffer
+	if err := texture.Encode(&cooked, texture.Mipmaps(rgba)); err != nil {
+		return nil, err
+	}
+	return cooked.Bytes(), nil
+}
+
+// modelCooker converts OBJ and glTF models to binary models. The files they
+// refer to, like material libraries and buffers, are inputs of the model.
+type modelCooker struct{}
+
+func (modelCooker) cook(ctx *context) ([]byte, error) {
+	data, err := ctx.readFile(ctx.source)
+	if err != nil {
+		return nil, err
+	}
+
+	open := func(name string) (io.ReadCloser, error) {
+		data, err := ctx.readFile(path.Join(path.Dir(ctx.source), name))
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+
+	var model *mesh.Model
+	if strings.ToLower(path.Ext(ctx.source)) == ".obj" {
+		model, err = mesh.ParseOBJ(bytes.NewReader(data), open)
+	} else {
+		model, err = mesh.ParseGLTF(bytes.NewReader(data), open)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var cooked bytes.Buffer
+	if err := mesh.WriteBinary(&cooked, model); err != nil {
+		return nil, err
+	}
+	return cooked.Bytes(), nil
+}
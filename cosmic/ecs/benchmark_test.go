@@ -0,0 +1,108 @@
+package ecs
+
+import "testing"
+
+const benchmarkEntities = 100000
+
+// benchmarkWorld returns a world with 100k entities with a position, half of
+// them moving and a tenth of those frozen.
+func benchmarkWorld() *World {
+	w := NewWorld()
+	for i := 0; i < benchmarkEntities; i++ {
+		e := w.Spawn()
+		Add(w, e, position{float32(i), 0})
+		if i%2 == 0 {
+			Add(w, e, velocity{1, 1})
+		}
+		if i%20 == 0 {
+			Add(w, e, frozen{})
+		}
+	}
+
+	return w
+}
+
+func BenchmarkQuery1(b *testing.B) {
+	w := benchmarkWorld()
+	q := NewQuery1[position](w)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		q.Each(func(e Entity, p *position) {
+			p.Y++
+		})
+	}
+}
+
+func BenchmarkQuery2(b *testing.B) {
+	w := benchmarkWorld()
+	q := NewQuery2[position, velocity](w)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		q.Each(func(e Entity, p *position, v *velocity) {
+			p.X += v.X
+			p.Y += v.Y
+		})
+	}
+}
+
+func BenchmarkQuery2_without(b *testing.B) {
+	w := benchmarkWorld()
+	q := NewQuery2[position, velocity](w).Without(ID[frozen]())
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		q.Each(func(e Entity, p *position, v *velocity) {
+			p.X += v.X
+			p.Y += v.Y
+		})
+	}
+}
+
+func BenchmarkSchedule(b *testing.B) {
+	w := benchmarkWorld()
+	s := NewSchedule()
+	s.Add(System{
+		Name:   "move",
+		Reads:  []ComponentID{ID[velocity]()},
+		Writes: []ComponentID{ID[position]()},
+		Run: func(f *Frame) {
+			NewQuery2[position, velocity](f.World).Each(func(e Entity, p *position, v *velocity) {
+				p.X += v.X * f.Delta
+				p.Y += v.Y * f.Delta
+			})
+		},
+	})
+	s.Add(System{
+		Name:   "accelerate",
+		Writes: []ComponentID{ID[velocity]()},
+		Run: func(f *Frame) {
+			NewQuery1[velocity](f.World).Each(func(e Entity, v *velocity) {
+				v.Y -= f.Delta
+			})
+		},
+	})
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		s.Run(w, 1.0/60, nil)
+	}
+}
+
+func BenchmarkSpawnDespawn(b *testing.B) {
+	w := NewWorld()
+	entities := make([]Entity, benchmarkEntities)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for j := range entities {
+			entities[j] = w.Spawn()
+			Add(w, entities[j], position{})
+			Add(w, entities[j], velocity{})
+		}
+		for _, e := range entities {
+			w.Despawn(e)
+		}
+	}
+}
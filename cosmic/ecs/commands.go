@@ -0,0 +1,57 @@
+package ecs
+
+// Commands records structural changes to apply to a world later, when no
+// query or schedule runs.
+type Commands struct {
+	world    *World
+	commands []func(w *World)
+}
+
+func NewCommands(w *World) *Commands {
+	return &Commands{world: w}
+}
+
+// Spawn creates an entity right away, so components can be added to it with
+// AddDeferred.
+func (c *Commands) Spawn() Entity {
+	return c.world.Spawn()
+}
+
+func (c *Commands) Despawn(e Entity) {
+	c.Run(func(w *World) { w.Despawn(e) })
+}
+
+// Run records a function to call when the commands are applied.
+func (c *Commands) Run(f func(w *World)) {
+	c.commands = append(c.commands, f)
+}
+
+// Len returns the number of commands recorded.
+func (c *Commands) Len() int {
+	return len(c.commands)
+}
+
+// Apply applies the commands in the order they were recorded and clears
+// them.
+func (c *Commands) Apply() {
+	commands := c.commands
+	c.commands = nil
+	for _, command := range commands {
+		command(c.world)
+	}
+}
+
+// AddDeferred records adding the component to the entity. The command is
+// skipped when the entity is despawned before it is applied.
+func AddDeferred[T any](c *Commands, e Entity, component T) {
+	c.Run(func(w *World) {
+		if w.Alive(e) {
+			Add(w, e, component)
+		}
+	})
+}
+
+// RemoveDeferred records removing the component of type T from the entity.
+func RemoveDeferred[T any](c *Commands, e Entity) {
+	c.Run(func(w *World) { Remove[T](w, e) })
+}
@@ -0,0 +1,309 @@
+package ecs
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/event"
+	"github.com/lentus/cosmic-engine/cosmic/log"
+	"os"
+	"sort"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	log.Init(log.LevelWarn, log.LevelWarn)
+	os.Exit(m.Run())
+}
+
+type position struct{ X, Y float32 }
+type velocity struct{ X, Y float32 }
+type health int
+type frozen struct{}
+
+func expectPanic(t *testing.T, name string, f func()) {
+	t.Helper()
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected %s to panic", name)
+		}
+	}()
+	f()
+}
+
+func TestWorld_entities(t *testing.T) {
+	w := NewWorld()
+	a, b := w.Spawn(), w.Spawn()
+	if a == b || !w.Alive(a) || !w.Alive(b) || w.Len() != 2 {
+		t.Fatalf("expected 2 distinct live entities, got %s and %s", a, b)
+	}
+	if w.Alive(0) {
+		t.Errorf("expected the zero entity not to be alive")
+	}
+
+	w.Despawn(a)
+	if w.Alive(a) || w.Len() != 1 {
+		t.Errorf("expected %s to be despawned", a)
+	}
+
+	// The index is reused with a new generation, so the old handle stays dead
+	c := w.Spawn()
+	if c.Index() != a.Index() || c.Generation() == a.Generation() || w.Alive(a) {
+		t.Errorf("expected %s to reuse the index of %s with a new generation", c, a)
+	}
+
+	var seen []Entity
+	w.Each(func(e Entity) { seen = append(seen, e) })
+	if len(seen) != 2 || seen[0] != c || seen[1] != b {
+		t.Errorf("expected entities %s and %s, got %v", c, b, seen)
+	}
+}
+
+func TestWorld_components(t *testing.T) {
+	w := NewWorld()
+	e := w.Spawn()
+
+	Add(w, e, position{1, 2})
+	Add(w, e, health(10))
+	if p := Get[position](w, e); p == nil || *p != (position{1, 2}) {
+		t.Fatalf("expected position {1 2}, got %v", p)
+	}
+	if Get[velocity](w, e) != nil || Has[velocity](w, e) {
+		t.Errorf("expected no velocity")
+	}
+
+	Get[position](w, e).X = 5
+	Add(w, e, health(20))
+	if Get[position](w, e).X != 5 || *Get[health](w, e) != 20 {
+		t.Errorf("expected components to be updated in place")
+	}
+
+	ids := w.Components(e)
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	expected := []ComponentID{ID[position](), ID[health]()}
+	sort.Slice(expected, func(i, j int) bool { return expected[i] < expected[j] })
+	if len(ids) != 2 || ids[0] != expected[0] || ids[1] != expected[1] {
+		t.Errorf("expected components %v, got %v", expected, ids)
+	}
+
+	Remove[health](w, e)
+	if Has[health](w, e) || !w.Has(e, ID[position]()) {
+		t.Errorf("expected only health to be removed")
+	}
+
+	w.Despawn(e)
+	f := w.Spawn()
+	if Has[position](w, e) || Has[position](w, f) {
+		t.Errorf("expected components to be removed with their entity")
+	}
+	expectPanic(t, "adding to a dead entity", func() { Add(w, e, health(1)) })
+}
+
+func TestStorage_remove(t *testing.T) {
+	w := NewWorld()
+	var entities []Entity
+	for i := 0; i < 5; i++ {
+		e := w.Spawn()
+		Add(w, e, health(i))
+		entities = append(entities, e)
+	}
+
+	// Removing swaps the last component into the gap
+	Remove[health](w, entities[1])
+	Remove[health](w, entities[4])
+	for i, e := range entities {
+		h := Get[health](w, e)
+		if i == 1 || i == 4 {
+			if h != nil {
+				t.Errorf("expected %s to have no health", e)
+			}
+		} else if h == nil || int(*h) != i {
+			t.Errorf("expected %s to have health %d, got %v", e, i, h)
+		}
+	}
+}
+
+func TestQuery(t *testing.T) {
+	w := NewWorld()
+	for i := 0; i < 10; i++ {
+		e := w.Spawn()
+		Add(w, e, position{float32(i), 0})
+		if i%2 == 0 {
+			Add(w, e, velocity{1, 1})
+		}
+		if i%4 == 0 {
+			Add(w, e, frozen{})
+		}
+		if i < 3 {
+			Add(w, e, health(i))
+		}
+	}
+
+	if n := NewQuery1[position](w).Count(); n != 10 {
+		t.Errorf("expected 10 positions, got %d", n)
+	}
+	if n := NewQuery2[position, velocity](w).Count(); n != 5 {
+		t.Errorf("expected 5 moving entities, got %d", n)
+	}
+	if n := NewQuery3[position, velocity, health](w).Count(); n != 2 {
+		t.Errorf("expected 2 entities with health, got %d", n)
+	}
+	if n := NewQuery4[position, velocity, health, frozen](w).Count(); n != 1 {
+		t.Errorf("expected 1 frozen entity with health, got %d", n)
+	}
+	if n := NewQuery1[position](w).With(ID[velocity]()).Without(ID[frozen]()).Count(); n != 2 {
+		t.Errorf("expected 2 filtered entities, got %d", n)
+	}
+
+	NewQuery2[position, velocity](w).Without(ID[frozen]()).Each(func(e Entity, p *position, v *velocity) {
+		p.X += v.X
+	})
+	NewQuery1[position](w).Each(func(e Entity, p *position) {
+		expected := float32(e.Index())
+		if e.Index()%2 == 0 && e.Index()%4 != 0 {
+			expected++
+		}
+		if p.X != expected {
+			t.Errorf("expected %s at %v, got %v", e, expected, p.X)
+		}
+	})
+
+	expectPanic(t, "despawning during a query", func() {
+		NewQuery1[position](w).Each(func(e Entity, p *position) { w.Despawn(e) })
+	})
+	expectPanic(t, "adding a component during a query", func() {
+		NewQuery1[position](w).Each(func(e Entity, p *position) { Add(w, e, frozen{}) })
+	})
+	// The world is unlocked again after a panic
+	w.Despawn(w.Spawn())
+}
+
+func TestCommands(t *testing.T) {
+	w := NewWorld()
+	for i := 0; i < 4; i++ {
+		Add(w, w.Spawn(), health(i))
+	}
+
+	commands := NewCommands(w)
+	NewQuery1[health](w).Each(func(e Entity, h *health) {
+		switch *h {
+		case 0:
+			commands.Despawn(e)
+			// Adding to an entity despawned before is skipped
+			AddDeferred(commands, e, velocity{})
+		case 1:
+			RemoveDeferred[health](commands, e)
+		default:
+			AddDeferred(commands, e, velocity{1, 0})
+		}
+	})
+	spawned := commands.Spawn()
+	AddDeferred(commands, spawned, health(9))
+
+	if commands.Len() != 6 || NewQuery1[velocity](w).Count() != 0 {
+		t.Fatalf("expected commands to be deferred")
+	}
+	commands.Apply()
+
+	if w.Len() != 4 || commands.Len() != 0 {
+		t.Errorf("expected 4 entities and no commands, got %d and %d", w.Len(), commands.Len())
+	}
+	if n := NewQuery1[velocity](w).Count(); n != 2 {
+		t.Errorf("expected 2 moving entities, got %d", n)
+	}
+	if n := NewQuery1[health](w).Count(); n != 3 {
+		t.Errorf("expected 3 entities with health, got %d", n)
+	}
+	if h := Get[health](w, spawned); h == nil || *h != 9 {
+		t.Errorf("expected spawned entity to have health 9, got %v", h)
+	}
+}
+
+func TestSchedule_stages(t *testing.T) {
+	s := NewSchedule()
+	noop := func(*Frame) {}
+	s.Add(System{Name: "input", Writes: []ComponentID{ID[velocity]()}, Run: noop})
+	s.Add(System{Name: "ai", Reads: []ComponentID{ID[position]()}, Writes: []ComponentID{ID[health]()}, Run: noop})
+	s.Add(System{Name: "move", Reads: []ComponentID{ID[velocity]()}, Writes: []ComponentID{ID[position]()}, Run: noop})
+	s.Add(System{Name: "render", Reads: []ComponentID{ID[position]()}, Run: noop})
+	s.Add(System{Name: "debug", Reads: []ComponentID{ID[health]()}, Run: noop})
+	s.Add(System{Name: "cleanup", Exclusive: true, Run: noop})
+	s.Add(System{Name: "stats", Reads: []ComponentID{ID[frozen]()}, Run: noop})
+
+	expected := [][]string{{"input", "ai"}, {"move", "debug"}, {"render"}, {"cleanup"}, {"stats"}}
+	stages := s.Stages()
+	if len(stages) != len(expected) {
+		t.Fatalf("expected stages %v, got %v", expected, stages)
+	}
+	for i := range expected {
+		if len(stages[i]) != len(expected[i]) {
+			t.Fatalf("expected stages %v, got %v", expected, stages)
+		}
+		for j := range expected[i] {
+			if stages[i][j] != expected[i][j] {
+				t.Fatalf("expected stages %v, got %v", expected, stages)
+			}
+		}
+	}
+}
+
+func TestSchedule_Run(t *testing.T) {
+	w := NewWorld()
+	for i := 0; i < 100; i++ {
+		e := w.Spawn()
+		Add(w, e, position{})
+		Add(w, e, velocity{1, 2})
+	}
+
+	var spawned int32
+	s := NewSchedule()
+	s.Add(System{
+		Name:   "move",
+		Reads:  []ComponentID{ID[velocity]()},
+		Writes: []ComponentID{ID[position]()},
+		Run: func(f *Frame) {
+			NewQuery2[position, velocity](f.World).Each(func(e Entity, p *position, v *velocity) {
+				p.X += v.X * f.Delta
+				p.Y += v.Y * f.Delta
+			})
+		},
+	})
+	s.Add(System{
+		Name:   "spawn",
+		Writes: []ComponentID{ID[health]()},
+		Run: func(f *Frame) {
+			// Runs in parallel with move, so the world is locked
+			expectPanic(t, "despawning while scheduled", func() { f.World.Despawn(f.World.Spawn()) })
+			for range f.Events {
+				AddDeferred(f.Commands, f.Commands.Spawn(), health(1))
+				atomic.AddInt32(&spawned, 1)
+			}
+		},
+	})
+	s.Add(System{
+		Name:  "count",
+		Reads: []ComponentID{ID[health]()},
+		Run: func(f *Frame) {
+			// Runs after the commands of spawn are applied
+			if n := NewQuery1[health](f.World).Count(); n != int(atomic.LoadInt32(&spawned)) {
+				t.Errorf("expected %d entities with health, got %d", spawned, n)
+			}
+		},
+	})
+
+	layer := NewLayer(w, s)
+	layer.OnAttach()
+	layer.OnEvent(&event.WindowClose{})
+	layer.OnEvent(&event.WindowClose{})
+	layer.OnUpdate()
+	s.Run(w, 0.5, nil)
+
+	NewQuery1[position](w).Each(func(e Entity, p *position) {
+		if p.X != 0.5 || p.Y != 1 {
+			t.Errorf("expected %s at (0.5, 1), got %v", e, *p)
+		}
+	})
+	// Besides the entities spawned for events, every run of spawn leaves
+	// the entity it failed to despawn
+	if spawned != 2 || w.Len() != 100+2+2 {
+		t.Errorf("expected 2 entities spawned by events, got %d of %d", spawned, w.Len())
+	}
+}
@@ -0,0 +1,33 @@
+// Package ecs stores game state as entities with components, and updates it
+// with systems. Components of one type are kept together in a sparse set, so
+// systems iterate over tightly packed values instead of chasing pointers.
+//
+// Structural changes, adding or removing components and despawning
+// entities, are not allowed while a query or schedule runs. Systems record
+// them in a command buffer instead, which is applied when it is safe.
+package ecs
+
+import "fmt"
+
+// Entity identifies a set of components in a world. It combines the index of
+// its slot with a generation, which is incremented whenever the slot is
+// reused, so handles to despawned entities never refer to new ones. The zero
+// Entity is never alive.
+type Entity uint64
+
+func newEntity(index, generation uint32) Entity {
+	return Entity(generation)<<32 | Entity(index)
+}
+
+// Index returns the slot of the entity, which is reused after despawning.
+func (e Entity) Index() uint32 {
+	return uint32(e)
+}
+
+func (e Entity) Generation() uint32 {
+	return uint32(e >> 32)
+}
+
+func (e Entity) String() string {
+	return fmt.Sprintf("Entity(%d v%d)", e.Index(), e.Generation())
+}
@@ -0,0 +1,46 @@
+package ecs
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/event"
+	"time"
+)
+
+// Layer runs a schedule on a world every frame of the application, when
+// pushed onto its layer stack. Events reaching the layer are passed to the
+// systems in the next frame, and are not handled by it.
+type Layer struct {
+	World    *World
+	Schedule *Schedule
+
+	last   time.Time
+	events []event.Event
+}
+
+func NewLayer(world *World, schedule *Schedule) *Layer {
+	return &Layer{World: world, Schedule: schedule}
+}
+
+func (l *Layer) OnAttach() {
+	l.last = time.Time{}
+}
+
+func (l *Layer) OnDetach() {
+	l.events = nil
+}
+
+func (l *Layer) OnUpdate() {
+	now := time.Now()
+	var delta float32
+	if !l.last.IsZero() {
+		delta = float32(now.Sub(l.last).Seconds())
+	}
+	l.last = now
+
+	events := l.events
+	l.events = nil
+	l.Schedule.Run(l.World, delta, events)
+}
+
+func (l *Layer) OnEvent(e event.Event) {
+	l.events = append(l.events, e)
+}
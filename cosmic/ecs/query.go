@@ -0,0 +1,247 @@
+package ecs
+
+// filter restricts a query to entities that have, or do not have, some
+// components besides the ones it returns.
+type filter struct {
+	with    []ComponentID
+	without []ComponentID
+}
+
+// storages returns the storages of the filtered components, nil for
+// components the world has no storage for.
+func (f *filter) storages(w *World) (with, without []anyStorage) {
+	for _, id := range f.with {
+		with = append(with, w.anyStorage(id))
+	}
+	for _, id := range f.without {
+		without = append(without, w.anyStorage(id))
+	}
+
+	return with, without
+}
+
+// matcher returns a function reporting whether an entity passes the filter,
+// or nil when the filter is empty.
+func (f *filter) matcher(w *World) func(e Entity) bool {
+	if len(f.with) == 0 && len(f.without) == 0 {
+		return nil
+	}
+
+	with, without := f.storages(w)
+	return func(e Entity) bool {
+		for _, s := range with {
+			if s == nil || !s.has(e) {
+				return false
+			}
+		}
+		for _, s := range without {
+			if s != nil && s.has(e) {
+				return false
+			}
+		}
+
+		return true
+	}
+}
+
+// smallest returns the entities of the storage with the fewest components,
+// which are the only candidates for a query needing all of them.
+func smallest(storages ...anyStorage) []Entity {
+	var entities []Entity
+	for i, s := range storages {
+		if i == 0 || s.len() < len(entities) {
+			entities = s.dense()
+		}
+	}
+
+	return entities
+}
+
+// Query1 iterates over the entities with a component of type A.
+type Query1[A any] struct {
+	world  *World
+	a      *storage[A]
+	filter filter
+}
+
+func NewQuery1[A any](w *World) *Query1[A] {
+	return &Query1[A]{world: w, a: storageOf[A](w)}
+}
+
+// With restricts the query to entities that have all of the components.
+func (q *Query1[A]) With(ids ...ComponentID) *Query1[A] {
+	q.filter.with = append(q.filter.with, ids...)
+	return q
+}
+
+// Without restricts the query to entities that have none of the components.
+func (q *Query1[A]) Without(ids ...ComponentID) *Query1[A] {
+	q.filter.without = append(q.filter.without, ids...)
+	return q
+}
+
+// Each calls f for every entity matching the query, with pointers to its
+// components. The world is locked for structural changes meanwhile.
+func (q *Query1[A]) Each(f func(e Entity, a *A)) {
+	q.world.lock()
+	defer q.world.unlock()
+
+	match := q.filter.matcher(q.world)
+	for i, e := range q.a.entities {
+		if match != nil && !match(e) {
+			continue
+		}
+		f(e, &q.a.components[i])
+	}
+}
+
+// Count returns the number of entities matching the query.
+func (q *Query1[A]) Count() int {
+	n := 0
+	q.Each(func(Entity, *A) { n++ })
+	return n
+}
+
+// Query2 iterates over the entities with components of types A and B.
+type Query2[A, B any] struct {
+	world  *World
+	a      *storage[A]
+	b      *storage[B]
+	filter filter
+}
+
+func NewQuery2[A, B any](w *World) *Query2[A, B] {
+	return &Query2[A, B]{world: w, a: storageOf[A](w), b: storageOf[B](w)}
+}
+
+// With restricts the query to entities that have all of the components.
+func (q *Query2[A, B]) With(ids ...ComponentID) *Query2[A, B] {
+	q.filter.with = append(q.filter.with, ids...)
+	return q
+}
+
+// Without restricts the query to entities that have none of the components.
+func (q *Query2[A, B]) Without(ids ...ComponentID) *Query2[A, B] {
+	q.filter.without = append(q.filter.without, ids...)
+	return q
+}
+
+// Each calls f for every entity matching the query, with pointers to its
+// components. The world is locked for structural changes meanwhile.
+func (q *Query2[A, B]) Each(f func(e Entity, a *A, b *B)) {
+	q.world.lock()
+	defer q.world.unlock()
+
+	match := q.filter.matcher(q.world)
+	for _, e := range smallest(q.a, q.b) {
+		a, b := q.a.get(e), q.b.get(e)
+		if a == nil || b == nil || match != nil && !match(e) {
+			continue
+		}
+		f(e, a, b)
+	}
+}
+
+// Count returns the number of entities matching the query.
+func (q *Query2[A, B]) Count() int {
+	n := 0
+	q.Each(func(Entity, *A, *B) { n++ })
+	return n
+}
+
+// Query3 iterates over the entities with components of types A, B and C.
+type Query3[A, B, C any] struct {
+	world  *World
+	a      *storage[A]
+	b      *storage[B]
+	c      *storage[C]
+	filter filter
+}
+
+func NewQuery3[A, B, C any](w *World) *Query3[A, B, C] {
+	return &Query3[A, B, C]{world: w, a: storageOf[A](w), b: storageOf[B](w), c: storageOf[C](w)}
+}
+
+// With restricts the query to entities that have all of the components.
+func (q *Query3[A, B, C]) With(ids ...ComponentID) *Query3[A, B, C] {
+	q.filter.with = append(q.filter.with, ids...)
+	return q
+}
+
+// Without restricts the query to entities that have none of the components.
+func (q *Query3[A, B, C]) Without(ids ...ComponentID) *Query3[A, B, C] {
+	q.filter.without = append(q.filter.without, ids...)
+	return q
+}
+
+// Each calls f for every entity matching the query, with pointers to its
+// components. The world is locked for structural changes meanwhile.
+func (q *Query3[A, B, C]) Each(f func(e Entity, a *A, b *B, c *C)) {
+	q.world.lock()
+	defer q.world.unlock()
+
+	match := q.filter.matcher(q.world)
+	for _, e := range smallest(q.a, q.b, q.c) {
+		a, b, c := q.a.get(e), q.b.get(e), q.c.get(e)
+		if a == nil || b == nil || c == nil || match != nil && !match(e) {
+			continue
+		}
+		f(e, a, b, c)
+	}
+}
+
+// Count returns the number of entities matching the query.
+func (q *Query3[A, B, C]) Count() int {
+	n := 0
+	q.Each(func(Entity, *A, *B, *C) { n++ })
+	return n
+}
+
+// Query4 iterates over the entities with components of types A, B, C and D.
+type Query4[A, B, C, D any] struct {
+	world  *World
+	a      *storage[A]
+	b      *storage[B]
+	c      *storage[C]
+	d      *storage[D]
+	filter filter
+}
+
+func NewQuery4[A, B, C, D any](w *World) *Query4[A, B, C, D] {
+	return &Query4[A, B, C, D]{world: w, a: storageOf[A](w), b: storageOf[B](w), c: storageOf[C](w), d: storageOf[D](w)}
+}
+
+// With restricts the query to entities that have all of the components.
+func (q *Query4[A, B, C, D]) With(ids ...ComponentID) *Query4[A, B, C, D] {
+	q.filter.with = append(q.filter.with, ids...)
+	return q
+}
+
+// Without restricts the query to entities that have none of the components.
+func (q *Query4[A, B, C, D]) Without(ids ...ComponentID) *Query4[A, B, C, D] {
+	q.filter.without = append(q.filter.without, ids...)
+	return q
+}
+
+// Each calls f for every entity matching the query, with pointers to its
+// components. The world is locked for structural changes meanwhile.
+func (q *Query4[A, B, C, D]) Each(f func(e Entity, a *A, b *B, c *C, d *D)) {
+	q.world.lock()
+	defer q.world.unlock()
+
+	match := q.filter.matcher(q.world)
+	for _, e := range smallest(q.a, q.b, q.c, q.d) {
+		a, b, c, d := q.a.get(e), q.b.get(e), q.c.get(e), q.d.get(e)
+		if a == nil || b == nil || c == nil || d == nil || match != nil && !match(e) {
+			continue
+		}
+		f(e, a, b, c, d)
+	}
+}
+
+// Count returns the number of entities matching the query.
+func (q *Query4[A, B, C, D]) Count() int {
+	n := 0
+	q.Each(func(Entity, *A, *B, *C, *D) { n++ })
+	return n
+}
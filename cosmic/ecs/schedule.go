@@ -0,0 +1,131 @@
+package ecs
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/event"
+	"sync"
+)
+
+// Frame is what a system gets to update the world with.
+type Frame struct {
+	World *World
+	// Structural changes of the system, applied after its stage.
+	Commands *Commands
+	// Seconds since the previous frame.
+	Delta float32
+	// Events received since the previous frame.
+	Events []event.Event
+}
+
+// System updates the world once per frame. It declares which components it
+// reads and writes, so systems that do not conflict can run in parallel.
+type System struct {
+	Name   string
+	Reads  []ComponentID
+	Writes []ComponentID
+	// Exclusive systems run alone, with the world unlocked, so they may
+	// access any component and make structural changes directly.
+	Exclusive bool
+	Run       func(f *Frame)
+}
+
+// conflicts reports whether the system cannot run in parallel with other.
+func (s *System) conflicts(other *System) bool {
+	if s.Exclusive || other.Exclusive {
+		return true
+	}
+
+	return overlaps(s.Writes, other.Reads) || overlaps(s.Writes, other.Writes) || overlaps(s.Reads, other.Writes)
+}
+
+func overlaps(a, b []ComponentID) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Schedule runs systems in stages. A system runs in a later stage than every
+// system added before it that it conflicts with, and in parallel with the
+// other systems of its stage. Commands recorded by the systems of a stage
+// are applied before the next stage starts.
+type Schedule struct {
+	systems []System
+	// Stage of every system, and the systems of every stage.
+	stageOf []int
+	stages  [][]int
+}
+
+func NewSchedule() *Schedule {
+	return &Schedule{}
+}
+
+func (s *Schedule) Add(system System) {
+	stage := 0
+	for i := range s.systems {
+		if system.conflicts(&s.systems[i]) && s.stageOf[i] >= stage {
+			stage = s.stageOf[i] + 1
+		}
+	}
+
+	if stage == len(s.stages) {
+		s.stages = append(s.stages, nil)
+	}
+	s.stages[stage] = append(s.stages[stage], len(s.systems))
+	s.systems = append(s.systems, system)
+	s.stageOf = append(s.stageOf, stage)
+}
+
+// Stages returns the names of the systems in every stage.
+func (s *Schedule) Stages() [][]string {
+	names := make([][]string, len(s.stages))
+	for stage, systems := range s.stages {
+		for _, i := range systems {
+			names[stage] = append(names[stage], s.systems[i].Name)
+		}
+	}
+
+	return names
+}
+
+// Run runs every system once.
+func (s *Schedule) Run(w *World, delta float32, events []event.Event) {
+	for _, systems := range s.stages {
+		frames := make([]Frame, len(systems))
+		for i := range frames {
+			frames[i] = Frame{World: w, Commands: NewCommands(w), Delta: delta, Events: events}
+		}
+
+		if len(systems) == 1 {
+			s.runSystem(systems[0], &frames[0])
+		} else {
+			var wg sync.WaitGroup
+			wg.Add(len(systems))
+			for i, system := range systems {
+				go func(system int, frame *Frame) {
+					defer wg.Done()
+					s.runSystem(system, frame)
+				}(system, &frames[i])
+			}
+			wg.Wait()
+		}
+
+		for i := range frames {
+			frames[i].Commands.Apply()
+		}
+	}
+}
+
+func (s *Schedule) runSystem(i int, frame *Frame) {
+	system := &s.systems[i]
+	if !system.Exclusive {
+		frame.World.lock()
+		defer frame.World.unlock()
+	}
+
+	system.Run(frame)
+}
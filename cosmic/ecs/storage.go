@@ -0,0 +1,153 @@
+package ecs
+
+import (
+	"reflect"
+	"sync"
+)
+
+// ComponentID identifies a component type, and is used to declare the
+// access of systems and to filter queries.
+type ComponentID int
+
+var components struct {
+	ids   sync.Map // reflect.Type -> ComponentID
+	mutex sync.Mutex
+	types []reflect.Type
+}
+
+// ID returns the ID of component type T, which is the same in every world.
+func ID[T any]() ComponentID {
+	return idOf(reflect.TypeOf((*T)(nil)).Elem())
+}
+
+func idOf(t reflect.Type) ComponentID {
+	if id, ok := components.ids.Load(t); ok {
+		return id.(ComponentID)
+	}
+
+	components.mutex.Lock()
+	defer components.mutex.Unlock()
+	if id, ok := components.ids.Load(t); ok {
+		return id.(ComponentID)
+	}
+
+	id := ComponentID(len(components.types))
+	components.types = append(components.types, t)
+	components.ids.Store(t, id)
+
+	return id
+}
+
+func (id ComponentID) String() string {
+	components.mutex.Lock()
+	defer components.mutex.Unlock()
+
+	if int(id) < 0 || int(id) >= len(components.types) {
+		return "unknown component"
+	}
+	return components.types[id].String()
+}
+
+// anyStorage is the part of a storage that does not depend on the component
+// type.
+type anyStorage interface {
+	has(e Entity) bool
+	remove(e Entity) bool
+	setAny(e Entity, component interface{})
+	len() int
+	dense() []Entity
+}
+
+// storage is a sparse set of components. The components are packed densely,
+// and sparse maps entity indices to positions in the dense arrays.
+type storage[T any] struct {
+	// Dense index plus one, so zero means the entity has no component.
+	sparse     []int32
+	entities   []Entity
+	components []T
+}
+
+func (s *storage[T]) index(e Entity) int {
+	i := int(e.Index())
+	if i >= len(s.sparse) || s.sparse[i] == 0 {
+		return -1
+	}
+
+	dense := int(s.sparse[i] - 1)
+	if s.entities[dense] != e {
+		return -1
+	}
+	return dense
+}
+
+func (s *storage[T]) has(e Entity) bool {
+	return s.index(e) >= 0
+}
+
+func (s *storage[T]) get(e Entity) *T {
+	if i := s.index(e); i >= 0 {
+		return &s.components[i]
+	}
+	return nil
+}
+
+// set replaces the component of the entity, and returns false when the
+// entity did not have one yet, which is a structural change.
+func (s *storage[T]) set(e Entity, component T) (replaced bool) {
+	if i := s.index(e); i >= 0 {
+		s.components[i] = component
+		return true
+	}
+	return false
+}
+
+func (s *storage[T]) insert(e Entity, component T) {
+	i := int(e.Index())
+	if i >= cap(s.sparse) {
+		grown := make([]int32, i+1, 2*i+1)
+		copy(grown, s.sparse)
+		s.sparse = grown
+	} else if i >= len(s.sparse) {
+		s.sparse = s.sparse[:i+1]
+	}
+
+	s.entities = append(s.entities, e)
+	s.components = append(s.components, component)
+	s.sparse[i] = int32(len(s.entities))
+}
+
+// remove swaps the last component into the place of the removed one.
+func (s *storage[T]) remove(e Entity) bool {
+	i := s.index(e)
+	if i < 0 {
+		return false
+	}
+
+	last := len(s.entities) - 1
+	moved := s.entities[last]
+	s.entities[i] = moved
+	s.components[i] = s.components[last]
+	s.sparse[moved.Index()] = int32(i + 1)
+	s.sparse[e.Index()] = 0
+
+	var zero T
+	s.components[last] = zero
+	s.entities = s.entities[:last]
+	s.components = s.components[:last]
+
+	return true
+}
+
+func (s *storage[T]) setAny(e Entity, component interface{}) {
+	if !s.set(e, component.(T)) {
+		s.insert(e, component.(T))
+	}
+}
+
+func (s *storage[T]) len() int {
+	return len(s.entities)
+}
+
+func (s *storage[T]) dense() []Entity {
+	return s.entities
+}
@@ -0,0 +1,215 @@
+package ecs
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/log"
+	"sync"
+	"sync/atomic"
+)
+
+// slot is the state of an entity index.
+type slot struct {
+	generation uint32
+	free       bool
+}
+
+// World holds entities and their components. Reading components and
+// replacing existing ones is safe from the systems of a schedule running in
+// parallel, as long as they declare their access. Structural changes panic
+// while the world is locked by a query or schedule.
+type World struct {
+	entityMutex sync.RWMutex
+	slots       []slot
+	free        []uint32
+	alive       int
+
+	storageMutex sync.RWMutex
+	storages     []anyStorage
+
+	locked int32
+}
+
+func NewWorld() *World {
+	return &World{}
+}
+
+// Spawn creates an entity without components. Unlike other structural
+// changes it is allowed at any time, so systems can refer to entities they
+// add components to with a command buffer.
+func (w *World) Spawn() Entity {
+	w.entityMutex.Lock()
+	defer w.entityMutex.Unlock()
+
+	w.alive++
+	if n := len(w.free); n > 0 {
+		index := w.free[n-1]
+		w.free = w.free[:n-1]
+		w.slots[index].free = false
+		return newEntity(index, w.slots[index].generation)
+	}
+
+	// Generations start at 1, so the zero entity is never alive
+	w.slots = append(w.slots, slot{generation: 1})
+	return newEntity(uint32(len(w.slots)-1), 1)
+}
+
+// Despawn removes the entity and all its components. Despawning an entity
+// that is not alive does nothing.
+func (w *World) Despawn(e Entity) {
+	w.checkUnlocked("despawn an entity")
+	if !w.Alive(e) {
+		return
+	}
+
+	w.storageMutex.RLock()
+	for _, s := range w.storages {
+		if s != nil {
+			s.remove(e)
+		}
+	}
+	w.storageMutex.RUnlock()
+
+	w.entityMutex.Lock()
+	defer w.entityMutex.Unlock()
+	s := &w.slots[e.Index()]
+	s.free = true
+	s.generation++
+	if s.generation == 0 {
+		// The generation wrapped around, skip the one reserved for the zero
+		// entity
+		s.generation = 1
+	}
+	w.free = append(w.free, e.Index())
+	w.alive--
+}
+
+func (w *World) Alive(e Entity) bool {
+	w.entityMutex.RLock()
+	defer w.entityMutex.RUnlock()
+
+	index := e.Index()
+	return int(index) < len(w.slots) && !w.slots[index].free && w.slots[index].generation == e.Generation()
+}
+
+// Len returns the number of entities alive.
+func (w *World) Len() int {
+	w.entityMutex.RLock()
+	defer w.entityMutex.RUnlock()
+
+	return w.alive
+}
+
+// Each calls f for every entity alive, in order of their index.
+func (w *World) Each(f func(e Entity)) {
+	w.lock()
+	defer w.unlock()
+
+	w.entityMutex.RLock()
+	entities := make([]Entity, 0, w.alive)
+	for index, s := range w.slots {
+		if !s.free {
+			entities = append(entities, newEntity(uint32(index), s.generation))
+		}
+	}
+	w.entityMutex.RUnlock()
+
+	for _, e := range entities {
+		f(e)
+	}
+}
+
+// Has reports whether the entity has a component with the given ID.
+func (w *World) Has(e Entity, id ComponentID) bool {
+	s := w.anyStorage(id)
+	return s != nil && s.has(e)
+}
+
+// Components returns the IDs of the components of the entity.
+func (w *World) Components(e Entity) []ComponentID {
+	w.storageMutex.RLock()
+	defer w.storageMutex.RUnlock()
+
+	var ids []ComponentID
+	for id, s := range w.storages {
+		if s != nil && s.has(e) {
+			ids = append(ids, ComponentID(id))
+		}
+	}
+
+	return ids
+}
+
+// Add sets the component of type T of the entity, replacing the one it has.
+// The entity must be alive.
+func Add[T any](w *World, e Entity, component T) {
+	if !w.Alive(e) {
+		log.PanicfCore("cannot add %s to %s, which is not alive", ID[T](), e)
+	}
+
+	s := storageOf[T](w)
+	if !s.set(e, component) {
+		w.checkUnlocked("add a component")
+		s.insert(e, component)
+	}
+}
+
+// Get returns a pointer to the component of type T of the entity, or nil
+// when it has none. The pointer is invalidated by structural changes.
+func Get[T any](w *World, e Entity) *T {
+	return storageOf[T](w).get(e)
+}
+
+func Has[T any](w *World, e Entity) bool {
+	return storageOf[T](w).has(e)
+}
+
+// Remove removes the component of type T from the entity, if it has one.
+func Remove[T any](w *World, e Entity) {
+	w.checkUnlocked("remove a component")
+	storageOf[T](w).remove(e)
+}
+
+// storageOf returns the storage for components of type T, creating it when
+// the world does not have one yet.
+func storageOf[T any](w *World) *storage[T] {
+	id := ID[T]()
+	if s := w.anyStorage(id); s != nil {
+		return s.(*storage[T])
+	}
+
+	w.storageMutex.Lock()
+	defer w.storageMutex.Unlock()
+	for len(w.storages) <= int(id) {
+		w.storages = append(w.storages, nil)
+	}
+	if w.storages[id] == nil {
+		w.storages[id] = &storage[T]{}
+	}
+
+	return w.storages[id].(*storage[T])
+}
+
+func (w *World) anyStorage(id ComponentID) anyStorage {
+	w.storageMutex.RLock()
+	defer w.storageMutex.RUnlock()
+
+	if int(id) < len(w.storages) {
+		return w.storages[id]
+	}
+	return nil
+}
+
+// lock prevents structural changes until the matching unlock. Locks nest,
+// and may be taken by several goroutines at once.
+func (w *World) lock() {
+	atomic.AddInt32(&w.locked, 1)
+}
+
+func (w *World) unlock() {
+	atomic.AddInt32(&w.locked, -1)
+}
+
+func (w *World) checkUnlocked(action string) {
+	if atomic.LoadInt32(&w.locked) > 0 {
+		log.PanicfCore("cannot %s while a query or schedule runs, use a command buffer", action)
+	}
+}
@@ -1,7 +1,12 @@
 package event
 
+// Signals a fixed tick of the application, at which the game is simulated
+// independently of the frame rate
 type AppTick struct {
 	baseEvent
+
+	// Duration of a tick in seconds
+	Delta float32
 }
 
 func (e *AppTick) Type() Type {
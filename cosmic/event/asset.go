@@ -0,0 +1,65 @@
+package event
+
+import "fmt"
+
+// Signals that an asset finished loading and can be used
+type AssetLoaded struct {
+	baseEvent
+
+	Path string
+}
+
+func (e *AssetLoaded) Type() Type {
+	return TypeAssetLoaded
+}
+
+func (e *AssetLoaded) Category() Category {
+	return CategoryAsset
+}
+
+func (e *AssetLoaded) String() string {
+	return fmt.Sprintf("AssetLoadedEvent [path=%s]", e.Path)
+}
+
+// Signals that an asset, or one of the assets it depends on, failed to load
+type AssetFailed struct {
+	baseEvent
+
+	Path string
+	Err  error
+}
+
+func (e *AssetFailed) Type() Type {
+	return TypeAssetFailed
+}
+
+func (e *AssetFailed) Category() Category {
+	return CategoryAsset
+}
+
+func (e *AssetFailed) String() string {
+	return fmt.Sprintf("AssetFailedEvent [path=%s, error=%s]", e.Path, e.Err.Error())
+}
+
+// Signals that an asset was replaced by a new version, because its file or
+// the file of an asset it depends on changed
+type AssetReloaded struct {
+	baseEvent
+
+	Path string
+	// Path of the asset whose file changed, which is Path itself when the
+	// asset was reloaded rather than one of its dependencies.
+	Cause string
+}
+
+func (e *AssetReloaded) Type() Type {
+	return TypeAssetReloaded
+}
+
+func (e *AssetReloaded) Category() Category {
+	return CategoryAsset
+}
+
+func (e *AssetReloaded) String() string {
+	return fmt.Sprintf("AssetReloadedEvent [path=%s, cause=%s]", e.Path, e.Cause)
+}
@@ -25,6 +25,17 @@ const (
 	TypeMouseButtonReleased
 	TypeMouseMoved
 	TypeMouseScrolled
+
+	// Asset events
+	TypeAssetLoaded
+	TypeAssetFailed
+	TypeAssetReloaded
+
+	// Physics events
+	TypeCollisionBegin
+	TypeCollisionEnd
+	TypeTriggerEnter
+	TypeTriggerExit
 )
 
 type Category int
@@ -37,6 +48,8 @@ const (
 	CategoryKey                  = 1 << 3
 	CategoryMouse                = 1 << 4
 	CategoryMouseButton          = 1 << 5
+	CategoryAsset                = 1 << 6
+	CategoryPhysics              = 1 << 7
 )
 
 type Event interface {
@@ -29,6 +29,8 @@ func TestIsInCategory(t *testing.T) {
 		CategoryKey,
 		CategoryMouse,
 		CategoryMouseButton,
+		CategoryAsset,
+		CategoryPhysics,
 	}
 	all := append(allExceptNone, CategoryNone)
 
@@ -3,6 +3,7 @@ package event
 import (
 	"fmt"
 	"github.com/lentus/cosmic-engine/cosmic/input"
+	"github.com/lentus/cosmic-engine/cosmic/math"
 )
 
 // Signals mouse movement
@@ -12,6 +13,12 @@ type MouseMoved struct {
 	X, Y float32
 }
 
+// Position returns the cursor position in pixels from the top left corner of
+// the window.
+func (e *MouseMoved) Position() math.Vec2 {
+	return math.Vec2{X: e.X, Y: e.Y}
+}
+
 func (e *MouseMoved) Type() Type {
 	return TypeMouseMoved
 }
@@ -31,6 +38,10 @@ type MouseScrolled struct {
 	OffsetX, OffsetY float32
 }
 
+func (e *MouseScrolled) Offset() math.Vec2 {
+	return math.Vec2{X: e.OffsetX, Y: e.OffsetY}
+}
+
 func (e *MouseScrolled) Type() Type {
 	return TypeMouseScrolled
 }
@@ -0,0 +1,143 @@
+package cosmic
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/lentus/cosmic-engine/cosmic/asset"
+	"github.com/lentus/cosmic-engine/cosmic/internal/vulkan/shaders"
+	"github.com/lentus/cosmic-engine/cosmic/log"
+	"github.com/lentus/cosmic-engine/cosmic/vfs"
+	"github.com/lentus/cosmic-engine/cosmic/watch"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// Interval at which asset directories are polled for changes when the
+// operating system cannot report them.
+const assetPollInterval = 500 * time.Millisecond
+
+// Priorities of the mounts of the file system of an application. Mods are
+// mounted with a priority between those of the game and the user, so they
+// override the files of the game and the engine, but not the settings of the
+// user.
+const (
+	PriorityEngine = -100
+	PriorityGame   = 0
+	PriorityMods   = 100
+	PriorityUser   = 200
+)
+
+// EngineShaderPath is where the shaders embedded in the engine are mounted
+// in the file system of an application.
+const EngineShaderPath = "engine/shaders"
+
+// FS returns the file system the application reads its files through. It
+// mounts the shaders of the engine at EngineShaderPath, the asset directory
+// at the root and, over it, the writable user data directory of the
+// application. More directories and archives, like mods, can be mounted
+// before the application runs.
+func (app *Application) FS() *vfs.FS {
+	if app.files != nil {
+		return app.files
+	}
+	app.files = vfs.New()
+
+	if _, err := app.files.Mount(EngineShaderPath, shaders.FS(), vfs.MountOptions{Priority: PriorityEngine}); err != nil {
+		log.ErrorfCore("Failed to mount engine shaders - %s", err.Error())
+	}
+
+	directory := app.AssetDirectory
+	if directory == "" {
+		directory = "."
+	}
+	if _, err := app.files.MountDir("", directory, vfs.MountOptions{Priority: PriorityGame}); err != nil {
+		log.ErrorfCore("Failed to mount asset directory - %s", err.Error())
+	}
+
+	userData, err := vfs.UserDataDir(app.Name)
+	if err == nil {
+		err = os.MkdirAll(userData, 0755)
+	}
+	if err == nil {
+		_, err = app.files.MountDir("", userData, vfs.MountOptions{Priority: PriorityUser, Writable: true})
+	}
+	if err != nil {
+		log.WarnfCore("No user data directory, files cannot be saved - %s", err.Error())
+	} else {
+		log.DebugfCore("Using user data directory %s", userData)
+	}
+
+	return app.files
+}
+
+// shaderFS returns the shaders of the engine in the file system of the
+// application, so they can be overridden like other files.
+func (app *Application) shaderFS() fs.FS {
+	files, err := fs.Sub(app.FS(), EngineShaderPath)
+	if err != nil {
+		log.PanicfCore("Invalid shader path - %s", err.Error())
+	}
+
+	return files
+}
+
+// LoadConfig decodes a JSON file of the file system of the application into
+// v. Configuration saved by the user overrides the defaults shipped with the
+// game, as the user data directory is mounted over the asset directory.
+func (app *Application) LoadConfig(name string, v interface{}) error {
+	data, err := fs.ReadFile(app.FS(), name)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s: %s", name, err.Error())
+	}
+	return nil
+}
+
+// SaveConfig writes v as a JSON file to the user data directory.
+func (app *Application) SaveConfig(name string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("%s: %s", name, err.Error())
+	}
+
+	return app.FS().WriteFile(name, append(data, '\n'))
+}
+
+// watchAssets watches the directories mounted in the file system of the
+// application for changes.
+func (app *Application) watchAssets() watch.Watcher {
+	watcher := watch.New(assetPollInterval)
+	for _, m := range app.FS().Mounts() {
+		if directory := m.Directory(); directory != "" {
+			if err := watcher.Add(directory); err != nil {
+				log.WarnfCore("Cannot watch %s for asset changes - %s", directory, err.Error())
+				continue
+			}
+			log.InfofCore("Watching %s for asset changes", directory)
+		}
+	}
+
+	return watcher
+}
+
+// reloadChangedAssets reloads the assets whose files were reported as changed
+// since the last frame.
+func reloadChangedAssets(files *vfs.FS, assets *asset.Manager, changes <-chan string) {
+	for {
+		select {
+		case file, ok := <-changes:
+			if !ok {
+				return
+			}
+			if name, ok := files.NameOf(file); ok {
+				assets.Reload(name)
+			}
+		default:
+			return
+		}
+	}
+}
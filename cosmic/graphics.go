@@ -0,0 +1,31 @@
+package cosmic
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/graphics"
+	"github.com/lentus/cosmic-engine/cosmic/internal/software"
+	"github.com/lentus/cosmic-engine/cosmic/internal/vulkan"
+	"github.com/lentus/cosmic-engine/cosmic/log"
+)
+
+// Adapters lists the GPUs, and other devices, that can be used for rendering,
+// for instance to let the user pick one in a launcher. Pass the name or index
+// of the picked adapter as WindowProperties.GraphicsProperties.Adapter.
+func Adapters() []graphics.Adapter {
+	return vulkan.Adapters()
+}
+
+// NewOffscreenContext creates a graphics context that renders into images of
+// the given size instead of a window. It does not need a display, so it can
+// be used by server-side tools and in CI with a software Vulkan driver, or
+// without any driver using graphics.BackendSoftware.
+func NewOffscreenContext(properties graphics.ContextProperties, width, height int) graphics.OffscreenContext {
+	switch properties.Backend {
+	case graphics.BackendVulkan:
+		return vulkan.NewOffscreenContext(properties, width, height)
+	case graphics.BackendSoftware:
+		return software.NewOffscreenContext(properties, width, height)
+	default:
+		log.PanicfCore("Invalid graphics backend %d", properties.Backend)
+		return nil
+	}
+}
@@ -0,0 +1,203 @@
+package graphics
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Environment variable with which the adapter can be forced, taking
+// precedence over ContextProperties.Adapter.
+const AdapterEnvironmentVariable = "COSMIC_ADAPTER"
+
+var ErrNoSuitableAdapter = errors.New("no suitable adapter found")
+
+type AdapterType int
+
+const (
+	AdapterOther AdapterType = iota
+	AdapterIntegrated
+	AdapterDiscrete
+	AdapterVirtual
+	AdapterCPU
+)
+
+func (t AdapterType) String() string {
+	switch t {
+	case AdapterIntegrated:
+		return "Integrated GPU"
+	case AdapterDiscrete:
+		return "Discrete GPU"
+	case AdapterVirtual:
+		return "Virtual GPU"
+	case AdapterCPU:
+		return "CPU"
+	default:
+		return "Other"
+	}
+}
+
+// rank orders adapter types by expected performance, higher is better.
+func (t AdapterType) rank() uint64 {
+	switch t {
+	case AdapterDiscrete:
+		return 4
+	case AdapterIntegrated:
+		return 3
+	case AdapterVirtual:
+		return 2
+	case AdapterCPU:
+		return 1
+	default:
+		return 0
+	}
+}
+
+type Version struct {
+	Major, Minor, Patch uint32
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// Adapter describes a GPU, or other device, that can be used for rendering.
+type Adapter struct {
+	// Position of the adapter in the list of enumerated adapters, which can
+	// be used to force the adapter.
+	Index int
+	Name  string
+	Type  AdapterType
+
+	VendorID uint32
+	Vendor   string
+	DeviceID uint32
+
+	DriverVersion string
+	APIVersion    Version
+
+	// Size in bytes of the memory local to the device.
+	DeviceMemory uint64
+
+	// Whether the adapter supports everything the engine requires. When it
+	// does not, Unsupported gives the reason.
+	Suitable    bool
+	Unsupported string
+}
+
+func (a Adapter) String() string {
+	return fmt.Sprintf("#%d %s (%s, %s, driver %s, Vulkan %s, %d MiB)",
+		a.Index, a.Name, a.Type, a.Vendor, a.DriverVersion, a.APIVersion, a.DeviceMemory>>20)
+}
+
+// Score rates how well an adapter is expected to perform, higher is better.
+// The adapter type weighs heaviest, so any discrete GPU beats an integrated
+// one. Device memory comes next and the supported API version breaks ties.
+// Unsuitable adapters always score 0.
+func (a Adapter) Score() uint64 {
+	if !a.Suitable {
+		return 0
+	}
+
+	memoryMiB := a.DeviceMemory >> 20
+	if memoryMiB >= 1<<40 {
+		memoryMiB = 1<<40 - 1
+	}
+
+	apiVersion := uint64(a.APIVersion.Major)<<8 | uint64(a.APIVersion.Minor)
+	if apiVersion >= 1<<16 {
+		apiVersion = 1<<16 - 1
+	}
+
+	return a.Type.rank()<<56 | memoryMiB<<16 | apiVersion
+}
+
+// ChooseAdapter returns the index of the adapter to use. The preference is an
+// adapter index or a case-insensitive part of an adapter name, and is only
+// honoured when it refers to a suitable adapter. Without a preference, the
+// suitable adapter with the highest score is chosen.
+func ChooseAdapter(adapters []Adapter, preference string) (int, error) {
+	if preference != "" {
+		return preferredAdapter(adapters, preference)
+	}
+
+	best := -1
+	for i, adapter := range adapters {
+		if adapter.Suitable && (best < 0 || adapter.Score() > adapters[best].Score()) {
+			best = i
+		}
+	}
+
+	if best < 0 {
+		return -1, ErrNoSuitableAdapter
+	}
+
+	return best, nil
+}
+
+func preferredAdapter(adapters []Adapter, preference string) (int, error) {
+	matches := func(i int) bool {
+		return strings.Contains(strings.ToLower(adapters[i].Name), strings.ToLower(preference))
+	}
+	if index, err := strconv.Atoi(preference); err == nil {
+		matches = func(i int) bool { return adapters[i].Index == index }
+	}
+
+	for i, adapter := range adapters {
+		if !matches(i) {
+			continue
+		}
+
+		if !adapter.Suitable {
+			return -1, fmt.Errorf("preferred adapter %s is not suitable: %s", adapter.Name, adapter.Unsupported)
+		}
+
+		return i, nil
+	}
+
+	return -1, fmt.Errorf("no adapter matches preference %q", preference)
+}
+
+var vendorNames = map[uint32]string{
+	0x1002:  "AMD",
+	0x1010:  "ImgTec",
+	0x10DE:  "NVIDIA",
+	0x13B5:  "ARM",
+	0x5143:  "Qualcomm",
+	0x8086:  "Intel",
+	0x10005: "Mesa",
+}
+
+// VendorName returns the name of the vendor with the given PCI vendor ID.
+func VendorName(vendorID uint32) string {
+	if name, ok := vendorNames[vendorID]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("Unknown (0x%04X)", vendorID)
+}
+
+// FormatDriverVersion formats a driver version the way its vendor does. Only
+// the API version encoding is standardised, NVIDIA and Intel (on Windows)
+// pack their driver versions differently.
+func FormatDriverVersion(vendorID, version uint32, windows bool) string {
+	switch {
+	case vendorID == 0x10DE:
+		return fmt.Sprintf("%d.%d.%d.%d",
+			version>>22, (version>>14)&0xFF, (version>>6)&0xFF, version&0x3F)
+	case vendorID == 0x8086 && windows:
+		return fmt.Sprintf("%d.%d", version>>14, version&0x3FFF)
+	default:
+		return ParseVersion(version).String()
+	}
+}
+
+// ParseVersion decodes a version packed the way Vulkan packs API versions.
+func ParseVersion(version uint32) Version {
+	return Version{
+		Major: version >> 22,
+		Minor: (version >> 12) & 0x3FF,
+		Patch: version & 0xFFF,
+	}
+}
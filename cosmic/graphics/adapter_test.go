@@ -0,0 +1,113 @@
+package graphics
+
+import "testing"
+
+func testAdapters() []Adapter {
+	return []Adapter{
+		{Index: 0, Name: "llvmpipe (LLVM 15.0.7, 256 bits)", Type: AdapterCPU, DeviceMemory: 32 << 30, Suitable: true},
+		{Index: 1, Name: "Intel(R) UHD Graphics 630", Type: AdapterIntegrated, DeviceMemory: 2 << 30, Suitable: true},
+		{Index: 2, Name: "NVIDIA GeForce GTX 1060", Type: AdapterDiscrete, DeviceMemory: 6 << 30, Suitable: true},
+		{Index: 3, Name: "NVIDIA GeForce RTX 3080", Type: AdapterDiscrete, DeviceMemory: 10 << 30, Suitable: false, Unsupported: "missing feature"},
+	}
+}
+
+func TestChooseAdapter_score(t *testing.T) {
+	adapters := testAdapters()
+
+	index, err := ChooseAdapter(adapters, "")
+	if err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	}
+	if index != 2 {
+		t.Errorf("expected the suitable discrete gpu to be chosen, got %s", adapters[index].Name)
+	}
+}
+
+func TestChooseAdapter_memory(t *testing.T) {
+	adapters := testAdapters()
+	adapters[3].Suitable = true
+
+	if index, _ := ChooseAdapter(adapters, ""); index != 3 {
+		t.Errorf("expected the discrete gpu with most memory to be chosen, got %s", adapters[index].Name)
+	}
+}
+
+func TestChooseAdapter_typeOverMemory(t *testing.T) {
+	adapters := testAdapters()[:2]
+
+	if index, _ := ChooseAdapter(adapters, ""); index != 1 {
+		t.Errorf("expected the integrated gpu to beat the cpu, got %s", adapters[index].Name)
+	}
+}
+
+func TestChooseAdapter_preference(t *testing.T) {
+	adapters := testAdapters()
+
+	tests := map[string]int{
+		"0":         0,
+		"1":         1,
+		"intel":     1,
+		"GTX 1060":  2,
+		"llvmpipe":  0,
+		"GeForce G": 2,
+	}
+
+	for preference, expected := range tests {
+		index, err := ChooseAdapter(adapters, preference)
+		if err != nil {
+			t.Errorf("preference %q: unexpected error %s", preference, err.Error())
+		} else if index != expected {
+			t.Errorf("preference %q: expected adapter %d, got %d", preference, expected, index)
+		}
+	}
+}
+
+func TestChooseAdapter_invalidPreference(t *testing.T) {
+	adapters := testAdapters()
+
+	for _, preference := range []string{"3", "RTX", "7", "radeon"} {
+		if _, err := ChooseAdapter(adapters, preference); err == nil {
+			t.Errorf("preference %q: expected an error", preference)
+		}
+	}
+}
+
+func TestChooseAdapter_noneSuitable(t *testing.T) {
+	adapters := testAdapters()
+	for i := range adapters {
+		adapters[i].Suitable = false
+	}
+
+	if _, err := ChooseAdapter(adapters, ""); err != ErrNoSuitableAdapter {
+		t.Errorf("expected ErrNoSuitableAdapter, got %v", err)
+	}
+}
+
+func TestFormatDriverVersion(t *testing.T) {
+	tests := []struct {
+		vendorID uint32
+		version  uint32
+		windows  bool
+		expected string
+	}{
+		{0x10DE, 460<<22 | 91<<14 | 3<<6, false, "460.91.3.0"},
+		{0x8086, 100<<14 | 9466, true, "100.9466"},
+		{0x8086, 21<<22 | 2<<12 | 5, false, "21.2.5"},
+		{0x1002, 2<<22 | 0<<12 | 179, false, "2.0.179"},
+	}
+
+	for _, test := range tests {
+		if actual := FormatDriverVersion(test.vendorID, test.version, test.windows); actual != test.expected {
+			t.Errorf("vendor 0x%04X: expected %s, got %s", test.vendorID, test.expected, actual)
+		}
+	}
+}
+
+func TestVendorName(t *testing.T) {
+	if name := VendorName(0x10DE); name != "NVIDIA" {
+		t.Errorf("expected NVIDIA, got %s", name)
+	}
+	if name := VendorName(0x1234); name != "Unknown (0x1234)" {
+		t.Errorf("expected unknown vendor, got %s", name)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build release
+// +build release
+
+package graphics
+
+// ReleaseBuild is true when the engine is built with the release build tag,
+// which disables all debugging facilities such as validation.
+const ReleaseBuild = true
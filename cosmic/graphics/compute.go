@@ -0,0 +1,84 @@
+package graphics
+
+import (
+	"hash/fnv"
+	"image"
+)
+
+// ComputePipelineDescriptor describes a compute pipeline. Like graphics
+// pipelines, compute pipelines are cached by the hash of their descriptor.
+type ComputePipelineDescriptor struct {
+	Shader ShaderStage
+}
+
+// Hash returns a key identifying the pipeline. Compute and graphics pipeline
+// hashes do not collide.
+func (d ComputePipelineDescriptor) Hash() uint64 {
+	h := fnv.New64a()
+
+	// Domain separation from graphics pipeline descriptors
+	h.Write([]byte("compute"))
+	writeUint32(h, uint32(len(d.Shader.SPIRV)))
+	h.Write([]byte(d.Shader.SPIRV))
+	writeUint32(h, uint32(len(d.Shader.GLSL)))
+	h.Write([]byte(d.Shader.GLSL))
+	writeConstants(h, d.Shader.Constants)
+
+	return h.Sum64()
+}
+
+// StorageBuffer is a buffer compute shaders read and write. Its memory is
+// visible to the cpu, so it can be filled and read back directly.
+type StorageBuffer interface {
+	Size() uint64
+
+	// Write copies data into the buffer at the given offset. Dispatches that
+	// were already submitted may still read the buffer, so only write buffers
+	// after reading back their results, or buffers no pending dispatch uses.
+	Write(offset uint64, data []byte)
+
+	// Read waits for the dispatches that were queued so far, and returns a
+	// copy of the buffer contents.
+	Read() []byte
+
+	Destroy()
+}
+
+// StorageImage is an RGBA image with 8 bit unsigned normalized channels that
+// compute shaders read and write.
+type StorageImage interface {
+	Size() (width, height int)
+
+	// ReadPixels waits for the dispatches that were queued so far, and
+	// returns a copy of the image.
+	ReadPixels() *image.RGBA
+
+	Destroy()
+}
+
+// ComputeBinding binds a storage buffer or image to a binding of a compute
+// shader. Exactly one of Buffer and Image is set.
+type ComputeBinding struct {
+	Set     uint32
+	Binding uint32
+	Buffer  StorageBuffer
+	Image   StorageImage
+}
+
+// Dispatch runs a compute shader over a grid of work groups.
+type Dispatch struct {
+	Pipeline      ComputePipelineDescriptor
+	Bindings      []ComputeBinding
+	PushConstants []byte
+	// Number of work groups in each dimension, zero counts are treated as 1.
+	Groups [3]uint32
+}
+
+// Compute creates the resources of compute shaders and dispatches them.
+// Dispatches are queued and submitted before the next frame is rendered, so
+// the frame sees their results.
+type Compute interface {
+	CreateStorageBuffer(size uint64) StorageBuffer
+	CreateStorageImage(width, height int) StorageImage
+	Dispatch(dispatch Dispatch)
+}
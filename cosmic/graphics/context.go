@@ -1,11 +1,113 @@
 package graphics
 
+import (
+	"image"
+	"io/fs"
+)
+
+// Backend is the implementation a context renders with.
+type Backend int
+
+const (
+	BackendVulkan Backend = iota
+	// BackendSoftware rasterizes on the cpu, so it runs on machines without a
+	// gpu or Vulkan driver. It only supports offscreen contexts, and is meant
+	// for tests and tools rather than for playing games.
+	BackendSoftware
+)
+
+func (b Backend) String() string {
+	switch b {
+	case BackendVulkan:
+		return "Vulkan"
+	case BackendSoftware:
+		return "software"
+	default:
+		return "unknown"
+	}
+}
+
 type ContextProperties struct {
+	// The implementation to render with, Vulkan by default.
+	Backend Backend
+
+	// Directory from which SPIR-V shaders are loaded at runtime. When empty,
+	// they are read from ShaderFS. The SPIR-V of a GLSL source is named after
+	// it, like shader.vert.spv, as cosmic-cook names it.
+	ShaderDirectory string
+
+	// File system the SPIR-V shaders are read from when ShaderDirectory is
+	// empty, like a mount of the application's virtual file system. The
+	// shaders embedded in the engine binary are used when it is nil.
+	ShaderFS fs.FS
+
+	// Watches the GLSL sources in ShaderDirectory and recompiles them with a
+	// local glslc or glslangValidator when they change. Affected pipelines are
+	// rebuilt without restarting the application.
+	HotReloadShaders bool
+
+	// File in which compiled pipelines are cached between runs. When empty,
+	// the cache is stored in the user's cache directory.
+	PipelineCachePath string
+
+	// Index or part of the name of the adapter to render with, overriding the
+	// adapter with the highest score. The COSMIC_ADAPTER environment variable
+	// takes precedence over this setting.
+	Adapter string
+
+	// Number of samples per pixel used for multisample anti-aliasing, where 0
+	// or 1 disables it. When the adapter does not support the count, the
+	// highest supported count below it is used.
+	Samples int
+
+	// Runs compute dispatches on a dedicated compute queue, when the adapter
+	// has one, so they can overlap with rendering.
+	AsyncCompute bool
+
+	// File to which the render graph of a frame is written in the Graphviz dot
+	// format whenever it is rebuilt, for debugging.
+	RenderGraphDump string
+
+	// Controls the Vulkan validation layers, which are disabled by default
+	// and cannot be enabled in release builds.
+	Validation ValidationProperties
 }
 
 type Context interface {
+	Compute
+	Drawer2D
+	MeshUploader
+
 	Render()
 	Terminate()
 
 	SignalFramebufferResized()
+
+	// Adapter returns the adapter the context renders with.
+	Adapter() Adapter
+
+	// SetSamples changes the number of samples per pixel, as described for
+	// ContextProperties.Samples, from the next frame on.
+	SetSamples(samples int)
+	// Samples returns the number of samples per pixel rendered with.
+	Samples() int
+
+	// Capture requests a copy of the next rendered frame. The frame is copied
+	// on the gpu and converted in the background, so rendering continues
+	// while the returned channel waits for it. The channel is closed without
+	// a frame if the frame cannot be captured.
+	Capture() <-chan *image.RGBA
+}
+
+// OffscreenContext renders into images owned by the context rather than into
+// a window, for tools and tests that run without a display.
+type OffscreenContext interface {
+	Context
+
+	// Resize changes the size of the images rendered to.
+	Resize(width, height int)
+	Size() (width, height int)
+
+	// ReadPixels waits for the last rendered frame and returns a copy of it.
+	ReadPixels() *image.RGBA
 }
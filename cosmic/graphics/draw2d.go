@@ -0,0 +1,63 @@
+package graphics
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/math"
+	"image"
+)
+
+// MaxBatchTextures is the number of textures a Batch2D can use on every
+// device, the minimum number of sampled images per shader stage Vulkan
+// guarantees. Drawers report how many they allow with MaxBatchTextures.
+const MaxBatchTextures = 16
+
+type TextureFilter int
+
+const (
+	FilterLinear TextureFilter = iota
+	// FilterNearest keeps the texels of magnified textures sharp, for pixel
+	// art.
+	FilterNearest
+)
+
+// Texture is an sRGB encoded image that batches sample from. Coordinates
+// outside of the texture are clamped to its edge.
+type Texture interface {
+	Size() (width, height int)
+	Destroy()
+}
+
+// Vertex2D is a vertex of a Batch2D. The texel at UV of the batch texture at
+// index Texture is multiplied by Color, a linear color with straight alpha.
+type Vertex2D struct {
+	Position math.Vec2
+	UV       math.Vec2
+	Color    [4]float32
+	Texture  uint32
+}
+
+// Batch2D is a list of indexed triangles drawn with a single draw call. The
+// triangles are alpha blended in index order, without depth testing or face
+// culling.
+type Batch2D struct {
+	ViewProjection math.Mat4
+	Vertices       []Vertex2D
+	Indices        []uint32
+	// At most Drawer2D.MaxBatchTextures textures, indexed by
+	// Vertex2D.Texture.
+	Textures []Texture
+}
+
+// Drawer2D draws batches of 2D geometry. Batches are queued and drawn in
+// order in the next frame, instead of the built-in triangle the context draws
+// when nothing was queued.
+type Drawer2D interface {
+	// CreateTexture uploads an image, and the levels of its mip chain when
+	// given, each half the size of the previous one.
+	CreateTexture(img *image.RGBA, filter TextureFilter, mipmaps ...*image.RGBA) Texture
+	// DrawBatch2D queues a batch and returns the number of draw calls it
+	// takes.
+	DrawBatch2D(batch Batch2D) int
+	// MaxBatchTextures returns how many textures a batch can use, at least
+	// the MaxBatchTextures every device supports.
+	MaxBatchTextures() int
+}
@@ -0,0 +1,169 @@
+// Package golden compares rendered images against reference images checked
+// in with the tests, to catch changes in what the renderer draws.
+//
+// References are stored as PNG in testdata/golden of the package under test,
+// unless the options name another directory. Run the tests with COSMIC_UPDATE_GOLDEN=1 to create or update them. When an
+// image does not match its reference, the rendered image and an image
+// highlighting the differences are written to COSMIC_GOLDEN_OUTPUT, or to a
+// directory in the system's temporary directory.
+package golden
+
+import (
+	"fmt"
+	"github.com/lentus/cosmic-engine/cosmic/graphics"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	UpdateEnvironmentVariable = "COSMIC_UPDATE_GOLDEN"
+	OutputEnvironmentVariable = "COSMIC_GOLDEN_OUTPUT"
+)
+
+// Options controls how strictly an image must match its reference. Different
+// gpus and drivers may round colors and rasterize edges slightly differently.
+type Options struct {
+	// Largest difference allowed in any color channel of a pixel.
+	Tolerance uint8
+	// Number of pixels allowed to differ by more than the tolerance.
+	MaxMismatched int
+	// Directory of the reference images, for tests shared by several
+	// packages. Empty for testdata/golden of the package under test.
+	Directory string
+}
+
+// Result describes the differences between two images.
+type Result struct {
+	// Number of pixels that differ by more than the tolerance.
+	Mismatched int
+	// Largest difference in any color channel of any pixel.
+	MaxDifference uint8
+	// Image showing the mismatched pixels in red, the pixels that differ
+	// within the tolerance in yellow and matching pixels darkened.
+	Diff *image.RGBA
+}
+
+// Compare compares two images of the same size pixel by pixel.
+func Compare(got, want image.Image, tolerance uint8) (Result, error) {
+	if got.Bounds().Size() != want.Bounds().Size() {
+		return Result{}, fmt.Errorf("image is %s, expected %s", got.Bounds().Size(), want.Bounds().Size())
+	}
+
+	size := got.Bounds().Size()
+	result := Result{Diff: image.NewRGBA(image.Rect(0, 0, size.X, size.Y))}
+
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			g := color.RGBAModel.Convert(got.At(got.Bounds().Min.X+x, got.Bounds().Min.Y+y)).(color.RGBA)
+			w := color.RGBAModel.Convert(want.At(want.Bounds().Min.X+x, want.Bounds().Min.Y+y)).(color.RGBA)
+
+			difference := maxDifference(g, w)
+			if difference > result.MaxDifference {
+				result.MaxDifference = difference
+			}
+
+			switch {
+			case difference > tolerance:
+				result.Mismatched++
+				result.Diff.SetRGBA(x, y, color.RGBA{R: 255, A: 255})
+			case difference > 0:
+				result.Diff.SetRGBA(x, y, color.RGBA{R: 255, G: 255, A: 255})
+			default:
+				gray := uint8((uint16(w.R) + uint16(w.G) + uint16(w.B)) / 3 / 4)
+				result.Diff.SetRGBA(x, y, color.RGBA{R: gray, G: gray, B: gray, A: 255})
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func maxDifference(a, b color.RGBA) uint8 {
+	var difference uint8
+	for _, channel := range [][2]uint8{{a.R, b.R}, {a.G, b.G}, {a.B, b.B}, {a.A, b.A}} {
+		d := channel[0] - channel[1]
+		if channel[1] > channel[0] {
+			d = channel[1] - channel[0]
+		}
+		if d > difference {
+			difference = d
+		}
+	}
+
+	return difference
+}
+
+// Assert fails the test when the image does not match the reference with the
+// given name.
+func Assert(t testing.TB, got image.Image, name string, options Options) {
+	t.Helper()
+
+	directory := options.Directory
+	if directory == "" {
+		directory = filepath.Join("testdata", "golden")
+	}
+	reference := filepath.Join(directory, name+".png")
+
+	if os.Getenv(UpdateEnvironmentVariable) != "" {
+		if err := graphics.SavePNG(got, reference); err != nil {
+			t.Fatalf("failed to update reference image %s - %s", reference, err.Error())
+		}
+		t.Logf("updated reference image %s", reference)
+		return
+	}
+
+	want, err := load(reference)
+	if err != nil {
+		actual := writeOutput(t, name, "actual", got)
+		t.Fatalf("failed to load reference image - %s\nrendered image: %s\nrun with %s=1 to create the reference",
+			err.Error(), actual, UpdateEnvironmentVariable)
+	}
+
+	result, err := Compare(got, want, options.Tolerance)
+	if err != nil {
+		actual := writeOutput(t, name, "actual", got)
+		t.Fatalf("%s: %s\nrendered image: %s", reference, err.Error(), actual)
+	}
+
+	if result.Mismatched > options.MaxMismatched {
+		actual := writeOutput(t, name, "actual", got)
+		diff := writeOutput(t, name, "diff", result.Diff)
+		t.Errorf("%s: %d pixels differ by more than %d (at most %d allowed, largest difference %d)\nrendered image: %s\ndiff image: %s",
+			reference, result.Mismatched, options.Tolerance, options.MaxMismatched, result.MaxDifference, actual, diff)
+	}
+}
+
+func load(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return png.Decode(file)
+}
+
+// writeOutput saves an image produced by a failing test and returns its path.
+func writeOutput(t testing.TB, name, kind string, img image.Image) string {
+	t.Helper()
+
+	directory := os.Getenv(OutputEnvironmentVariable)
+	if directory == "" {
+		directory = filepath.Join(os.TempDir(), "cosmic-golden")
+	}
+
+	// Subtests contain slashes in their names
+	testName := strings.NewReplacer("/", "_", "\\", "_").Replace(t.Name())
+	path := filepath.Join(directory, testName, name+"."+kind+".png")
+
+	if err := graphics.SavePNG(img, path); err != nil {
+		t.Logf("failed to write %s - %s", path, err.Error())
+	}
+
+	return path
+}
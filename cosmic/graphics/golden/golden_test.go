@@ -0,0 +1,78 @@
+package golden
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func uniform(width, height int, c color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+
+	return img
+}
+
+func TestCompare_equal(t *testing.T) {
+	a := uniform(4, 4, color.RGBA{R: 10, G: 20, B: 30, A: 255})
+	b := uniform(4, 4, color.RGBA{R: 10, G: 20, B: 30, A: 255})
+
+	result, err := Compare(a, b, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Mismatched != 0 || result.MaxDifference != 0 {
+		t.Errorf("expected no differences, got %d mismatched with largest difference %d", result.Mismatched, result.MaxDifference)
+	}
+}
+
+func TestCompare_tolerance(t *testing.T) {
+	want := uniform(4, 4, color.RGBA{R: 100, G: 100, B: 100, A: 255})
+	got := uniform(4, 4, color.RGBA{R: 100, G: 100, B: 100, A: 255})
+	got.SetRGBA(0, 0, color.RGBA{R: 103, G: 100, B: 100, A: 255})
+	got.SetRGBA(1, 0, color.RGBA{R: 100, G: 90, B: 100, A: 255})
+
+	result, err := Compare(got, want, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Mismatched != 1 {
+		t.Errorf("expected 1 mismatched pixel, got %d", result.Mismatched)
+	}
+	if result.MaxDifference != 10 {
+		t.Errorf("expected a largest difference of 10, got %d", result.MaxDifference)
+	}
+	if c := result.Diff.RGBAAt(1, 0); c != (color.RGBA{R: 255, A: 255}) {
+		t.Errorf("expected mismatched pixel to be red in the diff, got %v", c)
+	}
+	if c := result.Diff.RGBAAt(0, 0); c != (color.RGBA{R: 255, G: 255, A: 255}) {
+		t.Errorf("expected pixel within tolerance to be yellow in the diff, got %v", c)
+	}
+}
+
+func TestCompare_size(t *testing.T) {
+	_, err := Compare(uniform(4, 4, color.RGBA{}), uniform(4, 2, color.RGBA{}), 0)
+	if err == nil {
+		t.Error("expected images of different sizes not to compare")
+	}
+}
+
+func TestCompare_bounds(t *testing.T) {
+	// Images with the same size but different origins compare by position
+	// relative to their origin
+	want := uniform(4, 4, color.RGBA{R: 50, A: 255})
+	got := uniform(6, 6, color.RGBA{R: 50, A: 255}).SubImage(image.Rect(2, 2, 6, 6))
+
+	result, err := Compare(got, want, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Mismatched != 0 {
+		t.Errorf("expected no differences, got %d", result.Mismatched)
+	}
+}
@@ -0,0 +1,15 @@
+package graphics
+
+// MeshBuffers are the vertex and index buffers of a mesh in gpu memory.
+type MeshBuffers interface {
+	VertexCount() int
+	IndexCount() int
+	Destroy()
+}
+
+// MeshUploader copies meshes to gpu memory, where they are drawn from.
+type MeshUploader interface {
+	// UploadMesh copies tightly packed vertices of the given stride in bytes
+	// and their 32 bit indices.
+	UploadMesh(vertices []byte, stride int, indices []uint32) MeshBuffers
+}
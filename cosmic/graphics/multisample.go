@@ -0,0 +1,16 @@
+package graphics
+
+// ChooseSampleCount returns the number of samples per pixel to render with
+// when the given count is requested: the largest supported count that does
+// not exceed it. Counts below 2 disable multisampling, and when even the
+// smallest supported count exceeds the request a single sample is used.
+func ChooseSampleCount(requested int, supported []int) int {
+	chosen := 1
+	for _, count := range supported {
+		if count <= requested && count > chosen {
+			chosen = count
+		}
+	}
+
+	return chosen
+}
@@ -0,0 +1,28 @@
+package graphics
+
+import "testing"
+
+func TestChooseSampleCount(t *testing.T) {
+	supported := []int{1, 2, 4, 8}
+
+	tests := []struct {
+		requested int
+		supported []int
+		expected  int
+	}{
+		{0, supported, 1},
+		{1, supported, 1},
+		{4, supported, 4},
+		{6, supported, 4},
+		{64, supported, 8},
+		{4, []int{1}, 1},
+		{4, []int{1, 8}, 1},
+		{4, nil, 1},
+	}
+
+	for _, test := range tests {
+		if chosen := ChooseSampleCount(test.requested, test.supported); chosen != test.expected {
+			t.Errorf("ChooseSampleCount(%d, %v): expected %d, got %d", test.requested, test.supported, test.expected, chosen)
+		}
+	}
+}
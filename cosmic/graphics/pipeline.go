@@ -0,0 +1,148 @@
+package graphics
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+)
+
+type Topology int
+
+const (
+	TopologyTriangleList Topology = iota
+	TopologyTriangleStrip
+	TopologyLineList
+	TopologyLineStrip
+	TopologyPointList
+)
+
+type CullMode int
+
+const (
+	CullBack CullMode = iota
+	CullFront
+	CullNone
+)
+
+type FrontFace int
+
+const (
+	FrontFaceClockwise FrontFace = iota
+	FrontFaceCounterClockwise
+)
+
+type BlendMode int
+
+const (
+	BlendNone BlendMode = iota
+	BlendAlpha
+	BlendPremultipliedAlpha
+	BlendAdditive
+)
+
+type CompareOp int
+
+const (
+	CompareLess CompareOp = iota
+	CompareLessOrEqual
+	CompareGreater
+	CompareGreaterOrEqual
+	CompareEqual
+	CompareAlways
+)
+
+// ShaderStage refers to the compiled SPIR-V of a shader and, optionally, the
+// GLSL source it is compiled from. Both are relative to the shader directory
+// given in ContextProperties.
+type ShaderStage struct {
+	SPIRV string
+	GLSL  string
+	// Values of the specialization constants of the shader, the others keep
+	// their defaults.
+	Constants []SpecConstant
+}
+
+// SpecConstant sets the 32 bit specialization constant with the given ID.
+type SpecConstant struct {
+	ID    uint32
+	Value uint32
+}
+
+type RasterState struct {
+	CullMode  CullMode
+	FrontFace FrontFace
+	Wireframe bool
+	// Width of rasterized lines, 0 means 1.
+	LineWidth float32
+}
+
+type DepthState struct {
+	Test    bool
+	Write   bool
+	Compare CompareOp
+}
+
+// PipelineDescriptor describes all state of a graphics pipeline. Pipelines
+// are cached by the hash of their descriptor, so describing the same state
+// twice yields the same pipeline. Viewport and scissor are not part of the
+// descriptor, they are dynamic and follow the framebuffer size.
+type PipelineDescriptor struct {
+	VertexShader   ShaderStage
+	FragmentShader ShaderStage
+
+	Topology Topology
+	Raster   RasterState
+	Blend    BlendMode
+	Depth    DepthState
+}
+
+// Hash returns a key identifying the pipeline state of the descriptor.
+func (d PipelineDescriptor) Hash() uint64 {
+	h := fnv.New64a()
+
+	writeString := func(s string) {
+		// Prefix strings with their length, so adjacent strings cannot be
+		// confused with each other
+		writeUint32(h, uint32(len(s)))
+		h.Write([]byte(s))
+	}
+	writeBool := func(b bool) {
+		if b {
+			writeUint32(h, 1)
+		} else {
+			writeUint32(h, 0)
+		}
+	}
+
+	writeString(d.VertexShader.SPIRV)
+	writeString(d.VertexShader.GLSL)
+	writeConstants(h, d.VertexShader.Constants)
+	writeString(d.FragmentShader.SPIRV)
+	writeString(d.FragmentShader.GLSL)
+	writeConstants(h, d.FragmentShader.Constants)
+	writeUint32(h, uint32(d.Topology))
+	writeUint32(h, uint32(d.Raster.CullMode))
+	writeUint32(h, uint32(d.Raster.FrontFace))
+	writeBool(d.Raster.Wireframe)
+	writeUint32(h, math.Float32bits(d.Raster.LineWidth))
+	writeUint32(h, uint32(d.Blend))
+	writeBool(d.Depth.Test)
+	writeBool(d.Depth.Write)
+	writeUint32(h, uint32(d.Depth.Compare))
+
+	return h.Sum64()
+}
+
+func writeConstants(w interface{ Write([]byte) (int, error) }, constants []SpecConstant) {
+	writeUint32(w, uint32(len(constants)))
+	for _, constant := range constants {
+		writeUint32(w, constant.ID)
+		writeUint32(w, constant.Value)
+	}
+}
+
+func writeUint32(w interface{ Write([]byte) (int, error) }, value uint32) {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], value)
+	w.Write(buf[:])
+}
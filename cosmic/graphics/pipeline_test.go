@@ -0,0 +1,74 @@
+package graphics
+
+import "testing"
+
+func testDescriptor() PipelineDescriptor {
+	return PipelineDescriptor{
+		VertexShader:   ShaderStage{SPIRV: "vert.spv", GLSL: "shader.vert"},
+		FragmentShader: ShaderStage{SPIRV: "frag.spv", GLSL: "shader.frag"},
+		Topology:       TopologyTriangleList,
+		Raster:         RasterState{CullMode: CullBack, FrontFace: FrontFaceClockwise},
+	}
+}
+
+func TestPipelineDescriptor_Hash_equal(t *testing.T) {
+	if testDescriptor().Hash() != testDescriptor().Hash() {
+		t.Error("expected equal descriptors to have equal hashes")
+	}
+}
+
+func TestPipelineDescriptor_Hash_differs(t *testing.T) {
+	base := testDescriptor().Hash()
+
+	changes := map[string]func(d *PipelineDescriptor){
+		"vertex shader": func(d *PipelineDescriptor) { d.VertexShader.SPIRV = "other.spv" },
+		"constants": func(d *PipelineDescriptor) {
+			d.FragmentShader.Constants = []SpecConstant{{ID: 0, Value: 32}}
+		},
+		"topology":      func(d *PipelineDescriptor) { d.Topology = TopologyLineList },
+		"cull mode":     func(d *PipelineDescriptor) { d.Raster.CullMode = CullNone },
+		"wireframe":     func(d *PipelineDescriptor) { d.Raster.Wireframe = true },
+		"line width":    func(d *PipelineDescriptor) { d.Raster.LineWidth = 2 },
+		"blend":         func(d *PipelineDescriptor) { d.Blend = BlendAlpha },
+		"depth test":    func(d *PipelineDescriptor) { d.Depth.Test = true },
+		"depth compare": func(d *PipelineDescriptor) { d.Depth.Compare = CompareGreater },
+	}
+
+	for name, change := range changes {
+		d := testDescriptor()
+		change(&d)
+
+		if d.Hash() == base {
+			t.Errorf("expected changing the %s to change the hash", name)
+		}
+	}
+}
+
+func TestPipelineDescriptor_Hash_shaderBoundaries(t *testing.T) {
+	a := testDescriptor()
+	a.VertexShader = ShaderStage{SPIRV: "ab", GLSL: "c"}
+
+	b := testDescriptor()
+	b.VertexShader = ShaderStage{SPIRV: "a", GLSL: "bc"}
+
+	if a.Hash() == b.Hash() {
+		t.Error("expected shader paths to be hashed separately")
+	}
+}
+
+func TestComputePipelineDescriptor_Hash(t *testing.T) {
+	a := ComputePipelineDescriptor{Shader: ShaderStage{SPIRV: "particles.spv"}}
+	b := ComputePipelineDescriptor{Shader: ShaderStage{SPIRV: "culling.spv"}}
+
+	if a.Hash() != a.Hash() {
+		t.Error("expected equal descriptors to have equal hashes")
+	}
+	if a.Hash() == b.Hash() {
+		t.Error("expected different shaders to have different hashes")
+	}
+
+	graphics := PipelineDescriptor{VertexShader: a.Shader}
+	if a.Hash() == graphics.Hash() {
+		t.Error("expected compute and graphics pipelines not to share hashes")
+	}
+}
@@ -0,0 +1,493 @@
+package rendergraph
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Barrier synchronizes the accesses to a resource between passes, and
+// transitions images between layouts.
+type Barrier struct {
+	Resource  ResourceID
+	OldLayout Layout
+	NewLayout Layout
+	SrcStages Stage
+	DstStages Stage
+	SrcAccess Access
+	DstAccess Access
+}
+
+// CompiledPass is a pass that is executed, with the barriers to record before
+// it.
+type CompiledPass struct {
+	ID       PassID
+	Name     string
+	Barriers []Barrier
+}
+
+// ResourceInfo describes a resource of a compiled graph.
+type ResourceInfo struct {
+	Name     string
+	Kind     ResourceKind
+	Imported bool
+	Image    ImageDesc
+	Buffer   BufferDesc
+	// Index of the physical resource a transient resource is allocated from,
+	// -1 for imported resources and transient resources no pass uses.
+	Physical int
+}
+
+// PhysicalResource is the memory backing one or more transient resources
+// whose lifetimes do not overlap.
+type PhysicalResource struct {
+	Kind   ResourceKind
+	Image  ImageDesc
+	Buffer BufferDesc
+	// Every way any of its resources is used, in ascending order
+	Usages    []Usage
+	Resources []ResourceID
+}
+
+// Compiled is a graph ready to execute.
+type Compiled struct {
+	// Passes to execute, in order
+	Passes []CompiledPass
+	// Passes skipped because nothing uses their output
+	Culled []PassID
+	// Barriers to record after the last pass, transitioning imported
+	// resources to their final usage
+	FinalBarriers []Barrier
+
+	Resources []ResourceInfo
+	Physical  []PhysicalResource
+
+	graph *Graph
+}
+
+// Compile derives the execution order, barriers and transient allocations of
+// the graph.
+func (g *Graph) Compile() (*Compiled, error) {
+	if len(g.errors) > 0 {
+		messages := make([]string, len(g.errors))
+		for i, err := range g.errors {
+			messages[i] = err.Error()
+		}
+		return nil, errors.New(strings.Join(messages, "; "))
+	}
+
+	dependencies, producers := g.dependencies()
+	live := g.livePasses(producers)
+
+	order, err := g.order(dependencies, live)
+	if err != nil {
+		return nil, err
+	}
+
+	compiled := &Compiled{graph: g}
+	for id := range g.passes {
+		if !live[id] {
+			compiled.Culled = append(compiled.Culled, PassID(id))
+		}
+	}
+
+	compiled.allocate(order)
+	compiled.synchronize(order)
+
+	return compiled, nil
+}
+
+// dependencies returns for every pass the passes that must execute before
+// it, and the subset of those whose output it uses.
+func (g *Graph) dependencies() (dependencies, producers [][]PassID) {
+	type version struct {
+		resource ResourceID
+		version  int
+	}
+	readers := make(map[version][]PassID)
+	for id, p := range g.passes {
+		for _, a := range p.accesses {
+			if !a.write {
+				v := version{a.handle.Resource, a.handle.Version}
+				readers[v] = append(readers[v], PassID(id))
+			}
+		}
+	}
+
+	dependencies = make([][]PassID, len(g.passes))
+	producers = make([][]PassID, len(g.passes))
+	for id, p := range g.passes {
+		for _, a := range p.accesses {
+			// The pass producing the version read or overwritten
+			if writer := g.resources[a.handle.Resource].writers[a.handle.Version]; writer >= 0 {
+				producers[id] = append(producers[id], writer)
+				dependencies[id] = append(dependencies[id], writer)
+			}
+
+			// Passes reading the version overwritten
+			if a.write {
+				for _, reader := range readers[version{a.handle.Resource, a.handle.Version}] {
+					if reader != PassID(id) {
+						dependencies[id] = append(dependencies[id], reader)
+					}
+				}
+			}
+		}
+	}
+
+	return dependencies, producers
+}
+
+// livePasses finds the passes with effects outside the graph and the passes
+// producing what they use.
+func (g *Graph) livePasses(producers [][]PassID) []bool {
+	live := make([]bool, len(g.passes))
+
+	var visit func(id PassID)
+	visit = func(id PassID) {
+		if live[id] {
+			return
+		}
+		live[id] = true
+		for _, producer := range producers[id] {
+			visit(producer)
+		}
+	}
+
+	for id, p := range g.passes {
+		root := p.sideEffect
+		for _, a := range p.accesses {
+			root = root || (a.write && g.resources[a.handle.Resource].imported)
+		}
+
+		if root {
+			visit(PassID(id))
+		}
+	}
+
+	return live
+}
+
+// order sorts the live passes topologically. Passes that do not depend on
+// each other keep the order in which they were added.
+func (g *Graph) order(dependencies [][]PassID, live []bool) ([]PassID, error) {
+	remaining := make([]int, len(g.passes))
+	dependents := make([][]PassID, len(g.passes))
+	for id := range g.passes {
+		if !live[id] {
+			continue
+		}
+
+		seen := make(map[PassID]bool)
+		for _, dependency := range dependencies[id] {
+			if !seen[dependency] && live[dependency] {
+				seen[dependency] = true
+				remaining[id]++
+				dependents[dependency] = append(dependents[dependency], PassID(id))
+			}
+		}
+	}
+
+	var ready, order []PassID
+	for id := range g.passes {
+		if live[id] && remaining[id] == 0 {
+			ready = append(ready, PassID(id))
+		}
+	}
+
+	for len(ready) > 0 {
+		sort.Slice(ready, func(i, j int) bool { return ready[i] < ready[j] })
+		next := ready[0]
+		ready = ready[1:]
+		order = append(order, next)
+
+		for _, dependent := range dependents[next] {
+			remaining[dependent]--
+			if remaining[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+
+	for id := range g.passes {
+		if live[id] && remaining[id] > 0 {
+			return nil, fmt.Errorf("pass %s is part of a dependency cycle", g.passes[id].name)
+		}
+	}
+
+	return order, nil
+}
+
+// allocate assigns the transient resources to physical resources. Resources
+// of the same description whose lifetimes do not overlap share memory.
+func (c *Compiled) allocate(order []PassID) {
+	g := c.graph
+
+	first := make(map[ResourceID]int)
+	last := make(map[ResourceID]int)
+	usages := make(map[ResourceID]map[Usage]bool)
+	for position, id := range order {
+		for _, a := range g.passes[id].accesses {
+			if _, ok := first[a.handle.Resource]; !ok {
+				first[a.handle.Resource] = position
+				usages[a.handle.Resource] = make(map[Usage]bool)
+			}
+			last[a.handle.Resource] = position
+			usages[a.handle.Resource][a.usage] = true
+		}
+	}
+
+	c.Resources = make([]ResourceInfo, len(g.resources))
+	var transient []ResourceID
+	for id, r := range g.resources {
+		c.Resources[id] = ResourceInfo{
+			Name:     r.name,
+			Kind:     r.kind,
+			Imported: r.imported,
+			Image:    r.image,
+			Buffer:   r.buffer,
+			Physical: -1,
+		}
+
+		if _, used := first[ResourceID(id)]; used && !r.imported {
+			transient = append(transient, ResourceID(id))
+		}
+	}
+	sort.SliceStable(transient, func(i, j int) bool { return first[transient[i]] < first[transient[j]] })
+
+	physicalLast := make([]int, 0)
+	for _, id := range transient {
+		info := &c.Resources[id]
+
+		for p := range c.Physical {
+			physical := &c.Physical[p]
+			if physicalLast[p] >= first[id] || physical.Kind != info.Kind {
+				continue
+			}
+			if info.Kind == KindImage && physical.Image != info.Image {
+				continue
+			}
+
+			info.Physical = p
+			break
+		}
+
+		if info.Physical < 0 {
+			c.Physical = append(c.Physical, PhysicalResource{Kind: info.Kind, Image: info.Image})
+			physicalLast = append(physicalLast, 0)
+			info.Physical = len(c.Physical) - 1
+		}
+
+		physical := &c.Physical[info.Physical]
+		physicalLast[info.Physical] = last[id]
+		physical.Resources = append(physical.Resources, id)
+		if info.Buffer.Size > physical.Buffer.Size {
+			physical.Buffer.Size = info.Buffer.Size
+		}
+		for usage := range usages[id] {
+			physical.Usages = appendUsage(physical.Usages, usage)
+		}
+	}
+}
+
+func appendUsage(usages []Usage, usage Usage) []Usage {
+	for _, u := range usages {
+		if u == usage {
+			return usages
+		}
+	}
+
+	usages = append(usages, usage)
+	sort.Slice(usages, func(i, j int) bool { return usages[i] < usages[j] })
+	return usages
+}
+
+// resourceState tracks the accesses to a resource since it was last written.
+type resourceState struct {
+	layout Layout
+	// The resource whose contents the memory holds, for aliased resources
+	owner ResourceID
+
+	writeStages   Stage
+	writeAccess   Access
+	readStages    Stage
+	visibleStages Stage
+	visibleAccess Access
+}
+
+// synchronize derives the barriers between the passes in the given order.
+func (c *Compiled) synchronize(order []PassID) {
+	g := c.graph
+
+	// Imported resources are tracked by their own id, transient resources by
+	// the physical resource they share, as offset ids after the imported ones
+	key := func(id ResourceID) int {
+		if physical := c.Resources[id].Physical; physical >= 0 {
+			return len(g.resources) + physical
+		}
+		return int(id)
+	}
+
+	states := make(map[int]*resourceState)
+	for id, r := range g.resources {
+		if r.imported {
+			states[key(ResourceID(id))] = &resourceState{
+				layout:      r.initial.Layout,
+				owner:       ResourceID(id),
+				writeStages: r.initial.Stages,
+			}
+		}
+	}
+
+	for _, id := range order {
+		compiledPass := CompiledPass{ID: id, Name: g.passes[id].name}
+
+		for _, a := range mergeAccesses(g.passes[id].accesses) {
+			k := key(a.resource)
+			st, ok := states[k]
+			if !ok {
+				st = &resourceState{owner: -1}
+				states[k] = st
+			}
+
+			if barrier, needed := st.access(a, g.resources[a.resource].kind); needed {
+				compiledPass.Barriers = append(compiledPass.Barriers, barrier)
+			}
+		}
+
+		c.Passes = append(c.Passes, compiledPass)
+	}
+
+	for id, r := range g.resources {
+		if !r.imported || r.initial.Final == UsageNone {
+			continue
+		}
+
+		final := usageStates[r.initial.Final]
+		a := mergedAccess{
+			resource: ResourceID(id),
+			layout:   final.layoutFor(r.kind),
+			stages:   final.stages,
+			read:     final.read,
+		}
+		if barrier, needed := states[key(ResourceID(id))].access(a, r.kind); needed {
+			c.FinalBarriers = append(c.FinalBarriers, barrier)
+		}
+	}
+}
+
+// mergedAccess combines all accesses of a pass to one resource.
+type mergedAccess struct {
+	resource ResourceID
+	layout   Layout
+	stages   Stage
+	read     Access
+	write    Access
+	// Whether the pass overwrites a transient resource that was not written
+	// before, so its previous contents can be discarded
+	discard bool
+}
+
+func mergeAccesses(accesses []access) []mergedAccess {
+	var merged []mergedAccess
+	index := make(map[ResourceID]int)
+
+	for _, a := range accesses {
+		state := usageStates[a.usage]
+
+		i, ok := index[a.handle.Resource]
+		if !ok {
+			i = len(merged)
+			index[a.handle.Resource] = i
+			merged = append(merged, mergedAccess{resource: a.handle.Resource, layout: state.layout})
+		}
+
+		m := &merged[i]
+		m.stages |= state.stages
+		m.read |= state.read
+		if a.write {
+			m.write |= state.write
+			m.discard = m.discard || a.handle.Version == 0
+		}
+	}
+
+	return merged
+}
+
+// access updates the state for an access, and returns the barrier needed
+// before it when there is a hazard.
+func (st *resourceState) access(a mergedAccess, kind ResourceKind) (Barrier, bool) {
+	if kind == KindBuffer {
+		a.layout = LayoutUndefined
+	}
+
+	// A transient resource written for the first time, possibly in memory
+	// another resource used before
+	aliased := false
+	oldLayout := st.layout
+	if a.discard && st.owner != a.resource {
+		aliased = st.owner >= 0
+		oldLayout = LayoutUndefined
+	}
+	st.owner = a.resource
+
+	layoutChange := kind == KindImage && a.layout != oldLayout
+	write := a.write != 0
+
+	var hazard bool
+	switch {
+	case layoutChange || aliased:
+		hazard = true
+	case write:
+		hazard = st.writeStages|st.readStages != 0
+	default:
+		hazard = st.writeStages != 0 && (a.stages&^st.visibleStages != 0 || a.read&^st.visibleAccess != 0)
+	}
+
+	var barrier Barrier
+	if hazard {
+		srcStages := st.writeStages
+		if write || layoutChange || aliased {
+			srcStages |= st.readStages
+		}
+		if srcStages == 0 {
+			srcStages = StageTopOfPipe
+		}
+
+		barrier = Barrier{
+			Resource:  a.resource,
+			OldLayout: oldLayout,
+			NewLayout: a.layout,
+			SrcStages: srcStages,
+			DstStages: a.stages,
+			SrcAccess: st.writeAccess,
+			DstAccess: a.read | a.write,
+		}
+		if kind == KindBuffer {
+			barrier.OldLayout, barrier.NewLayout = LayoutUndefined, LayoutUndefined
+		}
+
+		st.visibleStages, st.visibleAccess = 0, 0
+	}
+
+	st.layout = a.layout
+	switch {
+	case write:
+		// What is written only becomes visible through a later barrier, even
+		// to the stages and accesses of the writer
+		st.writeStages, st.writeAccess, st.readStages = a.stages, a.write, 0
+		st.visibleStages, st.visibleAccess = 0, 0
+	case layoutChange:
+		// The transition is a write that is already visible to this pass
+		st.writeStages, st.writeAccess, st.readStages = a.stages, 0, a.stages
+		st.visibleStages |= a.stages
+		st.visibleAccess |= a.read
+	default:
+		st.readStages |= a.stages
+		st.visibleStages |= a.stages
+		st.visibleAccess |= a.read
+	}
+
+	return barrier, hazard
+}
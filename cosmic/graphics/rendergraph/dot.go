@@ -0,0 +1,71 @@
+package rendergraph
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// WriteDot writes the graph in the Graphviz dot format. Passes are boxes
+// labelled with their execution order, culled passes are dashed, and
+// resources are drawn per version with the physical resource transient
+// resources are allocated from.
+func (c *Compiled) WriteDot(w io.Writer) error {
+	g := c.graph
+	out := bufio.NewWriter(w)
+
+	position := make(map[PassID]int)
+	for i, p := range c.Passes {
+		position[p.ID] = i
+	}
+
+	fmt.Fprintln(out, "digraph rendergraph {")
+	fmt.Fprintln(out, "\trankdir=LR;")
+	fmt.Fprintln(out, "\tnode [fontname=\"sans-serif\"];")
+	fmt.Fprintln(out, "\tedge [fontname=\"sans-serif\", fontsize=10];")
+
+	for id, p := range g.passes {
+		if i, ok := position[PassID(id)]; ok {
+			fmt.Fprintf(out, "\tpass%d [shape=box, label=%q];\n", id, fmt.Sprintf("#%d %s", i, p.name))
+		} else {
+			fmt.Fprintf(out, "\tpass%d [shape=box, style=dashed, color=gray, fontcolor=gray, label=%q];\n", id, p.name+" (culled)")
+		}
+	}
+
+	for id, r := range g.resources {
+		info := c.Resources[id]
+
+		attributes := "shape=ellipse"
+		description := r.kind.String()
+		switch {
+		case r.imported:
+			attributes += ", style=bold"
+			description = "imported " + description
+		case info.Physical >= 0:
+			description = fmt.Sprintf("%s, physical %d", description, info.Physical)
+		default:
+			attributes += ", style=dashed, color=gray, fontcolor=gray"
+		}
+
+		for version := 0; version <= r.versions; version++ {
+			if version == 0 && !r.imported {
+				continue
+			}
+			label := fmt.Sprintf("%s v%d\n%s", r.name, version, description)
+			fmt.Fprintf(out, "\tres%d_%d [%s, label=%q];\n", id, version, attributes, label)
+		}
+	}
+
+	for id, p := range g.passes {
+		for _, a := range p.accesses {
+			if a.write {
+				fmt.Fprintf(out, "\tpass%d -> res%d_%d [label=%q];\n", id, a.handle.Resource, a.handle.Version+1, a.usage.String())
+			} else {
+				fmt.Fprintf(out, "\tres%d_%d -> pass%d [label=%q];\n", a.handle.Resource, a.handle.Version, id, a.usage.String())
+			}
+		}
+	}
+
+	fmt.Fprintln(out, "}")
+	return out.Flush()
+}
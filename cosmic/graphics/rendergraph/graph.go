@@ -0,0 +1,256 @@
+// Package rendergraph builds the passes of a frame from the resources they
+// read and write. From these declarations it derives the order in which the
+// passes execute, the layout transitions and barriers between them, which
+// transient resources can share memory, and which passes can be skipped
+// because nothing uses their output.
+//
+// Every write creates a new version of a resource, identified by the handle
+// it returns. Passes that read a version run after the pass that wrote it,
+// and a pass writing a resource runs after the passes reading the version it
+// overwrites, even when those passes were added later. Passes that do not
+// depend on each other run in the order they were added.
+package rendergraph
+
+import (
+	"fmt"
+)
+
+// ResourceKind distinguishes images from buffers.
+type ResourceKind int
+
+const (
+	KindImage ResourceKind = iota
+	KindBuffer
+)
+
+func (k ResourceKind) String() string {
+	if k == KindBuffer {
+		return "buffer"
+	}
+	return "image"
+}
+
+// Format is the pixel format of an image.
+type Format int
+
+const (
+	FormatRGBA8Unorm Format = iota
+	FormatRGBA8SRGB
+	FormatBGRA8SRGB
+	FormatRGBA16Float
+	FormatRGBA32Float
+	FormatR32Float
+	FormatDepth32Float
+	FormatDepth24Stencil8
+	FormatDepth32FloatStencil8
+)
+
+// IsDepth reports whether the format has a depth component.
+func (f Format) IsDepth() bool {
+	return f >= FormatDepth32Float
+}
+
+type ImageDesc struct {
+	Width, Height int
+	Format        Format
+	// Samples per pixel, 0 means 1.
+	Samples int
+}
+
+type BufferDesc struct {
+	Size uint64
+}
+
+// ResourceID identifies a resource of a graph.
+type ResourceID int
+
+// Handle refers to a version of a resource.
+type Handle struct {
+	Resource ResourceID
+	Version  int
+}
+
+// PassID identifies a pass of a graph.
+type PassID int
+
+// Import describes the state an imported resource is in before the graph
+// executes, and how it is used afterwards.
+type Import struct {
+	Layout Layout
+	// Stages that may still access the resource when the graph starts.
+	Stages Stage
+	// Usage after the graph, which the resource is transitioned to at the
+	// end. UsageNone leaves the resource as the last pass used it.
+	Final Usage
+}
+
+type resource struct {
+	name     string
+	kind     ResourceKind
+	image    ImageDesc
+	buffer   BufferDesc
+	imported bool
+	initial  Import
+	// Number of times the resource was written
+	versions int
+	// Pass that wrote each version, version 0 is written by no pass
+	writers []PassID
+}
+
+type access struct {
+	handle Handle
+	usage  Usage
+	write  bool
+}
+
+type pass struct {
+	name       string
+	accesses   []access
+	sideEffect bool
+}
+
+// Graph collects the passes and resources of a frame.
+type Graph struct {
+	resources []resource
+	passes    []pass
+	errors    []error
+}
+
+func New() *Graph {
+	return &Graph{}
+}
+
+// CreateImage declares an image that only lives during the graph. Its
+// contents are undefined until a pass writes it.
+func (g *Graph) CreateImage(name string, desc ImageDesc) Handle {
+	if desc.Samples == 0 {
+		desc.Samples = 1
+	}
+	return g.addResource(resource{name: name, kind: KindImage, image: desc})
+}
+
+// CreateBuffer declares a buffer that only lives during the graph.
+func (g *Graph) CreateBuffer(name string, desc BufferDesc) Handle {
+	return g.addResource(resource{name: name, kind: KindBuffer, buffer: desc})
+}
+
+// ImportImage declares an image owned outside of the graph, such as the
+// swapchain image. Imported resources outlive the graph, so the passes
+// writing them are never culled.
+func (g *Graph) ImportImage(name string, desc ImageDesc, state Import) Handle {
+	if desc.Samples == 0 {
+		desc.Samples = 1
+	}
+	return g.addResource(resource{name: name, kind: KindImage, image: desc, imported: true, initial: state})
+}
+
+// ImportBuffer declares a buffer owned outside of the graph.
+func (g *Graph) ImportBuffer(name string, desc BufferDesc, state Import) Handle {
+	state.Layout = LayoutUndefined
+	return g.addResource(resource{name: name, kind: KindBuffer, buffer: desc, imported: true, initial: state})
+}
+
+func (g *Graph) addResource(r resource) Handle {
+	r.writers = []PassID{-1}
+	g.resources = append(g.resources, r)
+	return Handle{Resource: ResourceID(len(g.resources) - 1)}
+}
+
+// AddPass adds a pass, whose reads and writes are declared by the setup
+// function.
+func (g *Graph) AddPass(name string, setup func(p *PassBuilder)) PassID {
+	id := PassID(len(g.passes))
+	g.passes = append(g.passes, pass{name: name})
+
+	setup(&PassBuilder{graph: g, id: id})
+	return id
+}
+
+// PassBuilder declares the resources used by a pass.
+type PassBuilder struct {
+	graph *Graph
+	id    PassID
+}
+
+func (b *PassBuilder) pass() *pass {
+	return &b.graph.passes[b.id]
+}
+
+func (b *PassBuilder) fail(format string, args ...interface{}) {
+	err := fmt.Errorf("pass %s: "+format, append([]interface{}{b.pass().name}, args...)...)
+	b.graph.errors = append(b.graph.errors, err)
+}
+
+// check validates the use of a resource version, returning false when it
+// cannot be used.
+func (b *PassBuilder) check(h Handle, usage Usage) bool {
+	if h.Resource < 0 || int(h.Resource) >= len(b.graph.resources) {
+		b.fail("unknown resource %d", h.Resource)
+		return false
+	}
+
+	r := &b.graph.resources[h.Resource]
+	state, ok := usageStates[usage]
+	if !ok || (r.kind == KindImage && !state.images) || (r.kind == KindBuffer && !state.bufs) {
+		b.fail("%s %s cannot be used as %s", r.kind, r.name, usage)
+		return false
+	}
+	if h.Version < 0 || h.Version > r.versions {
+		b.fail("unknown version %d of %s", h.Version, r.name)
+		return false
+	}
+
+	for _, a := range b.pass().accesses {
+		if a.handle.Resource == h.Resource && usageStates[a.usage].layoutFor(r.kind) != state.layoutFor(r.kind) {
+			b.fail("%s is used as both %s and %s", r.name, a.usage, usage)
+			return false
+		}
+	}
+
+	return true
+}
+
+// Read declares that the pass reads the given version of a resource.
+func (b *PassBuilder) Read(h Handle, usage Usage) {
+	if !b.check(h, usage) {
+		return
+	}
+
+	r := b.graph.resources[h.Resource]
+	if h.Version == 0 && !r.imported {
+		b.fail("%s is read before any pass writes it", r.name)
+		return
+	}
+
+	b.pass().accesses = append(b.pass().accesses, access{handle: h, usage: usage})
+}
+
+// Write declares that the pass writes the given version of a resource, and
+// returns the version it produces. Only the latest version can be written.
+func (b *PassBuilder) Write(h Handle, usage Usage) Handle {
+	if !b.check(h, usage) {
+		return h
+	}
+
+	r := &b.graph.resources[h.Resource]
+	if usageStates[usage].write == 0 {
+		b.fail("%s cannot be written as %s", r.name, usage)
+		return h
+	}
+	if h.Version != r.versions {
+		b.fail("version %d of %s is written, but version %d is the latest", h.Version, r.name, r.versions)
+		return h
+	}
+
+	r.versions++
+	r.writers = append(r.writers, b.id)
+
+	b.pass().accesses = append(b.pass().accesses, access{handle: h, usage: usage, write: true})
+	return Handle{Resource: h.Resource, Version: r.versions}
+}
+
+// SideEffect marks the pass as having effects outside the graph, such as
+// reading back results, so it is never culled.
+func (b *PassBuilder) SideEffect() {
+	b.pass().sideEffect = true
+}
@@ -0,0 +1,377 @@
+package rendergraph
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+var (
+	colorDesc = ImageDesc{Width: 64, Height: 64, Format: FormatRGBA16Float}
+	depthDesc = ImageDesc{Width: 64, Height: 64, Format: FormatDepth32Float}
+)
+
+func importBackbuffer(g *Graph) Handle {
+	return g.ImportImage("backbuffer", ImageDesc{Width: 64, Height: 64, Format: FormatBGRA8SRGB}, Import{
+		Layout: LayoutUndefined,
+		Stages: StageColorAttachmentOutput,
+		Final:  UsagePresent,
+	})
+}
+
+func passNames(c *Compiled) []string {
+	names := make([]string, len(c.Passes))
+	for i, p := range c.Passes {
+		names[i] = p.Name
+	}
+	return names
+}
+
+func compile(t *testing.T, g *Graph) *Compiled {
+	t.Helper()
+
+	c, err := g.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestCompile_order(t *testing.T) {
+	g := New()
+	backbuffer := importBackbuffer(g)
+	history := g.ImportImage("history", colorDesc, Import{Layout: LayoutShaderReadOnly})
+
+	// The history is updated by a pass added first, but the temporal pass
+	// reads the version from before the update, so it must run first
+	g.AddPass("update history", func(p *PassBuilder) {
+		p.Write(history, UsageColorAttachment)
+	})
+	g.AddPass("temporal", func(p *PassBuilder) {
+		p.Read(history, UsageSampled)
+		p.Write(backbuffer, UsageColorAttachment)
+	})
+
+	c := compile(t, g)
+	if names := strings.Join(passNames(c), ", "); names != "temporal, update history" {
+		t.Errorf("expected temporal, update history, got %s", names)
+	}
+}
+
+func TestCompile_culling(t *testing.T) {
+	g := New()
+	backbuffer := importBackbuffer(g)
+	unused := g.CreateImage("unused", colorDesc)
+	debug := g.CreateBuffer("statistics", BufferDesc{Size: 64})
+
+	g.AddPass("unused", func(p *PassBuilder) {
+		p.Write(unused, UsageColorAttachment)
+	})
+	g.AddPass("main", func(p *PassBuilder) {
+		p.Write(backbuffer, UsageColorAttachment)
+	})
+	g.AddPass("statistics", func(p *PassBuilder) {
+		p.Write(debug, UsageStorageBuffer)
+		p.SideEffect()
+	})
+
+	c := compile(t, g)
+	if names := strings.Join(passNames(c), ", "); names != "main, statistics" {
+		t.Errorf("expected main, statistics, got %s", names)
+	}
+	if len(c.Culled) != 1 || c.Culled[0] != 0 {
+		t.Errorf("expected the unused pass to be culled, got %v", c.Culled)
+	}
+	if c.Resources[unused.Resource].Physical != -1 {
+		t.Error("expected the unused image not to be allocated")
+	}
+}
+
+func TestCompile_cullingKeepsProducers(t *testing.T) {
+	g := New()
+	backbuffer := importBackbuffer(g)
+	shadows := g.CreateImage("shadow map", depthDesc)
+
+	g.AddPass("shadows", func(p *PassBuilder) {
+		shadows = p.Write(shadows, UsageDepthStencilAttachment)
+	})
+	g.AddPass("main", func(p *PassBuilder) {
+		p.Read(shadows, UsageSampled)
+		p.Write(backbuffer, UsageColorAttachment)
+	})
+
+	c := compile(t, g)
+	if len(c.Passes) != 2 || len(c.Culled) != 0 {
+		t.Errorf("expected both passes to execute, got %v", passNames(c))
+	}
+}
+
+func TestCompile_barriers(t *testing.T) {
+	g := New()
+	backbuffer := importBackbuffer(g)
+	scene := g.CreateImage("scene", colorDesc)
+
+	g.AddPass("scene", func(p *PassBuilder) {
+		scene = p.Write(scene, UsageColorAttachment)
+	})
+	g.AddPass("post processing", func(p *PassBuilder) {
+		p.Read(scene, UsageSampled)
+		p.Write(backbuffer, UsageColorAttachment)
+	})
+
+	c := compile(t, g)
+
+	expected := [][]Barrier{
+		{{
+			Resource: scene.Resource, OldLayout: LayoutUndefined, NewLayout: LayoutColorAttachment,
+			SrcStages: StageTopOfPipe, DstStages: StageColorAttachmentOutput,
+			DstAccess: AccessColorAttachmentRead | AccessColorAttachmentWrite,
+		}},
+		{{
+			Resource: scene.Resource, OldLayout: LayoutColorAttachment, NewLayout: LayoutShaderReadOnly,
+			SrcStages: StageColorAttachmentOutput, DstStages: StageFragmentShader | StageComputeShader,
+			SrcAccess: AccessColorAttachmentWrite, DstAccess: AccessShaderRead,
+		}, {
+			Resource: backbuffer.Resource, OldLayout: LayoutUndefined, NewLayout: LayoutColorAttachment,
+			SrcStages: StageColorAttachmentOutput, DstStages: StageColorAttachmentOutput,
+			DstAccess: AccessColorAttachmentRead | AccessColorAttachmentWrite,
+		}},
+	}
+
+	for i, p := range c.Passes {
+		if len(p.Barriers) != len(expected[i]) {
+			t.Fatalf("pass %s: expected %d barriers, got %+v", p.Name, len(expected[i]), p.Barriers)
+		}
+		for j, barrier := range p.Barriers {
+			if barrier != expected[i][j] {
+				t.Errorf("pass %s barrier %d:\nexpected %+v\ngot      %+v", p.Name, j, expected[i][j], barrier)
+			}
+		}
+	}
+
+	present := Barrier{
+		Resource: backbuffer.Resource, OldLayout: LayoutColorAttachment, NewLayout: LayoutPresent,
+		SrcStages: StageColorAttachmentOutput, DstStages: StageBottomOfPipe, SrcAccess: AccessColorAttachmentWrite,
+	}
+	if len(c.FinalBarriers) != 1 || c.FinalBarriers[0] != present {
+		t.Errorf("expected final barrier %+v, got %+v", present, c.FinalBarriers)
+	}
+}
+
+func TestCompile_storageReadAfterWrite(t *testing.T) {
+	tests := []struct {
+		name   string
+		create func(g *Graph) Handle
+		usage  Usage
+		stages Stage
+		layout Layout
+	}{
+		{"buffer", func(g *Graph) Handle {
+			return g.CreateBuffer("particles", BufferDesc{Size: 1024})
+		}, UsageStorageBuffer, StageVertexShader | StageFragmentShader | StageComputeShader, LayoutUndefined},
+		{"image", func(g *Graph) Handle {
+			return g.CreateImage("particles", colorDesc)
+		}, UsageStorageImage, StageFragmentShader | StageComputeShader, LayoutGeneral},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := New()
+			backbuffer := importBackbuffer(g)
+			particles := test.create(g)
+
+			g.AddPass("simulate", func(p *PassBuilder) {
+				particles = p.Write(particles, test.usage)
+			})
+			g.AddPass("cull", func(p *PassBuilder) {
+				p.Read(particles, test.usage)
+				p.Write(backbuffer, UsageColorAttachment)
+			})
+
+			c := compile(t, g)
+			expected := Barrier{
+				Resource: particles.Resource, OldLayout: test.layout, NewLayout: test.layout,
+				SrcStages: test.stages, DstStages: test.stages,
+				SrcAccess: AccessShaderWrite, DstAccess: AccessShaderRead,
+			}
+			for _, barrier := range c.Passes[1].Barriers {
+				if barrier.Resource == particles.Resource {
+					if barrier != expected {
+						t.Errorf("expected %+v\ngot      %+v", expected, barrier)
+					}
+					return
+				}
+			}
+			t.Errorf("expected a barrier before reading what the simulation wrote, got %+v", c.Passes[1].Barriers)
+		})
+	}
+}
+
+func TestCompile_noBarrierBetweenReads(t *testing.T) {
+	g := New()
+	backbuffer := importBackbuffer(g)
+	lut := g.ImportImage("lut", colorDesc, Import{Layout: LayoutShaderReadOnly})
+
+	g.AddPass("first", func(p *PassBuilder) {
+		p.Read(lut, UsageSampled)
+		backbuffer = p.Write(backbuffer, UsageColorAttachment)
+	})
+	g.AddPass("second", func(p *PassBuilder) {
+		p.Read(lut, UsageSampled)
+		p.Write(backbuffer, UsageColorAttachment)
+	})
+
+	c := compile(t, g)
+	for _, p := range c.Passes {
+		for _, barrier := range p.Barriers {
+			if barrier.Resource == lut.Resource {
+				t.Errorf("pass %s: expected no barrier for reading the lut, got %+v", p.Name, barrier)
+			}
+		}
+	}
+}
+
+func TestCompile_aliasing(t *testing.T) {
+	g := New()
+	backbuffer := importBackbuffer(g)
+	a := g.CreateImage("a", colorDesc)
+	b := g.CreateImage("b", colorDesc)
+	c := g.CreateImage("c", colorDesc)
+	depth := g.CreateImage("depth", depthDesc)
+
+	// a is dead after the second pass, so c can reuse its memory, while b
+	// is alive at the same time as a and c
+	g.AddPass("1", func(p *PassBuilder) {
+		a = p.Write(a, UsageColorAttachment)
+		b = p.Write(b, UsageColorAttachment)
+		p.Write(depth, UsageDepthStencilAttachment)
+	})
+	g.AddPass("2", func(p *PassBuilder) {
+		p.Read(a, UsageSampled)
+		b = p.Write(b, UsageColorAttachment)
+	})
+	g.AddPass("3", func(p *PassBuilder) {
+		p.Read(b, UsageSampled)
+		c = p.Write(c, UsageColorAttachment)
+	})
+	g.AddPass("4", func(p *PassBuilder) {
+		p.Read(c, UsageSampled)
+		p.Write(backbuffer, UsageColorAttachment)
+	})
+
+	compiled := compile(t, g)
+
+	physical := func(h Handle) int { return compiled.Resources[h.Resource].Physical }
+	if physical(a) != physical(c) {
+		t.Errorf("expected a and c to share memory, got %d and %d", physical(a), physical(c))
+	}
+	if physical(a) == physical(b) {
+		t.Error("expected a and b not to share memory")
+	}
+	if physical(depth) == physical(a) || physical(depth) == physical(b) {
+		t.Error("expected the depth image not to share memory with color images")
+	}
+	if len(compiled.Physical) != 3 {
+		t.Errorf("expected 3 physical images, got %d", len(compiled.Physical))
+	}
+
+	shared := compiled.Physical[physical(a)]
+	if len(shared.Usages) != 2 || shared.Usages[0] != UsageColorAttachment || shared.Usages[1] != UsageSampled {
+		t.Errorf("expected the shared image to be used as color attachment and sampled, got %v", shared.Usages)
+	}
+
+	// The first write of c must wait for the last read of a
+	var found bool
+	for _, barrier := range compiled.Passes[2].Barriers {
+		if barrier.Resource == c.Resource {
+			found = true
+			if barrier.OldLayout != LayoutUndefined || barrier.SrcStages&(StageFragmentShader) == 0 {
+				t.Errorf("expected c to discard a after its reads, got %+v", barrier)
+			}
+		}
+	}
+	if !found {
+		t.Error("expected a barrier before writing c")
+	}
+}
+
+func TestCompile_errors(t *testing.T) {
+	tests := map[string]func(g *Graph){
+		"read before write": func(g *Graph) {
+			image := g.CreateImage("image", colorDesc)
+			g.AddPass("pass", func(p *PassBuilder) { p.Read(image, UsageSampled) })
+		},
+		"stale write": func(g *Graph) {
+			image := g.CreateImage("image", colorDesc)
+			g.AddPass("first", func(p *PassBuilder) { p.Write(image, UsageColorAttachment) })
+			g.AddPass("second", func(p *PassBuilder) { p.Write(image, UsageColorAttachment) })
+		},
+		"buffer usage on image": func(g *Graph) {
+			image := g.CreateImage("image", colorDesc)
+			g.AddPass("pass", func(p *PassBuilder) { p.Write(image, UsageStorageBuffer) })
+		},
+		"read only usage written": func(g *Graph) {
+			image := g.CreateImage("image", colorDesc)
+			g.AddPass("pass", func(p *PassBuilder) { p.Write(image, UsageSampled) })
+		},
+		"conflicting layouts": func(g *Graph) {
+			image := g.CreateImage("image", colorDesc)
+			g.AddPass("first", func(p *PassBuilder) { image = p.Write(image, UsageColorAttachment) })
+			g.AddPass("second", func(p *PassBuilder) {
+				p.Read(image, UsageSampled)
+				p.Write(image, UsageColorAttachment)
+			})
+		},
+		"cycle": func(g *Graph) {
+			backbuffer := importBackbuffer(g)
+			x := g.ImportImage("x", colorDesc, Import{})
+			y := g.ImportImage("y", colorDesc, Import{})
+			// Writing x after second reads it, while second overwrites
+			// the version of y first reads
+			g.AddPass("first", func(p *PassBuilder) {
+				p.Read(y, UsageSampled)
+				p.Write(x, UsageColorAttachment)
+			})
+			g.AddPass("second", func(p *PassBuilder) {
+				p.Read(x, UsageSampled)
+				p.Write(y, UsageColorAttachment)
+				p.Write(backbuffer, UsageColorAttachment)
+			})
+		},
+	}
+
+	for name, build := range tests {
+		g := New()
+		build(g)
+
+		if _, err := g.Compile(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestCompiled_WriteDot(t *testing.T) {
+	g := New()
+	backbuffer := importBackbuffer(g)
+	unused := g.CreateImage("unused", colorDesc)
+
+	g.AddPass("unused", func(p *PassBuilder) { p.Write(unused, UsageColorAttachment) })
+	g.AddPass("main", func(p *PassBuilder) { p.Write(backbuffer, UsageColorAttachment) })
+
+	var out bytes.Buffer
+	if err := compile(t, g).WriteDot(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	dot := out.String()
+	for _, expected := range []string{
+		"digraph rendergraph {",
+		`pass0 [shape=box, style=dashed, color=gray, fontcolor=gray, label="unused (culled)"];`,
+		`pass1 [shape=box, label="#0 main"];`,
+		`pass1 -> res0_1 [label="color attachment"];`,
+	} {
+		if !strings.Contains(dot, expected) {
+			t.Errorf("expected dot output to contain %s, got:\n%s", expected, dot)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package rendergraph
+
+// Layout is the layout an image must be in to be used in a certain way.
+// Buffers have no layout.
+type Layout int
+
+const (
+	LayoutUndefined Layout = iota
+	LayoutGeneral
+	LayoutColorAttachment
+	LayoutDepthStencilAttachment
+	LayoutDepthStencilReadOnly
+	LayoutShaderReadOnly
+	LayoutTransferSrc
+	LayoutTransferDst
+	LayoutPresent
+)
+
+var layoutNames = [...]string{
+	"undefined", "general", "color attachment", "depth stencil attachment", "depth stencil read only",
+	"shader read only", "transfer source", "transfer destination", "present",
+}
+
+func (l Layout) String() string {
+	if l < 0 || int(l) >= len(layoutNames) {
+		return "unknown"
+	}
+	return layoutNames[l]
+}
+
+// Stage is a set of pipeline stages in which resources are accessed.
+type Stage uint32
+
+const (
+	StageTopOfPipe Stage = 1 << iota
+	StageDrawIndirect
+	StageVertexInput
+	StageVertexShader
+	StageFragmentShader
+	StageEarlyFragmentTests
+	StageLateFragmentTests
+	StageColorAttachmentOutput
+	StageComputeShader
+	StageTransfer
+	StageBottomOfPipe
+	StageHost
+)
+
+// Access is a set of ways in which memory is accessed.
+type Access uint32
+
+const (
+	AccessIndirectCommandRead Access = 1 << iota
+	AccessIndexRead
+	AccessVertexAttributeRead
+	AccessUniformRead
+	AccessShaderRead
+	AccessShaderWrite
+	AccessColorAttachmentRead
+	AccessColorAttachmentWrite
+	AccessDepthStencilAttachmentRead
+	AccessDepthStencilAttachmentWrite
+	AccessTransferRead
+	AccessTransferWrite
+	AccessHostRead
+	AccessHostWrite
+)
+
+// Usage describes how a pass uses a resource.
+type Usage int
+
+const (
+	UsageNone Usage = iota
+
+	// Image usages
+	UsageColorAttachment
+	UsageDepthStencilAttachment
+	UsageSampled
+	UsageStorageImage
+	UsagePresent
+
+	// Buffer usages
+	UsageVertexBuffer
+	UsageIndexBuffer
+	UsageUniformBuffer
+	UsageStorageBuffer
+	UsageIndirectBuffer
+
+	// Usages of both images and buffers
+	UsageTransferSrc
+	UsageTransferDst
+)
+
+// usageState describes the state a resource must be in for a usage.
+type usageState struct {
+	name   string
+	images bool
+	bufs   bool
+	layout Layout
+	stages Stage
+	read   Access
+	// Zero when the usage cannot write
+	write Access
+}
+
+var usageStates = map[Usage]usageState{
+	UsageColorAttachment: {
+		name: "color attachment", images: true, layout: LayoutColorAttachment, stages: StageColorAttachmentOutput,
+		read: AccessColorAttachmentRead, write: AccessColorAttachmentWrite,
+	},
+	UsageDepthStencilAttachment: {
+		name: "depth stencil attachment", images: true, layout: LayoutDepthStencilAttachment,
+		stages: StageEarlyFragmentTests | StageLateFragmentTests,
+		read:   AccessDepthStencilAttachmentRead, write: AccessDepthStencilAttachmentWrite,
+	},
+	UsageSampled: {
+		name: "sampled", images: true, layout: LayoutShaderReadOnly, stages: StageFragmentShader | StageComputeShader,
+		read: AccessShaderRead,
+	},
+	UsageStorageImage: {
+		name: "storage image", images: true, layout: LayoutGeneral, stages: StageFragmentShader | StageComputeShader,
+		read: AccessShaderRead, write: AccessShaderWrite,
+	},
+	UsagePresent: {
+		name: "present", images: true, layout: LayoutPresent, stages: StageBottomOfPipe,
+	},
+	UsageVertexBuffer: {
+		name: "vertex buffer", bufs: true, stages: StageVertexInput, read: AccessVertexAttributeRead,
+	},
+	UsageIndexBuffer: {
+		name: "index buffer", bufs: true, stages: StageVertexInput, read: AccessIndexRead,
+	},
+	UsageUniformBuffer: {
+		name: "uniform buffer", bufs: true, stages: StageVertexShader | StageFragmentShader | StageComputeShader,
+		read: AccessUniformRead,
+	},
+	UsageStorageBuffer: {
+		name: "storage buffer", bufs: true, stages: StageVertexShader | StageFragmentShader | StageComputeShader,
+		read: AccessShaderRead, write: AccessShaderWrite,
+	},
+	UsageIndirectBuffer: {
+		name: "indirect buffer", bufs: true, stages: StageDrawIndirect, read: AccessIndirectCommandRead,
+	},
+	UsageTransferSrc: {
+		name: "transfer source", images: true, bufs: true, layout: LayoutTransferSrc, stages: StageTransfer,
+		read: AccessTransferRead,
+	},
+	UsageTransferDst: {
+		name: "transfer destination", images: true, bufs: true, layout: LayoutTransferDst, stages: StageTransfer,
+		write: AccessTransferWrite,
+	},
+}
+
+func (u Usage) String() string {
+	if state, ok := usageStates[u]; ok {
+		return state.name
+	}
+	return "none"
+}
+
+// layoutFor returns the layout of a resource of the given kind for a usage.
+func (s usageState) layoutFor(kind ResourceKind) Layout {
+	if kind == KindBuffer {
+		return LayoutUndefined
+	}
+	return s.layout
+}
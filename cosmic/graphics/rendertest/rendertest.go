@@ -0,0 +1,187 @@
+// Package rendertest holds the render tests every graphics backend runs,
+// comparing what it draws into an offscreen context to golden images. Each
+// backend runs them from its own tests, so testing the software rasterizer
+// does not link the window system the Vulkan backend presents to.
+//
+// The reference images are shared by all backends and live in testdata/golden
+// of this package.
+package rendertest
+
+import (
+	"bytes"
+	"github.com/lentus/cosmic-engine/cosmic/camera"
+	"github.com/lentus/cosmic-engine/cosmic/graphics"
+	"github.com/lentus/cosmic-engine/cosmic/graphics/golden"
+	"github.com/lentus/cosmic-engine/cosmic/math"
+	"github.com/lentus/cosmic-engine/cosmic/renderer2d"
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// NewContext creates an offscreen context of the backend under test.
+type NewContext func(properties graphics.ContextProperties, width, height int) graphics.OffscreenContext
+
+// references is the directory of the reference images, found from the source
+// of this package since the tests run in the directory of the backend.
+var references = func() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "testdata", "golden")
+}()
+
+// Backends may rasterize the edges of the triangle slightly differently.
+var triangleOptions = golden.Options{Tolerance: 3, MaxMismatched: 64, Directory: references}
+
+// Tessellated shapes have many more edges than the triangle.
+var shapeOptions = golden.Options{Tolerance: 3, MaxMismatched: 192, Directory: references}
+
+var tests = []struct {
+	name          string
+	width, height int
+	test          func(t *testing.T, ctx graphics.OffscreenContext)
+}{
+	{"triangle", 64, 64, testTriangle},
+	{"resize", 16, 16, testResize},
+	{"Capture", 64, 64, testCapture},
+	{"SetSamples", 64, 64, testSetSamples},
+	{"CreateStorageBuffer", 16, 16, testCreateStorageBuffer},
+	{"CreateStorageImage", 16, 16, testCreateStorageImage},
+	{"renderer2d", 64, 64, testRenderer2D},
+}
+
+// Run runs every render test with a new offscreen context of the backend.
+func Run(t *testing.T, newContext NewContext) {
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			cacheDirectory, err := ioutil.TempDir("", "cosmic-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(cacheDirectory)
+
+			ctx := newContext(graphics.ContextProperties{
+				PipelineCachePath: filepath.Join(cacheDirectory, "pipeline-cache.bin"),
+			}, test.width, test.height)
+			defer ctx.Terminate()
+
+			test.test(t, ctx)
+		})
+	}
+}
+
+func testTriangle(t *testing.T, ctx graphics.OffscreenContext) {
+	ctx.Render()
+	golden.Assert(t, ctx.ReadPixels(), "triangle", triangleOptions)
+}
+
+func testResize(t *testing.T, ctx graphics.OffscreenContext) {
+	ctx.Resize(96, 48)
+	if width, height := ctx.Size(); width != 96 || height != 48 {
+		t.Fatalf("expected size 96x48, got %dx%d", width, height)
+	}
+
+	ctx.Render()
+	golden.Assert(t, ctx.ReadPixels(), "triangle-wide", triangleOptions)
+}
+
+func testCapture(t *testing.T, ctx graphics.OffscreenContext) {
+	frame := ctx.Capture()
+	// The capture completes once the frame it was recorded in has finished,
+	// which may take as many frames as are in flight
+	for i := 0; i < 3; i++ {
+		ctx.Render()
+	}
+
+	img, ok := <-frame
+	if !ok {
+		t.Fatal("expected the frame to be captured")
+	}
+	golden.Assert(t, img, "triangle", triangleOptions)
+}
+
+func testSetSamples(t *testing.T, ctx graphics.OffscreenContext) {
+	ctx.SetSamples(4)
+	ctx.Render()
+
+	if samples := ctx.Samples(); samples < 1 || samples > 4 {
+		t.Errorf("expected between 1 and 4 samples, got %d", samples)
+	}
+	// Multisampling only changes the edges of the triangle
+	golden.Assert(t, ctx.ReadPixels(), "triangle", triangleOptions)
+}
+
+func testCreateStorageBuffer(t *testing.T, ctx graphics.OffscreenContext) {
+	buffer := ctx.CreateStorageBuffer(8)
+	defer buffer.Destroy()
+
+	// Only written bytes are defined, gpu memory is not cleared
+	buffer.Write(2, []byte{1, 2, 3})
+	data := buffer.Read()
+	if len(data) != 8 || !bytes.Equal(data[2:5], []byte{1, 2, 3}) {
+		t.Errorf("unexpected storage buffer contents %v", data)
+	}
+}
+
+func testCreateStorageImage(t *testing.T, ctx graphics.OffscreenContext) {
+	img := ctx.CreateStorageImage(4, 2)
+	defer img.Destroy()
+
+	if width, height := img.Size(); width != 4 || height != 2 {
+		t.Fatalf("expected size 4x2, got %dx%d", width, height)
+	}
+	if pixels := img.ReadPixels(); pixels.Rect.Dx() != 4 || pixels.Rect.Dy() != 2 {
+		t.Errorf("expected 4x2 pixels, got %v", pixels.Rect)
+	}
+}
+
+func testRenderer2D(t *testing.T, ctx graphics.OffscreenContext) {
+	checker := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	copy(checker.Pix, []uint8{
+		255, 255, 255, 255, 0, 0, 0, 255,
+		0, 0, 0, 255, 255, 255, 255, 255,
+	})
+	texture := ctx.CreateTexture(checker, graphics.FilterNearest)
+	defer texture.Destroy()
+
+	renderer := renderer2d.New(ctx)
+	defer renderer.Destroy()
+
+	view := camera.NewOrthographic(64, 1, -1, 1)
+	view.Position = math.Vec3{X: 32, Y: 32}
+
+	renderer.Begin(view)
+	renderer.DrawSprite(renderer2d.Sprite{
+		Position: math.Vec2{X: 16, Y: 48},
+		Size:     math.Vec2{X: 24, Y: 24},
+		Texture:  texture,
+	})
+	renderer.DrawCircle(math.Vec2{X: 48, Y: 48}, 12, 0, renderer2d.Color{0, 0, 1, 1})
+	renderer.DrawRoundedRect(math.Vec2{X: 32, Y: 16}, math.Vec2{X: 48, Y: 20}, 6, 0, renderer2d.Color{0, 1, 0, 1})
+	// Drawn after the rounded rectangle, but below it
+	renderer.DrawLine(math.Vec2{X: 4, Y: 4}, math.Vec2{X: 60, Y: 28}, 3, -1, renderer2d.White)
+	renderer.DrawSprite(renderer2d.Sprite{
+		Position: math.Vec2{X: 32, Y: 32},
+		Size:     math.Vec2{X: 16, Y: 16},
+		Rotation: 0.5,
+		Z:        1,
+		Tint:     renderer2d.Color{1, 1, 0, 0.5},
+	})
+	renderer.End()
+
+	// Backends may split the batch into draw calls
+	if stats := renderer.Stats(); stats.Batches != 1 || stats.DrawCalls < 1 || stats.Quads != 3 {
+		t.Errorf("expected 1 batch and 3 quads, got %+v", stats)
+	}
+
+	ctx.Render()
+	golden.Assert(t, ctx.ReadPixels(), "renderer2d", shapeOptions)
+
+	// Batches are only drawn in the frame they were queued for
+	ctx.Render()
+	golden.Assert(t, ctx.ReadPixels(), "triangle", triangleOptions)
+}
@@ -0,0 +1,35 @@
+package graphics
+
+import (
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ScreenshotName returns the file name of a screenshot taken at the given
+// time. Names sort in the order the screenshots were taken.
+func ScreenshotName(t time.Time) string {
+	return "screenshot-" + t.Format("20060102-150405.000") + ".png"
+}
+
+// SavePNG encodes an image as PNG to the given path, creating its directory
+// when it does not exist.
+func SavePNG(img image.Image, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err = png.Encode(file, img); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
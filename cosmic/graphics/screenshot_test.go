@@ -0,0 +1,55 @@
+package graphics
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestScreenshotName_sorts(t *testing.T) {
+	first := time.Date(2020, 5, 1, 9, 59, 59, 999e6, time.UTC)
+	second := first.Add(time.Millisecond)
+
+	if ScreenshotName(first) >= ScreenshotName(second) {
+		t.Errorf("expected %s to sort before %s", ScreenshotName(first), ScreenshotName(second))
+	}
+}
+
+func TestSavePNG(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.Set(0, 0, color.RGBA{R: 255, A: 255})
+	img.Set(1, 0, color.RGBA{B: 255, A: 255})
+
+	dir, err := ioutil.TempDir("", "cosmic-screenshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "nested", "shot.png")
+	if err := SavePNG(img, path); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	decoded, err := png.Decode(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for x := 0; x < 2; x++ {
+		if decoded.At(x, 0) != img.At(x, 0) {
+			t.Errorf("pixel %d: expected %v, got %v", x, img.At(x, 0), decoded.At(x, 0))
+		}
+	}
+}
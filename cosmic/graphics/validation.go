@@ -0,0 +1,133 @@
+package graphics
+
+import (
+	"fmt"
+	"strings"
+)
+
+type DebugSeverity int
+
+const (
+	// The default minimum severity, which is SeverityWarning.
+	SeverityDefault DebugSeverity = iota
+	SeverityVerbose
+	SeverityInfo
+	SeverityWarning
+	SeverityError
+)
+
+func (s DebugSeverity) String() string {
+	switch s {
+	case SeverityVerbose:
+		return "Verbose"
+	case SeverityInfo:
+		return "Info"
+	case SeverityWarning:
+		return "Warning"
+	case SeverityError:
+		return "Error"
+	default:
+		return "Default"
+	}
+}
+
+// DebugMessageType is a bitmask of the kinds of messages reported by the
+// validation layers.
+type DebugMessageType uint32
+
+const (
+	MessageGeneral DebugMessageType = 1 << iota
+	MessageValidation
+	MessagePerformance
+
+	MessageAll = MessageGeneral | MessageValidation | MessagePerformance
+)
+
+func (t DebugMessageType) String() string {
+	var names []string
+	if t&MessageGeneral != 0 {
+		names = append(names, "General")
+	}
+	if t&MessageValidation != 0 {
+		names = append(names, "Validation")
+	}
+	if t&MessagePerformance != 0 {
+		names = append(names, "Performance")
+	}
+
+	return strings.Join(names, "|")
+}
+
+// DebugMessage is a message reported by the validation layers or driver.
+type DebugMessage struct {
+	Severity DebugSeverity
+	Type     DebugMessageType
+	ID       string
+	Message  string
+	// Objects involved, described by their type and the name they were
+	// given by the engine.
+	Objects []string
+	// Labels of the command buffer regions the message was reported in,
+	// innermost last.
+	Labels []string
+}
+
+func (m DebugMessage) String() string {
+	str := fmt.Sprintf("[%s] %s", m.Type, m.Message)
+	if len(m.Objects) > 0 {
+		str += " (objects: " + strings.Join(m.Objects, ", ") + ")"
+	}
+	if len(m.Labels) > 0 {
+		str += " (in: " + strings.Join(m.Labels, " > ") + ")"
+	}
+
+	return str
+}
+
+type ValidationProperties struct {
+	// Enables the Khronos validation layer and reports its messages. Ignored
+	// in release builds.
+	Enabled bool
+
+	// Messages below this severity are dropped. Defaults to SeverityWarning.
+	MinSeverity DebugSeverity
+
+	// Kinds of messages that are reported. Defaults to MessageAll.
+	MessageTypes DebugMessageType
+
+	// Called with every validation error, after the frame in which it was
+	// reported. Use PanicOnValidationError to abort, or call t.Error from a
+	// test to fail it. Errors are only logged when OnError is nil.
+	OnError func(message DebugMessage)
+
+	// Additional instance layers to enable along with validation, such as
+	// VK_LAYER_LUNARG_monitor or VK_LAYER_LUNARG_api_dump.
+	Layers []string
+}
+
+// Active reports whether validation is enabled and available in this build.
+func (p ValidationProperties) Active() bool {
+	return p.Enabled && !ReleaseBuild
+}
+
+// Reports returns whether messages of the given severity and type pass the
+// configured filter.
+func (p ValidationProperties) Reports(severity DebugSeverity, messageType DebugMessageType) bool {
+	minSeverity := p.MinSeverity
+	if minSeverity == SeverityDefault {
+		minSeverity = SeverityWarning
+	}
+
+	messageTypes := p.MessageTypes
+	if messageTypes == 0 {
+		messageTypes = MessageAll
+	}
+
+	return severity >= minSeverity && messageType&messageTypes != 0
+}
+
+// PanicOnValidationError can be used as ValidationProperties.OnError to abort
+// on the first validation error.
+func PanicOnValidationError(message DebugMessage) {
+	panic("Vulkan validation error: " + message.String())
+}
@@ -0,0 +1,56 @@
+package graphics
+
+import "testing"
+
+func TestValidationProperties_Reports_defaults(t *testing.T) {
+	properties := ValidationProperties{Enabled: true}
+
+	tests := []struct {
+		severity DebugSeverity
+		expected bool
+	}{
+		{SeverityVerbose, false},
+		{SeverityInfo, false},
+		{SeverityWarning, true},
+		{SeverityError, true},
+	}
+
+	for _, test := range tests {
+		for _, messageType := range []DebugMessageType{MessageGeneral, MessageValidation, MessagePerformance} {
+			if actual := properties.Reports(test.severity, messageType); actual != test.expected {
+				t.Errorf("%s %s: expected %v, got %v", test.severity, messageType, test.expected, actual)
+			}
+		}
+	}
+}
+
+func TestValidationProperties_Reports_filter(t *testing.T) {
+	properties := ValidationProperties{
+		Enabled:      true,
+		MinSeverity:  SeverityInfo,
+		MessageTypes: MessageValidation,
+	}
+
+	if !properties.Reports(SeverityInfo, MessageValidation) {
+		t.Error("expected validation info messages to be reported")
+	}
+	if properties.Reports(SeverityVerbose, MessageValidation) {
+		t.Error("expected verbose messages to be dropped")
+	}
+	if properties.Reports(SeverityError, MessagePerformance) {
+		t.Error("expected performance messages to be dropped")
+	}
+	if !properties.Reports(SeverityError, MessageGeneral|MessageValidation) {
+		t.Error("expected messages with any accepted type to be reported")
+	}
+}
+
+func TestPanicOnValidationError(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic")
+		}
+	}()
+
+	PanicOnValidationError(DebugMessage{Severity: SeverityError, Type: MessageValidation, Message: "misuse"})
+}
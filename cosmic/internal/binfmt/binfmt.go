@@ -0,0 +1,211 @@
+// Package binfmt reads and writes the parts of the binary file formats of the
+// engine: varints, little endian numbers and strings and byte slices prefixed
+// by their length.
+package binfmt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	stdmath "math"
+)
+
+// Capacity returns how much to allocate for n elements read from a file,
+// which may be corrupt. Slices grow as needed beyond it.
+func Capacity(n int) int {
+	if n > 1024 {
+		return 1024
+	}
+	return n
+}
+
+// Writer writes the parts of a file. Errors of the underlying writer are
+// returned by Flush.
+type Writer struct {
+	w       *bufio.Writer
+	scratch [binary.MaxVarintLen64]byte
+}
+
+func NewWriter(w *bufio.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Write writes raw bytes, without their length.
+func (w *Writer) Write(p []byte) {
+	w.w.Write(p)
+}
+
+func (w *Writer) Byte(b byte) {
+	w.w.WriteByte(b)
+}
+
+func (w *Writer) Uvarint(v uint64) {
+	n := binary.PutUvarint(w.scratch[:], v)
+	w.w.Write(w.scratch[:n])
+}
+
+func (w *Writer) Varint(v int64) {
+	n := binary.PutVarint(w.scratch[:], v)
+	w.w.Write(w.scratch[:n])
+}
+
+func (w *Writer) Uint32(v uint32) {
+	binary.LittleEndian.PutUint32(w.scratch[:], v)
+	w.w.Write(w.scratch[:4])
+}
+
+func (w *Writer) Uint64(v uint64) {
+	binary.LittleEndian.PutUint64(w.scratch[:], v)
+	w.w.Write(w.scratch[:8])
+}
+
+func (w *Writer) Float32(values ...float32) {
+	for _, v := range values {
+		w.Uint32(stdmath.Float32bits(v))
+	}
+}
+
+func (w *Writer) Bytes(b []byte) {
+	w.Uvarint(uint64(len(b)))
+	w.w.Write(b)
+}
+
+func (w *Writer) String(s string) {
+	w.Uvarint(uint64(len(s)))
+	w.w.WriteString(s)
+}
+
+func (w *Writer) Bool(b bool) {
+	if b {
+		w.w.WriteByte(1)
+	} else {
+		w.w.WriteByte(0)
+	}
+}
+
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+// Reader reads the parts of a file, remembering the first error so that
+// callers check it once. After an error, every read returns the zero value.
+type Reader struct {
+	r         *bufio.Reader
+	err       error
+	maxLength int
+	scratch   [8]byte
+}
+
+// NewReader returns a reader failing on lengths above maxLength, so a corrupt
+// file does not make it allocate huge buffers.
+func NewReader(r *bufio.Reader, maxLength int) *Reader {
+	return &Reader{r: r, maxLength: maxLength}
+}
+
+// Err returns the first error of the reader.
+func (r *Reader) Err() error {
+	return r.err
+}
+
+// Fail sets the error of the reader, unless it already failed. The end of the
+// file is unexpected, since the format says how much there is to read.
+func (r *Reader) Fail(err error) {
+	if r.err == nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		r.err = err
+	}
+}
+
+// ReadFull reads raw bytes into p, reporting whether all of them were read.
+func (r *Reader) ReadFull(p []byte) bool {
+	if r.err != nil {
+		return false
+	}
+
+	_, err := io.ReadFull(r.r, p)
+	r.Fail(err)
+	return err == nil
+}
+
+func (r *Reader) Byte() byte {
+	if r.err != nil {
+		return 0
+	}
+
+	b, err := r.r.ReadByte()
+	r.Fail(err)
+	return b
+}
+
+func (r *Reader) Uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+
+	v, err := binary.ReadUvarint(r.r)
+	r.Fail(err)
+	return v
+}
+
+func (r *Reader) Varint() int {
+	if r.err != nil {
+		return 0
+	}
+
+	v, err := binary.ReadVarint(r.r)
+	r.Fail(err)
+	return int(v)
+}
+
+// Length reads a varint counting elements or bytes.
+func (r *Reader) Length() int {
+	n := r.Uvarint()
+	if n > uint64(r.maxLength) {
+		r.Fail(fmt.Errorf("invalid length %d", n))
+		return 0
+	}
+
+	return int(n)
+}
+
+func (r *Reader) Uint32() uint32 {
+	if !r.ReadFull(r.scratch[:4]) {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(r.scratch[:])
+}
+
+func (r *Reader) Uint64() uint64 {
+	if !r.ReadFull(r.scratch[:8]) {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(r.scratch[:])
+}
+
+func (r *Reader) Float32() float32 {
+	return stdmath.Float32frombits(r.Uint32())
+}
+
+func (r *Reader) Bytes() []byte {
+	n := r.Length()
+	if r.err != nil || n == 0 {
+		return nil
+	}
+
+	data := make([]byte, n)
+	if !r.ReadFull(data) {
+		return nil
+	}
+	return data
+}
+
+func (r *Reader) String() string {
+	return string(r.Bytes())
+}
+
+func (r *Reader) Bool() bool {
+	return r.Byte() != 0
+}
@@ -0,0 +1,58 @@
+package binfmt
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	var buffer bytes.Buffer
+	w := NewWriter(bufio.NewWriter(&buffer))
+	w.Uvarint(300)
+	w.Varint(-5)
+	w.Uint64(1 << 40)
+	w.Float32(1.5, -2)
+	w.String("node")
+	w.Bool(true)
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Failed to write - %s", err.Error())
+	}
+
+	r := NewReader(bufio.NewReader(&buffer), 16)
+	if v := r.Uvarint(); v != 300 {
+		t.Errorf("Expected 300, got %d", v)
+	}
+	if v := r.Varint(); v != -5 {
+		t.Errorf("Expected -5, got %d", v)
+	}
+	if v := r.Uint64(); v != 1<<40 {
+		t.Errorf("Expected %d, got %d", uint64(1<<40), v)
+	}
+	if a, b := r.Float32(), r.Float32(); a != 1.5 || b != -2 {
+		t.Errorf("Expected 1.5 and -2, got %g and %g", a, b)
+	}
+	if s := r.String(); s != "node" {
+		t.Errorf("Expected node, got %q", s)
+	}
+	if !r.Bool() || r.Err() != nil {
+		t.Errorf("Expected true without error, got %v", r.Err())
+	}
+
+	if r.Byte(); r.Err() != io.ErrUnexpectedEOF {
+		t.Errorf("Expected the end of the file to be unexpected, got %v", r.Err())
+	}
+}
+
+func TestLengthLimit(t *testing.T) {
+	var buffer bytes.Buffer
+	w := NewWriter(bufio.NewWriter(&buffer))
+	w.String("longer than the limit")
+	w.Flush()
+
+	r := NewReader(bufio.NewReader(&buffer), 16)
+	if s := r.String(); s != "" || r.Err() == nil {
+		t.Errorf("Expected the length to be rejected, got %q", s)
+	}
+}
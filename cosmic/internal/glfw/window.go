@@ -19,6 +19,10 @@ type glfwWindow struct {
 }
 
 func NewWindow(title string, width, height int, graphicsProps graphics.ContextProperties) *glfwWindow {
+	if graphicsProps.Backend != graphics.BackendVulkan {
+		log.PanicfCore("The %s backend cannot render to windows", graphicsProps.Backend)
+	}
+
 	window := &glfwWindow{
 		title: title,
 		vsync: true,
@@ -43,7 +47,7 @@ func NewWindow(title string, width, height int, graphicsProps graphics.ContextPr
 	}
 
 	window.setCallbacks()
-	window.context = vulkan.NewContext(window.nativeWindow)
+	window.context = vulkan.NewContext(window.nativeWindow, graphicsProps)
 
 	return window
 }
@@ -144,3 +148,7 @@ func (w *glfwWindow) Terminate() {
 	log.DebugCore("Terminating GLFW window")
 	glfw.Terminate()
 }
+
+func (w *glfwWindow) GetContext() graphics.Context {
+	return w.context
+}
@@ -0,0 +1,71 @@
+package software
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/graphics"
+	"github.com/lentus/cosmic-engine/cosmic/log"
+	"image"
+)
+
+// storageBuffer and storageImage keep their contents in memory. They can be
+// created, filled and read back, but the software backend cannot run SPIR-V,
+// so no shader ever writes them.
+type storageBuffer struct {
+	data []byte
+}
+
+func (ctx *Context) CreateStorageBuffer(size uint64) graphics.StorageBuffer {
+	if size == 0 {
+		log.PanicCore("cannot create an empty storage buffer")
+	}
+
+	return &storageBuffer{data: make([]byte, size)}
+}
+
+func (b *storageBuffer) Size() uint64 {
+	return uint64(len(b.data))
+}
+
+func (b *storageBuffer) Write(offset uint64, data []byte) {
+	if offset+uint64(len(data)) > uint64(len(b.data)) {
+		log.PanicfCore("cannot write %d bytes at offset %d to a storage buffer of %d bytes", len(data), offset, len(b.data))
+	}
+	copy(b.data[offset:], data)
+}
+
+func (b *storageBuffer) Read() []byte {
+	data := make([]byte, len(b.data))
+	copy(data, b.data)
+
+	return data
+}
+
+func (b *storageBuffer) Destroy() {}
+
+type storageImage struct {
+	*image.RGBA
+}
+
+func (ctx *Context) CreateStorageImage(width, height int) graphics.StorageImage {
+	if width <= 0 || height <= 0 {
+		log.PanicfCore("invalid storage image size %dx%d", width, height)
+	}
+
+	return storageImage{image.NewRGBA(image.Rect(0, 0, width, height))}
+}
+
+func (img storageImage) Size() (width, height int) {
+	return img.Rect.Dx(), img.Rect.Dy()
+}
+
+func (img storageImage) ReadPixels() *image.RGBA {
+	rgba := image.NewRGBA(img.Rect)
+	copy(rgba.Pix, img.Pix)
+
+	return rgba
+}
+
+func (img storageImage) Destroy() {}
+
+func (ctx *Context) Dispatch(dispatch graphics.Dispatch) {
+	log.PanicfCore("the software backend cannot run compute shaders, dispatch of %s failed", dispatch.Pipeline.Shader.SPIRV)
+}
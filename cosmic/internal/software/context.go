@@ -0,0 +1,111 @@
+package software
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/graphics"
+	"github.com/lentus/cosmic-engine/cosmic/log"
+	"image"
+)
+
+// Context renders on the cpu into an image owned by the context. It
+// implements graphics.OffscreenContext for machines without a Vulkan driver.
+type Context struct {
+	properties graphics.ContextProperties
+	target     target
+	rendered   bool
+
+	// Batches queued for the next frame
+	batches []graphics.Batch2D
+
+	captureRequests []chan *image.RGBA
+}
+
+func NewOffscreenContext(properties graphics.ContextProperties, width, height int) *Context {
+	log.InfoCore("Creating offscreen software graphics context")
+
+	return &Context{
+		properties: properties,
+		target:     newTarget(width, height),
+	}
+}
+
+func (ctx *Context) Render() {
+	ctx.target.clear(clearColor)
+	if len(ctx.batches) > 0 {
+		for _, batch := range ctx.batches {
+			ctx.target.drawBatch2D(batch)
+		}
+		ctx.batches = ctx.batches[:0]
+	} else {
+		ctx.target.drawTriangle(triangle, triangleRaster)
+	}
+	ctx.rendered = true
+
+	for _, request := range ctx.captureRequests {
+		request <- ctx.copyTarget()
+		close(request)
+	}
+	ctx.captureRequests = nil
+}
+
+func (ctx *Context) Terminate() {
+	log.DebugCore("Terminating software graphics context")
+
+	for _, request := range ctx.captureRequests {
+		close(request)
+	}
+	ctx.captureRequests = nil
+}
+
+// SignalFramebufferResized does nothing, software contexts are only resized
+// explicitly.
+func (ctx *Context) SignalFramebufferResized() {}
+
+func (ctx *Context) Adapter() graphics.Adapter {
+	return graphics.Adapter{
+		Name:     "Cosmic software rasterizer",
+		Type:     graphics.AdapterCPU,
+		Vendor:   "Cosmic Engine",
+		Suitable: true,
+	}
+}
+
+// SetSamples only records the requested count, the software rasterizer
+// always renders a single sample per pixel.
+func (ctx *Context) SetSamples(samples int) {
+	ctx.properties.Samples = samples
+}
+
+func (ctx *Context) Samples() int {
+	return graphics.ChooseSampleCount(ctx.properties.Samples, []int{1})
+}
+
+func (ctx *Context) Capture() <-chan *image.RGBA {
+	result := make(chan *image.RGBA, 1)
+	ctx.captureRequests = append(ctx.captureRequests, result)
+
+	return result
+}
+
+func (ctx *Context) Resize(width, height int) {
+	ctx.target = newTarget(width, height)
+	ctx.rendered = false
+}
+
+func (ctx *Context) Size() (width, height int) {
+	return ctx.target.Rect.Dx(), ctx.target.Rect.Dy()
+}
+
+func (ctx *Context) ReadPixels() *image.RGBA {
+	if !ctx.rendered {
+		log.PanicCore("cannot read pixels before the first frame is rendered")
+	}
+
+	return ctx.copyTarget()
+}
+
+func (ctx *Context) copyTarget() *image.RGBA {
+	img := image.NewRGBA(ctx.target.Rect)
+	copy(img.Pix, ctx.target.Pix)
+
+	return img
+}
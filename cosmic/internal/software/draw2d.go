@@ -0,0 +1,162 @@
+package software
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/graphics"
+	"github.com/lentus/cosmic-engine/cosmic/log"
+	"github.com/lentus/cosmic-engine/cosmic/math"
+	"image"
+	stdmath "math"
+)
+
+// texture keeps a copy of the texels, decoded to linear colors once so
+// sampling does not convert them for every pixel.
+type texture struct {
+	width, height int
+	texels        [][4]float32
+	filter        graphics.TextureFilter
+}
+
+// CreateTexture ignores the mipmaps, since textures are sampled from the
+// image alone.
+func (ctx *Context) CreateTexture(img *image.RGBA, filter graphics.TextureFilter, mipmaps ...*image.RGBA) graphics.Texture {
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	if width <= 0 || height <= 0 {
+		log.PanicfCore("invalid texture size %dx%d", width, height)
+	}
+
+	t := &texture{
+		width:  width,
+		height: height,
+		texels: make([][4]float32, 0, width*height),
+		filter: filter,
+	}
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		for x := img.Rect.Min.X; x < img.Rect.Max.X; x++ {
+			offset := img.PixOffset(x, y)
+			t.texels = append(t.texels, decodePixel(img.Pix[offset:offset+4]))
+		}
+	}
+
+	return t
+}
+
+func (t *texture) Size() (width, height int) {
+	return t.width, t.height
+}
+
+func (t *texture) Destroy() {}
+
+// sample returns the linear color at the given texture coordinates, clamped
+// to the edge of the texture.
+func (t *texture) sample(u, v float64) [4]float32 {
+	x, y := u*float64(t.width), v*float64(t.height)
+	if t.filter == graphics.FilterNearest {
+		return t.texel(int(stdmath.Floor(x)), int(stdmath.Floor(y)))
+	}
+
+	// Texel centers are at half coordinates
+	x, y = x-0.5, y-0.5
+	x0, y0 := stdmath.Floor(x), stdmath.Floor(y)
+	fx, fy := float32(x-x0), float32(y-y0)
+	tx, ty := int(x0), int(y0)
+
+	var color [4]float32
+	for c := 0; c < 4; c++ {
+		top := t.texel(tx, ty)[c]*(1-fx) + t.texel(tx+1, ty)[c]*fx
+		bottom := t.texel(tx, ty+1)[c]*(1-fx) + t.texel(tx+1, ty+1)[c]*fx
+		color[c] = top*(1-fy) + bottom*fy
+	}
+
+	return color
+}
+
+func (t *texture) texel(x, y int) [4]float32 {
+	x = clamp(x, 0, t.width-1)
+	y = clamp(y, 0, t.height-1)
+
+	return t.texels[y*t.width+x]
+}
+
+// unusedTexture is sampled by vertices without a valid texture index, like
+// the white texture the Vulkan backend binds to unused slots.
+var unusedTexture = &texture{width: 1, height: 1, texels: [][4]float32{{1, 1, 1, 1}}}
+
+func (ctx *Context) MaxBatchTextures() int {
+	return graphics.MaxBatchTextures
+}
+
+// DrawBatch2D counts a batch as a single draw call, since the rasterizer
+// draws it in one pass whatever textures its triangles sample.
+func (ctx *Context) DrawBatch2D(batch graphics.Batch2D) int {
+	if len(batch.Textures) > graphics.MaxBatchTextures {
+		log.PanicfCore("a batch can use at most %d textures, got %d", graphics.MaxBatchTextures, len(batch.Textures))
+	}
+	if len(batch.Indices) == 0 {
+		return 0
+	}
+
+	ctx.batches = append(ctx.batches, batch)
+	return 1
+}
+
+// drawBatch2D draws the triangles of a batch in index order. Like flat shader
+// inputs, the texture index is taken from the first vertex of each triangle.
+func (t target) drawBatch2D(batch graphics.Batch2D) {
+	textures := make([]*texture, graphics.MaxBatchTextures)
+	for i := range textures {
+		textures[i] = unusedTexture
+		if i < len(batch.Textures) {
+			if tex, ok := batch.Textures[i].(*texture); ok {
+				textures[i] = tex
+			} else {
+				log.WarnfCore("Batch texture %d was not created by the software context", i)
+			}
+		}
+	}
+
+	for i := 0; i+2 < len(batch.Indices); i += 3 {
+		var corners [3]graphics.Vertex2D
+		var x, y [3]float32
+		for c := range corners {
+			corners[c] = batch.Vertices[batch.Indices[i+c]]
+			position := batch.ViewProjection.MulVec4(math.Vec4{X: corners[c].Position.X, Y: corners[c].Position.Y, W: 1})
+			x[c], y[c] = position.X/position.W, position.Y/position.W
+		}
+
+		tex := unusedTexture
+		if index := corners[0].Texture; index < uint32(len(textures)) {
+			tex = textures[index]
+		}
+
+		t.rasterize(x, y, graphics.RasterState{CullMode: graphics.CullNone}, func(px, py int, weights [3]float64) {
+			var u, v float64
+			var color [4]float32
+			for c := range corners {
+				u += weights[c] * float64(corners[c].UV.X)
+				v += weights[c] * float64(corners[c].UV.Y)
+				for k := 0; k < 4; k++ {
+					color[k] += float32(weights[c]) * corners[c].Color[k]
+				}
+			}
+
+			texel := tex.sample(u, v)
+			for k := range color {
+				color[k] *= texel[k]
+			}
+
+			t.setPixel(px, py, blendAlpha(color, t.pixel(px, py)))
+		})
+	}
+}
+
+// blendAlpha matches graphics.BlendAlpha: colors are weighted by the source
+// alpha and alpha accumulates coverage.
+func blendAlpha(src, dst [4]float32) [4]float32 {
+	a := saturate(src[3])
+	return [4]float32{
+		src[0]*a + dst[0]*(1-a),
+		src[1]*a + dst[1]*(1-a),
+		src[2]*a + dst[2]*(1-a),
+		a + dst[3]*(1-a),
+	}
+}
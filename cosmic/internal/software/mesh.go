@@ -0,0 +1,39 @@
+package software
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/graphics"
+	"github.com/lentus/cosmic-engine/cosmic/log"
+)
+
+// meshBuffers keep a copy of the mesh, the software rasterizer does not draw
+// meshes.
+type meshBuffers struct {
+	vertices []byte
+	indices  []uint32
+	stride   int
+}
+
+func (ctx *Context) UploadMesh(vertices []byte, stride int, indices []uint32) graphics.MeshBuffers {
+	if stride <= 0 || len(vertices) == 0 || len(vertices)%stride != 0 {
+		log.PanicfCore("invalid mesh of %d bytes with a vertex stride of %d", len(vertices), stride)
+	}
+	if len(indices) == 0 {
+		log.PanicCore("cannot upload a mesh without indices")
+	}
+
+	return &meshBuffers{
+		vertices: append([]byte(nil), vertices...),
+		indices:  append([]uint32(nil), indices...),
+		stride:   stride,
+	}
+}
+
+func (m *meshBuffers) VertexCount() int {
+	return len(m.vertices) / m.stride
+}
+
+func (m *meshBuffers) IndexCount() int {
+	return len(m.indices)
+}
+
+func (m *meshBuffers) Destroy() {}
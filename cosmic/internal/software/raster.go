@@ -0,0 +1,209 @@
+package software
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/graphics"
+	"image"
+	"math"
+)
+
+// vertex is a vertex after the vertex stage, in normalized device coordinates.
+type vertex struct {
+	x, y  float32
+	color [3]float32
+}
+
+// target is an sRGB encoded color image with a linear color interface, like
+// the R8G8B8A8_SRGB images the Vulkan backend renders to.
+type target struct {
+	*image.RGBA
+}
+
+func newTarget(width, height int) target {
+	return target{image.NewRGBA(image.Rect(0, 0, width, height))}
+}
+
+func (t target) clear(color [4]float32) {
+	pixel := encodePixel(color)
+	for i := 0; i < len(t.Pix); i += 4 {
+		copy(t.Pix[i:i+4], pixel[:])
+	}
+}
+
+// drawTriangle rasterizes a triangle following the Vulkan rasterization rules
+// with a viewport covering the whole target: pixels are sampled at their
+// centers, edges follow the top-left rule and colors are interpolated in
+// linear space before being encoded.
+func (t target) drawTriangle(vertices [3]vertex, raster graphics.RasterState) {
+	var x, y [3]float32
+	for i, v := range vertices {
+		x[i], y[i] = v.x, v.y
+	}
+
+	t.rasterize(x, y, raster, func(px, py int, weights [3]float64) {
+		var color [4]float32
+		for c := 0; c < 3; c++ {
+			color[c] = float32(weights[0]*float64(vertices[0].color[c]) +
+				weights[1]*float64(vertices[1].color[c]) +
+				weights[2]*float64(vertices[2].color[c]))
+		}
+		color[3] = 1
+
+		t.setPixel(px, py, color)
+	})
+}
+
+// rasterize calls shade for every pixel covered by the triangle with the
+// given corners in normalized device coordinates. The weights are the
+// barycentric coordinates of the pixel center, for the corners in the given
+// order.
+func (t target) rasterize(ndcX, ndcY [3]float32, raster graphics.RasterState, shade func(px, py int, weights [3]float64)) {
+	width, height := t.Rect.Dx(), t.Rect.Dy()
+
+	var x, y [3]float64
+	for i := range x {
+		x[i] = (float64(ndcX[i]) + 1) / 2 * float64(width)
+		y[i] = (float64(ndcY[i]) + 1) / 2 * float64(height)
+	}
+
+	// Twice the signed area, which is positive for triangles that are
+	// clockwise in framebuffer coordinates, where y points down
+	area := (x[1]-x[0])*(y[2]-y[0]) - (x[2]-x[0])*(y[1]-y[0])
+	if area == 0 {
+		return
+	}
+	clockwise := area > 0
+	if culled(clockwise, raster) {
+		return
+	}
+
+	// Order the corners clockwise, so points inside have positive edge
+	// functions
+	order := [3]int{0, 1, 2}
+	if area < 0 {
+		x[1], x[2] = x[2], x[1]
+		y[1], y[2] = y[2], y[1]
+		order[1], order[2] = order[2], order[1]
+		area = -area
+	}
+
+	minX := clamp(int(math.Floor(math.Min(x[0], math.Min(x[1], x[2])))), 0, width)
+	maxX := clamp(int(math.Ceil(math.Max(x[0], math.Max(x[1], x[2])))), 0, width)
+	minY := clamp(int(math.Floor(math.Min(y[0], math.Min(y[1], y[2])))), 0, height)
+	maxY := clamp(int(math.Ceil(math.Max(y[0], math.Max(y[1], y[2])))), 0, height)
+
+	for py := minY; py < maxY; py++ {
+		for px := minX; px < maxX; px++ {
+			sx, sy := float64(px)+0.5, float64(py)+0.5
+
+			var weights [3]float64
+			inside := true
+			for i := 0; i < 3; i++ {
+				// The edge opposite of corner i
+				ax, ay := x[(i+1)%3], y[(i+1)%3]
+				bx, by := x[(i+2)%3], y[(i+2)%3]
+
+				w := (bx-ax)*(sy-ay) - (by-ay)*(sx-ax)
+				if w < 0 || (w == 0 && !topLeft(ax, ay, bx, by)) {
+					inside = false
+					break
+				}
+				weights[order[i]] = w / area
+			}
+			if inside {
+				shade(px, py, weights)
+			}
+		}
+	}
+}
+
+func (t target) setPixel(px, py int, color [4]float32) {
+	pixel := encodePixel(color)
+	offset := t.PixOffset(px, py)
+	copy(t.Pix[offset:offset+4], pixel[:])
+}
+
+// pixel returns the linear color of a pixel.
+func (t target) pixel(px, py int) [4]float32 {
+	offset := t.PixOffset(px, py)
+	return decodePixel(t.Pix[offset : offset+4])
+}
+
+func culled(clockwise bool, raster graphics.RasterState) bool {
+	front := clockwise == (raster.FrontFace == graphics.FrontFaceClockwise)
+
+	switch raster.CullMode {
+	case graphics.CullBack:
+		return !front
+	case graphics.CullFront:
+		return front
+	default:
+		return false
+	}
+}
+
+// topLeft reports whether the edge from a to b is a top or left edge of a
+// clockwise triangle, which own the samples exactly on them.
+func topLeft(ax, ay, bx, by float64) bool {
+	dx, dy := bx-ax, by-ay
+	return (dy == 0 && dx > 0) || dy < 0
+}
+
+func clamp(value, min, max int) int {
+	if value < min {
+		return min
+	}
+	if value > max {
+		return max
+	}
+	return value
+}
+
+func encodePixel(color [4]float32) [4]uint8 {
+	return [4]uint8{
+		encodeSRGB(color[0]),
+		encodeSRGB(color[1]),
+		encodeSRGB(color[2]),
+		uint8(math.Round(float64(saturate(color[3])) * 255)),
+	}
+}
+
+func decodePixel(pixel []uint8) [4]float32 {
+	return [4]float32{
+		decodeSRGB(pixel[0]),
+		decodeSRGB(pixel[1]),
+		decodeSRGB(pixel[2]),
+		float32(pixel[3]) / 255,
+	}
+}
+
+// decodeSRGB converts an 8 bit sRGB value to a linear color component.
+func decodeSRGB(encoded uint8) float32 {
+	c := float64(encoded) / 255
+	if c <= 0.04045 {
+		return float32(c / 12.92)
+	}
+
+	return float32(math.Pow((c+0.055)/1.055, 2.4))
+}
+
+// encodeSRGB converts a linear color component to an 8 bit sRGB value.
+func encodeSRGB(linear float32) uint8 {
+	c := float64(saturate(linear))
+	if c <= 0.0031308 {
+		c *= 12.92
+	} else {
+		c = 1.055*math.Pow(c, 1/2.4) - 0.055
+	}
+
+	return uint8(math.Round(c * 255))
+}
+
+func saturate(value float32) float32 {
+	if value < 0 {
+		return 0
+	}
+	if value > 1 {
+		return 1
+	}
+	return value
+}
@@ -0,0 +1,80 @@
+package software
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/graphics"
+	"testing"
+)
+
+func TestEncodeSRGB(t *testing.T) {
+	tests := map[float32]uint8{
+		0:    0,
+		1:    255,
+		0.5:  188,
+		0.2:  124,
+		-1:   0,
+		2:    255,
+		0.01: 25,
+	}
+
+	for linear, expected := range tests {
+		if encoded := encodeSRGB(linear); encoded != expected {
+			t.Errorf("encodeSRGB(%v): expected %d, got %d", linear, expected, encoded)
+		}
+	}
+}
+
+func TestDrawTriangle_sharedEdge(t *testing.T) {
+	// Two triangles covering the target exactly must cover every pixel once,
+	// which the top-left rule guarantees for the samples on the diagonal
+	white := [3]float32{1, 1, 1}
+	first := [3]vertex{{-1, -1, white}, {1, -1, white}, {-1, 1, white}}
+	second := [3]vertex{{1, -1, white}, {1, 1, white}, {-1, 1, white}}
+	raster := graphics.RasterState{CullMode: graphics.CullNone}
+
+	covered := make(map[int]int)
+	for _, triangle := range [][3]vertex{first, second} {
+		target := newTarget(8, 8)
+		target.drawTriangle(triangle, raster)
+
+		for i := 0; i < len(target.Pix); i += 4 {
+			if target.Pix[i+3] != 0 {
+				covered[i/4]++
+			}
+		}
+	}
+
+	for pixel := 0; pixel < 64; pixel++ {
+		if covered[pixel] != 1 {
+			t.Errorf("pixel %d covered %d times", pixel, covered[pixel])
+		}
+	}
+}
+
+func TestDrawTriangle_culling(t *testing.T) {
+	white := [3]float32{1, 1, 1}
+	// Clockwise in framebuffer coordinates
+	clockwise := [3]vertex{{-1, -1, white}, {1, -1, white}, {-1, 1, white}}
+	counterClockwise := [3]vertex{clockwise[0], clockwise[2], clockwise[1]}
+
+	tests := []struct {
+		name     string
+		vertices [3]vertex
+		raster   graphics.RasterState
+		drawn    bool
+	}{
+		{"front clockwise", clockwise, graphics.RasterState{CullMode: graphics.CullBack, FrontFace: graphics.FrontFaceClockwise}, true},
+		{"back clockwise", counterClockwise, graphics.RasterState{CullMode: graphics.CullBack, FrontFace: graphics.FrontFaceClockwise}, false},
+		{"front counter-clockwise", counterClockwise, graphics.RasterState{CullMode: graphics.CullBack, FrontFace: graphics.FrontFaceCounterClockwise}, true},
+		{"cull front", clockwise, graphics.RasterState{CullMode: graphics.CullFront, FrontFace: graphics.FrontFaceClockwise}, false},
+		{"cull none", counterClockwise, graphics.RasterState{CullMode: graphics.CullNone}, true},
+	}
+
+	for _, test := range tests {
+		target := newTarget(4, 4)
+		target.drawTriangle(test.vertices, test.raster)
+
+		if drawn := target.Pix[3] != 0; drawn != test.drawn {
+			t.Errorf("%s: expected drawn to be %t, got %t", test.name, test.drawn, drawn)
+		}
+	}
+}
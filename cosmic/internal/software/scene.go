@@ -0,0 +1,20 @@
+package software
+
+import "github.com/lentus/cosmic-engine/cosmic/graphics"
+
+// The scene drawn by the renderer. It mirrors the built-in shaders and clear
+// color of the Vulkan backend, so both backends render the same image.
+var (
+	clearColor = [4]float32{0.8, 0.2, 0.2, 1.0}
+
+	triangle = [3]vertex{
+		{x: 0.0, y: -0.5, color: [3]float32{1.0, 0.0, 0.0}},
+		{x: 0.5, y: 0.5, color: [3]float32{0.0, 1.0, 0.0}},
+		{x: -0.5, y: 0.5, color: [3]float32{0.0, 0.0, 1.0}},
+	}
+
+	triangleRaster = graphics.RasterState{
+		CullMode:  graphics.CullBack,
+		FrontFace: graphics.FrontFaceClockwise,
+	}
+)
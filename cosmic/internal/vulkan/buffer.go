@@ -0,0 +1,84 @@
+package vulkan
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/log"
+	"github.com/vulkan-go/vulkan"
+	"unsafe"
+)
+
+// buffer is a buffer with its own device memory.
+type buffer struct {
+	handle vulkan.Buffer
+	memory vulkan.DeviceMemory
+	size   uint64
+}
+
+func (ctx *Context) createBuffer(size uint64, usage vulkan.BufferUsageFlagBits, properties vulkan.MemoryPropertyFlagBits, name string) buffer {
+	bufferCreateInfo := vulkan.BufferCreateInfo{
+		SType:       vulkan.StructureTypeBufferCreateInfo,
+		Size:        vulkan.DeviceSize(size),
+		Usage:       vulkan.BufferUsageFlags(usage),
+		SharingMode: vulkan.SharingModeExclusive,
+	}
+	if usage&vulkan.BufferUsageStorageBufferBit != 0 {
+		bufferCreateInfo.SharingMode, bufferCreateInfo.PQueueFamilyIndices = ctx.computeSharing()
+		bufferCreateInfo.QueueFamilyIndexCount = uint32(len(bufferCreateInfo.PQueueFamilyIndices))
+	}
+
+	buf := buffer{size: size}
+	result := vulkan.CreateBuffer(ctx.device, &bufferCreateInfo, nil, &buf.handle)
+	panicOnError(result, "create "+name)
+	ctx.nameObject(vulkan.ObjectTypeBuffer, unsafe.Pointer(buf.handle), name)
+
+	var memoryRequirements vulkan.MemoryRequirements
+	vulkan.GetBufferMemoryRequirements(ctx.device, buf.handle, &memoryRequirements)
+	memoryRequirements.Deref()
+
+	memoryTypeIndex := ctx.findMemoryTypeIndex(&memoryRequirements, vulkan.MemoryPropertyFlags(properties))
+	if memoryTypeIndex == vulkan.MaxUint32 {
+		log.PanicfCore("Could not find memory type to allocate %s memory", name)
+	}
+
+	memoryAllocateInfo := vulkan.MemoryAllocateInfo{
+		SType:           vulkan.StructureTypeMemoryAllocateInfo,
+		AllocationSize:  memoryRequirements.Size,
+		MemoryTypeIndex: memoryTypeIndex,
+	}
+	result = vulkan.AllocateMemory(ctx.device, &memoryAllocateInfo, nil, &buf.memory)
+	panicOnError(result, "allocate "+name+" memory")
+	result = vulkan.BindBufferMemory(ctx.device, buf.handle, buf.memory, 0)
+	panicOnError(result, "bind "+name+" memory")
+
+	return buf
+}
+
+func (ctx *Context) destroyBuffer(buf buffer) {
+	vulkan.DestroyBuffer(ctx.device, buf.handle, nil)
+	vulkan.FreeMemory(ctx.device, buf.memory, nil)
+}
+
+// read copies the contents of a host visible buffer.
+func (ctx *Context) read(buf buffer) []byte {
+	var mapped unsafe.Pointer
+	result := vulkan.MapMemory(ctx.device, buf.memory, 0, vulkan.DeviceSize(buf.size), 0, &mapped)
+	panicOnError(result, "map buffer memory")
+	defer vulkan.UnmapMemory(ctx.device, buf.memory)
+
+	data := make([]byte, buf.size)
+	copy(data, (*[1 << 31]byte)(mapped)[:buf.size:buf.size])
+
+	return data
+}
+
+// write copies data into a host visible buffer at the given offset.
+func (ctx *Context) write(buf buffer, offset uint64, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+
+	var mapped unsafe.Pointer
+	result := vulkan.MapMemory(ctx.device, buf.memory, vulkan.DeviceSize(offset), vulkan.DeviceSize(len(data)), 0, &mapped)
+	panicOnError(result, "map buffer memory")
+	copy((*[1 << 31]byte)(mapped)[:len(data):len(data)], data)
+	vulkan.UnmapMemory(ctx.device, buf.memory)
+}
@@ -0,0 +1,505 @@
+package vulkan
+
+import (
+	"fmt"
+	"github.com/lentus/cosmic-engine/cosmic/graphics"
+	"github.com/lentus/cosmic-engine/cosmic/internal/vulkan/spirv"
+	"github.com/lentus/cosmic-engine/cosmic/log"
+	"github.com/vulkan-go/vulkan"
+	"strconv"
+	"unsafe"
+)
+
+// computePipeline is a compute pipeline created from a descriptor, together
+// with the layout objects derived from its shader.
+type computePipeline struct {
+	descriptor      graphics.ComputePipelineDescriptor
+	handle          vulkan.Pipeline
+	layout          vulkan.PipelineLayout
+	setLayouts      []vulkan.DescriptorSetLayout
+	shaderInterface *pipelineInterface
+}
+
+func (p *computePipeline) shaders() []shaderSource {
+	return []shaderSource{toShaderSource(p.descriptor.Shader)}
+}
+
+// computeFrame holds the resources of one batch of dispatches, which are
+// reused once the fence of the batch is signalled.
+type computeFrame struct {
+	commandBuffer  vulkan.CommandBuffer
+	descriptorPool vulkan.DescriptorPool
+	fence          vulkan.Fence
+
+	// Signalled when the batch completes, and waited for by the frame the
+	// batch was submitted for
+	semaphore vulkan.Semaphore
+}
+
+// asyncCompute reports whether dispatches run on a dedicated queue rather
+// than on the graphics queue.
+func (ctx *Context) asyncCompute() bool {
+	return ctx.computeFamily != ctx.gpu.queueFamilies.graphicsIndex
+}
+
+// computeSharing returns the sharing mode of storage resources, which are
+// accessed from both the compute and the graphics queue.
+func (ctx *Context) computeSharing() (vulkan.SharingMode, []uint32) {
+	if !ctx.asyncCompute() {
+		return vulkan.SharingModeExclusive, nil
+	}
+
+	return vulkan.SharingModeConcurrent, []uint32{ctx.gpu.queueFamilies.graphicsIndex, ctx.computeFamily}
+}
+
+func (ctx *Context) createCompute() {
+	commandPoolCreateInfo := vulkan.CommandPoolCreateInfo{
+		SType:            vulkan.StructureTypeCommandPoolCreateInfo,
+		QueueFamilyIndex: ctx.computeFamily,
+		Flags:            vulkan.CommandPoolCreateFlags(vulkan.CommandPoolCreateResetCommandBufferBit),
+	}
+
+	var commandPool vulkan.CommandPool
+	result := vulkan.CreateCommandPool(ctx.device, &commandPoolCreateInfo, nil, &commandPool)
+	panicOnError(result, "create compute command pool")
+	ctx.computePool = commandPool
+
+	commandBuffers := make([]vulkan.CommandBuffer, maxFramesInFlight)
+	commandBufferAllocateInfo := vulkan.CommandBufferAllocateInfo{
+		SType:              vulkan.StructureTypeCommandBufferAllocateInfo,
+		CommandPool:        ctx.computePool,
+		Level:              vulkan.CommandBufferLevelPrimary,
+		CommandBufferCount: uint32(len(commandBuffers)),
+	}
+	result = vulkan.AllocateCommandBuffers(ctx.device, &commandBufferAllocateInfo, commandBuffers)
+	panicOnError(result, "allocate compute command buffers")
+
+	for i := range ctx.computeFrames {
+		frame := &ctx.computeFrames[i]
+		frame.commandBuffer = commandBuffers[i]
+		frame.fence = ctx.newFence()
+		frame.semaphore = ctx.newSemaphore()
+
+		ctx.nameObject(vulkan.ObjectTypeCommandBuffer, unsafe.Pointer(frame.commandBuffer), "compute commands "+strconv.Itoa(i))
+		ctx.nameObject(vulkan.ObjectTypeFence, unsafe.Pointer(frame.fence), "compute in flight "+strconv.Itoa(i))
+		ctx.nameObject(vulkan.ObjectTypeSemaphore, unsafe.Pointer(frame.semaphore), "compute complete "+strconv.Itoa(i))
+	}
+}
+
+// destroyCompute destroys the compute pipelines and the resources of all
+// batches, which requires the device to be idle.
+func (ctx *Context) destroyCompute() {
+	for key, p := range ctx.computePipelines {
+		ctx.destroyComputePipeline(p)
+		delete(ctx.computePipelines, key)
+	}
+
+	for i := range ctx.computeFrames {
+		frame := &ctx.computeFrames[i]
+		if frame.descriptorPool != vulkan.NullDescriptorPool {
+			vulkan.DestroyDescriptorPool(ctx.device, frame.descriptorPool, nil)
+		}
+		vulkan.DestroyFence(ctx.device, frame.fence, nil)
+		vulkan.DestroySemaphore(ctx.device, frame.semaphore, nil)
+	}
+	vulkan.DestroyCommandPool(ctx.device, ctx.computePool, nil)
+}
+
+// computePipeline returns the compute pipeline for the given descriptor,
+// creating it when it does not exist yet.
+func (ctx *Context) computePipeline(descriptor graphics.ComputePipelineDescriptor) *computePipeline {
+	key := descriptor.Hash()
+	if p, ok := ctx.computePipelines[key]; ok {
+		return p
+	}
+
+	shaderInterface, err := ctx.reflectComputeShader(descriptor)
+	if err != nil {
+		log.PanicfCore("failed to reflect compute pipeline shader: %s", err.Error())
+	}
+
+	p, err := ctx.createComputePipeline(descriptor, shaderInterface)
+	if err != nil {
+		log.PanicfCore("%s", err.Error())
+	}
+	ctx.computePipelines[key] = p
+
+	return p
+}
+
+func (ctx *Context) reflectComputeShader(descriptor graphics.ComputePipelineDescriptor) (*pipelineInterface, error) {
+	stage, err := ctx.reflectShader(toShaderSource(descriptor.Shader), spirv.StageCompute, descriptor.Shader.Constants)
+	if err != nil {
+		return nil, err
+	}
+
+	return reflectPipeline(stage)
+}
+
+// createComputePipeline returns an error when the driver fails to compile the
+// shader into a pipeline, leaving nothing to destroy.
+func (ctx *Context) createComputePipeline(descriptor graphics.ComputePipelineDescriptor, shaderInterface *pipelineInterface) (*computePipeline, error) {
+	p := &computePipeline{descriptor: descriptor, shaderInterface: shaderInterface}
+	name := descriptor.Shader.SPIRV
+
+	shaderModule, err := ctx.createShaderModule(toShaderSource(descriptor.Shader))
+	if err != nil {
+		return nil, err
+	}
+	defer vulkan.DestroyShaderModule(ctx.device, shaderModule, nil)
+
+	p.setLayouts = ctx.createDescriptorSetLayouts(shaderInterface)
+	pipelineLayoutCreateInfo := vulkan.PipelineLayoutCreateInfo{
+		SType:                  vulkan.StructureTypePipelineLayoutCreateInfo,
+		SetLayoutCount:         uint32(len(p.setLayouts)),
+		PSetLayouts:            p.setLayouts,
+		PushConstantRangeCount: uint32(len(shaderInterface.pushConstantRanges)),
+		PPushConstantRanges:    shaderInterface.pushConstantRanges,
+	}
+	var pipelineLayout vulkan.PipelineLayout
+	result := vulkan.CreatePipelineLayout(ctx.device, &pipelineLayoutCreateInfo, nil, &pipelineLayout)
+	panicOnError(result, "create compute pipeline layout")
+	p.layout = pipelineLayout
+	ctx.nameObject(vulkan.ObjectTypePipelineLayout, unsafe.Pointer(pipelineLayout), name)
+
+	pipelineCreateInfo := vulkan.ComputePipelineCreateInfo{
+		SType: vulkan.StructureTypeComputePipelineCreateInfo,
+		Stage: vulkan.PipelineShaderStageCreateInfo{
+			SType:               vulkan.StructureTypePipelineShaderStageCreateInfo,
+			Stage:               vulkan.ShaderStageComputeBit,
+			Module:              shaderModule,
+			PName:               safeStr("main"),
+			PSpecializationInfo: specializationInfo(descriptor.Shader.Constants),
+		},
+		Layout:             pipelineLayout,
+		BasePipelineHandle: nil,
+		BasePipelineIndex:  -1,
+	}
+
+	computePipelines := make([]vulkan.Pipeline, 1)
+	result = vulkan.CreateComputePipelines(
+		ctx.device, ctx.pipelineCache, 1, []vulkan.ComputePipelineCreateInfo{pipelineCreateInfo}, nil, computePipelines,
+	)
+	if err := resultError(result, "create compute pipeline "+name); err != nil {
+		ctx.destroyComputePipeline(p)
+		return nil, err
+	}
+	p.handle = computePipelines[0]
+	ctx.nameObject(vulkan.ObjectTypePipeline, unsafe.Pointer(p.handle), name)
+
+	return p, nil
+}
+
+func (ctx *Context) destroyComputePipeline(p *computePipeline) {
+	if p.handle != vulkan.NullPipeline {
+		vulkan.DestroyPipeline(ctx.device, p.handle, nil)
+	}
+	vulkan.DestroyPipelineLayout(ctx.device, p.layout, nil)
+	for _, setLayout := range p.setLayouts {
+		vulkan.DestroyDescriptorSetLayout(ctx.device, setLayout, nil)
+	}
+}
+
+// rebuildComputePipelines recreates the compute pipelines that use one of the
+// updated shaders, like rebuildPipelines does for graphics pipelines.
+func (ctx *Context) rebuildComputePipelines(updates []shaderUpdate) (int, error) {
+	affected := make(map[uint64]*pipelineInterface)
+	for key, p := range ctx.computePipelines {
+		if !usesShader(p.shaders(), updates) {
+			continue
+		}
+
+		shaderInterface, err := ctx.reflectComputeShader(p.descriptor)
+		if err != nil {
+			return 0, err
+		}
+		affected[key] = shaderInterface
+	}
+
+	if len(affected) == 0 {
+		return 0, nil
+	}
+
+	log.DebugfCore("Rebuilding %d compute pipeline(s) after shader reload", len(affected))
+	rebuilt := make(map[uint64]*computePipeline, len(affected))
+	for key, shaderInterface := range affected {
+		p, err := ctx.createComputePipeline(ctx.computePipelines[key].descriptor, shaderInterface)
+		if err != nil {
+			for _, p := range rebuilt {
+				ctx.destroyComputePipeline(p)
+			}
+			return 0, err
+		}
+		rebuilt[key] = p
+	}
+
+	vulkan.DeviceWaitIdle(ctx.device)
+	for key, p := range rebuilt {
+		ctx.destroyComputePipeline(ctx.computePipelines[key])
+		ctx.computePipelines[key] = p
+	}
+
+	return len(rebuilt), nil
+}
+
+// Dispatch queues a dispatch, which is submitted before the next frame or
+// when the results of a storage resource are read back. The pipeline is
+// created right away, so invalid shaders are reported by the caller.
+func (ctx *Context) Dispatch(dispatch graphics.Dispatch) {
+	p := ctx.computePipeline(dispatch.Pipeline)
+	if err := validateBindings(p.shaderInterface, dispatch.Bindings); err != nil {
+		log.PanicfCore("invalid dispatch of %s: %s", dispatch.Pipeline.Shader.SPIRV, err.Error())
+	}
+
+	ctx.dispatches = append(ctx.dispatches, dispatch)
+}
+
+// validateBindings checks that every binding of a dispatch binds a resource of
+// the kind the shader declares, and that every binding of the shader is bound.
+func validateBindings(shaderInterface *pipelineInterface, bindings []graphics.ComputeBinding) error {
+	bound := make(map[[2]uint32]bool)
+	for _, binding := range bindings {
+		if (binding.Buffer == nil) == (binding.Image == nil) {
+			return fmt.Errorf("set %d, binding %d must bind either a buffer or an image", binding.Set, binding.Binding)
+		}
+
+		layoutBinding, ok := shaderInterface.findBinding(binding.Set, binding.Binding)
+		if !ok {
+			return fmt.Errorf("shader has no set %d, binding %d", binding.Set, binding.Binding)
+		}
+
+		switch layoutBinding.DescriptorType {
+		case vulkan.DescriptorTypeStorageBuffer, vulkan.DescriptorTypeUniformBuffer:
+			if binding.Buffer == nil {
+				return fmt.Errorf("set %d, binding %d requires a buffer", binding.Set, binding.Binding)
+			}
+		case vulkan.DescriptorTypeStorageImage:
+			if binding.Image == nil {
+				return fmt.Errorf("set %d, binding %d requires an image", binding.Set, binding.Binding)
+			}
+		default:
+			return fmt.Errorf("set %d, binding %d has a descriptor type compute dispatches cannot bind", binding.Set, binding.Binding)
+		}
+
+		bound[[2]uint32{binding.Set, binding.Binding}] = true
+	}
+
+	for set, layoutBindings := range shaderInterface.setLayoutBindings {
+		for _, layoutBinding := range layoutBindings {
+			if !bound[[2]uint32{uint32(set), layoutBinding.Binding}] {
+				return fmt.Errorf("set %d, binding %d is not bound", set, layoutBinding.Binding)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (pi *pipelineInterface) findBinding(set, binding uint32) (vulkan.DescriptorSetLayoutBinding, bool) {
+	if set >= uint32(len(pi.setLayoutBindings)) {
+		return vulkan.DescriptorSetLayoutBinding{}, false
+	}
+
+	for _, layoutBinding := range pi.setLayoutBindings[set] {
+		if layoutBinding.Binding == binding {
+			return layoutBinding, true
+		}
+	}
+
+	return vulkan.DescriptorSetLayoutBinding{}, false
+}
+
+// submitCompute records the queued dispatches into the command buffer of the
+// next batch and submits it to the compute queue. Dispatches run in the order
+// they were queued, each seeing the writes of the previous ones. When signal
+// is set, the semaphore of the batch is returned to be waited for by the
+// graphics queue; otherwise the batch is only tracked by its fence.
+func (ctx *Context) submitCompute(signal bool) vulkan.Semaphore {
+	if len(ctx.dispatches) == 0 {
+		return vulkan.NullSemaphore
+	}
+
+	frame := &ctx.computeFrames[ctx.currentComputeFrame]
+	ctx.currentComputeFrame = (ctx.currentComputeFrame + 1) % maxFramesInFlight
+
+	result := vulkan.WaitForFences(ctx.device, 1, []vulkan.Fence{frame.fence}, vulkan.True, uint64(frameTimeout.Nanoseconds()))
+	if result != vulkan.Success {
+		log.PanicfCore("%s while waiting for compute fence", fmtResult(result))
+	}
+
+	if frame.descriptorPool != vulkan.NullDescriptorPool {
+		vulkan.DestroyDescriptorPool(ctx.device, frame.descriptorPool, nil)
+		frame.descriptorPool = vulkan.NullDescriptorPool
+	}
+	frame.descriptorPool = ctx.createComputeDescriptorPool(ctx.dispatches)
+
+	commandBuffer := frame.commandBuffer
+	vulkan.ResetCommandBuffer(commandBuffer, 0)
+	beginInfo := vulkan.CommandBufferBeginInfo{
+		SType: vulkan.StructureTypeCommandBufferBeginInfo,
+		Flags: vulkan.CommandBufferUsageFlags(vulkan.CommandBufferUsageOneTimeSubmitBit),
+	}
+	result = vulkan.BeginCommandBuffer(commandBuffer, &beginInfo)
+	panicOnError(result, "start recording compute command buffer")
+
+	for i, dispatch := range ctx.dispatches {
+		if i > 0 {
+			memoryBarrier(commandBuffer,
+				vulkan.PipelineStageComputeShaderBit, vulkan.AccessShaderWriteBit,
+				vulkan.PipelineStageComputeShaderBit, vulkan.AccessShaderReadBit|vulkan.AccessShaderWriteBit)
+		}
+		ctx.recordDispatch(commandBuffer, frame.descriptorPool, dispatch)
+	}
+
+	// Make the results visible to reads by the host and later transfers
+	memoryBarrier(commandBuffer,
+		vulkan.PipelineStageComputeShaderBit, vulkan.AccessShaderWriteBit,
+		vulkan.PipelineStageHostBit|vulkan.PipelineStageTransferBit, vulkan.AccessHostReadBit|vulkan.AccessTransferReadBit)
+
+	result = vulkan.EndCommandBuffer(commandBuffer)
+	panicOnError(result, "stop recording compute command buffer")
+	ctx.dispatches = nil
+
+	submitInfo := vulkan.SubmitInfo{
+		SType:              vulkan.StructureTypeSubmitInfo,
+		CommandBufferCount: 1,
+		PCommandBuffers:    []vulkan.CommandBuffer{commandBuffer},
+	}
+	if signal {
+		submitInfo.SignalSemaphoreCount = 1
+		submitInfo.PSignalSemaphores = []vulkan.Semaphore{frame.semaphore}
+	}
+
+	vulkan.ResetFences(ctx.device, 1, []vulkan.Fence{frame.fence})
+	result = vulkan.QueueSubmit(ctx.computeQueue, 1, []vulkan.SubmitInfo{submitInfo}, frame.fence)
+	panicOnError(result, "submit compute command buffer")
+
+	if !signal {
+		return vulkan.NullSemaphore
+	}
+	return frame.semaphore
+}
+
+func (ctx *Context) recordDispatch(commandBuffer vulkan.CommandBuffer, descriptorPool vulkan.DescriptorPool, dispatch graphics.Dispatch) {
+	p := ctx.computePipeline(dispatch.Pipeline)
+	ctx.beginLabel(commandBuffer, dispatch.Pipeline.Shader.SPIRV, [4]float32{0.8, 0.5, 0.2, 1})
+
+	vulkan.CmdBindPipeline(commandBuffer, vulkan.PipelineBindPointCompute, p.handle)
+
+	if len(p.setLayouts) > 0 {
+		descriptorSets := make([]vulkan.DescriptorSet, len(p.setLayouts))
+		allocateInfo := vulkan.DescriptorSetAllocateInfo{
+			SType:              vulkan.StructureTypeDescriptorSetAllocateInfo,
+			DescriptorPool:     descriptorPool,
+			DescriptorSetCount: uint32(len(p.setLayouts)),
+			PSetLayouts:        p.setLayouts,
+		}
+		result := vulkan.AllocateDescriptorSets(ctx.device, &allocateInfo, &descriptorSets[0])
+		panicOnError(result, "allocate compute descriptor sets")
+
+		writes := make([]vulkan.WriteDescriptorSet, 0, len(dispatch.Bindings))
+		for _, binding := range dispatch.Bindings {
+			layoutBinding, _ := p.shaderInterface.findBinding(binding.Set, binding.Binding)
+			write := vulkan.WriteDescriptorSet{
+				SType:           vulkan.StructureTypeWriteDescriptorSet,
+				DstSet:          descriptorSets[binding.Set],
+				DstBinding:      binding.Binding,
+				DescriptorCount: 1,
+				DescriptorType:  layoutBinding.DescriptorType,
+			}
+			if binding.Buffer != nil {
+				write.PBufferInfo = []vulkan.DescriptorBufferInfo{{
+					Buffer: binding.Buffer.(*storageBuffer).buffer.handle,
+					Offset: 0,
+					Range:  vulkan.DeviceSize(vulkan.WholeSize),
+				}}
+			} else {
+				write.PImageInfo = []vulkan.DescriptorImageInfo{{
+					ImageView:   binding.Image.(*storageImage).image.view,
+					ImageLayout: vulkan.ImageLayoutGeneral,
+				}}
+			}
+			writes = append(writes, write)
+		}
+		vulkan.UpdateDescriptorSets(ctx.device, uint32(len(writes)), writes, 0, nil)
+
+		vulkan.CmdBindDescriptorSets(commandBuffer, vulkan.PipelineBindPointCompute, p.layout,
+			0, uint32(len(descriptorSets)), descriptorSets, 0, nil)
+	}
+
+	if len(dispatch.PushConstants) > 0 {
+		vulkan.CmdPushConstants(commandBuffer, p.layout, vulkan.ShaderStageFlags(vulkan.ShaderStageComputeBit),
+			0, uint32(len(dispatch.PushConstants)), unsafe.Pointer(&dispatch.PushConstants[0]))
+	}
+
+	groups := dispatch.Groups
+	for i := range groups {
+		if groups[i] == 0 {
+			groups[i] = 1
+		}
+	}
+	vulkan.CmdDispatch(commandBuffer, groups[0], groups[1], groups[2])
+
+	ctx.endLabel(commandBuffer)
+}
+
+// createComputeDescriptorPool creates a pool large enough for the descriptor
+// sets of all given dispatches.
+func (ctx *Context) createComputeDescriptorPool(dispatches []graphics.Dispatch) vulkan.DescriptorPool {
+	var sets uint32
+	counts := make(map[vulkan.DescriptorType]uint32)
+	for _, dispatch := range dispatches {
+		p := ctx.computePipeline(dispatch.Pipeline)
+		sets += uint32(len(p.setLayouts))
+		for _, bindings := range p.shaderInterface.setLayoutBindings {
+			for _, binding := range bindings {
+				counts[binding.DescriptorType] += binding.DescriptorCount
+			}
+		}
+	}
+
+	if sets == 0 {
+		return vulkan.NullDescriptorPool
+	}
+
+	poolSizes := make([]vulkan.DescriptorPoolSize, 0, len(counts))
+	for descriptorType, count := range counts {
+		poolSizes = append(poolSizes, vulkan.DescriptorPoolSize{Type: descriptorType, DescriptorCount: count})
+	}
+
+	createInfo := vulkan.DescriptorPoolCreateInfo{
+		SType:         vulkan.StructureTypeDescriptorPoolCreateInfo,
+		MaxSets:       sets,
+		PoolSizeCount: uint32(len(poolSizes)),
+		PPoolSizes:    poolSizes,
+	}
+
+	var descriptorPool vulkan.DescriptorPool
+	result := vulkan.CreateDescriptorPool(ctx.device, &createInfo, nil, &descriptorPool)
+	panicOnError(result, "create compute descriptor pool")
+
+	return descriptorPool
+}
+
+// waitCompute submits the queued dispatches and waits until all dispatches
+// completed, before storage resources are read back.
+func (ctx *Context) waitCompute() {
+	ctx.submitCompute(false)
+	vulkan.QueueWaitIdle(ctx.computeQueue)
+}
+
+func memoryBarrier(
+	commandBuffer vulkan.CommandBuffer,
+	srcStage vulkan.PipelineStageFlagBits, srcAccess vulkan.AccessFlagBits,
+	dstStage vulkan.PipelineStageFlagBits, dstAccess vulkan.AccessFlagBits,
+) {
+	barrier := vulkan.MemoryBarrier{
+		SType:         vulkan.StructureTypeMemoryBarrier,
+		SrcAccessMask: vulkan.AccessFlags(srcAccess),
+		DstAccessMask: vulkan.AccessFlags(dstAccess),
+	}
+
+	vulkan.CmdPipelineBarrier(commandBuffer,
+		vulkan.PipelineStageFlags(srcStage), vulkan.PipelineStageFlags(dstStage),
+		0, 1, []vulkan.MemoryBarrier{barrier}, 0, nil, 0, nil)
+}
@@ -1,17 +1,29 @@
 package vulkan
 
 import (
+	"github.com/lentus/cosmic-engine/cosmic/graphics"
+	"github.com/lentus/cosmic-engine/cosmic/graphics/rendergraph"
 	"github.com/lentus/cosmic-engine/cosmic/log"
 	"github.com/vulkan-go/glfw/v3.3/glfw"
 	"github.com/vulkan-go/vulkan"
+	stdimage "image"
 	"strconv"
 	"time"
+	"unsafe"
 )
 
 const maxFramesInFlight = 2
 
+// How long to wait for a frame before assuming the gpu hangs.
+const frameTimeout = time.Second
+
 type Context struct {
 	nativeWindow *glfw.Window
+	properties   graphics.ContextProperties
+
+	// Offscreen contexts render to images owned by the context instead of a
+	// window surface, and do not present them.
+	offscreen bool
 
 	instance vulkan.Instance
 
@@ -20,22 +32,39 @@ type Context struct {
 	device        vulkan.Device
 	graphicsQueue vulkan.Queue
 	presentQueue  vulkan.Queue
+	computeQueue  vulkan.Queue
+	computeFamily uint32
 
-	swapchain            vulkan.Swapchain
-	swapchainImageCount  uint32
-	swapchainImageExtent vulkan.Extent2D
+	swapchain           vulkan.Swapchain
+	swapchainImageCount uint32
 
+	// Format and size of the images rendered to, either the swapchain images
+	// or the offscreen images
+	colorFormat       vulkan.Format
+	imageExtent       vulkan.Extent2D
 	imageResourceSets []imageResourceSet
 
-	pipelineLayout   vulkan.PipelineLayout
-	renderPass       vulkan.RenderPass
-	graphicsPipeline vulkan.Pipeline
+	shaders *shaderLibrary
+
+	renderPass    vulkan.RenderPass
+	pipelines     map[uint64]*pipeline
+	pipelineCache vulkan.PipelineCache
+
+	depthStencilFormat vulkan.Format
+	depthStencil       image
+	stencilAvailable   bool
 
-	depthStencilFormat      vulkan.Format
-	depthStencilImage       vulkan.Image
-	depthStencilImageMemory vulkan.DeviceMemory
-	depthStencilImageView   vulkan.ImageView
-	stencilAvailable        bool
+	// Multisampled images are resolved into the images rendered to at the
+	// end of the render pass
+	samples          vulkan.SampleCountFlagBits
+	samplesChanged   bool
+	multisampleColor image
+
+	// The passes of a frame, recorded into the command buffer of every image
+	frameGraph             *renderGraph
+	frameGraphBackbuffer   rendergraph.ResourceID
+	frameGraphDepthStencil rendergraph.ResourceID
+	framePasses            map[rendergraph.PassID]func(commandBuffer vulkan.CommandBuffer, imageIndex int)
 
 	availableInstanceLayers     []vulkan.LayerProperties
 	availableInstanceExtensions []vulkan.ExtensionProperties
@@ -44,77 +73,163 @@ type Context struct {
 	enabledInstanceExtensions   []string
 	enabledDeviceExtensions     []string
 
-	debugCallback vulkan.DebugReportCallback
+	debug *debugUtils
 
 	commandPool vulkan.CommandPool
 
+	// Dispatches are recorded into the command buffer of a compute frame
+	// when they are submitted, before the frame that uses their results
+	computePool         vulkan.CommandPool
+	computePipelines    map[uint64]*computePipeline
+	computeFrames       [maxFramesInFlight]computeFrame
+	currentComputeFrame int
+	dispatches          []graphics.Dispatch
+
+	// 2D batches queued for the next frame, and those uploaded for the frame
+	// being recorded
+	batches         []preparedBatch
+	preparedBatches []preparedBatch
+	drawFrames      [maxFramesInFlight]drawFrame
+	unusedTexture   *texture
+	// Textures a batch can use, the length of the texture array of the
+	// sprite shader
+	maxBatchTextures int
+
 	imageAvailableSemaphores []vulkan.Semaphore
 	renderCompleteSemaphores []vulkan.Semaphore
 	frameInFlightFences      []vulkan.Fence
 	imagesInFlightFences     []vulkan.Fence
 	currentFrame             int
 	framebufferResized       bool
+	rendered                 bool
+
+	captureSupported bool
+	captureRequests  []chan *stdimage.RGBA
+	captures         []*capture
 }
 
-func NewContext(nativeWindow *glfw.Window) *Context {
+func NewContext(nativeWindow *glfw.Window, properties graphics.ContextProperties) *Context {
 	log.InfoCore("Creating Vulkan graphics context")
 
 	if !glfw.VulkanSupported() {
 		log.PanicCore("glfw reports that Vulkan is not supported, aborting")
 	}
 
-	ctx := Context{
-		nativeWindow:              nativeWindow,
-		enabledInstanceLayers:     make([]string, 0),
-		enabledInstanceExtensions: make([]string, 0),
-		enabledDeviceExtensions:   make([]string, 0),
-	}
+	ctx := newContext(properties)
+	ctx.nativeWindow = nativeWindow
 	ctx.nativeWindow.MakeContextCurrent()
 
-	vulkan.SetGetInstanceProcAddr(glfw.GetVulkanGetInstanceProcAddress())
-	if err := vulkan.Init(); err != nil {
-		log.PanicfCore("failed to initialise Vulkan, %s", err.Error())
-	}
+	initVulkan(glfw.GetVulkanGetInstanceProcAddress())
 
 	ctx.setupLayersAndExtensions()
 	ctx.setupDebug()
 	ctx.createVulkanInstance()
-	ctx.initDebugCallback()
+	ctx.initDebugUtils()
 	ctx.createSurface()
 	ctx.selectPhysicalDevice()
 	ctx.createLogicalDevice()
 	ctx.createSwapchain()
 	ctx.createSwapchainImages()
+	ctx.createRenderer()
+
+	return ctx
+}
+
+// NewOffscreenContext creates a context that renders into images of the
+// given size instead of a window. No window library or presentation support
+// is required, so it works on headless machines with a software Vulkan
+// implementation such as lavapipe.
+func NewOffscreenContext(properties graphics.ContextProperties, width, height int) *Context {
+	log.InfoCore("Creating offscreen Vulkan graphics context")
+
+	ctx := newContext(properties)
+	ctx.offscreen = true
+	ctx.captureSupported = true
+	ctx.imageExtent = vulkan.Extent2D{Width: uint32(width), Height: uint32(height)}
+
+	initVulkan(nil)
+
+	ctx.setupLayersAndExtensions()
+	ctx.setupDebug()
+	ctx.createVulkanInstance()
+	ctx.initDebugUtils()
+	ctx.selectPhysicalDevice()
+	ctx.createLogicalDevice()
+	ctx.createOffscreenImages()
+	ctx.createRenderer()
+
+	return ctx
+}
+
+func newContext(properties graphics.ContextProperties) *Context {
+	return &Context{
+		properties:                properties,
+		pipelines:                 make(map[uint64]*pipeline),
+		computePipelines:          make(map[uint64]*computePipeline),
+		enabledInstanceLayers:     make([]string, 0),
+		enabledInstanceExtensions: make([]string, 0),
+		enabledDeviceExtensions:   make([]string, 0),
+	}
+}
 
-	// Graphics pipeline
+// createRenderer creates everything needed to render to the images of the
+// context, once these images exist.
+func (ctx *Context) createRenderer() {
+	ctx.shaders = newShaderLibrary(ctx.properties.ShaderDirectory, ctx.properties.ShaderFS, ctx.properties.HotReloadShaders)
+	ctx.createPipelineCache()
+	ctx.pickDepthStencilFormat()
+	ctx.pickSampleCount()
+	ctx.createDepthStencilImage()
+	ctx.createMultisampleImage()
 	ctx.createRenderPass()
-	ctx.createGraphicsPipeline()
 	ctx.createFramebuffers()
 
 	ctx.createCommandPool()
 	ctx.createCommandBuffers()
 	ctx.createSynchronizations()
+	ctx.createCompute()
+	ctx.createDrawer2D()
 
-	return &ctx
+	ctx.reportValidationErrors()
 }
 
 func (ctx *Context) Terminate() {
 	log.DebugCore("Terminating Vulkan graphics context")
 
-	// cleanupSwapchain is responsible to wait for the gpu to be idle
-	ctx.cleanupSwapchain()
+	// cleanupRenderTargets is responsible to wait for the gpu to be idle, and
+	// finishes captures that are still in flight
+	ctx.cleanupRenderTargets()
+	for _, request := range ctx.captureRequests {
+		close(request)
+	}
+	ctx.captureRequests = nil
+	ctx.destroyCompute()
+	ctx.destroyDrawer2D()
+	ctx.destroyPipelines()
+	vulkan.DestroyRenderPass(ctx.device, ctx.renderPass, nil)
+	ctx.savePipelineCache()
+	vulkan.DestroyPipelineCache(ctx.device, ctx.pipelineCache, nil)
+	ctx.shaders.terminate()
 	ctx.destroySynchronizations()
 	vulkan.DestroyCommandPool(ctx.device, ctx.commandPool, nil)
-	vulkan.DestroySurface(ctx.instance, ctx.surface.ref, nil)
+	if !ctx.offscreen {
+		vulkan.DestroySurface(ctx.instance, ctx.surface.ref, nil)
+	}
 	vulkan.DestroyDevice(ctx.device, nil)
-	vulkan.DestroyDebugReportCallback(ctx.instance, ctx.debugCallback, nil)
+	ctx.destroyDebugUtils()
 	vulkan.DestroyInstance(ctx.instance, nil)
+
+	ctx.reportValidationErrors()
 }
 
 func (ctx *Context) SignalFramebufferResized() {
 	ctx.framebufferResized = true
 }
 
+func (ctx *Context) Adapter() graphics.Adapter {
+	return ctx.gpu.adapter
+}
+
 func (ctx *Context) createVulkanInstance() {
 	log.DebugCore("Creating Vulkan instance")
 
@@ -153,6 +268,13 @@ func (ctx *Context) createLogicalDevice() {
 		queueFamilyIndices = append(queueFamilyIndices, ctx.gpu.queueFamilies.presentIndex)
 	}
 
+	ctx.computeFamily = ctx.gpu.queueFamilies.graphicsIndex
+	if ctx.properties.AsyncCompute && ctx.gpu.queueFamilies.hasAsyncComputeIndex {
+		log.DebugfCore("Using queue family %d for async compute", ctx.gpu.queueFamilies.asyncComputeIndex)
+		ctx.computeFamily = ctx.gpu.queueFamilies.asyncComputeIndex
+		queueFamilyIndices = append(queueFamilyIndices, ctx.computeFamily)
+	}
+
 	var queueCreateInfos []vulkan.DeviceQueueCreateInfo
 	for _, queueFamilyIndex := range queueFamilyIndices {
 		queueCreateInfos = append(queueCreateInfos, vulkan.DeviceQueueCreateInfo{
@@ -163,12 +285,14 @@ func (ctx *Context) createLogicalDevice() {
 		})
 	}
 
+	features := enabledFeatures()
 	deviceCreateInfo := vulkan.DeviceCreateInfo{
 		SType:                   vulkan.StructureTypeDeviceCreateInfo,
 		QueueCreateInfoCount:    uint32(len(queueCreateInfos)),
 		PQueueCreateInfos:       queueCreateInfos,
 		EnabledExtensionCount:   uint32(len(ctx.enabledDeviceExtensions)),
 		PpEnabledExtensionNames: ctx.enabledDeviceExtensions,
+		PEnabledFeatures:        []vulkan.PhysicalDeviceFeatures{features},
 	}
 
 	var device vulkan.Device
@@ -183,21 +307,71 @@ func (ctx *Context) createLogicalDevice() {
 	var presentQueue vulkan.Queue
 	vulkan.GetDeviceQueue(ctx.device, ctx.gpu.queueFamilies.presentIndex, 0, &presentQueue)
 	ctx.presentQueue = presentQueue
+
+	var computeQueue vulkan.Queue
+	vulkan.GetDeviceQueue(ctx.device, ctx.computeFamily, 0, &computeQueue)
+	ctx.computeQueue = computeQueue
+
+	ctx.nameObject(vulkan.ObjectTypeDevice, unsafe.Pointer(ctx.device), ctx.gpu.adapter.Name)
+	ctx.nameObject(vulkan.ObjectTypeQueue, unsafe.Pointer(ctx.graphicsQueue), "graphics queue")
+	if ctx.gpu.queueFamilies.hasSeparatePresentQueue() {
+		ctx.nameObject(vulkan.ObjectTypeQueue, unsafe.Pointer(ctx.presentQueue), "present queue")
+	}
+	if ctx.asyncCompute() {
+		ctx.nameObject(vulkan.ObjectTypeQueue, unsafe.Pointer(ctx.computeQueue), "async compute queue")
+	}
 }
 
 func (ctx *Context) createRenderPass() {
-	attachments := make([]vulkan.AttachmentDescription, 1)
+	// The frame graph transitions the image rendered to before and after the
+	// pass, to be presented or read back
+	finalLayout := vulkan.ImageLayoutColorAttachmentOptimal
+
+	// When multisampling, the multisampled color attachment is only needed
+	// during the pass, and is resolved into the image rendered to
+	colorStoreOp := vulkan.AttachmentStoreOpStore
+	if ctx.multisampled() {
+		colorStoreOp = vulkan.AttachmentStoreOpDontCare
+	}
+
+	attachments := make([]vulkan.AttachmentDescription, 2, 3)
 
 	// Color attachment
 	attachments[0] = vulkan.AttachmentDescription{
-		Format:         ctx.surface.format.Format,
-		Samples:        vulkan.SampleCount1Bit,
+		Format:         ctx.colorFormat,
+		Samples:        ctx.samples,
 		LoadOp:         vulkan.AttachmentLoadOpClear,
-		StoreOp:        vulkan.AttachmentStoreOpStore,
+		StoreOp:        colorStoreOp,
 		StencilLoadOp:  vulkan.AttachmentLoadOpDontCare,
 		StencilStoreOp: vulkan.AttachmentStoreOpDontCare,
 		InitialLayout:  vulkan.ImageLayoutUndefined,
-		FinalLayout:    vulkan.ImageLayoutPresentSrc,
+		FinalLayout:    finalLayout,
+	}
+
+	// Depth stencil attachment
+	attachments[1] = vulkan.AttachmentDescription{
+		Format:         ctx.depthStencilFormat,
+		Samples:        ctx.samples,
+		LoadOp:         vulkan.AttachmentLoadOpClear,
+		StoreOp:        vulkan.AttachmentStoreOpDontCare,
+		StencilLoadOp:  vulkan.AttachmentLoadOpClear,
+		StencilStoreOp: vulkan.AttachmentStoreOpDontCare,
+		InitialLayout:  vulkan.ImageLayoutUndefined,
+		FinalLayout:    vulkan.ImageLayoutDepthStencilAttachmentOptimal,
+	}
+
+	// Resolve attachment
+	if ctx.multisampled() {
+		attachments = append(attachments, vulkan.AttachmentDescription{
+			Format:         ctx.colorFormat,
+			Samples:        vulkan.SampleCount1Bit,
+			LoadOp:         vulkan.AttachmentLoadOpDontCare,
+			StoreOp:        vulkan.AttachmentStoreOpStore,
+			StencilLoadOp:  vulkan.AttachmentLoadOpDontCare,
+			StencilStoreOp: vulkan.AttachmentStoreOpDontCare,
+			InitialLayout:  vulkan.ImageLayoutUndefined,
+			FinalLayout:    finalLayout,
+		})
 	}
 
 	colorAttachmentRefs := make([]vulkan.AttachmentReference, 1)
@@ -206,22 +380,41 @@ func (ctx *Context) createRenderPass() {
 		Layout:     vulkan.ImageLayoutColorAttachmentOptimal,
 	}
 
+	depthStencilAttachmentRef := vulkan.AttachmentReference{
+		Attachment: 1,
+		Layout:     vulkan.ImageLayoutDepthStencilAttachmentOptimal,
+	}
+
 	subPasses := make([]vulkan.SubpassDescription, 1)
 	subPasses[0] = vulkan.SubpassDescription{
-		PipelineBindPoint:    vulkan.PipelineBindPointGraphics,
-		ColorAttachmentCount: uint32(len(colorAttachmentRefs)),
-		PColorAttachments:    colorAttachmentRefs,
+		PipelineBindPoint:       vulkan.PipelineBindPointGraphics,
+		ColorAttachmentCount:    uint32(len(colorAttachmentRefs)),
+		PColorAttachments:       colorAttachmentRefs,
+		PDepthStencilAttachment: &depthStencilAttachmentRef,
+	}
+	if ctx.multisampled() {
+		subPasses[0].PResolveAttachments = []vulkan.AttachmentReference{{
+			Attachment: 2,
+			Layout:     vulkan.ImageLayoutColorAttachmentOptimal,
+		}}
 	}
 
-	// Make sure the subpass is not processed before it can write to the color attachment
+	// Make sure the subpass is not processed before it can write to the color
+	// and depth attachments
 	subpassDependencies := make([]vulkan.SubpassDependency, 1)
 	subpassDependencies[0] = vulkan.SubpassDependency{
-		SrcSubpass:    vulkan.SubpassExternal,
-		DstSubpass:    0,
-		SrcStageMask:  vulkan.PipelineStageFlags(vulkan.PipelineStageColorAttachmentOutputBit),
+		SrcSubpass: vulkan.SubpassExternal,
+		DstSubpass: 0,
+		SrcStageMask: vulkan.PipelineStageFlags(
+			vulkan.PipelineStageColorAttachmentOutputBit | vulkan.PipelineStageEarlyFragmentTestsBit,
+		),
 		SrcAccessMask: vulkan.AccessFlags(0),
-		DstStageMask:  vulkan.PipelineStageFlags(vulkan.PipelineStageColorAttachmentOutputBit),
-		DstAccessMask: vulkan.AccessFlags(vulkan.AccessColorAttachmentWriteBit),
+		DstStageMask: vulkan.PipelineStageFlags(
+			vulkan.PipelineStageColorAttachmentOutputBit | vulkan.PipelineStageEarlyFragmentTestsBit,
+		),
+		DstAccessMask: vulkan.AccessFlags(
+			vulkan.AccessColorAttachmentWriteBit | vulkan.AccessDepthStencilAttachmentWriteBit,
+		),
 	}
 
 	renderPassCreateInfo := vulkan.RenderPassCreateInfo{
@@ -238,19 +431,23 @@ func (ctx *Context) createRenderPass() {
 	result := vulkan.CreateRenderPass(ctx.device, &renderPassCreateInfo, nil, &renderPass)
 	panicOnError(result, "create render pass")
 	ctx.renderPass = renderPass
+	ctx.nameObject(vulkan.ObjectTypeRenderPass, unsafe.Pointer(renderPass), "main render pass")
 }
 
 func (ctx *Context) createFramebuffers() {
 	for i := range ctx.imageResourceSets {
-		attachments := []vulkan.ImageView{ctx.imageResourceSets[i].view}
+		attachments := []vulkan.ImageView{ctx.imageResourceSets[i].view, ctx.depthStencil.view}
+		if ctx.multisampled() {
+			attachments = []vulkan.ImageView{ctx.multisampleColor.view, ctx.depthStencil.view, ctx.imageResourceSets[i].view}
+		}
 
 		framebufferCreateInfo := vulkan.FramebufferCreateInfo{
 			SType:           vulkan.StructureTypeFramebufferCreateInfo,
 			RenderPass:      ctx.renderPass,
 			AttachmentCount: uint32(len(attachments)),
 			PAttachments:    attachments,
-			Width:           ctx.surface.capabilities.CurrentExtent.Width,
-			Height:          ctx.surface.capabilities.CurrentExtent.Height,
+			Width:           ctx.imageExtent.Width,
+			Height:          ctx.imageExtent.Height,
 			Layers:          1,
 		}
 
@@ -258,23 +455,30 @@ func (ctx *Context) createFramebuffers() {
 		result := vulkan.CreateFramebuffer(ctx.device, &framebufferCreateInfo, nil, &framebuffer)
 		panicOnError(result, "create framebuffer for swapchain image "+strconv.Itoa(i))
 		ctx.imageResourceSets[i].framebuffer = framebuffer
+		ctx.nameObject(vulkan.ObjectTypeFramebuffer, unsafe.Pointer(framebuffer), "framebuffer "+strconv.Itoa(i))
 	}
 }
 
-func (ctx *Context) cleanupSwapchain() {
+// cleanupRenderTargets destroys everything that depends on the size of the
+// images rendered to.
+func (ctx *Context) cleanupRenderTargets() {
 	vulkan.DeviceWaitIdle(ctx.device)
+	ctx.finishCaptures(0, true)
 
 	ctx.destroyFramebuffers()
 
-	cmdBuffers := make([]vulkan.CommandBuffer, len(ctx.imageResourceSets))
-	for i, resourceSet := range ctx.imageResourceSets {
-		cmdBuffers[i] = resourceSet.commandBuffer
+	ctx.freeCommandBuffers()
+	ctx.destroyRenderGraph(ctx.frameGraph)
+	ctx.frameGraph = nil
+
+	ctx.destroyImage(ctx.depthStencil)
+	ctx.destroyMultisampleImage()
+	if ctx.offscreen {
+		ctx.destroyOffscreenImages()
+	} else {
+		ctx.destroySwapchainImageViews()
+		vulkan.DestroySwapchain(ctx.device, ctx.swapchain, nil) // Destroys swapchain images as well
 	}
-	vulkan.FreeCommandBuffers(ctx.device, ctx.commandPool, 1, cmdBuffers)
-
-	ctx.destroyGraphicsPipeline()
-	ctx.destroySwapchainImageViews()
-	vulkan.DestroySwapchain(ctx.device, ctx.swapchain, nil) // Destroys swapchain images as well
 }
 
 func (ctx *Context) recreateSwapchain() {
@@ -289,14 +493,26 @@ func (ctx *Context) recreateSwapchain() {
 
 	vulkan.DeviceWaitIdle(ctx.device)
 
-	ctx.cleanupSwapchain()
+	ctx.cleanupRenderTargets()
 
+	previousFormat := ctx.colorFormat
 	ctx.createSwapchain()
 	ctx.createSwapchainImages()
-	ctx.createRenderPass()
-	ctx.createGraphicsPipeline()
+	ctx.createDepthStencilImage()
+	ctx.createMultisampleImage()
+
+	// Pipelines only depend on the render pass, not on the swapchain extent,
+	// so they survive a resize unless the surface format changed
+	if ctx.colorFormat != previousFormat {
+		ctx.destroyPipelines()
+		vulkan.DestroyRenderPass(ctx.device, ctx.renderPass, nil)
+		ctx.createRenderPass()
+	}
 	ctx.createFramebuffers()
 	ctx.createCommandBuffers()
+
+	// The number of swapchain images may have changed
+	ctx.imagesInFlightFences = make([]vulkan.Fence, len(ctx.imageResourceSets))
 }
 
 func (ctx *Context) destroyFramebuffers() {
@@ -309,7 +525,8 @@ func (ctx *Context) createCommandPool() {
 	commandPoolCreateInfo := vulkan.CommandPoolCreateInfo{
 		SType:            vulkan.StructureTypeCommandPoolCreateInfo,
 		QueueFamilyIndex: ctx.gpu.queueFamilies.graphicsIndex,
-		Flags:            0,
+		// Command buffers are recorded again when the frame draws batches
+		Flags: vulkan.CommandPoolCreateFlags(vulkan.CommandPoolCreateResetCommandBufferBit),
 	}
 
 	var commandPool vulkan.CommandPool
@@ -318,8 +535,16 @@ func (ctx *Context) createCommandPool() {
 	ctx.commandPool = commandPool
 }
 
+func (ctx *Context) freeCommandBuffers() {
+	cmdBuffers := make([]vulkan.CommandBuffer, len(ctx.imageResourceSets))
+	for i, resourceSet := range ctx.imageResourceSets {
+		cmdBuffers[i] = resourceSet.commandBuffer
+	}
+	vulkan.FreeCommandBuffers(ctx.device, ctx.commandPool, uint32(len(cmdBuffers)), cmdBuffers)
+}
+
 func (ctx *Context) createCommandBuffers() {
-	commandBuffers := make([]vulkan.CommandBuffer, ctx.swapchainImageCount)
+	commandBuffers := make([]vulkan.CommandBuffer, len(ctx.imageResourceSets))
 	commandBufferAllocateInfo := vulkan.CommandBufferAllocateInfo{
 		SType:              vulkan.StructureTypeCommandBufferAllocateInfo,
 		CommandPool:        ctx.commandPool,
@@ -330,44 +555,67 @@ func (ctx *Context) createCommandBuffers() {
 	result := vulkan.AllocateCommandBuffers(ctx.device, &commandBufferAllocateInfo, commandBuffers)
 	panicOnError(result, "allocate command buffers")
 
-	// Record command buffers
+	ctx.buildFrameGraph()
+
 	for i := range ctx.imageResourceSets {
 		ctx.imageResourceSets[i].commandBuffer = commandBuffers[i]
+		ctx.nameObject(vulkan.ObjectTypeCommandBuffer, unsafe.Pointer(commandBuffers[i]), "draw commands "+strconv.Itoa(i))
+		ctx.recordCommandBuffer(i)
+	}
+}
 
-		beginInfo := vulkan.CommandBufferBeginInfo{
-			SType: vulkan.StructureTypeCommandBufferBeginInfo,
-		}
-		result = vulkan.BeginCommandBuffer(ctx.imageResourceSets[i].commandBuffer, &beginInfo)
-		panicOnError(result, "start recording command buffer "+strconv.Itoa(i))
-
-		renderArea := vulkan.Rect2D{
-			Offset: vulkan.Offset2D{X: 0, Y: 0},
-			Extent: vulkan.Extent2D{
-				Width:  ctx.swapchainImageExtent.Width,
-				Height: ctx.swapchainImageExtent.Height,
-			},
-		}
+// recordCommandBuffer records the frame into the command buffer of an image,
+// which must not be in use by the gpu.
+func (ctx *Context) recordCommandBuffer(imageIndex int) {
+	resourceSet := &ctx.imageResourceSets[imageIndex]
 
-		clearValues := make([]vulkan.ClearValue, 1)
-		clearValues[0].SetColor([]float32{0.8, 0.2, 0.2, 1.0})
+	beginInfo := vulkan.CommandBufferBeginInfo{
+		SType: vulkan.StructureTypeCommandBufferBeginInfo,
+	}
+	result := vulkan.BeginCommandBuffer(resourceSet.commandBuffer, &beginInfo)
+	panicOnError(result, "start recording command buffer "+strconv.Itoa(imageIndex))
 
-		renderPassBeginInfo := vulkan.RenderPassBeginInfo{
-			SType:           vulkan.StructureTypeRenderPassBeginInfo,
-			RenderPass:      ctx.renderPass,
-			Framebuffer:     ctx.imageResourceSets[i].framebuffer,
-			RenderArea:      renderArea,
-			ClearValueCount: uint32(len(clearValues)),
-			PClearValues:    clearValues,
-		}
+	ctx.recordFrame(resourceSet.commandBuffer, imageIndex)
+	resourceSet.batchesRecorded = len(ctx.preparedBatches) > 0
+
+	result = vulkan.EndCommandBuffer(resourceSet.commandBuffer)
+	panicOnError(result, "stop recording command buffer "+strconv.Itoa(imageIndex))
+}
 
-		vulkan.CmdBeginRenderPass(ctx.imageResourceSets[i].commandBuffer, &renderPassBeginInfo, vulkan.SubpassContentsInline)
-		vulkan.CmdBindPipeline(ctx.imageResourceSets[i].commandBuffer, vulkan.PipelineBindPointGraphics, ctx.graphicsPipeline)
-		vulkan.CmdDraw(ctx.imageResourceSets[i].commandBuffer, 3, 1, 0, 0)
-		vulkan.CmdEndRenderPass(ctx.imageResourceSets[i].commandBuffer)
+// submitOneTimeCommands records commands into a temporary command buffer,
+// submits it to the given queue and waits for it to complete.
+func (ctx *Context) submitOneTimeCommands(
+	queue vulkan.Queue, commandPool vulkan.CommandPool, name string, record func(commandBuffer vulkan.CommandBuffer),
+) {
+	commandBuffers := make([]vulkan.CommandBuffer, 1)
+	allocateInfo := vulkan.CommandBufferAllocateInfo{
+		SType:              vulkan.StructureTypeCommandBufferAllocateInfo,
+		CommandPool:        commandPool,
+		Level:              vulkan.CommandBufferLevelPrimary,
+		CommandBufferCount: 1,
+	}
+	result := vulkan.AllocateCommandBuffers(ctx.device, &allocateInfo, commandBuffers)
+	panicOnError(result, "allocate "+name+" command buffer")
+	defer vulkan.FreeCommandBuffers(ctx.device, commandPool, 1, commandBuffers)
 
-		result = vulkan.EndCommandBuffer(ctx.imageResourceSets[i].commandBuffer)
-		panicOnError(result, "stop recording command buffer "+strconv.Itoa(i))
+	beginInfo := vulkan.CommandBufferBeginInfo{
+		SType: vulkan.StructureTypeCommandBufferBeginInfo,
+		Flags: vulkan.CommandBufferUsageFlags(vulkan.CommandBufferUsageOneTimeSubmitBit),
 	}
+	result = vulkan.BeginCommandBuffer(commandBuffers[0], &beginInfo)
+	panicOnError(result, "start recording "+name+" command buffer")
+	record(commandBuffers[0])
+	result = vulkan.EndCommandBuffer(commandBuffers[0])
+	panicOnError(result, "stop recording "+name+" command buffer")
+
+	submitInfo := vulkan.SubmitInfo{
+		SType:              vulkan.StructureTypeSubmitInfo,
+		CommandBufferCount: 1,
+		PCommandBuffers:    commandBuffers,
+	}
+	result = vulkan.QueueSubmit(queue, 1, []vulkan.SubmitInfo{submitInfo}, vulkan.NullFence)
+	panicOnError(result, "submit "+name+" command buffer")
+	vulkan.QueueWaitIdle(queue)
 }
 
 func (ctx *Context) createSynchronizations() {
@@ -379,9 +627,13 @@ func (ctx *Context) createSynchronizations() {
 		ctx.imageAvailableSemaphores[i] = ctx.newSemaphore()
 		ctx.renderCompleteSemaphores[i] = ctx.newSemaphore()
 		ctx.frameInFlightFences[i] = ctx.newFence()
+
+		ctx.nameObject(vulkan.ObjectTypeSemaphore, unsafe.Pointer(ctx.imageAvailableSemaphores[i]), "image available "+strconv.Itoa(i))
+		ctx.nameObject(vulkan.ObjectTypeSemaphore, unsafe.Pointer(ctx.renderCompleteSemaphores[i]), "render complete "+strconv.Itoa(i))
+		ctx.nameObject(vulkan.ObjectTypeFence, unsafe.Pointer(ctx.frameInFlightFences[i]), "frame in flight "+strconv.Itoa(i))
 	}
 
-	ctx.imagesInFlightFences = make([]vulkan.Fence, ctx.swapchainImageCount)
+	ctx.imagesInFlightFences = make([]vulkan.Fence, len(ctx.imageResourceSets))
 }
 
 func (ctx *Context) destroySynchronizations() {
@@ -416,8 +668,38 @@ func (ctx *Context) newSemaphore() vulkan.Semaphore {
 	return semaphore
 }
 
+// reloadShaders rebuilds the pipelines using a shader that was changed on
+// disk. Command buffers are recorded with the pipelines bound, so they are
+// recorded again as well.
+func (ctx *Context) reloadShaders() {
+	updates := ctx.shaders.takeUpdates()
+	// Keep the current pipelines when the new shaders do not fit together
+	if _, err := ctx.rebuildComputePipelines(updates); err != nil {
+		log.ErrorfCore("Reloaded shaders are invalid, keeping last good modules - %s", err.Error())
+		ctx.shaders.revert(updates)
+		return
+	}
+	rebuilt, err := ctx.rebuildPipelines(updates)
+	if err != nil {
+		log.ErrorfCore("Reloaded shaders are invalid, keeping last good modules - %s", err.Error())
+		ctx.shaders.revert(updates)
+		return
+	}
+	if rebuilt == 0 {
+		return
+	}
+
+	ctx.freeCommandBuffers()
+	ctx.createCommandBuffers()
+}
+
 func (ctx *Context) Render() {
-	timeout := uint64(10 * time.Millisecond.Nanoseconds())
+	timeout := uint64(frameTimeout.Nanoseconds())
+
+	ctx.reloadShaders()
+	if ctx.samplesChanged {
+		ctx.applySampleCount()
+	}
 
 	// Wait for frame to be presented if still in flight
 	result := vulkan.WaitForFences(
@@ -426,21 +708,25 @@ func (ctx *Context) Render() {
 	if result != vulkan.Success {
 		log.PanicfCore("%s while waiting for frame in flight fence %d", fmtResult(result), ctx.currentFrame)
 	}
+	ctx.finishCaptures(ctx.currentFrame, false)
 
+	// Offscreen contexts always render to their single image
 	var imageIndex uint32
-	result = vulkan.AcquireNextImage(
-		ctx.device, ctx.swapchain, vulkan.MaxUint64, ctx.imageAvailableSemaphores[ctx.currentFrame], vulkan.NullFence, &imageIndex,
-	)
-	if result == vulkan.ErrorOutOfDate {
-		ctx.recreateSwapchain()
-		// Try drawing again next frame
-		return
+	if !ctx.offscreen {
+		result = vulkan.AcquireNextImage(
+			ctx.device, ctx.swapchain, vulkan.MaxUint64, ctx.imageAvailableSemaphores[ctx.currentFrame], vulkan.NullFence, &imageIndex,
+		)
+		if result == vulkan.ErrorOutOfDate {
+			ctx.recreateSwapchain()
+			// Try drawing again next frame
+			return
+		}
+		panicOnError(result, "retrieve active swapchain image index")
 	}
-	panicOnError(result, "retrieve active swapchain image index")
 
-	// Check whether the swapchain image is currently in flight. After the first
-	// ctx.swapchainImageCount frames these will always be filled, but waiting
-	// for fences that were already signalled is just a no-op.
+	// Check whether the image is currently in flight. After the first
+	// len(ctx.imageResourceSets) frames these will always be filled, but
+	// waiting for fences that were already signalled is just a no-op.
 	if ctx.imagesInFlightFences[imageIndex] != nil {
 		result = vulkan.WaitForFences(
 			ctx.device, 1, []vulkan.Fence{ctx.imagesInFlightFences[imageIndex]}, vulkan.True, timeout,
@@ -451,23 +737,65 @@ func (ctx *Context) Render() {
 	}
 	ctx.imagesInFlightFences[imageIndex] = ctx.frameInFlightFences[ctx.currentFrame]
 
-	pipelineStageFlags := vulkan.PipelineStageFlags(vulkan.PipelineStageColorAttachmentOutputBit)
+	// Command buffers drawing batches are recorded for a single frame, the
+	// built-in triangle stays recorded until batches are drawn
+	ctx.prepareBatches()
+	if len(ctx.preparedBatches) > 0 || ctx.imageResourceSets[imageIndex].batchesRecorded {
+		ctx.recordCommandBuffer(int(imageIndex))
+	}
+
+	// Captures are submitted along with the frame, so presentation waits for
+	// the copy to complete
+	commandBuffers := []vulkan.CommandBuffer{ctx.imageResourceSets[imageIndex].commandBuffer}
+	if len(ctx.captureRequests) > 0 && ctx.captureSupported {
+		commandBuffers = append(commandBuffers, ctx.recordCaptures(imageIndex)...)
+	}
+
+	var waitSemaphores []vulkan.Semaphore
+	var waitStages []vulkan.PipelineStageFlags
+	if !ctx.offscreen {
+		waitSemaphores = append(waitSemaphores, ctx.imageAvailableSemaphores[ctx.currentFrame])
+		waitStages = append(waitStages, vulkan.PipelineStageFlags(vulkan.PipelineStageColorAttachmentOutputBit))
+	}
+
+	// Shaders of the frame may read what the queued dispatches write
+	if computeComplete := ctx.submitCompute(true); computeComplete != vulkan.NullSemaphore {
+		waitSemaphores = append(waitSemaphores, computeComplete)
+		waitStages = append(waitStages, vulkan.PipelineStageFlags(
+			vulkan.PipelineStageVertexInputBit|vulkan.PipelineStageVertexShaderBit|vulkan.PipelineStageFragmentShaderBit,
+		))
+	}
+
 	submitInfo := vulkan.SubmitInfo{
-		SType:                vulkan.StructureTypeSubmitInfo,
-		WaitSemaphoreCount:   1,
-		PWaitSemaphores:      []vulkan.Semaphore{ctx.imageAvailableSemaphores[ctx.currentFrame]},
-		PWaitDstStageMask:    []vulkan.PipelineStageFlags{pipelineStageFlags},
-		CommandBufferCount:   1,
-		PCommandBuffers:      []vulkan.CommandBuffer{ctx.imageResourceSets[imageIndex].commandBuffer},
-		SignalSemaphoreCount: 1,
-		PSignalSemaphores:    []vulkan.Semaphore{ctx.renderCompleteSemaphores[ctx.currentFrame]},
+		SType:              vulkan.StructureTypeSubmitInfo,
+		WaitSemaphoreCount: uint32(len(waitSemaphores)),
+		PWaitSemaphores:    waitSemaphores,
+		PWaitDstStageMask:  waitStages,
+		CommandBufferCount: uint32(len(commandBuffers)),
+		PCommandBuffers:    commandBuffers,
+	}
+	if !ctx.offscreen {
+		submitInfo.SignalSemaphoreCount = 1
+		submitInfo.PSignalSemaphores = []vulkan.Semaphore{ctx.renderCompleteSemaphores[ctx.currentFrame]}
 	}
 	vulkan.ResetFences(ctx.device, 1, []vulkan.Fence{ctx.frameInFlightFences[ctx.currentFrame]})
 	result = vulkan.QueueSubmit(
 		ctx.graphicsQueue, 1, []vulkan.SubmitInfo{submitInfo}, ctx.frameInFlightFences[ctx.currentFrame],
 	)
 	panicOnError(result, "submit draw command buffer")
+	ctx.rendered = true
+	ctx.preparedBatches = ctx.preparedBatches[:0]
 
+	if !ctx.offscreen {
+		ctx.present(imageIndex)
+	}
+
+	ctx.currentFrame = (ctx.currentFrame + 1) % maxFramesInFlight
+
+	ctx.reportValidationErrors()
+}
+
+func (ctx *Context) present(imageIndex uint32) {
 	presentInfo := vulkan.PresentInfo{
 		SType:              vulkan.StructureTypePresentInfo,
 		WaitSemaphoreCount: 1,
@@ -476,13 +804,11 @@ func (ctx *Context) Render() {
 		PSwapchains:        []vulkan.Swapchain{ctx.swapchain},
 		PImageIndices:      []uint32{imageIndex},
 	}
-	result = vulkan.QueuePresent(ctx.presentQueue, &presentInfo)
+	result := vulkan.QueuePresent(ctx.presentQueue, &presentInfo)
 	if result == vulkan.ErrorOutOfDate || result == vulkan.Suboptimal || ctx.framebufferResized {
 		ctx.framebufferResized = false
 		ctx.recreateSwapchain()
 	} else if result != vulkan.Success {
 		panicOnError(result, "queue present")
 	}
-
-	ctx.currentFrame = (ctx.currentFrame + 1) % maxFramesInFlight
 }
@@ -1,76 +1,257 @@
 package vulkan
 
+/*
+#include <stdlib.h>
+#include "debugutils.h"
+*/
+import "C"
+
 import (
+	"fmt"
+	"github.com/lentus/cosmic-engine/cosmic/graphics"
 	"github.com/lentus/cosmic-engine/cosmic/log"
 	"github.com/vulkan-go/vulkan"
+	"sync"
 	"unsafe"
 )
 
+// debugUtils holds the VK_EXT_debug_utils functions of an instance and the
+// messenger through which validation messages are received.
+type debugUtils struct {
+	functions  C.cosmicDebugUtils
+	messenger  C.uint64_t
+	id         uintptr
+	properties graphics.ValidationProperties
+
+	errorsMutex sync.Mutex
+	errors      []graphics.DebugMessage
+}
+
+// Messages are delivered to the messenger registered under the id passed as
+// user data, as Go pointers cannot be handed to the driver.
+var (
+	messengersMutex sync.Mutex
+	messengers      = make(map[uintptr]*debugUtils)
+	nextMessengerID uintptr
+)
+
+var severityBits = map[graphics.DebugSeverity]vulkan.DebugUtilsMessageSeverityFlagBits{
+	graphics.SeverityVerbose: vulkan.DebugUtilsMessageSeverityVerboseBit,
+	graphics.SeverityInfo:    vulkan.DebugUtilsMessageSeverityInfoBit,
+	graphics.SeverityWarning: vulkan.DebugUtilsMessageSeverityWarningBit,
+	graphics.SeverityError:   vulkan.DebugUtilsMessageSeverityErrorBit,
+}
+
+var messageTypeBits = map[graphics.DebugMessageType]vulkan.DebugUtilsMessageTypeFlagBits{
+	graphics.MessageGeneral:     vulkan.DebugUtilsMessageTypeGeneralBit,
+	graphics.MessageValidation:  vulkan.DebugUtilsMessageTypeValidationBit,
+	graphics.MessagePerformance: vulkan.DebugUtilsMessageTypePerformanceBit,
+}
+
 func (ctx *Context) setupDebug() {
-	// Setup debug layers
+	validation := ctx.properties.Validation
+	if !validation.Active() {
+		log.DebugCore("Vulkan validation disabled")
+		return
+	}
+
 	ctx.enableLayerIfAvailable("VK_LAYER_KHRONOS_validation")
-	ctx.enableLayerIfAvailable("VK_LAYER_LUNARG_screenshot")
-	ctx.enableLayerIfAvailable("VK_LAYER_LUNARG_monitor")
+	for _, layer := range validation.Layers {
+		ctx.enableLayerIfAvailable(layer)
+	}
 
-	// Setup debug error callback
-	ctx.enabledInstanceExtensions = append(ctx.enabledInstanceExtensions, safeStr(vulkan.ExtDebugReportExtensionName))
+	if !ctx.instanceExtensionAvailable(vulkan.ExtDebugUtilsExtensionName) {
+		log.WarnfCore("Cannot report validation messages, %s is not available", vulkan.ExtDebugUtilsExtensionName)
+		return
+	}
+	ctx.enabledInstanceExtensions = append(ctx.enabledInstanceExtensions, safeStr(vulkan.ExtDebugUtilsExtensionName))
 }
 
-var debugBit = vulkan.DebugReportFlags(vulkan.DebugReportDebugBit)
-var infoBit = vulkan.DebugReportFlags(vulkan.DebugReportInformationBit)
-var warnBit = vulkan.DebugReportFlags(vulkan.DebugReportWarningBit)
-var perfWarnBit = vulkan.DebugReportFlags(vulkan.DebugReportPerformanceWarningBit)
-var errorBit = vulkan.DebugReportFlags(vulkan.DebugReportErrorBit)
-
-func vulkanDebugReportCallback(
-	flags vulkan.DebugReportFlags,
-	objectType vulkan.DebugReportObjectType,
-	_ uint64,
-	_ uint,
-	msgCode int32,
-	layer string,
-	msg string,
-	_ unsafe.Pointer) vulkan.Bool32 {
-
-	fmtString := "Vulkan %s [%s] - %s (code %d)"
-
-	switch {
-	case flags&debugBit != 0:
-		log.DebugfCore(fmtString, layer, fmtObjectType(objectType), msg, msgCode)
-	case flags&infoBit != 0:
-		log.InfofCore(fmtString, layer, fmtObjectType(objectType), msg, msgCode)
-	case flags&warnBit != 0:
-		log.WarnfCore(fmtString, layer, fmtObjectType(objectType), msg, msgCode)
-	case flags&perfWarnBit != 0:
-		log.WarnfCore(fmtString, "<Performance> "+layer, fmtObjectType(objectType), msg, msgCode)
-	case flags&errorBit != 0:
-		log.ErrorfCore(fmtString, layer, fmtObjectType(objectType), msg, msgCode)
-	}
-
-	return vulkan.False
+func (ctx *Context) initDebugUtils() {
+	if !ctx.instanceExtensionEnabled(vulkan.ExtDebugUtilsExtensionName) {
+		return
+	}
+
+	d := &debugUtils{properties: ctx.properties.Validation}
+	loaded := C.cosmicLoadDebugUtils(getInstanceProcAddr, unsafe.Pointer(ctx.instance), &d.functions)
+	if loaded == 0 {
+		log.WarnfCore("Failed to load the %s functions", vulkan.ExtDebugUtilsExtensionName)
+		return
+	}
+
+	// Only request the messages that pass the filter from the driver
+	var severities vulkan.DebugUtilsMessageSeverityFlagBits
+	for severity, bit := range severityBits {
+		if d.properties.Reports(severity, graphics.MessageAll) {
+			severities |= bit
+		}
+	}
+	var messageTypes vulkan.DebugUtilsMessageTypeFlagBits
+	for messageType, bit := range messageTypeBits {
+		if d.properties.Reports(graphics.SeverityError, messageType) {
+			messageTypes |= bit
+		}
+	}
+
+	messengersMutex.Lock()
+	nextMessengerID++
+	d.id = nextMessengerID
+	messengers[d.id] = d
+	messengersMutex.Unlock()
+
+	result := vulkan.Result(C.cosmicCreateDebugUtilsMessenger(
+		&d.functions, unsafe.Pointer(ctx.instance), C.uint32_t(severities), C.uint32_t(messageTypes), C.uintptr_t(d.id), &d.messenger,
+	))
+	panicOnError(result, "create debug utils messenger")
+
+	ctx.debug = d
 }
 
-func (ctx *Context) initDebugCallback() {
-	createInfo := createDebugReportCallbackCreateInfo()
+func (ctx *Context) destroyDebugUtils() {
+	if ctx.debug == nil {
+		return
+	}
+
+	C.cosmicDestroyDebugUtilsMessenger(&ctx.debug.functions, unsafe.Pointer(ctx.instance), ctx.debug.messenger)
 
-	var debugCallback vulkan.DebugReportCallback
-	vulkan.CreateDebugReportCallback(ctx.instance, &createInfo, nil, &debugCallback)
-	ctx.debugCallback = debugCallback
+	messengersMutex.Lock()
+	delete(messengers, ctx.debug.id)
+	messengersMutex.Unlock()
 }
 
-func createDebugReportCallbackCreateInfo() vulkan.DebugReportCallbackCreateInfo {
-	reportFlagBits :=
-		//vulkan.DebugReportDebugBit |
-		//	vulkan.DebugReportInformationBit |
-		vulkan.DebugReportWarningBit |
-			vulkan.DebugReportErrorBit |
-			vulkan.DebugReportPerformanceWarningBit
+//export goDebugUtilsMessage
+func goDebugUtilsMessage(severityBit, typeBits C.uint32_t, data *C.cosmicDebugUtilsMessengerCallbackData, id C.uintptr_t) {
+	messengersMutex.Lock()
+	d, ok := messengers[uintptr(id)]
+	messengersMutex.Unlock()
+	if !ok {
+		return
+	}
+
+	message := graphics.DebugMessage{
+		Message: C.GoString(data.pMessage),
+		ID:      C.GoString(data.pMessageIdName),
+	}
+
+	for severity, bit := range severityBits {
+		if vulkan.DebugUtilsMessageSeverityFlagBits(severityBit)&bit != 0 {
+			message.Severity = severity
+		}
+	}
+	for messageType, bit := range messageTypeBits {
+		if vulkan.DebugUtilsMessageTypeFlagBits(typeBits)&bit != 0 {
+			message.Type |= messageType
+		}
+	}
 
-	createInfo := vulkan.DebugReportCallbackCreateInfo{
-		SType:       vulkan.StructureTypeDebugReportCallbackCreateInfo,
-		Flags:       vulkan.DebugReportFlags(reportFlagBits),
-		PfnCallback: vulkanDebugReportCallback,
+	if !d.properties.Reports(message.Severity, message.Type) {
+		return
 	}
 
-	return createInfo
+	if data.objectCount > 0 {
+		objects := (*[1 << 16]C.cosmicDebugUtilsObjectNameInfo)(unsafe.Pointer(data.pObjects))[:data.objectCount:data.objectCount]
+		for _, object := range objects {
+			name := fmt.Sprintf("0x%x", uint64(object.objectHandle))
+			if object.pObjectName != nil {
+				name = C.GoString(object.pObjectName)
+			}
+			message.Objects = append(message.Objects, fmtObjectType(vulkan.ObjectType(object.objectType))+" "+name)
+		}
+	}
+
+	if data.cmdBufLabelCount > 0 {
+		labels := (*[1 << 16]C.cosmicDebugUtilsLabel)(unsafe.Pointer(data.pCmdBufLabels))[:data.cmdBufLabelCount:data.cmdBufLabelCount]
+		// The driver reports the innermost label first
+		for i := len(labels) - 1; i >= 0; i-- {
+			message.Labels = append(message.Labels, C.GoString(labels[i].pLabelName))
+		}
+	}
+
+	fmtString := "Vulkan %s - %s"
+	switch message.Severity {
+	case graphics.SeverityVerbose:
+		log.DebugfCore(fmtString, message.ID, message)
+	case graphics.SeverityInfo:
+		log.InfofCore(fmtString, message.ID, message)
+	case graphics.SeverityWarning:
+		log.WarnfCore(fmtString, message.ID, message)
+	case graphics.SeverityError:
+		log.ErrorfCore(fmtString, message.ID, message)
+
+		// Messages can arrive on any thread, in the middle of a Vulkan call.
+		// Errors are handed to the application after the frame instead.
+		d.errorsMutex.Lock()
+		d.errors = append(d.errors, message)
+		d.errorsMutex.Unlock()
+	}
+}
+
+// reportValidationErrors passes the validation errors received since the
+// previous call to the error handler of the application.
+func (ctx *Context) reportValidationErrors() {
+	if ctx.debug == nil || ctx.debug.properties.OnError == nil {
+		return
+	}
+
+	ctx.debug.errorsMutex.Lock()
+	errors := ctx.debug.errors
+	ctx.debug.errors = nil
+	ctx.debug.errorsMutex.Unlock()
+
+	for _, message := range errors {
+		ctx.debug.properties.OnError(message)
+	}
+}
+
+// nameObject gives a Vulkan object a name, by which validation messages and
+// graphics debuggers refer to it.
+func (ctx *Context) nameObject(objectType vulkan.ObjectType, handle unsafe.Pointer, name string) {
+	if ctx.debug == nil {
+		return
+	}
+
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+
+	result := vulkan.Result(C.cosmicSetDebugUtilsObjectName(
+		&ctx.debug.functions, unsafe.Pointer(ctx.device), C.int32_t(objectType), C.uint64_t(uintptr(handle)), cName,
+	))
+	if result != vulkan.Success {
+		log.WarnfCore("Failed to name %s %s (%s)", fmtObjectType(objectType), name, fmtResult(result))
+	}
+}
+
+// beginLabel opens a labelled region in a command buffer, which graphics
+// debuggers and validation messages use to show where commands come from.
+func (ctx *Context) beginLabel(commandBuffer vulkan.CommandBuffer, name string, color [4]float32) {
+	if ctx.debug == nil {
+		return
+	}
+
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+
+	C.cosmicCmdBeginDebugUtilsLabel(&ctx.debug.functions, unsafe.Pointer(commandBuffer), cName,
+		C.float(color[0]), C.float(color[1]), C.float(color[2]), C.float(color[3]))
+}
+
+func (ctx *Context) endLabel(commandBuffer vulkan.CommandBuffer) {
+	if ctx.debug == nil {
+		return
+	}
+
+	C.cosmicCmdEndDebugUtilsLabel(&ctx.debug.functions, unsafe.Pointer(commandBuffer))
+}
+
+// insertLabel marks a single point in a command buffer.
+func (ctx *Context) insertLabel(commandBuffer vulkan.CommandBuffer, name string, color [4]float32) {
+	if ctx.debug == nil {
+		return
+	}
+
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+
+	C.cosmicCmdInsertDebugUtilsLabel(&ctx.debug.functions, unsafe.Pointer(commandBuffer), cName,
+		C.float(color[0]), C.float(color[1]), C.float(color[2]), C.float(color[3]))
 }
@@ -0,0 +1,84 @@
+#include "debugutils.h"
+#include "_cgo_export.h"
+
+// Structure types of VK_EXT_debug_utils
+#define COSMIC_STRUCTURE_TYPE_DEBUG_UTILS_OBJECT_NAME_INFO 1000128000
+#define COSMIC_STRUCTURE_TYPE_DEBUG_UTILS_LABEL 1000128002
+#define COSMIC_STRUCTURE_TYPE_DEBUG_UTILS_MESSENGER_CREATE_INFO 1000128004
+
+static uint32_t cosmicDebugUtilsCallback(uint32_t severity, uint32_t types,
+	const cosmicDebugUtilsMessengerCallbackData *data, void *userData) {
+	goDebugUtilsMessage(severity, types, (cosmicDebugUtilsMessengerCallbackData *) data, (uintptr_t) userData);
+
+	// Never abort the call that triggered the message
+	return 0;
+}
+
+int cosmicLoadDebugUtils(void *getInstanceProcAddr, void *instance, cosmicDebugUtils *functions) {
+	cosmicGetInstanceProcAddr load = (cosmicGetInstanceProcAddr) getInstanceProcAddr;
+
+	functions->createMessenger = (void *) load(instance, "vkCreateDebugUtilsMessengerEXT");
+	functions->destroyMessenger = (void *) load(instance, "vkDestroyDebugUtilsMessengerEXT");
+	functions->setObjectName = (void *) load(instance, "vkSetDebugUtilsObjectNameEXT");
+	functions->cmdBeginLabel = (void *) load(instance, "vkCmdBeginDebugUtilsLabelEXT");
+	functions->cmdEndLabel = (void *) load(instance, "vkCmdEndDebugUtilsLabelEXT");
+	functions->cmdInsertLabel = (void *) load(instance, "vkCmdInsertDebugUtilsLabelEXT");
+
+	return functions->createMessenger && functions->destroyMessenger && functions->setObjectName &&
+		functions->cmdBeginLabel && functions->cmdEndLabel && functions->cmdInsertLabel;
+}
+
+int32_t cosmicCreateDebugUtilsMessenger(cosmicDebugUtils *functions, void *instance,
+	uint32_t severities, uint32_t types, uintptr_t id, uint64_t *messenger) {
+	cosmicDebugUtilsMessengerCreateInfo createInfo = {
+		.sType = COSMIC_STRUCTURE_TYPE_DEBUG_UTILS_MESSENGER_CREATE_INFO,
+		.messageSeverity = severities,
+		.messageType = types,
+		.pfnUserCallback = cosmicDebugUtilsCallback,
+		.pUserData = (void *) id,
+	};
+
+	return functions->createMessenger(instance, &createInfo, 0, messenger);
+}
+
+void cosmicDestroyDebugUtilsMessenger(cosmicDebugUtils *functions, void *instance, uint64_t messenger) {
+	functions->destroyMessenger(instance, messenger, 0);
+}
+
+int32_t cosmicSetDebugUtilsObjectName(cosmicDebugUtils *functions, void *device,
+	int32_t objectType, uint64_t handle, const char *name) {
+	cosmicDebugUtilsObjectNameInfo nameInfo = {
+		.sType = COSMIC_STRUCTURE_TYPE_DEBUG_UTILS_OBJECT_NAME_INFO,
+		.objectType = objectType,
+		.objectHandle = handle,
+		.pObjectName = name,
+	};
+
+	return functions->setObjectName(device, &nameInfo);
+}
+
+void cosmicCmdBeginDebugUtilsLabel(cosmicDebugUtils *functions, void *commandBuffer, const char *name,
+	float r, float g, float b, float a) {
+	cosmicDebugUtilsLabel label = {
+		.sType = COSMIC_STRUCTURE_TYPE_DEBUG_UTILS_LABEL,
+		.pLabelName = name,
+		.color = {r, g, b, a},
+	};
+
+	functions->cmdBeginLabel(commandBuffer, &label);
+}
+
+void cosmicCmdEndDebugUtilsLabel(cosmicDebugUtils *functions, void *commandBuffer) {
+	functions->cmdEndLabel(commandBuffer);
+}
+
+void cosmicCmdInsertDebugUtilsLabel(cosmicDebugUtils *functions, void *commandBuffer, const char *name,
+	float r, float g, float b, float a) {
+	cosmicDebugUtilsLabel label = {
+		.sType = COSMIC_STRUCTURE_TYPE_DEBUG_UTILS_LABEL,
+		.pLabelName = name,
+		.color = {r, g, b, a},
+	};
+
+	functions->cmdInsertLabel(commandBuffer, &label);
+}
@@ -0,0 +1,78 @@
+#ifndef COSMIC_DEBUGUTILS_H
+#define COSMIC_DEBUGUTILS_H
+
+#include <stdint.h>
+
+// Minimal declarations of VK_EXT_debug_utils, laid out as in vulkan_core.h.
+// The Go Vulkan bindings do not load the extension's functions, so they are
+// resolved here through vkGetInstanceProcAddr.
+
+typedef void (*cosmicVoidFunction)(void);
+typedef cosmicVoidFunction (*cosmicGetInstanceProcAddr)(void *instance, const char *name);
+
+typedef struct {
+	int32_t sType;
+	const void *pNext;
+	const char *pLabelName;
+	float color[4];
+} cosmicDebugUtilsLabel;
+
+typedef struct {
+	int32_t sType;
+	const void *pNext;
+	int32_t objectType;
+	uint64_t objectHandle;
+	const char *pObjectName;
+} cosmicDebugUtilsObjectNameInfo;
+
+typedef struct {
+	int32_t sType;
+	const void *pNext;
+	uint32_t flags;
+	const char *pMessageIdName;
+	int32_t messageIdNumber;
+	const char *pMessage;
+	uint32_t queueLabelCount;
+	const cosmicDebugUtilsLabel *pQueueLabels;
+	uint32_t cmdBufLabelCount;
+	const cosmicDebugUtilsLabel *pCmdBufLabels;
+	uint32_t objectCount;
+	const cosmicDebugUtilsObjectNameInfo *pObjects;
+} cosmicDebugUtilsMessengerCallbackData;
+
+typedef uint32_t (*cosmicDebugUtilsMessengerCallback)(
+	uint32_t severity, uint32_t types, const cosmicDebugUtilsMessengerCallbackData *data, void *userData);
+
+typedef struct {
+	int32_t sType;
+	const void *pNext;
+	uint32_t flags;
+	uint32_t messageSeverity;
+	uint32_t messageType;
+	cosmicDebugUtilsMessengerCallback pfnUserCallback;
+	void *pUserData;
+} cosmicDebugUtilsMessengerCreateInfo;
+
+typedef struct {
+	int32_t (*createMessenger)(void *instance, const cosmicDebugUtilsMessengerCreateInfo *createInfo,
+		const void *allocator, uint64_t *messenger);
+	void (*destroyMessenger)(void *instance, uint64_t messenger, const void *allocator);
+	int32_t (*setObjectName)(void *device, const cosmicDebugUtilsObjectNameInfo *nameInfo);
+	void (*cmdBeginLabel)(void *commandBuffer, const cosmicDebugUtilsLabel *label);
+	void (*cmdEndLabel)(void *commandBuffer);
+	void (*cmdInsertLabel)(void *commandBuffer, const cosmicDebugUtilsLabel *label);
+} cosmicDebugUtils;
+
+int cosmicLoadDebugUtils(void *getInstanceProcAddr, void *instance, cosmicDebugUtils *functions);
+int32_t cosmicCreateDebugUtilsMessenger(cosmicDebugUtils *functions, void *instance,
+	uint32_t severities, uint32_t types, uintptr_t id, uint64_t *messenger);
+void cosmicDestroyDebugUtilsMessenger(cosmicDebugUtils *functions, void *instance, uint64_t messenger);
+int32_t cosmicSetDebugUtilsObjectName(cosmicDebugUtils *functions, void *device,
+	int32_t objectType, uint64_t handle, const char *name);
+void cosmicCmdBeginDebugUtilsLabel(cosmicDebugUtils *functions, void *commandBuffer, const char *name,
+	float r, float g, float b, float a);
+void cosmicCmdEndDebugUtilsLabel(cosmicDebugUtils *functions, void *commandBuffer);
+void cosmicCmdInsertDebugUtilsLabel(cosmicDebugUtils *functions, void *commandBuffer, const char *name,
+	float r, float g, float b, float a);
+
+#endif
@@ -0,0 +1,421 @@
+package vulkan
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/graphics"
+	"github.com/lentus/cosmic-engine/cosmic/log"
+	"github.com/vulkan-go/vulkan"
+	stdimage "image"
+	"math/bits"
+	"unsafe"
+)
+
+// Most textures a batch uses, however many the device can bind. Every batch
+// binds this many descriptors, so larger batches cost more to prepare than
+// they save.
+const batchTexturesCap = 64
+
+// Specialization constant of the sprite shader sizing its texture array.
+const batchTexturesConstant = 0
+
+// spritePipeline draws 2D batches. Its vertex input matches the memory layout
+// of graphics.Vertex2D, so vertices are uploaded without conversion.
+func (ctx *Context) spritePipeline() graphics.PipelineDescriptor {
+	return graphics.PipelineDescriptor{
+		VertexShader: graphics.ShaderStage{SPIRV: "sprite.vert.spv", GLSL: "sprite.vert"},
+		FragmentShader: graphics.ShaderStage{SPIRV: "sprite.frag.spv", GLSL: "sprite.frag", Constants: []graphics.SpecConstant{
+			{ID: batchTexturesConstant, Value: uint32(ctx.maxBatchTextures)},
+		}},
+		Topology: graphics.TopologyTriangleList,
+		Raster:   graphics.RasterState{CullMode: graphics.CullNone},
+		Blend:    graphics.BlendAlpha,
+	}
+}
+
+const vertex2DSize = uint64(unsafe.Sizeof(graphics.Vertex2D{}))
+
+// texture is a sampled image uploaded once, in the shader read only layout.
+type texture struct {
+	ctx     *Context
+	image   image
+	sampler vulkan.Sampler
+	extent  vulkan.Extent2D
+}
+
+// drawFrame holds the geometry and descriptor sets of the batches drawn in
+// one frame in flight. The buffers only grow, so they are rarely recreated.
+type drawFrame struct {
+	vertices       buffer
+	indices        buffer
+	descriptorPool vulkan.DescriptorPool
+}
+
+// preparedBatch is a batch split into its draw calls when queued, whose
+// geometry and textures are uploaded when the frame is prepared.
+type preparedBatch struct {
+	descriptorSet vulkan.DescriptorSet
+	batch         graphics.Batch2D
+	firstIndex    uint32
+	vertexOffset  int32
+	draws         []indexRange
+}
+
+// indexRange is a range of the indices of a batch drawn with one draw call.
+type indexRange struct {
+	first, count uint32
+}
+
+var textureFilters = map[graphics.TextureFilter]vulkan.Filter{
+	graphics.FilterLinear:  vulkan.FilterLinear,
+	graphics.FilterNearest: vulkan.FilterNearest,
+}
+
+var mipmapModes = map[graphics.TextureFilter]vulkan.SamplerMipmapMode{
+	graphics.FilterLinear:  vulkan.SamplerMipmapModeLinear,
+	graphics.FilterNearest: vulkan.SamplerMipmapModeNearest,
+}
+
+func (ctx *Context) CreateTexture(img *stdimage.RGBA, filter graphics.TextureFilter, mipmaps ...*stdimage.RGBA) graphics.Texture {
+	return ctx.createTexture(append([]*stdimage.RGBA{img}, mipmaps...), filter, "texture")
+}
+
+// createTexture uploads each of the levels into its own mip level of the
+// image.
+func (ctx *Context) createTexture(levels []*stdimage.RGBA, filter graphics.TextureFilter, name string) *texture {
+	width, height := levels[0].Rect.Dx(), levels[0].Rect.Dy()
+	if width <= 0 || height <= 0 {
+		log.PanicfCore("invalid texture size %dx%d", width, height)
+	}
+
+	t := &texture{
+		ctx:    ctx,
+		extent: vulkan.Extent2D{Width: uint32(width), Height: uint32(height)},
+	}
+
+	// Each level is half the size of the previous one, down to a pixel
+	maxLevels := bits.Len(uint(width | height))
+	if len(levels) > maxLevels {
+		log.PanicfCore("a %dx%d texture has at most %d mip levels, got %d", width, height, maxLevels, len(levels))
+	}
+	regions := make([]vulkan.BufferImageCopy, len(levels))
+	var size uint64
+	for i, level := range levels {
+		if i > 0 && width > 1 {
+			width /= 2
+		}
+		if i > 0 && height > 1 {
+			height /= 2
+		}
+		if level.Rect.Dx() != width || level.Rect.Dy() != height {
+			log.PanicfCore("invalid size %dx%d of mip level %d, expected %dx%d",
+				level.Rect.Dx(), level.Rect.Dy(), i, width, height)
+		}
+
+		regions[i] = vulkan.BufferImageCopy{
+			BufferOffset: vulkan.DeviceSize(size),
+			ImageSubresource: vulkan.ImageSubresourceLayers{
+				AspectMask: vulkan.ImageAspectFlags(vulkan.ImageAspectColorBit),
+				MipLevel:   uint32(i),
+				LayerCount: 1,
+			},
+			ImageExtent: vulkan.Extent3D{Width: uint32(width), Height: uint32(height), Depth: 1},
+		}
+		size += uint64(width * height * 4)
+	}
+
+	staging := ctx.createBuffer(
+		size,
+		vulkan.BufferUsageTransferSrcBit,
+		vulkan.MemoryPropertyHostVisibleBit|vulkan.MemoryPropertyHostCoherentBit,
+		name+" staging buffer",
+	)
+	defer ctx.destroyBuffer(staging)
+
+	// Sub images do not start at the first pixel and have a longer stride
+	for i, level := range levels {
+		width, height := level.Rect.Dx(), level.Rect.Dy()
+		for y := 0; y < height; y++ {
+			row := level.PixOffset(level.Rect.Min.X, level.Rect.Min.Y+y)
+			ctx.write(staging, uint64(regions[i].BufferOffset)+uint64(y*width*4), level.Pix[row:row+width*4])
+		}
+	}
+
+	t.image = ctx.createMipmappedImage(
+		t.extent,
+		uint32(len(levels)),
+		vulkan.FormatR8g8b8a8Srgb,
+		vulkan.SampleCount1Bit,
+		vulkan.ImageUsageTransferDstBit|vulkan.ImageUsageSampledBit,
+		vulkan.ImageAspectColorBit,
+		name,
+	)
+
+	ctx.submitOneTimeCommands(ctx.graphicsQueue, ctx.commandPool, name+" upload", func(commandBuffer vulkan.CommandBuffer) {
+		ctx.transitionImage(commandBuffer, t.image.handle, vulkan.ImageLayoutUndefined, vulkan.ImageLayoutTransferDstOptimal,
+			vulkan.PipelineStageTopOfPipeBit, 0,
+			vulkan.PipelineStageTransferBit, vulkan.AccessTransferWriteBit)
+
+		vulkan.CmdCopyBufferToImage(commandBuffer, staging.handle, t.image.handle, vulkan.ImageLayoutTransferDstOptimal,
+			uint32(len(regions)), regions)
+
+		ctx.transitionImage(commandBuffer, t.image.handle, vulkan.ImageLayoutTransferDstOptimal, vulkan.ImageLayoutShaderReadOnlyOptimal,
+			vulkan.PipelineStageTransferBit, vulkan.AccessTransferWriteBit,
+			vulkan.PipelineStageFragmentShaderBit, vulkan.AccessShaderReadBit)
+	})
+
+	samplerCreateInfo := vulkan.SamplerCreateInfo{
+		SType:                   vulkan.StructureTypeSamplerCreateInfo,
+		MagFilter:               textureFilters[filter],
+		MinFilter:               textureFilters[filter],
+		MipmapMode:              mipmapModes[filter],
+		AddressModeU:            vulkan.SamplerAddressModeClampToEdge,
+		AddressModeV:            vulkan.SamplerAddressModeClampToEdge,
+		AddressModeW:            vulkan.SamplerAddressModeClampToEdge,
+		AnisotropyEnable:        vulkan.False,
+		MaxAnisotropy:           1,
+		CompareEnable:           vulkan.False,
+		CompareOp:               vulkan.CompareOpAlways,
+		MinLod:                  0,
+		MaxLod:                  float32(len(levels)),
+		BorderColor:             vulkan.BorderColorFloatOpaqueWhite,
+		UnnormalizedCoordinates: vulkan.False,
+	}
+	result := vulkan.CreateSampler(ctx.device, &samplerCreateInfo, nil, &t.sampler)
+	panicOnError(result, "create "+name+" sampler")
+	ctx.nameObject(vulkan.ObjectTypeSampler, unsafe.Pointer(t.sampler), name)
+
+	return t
+}
+
+func (t *texture) Size() (width, height int) {
+	return int(t.extent.Width), int(t.extent.Height)
+}
+
+// Destroy waits for the device to be idle, since frames in flight may still
+// sample the texture.
+func (t *texture) Destroy() {
+	vulkan.DeviceWaitIdle(t.ctx.device)
+	t.destroy()
+}
+
+func (t *texture) destroy() {
+	vulkan.DestroySampler(t.ctx.device, t.sampler, nil)
+	t.ctx.destroyImage(t.image)
+}
+
+func (ctx *Context) MaxBatchTextures() int {
+	return ctx.maxBatchTextures
+}
+
+func (ctx *Context) DrawBatch2D(batch graphics.Batch2D) int {
+	if len(batch.Textures) > ctx.maxBatchTextures {
+		log.PanicfCore("a batch can use at most %d textures, got %d", ctx.maxBatchTextures, len(batch.Textures))
+	}
+	if len(batch.Indices) == 0 {
+		return 0
+	}
+
+	queued := preparedBatch{batch: batch, draws: textureRuns(batch)}
+	ctx.batches = append(ctx.batches, queued)
+	return len(queued.draws)
+}
+
+// createDrawer2D sizes batches to the samplers the device can bind in the
+// fragment stage, and creates the texture bound to the texture slots batches
+// do not use, which must be valid even though they are never sampled.
+func (ctx *Context) createDrawer2D() {
+	limits := ctx.gpu.properties.Limits
+	ctx.maxBatchTextures = batchTexturesCap
+	for _, limit := range []uint32{limits.MaxPerStageDescriptorSamplers, limits.MaxPerStageDescriptorSampledImages} {
+		if int(limit) < ctx.maxBatchTextures {
+			ctx.maxBatchTextures = int(limit)
+		}
+	}
+	if ctx.maxBatchTextures < graphics.MaxBatchTextures {
+		log.PanicfCore("the gpu can bind %d textures per shader stage, at least %d are required",
+			ctx.maxBatchTextures, graphics.MaxBatchTextures)
+	}
+	log.DebugfCore("Batching up to %d textures", ctx.maxBatchTextures)
+
+	white := stdimage.NewRGBA(stdimage.Rect(0, 0, 1, 1))
+	copy(white.Pix, []byte{0xFF, 0xFF, 0xFF, 0xFF})
+	ctx.unusedTexture = ctx.createTexture([]*stdimage.RGBA{white}, graphics.FilterNearest, "unused texture")
+}
+
+func (ctx *Context) destroyDrawer2D() {
+	for i := range ctx.drawFrames {
+		ctx.destroyDrawFrame(&ctx.drawFrames[i])
+	}
+	ctx.unusedTexture.destroy()
+}
+
+func (ctx *Context) destroyDrawFrame(frame *drawFrame) {
+	if frame.vertices.handle != vulkan.NullBuffer {
+		ctx.destroyBuffer(frame.vertices)
+		ctx.destroyBuffer(frame.indices)
+	}
+	if frame.descriptorPool != vulkan.NullDescriptorPool {
+		vulkan.DestroyDescriptorPool(ctx.device, frame.descriptorPool, nil)
+	}
+	*frame = drawFrame{}
+}
+
+// prepareBatches uploads the queued batches into the buffers of the current
+// frame in flight, whose previous use has completed, and allocates their
+// descriptor sets.
+func (ctx *Context) prepareBatches() {
+	frame := &ctx.drawFrames[ctx.currentFrame]
+	if frame.descriptorPool != vulkan.NullDescriptorPool {
+		vulkan.DestroyDescriptorPool(ctx.device, frame.descriptorPool, nil)
+		frame.descriptorPool = vulkan.NullDescriptorPool
+	}
+
+	ctx.preparedBatches = ctx.preparedBatches[:0]
+	if len(ctx.batches) == 0 {
+		return
+	}
+
+	var vertexCount, indexCount uint64
+	for _, queued := range ctx.batches {
+		vertexCount += uint64(len(queued.batch.Vertices))
+		indexCount += uint64(len(queued.batch.Indices))
+	}
+	ctx.reserveDrawFrame(frame, vertexCount*vertex2DSize, indexCount*4)
+
+	p := ctx.pipeline(ctx.spritePipeline())
+	poolSizes := []vulkan.DescriptorPoolSize{{
+		Type:            vulkan.DescriptorTypeCombinedImageSampler,
+		DescriptorCount: uint32(len(ctx.batches) * ctx.maxBatchTextures),
+	}}
+	poolCreateInfo := vulkan.DescriptorPoolCreateInfo{
+		SType:         vulkan.StructureTypeDescriptorPoolCreateInfo,
+		MaxSets:       uint32(len(ctx.batches)),
+		PoolSizeCount: uint32(len(poolSizes)),
+		PPoolSizes:    poolSizes,
+	}
+	result := vulkan.CreateDescriptorPool(ctx.device, &poolCreateInfo, nil, &frame.descriptorPool)
+	panicOnError(result, "create batch descriptor pool")
+
+	var vertexOffset, indexOffset uint64
+	for _, prepared := range ctx.batches {
+		batch := prepared.batch
+		if len(batch.Vertices) > 0 {
+			vertexBytes := (*[1 << 31]byte)(unsafe.Pointer(&batch.Vertices[0]))[: uint64(len(batch.Vertices))*vertex2DSize : uint64(len(batch.Vertices))*vertex2DSize]
+			ctx.write(frame.vertices, vertexOffset*vertex2DSize, vertexBytes)
+		}
+		indexBytes := (*[1 << 31]byte)(unsafe.Pointer(&batch.Indices[0]))[: len(batch.Indices)*4 : len(batch.Indices)*4]
+		ctx.write(frame.indices, indexOffset*4, indexBytes)
+
+		prepared.descriptorSet = ctx.allocateBatchDescriptorSet(frame.descriptorPool, p.setLayouts[0], batch.Textures)
+		prepared.firstIndex = uint32(indexOffset)
+		prepared.vertexOffset = int32(vertexOffset)
+		ctx.preparedBatches = append(ctx.preparedBatches, prepared)
+
+		vertexOffset += uint64(len(batch.Vertices))
+		indexOffset += uint64(len(batch.Indices))
+	}
+	ctx.batches = nil
+}
+
+// textureRuns splits the triangles of a batch into runs sampling the same
+// texture. The sprite shader indexes its texture array with the texture of
+// the provoking vertex of a triangle, which may only vary between draw calls.
+func textureRuns(batch graphics.Batch2D) []indexRange {
+	var runs []indexRange
+	current := uint32(0)
+	for first := 0; first+2 < len(batch.Indices); first += 3 {
+		texture := batch.Vertices[batch.Indices[first]].Texture
+		if len(runs) == 0 || texture != current {
+			runs = append(runs, indexRange{first: uint32(first)})
+			current = texture
+		}
+		runs[len(runs)-1].count += 3
+	}
+
+	return runs
+}
+
+// reserveDrawFrame makes sure the buffers of a frame hold at least the given
+// number of bytes, doubling their size when they do not.
+func (ctx *Context) reserveDrawFrame(frame *drawFrame, vertexBytes, indexBytes uint64) {
+	if frame.vertices.handle != vulkan.NullBuffer && frame.vertices.size >= vertexBytes && frame.indices.size >= indexBytes {
+		return
+	}
+
+	vertexSize, indexSize := uint64(64*1024), uint64(16*1024)
+	if frame.vertices.handle != vulkan.NullBuffer {
+		vertexSize, indexSize = frame.vertices.size, frame.indices.size
+		ctx.destroyBuffer(frame.vertices)
+		ctx.destroyBuffer(frame.indices)
+	}
+	for vertexSize < vertexBytes {
+		vertexSize *= 2
+	}
+	for indexSize < indexBytes {
+		indexSize *= 2
+	}
+
+	memoryProperties := vulkan.MemoryPropertyHostVisibleBit | vulkan.MemoryPropertyHostCoherentBit
+	frame.vertices = ctx.createBuffer(vertexSize, vulkan.BufferUsageVertexBufferBit, memoryProperties, "batch vertex buffer")
+	frame.indices = ctx.createBuffer(indexSize, vulkan.BufferUsageIndexBufferBit, memoryProperties, "batch index buffer")
+}
+
+func (ctx *Context) allocateBatchDescriptorSet(
+	pool vulkan.DescriptorPool, setLayout vulkan.DescriptorSetLayout, textures []graphics.Texture,
+) vulkan.DescriptorSet {
+	var descriptorSet vulkan.DescriptorSet
+	allocateInfo := vulkan.DescriptorSetAllocateInfo{
+		SType:              vulkan.StructureTypeDescriptorSetAllocateInfo,
+		DescriptorPool:     pool,
+		DescriptorSetCount: 1,
+		PSetLayouts:        []vulkan.DescriptorSetLayout{setLayout},
+	}
+	result := vulkan.AllocateDescriptorSets(ctx.device, &allocateInfo, &descriptorSet)
+	panicOnError(result, "allocate batch descriptor set")
+
+	imageInfos := make([]vulkan.DescriptorImageInfo, ctx.maxBatchTextures)
+	for i := range imageInfos {
+		t := ctx.unusedTexture
+		if i < len(textures) {
+			t = textures[i].(*texture)
+		}
+		imageInfos[i] = vulkan.DescriptorImageInfo{
+			Sampler:     t.sampler,
+			ImageView:   t.image.view,
+			ImageLayout: vulkan.ImageLayoutShaderReadOnlyOptimal,
+		}
+	}
+
+	write := vulkan.WriteDescriptorSet{
+		SType:           vulkan.StructureTypeWriteDescriptorSet,
+		DstSet:          descriptorSet,
+		DstBinding:      0,
+		DescriptorCount: uint32(len(imageInfos)),
+		DescriptorType:  vulkan.DescriptorTypeCombinedImageSampler,
+		PImageInfo:      imageInfos,
+	}
+	vulkan.UpdateDescriptorSets(ctx.device, 1, []vulkan.WriteDescriptorSet{write}, 0, nil)
+
+	return descriptorSet
+}
+
+// recordBatches draws the batches prepared for the current frame within the
+// main pass.
+func (ctx *Context) recordBatches(commandBuffer vulkan.CommandBuffer) {
+	frame := &ctx.drawFrames[ctx.currentFrame]
+	p := ctx.pipeline(ctx.spritePipeline())
+
+	vulkan.CmdBindPipeline(commandBuffer, vulkan.PipelineBindPointGraphics, p.handle)
+	vulkan.CmdBindVertexBuffers(commandBuffer, 0, 1, []vulkan.Buffer{frame.vertices.handle}, []vulkan.DeviceSize{0})
+	vulkan.CmdBindIndexBuffer(commandBuffer, frame.indices.handle, 0, vulkan.IndexTypeUint32)
+
+	for _, prepared := range ctx.preparedBatches {
+		viewProjection := prepared.batch.ViewProjection
+		vulkan.CmdBindDescriptorSets(commandBuffer, vulkan.PipelineBindPointGraphics, p.layout,
+			0, 1, []vulkan.DescriptorSet{prepared.descriptorSet}, 0, nil)
+		vulkan.CmdPushConstants(commandBuffer, p.layout, vulkan.ShaderStageFlags(vulkan.ShaderStageVertexBit),
+			0, uint32(unsafe.Sizeof(viewProjection)), unsafe.Pointer(&viewProjection[0]))
+		for _, draw := range prepared.draws {
+			vulkan.CmdDrawIndexed(commandBuffer, draw.count, 1, prepared.firstIndex+draw.first, prepared.vertexOffset, 0)
+		}
+	}
+}
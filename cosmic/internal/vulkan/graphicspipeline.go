@@ -1,75 +1,184 @@
 package vulkan
 
 import (
+	"github.com/lentus/cosmic-engine/cosmic/graphics"
+	"github.com/lentus/cosmic-engine/cosmic/internal/vulkan/spirv"
 	"github.com/lentus/cosmic-engine/cosmic/log"
 	"github.com/vulkan-go/vulkan"
+	"unsafe"
 )
 
-func (ctx *Context) createGraphicsPipeline() {
-	vertexShaderModule := ctx.createShaderModule("vert.spv")
-	fragmentShaderModule := ctx.createShaderModule("frag.spv")
+// trianglePipeline draws the built-in triangle.
+var trianglePipeline = graphics.PipelineDescriptor{
+	VertexShader:   graphics.ShaderStage{SPIRV: "shader.vert.spv", GLSL: "shader.vert"},
+	FragmentShader: graphics.ShaderStage{SPIRV: "shader.frag.spv", GLSL: "shader.frag"},
+	Topology:       graphics.TopologyTriangleList,
+	Raster: graphics.RasterState{
+		CullMode:  graphics.CullBack,
+		FrontFace: graphics.FrontFaceClockwise,
+	},
+}
+
+// pipeline is a graphics pipeline created from a descriptor, together with
+// the layout objects derived from its shaders.
+type pipeline struct {
+	descriptor graphics.PipelineDescriptor
+	handle     vulkan.Pipeline
+	layout     vulkan.PipelineLayout
+	setLayouts []vulkan.DescriptorSetLayout
+}
+
+func (p *pipeline) shaders() []shaderSource {
+	return []shaderSource{toShaderSource(p.descriptor.VertexShader), toShaderSource(p.descriptor.FragmentShader)}
+}
+
+// name identifies the pipeline by its shaders in debug messages.
+func (p *pipeline) name() string {
+	return p.descriptor.VertexShader.SPIRV + " + " + p.descriptor.FragmentShader.SPIRV
+}
+
+func toShaderSource(stage graphics.ShaderStage) shaderSource {
+	return shaderSource{spirv: stage.SPIRV, glsl: stage.GLSL}
+}
+
+// specializationInfo sets the specialization constants of a shader stage, it
+// is nil when the stage keeps their defaults.
+func specializationInfo(constants []graphics.SpecConstant) []vulkan.SpecializationInfo {
+	if len(constants) == 0 {
+		return nil
+	}
+
+	entries := make([]vulkan.SpecializationMapEntry, len(constants))
+	data := make([]uint32, len(constants))
+	for i, constant := range constants {
+		entries[i] = vulkan.SpecializationMapEntry{ConstantID: constant.ID, Offset: uint32(i * 4), Size: 4}
+		data[i] = constant.Value
+	}
+
+	return []vulkan.SpecializationInfo{{
+		MapEntryCount: uint32(len(entries)),
+		PMapEntries:   entries,
+		DataSize:      uint(len(data) * 4),
+		PData:         unsafe.Pointer(&data[0]),
+	}}
+}
+
+// pipeline returns the pipeline for the given descriptor, creating it when
+// no pipeline with the same state exists yet.
+func (ctx *Context) pipeline(descriptor graphics.PipelineDescriptor) *pipeline {
+	key := descriptor.Hash()
+	if p, ok := ctx.pipelines[key]; ok {
+		return p
+	}
+
+	shaderInterface, err := ctx.reflectPipelineShaders(descriptor)
+	if err != nil {
+		log.PanicfCore("failed to reflect graphics pipeline shaders: %s", err.Error())
+	}
+
+	p, err := ctx.createGraphicsPipeline(descriptor, shaderInterface)
+	if err != nil {
+		log.PanicfCore("%s", err.Error())
+	}
+	ctx.pipelines[key] = p
+
+	return p
+}
+
+// reflectPipelineShaders derives the vertex input state and pipeline layout
+// of a pipeline from its shaders.
+func (ctx *Context) reflectPipelineShaders(descriptor graphics.PipelineDescriptor) (*pipelineInterface, error) {
+	vertexStage, err := ctx.reflectShader(toShaderSource(descriptor.VertexShader), spirv.StageVertex, descriptor.VertexShader.Constants)
+	if err != nil {
+		return nil, err
+	}
+
+	fragmentStage, err := ctx.reflectShader(toShaderSource(descriptor.FragmentShader), spirv.StageFragment, descriptor.FragmentShader.Constants)
+	if err != nil {
+		return nil, err
+	}
+
+	return reflectPipeline(vertexStage, fragmentStage)
+}
+
+// createGraphicsPipeline returns an error when the driver fails to compile
+// the shaders into a pipeline, leaving nothing to destroy.
+func (ctx *Context) createGraphicsPipeline(descriptor graphics.PipelineDescriptor, shaderInterface *pipelineInterface) (*pipeline, error) {
+	p := &pipeline{descriptor: descriptor}
+
+	vertexShaderModule, err := ctx.createShaderModule(toShaderSource(descriptor.VertexShader))
+	if err != nil {
+		return nil, err
+	}
+	defer vulkan.DestroyShaderModule(ctx.device, vertexShaderModule, nil)
+	fragmentShaderModule, err := ctx.createShaderModule(toShaderSource(descriptor.FragmentShader))
+	if err != nil {
+		return nil, err
+	}
+	defer vulkan.DestroyShaderModule(ctx.device, fragmentShaderModule, nil)
 
 	vertexShaderStageCreateInfo := vulkan.PipelineShaderStageCreateInfo{
-		SType:  vulkan.StructureTypePipelineShaderStageCreateInfo,
-		Stage:  vulkan.ShaderStageVertexBit,
-		Module: vertexShaderModule,
-		PName:  safeStr("main"),
+		SType:               vulkan.StructureTypePipelineShaderStageCreateInfo,
+		Stage:               vulkan.ShaderStageVertexBit,
+		Module:              vertexShaderModule,
+		PName:               safeStr("main"),
+		PSpecializationInfo: specializationInfo(descriptor.VertexShader.Constants),
 	}
 
 	fragmentShaderStageCreateInfo := vulkan.PipelineShaderStageCreateInfo{
-		SType:  vulkan.StructureTypePipelineShaderStageCreateInfo,
-		Stage:  vulkan.ShaderStageFragmentBit,
-		Module: fragmentShaderModule,
-		PName:  safeStr("main"),
+		SType:               vulkan.StructureTypePipelineShaderStageCreateInfo,
+		Stage:               vulkan.ShaderStageFragmentBit,
+		Module:              fragmentShaderModule,
+		PName:               safeStr("main"),
+		PSpecializationInfo: specializationInfo(descriptor.FragmentShader.Constants),
 	}
 
 	vertexInputStateCreateInfo := vulkan.PipelineVertexInputStateCreateInfo{
 		SType:                           vulkan.StructureTypePipelineVertexInputStateCreateInfo,
-		VertexBindingDescriptionCount:   0,
-		PVertexBindingDescriptions:      nil,
-		VertexAttributeDescriptionCount: 0,
-		PVertexAttributeDescriptions:    nil,
+		VertexBindingDescriptionCount:   uint32(len(shaderInterface.vertexBindings)),
+		PVertexBindingDescriptions:      shaderInterface.vertexBindings,
+		VertexAttributeDescriptionCount: uint32(len(shaderInterface.vertexAttributes)),
+		PVertexAttributeDescriptions:    shaderInterface.vertexAttributes,
 	}
 
 	inputAssemblyStateCreateInfo := vulkan.PipelineInputAssemblyStateCreateInfo{
 		SType:                  vulkan.StructureTypePipelineInputAssemblyStateCreateInfo,
-		Topology:               vulkan.PrimitiveTopologyTriangleList,
+		Topology:               primitiveTopologies[descriptor.Topology],
 		PrimitiveRestartEnable: vulkan.False,
 	}
 
-	viewport := vulkan.Viewport{
-		X:        0,
-		Y:        0,
-		Width:    float32(ctx.swapchainImageExtent.Width),
-		Height:   float32(ctx.swapchainImageExtent.Height),
-		MinDepth: 0,
-		MaxDepth: 1,
-	}
-
-	scissor := vulkan.Rect2D{
-		Offset: vulkan.Offset2D{X: 0, Y: 0},
-		Extent: vulkan.Extent2D{
-			Width:  ctx.swapchainImageExtent.Width,
-			Height: ctx.swapchainImageExtent.Height,
-		},
-	}
-
+	// Viewport and scissor are dynamic, so only their count is given here
 	viewportStateCreateInfo := vulkan.PipelineViewportStateCreateInfo{
 		SType:         vulkan.StructureTypePipelineViewportStateCreateInfo,
 		ViewportCount: 1,
-		PViewports:    []vulkan.Viewport{viewport},
 		ScissorCount:  1,
-		PScissors:     []vulkan.Rect2D{scissor},
+	}
+
+	dynamicStates := []vulkan.DynamicState{vulkan.DynamicStateViewport, vulkan.DynamicStateScissor}
+	dynamicStateCreateInfo := vulkan.PipelineDynamicStateCreateInfo{
+		SType:             vulkan.StructureTypePipelineDynamicStateCreateInfo,
+		DynamicStateCount: uint32(len(dynamicStates)),
+		PDynamicStates:    dynamicStates,
+	}
+
+	polygonMode := vulkan.PolygonModeFill
+	if descriptor.Raster.Wireframe {
+		polygonMode = vulkan.PolygonModeLine
+	}
+
+	lineWidth := descriptor.Raster.LineWidth
+	if lineWidth == 0 {
+		lineWidth = 1
 	}
 
 	rasterizationStateCreateInfo := vulkan.PipelineRasterizationStateCreateInfo{
 		SType:                   vulkan.StructureTypePipelineRasterizationStateCreateInfo,
 		DepthClampEnable:        vulkan.False,
 		RasterizerDiscardEnable: vulkan.False,
-		PolygonMode:             vulkan.PolygonModeFill,
-		LineWidth:               1,
-		CullMode:                vulkan.CullModeFlags(vulkan.CullModeBackBit),
-		FrontFace:               vulkan.FrontFaceClockwise,
+		PolygonMode:             polygonMode,
+		LineWidth:               lineWidth,
+		CullMode:                vulkan.CullModeFlags(cullModes[descriptor.Raster.CullMode]),
+		FrontFace:               frontFaces[descriptor.Raster.FrontFace],
 		DepthBiasEnable:         vulkan.False,
 		DepthBiasConstantFactor: 0,
 		DepthBiasClamp:          0,
@@ -79,27 +188,22 @@ func (ctx *Context) createGraphicsPipeline() {
 	multisampleStateCreateInfo := vulkan.PipelineMultisampleStateCreateInfo{
 		SType:                 vulkan.StructureTypePipelineMultisampleStateCreateInfo,
 		SampleShadingEnable:   vulkan.False,
-		RasterizationSamples:  vulkan.SampleCount1Bit,
+		RasterizationSamples:  ctx.samples,
 		MinSampleShading:      1,
 		PSampleMask:           nil,
 		AlphaToCoverageEnable: vulkan.False,
 		AlphaToOneEnable:      vulkan.False,
 	}
 
-	//ctx.createDepthStencilImage()
-
-	colorComponentFlags := vulkan.ColorComponentFlags(
-		vulkan.ColorComponentRBit | vulkan.ColorComponentGBit | vulkan.ColorComponentBBit | vulkan.ColorComponentABit,
-	)
-	colorblendAttachment := vulkan.PipelineColorBlendAttachmentState{
-		BlendEnable:         vulkan.False,
-		SrcColorBlendFactor: vulkan.BlendFactorOne,
-		DstColorBlendFactor: vulkan.BlendFactorZero,
-		ColorBlendOp:        vulkan.BlendOpAdd,
-		SrcAlphaBlendFactor: vulkan.BlendFactorOne,
-		DstAlphaBlendFactor: vulkan.BlendFactorZero,
-		AlphaBlendOp:        vulkan.BlendOpAdd,
-		ColorWriteMask:      colorComponentFlags,
+	depthStencilStateCreateInfo := vulkan.PipelineDepthStencilStateCreateInfo{
+		SType:                 vulkan.StructureTypePipelineDepthStencilStateCreateInfo,
+		DepthTestEnable:       vulkanBool(descriptor.Depth.Test),
+		DepthWriteEnable:      vulkanBool(descriptor.Depth.Write),
+		DepthCompareOp:        compareOps[descriptor.Depth.Compare],
+		DepthBoundsTestEnable: vulkan.False,
+		StencilTestEnable:     vulkan.False,
+		MinDepthBounds:        0,
+		MaxDepthBounds:        1,
 	}
 
 	colorblendCreateInfo := vulkan.PipelineColorBlendStateCreateInfo{
@@ -107,21 +211,23 @@ func (ctx *Context) createGraphicsPipeline() {
 		LogicOpEnable:   vulkan.False,
 		LogicOp:         vulkan.LogicOpCopy,
 		AttachmentCount: 1,
-		PAttachments:    []vulkan.PipelineColorBlendAttachmentState{colorblendAttachment},
+		PAttachments:    []vulkan.PipelineColorBlendAttachmentState{colorBlendAttachment(descriptor.Blend)},
 		BlendConstants:  [4]float32{0, 0, 0, 0},
 	}
 
+	p.setLayouts = ctx.createDescriptorSetLayouts(shaderInterface)
 	pipelineLayoutCreateInfo := vulkan.PipelineLayoutCreateInfo{
 		SType:                  vulkan.StructureTypePipelineLayoutCreateInfo,
-		SetLayoutCount:         0,
-		PSetLayouts:            nil,
-		PushConstantRangeCount: 0,
-		PPushConstantRanges:    nil,
+		SetLayoutCount:         uint32(len(p.setLayouts)),
+		PSetLayouts:            p.setLayouts,
+		PushConstantRangeCount: uint32(len(shaderInterface.pushConstantRanges)),
+		PPushConstantRanges:    shaderInterface.pushConstantRanges,
 	}
 	var pipelineLayout vulkan.PipelineLayout
 	result := vulkan.CreatePipelineLayout(ctx.device, &pipelineLayoutCreateInfo, nil, &pipelineLayout)
 	panicOnError(result, "create pipeline layout")
-	ctx.pipelineLayout = pipelineLayout
+	p.layout = pipelineLayout
+	ctx.nameObject(vulkan.ObjectTypePipelineLayout, unsafe.Pointer(pipelineLayout), p.name())
 
 	pipelineCreateInfo := vulkan.GraphicsPipelineCreateInfo{
 		SType:      vulkan.StructureTypeGraphicsPipelineCreateInfo,
@@ -135,9 +241,9 @@ func (ctx *Context) createGraphicsPipeline() {
 		PViewportState:      &viewportStateCreateInfo,
 		PRasterizationState: &rasterizationStateCreateInfo,
 		PMultisampleState:   &multisampleStateCreateInfo,
-		PDepthStencilState:  nil,
+		PDepthStencilState:  &depthStencilStateCreateInfo,
 		PColorBlendState:    &colorblendCreateInfo,
-		PDynamicState:       nil,
+		PDynamicState:       &dynamicStateCreateInfo,
 		Layout:              pipelineLayout,
 		RenderPass:          ctx.renderPass,
 		Subpass:             0,
@@ -148,25 +254,166 @@ func (ctx *Context) createGraphicsPipeline() {
 	graphicsPipelines := make([]vulkan.Pipeline, 1)
 	pipelineCreateInfos := []vulkan.GraphicsPipelineCreateInfo{pipelineCreateInfo}
 	result = vulkan.CreateGraphicsPipelines(
-		ctx.device, vulkan.NullPipelineCache, 1, pipelineCreateInfos, nil, graphicsPipelines,
+		ctx.device, ctx.pipelineCache, 1, pipelineCreateInfos, nil, graphicsPipelines,
 	)
-	panicOnError(result, "create graphics pipeline")
-	ctx.graphicsPipeline = graphicsPipelines[0]
+	if err := resultError(result, "create graphics pipeline "+p.name()); err != nil {
+		ctx.destroyGraphicsPipeline(p)
+		return nil, err
+	}
+	p.handle = graphicsPipelines[0]
+	ctx.nameObject(vulkan.ObjectTypePipeline, unsafe.Pointer(p.handle), p.name())
 
-	vulkan.DestroyShaderModule(ctx.device, vertexShaderModule, nil)
-	vulkan.DestroyShaderModule(ctx.device, fragmentShaderModule, nil)
+	return p, nil
 }
 
-func (ctx *Context) destroyGraphicsPipeline() {
-	vulkan.DestroyPipeline(ctx.device, ctx.graphicsPipeline, nil)
-	vulkan.DestroyPipelineLayout(ctx.device, ctx.pipelineLayout, nil)
-	//ctx.destroyDepthStencilImage()
-	vulkan.DestroyRenderPass(ctx.device, ctx.renderPass, nil)
+func (ctx *Context) destroyGraphicsPipeline(p *pipeline) {
+	if p.handle != vulkan.NullPipeline {
+		vulkan.DestroyPipeline(ctx.device, p.handle, nil)
+	}
+	vulkan.DestroyPipelineLayout(ctx.device, p.layout, nil)
+	for _, setLayout := range p.setLayouts {
+		vulkan.DestroyDescriptorSetLayout(ctx.device, setLayout, nil)
+	}
 }
 
-func (ctx *Context) createDepthStencilImage() {
-	log.DebugCore("Creating Vulkan depth stencil image")
+// destroyPipelines destroys all cached pipelines, e.g. when the render pass
+// they were created for is replaced.
+func (ctx *Context) destroyPipelines() {
+	for key, p := range ctx.pipelines {
+		ctx.destroyGraphicsPipeline(p)
+		delete(ctx.pipelines, key)
+	}
+}
 
+// rebuildPipelines recreates the cached pipelines that use one of the updated
+// shaders and returns how many were rebuilt. No pipeline is touched when the
+// updated shaders cannot be used, the new pipelines are all created before
+// the old ones are destroyed.
+func (ctx *Context) rebuildPipelines(updates []shaderUpdate) (int, error) {
+	affected := make(map[uint64]*pipelineInterface)
+	for key, p := range ctx.pipelines {
+		if !usesShader(p.shaders(), updates) {
+			continue
+		}
+
+		shaderInterface, err := ctx.reflectPipelineShaders(p.descriptor)
+		if err != nil {
+			return 0, err
+		}
+		affected[key] = shaderInterface
+	}
+
+	if len(affected) == 0 {
+		return 0, nil
+	}
+
+	log.DebugfCore("Rebuilding %d pipeline(s) after shader reload", len(affected))
+	rebuilt := make(map[uint64]*pipeline, len(affected))
+	for key, shaderInterface := range affected {
+		p, err := ctx.createGraphicsPipeline(ctx.pipelines[key].descriptor, shaderInterface)
+		if err != nil {
+			for _, p := range rebuilt {
+				ctx.destroyGraphicsPipeline(p)
+			}
+			return 0, err
+		}
+		rebuilt[key] = p
+	}
+
+	vulkan.DeviceWaitIdle(ctx.device)
+	for key, p := range rebuilt {
+		ctx.destroyGraphicsPipeline(ctx.pipelines[key])
+		ctx.pipelines[key] = p
+	}
+
+	return len(rebuilt), nil
+}
+
+func usesShader(pipelineShaders []shaderSource, updates []shaderUpdate) bool {
+	for _, pipelineShader := range pipelineShaders {
+		for _, update := range updates {
+			if pipelineShader.spirv == update.spirv {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+var primitiveTopologies = map[graphics.Topology]vulkan.PrimitiveTopology{
+	graphics.TopologyTriangleList:  vulkan.PrimitiveTopologyTriangleList,
+	graphics.TopologyTriangleStrip: vulkan.PrimitiveTopologyTriangleStrip,
+	graphics.TopologyLineList:      vulkan.PrimitiveTopologyLineList,
+	graphics.TopologyLineStrip:     vulkan.PrimitiveTopologyLineStrip,
+	graphics.TopologyPointList:     vulkan.PrimitiveTopologyPointList,
+}
+
+var cullModes = map[graphics.CullMode]vulkan.CullModeFlagBits{
+	graphics.CullBack:  vulkan.CullModeBackBit,
+	graphics.CullFront: vulkan.CullModeFrontBit,
+	graphics.CullNone:  vulkan.CullModeNone,
+}
+
+var frontFaces = map[graphics.FrontFace]vulkan.FrontFace{
+	graphics.FrontFaceClockwise:        vulkan.FrontFaceClockwise,
+	graphics.FrontFaceCounterClockwise: vulkan.FrontFaceCounterClockwise,
+}
+
+var compareOps = map[graphics.CompareOp]vulkan.CompareOp{
+	graphics.CompareLess:           vulkan.CompareOpLess,
+	graphics.CompareLessOrEqual:    vulkan.CompareOpLessOrEqual,
+	graphics.CompareGreater:        vulkan.CompareOpGreater,
+	graphics.CompareGreaterOrEqual: vulkan.CompareOpGreaterOrEqual,
+	graphics.CompareEqual:          vulkan.CompareOpEqual,
+	graphics.CompareAlways:         vulkan.CompareOpAlways,
+}
+
+func colorBlendAttachment(mode graphics.BlendMode) vulkan.PipelineColorBlendAttachmentState {
+	attachment := vulkan.PipelineColorBlendAttachmentState{
+		BlendEnable:         vulkan.False,
+		SrcColorBlendFactor: vulkan.BlendFactorOne,
+		DstColorBlendFactor: vulkan.BlendFactorZero,
+		ColorBlendOp:        vulkan.BlendOpAdd,
+		SrcAlphaBlendFactor: vulkan.BlendFactorOne,
+		DstAlphaBlendFactor: vulkan.BlendFactorZero,
+		AlphaBlendOp:        vulkan.BlendOpAdd,
+		ColorWriteMask: vulkan.ColorComponentFlags(
+			vulkan.ColorComponentRBit | vulkan.ColorComponentGBit | vulkan.ColorComponentBBit | vulkan.ColorComponentABit,
+		),
+	}
+
+	switch mode {
+	case graphics.BlendAlpha:
+		attachment.BlendEnable = vulkan.True
+		attachment.SrcColorBlendFactor = vulkan.BlendFactorSrcAlpha
+		attachment.DstColorBlendFactor = vulkan.BlendFactorOneMinusSrcAlpha
+		attachment.DstAlphaBlendFactor = vulkan.BlendFactorOneMinusSrcAlpha
+	case graphics.BlendPremultipliedAlpha:
+		attachment.BlendEnable = vulkan.True
+		attachment.DstColorBlendFactor = vulkan.BlendFactorOneMinusSrcAlpha
+		attachment.DstAlphaBlendFactor = vulkan.BlendFactorOneMinusSrcAlpha
+	case graphics.BlendAdditive:
+		attachment.BlendEnable = vulkan.True
+		attachment.SrcColorBlendFactor = vulkan.BlendFactorSrcAlpha
+		attachment.DstColorBlendFactor = vulkan.BlendFactorOne
+		attachment.DstAlphaBlendFactor = vulkan.BlendFactorOne
+	}
+
+	return attachment
+}
+
+func vulkanBool(b bool) vulkan.Bool32 {
+	if b {
+		return vulkan.True
+	}
+
+	return vulkan.False
+}
+
+// pickDepthStencilFormat selects the format of the depth stencil attachment,
+// which must be known before the render pass is created.
+func (ctx *Context) pickDepthStencilFormat() {
 	// Take the first supported format of the following formats
 	desiredFormats := []vulkan.Format{
 		vulkan.FormatD32SfloatS8Uint,
@@ -193,82 +440,18 @@ func (ctx *Context) createDepthStencilImage() {
 	// Check whether stencil is available
 	ctx.stencilAvailable = ctx.depthStencilFormat == vulkan.FormatD32SfloatS8Uint ||
 		ctx.depthStencilFormat == vulkan.FormatD24UnormS8Uint ||
-		ctx.depthStencilFormat == vulkan.FormatD16UnormS8Uint ||
-		ctx.depthStencilFormat == vulkan.FormatD32Sfloat
-
-	imageCreateInfo := vulkan.ImageCreateInfo{
-		SType:     vulkan.StructureTypeImageCreateInfo,
-		Flags:     0,
-		ImageType: vulkan.ImageType2d,
-		Format:    ctx.depthStencilFormat,
-		Extent: vulkan.Extent3D{
-			Width:  ctx.surface.capabilities.CurrentExtent.Width,
-			Height: ctx.surface.capabilities.CurrentExtent.Height,
-			Depth:  1,
-		},
-		MipLevels:             1,
-		ArrayLayers:           1,
-		Samples:               vulkan.SampleCount1Bit,
-		Tiling:                vulkan.ImageTilingOptimal,
-		Usage:                 vulkan.ImageUsageFlags(vulkan.ImageUsageDepthStencilAttachmentBit),
-		SharingMode:           vulkan.SharingModeExclusive,
-		QueueFamilyIndexCount: 0,   // Ignored because of exclusive mode
-		PQueueFamilyIndices:   nil, // Ignored because of exclusive mode
-		InitialLayout:         vulkan.ImageLayoutUndefined,
-	}
-
-	var depthStencilImage vulkan.Image
-	result := vulkan.CreateImage(ctx.device, &imageCreateInfo, nil, &depthStencilImage)
-	panicOnError(result, "create depth stencil image")
-	ctx.depthStencilImage = depthStencilImage
-
-	var imageMemoryRequirements vulkan.MemoryRequirements
-	vulkan.GetImageMemoryRequirements(ctx.device, ctx.depthStencilImage, &imageMemoryRequirements)
-	imageMemoryRequirements.Deref()
-
-	memoryTypeIndex := ctx.findMemoryTypeIndex(&imageMemoryRequirements, vulkan.MemoryPropertyFlags(vulkan.MemoryPropertyDeviceLocalBit))
-	if memoryTypeIndex == vulkan.MaxUint32 {
-		log.PanicCore("Could not find memory type to allocate depth stencil image memory")
-	}
+		ctx.depthStencilFormat == vulkan.FormatD16UnormS8Uint
+}
 
-	memoryAllocateInfo := vulkan.MemoryAllocateInfo{
-		SType:           vulkan.StructureTypeMemoryAllocateInfo,
-		AllocationSize:  imageMemoryRequirements.Size,
-		MemoryTypeIndex: memoryTypeIndex,
-	}
-	var depthStencilImageMemory vulkan.DeviceMemory
-	vulkan.AllocateMemory(ctx.device, &memoryAllocateInfo, nil, &depthStencilImageMemory)
-	ctx.depthStencilImageMemory = depthStencilImageMemory
-	vulkan.BindImageMemory(ctx.device, ctx.depthStencilImage, ctx.depthStencilImageMemory, 0)
+func (ctx *Context) createDepthStencilImage() {
+	log.DebugCore("Creating Vulkan depth stencil image")
 
 	aspectMask := vulkan.ImageAspectDepthBit
 	if ctx.stencilAvailable {
 		aspectMask |= vulkan.ImageAspectStencilBit
 	}
 
-	imageViewCreateInfo := vulkan.ImageViewCreateInfo{
-		SType:      vulkan.StructureTypeImageViewCreateInfo,
-		Image:      ctx.depthStencilImage,
-		ViewType:   vulkan.ImageViewType2d,
-		Format:     ctx.depthStencilFormat,
-		Components: vulkan.ComponentMapping{}, // Use identity mapping for rgba components
-		SubresourceRange: vulkan.ImageSubresourceRange{
-			AspectMask:     vulkan.ImageAspectFlags(aspectMask),
-			BaseMipLevel:   0,
-			LevelCount:     1,
-			BaseArrayLayer: 0,
-			LayerCount:     1,
-		},
-	}
-
-	var depthStencilImageView vulkan.ImageView
-	result = vulkan.CreateImageView(ctx.device, &imageViewCreateInfo, nil, &depthStencilImageView)
-	panicOnError(result, "create depth stencil image view")
-	ctx.depthStencilImageView = depthStencilImageView
-}
-
-func (ctx *Context) destroyDepthStencilImage() {
-	vulkan.DestroyImageView(ctx.device, ctx.depthStencilImageView, nil)
-	vulkan.FreeMemory(ctx.device, ctx.depthStencilImageMemory, nil)
-	vulkan.DestroyImage(ctx.device, ctx.depthStencilImage, nil)
+	ctx.depthStencil = ctx.createImage(
+		ctx.imageExtent, ctx.depthStencilFormat, ctx.samples, vulkan.ImageUsageDepthStencilAttachmentBit, aspectMask, "depth stencil image",
+	)
 }
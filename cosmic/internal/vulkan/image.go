@@ -0,0 +1,112 @@
+package vulkan
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/log"
+	"github.com/vulkan-go/vulkan"
+	"unsafe"
+)
+
+// image is a 2D image with its own device memory and a view of all its mip
+// levels.
+type image struct {
+	handle vulkan.Image
+	memory vulkan.DeviceMemory
+	view   vulkan.ImageView
+}
+
+func (ctx *Context) createImage(
+	extent vulkan.Extent2D,
+	format vulkan.Format,
+	samples vulkan.SampleCountFlagBits,
+	usage vulkan.ImageUsageFlagBits,
+	aspectMask vulkan.ImageAspectFlagBits,
+	name string,
+) image {
+	return ctx.createMipmappedImage(extent, 1, format, samples, usage, aspectMask, name)
+}
+
+func (ctx *Context) createMipmappedImage(
+	extent vulkan.Extent2D,
+	levels uint32,
+	format vulkan.Format,
+	samples vulkan.SampleCountFlagBits,
+	usage vulkan.ImageUsageFlagBits,
+	aspectMask vulkan.ImageAspectFlagBits,
+	name string,
+) image {
+	imageCreateInfo := vulkan.ImageCreateInfo{
+		SType:     vulkan.StructureTypeImageCreateInfo,
+		Flags:     0,
+		ImageType: vulkan.ImageType2d,
+		Format:    format,
+		Extent: vulkan.Extent3D{
+			Width:  extent.Width,
+			Height: extent.Height,
+			Depth:  1,
+		},
+		MipLevels:             levels,
+		ArrayLayers:           1,
+		Samples:               samples,
+		Tiling:                vulkan.ImageTilingOptimal,
+		Usage:                 vulkan.ImageUsageFlags(usage),
+		SharingMode:           vulkan.SharingModeExclusive,
+		QueueFamilyIndexCount: 0,   // Ignored because of exclusive mode
+		PQueueFamilyIndices:   nil, // Ignored because of exclusive mode
+		InitialLayout:         vulkan.ImageLayoutUndefined,
+	}
+	if usage&vulkan.ImageUsageStorageBit != 0 {
+		imageCreateInfo.SharingMode, imageCreateInfo.PQueueFamilyIndices = ctx.computeSharing()
+		imageCreateInfo.QueueFamilyIndexCount = uint32(len(imageCreateInfo.PQueueFamilyIndices))
+	}
+
+	var img image
+	result := vulkan.CreateImage(ctx.device, &imageCreateInfo, nil, &img.handle)
+	panicOnError(result, "create "+name)
+	ctx.nameObject(vulkan.ObjectTypeImage, unsafe.Pointer(img.handle), name)
+
+	var imageMemoryRequirements vulkan.MemoryRequirements
+	vulkan.GetImageMemoryRequirements(ctx.device, img.handle, &imageMemoryRequirements)
+	imageMemoryRequirements.Deref()
+
+	memoryTypeIndex := ctx.findMemoryTypeIndex(&imageMemoryRequirements, vulkan.MemoryPropertyFlags(vulkan.MemoryPropertyDeviceLocalBit))
+	if memoryTypeIndex == vulkan.MaxUint32 {
+		log.PanicfCore("Could not find memory type to allocate %s memory", name)
+	}
+
+	memoryAllocateInfo := vulkan.MemoryAllocateInfo{
+		SType:           vulkan.StructureTypeMemoryAllocateInfo,
+		AllocationSize:  imageMemoryRequirements.Size,
+		MemoryTypeIndex: memoryTypeIndex,
+	}
+	result = vulkan.AllocateMemory(ctx.device, &memoryAllocateInfo, nil, &img.memory)
+	panicOnError(result, "allocate "+name+" memory")
+	result = vulkan.BindImageMemory(ctx.device, img.handle, img.memory, 0)
+	panicOnError(result, "bind "+name+" memory")
+
+	imageViewCreateInfo := vulkan.ImageViewCreateInfo{
+		SType:      vulkan.StructureTypeImageViewCreateInfo,
+		Image:      img.handle,
+		ViewType:   vulkan.ImageViewType2d,
+		Format:     format,
+		Components: vulkan.ComponentMapping{}, // Use identity mapping for rgba components
+		SubresourceRange: vulkan.ImageSubresourceRange{
+			AspectMask:     vulkan.ImageAspectFlags(aspectMask),
+			BaseMipLevel:   0,
+			LevelCount:     levels,
+			BaseArrayLayer: 0,
+			LayerCount:     1,
+		},
+	}
+
+	result = vulkan.CreateImageView(ctx.device, &imageViewCreateInfo, nil, &img.view)
+	panicOnError(result, "create "+name+" view")
+	ctx.nameObject(vulkan.ObjectTypeImageView, unsafe.Pointer(img.view), name+" view")
+
+	return img
+}
+
+func (ctx *Context) destroyImage(img image) {
+	vulkan.DestroyImageView(ctx.device, img.view, nil)
+	vulkan.DestroyImage(ctx.device, img.handle, nil)
+	vulkan.FreeMemory(ctx.device, img.memory, nil)
+}
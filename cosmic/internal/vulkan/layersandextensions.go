@@ -4,12 +4,18 @@ import (
 	"bytes"
 	"github.com/lentus/cosmic-engine/cosmic/log"
 	"github.com/vulkan-go/vulkan"
+	"strings"
 )
 
 func (ctx *Context) setupLayersAndExtensions() {
 	ctx.availableInstanceLayers = getInstanceLayers()
 	ctx.availableInstanceExtensions = getInstanceExtensions()
 
+	// Offscreen contexts do not present, so they need no surface or swapchain
+	if ctx.offscreen {
+		return
+	}
+
 	requiredInstanceExtensions := ctx.nativeWindow.GetRequiredInstanceExtensions()
 
 	log.DebugCore("Required instance extensions:")
@@ -45,6 +51,28 @@ func getInstanceExtensions() []vulkan.ExtensionProperties {
 	return extensionPropertiesList
 }
 
+func (ctx *Context) instanceExtensionAvailable(extensionName string) bool {
+	for _, extension := range ctx.availableInstanceExtensions {
+		extension.Deref()
+
+		if string(bytes.Trim(extension.ExtensionName[:], "\x00")) == extensionName {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (ctx *Context) instanceExtensionEnabled(extensionName string) bool {
+	for _, extension := range ctx.enabledInstanceExtensions {
+		if strings.TrimRight(extension, "\x00") == extensionName {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (ctx *Context) enableLayerIfAvailable(layerName string) {
 	for _, instanceLayer := range ctx.availableInstanceLayers {
 		instanceLayer.Deref()
@@ -0,0 +1,36 @@
+#include "loader.h"
+
+#if defined(_WIN32)
+#include <windows.h>
+
+void *cosmicLoadVulkan(void) {
+	HMODULE library = LoadLibraryA("vulkan-1.dll");
+	if (!library) {
+		return 0;
+	}
+
+	return (void *) GetProcAddress(library, "vkGetInstanceProcAddr");
+}
+#else
+#include <dlfcn.h>
+
+void *cosmicLoadVulkan(void) {
+	const char *names[] = {
+#if defined(__APPLE__)
+		"libvulkan.1.dylib", "libvulkan.dylib", "libMoltenVK.dylib",
+#else
+		// Only development packages install the unversioned library
+		"libvulkan.so.1", "libvulkan.so",
+#endif
+	};
+
+	for (unsigned long i = 0; i < sizeof(names) / sizeof(names[0]); i++) {
+		void *library = dlopen(names[i], RTLD_NOW | RTLD_LOCAL);
+		if (library) {
+			return dlsym(library, "vkGetInstanceProcAddr");
+		}
+	}
+
+	return 0;
+}
+#endif
@@ -0,0 +1,51 @@
+package vulkan
+
+/*
+#cgo linux LDFLAGS: -ldl
+#include "loader.h"
+*/
+import "C"
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/log"
+	"github.com/vulkan-go/vulkan"
+	"unsafe"
+)
+
+// The vkGetInstanceProcAddr through which Vulkan was initialised, used to
+// load the functions the Go bindings do not provide.
+var getInstanceProcAddr unsafe.Pointer
+
+// initVulkan loads the global Vulkan functions through the given
+// vkGetInstanceProcAddr. When it is nil, the system Vulkan library is loaded
+// directly, so Vulkan can be used without a window library.
+func initVulkan(procAddr unsafe.Pointer) {
+	if procAddr == nil {
+		procAddr = C.cosmicLoadVulkan()
+		if procAddr == nil {
+			log.PanicCore("failed to load the Vulkan library, make sure a Vulkan driver is installed")
+		}
+	}
+
+	getInstanceProcAddr = procAddr
+	vulkan.SetGetInstanceProcAddr(procAddr)
+	if err := vulkan.Init(); err != nil {
+		log.PanicfCore("failed to initialise Vulkan, %s", err.Error())
+	}
+}
+
+// Available reports whether a Vulkan driver is installed with an adapter the
+// engine can render with.
+func Available() bool {
+	if C.cosmicLoadVulkan() == nil {
+		return false
+	}
+
+	for _, adapter := range Adapters() {
+		if adapter.Suitable {
+			return true
+		}
+	}
+
+	return false
+}
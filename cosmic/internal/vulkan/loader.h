@@ -0,0 +1,8 @@
+#ifndef COSMIC_LOADER_H
+#define COSMIC_LOADER_H
+
+// cosmicLoadVulkan opens the system Vulkan library and returns its
+// vkGetInstanceProcAddr, or null when no Vulkan library is installed.
+void *cosmicLoadVulkan(void);
+
+#endif
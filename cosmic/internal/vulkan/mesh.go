@@ -0,0 +1,86 @@
+package vulkan
+
+import (
+	"encoding/binary"
+	"github.com/lentus/cosmic-engine/cosmic/graphics"
+	"github.com/lentus/cosmic-engine/cosmic/log"
+	"github.com/vulkan-go/vulkan"
+)
+
+// meshBuffers live in device local memory, which the host cannot map, so
+// they are filled through a staging buffer.
+type meshBuffers struct {
+	ctx         *Context
+	vertices    buffer
+	indices     buffer
+	vertexCount int
+	indexCount  int
+}
+
+func (ctx *Context) UploadMesh(vertices []byte, stride int, indices []uint32) graphics.MeshBuffers {
+	if stride <= 0 || len(vertices) == 0 || len(vertices)%stride != 0 {
+		log.PanicfCore("invalid mesh of %d bytes with a vertex stride of %d", len(vertices), stride)
+	}
+	if len(indices) == 0 {
+		log.PanicCore("cannot upload a mesh without indices")
+	}
+
+	indexData := make([]byte, len(indices)*4)
+	for i, index := range indices {
+		binary.LittleEndian.PutUint32(indexData[i*4:], index)
+	}
+
+	return &meshBuffers{
+		ctx:         ctx,
+		vertices:    ctx.createDeviceLocalBuffer(vertices, vulkan.BufferUsageVertexBufferBit, "mesh vertex buffer"),
+		indices:     ctx.createDeviceLocalBuffer(indexData, vulkan.BufferUsageIndexBufferBit, "mesh index buffer"),
+		vertexCount: len(vertices) / stride,
+		indexCount:  len(indices),
+	}
+}
+
+// createDeviceLocalBuffer creates a buffer the host cannot access and copies
+// the data into it.
+func (ctx *Context) createDeviceLocalBuffer(data []byte, usage vulkan.BufferUsageFlagBits, name string) buffer {
+	staging := ctx.createBuffer(
+		uint64(len(data)),
+		vulkan.BufferUsageTransferSrcBit,
+		vulkan.MemoryPropertyHostVisibleBit|vulkan.MemoryPropertyHostCoherentBit,
+		name+" staging buffer",
+	)
+	defer ctx.destroyBuffer(staging)
+	ctx.write(staging, 0, data)
+
+	buf := ctx.createBuffer(
+		uint64(len(data)),
+		usage|vulkan.BufferUsageTransferDstBit,
+		vulkan.MemoryPropertyDeviceLocalBit,
+		name,
+	)
+
+	ctx.submitOneTimeCommands(ctx.graphicsQueue, ctx.commandPool, name+" upload", func(commandBuffer vulkan.CommandBuffer) {
+		vulkan.CmdCopyBuffer(commandBuffer, staging.handle, buf.handle, 1, []vulkan.BufferCopy{{Size: vulkan.DeviceSize(len(data))}})
+
+		memoryBarrier(commandBuffer,
+			vulkan.PipelineStageTransferBit, vulkan.AccessTransferWriteBit,
+			vulkan.PipelineStageVertexInputBit, vulkan.AccessVertexAttributeReadBit|vulkan.AccessIndexReadBit)
+	})
+
+	return buf
+}
+
+func (m *meshBuffers) VertexCount() int {
+	return m.vertexCount
+}
+
+func (m *meshBuffers) IndexCount() int {
+	return m.indexCount
+}
+
+// Destroy waits for the device to be idle, since frames in flight may still
+// read the buffers.
+func (m *meshBuffers) Destroy() {
+	vulkan.DeviceWaitIdle(m.ctx.device)
+	m.ctx.destroyBuffer(m.vertices)
+	m.ctx.destroyBuffer(m.indices)
+}
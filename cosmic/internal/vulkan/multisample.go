@@ -0,0 +1,102 @@
+package vulkan
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/graphics"
+	"github.com/lentus/cosmic-engine/cosmic/log"
+	"github.com/vulkan-go/vulkan"
+)
+
+// supportedSampleCounts lists the sample counts the gpu supports for both
+// color and depth attachments.
+func (ctx *Context) supportedSampleCounts() []int {
+	limits := ctx.gpu.properties.Limits
+	flags := limits.FramebufferColorSampleCounts & limits.FramebufferDepthSampleCounts
+
+	var counts []int
+	for count := vulkan.SampleCount1Bit; count <= vulkan.SampleCount64Bit; count <<= 1 {
+		if flags&vulkan.SampleCountFlags(count) != 0 {
+			// The flag of every sample count equals the count itself
+			counts = append(counts, int(count))
+		}
+	}
+
+	return counts
+}
+
+// pickSampleCount selects the sample count to render with from the requested
+// count in the context properties.
+func (ctx *Context) pickSampleCount() {
+	chosen := graphics.ChooseSampleCount(ctx.properties.Samples, ctx.supportedSampleCounts())
+	if chosen < ctx.properties.Samples {
+		log.WarnfCore("%d samples per pixel are not supported, using %d", ctx.properties.Samples, chosen)
+	}
+	log.DebugfCore("Rendering with %d samples per pixel", chosen)
+
+	ctx.samples = vulkan.SampleCountFlagBits(chosen)
+}
+
+func (ctx *Context) multisampled() bool {
+	return ctx.samples > vulkan.SampleCount1Bit
+}
+
+// createMultisampleImage creates the color image rendered to when
+// multisampling, which is resolved into the image presented or read back.
+func (ctx *Context) createMultisampleImage() {
+	if !ctx.multisampled() {
+		return
+	}
+
+	log.DebugfCore("Creating Vulkan %dx multisample color image", ctx.samples)
+	ctx.multisampleColor = ctx.createImage(
+		ctx.imageExtent,
+		ctx.colorFormat,
+		ctx.samples,
+		vulkan.ImageUsageColorAttachmentBit|vulkan.ImageUsageTransientAttachmentBit,
+		vulkan.ImageAspectColorBit,
+		"multisample color image",
+	)
+}
+
+func (ctx *Context) destroyMultisampleImage() {
+	if ctx.multisampleColor.handle != nil {
+		ctx.destroyImage(ctx.multisampleColor)
+		ctx.multisampleColor = image{}
+	}
+}
+
+func (ctx *Context) SetSamples(samples int) {
+	ctx.properties.Samples = samples
+	ctx.samplesChanged = true
+}
+
+func (ctx *Context) Samples() int {
+	return int(ctx.samples)
+}
+
+// applySampleCount recreates the render pass, pipelines and attachments when
+// the sample count was changed.
+func (ctx *Context) applySampleCount() {
+	ctx.samplesChanged = false
+
+	previous := ctx.samples
+	ctx.pickSampleCount()
+	if ctx.samples == previous {
+		return
+	}
+
+	vulkan.DeviceWaitIdle(ctx.device)
+	ctx.finishCaptures(0, true)
+
+	ctx.destroyFramebuffers()
+	ctx.freeCommandBuffers()
+	ctx.destroyImage(ctx.depthStencil)
+	ctx.destroyMultisampleImage()
+	ctx.destroyPipelines()
+	vulkan.DestroyRenderPass(ctx.device, ctx.renderPass, nil)
+
+	ctx.createDepthStencilImage()
+	ctx.createMultisampleImage()
+	ctx.createRenderPass()
+	ctx.createFramebuffers()
+	ctx.createCommandBuffers()
+}
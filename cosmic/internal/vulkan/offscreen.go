@@ -0,0 +1,65 @@
+package vulkan
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/log"
+	"github.com/vulkan-go/vulkan"
+)
+
+// Format of offscreen images, matching the sRGB encoding of the swapchain
+// images but in RGBA order.
+const offscreenColorFormat = vulkan.FormatR8g8b8a8Srgb
+
+func (ctx *Context) createOffscreenImages() {
+	log.DebugfCore("Creating %dx%d offscreen image", ctx.imageExtent.Width, ctx.imageExtent.Height)
+
+	ctx.colorFormat = offscreenColorFormat
+	color := ctx.createImage(
+		ctx.imageExtent,
+		ctx.colorFormat,
+		vulkan.SampleCount1Bit,
+		vulkan.ImageUsageColorAttachmentBit|vulkan.ImageUsageTransferSrcBit,
+		vulkan.ImageAspectColorBit,
+		"offscreen image",
+	)
+
+	ctx.imageResourceSets = []imageResourceSet{{
+		image:  color.handle,
+		view:   color.view,
+		memory: color.memory,
+	}}
+}
+
+func (ctx *Context) destroyOffscreenImages() {
+	for _, imageResourceSet := range ctx.imageResourceSets {
+		ctx.destroyImage(image{
+			handle: imageResourceSet.image,
+			memory: imageResourceSet.memory,
+			view:   imageResourceSet.view,
+		})
+	}
+}
+
+// Resize changes the size of the images an offscreen context renders to.
+func (ctx *Context) Resize(width, height int) {
+	if !ctx.offscreen {
+		log.PanicCore("only offscreen contexts can be resized, windows resize their context themselves")
+	}
+
+	ctx.cleanupRenderTargets()
+
+	ctx.imageExtent = vulkan.Extent2D{Width: uint32(width), Height: uint32(height)}
+	ctx.createOffscreenImages()
+	ctx.createDepthStencilImage()
+	ctx.createMultisampleImage()
+	ctx.createFramebuffers()
+	ctx.createCommandBuffers()
+
+	// The fences refer to frames rendered to the previous images
+	for i := range ctx.imagesInFlightFences {
+		ctx.imagesInFlightFences[i] = nil
+	}
+}
+
+func (ctx *Context) Size() (width, height int) {
+	return int(ctx.imageExtent.Width), int(ctx.imageExtent.Height)
+}
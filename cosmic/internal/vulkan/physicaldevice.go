@@ -2,58 +2,92 @@ package vulkan
 
 import (
 	"bytes"
+	"github.com/lentus/cosmic-engine/cosmic/graphics"
 	"github.com/lentus/cosmic-engine/cosmic/log"
 	"github.com/vulkan-go/vulkan"
+	"os"
+	"runtime"
+	"strings"
 )
 
 type physicalDevice struct {
 	ref              vulkan.PhysicalDevice
+	adapter          graphics.Adapter
 	properties       vulkan.PhysicalDeviceProperties
 	memoryProperties vulkan.PhysicalDeviceMemoryProperties
 	features         vulkan.PhysicalDeviceFeatures
 	queueFamilies    queueFamilies
 }
 
+// requiredFeatures lists the device features the engine depends on, they are
+// enabled when creating the logical device.
+var requiredFeatures = []struct {
+	name      string
+	supported func(features vulkan.PhysicalDeviceFeatures) vulkan.Bool32
+	enable    func(features *vulkan.PhysicalDeviceFeatures)
+}{
+	{
+		name:      "fillModeNonSolid",
+		supported: func(features vulkan.PhysicalDeviceFeatures) vulkan.Bool32 { return features.FillModeNonSolid },
+		enable:    func(features *vulkan.PhysicalDeviceFeatures) { features.FillModeNonSolid = vulkan.True },
+	},
+	{
+		// 2D batches index their textures with a value that is uniform
+		// within each draw call
+		name: "shaderSampledImageArrayDynamicIndexing",
+		supported: func(features vulkan.PhysicalDeviceFeatures) vulkan.Bool32 {
+			return features.ShaderSampledImageArrayDynamicIndexing
+		},
+		enable: func(features *vulkan.PhysicalDeviceFeatures) {
+			features.ShaderSampledImageArrayDynamicIndexing = vulkan.True
+		},
+	},
+}
+
 func (ctx *Context) selectPhysicalDevice() {
 	log.DebugCore("Selecting gpu")
 
-	var gpuCount uint32
-	vulkan.EnumeratePhysicalDevices(ctx.instance, &gpuCount, nil)
-	gpus := make([]vulkan.PhysicalDevice, gpuCount)
-	result := vulkan.EnumeratePhysicalDevices(ctx.instance, &gpuCount, gpus)
-	panicOnError(result, "retrieve gpu list")
-
+	gpus := getPhysicalDevices(ctx.instance)
 	log.DebugfCore("Found %d gpu(s)", len(gpus))
-	var selected vulkan.PhysicalDevice
-	for _, gpu := range gpus {
-		gpuProperties := getProperties(gpu)
-
-		log.DebugfCore("\tName           %s", gpuProperties.DeviceName)
-		log.DebugfCore("\tID             %d", gpuProperties.DeviceID)
-		log.DebugfCore("\tType           %d", gpuProperties.DeviceType)
-		log.DebugfCore("\tAPI version    %d", gpuProperties.ApiVersion)
-		log.DebugfCore("\tVendor ID      %d", gpuProperties.VendorID)
-		log.DebugfCore("\tDriver version %d", gpuProperties.DriverVersion)
-		log.DebugCore("")
-
-		if isDeviceSuitable(gpu, ctx.surface.ref, ctx.enabledDeviceExtensions) && selected == nil {
-			// TODO find best performing one
-			selected = gpu
+
+	adapters := make([]graphics.Adapter, len(gpus))
+	for i, gpu := range gpus {
+		adapters[i] = describeAdapter(i, gpu, ctx.enabledDeviceExtensions)
+		if adapters[i].Suitable && !ctx.offscreen && !canPresent(gpu, ctx.surface.ref) {
+			adapters[i].Suitable = false
+			adapters[i].Unsupported = "cannot present to the window surface"
+		}
+
+		log.DebugfCore("\t%s", adapters[i])
+		if !adapters[i].Suitable {
+			log.DebugfCore("\t\tunsuitable: %s", adapters[i].Unsupported)
 		}
 	}
 
-	if selected == nil {
-		log.PanicCore("failed to find a suitable gpu")
+	preference := os.Getenv(graphics.AdapterEnvironmentVariable)
+	if preference == "" {
+		preference = ctx.properties.Adapter
 	}
 
+	index, err := graphics.ChooseAdapter(adapters, preference)
+	if err != nil && preference != "" {
+		log.WarnfCore("Ignoring adapter preference - %s", err.Error())
+		index, err = graphics.ChooseAdapter(adapters, "")
+	}
+	if err != nil {
+		log.PanicfCore("failed to select a gpu: %s", err.Error())
+	}
+
+	selected := gpus[index]
 	ctx.gpu = physicalDevice{
 		ref:              selected,
+		adapter:          adapters[index],
 		properties:       getProperties(selected),
 		memoryProperties: getMemoryProperties(selected),
 		features:         getFeatures(selected),
 		queueFamilies:    findQueueFamilies(selected, ctx.surface.ref),
 	}
-	log.InfofCore("\tUsing %s", string(ctx.gpu.properties.DeviceName[:]))
+	log.InfofCore("\tUsing %s", ctx.gpu.adapter)
 
 	ctx.availableDeviceExtensions = getExtensions(ctx.gpu.ref)
 	log.DebugfCore("Device extensions (%d):", len(ctx.availableDeviceExtensions))
@@ -63,36 +97,155 @@ func (ctx *Context) selectPhysicalDevice() {
 	}
 }
 
-func isDeviceSuitable(gpu vulkan.PhysicalDevice, surface vulkan.Surface, enabledExtensions []string) bool {
-	// Check whether all required queue families are present
-	indices := findQueueFamilies(gpu, surface)
-	if !indices.complete() {
-		return false
+// Adapters lists the adapters on this system, without creating a window.
+// Whether an adapter can present to a window is only known once the window
+// exists, so that is not taken into account here.
+func Adapters() []graphics.Adapter {
+	initVulkan(nil)
+
+	applicationInfo := vulkan.ApplicationInfo{
+		SType:       vulkan.StructureTypeApplicationInfo,
+		ApiVersion:  vulkan.ApiVersion10,
+		PEngineName: safeStr("Cosmic Engine"),
+	}
+	instanceCreateInfo := vulkan.InstanceCreateInfo{
+		SType:            vulkan.StructureTypeInstanceCreateInfo,
+		PApplicationInfo: &applicationInfo,
+	}
+
+	var instance vulkan.Instance
+	result := vulkan.CreateInstance(&instanceCreateInfo, nil, &instance)
+	panicOnError(result, "create Vulkan instance")
+	defer vulkan.DestroyInstance(instance, nil)
+
+	if err := vulkan.InitInstance(instance); err != nil {
+		log.PanicfCore("failed to initialise Vulkan instance (%s)", err.Error())
+	}
+
+	requiredExtensions := []string{safeStr(vulkan.KhrSwapchainExtensionName)}
+
+	var adapters []graphics.Adapter
+	for i, gpu := range getPhysicalDevices(instance) {
+		adapters = append(adapters, describeAdapter(i, gpu, requiredExtensions))
+	}
+
+	return adapters
+}
+
+func getPhysicalDevices(instance vulkan.Instance) []vulkan.PhysicalDevice {
+	var gpuCount uint32
+	vulkan.EnumeratePhysicalDevices(instance, &gpuCount, nil)
+	gpus := make([]vulkan.PhysicalDevice, gpuCount)
+	result := vulkan.EnumeratePhysicalDevices(instance, &gpuCount, gpus)
+	panicOnError(result, "retrieve gpu list")
+
+	return gpus
+}
+
+var adapterTypes = map[vulkan.PhysicalDeviceType]graphics.AdapterType{
+	vulkan.PhysicalDeviceTypeOther:         graphics.AdapterOther,
+	vulkan.PhysicalDeviceTypeIntegratedGpu: graphics.AdapterIntegrated,
+	vulkan.PhysicalDeviceTypeDiscreteGpu:   graphics.AdapterDiscrete,
+	vulkan.PhysicalDeviceTypeVirtualGpu:    graphics.AdapterVirtual,
+	vulkan.PhysicalDeviceTypeCpu:           graphics.AdapterCPU,
+}
+
+// describeAdapter collects the properties of a gpu and checks whether it has
+// a graphics queue and supports all required extensions and features.
+func describeAdapter(index int, gpu vulkan.PhysicalDevice, requiredExtensions []string) graphics.Adapter {
+	properties := getProperties(gpu)
+
+	adapter := graphics.Adapter{
+		Index:         index,
+		Name:          string(bytes.Trim(properties.DeviceName[:], "\x00")),
+		Type:          adapterTypes[properties.DeviceType],
+		VendorID:      properties.VendorID,
+		Vendor:        graphics.VendorName(properties.VendorID),
+		DeviceID:      properties.DeviceID,
+		DriverVersion: graphics.FormatDriverVersion(properties.VendorID, properties.DriverVersion, runtime.GOOS == "windows"),
+		APIVersion:    graphics.ParseVersion(properties.ApiVersion),
+		DeviceMemory:  deviceLocalMemory(getMemoryProperties(gpu)),
+		Suitable:      true,
+	}
+
+	if missing := missingExtensions(gpu, requiredExtensions); len(missing) > 0 {
+		adapter.Suitable = false
+		adapter.Unsupported = "missing extensions " + strings.Join(missing, ", ")
+	}
+
+	features := getFeatures(gpu)
+	for _, feature := range requiredFeatures {
+		if feature.supported(features) != vulkan.True {
+			adapter.Suitable = false
+			adapter.Unsupported = "missing feature " + feature.name
+		}
+	}
+
+	if !hasGraphicsQueue(gpu) {
+		adapter.Suitable = false
+		adapter.Unsupported = "no graphics queue"
+	}
+
+	return adapter
+}
+
+func deviceLocalMemory(memoryProperties vulkan.PhysicalDeviceMemoryProperties) uint64 {
+	var size uint64
+	for i := uint32(0); i < memoryProperties.MemoryHeapCount; i++ {
+		heap := memoryProperties.MemoryHeaps[i]
+		heap.Deref()
+
+		if heap.Flags&vulkan.MemoryHeapFlags(vulkan.MemoryHeapDeviceLocalBit) != 0 {
+			size += uint64(heap.Size)
+		}
 	}
 
-	// Check whether all enabled device extensions are supported
-	availableExtensions := getExtensions(gpu)
+	return size
+}
+
+func missingExtensions(gpu vulkan.PhysicalDevice, requiredExtensions []string) []string {
 	availableExtensionMap := make(map[string]bool)
-	for _, availableExtension := range availableExtensions {
+	for _, availableExtension := range getExtensions(gpu) {
 		availableExtension.Deref()
 		index := string(bytes.Trim(availableExtension.ExtensionName[:], "\x00"))
 		availableExtensionMap[safeStr(index)] = true
 	}
 
-	for _, requiredExtension := range enabledExtensions {
+	var missing []string
+	for _, requiredExtension := range requiredExtensions {
 		if _, extensionSupported := availableExtensionMap[requiredExtension]; !extensionSupported {
-			return false
+			missing = append(missing, strings.TrimRight(requiredExtension, "\x00"))
 		}
 	}
 
-	// Check whether surface can be drawn to
+	return missing
+}
+
+// canPresent checks whether the gpu has a queue family that can present to
+// the surface, and whether the surface can be drawn to.
+func canPresent(gpu vulkan.PhysicalDevice, surface vulkan.Surface) bool {
+	if !findQueueFamilies(gpu, surface).complete() {
+		return false
+	}
+
 	return len(getSurfaceFormats(gpu, surface)) > 0 && len(getPresentModes(gpu, surface)) > 0
 }
 
+// enabledFeatures returns the features to enable on the logical device.
+func enabledFeatures() vulkan.PhysicalDeviceFeatures {
+	var features vulkan.PhysicalDeviceFeatures
+	for _, feature := range requiredFeatures {
+		feature.enable(&features)
+	}
+
+	return features
+}
+
 func getProperties(gpu vulkan.PhysicalDevice) vulkan.PhysicalDeviceProperties {
 	var gpuProperties vulkan.PhysicalDeviceProperties
 	vulkan.GetPhysicalDeviceProperties(gpu, &gpuProperties)
 	gpuProperties.Deref()
+	gpuProperties.Limits.Deref()
 
 	return gpuProperties
 }
@@ -128,6 +281,11 @@ type queueFamilies struct {
 
 	presentIndex    uint32
 	hasPresentIndex bool
+
+	// A family supporting compute but not graphics, whose queues can run
+	// compute work while the graphics queue renders
+	asyncComputeIndex    uint32
+	hasAsyncComputeIndex bool
 }
 
 func (qf queueFamilies) complete() bool {
@@ -138,6 +296,11 @@ func (qf queueFamilies) hasSeparatePresentQueue() bool {
 	return qf.graphicsIndex != qf.presentIndex
 }
 
+// findQueueFamilies looks for queue families supporting graphics and
+// presentation to the surface, and for a dedicated compute family. Without a
+// surface, the graphics queue family is used for presentation as well. The
+// graphics family must support compute too, which Vulkan guarantees for at
+// least one graphics family.
 func findQueueFamilies(device vulkan.PhysicalDevice, surface vulkan.Surface) queueFamilies {
 	var familyCount uint32
 	vulkan.GetPhysicalDeviceQueueFamilyProperties(device, &familyCount, nil)
@@ -148,22 +311,55 @@ func findQueueFamilies(device vulkan.PhysicalDevice, surface vulkan.Surface) que
 	for i, properties := range queueFamilyPropertiesList {
 		properties.Deref()
 
-		if properties.QueueFlags&vulkan.QueueFlags(vulkan.QueueGraphicsBit) != 0 {
+		graphics := properties.QueueFlags&vulkan.QueueFlags(vulkan.QueueGraphicsBit) != 0
+		compute := properties.QueueFlags&vulkan.QueueFlags(vulkan.QueueComputeBit) != 0
+
+		if compute && !graphics && !queueFamilies.hasAsyncComputeIndex {
+			queueFamilies.asyncComputeIndex = uint32(i)
+			queueFamilies.hasAsyncComputeIndex = true
+		}
+
+		if queueFamilies.complete() {
+			continue
+		}
+
+		if graphics && compute {
 			queueFamilies.graphicsIndex = uint32(i)
 			queueFamilies.hasGraphicsIndex = true
 		}
 
-		var presentSupported vulkan.Bool32
-		vulkan.GetPhysicalDeviceSurfaceSupport(device, uint32(i), surface, &presentSupported)
-		if presentSupported == vulkan.True {
+		if surface == vulkan.NullSurface {
+			queueFamilies.presentIndex = queueFamilies.graphicsIndex
+			queueFamilies.hasPresentIndex = queueFamilies.hasGraphicsIndex
+		} else if presentSupported(device, uint32(i), surface) {
 			queueFamilies.presentIndex = uint32(i)
 			queueFamilies.hasPresentIndex = true
 		}
+	}
 
-		if queueFamilies.complete() {
-			break
+	return queueFamilies
+}
+
+func presentSupported(device vulkan.PhysicalDevice, queueFamilyIndex uint32, surface vulkan.Surface) bool {
+	var supported vulkan.Bool32
+	vulkan.GetPhysicalDeviceSurfaceSupport(device, queueFamilyIndex, surface, &supported)
+
+	return supported == vulkan.True
+}
+
+func hasGraphicsQueue(device vulkan.PhysicalDevice) bool {
+	var familyCount uint32
+	vulkan.GetPhysicalDeviceQueueFamilyProperties(device, &familyCount, nil)
+	queueFamilyPropertiesList := make([]vulkan.QueueFamilyProperties, familyCount)
+	vulkan.GetPhysicalDeviceQueueFamilyProperties(device, &familyCount, queueFamilyPropertiesList)
+
+	for _, properties := range queueFamilyPropertiesList {
+		properties.Deref()
+
+		if properties.QueueFlags&vulkan.QueueFlags(vulkan.QueueGraphicsBit) != 0 {
+			return true
 		}
 	}
 
-	return queueFamilies
+	return false
 }
@@ -0,0 +1,129 @@
+package vulkan
+
+import (
+	"encoding/binary"
+	"github.com/lentus/cosmic-engine/cosmic/log"
+	"github.com/vulkan-go/vulkan"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"unsafe"
+)
+
+// Size of the header that precedes the pipeline cache data, as defined by
+// the Vulkan specification for VK_PIPELINE_CACHE_HEADER_VERSION_ONE.
+const pipelineCacheHeaderSize = 16 + vulkan.UuidSize
+
+// pipelineCachePath returns the file in which the pipeline cache is stored.
+func (ctx *Context) pipelineCachePath() string {
+	if ctx.properties.PipelineCachePath != "" {
+		return ctx.properties.PipelineCachePath
+	}
+
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		log.WarnfCore("Cannot determine cache directory, pipeline cache is not persisted - %s", err.Error())
+		return ""
+	}
+
+	return filepath.Join(cacheDir, "cosmic-engine", "pipeline-cache.bin")
+}
+
+// createPipelineCache creates the pipeline cache, seeded with the data of a
+// previous run when it was created by the same gpu and driver.
+func (ctx *Context) createPipelineCache() {
+	var initialData []byte
+	if path := ctx.pipelineCachePath(); path != "" {
+		data, err := ioutil.ReadFile(path)
+		switch {
+		case os.IsNotExist(err):
+			log.DebugCore("No pipeline cache found, starting with an empty cache")
+		case err != nil:
+			log.WarnfCore("Failed to read pipeline cache %s - %s", path, err.Error())
+		case !ctx.pipelineCacheCompatible(data):
+			log.InfoCore("Discarding pipeline cache created by a different gpu or driver")
+		default:
+			log.DebugfCore("Loaded pipeline cache of %d bytes from %s", len(data), path)
+			initialData = data
+		}
+	}
+
+	createInfo := vulkan.PipelineCacheCreateInfo{
+		SType:           vulkan.StructureTypePipelineCacheCreateInfo,
+		InitialDataSize: uint(len(initialData)),
+	}
+	if len(initialData) > 0 {
+		createInfo.PInitialData = unsafe.Pointer(&initialData[0])
+	}
+
+	var pipelineCache vulkan.PipelineCache
+	result := vulkan.CreatePipelineCache(ctx.device, &createInfo, nil, &pipelineCache)
+	panicOnError(result, "create pipeline cache")
+	ctx.pipelineCache = pipelineCache
+}
+
+// pipelineCacheCompatible checks whether the header of cache data matches the
+// selected gpu. Drivers should reject incompatible data themselves, but not
+// all of them do so reliably.
+func (ctx *Context) pipelineCacheCompatible(data []byte) bool {
+	if len(data) < pipelineCacheHeaderSize {
+		return false
+	}
+
+	headerSize := binary.LittleEndian.Uint32(data[0:])
+	headerVersion := binary.LittleEndian.Uint32(data[4:])
+	vendorID := binary.LittleEndian.Uint32(data[8:])
+	deviceID := binary.LittleEndian.Uint32(data[12:])
+
+	if headerSize < pipelineCacheHeaderSize || headerVersion != uint32(vulkan.PipelineCacheHeaderVersionOne) {
+		return false
+	}
+
+	properties := ctx.gpu.properties
+	if vendorID != properties.VendorID || deviceID != properties.DeviceID {
+		return false
+	}
+
+	for i := 0; i < vulkan.UuidSize; i++ {
+		if data[16+i] != properties.PipelineCacheUUID[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// savePipelineCache writes the contents of the pipeline cache to disk, so the
+// next run does not have to compile the same pipelines again.
+func (ctx *Context) savePipelineCache() {
+	path := ctx.pipelineCachePath()
+	if path == "" {
+		return
+	}
+
+	var size uint
+	result := vulkan.GetPipelineCacheData(ctx.device, ctx.pipelineCache, &size, nil)
+	if result != vulkan.Success || size == 0 {
+		log.WarnfCore("Failed to retrieve pipeline cache size (%s)", fmtResult(result))
+		return
+	}
+
+	data := make([]byte, size)
+	result = vulkan.GetPipelineCacheData(ctx.device, ctx.pipelineCache, &size, unsafe.Pointer(&data[0]))
+	if result != vulkan.Success {
+		log.WarnfCore("Failed to retrieve pipeline cache data (%s)", fmtResult(result))
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		log.WarnfCore("Failed to create pipeline cache directory - %s", err.Error())
+		return
+	}
+
+	if err := ioutil.WriteFile(path, data[:size], 0644); err != nil {
+		log.WarnfCore("Failed to write pipeline cache %s - %s", path, err.Error())
+		return
+	}
+
+	log.DebugfCore("Saved pipeline cache of %d bytes to %s", size, path)
+}
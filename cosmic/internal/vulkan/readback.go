@@ -0,0 +1,258 @@
+package vulkan
+
+import (
+	"fmt"
+	"github.com/lentus/cosmic-engine/cosmic/log"
+	"github.com/vulkan-go/vulkan"
+	stdimage "image"
+	"strconv"
+)
+
+// capture is a copy of a rendered image to host visible memory, which is
+// read once the frame it was recorded in has finished.
+type capture struct {
+	frame         int
+	buffer        buffer
+	commandBuffer vulkan.CommandBuffer
+	extent        vulkan.Extent2D
+	format        vulkan.Format
+	result        chan *stdimage.RGBA
+}
+
+// Capture requests a copy of the next frame. The returned channel receives
+// the frame once the gpu finished copying it, a few frames later, so the
+// frame being captured does not stall the application. The channel is closed
+// without a frame when the frame cannot be captured.
+func (ctx *Context) Capture() <-chan *stdimage.RGBA {
+	result := make(chan *stdimage.RGBA, 1)
+	if !ctx.captureSupported {
+		close(result)
+		return result
+	}
+	ctx.captureRequests = append(ctx.captureRequests, result)
+
+	return result
+}
+
+// ReadPixels copies the last image rendered by an offscreen context, waiting
+// for the gpu to finish rendering it.
+func (ctx *Context) ReadPixels() *stdimage.RGBA {
+	if !ctx.offscreen {
+		log.PanicCore("only offscreen contexts can read pixels directly, use Capture for windows")
+	}
+	if !ctx.rendered {
+		log.PanicCore("cannot read pixels before the first frame is rendered")
+	}
+
+	vulkan.DeviceWaitIdle(ctx.device)
+
+	c := ctx.recordCapture(0, make(chan *stdimage.RGBA, 1))
+	submitInfo := vulkan.SubmitInfo{
+		SType:              vulkan.StructureTypeSubmitInfo,
+		CommandBufferCount: 1,
+		PCommandBuffers:    []vulkan.CommandBuffer{c.commandBuffer},
+	}
+	result := vulkan.QueueSubmit(ctx.graphicsQueue, 1, []vulkan.SubmitInfo{submitInfo}, vulkan.NullFence)
+	panicOnError(result, "submit readback command buffer")
+	vulkan.QueueWaitIdle(ctx.graphicsQueue)
+
+	ctx.finishCapture(c)
+	return <-c.result
+}
+
+// recordCaptures records a copy of the image being rendered to for every
+// requested capture. The command buffers are submitted along with the frame.
+func (ctx *Context) recordCaptures(imageIndex uint32) []vulkan.CommandBuffer {
+	var commandBuffers []vulkan.CommandBuffer
+	for _, request := range ctx.captureRequests {
+		c := ctx.recordCapture(imageIndex, request)
+		ctx.captures = append(ctx.captures, c)
+		commandBuffers = append(commandBuffers, c.commandBuffer)
+	}
+	ctx.captureRequests = nil
+
+	return commandBuffers
+}
+
+func (ctx *Context) recordCapture(imageIndex uint32, request chan *stdimage.RGBA) *capture {
+	c := &capture{
+		frame:  ctx.currentFrame,
+		extent: ctx.imageExtent,
+		format: ctx.colorFormat,
+		result: request,
+	}
+
+	size := uint64(c.extent.Width) * uint64(c.extent.Height) * 4
+	c.buffer = ctx.createBuffer(
+		size,
+		vulkan.BufferUsageTransferDstBit,
+		vulkan.MemoryPropertyHostVisibleBit|vulkan.MemoryPropertyHostCoherentBit,
+		"capture buffer "+strconv.Itoa(int(imageIndex)),
+	)
+
+	commandBuffers := make([]vulkan.CommandBuffer, 1)
+	allocateInfo := vulkan.CommandBufferAllocateInfo{
+		SType:              vulkan.StructureTypeCommandBufferAllocateInfo,
+		CommandPool:        ctx.commandPool,
+		Level:              vulkan.CommandBufferLevelPrimary,
+		CommandBufferCount: 1,
+	}
+	result := vulkan.AllocateCommandBuffers(ctx.device, &allocateInfo, commandBuffers)
+	panicOnError(result, "allocate capture command buffer")
+	c.commandBuffer = commandBuffers[0]
+
+	beginInfo := vulkan.CommandBufferBeginInfo{
+		SType: vulkan.StructureTypeCommandBufferBeginInfo,
+		Flags: vulkan.CommandBufferUsageFlags(vulkan.CommandBufferUsageOneTimeSubmitBit),
+	}
+	result = vulkan.BeginCommandBuffer(c.commandBuffer, &beginInfo)
+	panicOnError(result, "start recording capture command buffer")
+	ctx.beginLabel(c.commandBuffer, "Capture", [4]float32{0.2, 0.8, 0.2, 1})
+
+	// Swapchain images must be moved out of and back into the present layout,
+	// offscreen images are already in the transfer layout
+	renderedLayout := vulkan.ImageLayoutPresentSrc
+	if ctx.offscreen {
+		renderedLayout = vulkan.ImageLayoutTransferSrcOptimal
+	}
+	colorImage := ctx.imageResourceSets[imageIndex].image
+
+	// The frame ends with a transition of the image, which the copy waits for
+	ctx.transitionImage(c.commandBuffer, colorImage, renderedLayout, vulkan.ImageLayoutTransferSrcOptimal,
+		vulkan.PipelineStageAllCommandsBit, vulkan.AccessColorAttachmentWriteBit,
+		vulkan.PipelineStageTransferBit, vulkan.AccessTransferReadBit)
+
+	region := vulkan.BufferImageCopy{
+		BufferOffset:      0,
+		BufferRowLength:   0, // Tightly packed
+		BufferImageHeight: 0,
+		ImageSubresource: vulkan.ImageSubresourceLayers{
+			AspectMask:     vulkan.ImageAspectFlags(vulkan.ImageAspectColorBit),
+			MipLevel:       0,
+			BaseArrayLayer: 0,
+			LayerCount:     1,
+		},
+		ImageOffset: vulkan.Offset3D{X: 0, Y: 0, Z: 0},
+		ImageExtent: vulkan.Extent3D{Width: c.extent.Width, Height: c.extent.Height, Depth: 1},
+	}
+	vulkan.CmdCopyImageToBuffer(c.commandBuffer, colorImage, vulkan.ImageLayoutTransferSrcOptimal,
+		c.buffer.handle, 1, []vulkan.BufferImageCopy{region})
+
+	ctx.transitionImage(c.commandBuffer, colorImage, vulkan.ImageLayoutTransferSrcOptimal, renderedLayout,
+		vulkan.PipelineStageTransferBit, vulkan.AccessTransferReadBit,
+		vulkan.PipelineStageBottomOfPipeBit, 0)
+
+	// Make the copy visible to the host
+	bufferBarrier := vulkan.BufferMemoryBarrier{
+		SType:               vulkan.StructureTypeBufferMemoryBarrier,
+		SrcAccessMask:       vulkan.AccessFlags(vulkan.AccessTransferWriteBit),
+		DstAccessMask:       vulkan.AccessFlags(vulkan.AccessHostReadBit),
+		SrcQueueFamilyIndex: vulkan.QueueFamilyIgnored,
+		DstQueueFamilyIndex: vulkan.QueueFamilyIgnored,
+		Buffer:              c.buffer.handle,
+		Offset:              0,
+		Size:                vulkan.DeviceSize(vulkan.WholeSize),
+	}
+	vulkan.CmdPipelineBarrier(c.commandBuffer,
+		vulkan.PipelineStageFlags(vulkan.PipelineStageTransferBit), vulkan.PipelineStageFlags(vulkan.PipelineStageHostBit),
+		0, 0, nil, 1, []vulkan.BufferMemoryBarrier{bufferBarrier}, 0, nil)
+
+	ctx.endLabel(c.commandBuffer)
+	result = vulkan.EndCommandBuffer(c.commandBuffer)
+	panicOnError(result, "stop recording capture command buffer")
+
+	return c
+}
+
+func (ctx *Context) transitionImage(
+	commandBuffer vulkan.CommandBuffer,
+	img vulkan.Image,
+	oldLayout, newLayout vulkan.ImageLayout,
+	srcStage vulkan.PipelineStageFlagBits, srcAccess vulkan.AccessFlagBits,
+	dstStage vulkan.PipelineStageFlagBits, dstAccess vulkan.AccessFlagBits,
+) {
+	barrier := vulkan.ImageMemoryBarrier{
+		SType:               vulkan.StructureTypeImageMemoryBarrier,
+		SrcAccessMask:       vulkan.AccessFlags(srcAccess),
+		DstAccessMask:       vulkan.AccessFlags(dstAccess),
+		OldLayout:           oldLayout,
+		NewLayout:           newLayout,
+		SrcQueueFamilyIndex: vulkan.QueueFamilyIgnored,
+		DstQueueFamilyIndex: vulkan.QueueFamilyIgnored,
+		Image:               img,
+		SubresourceRange: vulkan.ImageSubresourceRange{
+			AspectMask:     vulkan.ImageAspectFlags(vulkan.ImageAspectColorBit),
+			BaseMipLevel:   0,
+			LevelCount:     vulkan.RemainingMipLevels,
+			BaseArrayLayer: 0,
+			LayerCount:     1,
+		},
+	}
+
+	vulkan.CmdPipelineBarrier(commandBuffer,
+		vulkan.PipelineStageFlags(srcStage), vulkan.PipelineStageFlags(dstStage),
+		0, 0, nil, 0, nil, 1, []vulkan.ImageMemoryBarrier{barrier})
+}
+
+// finishCaptures reads back the captures recorded in the given frame, whose
+// fence was just waited for. Without a frame, all captures are finished,
+// which requires the device to be idle.
+func (ctx *Context) finishCaptures(frame int, all bool) {
+	remaining := ctx.captures[:0]
+	for _, c := range ctx.captures {
+		if all || c.frame == frame {
+			ctx.finishCapture(c)
+		} else {
+			remaining = append(remaining, c)
+		}
+	}
+	ctx.captures = remaining
+}
+
+// finishCapture copies the captured pixels out of the buffer and converts them
+// on a separate goroutine.
+func (ctx *Context) finishCapture(c *capture) {
+	data := ctx.read(c.buffer)
+
+	vulkan.FreeCommandBuffers(ctx.device, ctx.commandPool, 1, []vulkan.CommandBuffer{c.commandBuffer})
+	ctx.destroyBuffer(c.buffer)
+
+	go func() {
+		img, err := convertToRGBA(data, int(c.extent.Width), int(c.extent.Height), c.format)
+		if err != nil {
+			log.ErrorfCore("Failed to convert captured frame - %s", err.Error())
+		} else {
+			c.result <- img
+		}
+		close(c.result)
+	}()
+}
+
+// convertToRGBA converts 8 bit per channel pixel data to an RGBA image. Both
+// the swapchain and offscreen images hold sRGB encoded values, which is what
+// image consumers such as PNG encoders expect, so only the channel order may
+// need to change.
+func convertToRGBA(data []byte, width, height int, format vulkan.Format) (*stdimage.RGBA, error) {
+	var swapRedBlue bool
+	switch format {
+	case vulkan.FormatB8g8r8a8Srgb, vulkan.FormatB8g8r8a8Unorm:
+		swapRedBlue = true
+	case vulkan.FormatR8g8b8a8Srgb, vulkan.FormatR8g8b8a8Unorm:
+		swapRedBlue = false
+	default:
+		return nil, fmt.Errorf("unsupported image format %d", format)
+	}
+
+	img := stdimage.NewRGBA(stdimage.Rect(0, 0, width, height))
+	copy(img.Pix, data)
+
+	for i := 0; i < len(img.Pix); i += 4 {
+		if swapRedBlue {
+			img.Pix[i], img.Pix[i+2] = img.Pix[i+2], img.Pix[i]
+		}
+		// Frames are composited opaquely, whatever alpha was written
+		img.Pix[i+3] = 0xFF
+	}
+
+	return img, nil
+}
@@ -0,0 +1,245 @@
+package vulkan
+
+import (
+	"fmt"
+	"github.com/lentus/cosmic-engine/cosmic/graphics"
+	"github.com/lentus/cosmic-engine/cosmic/internal/vulkan/spirv"
+	"github.com/vulkan-go/vulkan"
+	"sort"
+)
+
+// reflectedStage is a shader stage together with its reflected interface.
+type reflectedStage struct {
+	source     shaderSource
+	stage      vulkan.ShaderStageFlagBits
+	module     *spirv.Module
+	entryPoint *spirv.EntryPoint
+}
+
+// pipelineInterface describes the vertex input state and pipeline layout
+// required by the shader stages of a pipeline, derived from their SPIR-V.
+type pipelineInterface struct {
+	vertexBindings     []vulkan.VertexInputBindingDescription
+	vertexAttributes   []vulkan.VertexInputAttributeDescription
+	setLayoutBindings  [][]vulkan.DescriptorSetLayoutBinding
+	pushConstantRanges []vulkan.PushConstantRange
+}
+
+var shaderStages = map[spirv.Stage]vulkan.ShaderStageFlagBits{
+	spirv.StageVertex:                 vulkan.ShaderStageVertexBit,
+	spirv.StageTessellationControl:    vulkan.ShaderStageTessellationControlBit,
+	spirv.StageTessellationEvaluation: vulkan.ShaderStageTessellationEvaluationBit,
+	spirv.StageGeometry:               vulkan.ShaderStageGeometryBit,
+	spirv.StageFragment:               vulkan.ShaderStageFragmentBit,
+	spirv.StageCompute:                vulkan.ShaderStageComputeBit,
+}
+
+var descriptorTypes = map[spirv.DescriptorType]vulkan.DescriptorType{
+	spirv.DescriptorSampler:              vulkan.DescriptorTypeSampler,
+	spirv.DescriptorCombinedImageSampler: vulkan.DescriptorTypeCombinedImageSampler,
+	spirv.DescriptorSampledImage:         vulkan.DescriptorTypeSampledImage,
+	spirv.DescriptorStorageImage:         vulkan.DescriptorTypeStorageImage,
+	spirv.DescriptorUniformTexelBuffer:   vulkan.DescriptorTypeUniformTexelBuffer,
+	spirv.DescriptorStorageTexelBuffer:   vulkan.DescriptorTypeStorageTexelBuffer,
+	spirv.DescriptorUniformBuffer:        vulkan.DescriptorTypeUniformBuffer,
+	spirv.DescriptorStorageBuffer:        vulkan.DescriptorTypeStorageBuffer,
+	spirv.DescriptorInputAttachment:      vulkan.DescriptorTypeInputAttachment,
+}
+
+// reflectShader parses the SPIR-V code of a shader and finds the entry point
+// named main for the given stage. Arrays of resources sized by the given
+// specialization constants take their values.
+func (ctx *Context) reflectShader(source shaderSource, stage spirv.Stage, constants []graphics.SpecConstant) (reflectedStage, error) {
+	module, err := spirv.Parse(ctx.shaders.load(source))
+	if err != nil {
+		return reflectedStage{}, fmt.Errorf("%s: %s", source.spirv, err.Error())
+	}
+
+	for i, binding := range module.DescriptorBindings {
+		for _, constant := range constants {
+			if binding.SpecializedCount && binding.CountSpecID == constant.ID {
+				module.DescriptorBindings[i].Count = constant.Value
+			}
+		}
+	}
+
+	entryPoint, err := module.EntryPoint("main", stage)
+	if err != nil {
+		return reflectedStage{}, fmt.Errorf("%s: %s", source.spirv, err.Error())
+	}
+
+	return reflectedStage{
+		source:     source,
+		stage:      shaderStages[stage],
+		module:     module,
+		entryPoint: entryPoint,
+	}, nil
+}
+
+// reflectPipeline validates that the outputs of every stage match the inputs
+// of the next, and builds the pipeline interface of the given stages. The
+// stages must be passed in pipeline order.
+func reflectPipeline(stages ...reflectedStage) (*pipelineInterface, error) {
+	for i := 1; i < len(stages); i++ {
+		if err := spirv.ValidateInterface(stages[i-1].entryPoint, stages[i].entryPoint); err != nil {
+			return nil, fmt.Errorf("%s -> %s: %s", stages[i-1].source.spirv, stages[i].source.spirv, err.Error())
+		}
+	}
+
+	pipeline := &pipelineInterface{}
+	for _, stage := range stages {
+		if stage.stage == vulkan.ShaderStageVertexBit {
+			if err := pipeline.addVertexInputs(stage.entryPoint.Inputs); err != nil {
+				return nil, fmt.Errorf("%s: %s", stage.source.spirv, err.Error())
+			}
+		}
+
+		if err := pipeline.addDescriptorBindings(stage); err != nil {
+			return nil, err
+		}
+
+		for _, block := range stage.module.PushConstants {
+			pipeline.pushConstantRanges = append(pipeline.pushConstantRanges, vulkan.PushConstantRange{
+				StageFlags: vulkan.ShaderStageFlags(stage.stage),
+				Offset:     block.Offset,
+				Size:       block.Size - block.Offset,
+			})
+		}
+	}
+
+	return pipeline, nil
+}
+
+// addVertexInputs creates a vertex attribute for every location used by the
+// vertex stage inputs. All attributes are tightly packed in a single
+// interleaved vertex buffer, in location order.
+func (pi *pipelineInterface) addVertexInputs(inputs []spirv.Variable) error {
+	if len(inputs) == 0 {
+		return nil
+	}
+
+	var offset uint32
+	for _, input := range inputs {
+		// Matrices and arrays take one attribute per column or element
+		columns, columnType := uint32(1), input.Type
+		switch input.Type.Kind {
+		case spirv.KindMatrix:
+			columns, columnType = input.Type.Columns, input.Type.Elem
+		case spirv.KindArray:
+			columns, columnType = input.Type.Length, input.Type.Elem
+		}
+
+		format, size, err := vertexFormat(columnType)
+		if err != nil {
+			return fmt.Errorf("vertex input %s: %s", input.Name, err.Error())
+		}
+
+		for column := uint32(0); column < columns; column++ {
+			pi.vertexAttributes = append(pi.vertexAttributes, vulkan.VertexInputAttributeDescription{
+				Location: input.Location + column*columnType.Locations(),
+				Binding:  0,
+				Format:   format,
+				Offset:   offset,
+			})
+			offset += size
+		}
+	}
+
+	pi.vertexBindings = []vulkan.VertexInputBindingDescription{{
+		Binding:   0,
+		Stride:    offset,
+		InputRate: vulkan.VertexInputRateVertex,
+	}}
+
+	return nil
+}
+
+func vertexFormat(t *spirv.Type) (vulkan.Format, uint32, error) {
+	scalar, components := t, uint32(1)
+	if t.Kind == spirv.KindVector {
+		scalar, components = t.Elem, t.Components
+	}
+
+	var formats []vulkan.Format
+	switch {
+	case scalar.Kind == spirv.KindFloat && scalar.Width == 32:
+		formats = []vulkan.Format{vulkan.FormatR32Sfloat, vulkan.FormatR32g32Sfloat, vulkan.FormatR32g32b32Sfloat, vulkan.FormatR32g32b32a32Sfloat}
+	case scalar.Kind == spirv.KindFloat && scalar.Width == 64:
+		formats = []vulkan.Format{vulkan.FormatR64Sfloat, vulkan.FormatR64g64Sfloat, vulkan.FormatR64g64b64Sfloat, vulkan.FormatR64g64b64a64Sfloat}
+	case scalar.Kind == spirv.KindInt && scalar.Width == 32 && scalar.Signed:
+		formats = []vulkan.Format{vulkan.FormatR32Sint, vulkan.FormatR32g32Sint, vulkan.FormatR32g32b32Sint, vulkan.FormatR32g32b32a32Sint}
+	case scalar.Kind == spirv.KindInt && scalar.Width == 32:
+		formats = []vulkan.Format{vulkan.FormatR32Uint, vulkan.FormatR32g32Uint, vulkan.FormatR32g32b32Uint, vulkan.FormatR32g32b32a32Uint}
+	}
+
+	if formats == nil || components < 1 || components > 4 {
+		return vulkan.FormatUndefined, 0, fmt.Errorf("unsupported vertex input type %s", t)
+	}
+
+	return formats[components-1], t.Size, nil
+}
+
+// addDescriptorBindings merges the descriptor bindings of a stage with those
+// of previous stages. Stages may share a binding, but only with the same
+// descriptor type and count.
+func (pi *pipelineInterface) addDescriptorBindings(stage reflectedStage) error {
+	for _, binding := range stage.module.DescriptorBindings {
+		for uint32(len(pi.setLayoutBindings)) <= binding.Set {
+			pi.setLayoutBindings = append(pi.setLayoutBindings, nil)
+		}
+
+		descriptorType := descriptorTypes[binding.Type]
+		bindings := pi.setLayoutBindings[binding.Set]
+
+		merged := false
+		for i := range bindings {
+			if bindings[i].Binding != binding.Binding {
+				continue
+			}
+
+			if bindings[i].DescriptorType != descriptorType || bindings[i].DescriptorCount != binding.Count {
+				return fmt.Errorf("%s: %s (set %d, binding %d) conflicts with a previous stage",
+					stage.source.spirv, binding.Name, binding.Set, binding.Binding)
+			}
+
+			bindings[i].StageFlags |= vulkan.ShaderStageFlags(stage.stage)
+			merged = true
+		}
+
+		if !merged {
+			pi.setLayoutBindings[binding.Set] = append(bindings, vulkan.DescriptorSetLayoutBinding{
+				Binding:         binding.Binding,
+				DescriptorType:  descriptorType,
+				DescriptorCount: binding.Count,
+				StageFlags:      vulkan.ShaderStageFlags(stage.stage),
+			})
+		}
+	}
+
+	for _, bindings := range pi.setLayoutBindings {
+		sort.Slice(bindings, func(i, j int) bool { return bindings[i].Binding < bindings[j].Binding })
+	}
+
+	return nil
+}
+
+// createDescriptorSetLayouts creates a layout for every descriptor set up to
+// the highest set used. Unused sets in between get an empty layout.
+func (ctx *Context) createDescriptorSetLayouts(pi *pipelineInterface) []vulkan.DescriptorSetLayout {
+	setLayouts := make([]vulkan.DescriptorSetLayout, len(pi.setLayoutBindings))
+
+	for set, bindings := range pi.setLayoutBindings {
+		createInfo := vulkan.DescriptorSetLayoutCreateInfo{
+			SType:        vulkan.StructureTypeDescriptorSetLayoutCreateInfo,
+			BindingCount: uint32(len(bindings)),
+			PBindings:    bindings,
+		}
+
+		var setLayout vulkan.DescriptorSetLayout
+		result := vulkan.CreateDescriptorSetLayout(ctx.device, &createInfo, nil, &setLayout)
+		panicOnError(result, fmt.Sprintf("create descriptor set layout %d", set))
+		setLayouts[set] = setLayout
+	}
+
+	return setLayouts
+}
@@ -0,0 +1,24 @@
+package vulkan
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/graphics"
+	"github.com/lentus/cosmic-engine/cosmic/graphics/rendertest"
+	"github.com/lentus/cosmic-engine/cosmic/log"
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	log.Init(log.LevelWarn, log.LevelWarn)
+	os.Exit(m.Run())
+}
+
+func TestOffscreenContext(t *testing.T) {
+	if !Available() {
+		t.Skip("no Vulkan driver installed")
+	}
+
+	rendertest.Run(t, func(properties graphics.ContextProperties, width, height int) graphics.OffscreenContext {
+		return NewOffscreenContext(properties, width, height)
+	})
+}
@@ -0,0 +1,438 @@
+package vulkan
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/graphics/rendergraph"
+	"github.com/lentus/cosmic-engine/cosmic/log"
+	"github.com/vulkan-go/vulkan"
+	"os"
+	"strconv"
+)
+
+var graphLayouts = map[rendergraph.Layout]vulkan.ImageLayout{
+	rendergraph.LayoutUndefined:              vulkan.ImageLayoutUndefined,
+	rendergraph.LayoutGeneral:                vulkan.ImageLayoutGeneral,
+	rendergraph.LayoutColorAttachment:        vulkan.ImageLayoutColorAttachmentOptimal,
+	rendergraph.LayoutDepthStencilAttachment: vulkan.ImageLayoutDepthStencilAttachmentOptimal,
+	rendergraph.LayoutDepthStencilReadOnly:   vulkan.ImageLayoutDepthStencilReadOnlyOptimal,
+	rendergraph.LayoutShaderReadOnly:         vulkan.ImageLayoutShaderReadOnlyOptimal,
+	rendergraph.LayoutTransferSrc:            vulkan.ImageLayoutTransferSrcOptimal,
+	rendergraph.LayoutTransferDst:            vulkan.ImageLayoutTransferDstOptimal,
+	rendergraph.LayoutPresent:                vulkan.ImageLayoutPresentSrc,
+}
+
+var graphStages = map[rendergraph.Stage]vulkan.PipelineStageFlagBits{
+	rendergraph.StageTopOfPipe:             vulkan.PipelineStageTopOfPipeBit,
+	rendergraph.StageDrawIndirect:          vulkan.PipelineStageDrawIndirectBit,
+	rendergraph.StageVertexInput:           vulkan.PipelineStageVertexInputBit,
+	rendergraph.StageVertexShader:          vulkan.PipelineStageVertexShaderBit,
+	rendergraph.StageFragmentShader:        vulkan.PipelineStageFragmentShaderBit,
+	rendergraph.StageEarlyFragmentTests:    vulkan.PipelineStageEarlyFragmentTestsBit,
+	rendergraph.StageLateFragmentTests:     vulkan.PipelineStageLateFragmentTestsBit,
+	rendergraph.StageColorAttachmentOutput: vulkan.PipelineStageColorAttachmentOutputBit,
+	rendergraph.StageComputeShader:         vulkan.PipelineStageComputeShaderBit,
+	rendergraph.StageTransfer:              vulkan.PipelineStageTransferBit,
+	rendergraph.StageBottomOfPipe:          vulkan.PipelineStageBottomOfPipeBit,
+	rendergraph.StageHost:                  vulkan.PipelineStageHostBit,
+}
+
+var graphAccesses = map[rendergraph.Access]vulkan.AccessFlagBits{
+	rendergraph.AccessIndirectCommandRead:         vulkan.AccessIndirectCommandReadBit,
+	rendergraph.AccessIndexRead:                   vulkan.AccessIndexReadBit,
+	rendergraph.AccessVertexAttributeRead:         vulkan.AccessVertexAttributeReadBit,
+	rendergraph.AccessUniformRead:                 vulkan.AccessUniformReadBit,
+	rendergraph.AccessShaderRead:                  vulkan.AccessShaderReadBit,
+	rendergraph.AccessShaderWrite:                 vulkan.AccessShaderWriteBit,
+	rendergraph.AccessColorAttachmentRead:         vulkan.AccessColorAttachmentReadBit,
+	rendergraph.AccessColorAttachmentWrite:        vulkan.AccessColorAttachmentWriteBit,
+	rendergraph.AccessDepthStencilAttachmentRead:  vulkan.AccessDepthStencilAttachmentReadBit,
+	rendergraph.AccessDepthStencilAttachmentWrite: vulkan.AccessDepthStencilAttachmentWriteBit,
+	rendergraph.AccessTransferRead:                vulkan.AccessTransferReadBit,
+	rendergraph.AccessTransferWrite:               vulkan.AccessTransferWriteBit,
+	rendergraph.AccessHostRead:                    vulkan.AccessHostReadBit,
+	rendergraph.AccessHostWrite:                   vulkan.AccessHostWriteBit,
+}
+
+var graphFormats = map[rendergraph.Format]vulkan.Format{
+	rendergraph.FormatRGBA8Unorm:           vulkan.FormatR8g8b8a8Unorm,
+	rendergraph.FormatRGBA8SRGB:            vulkan.FormatR8g8b8a8Srgb,
+	rendergraph.FormatBGRA8SRGB:            vulkan.FormatB8g8r8a8Srgb,
+	rendergraph.FormatRGBA16Float:          vulkan.FormatR16g16b16a16Sfloat,
+	rendergraph.FormatRGBA32Float:          vulkan.FormatR32g32b32a32Sfloat,
+	rendergraph.FormatR32Float:             vulkan.FormatR32Sfloat,
+	rendergraph.FormatDepth32Float:         vulkan.FormatD32Sfloat,
+	rendergraph.FormatDepth24Stencil8:      vulkan.FormatD24UnormS8Uint,
+	rendergraph.FormatDepth32FloatStencil8: vulkan.FormatD32SfloatS8Uint,
+}
+
+var graphImageUsages = map[rendergraph.Usage]vulkan.ImageUsageFlagBits{
+	rendergraph.UsageColorAttachment:        vulkan.ImageUsageColorAttachmentBit,
+	rendergraph.UsageDepthStencilAttachment: vulkan.ImageUsageDepthStencilAttachmentBit,
+	rendergraph.UsageSampled:                vulkan.ImageUsageSampledBit,
+	rendergraph.UsageStorageImage:           vulkan.ImageUsageStorageBit,
+	rendergraph.UsageTransferSrc:            vulkan.ImageUsageTransferSrcBit,
+	rendergraph.UsageTransferDst:            vulkan.ImageUsageTransferDstBit,
+}
+
+var graphBufferUsages = map[rendergraph.Usage]vulkan.BufferUsageFlagBits{
+	rendergraph.UsageVertexBuffer:   vulkan.BufferUsageVertexBufferBit,
+	rendergraph.UsageIndexBuffer:    vulkan.BufferUsageIndexBufferBit,
+	rendergraph.UsageUniformBuffer:  vulkan.BufferUsageUniformBufferBit,
+	rendergraph.UsageStorageBuffer:  vulkan.BufferUsageStorageBufferBit,
+	rendergraph.UsageIndirectBuffer: vulkan.BufferUsageIndirectBufferBit,
+	rendergraph.UsageTransferSrc:    vulkan.BufferUsageTransferSrcBit,
+	rendergraph.UsageTransferDst:    vulkan.BufferUsageTransferDstBit,
+}
+
+func toPipelineStages(stages rendergraph.Stage) vulkan.PipelineStageFlags {
+	var flags vulkan.PipelineStageFlagBits
+	for stage, bit := range graphStages {
+		if stages&stage != 0 {
+			flags |= bit
+		}
+	}
+	return vulkan.PipelineStageFlags(flags)
+}
+
+func toAccessFlags(access rendergraph.Access) vulkan.AccessFlags {
+	var flags vulkan.AccessFlagBits
+	for a, bit := range graphAccesses {
+		if access&a != 0 {
+			flags |= bit
+		}
+	}
+	return vulkan.AccessFlags(flags)
+}
+
+// toGraphFormat finds the render graph format of a Vulkan format, to describe
+// imported images.
+func toGraphFormat(format vulkan.Format) rendergraph.Format {
+	for graphFormat, vulkanFormat := range graphFormats {
+		if vulkanFormat == format {
+			return graphFormat
+		}
+	}
+	return rendergraph.FormatRGBA8Unorm
+}
+
+// graphImage is an image bound to a resource of a render graph.
+type graphImage struct {
+	handle vulkan.Image
+	aspect vulkan.ImageAspectFlagBits
+}
+
+// graphBindings binds the imported resources of a render graph.
+type graphBindings struct {
+	images  map[rendergraph.ResourceID]graphImage
+	buffers map[rendergraph.ResourceID]vulkan.Buffer
+}
+
+// renderGraph is a compiled render graph with the memory of its transient
+// resources.
+type renderGraph struct {
+	compiled *rendergraph.Compiled
+	images   map[int]image
+	buffers  map[int]buffer
+}
+
+// createRenderGraph compiles a graph and allocates its transient resources.
+func (ctx *Context) createRenderGraph(g *rendergraph.Graph, name string) *renderGraph {
+	compiled, err := g.Compile()
+	if err != nil {
+		log.PanicfCore("Invalid %s render graph - %s", name, err.Error())
+	}
+
+	if path := ctx.properties.RenderGraphDump; path != "" {
+		ctx.dumpRenderGraph(compiled, path)
+	}
+
+	rg := &renderGraph{
+		compiled: compiled,
+		images:   make(map[int]image),
+		buffers:  make(map[int]buffer),
+	}
+
+	for i, physical := range compiled.Physical {
+		resourceName := name + " transient " + physical.Kind.String() + " " + strconv.Itoa(i)
+
+		switch physical.Kind {
+		case rendergraph.KindImage:
+			var usage vulkan.ImageUsageFlagBits
+			for _, u := range physical.Usages {
+				usage |= graphImageUsages[u]
+			}
+
+			rg.images[i] = ctx.createImage(
+				vulkan.Extent2D{Width: uint32(physical.Image.Width), Height: uint32(physical.Image.Height)},
+				graphFormats[physical.Image.Format],
+				vulkan.SampleCountFlagBits(physical.Image.Samples),
+				usage,
+				imageAspect(physical.Image.Format),
+				resourceName,
+			)
+		case rendergraph.KindBuffer:
+			var usage vulkan.BufferUsageFlagBits
+			for _, u := range physical.Usages {
+				usage |= graphBufferUsages[u]
+			}
+
+			rg.buffers[i] = ctx.createBuffer(
+				physical.Buffer.Size, usage, vulkan.MemoryPropertyDeviceLocalBit, resourceName,
+			)
+		}
+	}
+
+	return rg
+}
+
+func (ctx *Context) destroyRenderGraph(rg *renderGraph) {
+	if rg == nil {
+		return
+	}
+
+	for _, img := range rg.images {
+		ctx.destroyImage(img)
+	}
+	for _, buf := range rg.buffers {
+		ctx.destroyBuffer(buf)
+	}
+}
+
+func (ctx *Context) dumpRenderGraph(compiled *rendergraph.Compiled, path string) {
+	file, err := os.Create(path)
+	if err != nil {
+		log.ErrorfCore("Failed to dump render graph - %s", err.Error())
+		return
+	}
+	defer file.Close()
+
+	if err = compiled.WriteDot(file); err != nil {
+		log.ErrorfCore("Failed to dump render graph - %s", err.Error())
+		return
+	}
+	log.DebugfCore("Dumped render graph to %s", path)
+}
+
+func imageAspect(format rendergraph.Format) vulkan.ImageAspectFlagBits {
+	switch format {
+	case rendergraph.FormatDepth32Float:
+		return vulkan.ImageAspectDepthBit
+	case rendergraph.FormatDepth24Stencil8, rendergraph.FormatDepth32FloatStencil8:
+		return vulkan.ImageAspectDepthBit | vulkan.ImageAspectStencilBit
+	default:
+		return vulkan.ImageAspectColorBit
+	}
+}
+
+// recordRenderGraph records the passes of a render graph in execution order,
+// each preceded by its barriers. Passes without a function record nothing.
+func (ctx *Context) recordRenderGraph(
+	commandBuffer vulkan.CommandBuffer,
+	rg *renderGraph,
+	bindings graphBindings,
+	passes map[rendergraph.PassID]func(commandBuffer vulkan.CommandBuffer),
+) {
+	for _, pass := range rg.compiled.Passes {
+		ctx.recordGraphBarriers(commandBuffer, rg, bindings, pass.Barriers)
+
+		if record, ok := passes[pass.ID]; ok {
+			record(commandBuffer)
+		}
+	}
+
+	ctx.recordGraphBarriers(commandBuffer, rg, bindings, rg.compiled.FinalBarriers)
+}
+
+// recordGraphBarriers records the barriers before a pass as a single pipeline
+// barrier.
+func (ctx *Context) recordGraphBarriers(
+	commandBuffer vulkan.CommandBuffer,
+	rg *renderGraph,
+	bindings graphBindings,
+	barriers []rendergraph.Barrier,
+) {
+	if len(barriers) == 0 {
+		return
+	}
+
+	var srcStages, dstStages vulkan.PipelineStageFlags
+	var imageBarriers []vulkan.ImageMemoryBarrier
+	var bufferBarriers []vulkan.BufferMemoryBarrier
+
+	for _, barrier := range barriers {
+		srcStages |= toPipelineStages(barrier.SrcStages)
+		dstStages |= toPipelineStages(barrier.DstStages)
+
+		info := rg.compiled.Resources[barrier.Resource]
+		switch info.Kind {
+		case rendergraph.KindImage:
+			img, ok := bindings.images[barrier.Resource]
+			if !info.Imported {
+				img, ok = graphImage{handle: rg.images[info.Physical].handle, aspect: imageAspect(info.Image.Format)}, true
+			}
+			if !ok {
+				log.PanicfCore("Render graph image %s is not bound", info.Name)
+			}
+
+			imageBarriers = append(imageBarriers, vulkan.ImageMemoryBarrier{
+				SType:               vulkan.StructureTypeImageMemoryBarrier,
+				SrcAccessMask:       toAccessFlags(barrier.SrcAccess),
+				DstAccessMask:       toAccessFlags(barrier.DstAccess),
+				OldLayout:           graphLayouts[barrier.OldLayout],
+				NewLayout:           graphLayouts[barrier.NewLayout],
+				SrcQueueFamilyIndex: vulkan.QueueFamilyIgnored,
+				DstQueueFamilyIndex: vulkan.QueueFamilyIgnored,
+				Image:               img.handle,
+				SubresourceRange: vulkan.ImageSubresourceRange{
+					AspectMask:     vulkan.ImageAspectFlags(img.aspect),
+					BaseMipLevel:   0,
+					LevelCount:     vulkan.RemainingMipLevels,
+					BaseArrayLayer: 0,
+					LayerCount:     vulkan.RemainingArrayLayers,
+				},
+			})
+		case rendergraph.KindBuffer:
+			buf, ok := bindings.buffers[barrier.Resource]
+			if !info.Imported {
+				buf, ok = rg.buffers[info.Physical].handle, true
+			}
+			if !ok {
+				log.PanicfCore("Render graph buffer %s is not bound", info.Name)
+			}
+
+			bufferBarriers = append(bufferBarriers, vulkan.BufferMemoryBarrier{
+				SType:               vulkan.StructureTypeBufferMemoryBarrier,
+				SrcAccessMask:       toAccessFlags(barrier.SrcAccess),
+				DstAccessMask:       toAccessFlags(barrier.DstAccess),
+				SrcQueueFamilyIndex: vulkan.QueueFamilyIgnored,
+				DstQueueFamilyIndex: vulkan.QueueFamilyIgnored,
+				Buffer:              buf,
+				Offset:              0,
+				Size:                vulkan.DeviceSize(vulkan.WholeSize),
+			})
+		}
+	}
+
+	vulkan.CmdPipelineBarrier(
+		commandBuffer, srcStages, dstStages, 0,
+		0, nil,
+		uint32(len(bufferBarriers)), bufferBarriers,
+		uint32(len(imageBarriers)), imageBarriers,
+	)
+}
+
+// buildFrameGraph describes the passes rendering a frame. The graph depends
+// on the size and format of the images rendered to, so it is rebuilt along
+// with the command buffers.
+func (ctx *Context) buildFrameGraph() {
+	ctx.destroyRenderGraph(ctx.frameGraph)
+
+	g := rendergraph.New()
+
+	// Swapchain images are presented, offscreen images are read back
+	finalUsage := rendergraph.UsagePresent
+	if ctx.offscreen {
+		finalUsage = rendergraph.UsageTransferSrc
+	}
+
+	backbuffer := g.ImportImage("backbuffer", rendergraph.ImageDesc{
+		Width:  int(ctx.imageExtent.Width),
+		Height: int(ctx.imageExtent.Height),
+		Format: toGraphFormat(ctx.colorFormat),
+	}, rendergraph.Import{
+		// Contents of the previous frame are cleared, and the image becomes
+		// available once the acquire semaphore is signalled
+		Layout: rendergraph.LayoutUndefined,
+		Stages: rendergraph.StageColorAttachmentOutput,
+		Final:  finalUsage,
+	})
+	depthStencil := g.ImportImage("depth stencil", rendergraph.ImageDesc{
+		Width:   int(ctx.imageExtent.Width),
+		Height:  int(ctx.imageExtent.Height),
+		Format:  toGraphFormat(ctx.depthStencilFormat),
+		Samples: int(ctx.samples),
+	}, rendergraph.Import{
+		Layout: rendergraph.LayoutUndefined,
+		Stages: rendergraph.StageEarlyFragmentTests | rendergraph.StageLateFragmentTests,
+	})
+
+	mainPass := g.AddPass("Main pass", func(p *rendergraph.PassBuilder) {
+		p.Write(backbuffer, rendergraph.UsageColorAttachment)
+		p.Write(depthStencil, rendergraph.UsageDepthStencilAttachment)
+	})
+
+	ctx.frameGraph = ctx.createRenderGraph(g, "frame")
+	ctx.frameGraphBackbuffer = backbuffer.Resource
+	ctx.frameGraphDepthStencil = depthStencil.Resource
+	ctx.framePasses = map[rendergraph.PassID]func(commandBuffer vulkan.CommandBuffer, imageIndex int){
+		mainPass: ctx.recordMainPass,
+	}
+}
+
+// recordFrame records the frame graph for one of the images rendered to.
+func (ctx *Context) recordFrame(commandBuffer vulkan.CommandBuffer, imageIndex int) {
+	depthAspect := vulkan.ImageAspectDepthBit
+	if ctx.stencilAvailable {
+		depthAspect |= vulkan.ImageAspectStencilBit
+	}
+
+	bindings := graphBindings{images: map[rendergraph.ResourceID]graphImage{
+		ctx.frameGraphBackbuffer:   {handle: ctx.imageResourceSets[imageIndex].image, aspect: vulkan.ImageAspectColorBit},
+		ctx.frameGraphDepthStencil: {handle: ctx.depthStencil.handle, aspect: depthAspect},
+	}}
+
+	passes := make(map[rendergraph.PassID]func(commandBuffer vulkan.CommandBuffer), len(ctx.framePasses))
+	for id, record := range ctx.framePasses {
+		record := record
+		passes[id] = func(commandBuffer vulkan.CommandBuffer) { record(commandBuffer, imageIndex) }
+	}
+
+	ctx.recordRenderGraph(commandBuffer, ctx.frameGraph, bindings, passes)
+}
+
+// recordMainPass draws the scene into the image rendered to.
+func (ctx *Context) recordMainPass(commandBuffer vulkan.CommandBuffer, imageIndex int) {
+	renderArea := vulkan.Rect2D{
+		Offset: vulkan.Offset2D{X: 0, Y: 0},
+		Extent: vulkan.Extent2D{
+			Width:  ctx.imageExtent.Width,
+			Height: ctx.imageExtent.Height,
+		},
+	}
+
+	clearValues := make([]vulkan.ClearValue, 2)
+	clearValues[0].SetColor([]float32{0.8, 0.2, 0.2, 1.0})
+	clearValues[1].SetDepthStencil(1, 0)
+
+	renderPassBeginInfo := vulkan.RenderPassBeginInfo{
+		SType:           vulkan.StructureTypeRenderPassBeginInfo,
+		RenderPass:      ctx.renderPass,
+		Framebuffer:     ctx.imageResourceSets[imageIndex].framebuffer,
+		RenderArea:      renderArea,
+		ClearValueCount: uint32(len(clearValues)),
+		PClearValues:    clearValues,
+	}
+
+	viewport := vulkan.Viewport{
+		X:        0,
+		Y:        0,
+		Width:    float32(ctx.imageExtent.Width),
+		Height:   float32(ctx.imageExtent.Height),
+		MinDepth: 0,
+		MaxDepth: 1,
+	}
+
+	ctx.beginLabel(commandBuffer, "Main pass", [4]float32{0.2, 0.4, 0.8, 1})
+	vulkan.CmdBeginRenderPass(commandBuffer, &renderPassBeginInfo, vulkan.SubpassContentsInline)
+	vulkan.CmdSetViewport(commandBuffer, 0, 1, []vulkan.Viewport{viewport})
+	vulkan.CmdSetScissor(commandBuffer, 0, 1, []vulkan.Rect2D{renderArea})
+	if len(ctx.preparedBatches) > 0 {
+		ctx.insertLabel(commandBuffer, "Draw batches", [4]float32{0.8, 0.8, 0.2, 1})
+		ctx.recordBatches(commandBuffer)
+	} else {
+		ctx.insertLabel(commandBuffer, "Draw triangle", [4]float32{0.8, 0.8, 0.2, 1})
+		vulkan.CmdBindPipeline(commandBuffer, vulkan.PipelineBindPointGraphics, ctx.pipeline(trianglePipeline).handle)
+		vulkan.CmdDraw(commandBuffer, 3, 1, 0, 0)
+	}
+	vulkan.CmdEndRenderPass(commandBuffer)
+	ctx.endLabel(commandBuffer)
+}
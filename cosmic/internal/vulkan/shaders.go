@@ -1,18 +1,353 @@
 package vulkan
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"github.com/lentus/cosmic-engine/cosmic/internal/vulkan/shaders"
 	"github.com/lentus/cosmic-engine/cosmic/log"
+	"github.com/lentus/cosmic-engine/cosmic/watch"
 	"github.com/vulkan-go/vulkan"
-	"unsafe"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
 )
 
-func (ctx Context) createShaderModule(shaderFileName string) vulkan.ShaderModule {
-	shaderCode, err := shaders.Asset(shaderFileName)
+const spirvMagicNumber = 0x07230203
+
+// Interval at which the shader directory is polled for changes when the
+// operating system cannot report them.
+const shaderPollInterval = 500 * time.Millisecond
+
+// shaderSource describes where the SPIR-V code of a shader and, optionally,
+// its GLSL source can be found. Both are relative to the shader directory.
+type shaderSource struct {
+	spirv string
+	glsl  string
+}
+
+var (
+	triangleVertexShader   = shaderSource{spirv: "shader.vert.spv", glsl: "shader.vert"}
+	triangleFragmentShader = shaderSource{spirv: "shader.frag.spv", glsl: "shader.frag"}
+)
+
+// shaderUpdate carries freshly loaded SPIR-V code from the watcher goroutine
+// to the main thread. Once applied, it remembers the code it replaced.
+type shaderUpdate struct {
+	spirv    string
+	code     []byte
+	previous []byte
+}
+
+// watchedShader keeps track of the modification times of the files that
+// make up a shader, so the watcher can tell which one changed.
+type watchedShader struct {
+	source       shaderSource
+	glslModTime  time.Time
+	spirvModTime time.Time
+}
+
+// shaderLibrary loads SPIR-V shader code either from a directory on disk or
+// from a file system, the shaders embedded in the binary by default. When hot
+// reloading is enabled, it watches the loaded shaders and recompiles their
+// GLSL sources on change.
+//
+// The code of a shader is only ever replaced on the main thread (see
+// takeUpdates), and only with code that was compiled and validated
+// successfully, so a broken shader never replaces the last good module.
+type shaderLibrary struct {
+	directory string
+	files     fs.FS
+	hotReload bool
+	compiler  []string
+
+	// Last good SPIR-V code, keyed by SPIR-V file name. Main thread only.
+	code map[string][]byte
+
+	watchedMutex sync.Mutex
+	watched      map[string]*watchedShader
+
+	updates chan shaderUpdate
+	stop    chan struct{}
+	stopped sync.WaitGroup
+}
+
+func newShaderLibrary(directory string, files fs.FS, hotReload bool) *shaderLibrary {
+	if files == nil {
+		files = shaders.FS()
+	}
+
+	lib := &shaderLibrary{
+		directory: directory,
+		files:     files,
+		hotReload: hotReload && directory != "",
+		code:      make(map[string][]byte),
+		watched:   make(map[string]*watchedShader),
+		updates:   make(chan shaderUpdate, 16),
+		stop:      make(chan struct{}),
+	}
+
+	if hotReload && directory == "" {
+		log.WarnCore("Shader hot reloading requires a shader directory, shaders are not reloaded")
+	}
+
+	if lib.directory != "" {
+		lib.compiler = findShaderCompiler()
+		if lib.compiler == nil {
+			log.DebugCore("No GLSL compiler found, shaders are only loaded from SPIR-V files")
+		} else {
+			log.DebugfCore("Using %s to compile GLSL shaders", lib.compiler[0])
+		}
+	}
+
+	if lib.hotReload {
+		log.InfofCore("Watching %s for shader changes", lib.directory)
+		lib.stopped.Add(1)
+		go lib.watch()
+	}
+
+	return lib
+}
+
+// findShaderCompiler returns the command used to compile GLSL to SPIR-V, or
+// nil when neither glslc nor glslangValidator is installed.
+func findShaderCompiler() []string {
+	if path, err := exec.LookPath("glslc"); err == nil {
+		return []string{path}
+	}
+
+	if path, err := exec.LookPath("glslangValidator"); err == nil {
+		return []string{path, "-V"}
+	}
+
+	return nil
+}
+
+// load returns the SPIR-V code of the given shader, loading it when this is
+// the first time it is requested.
+func (lib *shaderLibrary) load(source shaderSource) []byte {
+	if code, ok := lib.code[source.spirv]; ok {
+		return code
+	}
+
+	code, err := lib.read(source)
 	if err != nil {
-		log.Panicf("failed to read shader file %s: %s", shaderFileName, err.Error())
+		log.PanicfCore("failed to load shader %s: %s", source.spirv, err.Error())
+	}
+	lib.code[source.spirv] = code
+
+	if lib.hotReload {
+		lib.addWatch(source)
 	}
 
+	return code
+}
+
+func (lib *shaderLibrary) read(source shaderSource) ([]byte, error) {
+	if lib.directory == "" {
+		code, err := fs.ReadFile(lib.files, source.spirv)
+		if err != nil {
+			return nil, err
+		}
+
+		return code, validateSpirv(code)
+	}
+
+	code, err := ioutil.ReadFile(filepath.Join(lib.directory, source.spirv))
+	if os.IsNotExist(err) && source.glsl != "" && lib.compiler != nil {
+		log.DebugfCore("No SPIR-V found for shader %s, compiling %s", source.spirv, source.glsl)
+		return lib.compile(source)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return code, validateSpirv(code)
+}
+
+// compile compiles the GLSL source of a shader, writes the result next to it
+// and returns the resulting code.
+func (lib *shaderLibrary) compile(source shaderSource) ([]byte, error) {
+	if lib.compiler == nil {
+		return nil, errors.New("no GLSL compiler available")
+	}
+
+	output, err := ioutil.TempFile(lib.directory, ".cosmic-*.spv")
+	if err != nil {
+		return nil, err
+	}
+	output.Close()
+	defer os.Remove(output.Name())
+
+	args := append(append([]string{}, lib.compiler[1:]...), filepath.Join(lib.directory, source.glsl), "-o", output.Name())
+	var messages bytes.Buffer
+	cmd := exec.Command(lib.compiler[0], args...)
+	cmd.Stdout = &messages
+	cmd.Stderr = &messages
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %s", err.Error(), bytes.TrimSpace(messages.Bytes()))
+	}
+
+	code, err := ioutil.ReadFile(output.Name())
+	if err != nil {
+		return nil, err
+	}
+	if err := validateSpirv(code); err != nil {
+		return nil, err
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(lib.directory, source.spirv), code, 0664); err != nil {
+		log.WarnfCore("Could not write compiled shader %s - %s", source.spirv, err.Error())
+	}
+
+	return code, nil
+}
+
+func validateSpirv(code []byte) error {
+	if len(code) < 20 || len(code)%4 != 0 {
+		return fmt.Errorf("invalid SPIR-V size of %d bytes", len(code))
+	}
+
+	if binary.LittleEndian.Uint32(code) != spirvMagicNumber {
+		return errors.New("missing SPIR-V magic number")
+	}
+
+	return nil
+}
+
+// takeUpdates applies all shader updates found by the watcher since the
+// last call, and returns them. May only be called from the main thread.
+func (lib *shaderLibrary) takeUpdates() (applied []shaderUpdate) {
+	for {
+		select {
+		case update := <-lib.updates:
+			log.InfofCore("Reloaded shader %s", update.spirv)
+			update.previous = lib.code[update.spirv]
+			lib.code[update.spirv] = update.code
+			applied = append(applied, update)
+		default:
+			return
+		}
+	}
+}
+
+// revert restores the code that was replaced by the given updates, for
+// when the new code turns out to be unusable.
+func (lib *shaderLibrary) revert(applied []shaderUpdate) {
+	for i := len(applied) - 1; i >= 0; i-- {
+		lib.code[applied[i].spirv] = applied[i].previous
+	}
+}
+
+func (lib *shaderLibrary) terminate() {
+	if lib.hotReload {
+		close(lib.stop)
+		lib.stopped.Wait()
+	}
+}
+
+func (lib *shaderLibrary) addWatch(source shaderSource) {
+	watched := &watchedShader{source: source}
+	watched.spirvModTime = modTime(filepath.Join(lib.directory, source.spirv))
+	if source.glsl != "" && lib.compiler != nil {
+		watched.glslModTime = modTime(filepath.Join(lib.directory, source.glsl))
+	}
+
+	lib.watchedMutex.Lock()
+	lib.watched[source.spirv] = watched
+	lib.watchedMutex.Unlock()
+}
+
+func (lib *shaderLibrary) watch() {
+	defer lib.stopped.Done()
+
+	watcher := watch.New(shaderPollInterval)
+	defer watcher.Close()
+	if err := watcher.Add(lib.directory); err != nil {
+		log.ErrorfCore("Failed to watch %s for shader changes - %s", lib.directory, err.Error())
+		return
+	}
+
+	for {
+		select {
+		case <-lib.stop:
+			return
+		case _, ok := <-watcher.Changes():
+			if !ok {
+				return
+			}
+			lib.poll()
+		}
+	}
+}
+
+// poll checks all watched shaders for changes, when a file in the shader
+// directory changed. A changed GLSL source is recompiled, a changed SPIR-V
+// file (e.g. compiled by hand) is reloaded.
+func (lib *shaderLibrary) poll() {
+	lib.watchedMutex.Lock()
+	watched := make([]*watchedShader, 0, len(lib.watched))
+	for _, w := range lib.watched {
+		watched = append(watched, w)
+	}
+	lib.watchedMutex.Unlock()
+
+	for _, w := range watched {
+		spirvPath := filepath.Join(lib.directory, w.source.spirv)
+
+		glslChanged := false
+		if w.source.glsl != "" && lib.compiler != nil {
+			glslModTime := modTime(filepath.Join(lib.directory, w.source.glsl))
+			glslChanged = glslModTime.After(w.glslModTime)
+			w.glslModTime = glslModTime
+		}
+
+		var code []byte
+		var err error
+
+		if glslChanged {
+			code, err = lib.compile(w.source)
+		} else if modTime(spirvPath).After(w.spirvModTime) {
+			code, err = ioutil.ReadFile(spirvPath)
+			if err == nil {
+				err = validateSpirv(code)
+			}
+		} else {
+			continue
+		}
+		// Our own compilation output must not trigger another reload
+		w.spirvModTime = modTime(spirvPath)
+
+		if err != nil {
+			log.ErrorfCore("Failed to reload shader %s, keeping last good module - %s", w.source.spirv, err.Error())
+			continue
+		}
+
+		select {
+		case lib.updates <- shaderUpdate{spirv: w.source.spirv, code: code}:
+		case <-lib.stop:
+			return
+		}
+	}
+}
+
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return info.ModTime()
+}
+
+func (ctx *Context) createShaderModule(source shaderSource) (vulkan.ShaderModule, error) {
+	shaderCode := ctx.shaders.load(source)
+
 	shaderModuleCreateInfo := vulkan.ShaderModuleCreateInfo{
 		SType:    vulkan.StructureTypeShaderModuleCreateInfo,
 		Flags:    0,
@@ -21,20 +356,21 @@ func (ctx Context) createShaderModule(shaderFileName string) vulkan.ShaderModule
 	}
 	var shaderModule vulkan.ShaderModule
 	result := vulkan.CreateShaderModule(ctx.device, &shaderModuleCreateInfo, nil, &shaderModule)
-	panicOnError(result, "create shader module")
+	if err := resultError(result, "create shader module "+source.spirv); err != nil {
+		return vulkan.NullShaderModule, err
+	}
 
-	return shaderModule
+	return shaderModule, nil
 }
 
-// sliceUint32 and sliceHeader are copied from vulkan-go/asche, it's magic.
-// https://github.com/vulkan-go/asche/blob/master/util.go#L179
+// sliceUint32 copies SPIR-V code into a slice of words. Shaders loaded from
+// disk are not guaranteed to be 4-byte aligned, so the bytes are not simply
+// reinterpreted.
 func sliceUint32(data []byte) []uint32 {
-	const m = 0x7fffffff
-	return (*[m / 4]uint32)(unsafe.Pointer((*sliceHeader)(unsafe.Pointer(&data)).Data))[:len(data)/4]
-}
+	words := make([]uint32, len(data)/4)
+	for i := range words {
+		words[i] = binary.LittleEndian.Uint32(data[i*4:])
+	}
 
-type sliceHeader struct {
-	Data uintptr
-	Len  int
-	Cap  int
+	return words
 }
@@ -1,4 +0,0 @@
-glslc shader.vert -o vert.spv
-glslc shader.frag -o frag.spv
-
-go-bindata -nocompress -pkg=shaders frag.spv vert.spv
\ No newline at end of file
@@ -0,0 +1,24 @@
+// Package shaders holds the shaders of the engine. Their GLSL sources in src
+// are cooked to SPIR-V in spirv, which is embedded in the binary.
+package shaders
+
+//go:generate go run github.com/lentus/cosmic-engine/cmd/cosmic-cook -o spirv src
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed spirv/*.spv
+var spirvFiles embed.FS
+
+// FS returns the embedded SPIR-V shaders as a file system.
+func FS() fs.FS {
+	files, err := fs.Sub(spirvFiles, "spirv")
+	if err != nil {
+		// The embedded directory always exists
+		panic(err)
+	}
+
+	return files
+}
@@ -0,0 +1,18 @@
+#version 450
+#extension GL_ARB_separate_shader_objects : enable
+
+// Number of textures a batch can use, set to the limit of the device by the
+// Vulkan context. The index is the same for every triangle of a draw call,
+// batches are split into a draw call per texture.
+layout(constant_id = 0) const uint maxBatchTextures = 16;
+layout(set = 0, binding = 0) uniform sampler2D textures[maxBatchTextures];
+
+layout(location = 0) in vec2 fragUV;
+layout(location = 1) in vec4 fragColor;
+layout(location = 2) flat in uint fragTexture;
+
+layout(location = 0) out vec4 outColor;
+
+void main() {
+    outColor = texture(textures[fragTexture], fragUV) * fragColor;
+}
@@ -0,0 +1,22 @@
+#version 450
+#extension GL_ARB_separate_shader_objects : enable
+
+layout(push_constant) uniform Camera {
+    mat4 viewProjection;
+} camera;
+
+layout(location = 0) in vec2 inPosition;
+layout(location = 1) in vec2 inUV;
+layout(location = 2) in vec4 inColor;
+layout(location = 3) in uint inTexture;
+
+layout(location = 0) out vec2 fragUV;
+layout(location = 1) out vec4 fragColor;
+layout(location = 2) flat out uint fragTexture;
+
+void main() {
+    gl_Position = camera.viewProjection * vec4(inPosition, 0.0, 1.0);
+    fragUV = inUV;
+    fragColor = inColor;
+    fragTexture = inTexture;
+}
@@ -0,0 +1,60 @@
+package spirv
+
+import (
+	"fmt"
+	"strings"
+)
+
+// InterfaceError lists the mismatches between the outputs of one stage and
+// the inputs of the next.
+type InterfaceError struct {
+	Producer, Consumer Stage
+	Mismatches         []string
+}
+
+func (e *InterfaceError) Error() string {
+	return fmt.Sprintf("spirv: %s outputs do not match %s inputs: %s",
+		e.Producer, e.Consumer, strings.Join(e.Mismatches, "; "))
+}
+
+// ValidateInterface checks that every input of the consumer stage is written
+// by the producer stage, at the same location and with the same type.
+// Outputs that are not consumed are allowed.
+func ValidateInterface(producer, consumer *EntryPoint) error {
+	outputs := make(map[[2]uint32]Variable, len(producer.Outputs))
+	for _, output := range producer.Outputs {
+		outputs[[2]uint32{output.Location, output.Component}] = output
+	}
+
+	var mismatches []string
+	for _, input := range consumer.Inputs {
+		output, ok := outputs[[2]uint32{input.Location, input.Component}]
+		if !ok {
+			mismatches = append(mismatches, fmt.Sprintf(
+				"input %s at location %d is not written", displayName(input), input.Location,
+			))
+			continue
+		}
+
+		if !output.Type.Equal(input.Type) {
+			mismatches = append(mismatches, fmt.Sprintf(
+				"input %s at location %d is %s, but output %s is %s",
+				displayName(input), input.Location, input.Type, displayName(output), output.Type,
+			))
+		}
+	}
+
+	if len(mismatches) > 0 {
+		return &InterfaceError{Producer: producer.Stage, Consumer: consumer.Stage, Mismatches: mismatches}
+	}
+
+	return nil
+}
+
+func displayName(v Variable) string {
+	if v.Name == "" {
+		return "<unnamed>"
+	}
+
+	return v.Name
+}
@@ -0,0 +1,631 @@
+// Package spirv provides reflection over SPIR-V shader modules. It extracts
+// the information needed to build pipeline layouts and vertex input state
+// from compiled shaders, so those no longer have to be kept in sync with the
+// GLSL by hand.
+package spirv
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+const magicNumber = 0x07230203
+
+// Stage is the execution model of an entry point.
+type Stage uint32
+
+const (
+	StageVertex Stage = iota
+	StageTessellationControl
+	StageTessellationEvaluation
+	StageGeometry
+	StageFragment
+	StageCompute
+)
+
+func (s Stage) String() string {
+	switch s {
+	case StageVertex:
+		return "vertex"
+	case StageTessellationControl:
+		return "tessellation control"
+	case StageTessellationEvaluation:
+		return "tessellation evaluation"
+	case StageGeometry:
+		return "geometry"
+	case StageFragment:
+		return "fragment"
+	case StageCompute:
+		return "compute"
+	default:
+		return fmt.Sprintf("stage(%d)", uint32(s))
+	}
+}
+
+// Module is the reflected interface of a SPIR-V module.
+type Module struct {
+	Version     uint32
+	EntryPoints []EntryPoint
+
+	// Resources declared by the module. SPIR-V before 1.4 does not list
+	// these per entry point, so they are shared by all entry points.
+	DescriptorBindings []DescriptorBinding
+	PushConstants      []Block
+	SpecConstants      []SpecConstant
+}
+
+// EntryPoint returns the entry point with the given name and stage.
+func (m *Module) EntryPoint(name string, stage Stage) (*EntryPoint, error) {
+	for i := range m.EntryPoints {
+		if m.EntryPoints[i].Name == name && m.EntryPoints[i].Stage == stage {
+			return &m.EntryPoints[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("no %s entry point named %s", stage, name)
+}
+
+// EntryPoint is a shader stage entry point with its stage interface.
+// Built-in variables such as gl_Position are not part of the interface.
+type EntryPoint struct {
+	Name    string
+	Stage   Stage
+	Inputs  []Variable
+	Outputs []Variable
+}
+
+// Variable is an input or output of a shader stage.
+type Variable struct {
+	Name      string
+	Location  uint32
+	Component uint32
+	Type      *Type
+}
+
+// DescriptorType is the kind of resource bound through a descriptor.
+type DescriptorType int
+
+const (
+	DescriptorSampler DescriptorType = iota
+	DescriptorCombinedImageSampler
+	DescriptorSampledImage
+	DescriptorStorageImage
+	DescriptorUniformTexelBuffer
+	DescriptorStorageTexelBuffer
+	DescriptorUniformBuffer
+	DescriptorStorageBuffer
+	DescriptorInputAttachment
+)
+
+func (t DescriptorType) String() string {
+	switch t {
+	case DescriptorSampler:
+		return "sampler"
+	case DescriptorCombinedImageSampler:
+		return "combined image sampler"
+	case DescriptorSampledImage:
+		return "sampled image"
+	case DescriptorStorageImage:
+		return "storage image"
+	case DescriptorUniformTexelBuffer:
+		return "uniform texel buffer"
+	case DescriptorStorageTexelBuffer:
+		return "storage texel buffer"
+	case DescriptorUniformBuffer:
+		return "uniform buffer"
+	case DescriptorStorageBuffer:
+		return "storage buffer"
+	case DescriptorInputAttachment:
+		return "input attachment"
+	default:
+		return fmt.Sprintf("descriptor(%d)", int(t))
+	}
+}
+
+// DescriptorBinding is a resource bound at a set and binding number.
+type DescriptorBinding struct {
+	Name    string
+	Set     uint32
+	Binding uint32
+	Type    DescriptorType
+	// Number of descriptors, larger than 1 for arrays of resources. Zero for
+	// runtime sized arrays.
+	Count uint32
+	// Set when the length of an array of resources is a specialization
+	// constant, whose default Count holds.
+	SpecializedCount bool
+	CountSpecID      uint32
+	// Size in bytes of uniform and storage buffer blocks.
+	Size uint32
+}
+
+// Block is a uniform, storage or push constant block.
+type Block struct {
+	Name string
+	// Offset of the first member, push constant ranges start here.
+	Offset uint32
+	Size   uint32
+	Type   *Type
+}
+
+// SpecConstant is a specialization constant with its default value. Boolean
+// defaults are 0 or 1, other defaults hold the raw bits of the value.
+type SpecConstant struct {
+	Name    string
+	ID      uint32
+	Type    *Type
+	Default uint64
+}
+
+// Parse reflects the given SPIR-V code.
+func Parse(code []byte) (*Module, error) {
+	if len(code)%4 != 0 {
+		return nil, fmt.Errorf("spirv: size of %d bytes is not a multiple of 4", len(code))
+	}
+	if len(code) < 20 {
+		return nil, errors.New("spirv: module too small to contain a header")
+	}
+
+	words := make([]uint32, len(code)/4)
+	switch {
+	case binary.LittleEndian.Uint32(code) == magicNumber:
+		for i := range words {
+			words[i] = binary.LittleEndian.Uint32(code[i*4:])
+		}
+	case binary.BigEndian.Uint32(code) == magicNumber:
+		for i := range words {
+			words[i] = binary.BigEndian.Uint32(code[i*4:])
+		}
+	default:
+		return nil, errors.New("spirv: missing magic number")
+	}
+
+	return ParseWords(words)
+}
+
+// ParseWords reflects SPIR-V code that was already split into words.
+func ParseWords(words []uint32) (*Module, error) {
+	if len(words) < 5 || words[0] != magicNumber {
+		return nil, errors.New("spirv: invalid header")
+	}
+
+	p := newParser(words[3])
+	for offset := 5; offset < len(words); {
+		wordCount := int(words[offset] >> 16)
+		opcode := words[offset] & 0xffff
+		if wordCount == 0 || offset+wordCount > len(words) {
+			return nil, fmt.Errorf("spirv: malformed instruction at word %d", offset)
+		}
+
+		if err := p.instruction(opcode, words[offset+1:offset+wordCount]); err != nil {
+			return nil, fmt.Errorf("spirv: %s (at word %d)", err.Error(), offset)
+		}
+		offset += wordCount
+	}
+
+	module, err := p.module()
+	if err != nil {
+		return nil, err
+	}
+	module.Version = words[1]
+
+	return module, nil
+}
+
+// Instruction opcodes used for reflection.
+const (
+	opName              = 5
+	opMemberName        = 6
+	opEntryPoint        = 15
+	opTypeVoid          = 19
+	opTypeBool          = 20
+	opTypeInt           = 21
+	opTypeFloat         = 22
+	opTypeVector        = 23
+	opTypeMatrix        = 24
+	opTypeImage         = 25
+	opTypeSampler       = 26
+	opTypeSampledImage  = 27
+	opTypeArray         = 28
+	opTypeRuntimeArray  = 29
+	opTypeStruct        = 30
+	opTypePointer       = 32
+	opConstant          = 43
+	opSpecConstantTrue  = 48
+	opSpecConstantFalse = 49
+	opSpecConstant      = 50
+	opVariable          = 59
+	opDecorate          = 71
+	opMemberDecorate    = 72
+)
+
+// Decorations used for reflection.
+const (
+	decorationSpecID        = 1
+	decorationBlock         = 2
+	decorationBufferBlock   = 3
+	decorationArrayStride   = 6
+	decorationMatrixStride  = 7
+	decorationBuiltIn       = 11
+	decorationLocation      = 30
+	decorationComponent     = 31
+	decorationBinding       = 33
+	decorationDescriptorSet = 34
+	decorationOffset        = 35
+)
+
+// Storage classes used for reflection.
+const (
+	storageUniformConstant = 0
+	storageInput           = 1
+	storageUniform         = 2
+	storageOutput          = 3
+	storagePushConstant    = 9
+	storageStorageBuffer   = 12
+)
+
+type decorations map[uint32][]uint32
+
+func (d decorations) has(decoration uint32) bool {
+	_, ok := d[decoration]
+	return ok
+}
+
+func (d decorations) value(decoration uint32) uint32 {
+	if literals := d[decoration]; len(literals) > 0 {
+		return literals[0]
+	}
+
+	return 0
+}
+
+type entryPoint struct {
+	name       string
+	stage      Stage
+	interfaces []uint32
+}
+
+type variable struct {
+	id           uint32
+	pointerType  uint32
+	storageClass uint32
+}
+
+type specConstant struct {
+	id       uint32
+	typeID   uint32
+	defaults uint64
+}
+
+// parser collects the relevant instructions of a module. Types may only be
+// resolved once all decorations are known, which is done in module().
+type parser struct {
+	bound uint32
+
+	names             map[uint32]string
+	memberNames       map[uint32]map[uint32]string
+	decorations       map[uint32]decorations
+	memberDecorations map[uint32]map[uint32]decorations
+
+	typeInstructions map[uint32][]uint32
+	typeOpcodes      map[uint32]uint32
+	constants        map[uint32][]uint32
+	types            map[uint32]*Type
+
+	entryPoints   []entryPoint
+	variables     []variable
+	specConstants []specConstant
+}
+
+func newParser(bound uint32) *parser {
+	return &parser{
+		bound:             bound,
+		names:             make(map[uint32]string),
+		memberNames:       make(map[uint32]map[uint32]string),
+		decorations:       make(map[uint32]decorations),
+		memberDecorations: make(map[uint32]map[uint32]decorations),
+		typeInstructions:  make(map[uint32][]uint32),
+		typeOpcodes:       make(map[uint32]uint32),
+		constants:         make(map[uint32][]uint32),
+		types:             make(map[uint32]*Type),
+	}
+}
+
+func (p *parser) instruction(opcode uint32, operands []uint32) error {
+	switch opcode {
+	case opName:
+		if len(operands) < 1 {
+			return errors.New("truncated OpName")
+		}
+		p.names[operands[0]] = decodeString(operands[1:])
+
+	case opMemberName:
+		if len(operands) < 2 {
+			return errors.New("truncated OpMemberName")
+		}
+		if p.memberNames[operands[0]] == nil {
+			p.memberNames[operands[0]] = make(map[uint32]string)
+		}
+		p.memberNames[operands[0]][operands[1]] = decodeString(operands[2:])
+
+	case opEntryPoint:
+		if len(operands) < 3 {
+			return errors.New("truncated OpEntryPoint")
+		}
+		name := decodeString(operands[2:])
+		nameWords := (len(name) + 4) / 4
+		p.entryPoints = append(p.entryPoints, entryPoint{
+			stage:      Stage(operands[0]),
+			name:       name,
+			interfaces: operands[2+nameWords:],
+		})
+
+	case opDecorate:
+		if len(operands) < 2 {
+			return errors.New("truncated OpDecorate")
+		}
+		if p.decorations[operands[0]] == nil {
+			p.decorations[operands[0]] = make(decorations)
+		}
+		p.decorations[operands[0]][operands[1]] = operands[2:]
+
+	case opMemberDecorate:
+		if len(operands) < 3 {
+			return errors.New("truncated OpMemberDecorate")
+		}
+		members := p.memberDecorations[operands[0]]
+		if members == nil {
+			members = make(map[uint32]decorations)
+			p.memberDecorations[operands[0]] = members
+		}
+		if members[operands[1]] == nil {
+			members[operands[1]] = make(decorations)
+		}
+		members[operands[1]][operands[2]] = operands[3:]
+
+	case opTypeVoid, opTypeBool, opTypeInt, opTypeFloat, opTypeVector, opTypeMatrix, opTypeImage,
+		opTypeSampler, opTypeSampledImage, opTypeArray, opTypeRuntimeArray, opTypeStruct, opTypePointer:
+		if len(operands) < 1 {
+			return errors.New("truncated type declaration")
+		}
+		p.typeOpcodes[operands[0]] = opcode
+		p.typeInstructions[operands[0]] = operands[1:]
+
+	case opConstant:
+		if len(operands) < 3 {
+			return errors.New("truncated OpConstant")
+		}
+		p.constants[operands[1]] = operands[2:]
+
+	case opSpecConstantTrue, opSpecConstantFalse:
+		if len(operands) < 2 {
+			return errors.New("truncated boolean OpSpecConstant")
+		}
+		var value uint64
+		if opcode == opSpecConstantTrue {
+			value = 1
+		}
+		p.specConstants = append(p.specConstants, specConstant{id: operands[1], typeID: operands[0], defaults: value})
+
+	case opSpecConstant:
+		if len(operands) < 3 {
+			return errors.New("truncated OpSpecConstant")
+		}
+		value := uint64(operands[2])
+		if len(operands) > 3 {
+			value |= uint64(operands[3]) << 32
+		}
+		p.specConstants = append(p.specConstants, specConstant{id: operands[1], typeID: operands[0], defaults: value})
+		// Arrays may be sized by specialization constants
+		p.constants[operands[1]] = operands[2:]
+
+	case opVariable:
+		if len(operands) < 3 {
+			return errors.New("truncated OpVariable")
+		}
+		p.variables = append(p.variables, variable{
+			pointerType:  operands[0],
+			id:           operands[1],
+			storageClass: operands[2],
+		})
+	}
+
+	return nil
+}
+
+func (p *parser) module() (*Module, error) {
+	module := &Module{}
+	variables := make(map[uint32]variable, len(p.variables))
+
+	for _, v := range p.variables {
+		variables[v.id] = v
+
+		if err := p.addResource(module, v); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, ep := range p.entryPoints {
+		entry := EntryPoint{Name: ep.name, Stage: ep.stage}
+
+		for _, id := range ep.interfaces {
+			v, ok := variables[id]
+			if !ok || (v.storageClass != storageInput && v.storageClass != storageOutput) {
+				continue
+			}
+
+			// Built-ins (gl_Position, gl_VertexIndex, ...) are either decorated
+			// themselves or are a block whose members are decorated.
+			if p.decorations[id].has(decorationBuiltIn) {
+				continue
+			}
+
+			t, err := p.pointee(v.pointerType)
+			if err != nil {
+				return nil, err
+			}
+			if t.isBuiltInBlock {
+				continue
+			}
+
+			decorations := p.decorations[id]
+			if !decorations.has(decorationLocation) {
+				return nil, fmt.Errorf("spirv: stage variable %s has no location", p.name(id))
+			}
+
+			stageVariable := Variable{
+				Name:      p.names[id],
+				Location:  decorations.value(decorationLocation),
+				Component: decorations.value(decorationComponent),
+				Type:      t,
+			}
+			if v.storageClass == storageInput {
+				entry.Inputs = append(entry.Inputs, stageVariable)
+			} else {
+				entry.Outputs = append(entry.Outputs, stageVariable)
+			}
+		}
+
+		sort.Slice(entry.Inputs, func(i, j int) bool { return entry.Inputs[i].Location < entry.Inputs[j].Location })
+		sort.Slice(entry.Outputs, func(i, j int) bool { return entry.Outputs[i].Location < entry.Outputs[j].Location })
+		module.EntryPoints = append(module.EntryPoints, entry)
+	}
+
+	for _, sc := range p.specConstants {
+		decorations := p.decorations[sc.id]
+		if !decorations.has(decorationSpecID) {
+			continue
+		}
+
+		t, err := p.resolve(sc.typeID)
+		if err != nil {
+			return nil, err
+		}
+
+		module.SpecConstants = append(module.SpecConstants, SpecConstant{
+			Name:    p.names[sc.id],
+			ID:      decorations.value(decorationSpecID),
+			Type:    t,
+			Default: sc.defaults,
+		})
+	}
+
+	sort.Slice(module.DescriptorBindings, func(i, j int) bool {
+		a, b := module.DescriptorBindings[i], module.DescriptorBindings[j]
+		return a.Set < b.Set || (a.Set == b.Set && a.Binding < b.Binding)
+	})
+	sort.Slice(module.SpecConstants, func(i, j int) bool { return module.SpecConstants[i].ID < module.SpecConstants[j].ID })
+
+	return module, nil
+}
+
+// addResource adds descriptor bindings and push constant blocks to the module.
+func (p *parser) addResource(module *Module, v variable) error {
+	switch v.storageClass {
+	case storageUniformConstant, storageUniform, storageStorageBuffer:
+	case storagePushConstant:
+		t, err := p.pointee(v.pointerType)
+		if err != nil {
+			return err
+		}
+
+		module.PushConstants = append(module.PushConstants, Block{
+			Name:   p.name(v.id),
+			Offset: t.firstOffset(),
+			Size:   t.Size,
+			Type:   t,
+		})
+		return nil
+	default:
+		return nil
+	}
+
+	t, err := p.pointee(v.pointerType)
+	if err != nil {
+		return err
+	}
+
+	binding := DescriptorBinding{
+		Name:    p.name(v.id),
+		Set:     p.decorations[v.id].value(decorationDescriptorSet),
+		Binding: p.decorations[v.id].value(decorationBinding),
+		Count:   1,
+	}
+
+	// Arrays of resources take one descriptor per element. The length of a
+	// single array may be specialized.
+	if t.Kind == KindArray && t.SpecializedLength && t.Elem.Kind != KindArray && t.Elem.Kind != KindRuntimeArray {
+		binding.SpecializedCount, binding.CountSpecID = true, t.LengthSpecID
+	}
+	for t.Kind == KindArray || t.Kind == KindRuntimeArray {
+		if t.Kind == KindRuntimeArray {
+			binding.Count = 0
+		} else {
+			binding.Count *= t.Length
+		}
+		t = t.Elem
+	}
+
+	switch {
+	case t.Kind == KindSampler:
+		binding.Type = DescriptorSampler
+	case t.Kind == KindSampledImage:
+		binding.Type = DescriptorCombinedImageSampler
+	case t.Kind == KindImage && t.Image.Dim == DimBuffer && t.Image.Sampled == 2:
+		binding.Type = DescriptorStorageTexelBuffer
+	case t.Kind == KindImage && t.Image.Dim == DimBuffer:
+		binding.Type = DescriptorUniformTexelBuffer
+	case t.Kind == KindImage && t.Image.Dim == DimSubpassData:
+		binding.Type = DescriptorInputAttachment
+	case t.Kind == KindImage && t.Image.Sampled == 2:
+		binding.Type = DescriptorStorageImage
+	case t.Kind == KindImage:
+		binding.Type = DescriptorSampledImage
+	case t.Kind == KindStruct && (v.storageClass == storageStorageBuffer || t.bufferBlock):
+		binding.Type = DescriptorStorageBuffer
+		binding.Size = t.Size
+	case t.Kind == KindStruct:
+		binding.Type = DescriptorUniformBuffer
+		binding.Size = t.Size
+	default:
+		return fmt.Errorf("spirv: unsupported resource type for %s", binding.Name)
+	}
+
+	module.DescriptorBindings = append(module.DescriptorBindings, binding)
+	return nil
+}
+
+func (p *parser) name(id uint32) string {
+	if name, ok := p.names[id]; ok && name != "" {
+		return name
+	}
+
+	return fmt.Sprintf("%%%d", id)
+}
+
+func (p *parser) pointee(pointerType uint32) (*Type, error) {
+	operands, ok := p.typeInstructions[pointerType]
+	if !ok || p.typeOpcodes[pointerType] != opTypePointer || len(operands) < 2 {
+		return nil, fmt.Errorf("spirv: %%%d is not a pointer type", pointerType)
+	}
+
+	return p.resolve(operands[1])
+}
+
+// decodeString decodes a nul-terminated UTF-8 literal string.
+func decodeString(words []uint32) string {
+	bytes := make([]byte, 0, len(words)*4)
+	for _, word := range words {
+		for i := uint(0); i < 4; i++ {
+			b := byte(word >> (8 * i))
+			if b == 0 {
+				return string(bytes)
+			}
+			bytes = append(bytes, b)
+		}
+	}
+
+	return string(bytes)
+}
@@ -0,0 +1,394 @@
+package spirv
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+// assembler builds small SPIR-V modules for the tests below.
+type assembler struct {
+	words []uint32
+}
+
+func newAssembler() *assembler {
+	return &assembler{words: []uint32{magicNumber, 0x00010000, 0, 100, 0}}
+}
+
+func (a *assembler) op(opcode uint32, operands ...uint32) {
+	a.words = append(a.words, uint32(len(operands)+1)<<16|opcode)
+	a.words = append(a.words, operands...)
+}
+
+func str(s string) []uint32 {
+	bytes := append([]byte(s), 0)
+	for len(bytes)%4 != 0 {
+		bytes = append(bytes, 0)
+	}
+
+	words := make([]uint32, len(bytes)/4)
+	for i := range words {
+		words[i] = uint32(bytes[i*4]) | uint32(bytes[i*4+1])<<8 | uint32(bytes[i*4+2])<<16 | uint32(bytes[i*4+3])<<24
+	}
+
+	return words
+}
+
+func concat(parts ...[]uint32) []uint32 {
+	var words []uint32
+	for _, part := range parts {
+		words = append(words, part...)
+	}
+
+	return words
+}
+
+func parseFile(t *testing.T, name string) *Module {
+	code, err := ioutil.ReadFile("../shaders/spirv/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	module, err := Parse(code)
+	if err != nil {
+		t.Fatalf("failed to parse %s: %s", name, err.Error())
+	}
+
+	return module
+}
+
+func TestParse_vertexShader(t *testing.T) {
+	module := parseFile(t, "shader.vert.spv")
+
+	entryPoint, err := module.EntryPoint("main", StageVertex)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entryPoint.Inputs) != 0 {
+		t.Errorf("expected built-in gl_VertexIndex to be skipped, got %d inputs", len(entryPoint.Inputs))
+	}
+	if len(entryPoint.Outputs) != 1 {
+		t.Fatalf("expected 1 output (gl_PerVertex skipped), got %d", len(entryPoint.Outputs))
+	}
+
+	output := entryPoint.Outputs[0]
+	if output.Name != "fragColor" || output.Location != 0 {
+		t.Errorf("expected fragColor at location 0, got %s at %d", output.Name, output.Location)
+	}
+	if output.Type.Kind != KindVector || output.Type.Components != 3 || output.Type.Elem.Kind != KindFloat {
+		t.Errorf("expected fragColor to be a float vec3, got %s", output.Type)
+	}
+}
+
+func TestParse_fragmentShader(t *testing.T) {
+	module := parseFile(t, "shader.frag.spv")
+
+	entryPoint, err := module.EntryPoint("main", StageFragment)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entryPoint.Inputs) != 1 || entryPoint.Inputs[0].Name != "fragColor" {
+		t.Errorf("expected single input fragColor, got %v", entryPoint.Inputs)
+	}
+	if len(entryPoint.Outputs) != 1 || entryPoint.Outputs[0].Type.Components != 4 {
+		t.Errorf("expected single vec4 output, got %v", entryPoint.Outputs)
+	}
+	if len(module.DescriptorBindings) != 0 || len(module.PushConstants) != 0 {
+		t.Error("expected no resources")
+	}
+}
+
+func TestParse_wrongEntryPoint(t *testing.T) {
+	module := parseFile(t, "shader.frag.spv")
+
+	if _, err := module.EntryPoint("main", StageVertex); err == nil {
+		t.Error("expected an error for a missing entry point")
+	}
+}
+
+func TestParse_invalid(t *testing.T) {
+	if _, err := Parse([]byte{1, 2, 3}); err == nil {
+		t.Error("expected an error for a truncated module")
+	}
+
+	if _, err := Parse(make([]byte, 40)); err == nil {
+		t.Error("expected an error for a module without magic number")
+	}
+
+	a := newAssembler()
+	a.words = append(a.words, 10<<16|opName, 1)
+	if _, err := ParseWords(a.words); err == nil {
+		t.Error("expected an error for an instruction running past the end")
+	}
+}
+
+// resourceModule assembles a vertex shader with vertex inputs, a uniform
+// buffer, an array of combined image samplers, a push constant block and two
+// specialization constants.
+func resourceModule() []uint32 {
+	const (
+		idMain = iota + 1
+		idFloat
+		idVec2
+		idVec3
+		idVec4
+		idMat4
+		idInt
+		idBool
+		idUint
+		idFour
+		idUBO
+		idUBOPtr
+		idUBOVar
+		idImage
+		idSampledImage
+		idSamplerArray
+		idSamplerPtr
+		idSamplerVar
+		idPush
+		idPushPtr
+		idPushVar
+		idInVec3Ptr
+		idInVec2Ptr
+		idOutVec2Ptr
+		idPosition
+		idUV
+		idOutUV
+		idPerVertex
+		idPerVertexPtr
+		idPerVertexVar
+		idSpecCount
+		idSpecEnabled
+	)
+
+	a := newAssembler()
+	a.op(opEntryPoint, concat([]uint32{uint32(StageVertex), idMain}, str("main"),
+		[]uint32{idPosition, idUV, idOutUV, idPerVertexVar})...)
+
+	a.op(opName, concat([]uint32{idUBOVar}, str("camera"))...)
+	a.op(opName, concat([]uint32{idSamplerVar}, str("textures"))...)
+	a.op(opName, concat([]uint32{idPushVar}, str("constants"))...)
+	a.op(opName, concat([]uint32{idPosition}, str("inPosition"))...)
+	a.op(opName, concat([]uint32{idUV}, str("inUV"))...)
+	a.op(opName, concat([]uint32{idOutUV}, str("outUV"))...)
+	a.op(opName, concat([]uint32{idSpecCount}, str("lightCount"))...)
+	a.op(opMemberName, concat([]uint32{idPush, 1}, str("scale"))...)
+
+	a.op(opDecorate, idUBO, decorationBlock)
+	a.op(opMemberDecorate, idUBO, 0, decorationOffset, 0)
+	a.op(opMemberDecorate, idUBO, 0, decorationMatrixStride, 16)
+	a.op(opDecorate, idUBOVar, decorationDescriptorSet, 0)
+	a.op(opDecorate, idUBOVar, decorationBinding, 0)
+	a.op(opDecorate, idSamplerVar, decorationDescriptorSet, 1)
+	a.op(opDecorate, idSamplerVar, decorationBinding, 2)
+	a.op(opDecorate, idPush, decorationBlock)
+	a.op(opMemberDecorate, idPush, 0, decorationOffset, 16)
+	a.op(opMemberDecorate, idPush, 1, decorationOffset, 32)
+	a.op(opDecorate, idPosition, decorationLocation, 0)
+	a.op(opDecorate, idUV, decorationLocation, 1)
+	a.op(opDecorate, idOutUV, decorationLocation, 0)
+	a.op(opMemberDecorate, idPerVertex, 0, decorationBuiltIn, 0)
+	a.op(opDecorate, idPerVertex, decorationBlock)
+	a.op(opDecorate, idSpecCount, decorationSpecID, 3)
+	a.op(opDecorate, idSpecEnabled, decorationSpecID, 4)
+
+	a.op(opTypeFloat, idFloat, 32)
+	a.op(opTypeVector, idVec2, idFloat, 2)
+	a.op(opTypeVector, idVec3, idFloat, 3)
+	a.op(opTypeVector, idVec4, idFloat, 4)
+	a.op(opTypeMatrix, idMat4, idVec4, 4)
+	a.op(opTypeInt, idInt, 32, 1)
+	a.op(opTypeBool, idBool)
+	a.op(opTypeInt, idUint, 32, 0)
+	a.op(opConstant, idUint, idFour, 4)
+	a.op(opTypeStruct, idUBO, idMat4)
+	a.op(opTypePointer, idUBOPtr, storageUniform, idUBO)
+	a.op(opTypeImage, idImage, idFloat, uint32(Dim2D), 0, 0, 0, 1, 0)
+	a.op(opTypeSampledImage, idSampledImage, idImage)
+	a.op(opTypeArray, idSamplerArray, idSampledImage, idFour)
+	a.op(opTypePointer, idSamplerPtr, storageUniformConstant, idSamplerArray)
+	a.op(opTypeStruct, idPush, idVec4, idFloat)
+	a.op(opTypePointer, idPushPtr, storagePushConstant, idPush)
+	a.op(opTypePointer, idInVec3Ptr, storageInput, idVec3)
+	a.op(opTypePointer, idInVec2Ptr, storageInput, idVec2)
+	a.op(opTypePointer, idOutVec2Ptr, storageOutput, idVec2)
+	a.op(opTypeStruct, idPerVertex, idVec4)
+	a.op(opTypePointer, idPerVertexPtr, storageOutput, idPerVertex)
+	a.op(opSpecConstant, idInt, idSpecCount, 7)
+	a.op(opSpecConstantTrue, idBool, idSpecEnabled)
+
+	a.op(opVariable, idUBOPtr, idUBOVar, storageUniform)
+	a.op(opVariable, idSamplerPtr, idSamplerVar, storageUniformConstant)
+	a.op(opVariable, idPushPtr, idPushVar, storagePushConstant)
+	a.op(opVariable, idInVec3Ptr, idPosition, storageInput)
+	a.op(opVariable, idInVec2Ptr, idUV, storageInput)
+	a.op(opVariable, idOutVec2Ptr, idOutUV, storageOutput)
+	a.op(opVariable, idPerVertexPtr, idPerVertexVar, storageOutput)
+
+	return a.words
+}
+
+func TestParse_resources(t *testing.T) {
+	module, err := ParseWords(resourceModule())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(module.DescriptorBindings) != 2 {
+		t.Fatalf("expected 2 descriptor bindings, got %d", len(module.DescriptorBindings))
+	}
+
+	ubo := module.DescriptorBindings[0]
+	if ubo.Name != "camera" || ubo.Set != 0 || ubo.Binding != 0 || ubo.Type != DescriptorUniformBuffer || ubo.Size != 64 {
+		t.Errorf("unexpected uniform buffer binding %+v", ubo)
+	}
+
+	textures := module.DescriptorBindings[1]
+	if textures.Set != 1 || textures.Binding != 2 || textures.Type != DescriptorCombinedImageSampler || textures.Count != 4 {
+		t.Errorf("unexpected sampler binding %+v", textures)
+	}
+
+	if len(module.PushConstants) != 1 {
+		t.Fatalf("expected 1 push constant block, got %d", len(module.PushConstants))
+	}
+	push := module.PushConstants[0]
+	if push.Offset != 16 || push.Size != 36 || push.Type.Members[1].Name != "scale" {
+		t.Errorf("unexpected push constant block %+v", push)
+	}
+}
+
+func TestParse_specConstants(t *testing.T) {
+	module, err := ParseWords(resourceModule())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(module.SpecConstants) != 2 {
+		t.Fatalf("expected 2 specialization constants, got %d", len(module.SpecConstants))
+	}
+
+	count := module.SpecConstants[0]
+	if count.ID != 3 || count.Name != "lightCount" || count.Default != 7 || count.Type.Kind != KindInt {
+		t.Errorf("unexpected specialization constant %+v", count)
+	}
+
+	enabled := module.SpecConstants[1]
+	if enabled.ID != 4 || enabled.Default != 1 || enabled.Type.Kind != KindBool {
+		t.Errorf("unexpected specialization constant %+v", enabled)
+	}
+}
+
+func TestParse_stageInterface(t *testing.T) {
+	module, err := ParseWords(resourceModule())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entryPoint := module.EntryPoints[0]
+	if len(entryPoint.Inputs) != 2 {
+		t.Fatalf("expected 2 inputs, got %d", len(entryPoint.Inputs))
+	}
+	if entryPoint.Inputs[0].Name != "inPosition" || entryPoint.Inputs[1].Location != 1 {
+		t.Errorf("expected inputs sorted by location, got %v", entryPoint.Inputs)
+	}
+	if len(entryPoint.Outputs) != 1 || entryPoint.Outputs[0].Name != "outUV" {
+		t.Errorf("expected built-in block to be skipped, got %v", entryPoint.Outputs)
+	}
+}
+
+func TestType_Locations(t *testing.T) {
+	float := &Type{Kind: KindFloat, Width: 32}
+	double := &Type{Kind: KindFloat, Width: 64}
+	vec4 := &Type{Kind: KindVector, Components: 4, Elem: float}
+	dvec4 := &Type{Kind: KindVector, Components: 4, Elem: double}
+
+	tests := []struct {
+		name      string
+		t         *Type
+		locations uint32
+	}{
+		{"float", float, 1},
+		{"vec4", vec4, 1},
+		{"dvec4", dvec4, 2},
+		{"mat4", &Type{Kind: KindMatrix, Columns: 4, Elem: vec4}, 4},
+		{"vec4[3]", &Type{Kind: KindArray, Length: 3, Elem: vec4}, 3},
+	}
+
+	for _, test := range tests {
+		if locations := test.t.Locations(); locations != test.locations {
+			t.Errorf("expected %s to take %d locations, got %d", test.name, test.locations, locations)
+		}
+	}
+}
+
+func TestValidateInterface(t *testing.T) {
+	vertex := parseFile(t, "shader.vert.spv")
+	fragment := parseFile(t, "shader.frag.spv")
+
+	if err := ValidateInterface(&vertex.EntryPoints[0], &fragment.EntryPoints[0]); err != nil {
+		t.Errorf("expected built-in shaders to match, got %s", err.Error())
+	}
+}
+
+func TestValidateInterface_mismatch(t *testing.T) {
+	float := &Type{Kind: KindFloat, Width: 32}
+	vec3 := &Type{Kind: KindVector, Components: 3, Elem: float}
+	vec4 := &Type{Kind: KindVector, Components: 4, Elem: float}
+
+	producer := &EntryPoint{Stage: StageVertex, Outputs: []Variable{
+		{Name: "color", Location: 0, Type: vec3},
+	}}
+	consumer := &EntryPoint{Stage: StageFragment, Inputs: []Variable{
+		{Name: "color", Location: 0, Type: vec4},
+		{Name: "normal", Location: 1, Type: vec3},
+	}}
+
+	err := ValidateInterface(producer, consumer)
+	interfaceErr, ok := err.(*InterfaceError)
+	if !ok {
+		t.Fatalf("expected an InterfaceError, got %v", err)
+	}
+	if len(interfaceErr.Mismatches) != 2 {
+		t.Errorf("expected a type and a missing output mismatch, got %v", interfaceErr.Mismatches)
+	}
+}
+
+func TestParse_specializedArrayLength(t *testing.T) {
+	const (
+		idFloat = iota + 1
+		idUint
+		idCount
+		idImage
+		idSampledImage
+		idSamplerArray
+		idSamplerPtr
+		idSamplerVar
+	)
+
+	a := newAssembler()
+	a.op(opDecorate, idCount, decorationSpecID, 0)
+	a.op(opDecorate, idSamplerVar, decorationDescriptorSet, 0)
+	a.op(opDecorate, idSamplerVar, decorationBinding, 0)
+	a.op(opTypeFloat, idFloat, 32)
+	a.op(opTypeInt, idUint, 32, 0)
+	a.op(opSpecConstant, idUint, idCount, 16)
+	a.op(opTypeImage, idImage, idFloat, uint32(Dim2D), 0, 0, 0, 1, 0)
+	a.op(opTypeSampledImage, idSampledImage, idImage)
+	a.op(opTypeArray, idSamplerArray, idSampledImage, idCount)
+	a.op(opTypePointer, idSamplerPtr, storageUniformConstant, idSamplerArray)
+	a.op(opVariable, idSamplerPtr, idSamplerVar, storageUniformConstant)
+
+	module, err := ParseWords(a.words)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(module.DescriptorBindings) != 1 {
+		t.Fatalf("expected 1 descriptor binding, got %d", len(module.DescriptorBindings))
+	}
+	textures := module.DescriptorBindings[0]
+	if textures.Count != 16 || !textures.SpecializedCount || textures.CountSpecID != 0 {
+		t.Errorf("unexpected specialized sampler binding %+v", textures)
+	}
+}
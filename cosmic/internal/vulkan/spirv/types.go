@@ -0,0 +1,341 @@
+package spirv
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Kind identifies the kind of a Type.
+type Kind int
+
+const (
+	KindVoid Kind = iota
+	KindBool
+	KindInt
+	KindFloat
+	KindVector
+	KindMatrix
+	KindImage
+	KindSampler
+	KindSampledImage
+	KindArray
+	KindRuntimeArray
+	KindStruct
+)
+
+// Dim is the dimensionality of an image type.
+type Dim uint32
+
+const (
+	Dim1D Dim = iota
+	Dim2D
+	Dim3D
+	DimCube
+	DimRect
+	DimBuffer
+	DimSubpassData
+)
+
+// Type is a reflected SPIR-V type.
+type Type struct {
+	Kind Kind
+	Name string
+
+	// Bit width and signedness of scalars.
+	Width  uint32
+	Signed bool
+
+	// Components of a vector, or columns of a matrix.
+	Components uint32
+	Columns    uint32
+
+	// Component type of vectors, column type of matrices and element type of
+	// arrays. Image type of sampled images.
+	Elem *Type
+
+	// Length of fixed size arrays and the explicit stride of arrays, if any.
+	Length uint32
+	Stride uint32
+	// Set when the length of an array is a specialization constant, whose
+	// default Length holds.
+	SpecializedLength bool
+	LengthSpecID      uint32
+
+	Members []Member
+	Image   *ImageInfo
+
+	// Size in bytes. For blocks this follows the explicit layout given by the
+	// Offset, ArrayStride and MatrixStride decorations.
+	Size uint32
+
+	isBuiltInBlock bool
+	bufferBlock    bool
+}
+
+// Member is a member of a struct type.
+type Member struct {
+	Name   string
+	Offset uint32
+	Type   *Type
+}
+
+// ImageInfo describes an image type.
+type ImageInfo struct {
+	Dim          Dim
+	Depth        uint32
+	Arrayed      bool
+	Multisampled bool
+	// 1 when used with a sampler, 2 when used as storage image.
+	Sampled uint32
+	Format  uint32
+}
+
+// Equal reports whether two types have the same shape. Names are ignored,
+// as they do not have to match across stages.
+func (t *Type) Equal(other *Type) bool {
+	if t == other {
+		return true
+	}
+	if t == nil || other == nil {
+		return false
+	}
+
+	if t.Kind != other.Kind || t.Width != other.Width || t.Signed != other.Signed ||
+		t.Components != other.Components || t.Columns != other.Columns || t.Length != other.Length ||
+		len(t.Members) != len(other.Members) {
+		return false
+	}
+
+	for i := range t.Members {
+		if !t.Members[i].Type.Equal(other.Members[i].Type) {
+			return false
+		}
+	}
+
+	if (t.Elem == nil) != (other.Elem == nil) {
+		return false
+	}
+
+	return t.Elem == nil || t.Elem.Equal(other.Elem)
+}
+
+// Locations returns the number of interface locations a stage variable of
+// this type occupies.
+func (t *Type) Locations() uint32 {
+	switch t.Kind {
+	case KindVector:
+		// 64-bit three- and four-component vectors take two locations
+		if t.Elem.Width == 64 && t.Components > 2 {
+			return 2
+		}
+		return 1
+	case KindMatrix:
+		return t.Columns * t.Elem.Locations()
+	case KindArray:
+		return t.Length * t.Elem.Locations()
+	case KindStruct:
+		var locations uint32
+		for _, member := range t.Members {
+			locations += member.Type.Locations()
+		}
+		return locations
+	default:
+		return 1
+	}
+}
+
+func (t *Type) String() string {
+	switch t.Kind {
+	case KindVoid:
+		return "void"
+	case KindBool:
+		return "bool"
+	case KindInt:
+		if t.Signed {
+			return "int" + strconv.Itoa(int(t.Width))
+		}
+		return "uint" + strconv.Itoa(int(t.Width))
+	case KindFloat:
+		return "float" + strconv.Itoa(int(t.Width))
+	case KindVector:
+		return fmt.Sprintf("%s vec%d", t.Elem, t.Components)
+	case KindMatrix:
+		return fmt.Sprintf("%s mat%dx%d", t.Elem.Elem, t.Columns, t.Elem.Components)
+	case KindImage:
+		return "image"
+	case KindSampler:
+		return "sampler"
+	case KindSampledImage:
+		return "sampled image"
+	case KindArray:
+		return fmt.Sprintf("%s[%d]", t.Elem, t.Length)
+	case KindRuntimeArray:
+		return fmt.Sprintf("%s[]", t.Elem)
+	case KindStruct:
+		if t.Name != "" {
+			return "struct " + t.Name
+		}
+		return "struct"
+	default:
+		return "unknown"
+	}
+}
+
+// firstOffset returns the offset of the first member of a block.
+func (t *Type) firstOffset() uint32 {
+	if t.Kind != KindStruct || len(t.Members) == 0 {
+		return 0
+	}
+
+	offset := t.Members[0].Offset
+	for _, member := range t.Members[1:] {
+		if member.Offset < offset {
+			offset = member.Offset
+		}
+	}
+
+	return offset
+}
+
+// resolve builds the Type with the given id, including its size.
+func (p *parser) resolve(id uint32) (*Type, error) {
+	if t, ok := p.types[id]; ok {
+		return t, nil
+	}
+
+	operands, ok := p.typeInstructions[id]
+	if !ok {
+		return nil, fmt.Errorf("spirv: %%%d is not a type", id)
+	}
+
+	t := &Type{Name: p.names[id]}
+	p.types[id] = t
+
+	var err error
+	switch p.typeOpcodes[id] {
+	case opTypeVoid:
+		t.Kind = KindVoid
+	case opTypeBool:
+		t.Kind = KindBool
+		t.Width = 32
+		t.Size = 4
+	case opTypeInt:
+		t.Kind = KindInt
+		t.Width = operand(operands, 0)
+		t.Signed = operand(operands, 1) == 1
+		t.Size = t.Width / 8
+	case opTypeFloat:
+		t.Kind = KindFloat
+		t.Width = operand(operands, 0)
+		t.Size = t.Width / 8
+	case opTypeVector:
+		t.Kind = KindVector
+		t.Components = operand(operands, 1)
+		if t.Elem, err = p.resolve(operand(operands, 0)); err == nil {
+			t.Size = t.Components * t.Elem.Size
+		}
+	case opTypeMatrix:
+		t.Kind = KindMatrix
+		t.Columns = operand(operands, 1)
+		if t.Elem, err = p.resolve(operand(operands, 0)); err == nil {
+			t.Size = t.Columns * t.Elem.Size
+		}
+	case opTypeImage:
+		t.Kind = KindImage
+		t.Image = &ImageInfo{
+			Dim:          Dim(operand(operands, 1)),
+			Depth:        operand(operands, 2),
+			Arrayed:      operand(operands, 3) == 1,
+			Multisampled: operand(operands, 4) == 1,
+			Sampled:      operand(operands, 5),
+			Format:       operand(operands, 6),
+		}
+	case opTypeSampler:
+		t.Kind = KindSampler
+	case opTypeSampledImage:
+		t.Kind = KindSampledImage
+		t.Elem, err = p.resolve(operand(operands, 0))
+	case opTypeArray:
+		t.Kind = KindArray
+		lengthID := operand(operands, 1)
+		length, ok := p.constants[lengthID]
+		if !ok || len(length) == 0 {
+			return nil, fmt.Errorf("spirv: array %%%d has a non-constant length", id)
+		}
+		t.Length = length[0]
+		if decorations := p.decorations[lengthID]; decorations.has(decorationSpecID) {
+			t.SpecializedLength, t.LengthSpecID = true, decorations.value(decorationSpecID)
+		}
+		t.Stride = p.decorations[id].value(decorationArrayStride)
+		if t.Elem, err = p.resolve(operand(operands, 0)); err == nil {
+			if t.Stride != 0 {
+				t.Size = t.Length * t.Stride
+			} else {
+				t.Size = t.Length * t.Elem.Size
+			}
+		}
+	case opTypeRuntimeArray:
+		t.Kind = KindRuntimeArray
+		t.Stride = p.decorations[id].value(decorationArrayStride)
+		t.Elem, err = p.resolve(operand(operands, 0))
+	case opTypeStruct:
+		err = p.resolveStruct(id, t, operands)
+	case opTypePointer:
+		return nil, fmt.Errorf("spirv: unexpected pointer type %%%d", id)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func (p *parser) resolveStruct(id uint32, t *Type, memberTypes []uint32) error {
+	t.Kind = KindStruct
+	t.bufferBlock = p.decorations[id].has(decorationBufferBlock)
+
+	var sequentialOffset uint32
+	for i, memberTypeID := range memberTypes {
+		memberType, err := p.resolve(memberTypeID)
+		if err != nil {
+			return err
+		}
+
+		decorations := p.memberDecorations[id][uint32(i)]
+		if decorations.has(decorationBuiltIn) {
+			t.isBuiltInBlock = true
+		}
+
+		member := Member{
+			Name:   p.memberNames[id][uint32(i)],
+			Offset: sequentialOffset,
+			Type:   memberType,
+		}
+		if decorations.has(decorationOffset) {
+			member.Offset = decorations.value(decorationOffset)
+		}
+
+		// The matrix stride of a member overrides the tightly packed size
+		size := memberType.Size
+		if memberType.Kind == KindMatrix && decorations.has(decorationMatrixStride) {
+			size = memberType.Columns * decorations.value(decorationMatrixStride)
+		}
+
+		t.Members = append(t.Members, member)
+		sequentialOffset = member.Offset + size
+		if sequentialOffset > t.Size {
+			t.Size = sequentialOffset
+		}
+	}
+
+	return nil
+}
+
+func operand(operands []uint32, i int) uint32 {
+	if i < len(operands) {
+		return operands[i]
+	}
+
+	return 0
+}
@@ -0,0 +1,137 @@
+package vulkan
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/graphics"
+	"github.com/lentus/cosmic-engine/cosmic/log"
+	"github.com/vulkan-go/vulkan"
+	stdimage "image"
+)
+
+// storageBuffer is a host visible storage buffer, so it is written and read
+// without staging buffers.
+type storageBuffer struct {
+	ctx    *Context
+	buffer buffer
+}
+
+func (ctx *Context) CreateStorageBuffer(size uint64) graphics.StorageBuffer {
+	if size == 0 {
+		log.PanicCore("cannot create an empty storage buffer")
+	}
+
+	return &storageBuffer{
+		ctx: ctx,
+		buffer: ctx.createBuffer(
+			size,
+			vulkan.BufferUsageStorageBufferBit|vulkan.BufferUsageTransferSrcBit|vulkan.BufferUsageTransferDstBit,
+			vulkan.MemoryPropertyHostVisibleBit|vulkan.MemoryPropertyHostCoherentBit,
+			"storage buffer",
+		),
+	}
+}
+
+func (b *storageBuffer) Size() uint64 {
+	return b.buffer.size
+}
+
+func (b *storageBuffer) Write(offset uint64, data []byte) {
+	if offset+uint64(len(data)) > b.buffer.size {
+		log.PanicfCore("cannot write %d bytes at offset %d to a storage buffer of %d bytes", len(data), offset, b.buffer.size)
+	}
+	b.ctx.write(b.buffer, offset, data)
+}
+
+func (b *storageBuffer) Read() []byte {
+	b.ctx.waitCompute()
+	return b.ctx.read(b.buffer)
+}
+
+// Destroy waits for the device to be idle, since the buffer may still be
+// used by dispatches in flight.
+func (b *storageBuffer) Destroy() {
+	vulkan.DeviceWaitIdle(b.ctx.device)
+	b.ctx.destroyBuffer(b.buffer)
+}
+
+// storageImage is an image that stays in the general layout, in which both
+// compute shaders and transfers can access it.
+type storageImage struct {
+	ctx    *Context
+	image  image
+	extent vulkan.Extent2D
+}
+
+func (ctx *Context) CreateStorageImage(width, height int) graphics.StorageImage {
+	if width <= 0 || height <= 0 {
+		log.PanicfCore("invalid storage image size %dx%d", width, height)
+	}
+
+	img := &storageImage{
+		ctx:    ctx,
+		extent: vulkan.Extent2D{Width: uint32(width), Height: uint32(height)},
+	}
+	img.image = ctx.createImage(
+		img.extent,
+		vulkan.FormatR8g8b8a8Unorm,
+		vulkan.SampleCount1Bit,
+		vulkan.ImageUsageStorageBit|vulkan.ImageUsageTransferSrcBit|vulkan.ImageUsageSampledBit,
+		vulkan.ImageAspectColorBit,
+		"storage image",
+	)
+
+	ctx.submitOneTimeCommands(ctx.computeQueue, ctx.computePool, "storage image layout", func(commandBuffer vulkan.CommandBuffer) {
+		ctx.transitionImage(commandBuffer, img.image.handle, vulkan.ImageLayoutUndefined, vulkan.ImageLayoutGeneral,
+			vulkan.PipelineStageTopOfPipeBit, 0,
+			vulkan.PipelineStageComputeShaderBit, vulkan.AccessShaderReadBit|vulkan.AccessShaderWriteBit)
+	})
+
+	return img
+}
+
+func (img *storageImage) Size() (width, height int) {
+	return int(img.extent.Width), int(img.extent.Height)
+}
+
+// ReadPixels copies the image to a host visible buffer. Unlike captured
+// frames, the alpha channel is kept as written by the shaders.
+func (img *storageImage) ReadPixels() *stdimage.RGBA {
+	ctx := img.ctx
+	ctx.waitCompute()
+
+	size := uint64(img.extent.Width) * uint64(img.extent.Height) * 4
+	buf := ctx.createBuffer(
+		size,
+		vulkan.BufferUsageTransferDstBit,
+		vulkan.MemoryPropertyHostVisibleBit|vulkan.MemoryPropertyHostCoherentBit,
+		"storage image readback buffer",
+	)
+	defer ctx.destroyBuffer(buf)
+
+	ctx.submitOneTimeCommands(ctx.computeQueue, ctx.computePool, "storage image readback", func(commandBuffer vulkan.CommandBuffer) {
+		region := vulkan.BufferImageCopy{
+			ImageSubresource: vulkan.ImageSubresourceLayers{
+				AspectMask: vulkan.ImageAspectFlags(vulkan.ImageAspectColorBit),
+				LayerCount: 1,
+			},
+			ImageExtent: vulkan.Extent3D{Width: img.extent.Width, Height: img.extent.Height, Depth: 1},
+		}
+		vulkan.CmdCopyImageToBuffer(commandBuffer, img.image.handle, vulkan.ImageLayoutGeneral,
+			buf.handle, 1, []vulkan.BufferImageCopy{region})
+
+		memoryBarrier(commandBuffer,
+			vulkan.PipelineStageTransferBit, vulkan.AccessTransferWriteBit,
+			vulkan.PipelineStageHostBit, vulkan.AccessHostReadBit)
+	})
+
+	rgba := stdimage.NewRGBA(stdimage.Rect(0, 0, int(img.extent.Width), int(img.extent.Height)))
+	copy(rgba.Pix, ctx.read(buf))
+
+	return rgba
+}
+
+// Destroy waits for the device to be idle, since the image may still be used
+// by dispatches in flight.
+func (img *storageImage) Destroy() {
+	vulkan.DeviceWaitIdle(img.ctx.device)
+	img.ctx.destroyImage(img.image)
+}
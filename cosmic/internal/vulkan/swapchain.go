@@ -5,6 +5,7 @@ import (
 	"github.com/lentus/cosmic-engine/cosmic/log"
 	"github.com/vulkan-go/glfw/v3.3/glfw"
 	"github.com/vulkan-go/vulkan"
+	"unsafe"
 )
 
 func (ctx *Context) createSwapchain() {
@@ -21,6 +22,7 @@ func (ctx *Context) createSwapchain() {
 		surfaceFormats[i].Deref()
 	}
 	ctx.surface.format = pickSurfaceFormat(surfaceFormats)
+	ctx.colorFormat = ctx.surface.format.Format
 	ctx.surface.presentMode = pickPresentMode(getPresentModes(ctx.gpu.ref, ctx.surface.ref))
 
 	ctx.swapchainImageCount = determineImageCount(
@@ -29,16 +31,25 @@ func (ctx *Context) createSwapchain() {
 	)
 	log.DebugfCore("Requesting %d swapchain images", ctx.swapchainImageCount)
 
-	ctx.swapchainImageExtent = createImageExtent(ctx.surface.capabilities, ctx.nativeWindow)
+	// Captures copy from the swapchain images, which most surfaces allow
+	imageUsage := vulkan.ImageUsageColorAttachmentBit
+	ctx.captureSupported = vulkan.ImageUsageFlagBits(ctx.surface.capabilities.SupportedUsageFlags)&vulkan.ImageUsageTransferSrcBit != 0
+	if ctx.captureSupported {
+		imageUsage |= vulkan.ImageUsageTransferSrcBit
+	} else {
+		log.WarnCore("Surface does not support copying from swapchain images, frames cannot be captured")
+	}
+
+	ctx.imageExtent = createImageExtent(ctx.surface.capabilities, ctx.nativeWindow)
 	swapchainCreateInfo := vulkan.SwapchainCreateInfo{
 		SType:            vulkan.StructureTypeSwapchainCreateInfo,
 		Surface:          ctx.surface.ref,
 		MinImageCount:    ctx.swapchainImageCount,
 		ImageFormat:      ctx.surface.format.Format,
 		ImageColorSpace:  ctx.surface.format.ColorSpace,
-		ImageExtent:      ctx.swapchainImageExtent,
+		ImageExtent:      ctx.imageExtent,
 		ImageArrayLayers: 1, // No stereoscopic rendering, which requires 2
-		ImageUsage:       vulkan.ImageUsageFlags(vulkan.ImageUsageColorAttachmentBit),
+		ImageUsage:       vulkan.ImageUsageFlags(imageUsage),
 		PreTransform:     ctx.surface.capabilities.CurrentTransform,
 		CompositeAlpha:   vulkan.CompositeAlphaOpaqueBit,
 		PresentMode:      ctx.surface.presentMode,
@@ -61,6 +72,7 @@ func (ctx *Context) createSwapchain() {
 	result := vulkan.CreateSwapchain(ctx.device, &swapchainCreateInfo, nil, &swapchain)
 	panicOnError(result, "create swapchain")
 	ctx.swapchain = swapchain
+	ctx.nameObject(vulkan.ObjectTypeSwapchain, unsafe.Pointer(ctx.swapchain), "swapchain")
 
 	var swapchainImageCount uint32
 	result = vulkan.GetSwapchainImages(ctx.device, ctx.swapchain, &swapchainImageCount, nil)
@@ -71,30 +83,30 @@ func (ctx *Context) createSwapchain() {
 }
 
 func createImageExtent(capabilities vulkan.SurfaceCapabilities, nativeWindow *glfw.Window) vulkan.Extent2D {
-	var swapchainImageExtent vulkan.Extent2D
+	var imageExtent vulkan.Extent2D
 	if capabilities.CurrentExtent.Width != vulkan.MaxUint32 {
-		swapchainImageExtent.Width = capabilities.CurrentExtent.Width
-		swapchainImageExtent.Height = capabilities.CurrentExtent.Height
+		imageExtent.Width = capabilities.CurrentExtent.Width
+		imageExtent.Height = capabilities.CurrentExtent.Height
 	} else {
 		width, height := nativeWindow.GetSize()
-		swapchainImageExtent.Width = uint32(width)
-		swapchainImageExtent.Height = uint32(height)
+		imageExtent.Width = uint32(width)
+		imageExtent.Height = uint32(height)
 
-		if swapchainImageExtent.Width < capabilities.MinImageExtent.Width {
-			swapchainImageExtent.Width = capabilities.MinImageExtent.Width
+		if imageExtent.Width < capabilities.MinImageExtent.Width {
+			imageExtent.Width = capabilities.MinImageExtent.Width
 		}
-		if swapchainImageExtent.Height < capabilities.MinImageExtent.Height {
-			swapchainImageExtent.Height = capabilities.MinImageExtent.Height
+		if imageExtent.Height < capabilities.MinImageExtent.Height {
+			imageExtent.Height = capabilities.MinImageExtent.Height
 		}
-		if swapchainImageExtent.Width > capabilities.MaxImageExtent.Width {
-			swapchainImageExtent.Width = capabilities.MaxImageExtent.Width
+		if imageExtent.Width > capabilities.MaxImageExtent.Width {
+			imageExtent.Width = capabilities.MaxImageExtent.Width
 		}
-		if swapchainImageExtent.Height > capabilities.MaxImageExtent.Height {
-			swapchainImageExtent.Height = capabilities.MaxImageExtent.Height
+		if imageExtent.Height > capabilities.MaxImageExtent.Height {
+			imageExtent.Height = capabilities.MaxImageExtent.Height
 		}
 	}
 
-	return swapchainImageExtent
+	return imageExtent
 }
 
 func determineImageCount(min, max uint32) uint32 {
@@ -111,6 +123,14 @@ type imageResourceSet struct {
 	view          vulkan.ImageView
 	commandBuffer vulkan.CommandBuffer
 	framebuffer   vulkan.Framebuffer
+
+	// Only set for offscreen images, swapchain images are owned by the
+	// swapchain
+	memory vulkan.DeviceMemory
+
+	// Whether the command buffer draws the batches of a past frame, so it
+	// must be recorded again before it is submitted
+	batchesRecorded bool
 }
 
 func (ctx *Context) createSwapchainImages() {
@@ -123,12 +143,13 @@ func (ctx *Context) createSwapchainImages() {
 	ctx.imageResourceSets = make([]imageResourceSet, ctx.swapchainImageCount)
 	for i := range ctx.imageResourceSets {
 		ctx.imageResourceSets[i].image = swapchainImages[i]
+		ctx.nameObject(vulkan.ObjectTypeImage, unsafe.Pointer(swapchainImages[i]), fmt.Sprintf("swapchain image %d", i))
 
 		imageViewCreateInfo := vulkan.ImageViewCreateInfo{
 			SType:      vulkan.StructureTypeImageViewCreateInfo,
 			Image:      ctx.imageResourceSets[i].image,
 			ViewType:   vulkan.ImageViewType2d,
-			Format:     ctx.surface.format.Format,
+			Format:     ctx.colorFormat,
 			Components: vulkan.ComponentMapping{}, // Use identity mapping for rgba components
 			SubresourceRange: vulkan.ImageSubresourceRange{
 				AspectMask:     vulkan.ImageAspectFlags(vulkan.ImageAspectColorBit),
@@ -143,6 +164,7 @@ func (ctx *Context) createSwapchainImages() {
 		result = vulkan.CreateImageView(ctx.device, &imageViewCreateInfo, nil, &imageView)
 		panicOnError(result, fmt.Sprintf("create swapchain image view nr %d", i))
 		ctx.imageResourceSets[i].view = imageView
+		ctx.nameObject(vulkan.ObjectTypeImageView, unsafe.Pointer(imageView), fmt.Sprintf("swapchain image view %d", i))
 	}
 }
 
@@ -19,13 +19,23 @@ func safeStr(str string) string {
 }
 
 func panicOnError(result vulkan.Result, operation string) {
+	if err := resultError(result, operation); err != nil {
+		log.PanicfCore("%s", err.Error())
+	}
+}
+
+// resultError returns an error for a failed operation, for the operations
+// that can fail without leaving the context unusable, like compiling reloaded
+// shaders into a pipeline.
+func resultError(result vulkan.Result, operation string) error {
 	if result < vulkan.Success {
-		log.PanicfCore("failed to %s: %s", operation, fmtResult(result))
+		return fmt.Errorf("failed to %s: %s", operation, fmtResult(result))
 	}
 
 	if result > vulkan.Success {
 		log.WarnfCore("%s partially successful: %s", operation, fmtResult(result))
 	}
+	return nil
 }
 
 func fmtResult(error vulkan.Result) string {
@@ -97,80 +107,76 @@ func fmtResult(error vulkan.Result) string {
 	return fmt.Sprintf("%s (%d)", errName, error)
 }
 
-func fmtObjectType(objectType vulkan.DebugReportObjectType) string {
+func fmtObjectType(objectType vulkan.ObjectType) string {
 	switch objectType {
-	case vulkan.DebugReportObjectTypeInstance:
+	case vulkan.ObjectTypeInstance:
 		return "Instance"
-	case vulkan.DebugReportObjectTypePhysicalDevice:
+	case vulkan.ObjectTypePhysicalDevice:
 		return "PhysicalDevice"
-	case vulkan.DebugReportObjectTypeDevice:
+	case vulkan.ObjectTypeDevice:
 		return "Device"
-	case vulkan.DebugReportObjectTypeQueue:
+	case vulkan.ObjectTypeQueue:
 		return "Queue"
-	case vulkan.DebugReportObjectTypeSemaphore:
+	case vulkan.ObjectTypeSemaphore:
 		return "Semaphore"
-	case vulkan.DebugReportObjectTypeCommandBuffer:
+	case vulkan.ObjectTypeCommandBuffer:
 		return "CommandBuffer"
-	case vulkan.DebugReportObjectTypeFence:
+	case vulkan.ObjectTypeFence:
 		return "Fence"
-	case vulkan.DebugReportObjectTypeDeviceMemory:
+	case vulkan.ObjectTypeDeviceMemory:
 		return "DeviceMemory"
-	case vulkan.DebugReportObjectTypeBuffer:
+	case vulkan.ObjectTypeBuffer:
 		return "Buffer"
-	case vulkan.DebugReportObjectTypeImage:
+	case vulkan.ObjectTypeImage:
 		return "Image"
-	case vulkan.DebugReportObjectTypeEvent:
+	case vulkan.ObjectTypeEvent:
 		return "Event"
-	case vulkan.DebugReportObjectTypeQueryPool:
+	case vulkan.ObjectTypeQueryPool:
 		return "QueryPool"
-	case vulkan.DebugReportObjectTypeBufferView:
+	case vulkan.ObjectTypeBufferView:
 		return "BufferView"
-	case vulkan.DebugReportObjectTypeImageView:
+	case vulkan.ObjectTypeImageView:
 		return "ImageView"
-	case vulkan.DebugReportObjectTypeShaderModule:
+	case vulkan.ObjectTypeShaderModule:
 		return "ShaderModule"
-	case vulkan.DebugReportObjectTypePipelineCache:
+	case vulkan.ObjectTypePipelineCache:
 		return "PipelineCache"
-	case vulkan.DebugReportObjectTypePipelineLayout:
+	case vulkan.ObjectTypePipelineLayout:
 		return "PipelineLayout"
-	case vulkan.DebugReportObjectTypeRenderPass:
+	case vulkan.ObjectTypeRenderPass:
 		return "RenderPass"
-	case vulkan.DebugReportObjectTypePipeline:
+	case vulkan.ObjectTypePipeline:
 		return "Pipeline"
-	case vulkan.DebugReportObjectTypeDescriptorSetLayout:
+	case vulkan.ObjectTypeDescriptorSetLayout:
 		return "DescriptorSetLayout"
-	case vulkan.DebugReportObjectTypeSampler:
+	case vulkan.ObjectTypeSampler:
 		return "Sampler"
-	case vulkan.DebugReportObjectTypeDescriptorPool:
+	case vulkan.ObjectTypeDescriptorPool:
 		return "DescriptorPool"
-	case vulkan.DebugReportObjectTypeDescriptorSet:
+	case vulkan.ObjectTypeDescriptorSet:
 		return "DescriptorSet"
-	case vulkan.DebugReportObjectTypeFramebuffer:
+	case vulkan.ObjectTypeFramebuffer:
 		return "Framebuffer"
-	case vulkan.DebugReportObjectTypeCommandPool:
+	case vulkan.ObjectTypeCommandPool:
 		return "CommandPool"
-	case vulkan.DebugReportObjectTypeSurfaceKhr:
-		return "SurfaceKhr"
-	case vulkan.DebugReportObjectTypeSwapchainKhr:
-		return "SwapchainKhr"
-	case vulkan.DebugReportObjectTypeDebugReportCallbackExt:
-		return "DebugReport/DebugReportCallbackExt"
-	case vulkan.DebugReportObjectTypeDisplayKhr:
-		return "DisplayKhr"
-	case vulkan.DebugReportObjectTypeDisplayModeKhr:
-		return "DisplayModeKhr"
-	case vulkan.DebugReportObjectTypeObjectTableNvx:
-		return "ObjectTableNvx"
-	case vulkan.DebugReportObjectTypeIndirectCommandsLayoutNvx:
-		return "IndirectCommandsLayoutNvx"
-	case vulkan.DebugReportObjectTypeValidationCacheExt:
-		return "ValidationCache/ValidationCacheExt"
-	case vulkan.DebugReportObjectTypeSamplerYcbcrConversion:
-		return "SamplerYcbcrConversion/SamplerYcbcrConversionKhr"
-	case vulkan.DebugReportObjectTypeDescriptorUpdateTemplate:
-		return "DescriptorUpdateTemplate/DescriptorUpdateTemplateKhr"
-	case vulkan.DebugReportObjectTypeAccelerationStructureNvx:
-		return "AccelerationStructureNvx"
+	case vulkan.ObjectTypeSamplerYcbcrConversion:
+		return "SamplerYcbcrConversion"
+	case vulkan.ObjectTypeDescriptorUpdateTemplate:
+		return "DescriptorUpdateTemplate"
+	case vulkan.ObjectTypeSurface:
+		return "Surface"
+	case vulkan.ObjectTypeSwapchain:
+		return "Swapchain"
+	case vulkan.ObjectTypeDisplay:
+		return "Display"
+	case vulkan.ObjectTypeDisplayMode:
+		return "DisplayMode"
+	case vulkan.ObjectTypeDebugReportCallback:
+		return "DebugReportCallback"
+	case vulkan.ObjectTypeDebugUtilsMessenger:
+		return "DebugUtilsMessenger"
+	case vulkan.ObjectTypeValidationCache:
+		return "ValidationCache"
 	default:
 		return "Unknown"
 	}
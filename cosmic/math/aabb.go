@@ -0,0 +1,75 @@
+package math
+
+import stdmath "math"
+
+// AABB is an axis aligned bounding box. The zero value is a box containing
+// only the origin, use EmptyAABB to grow a box from points.
+type AABB struct {
+	Min, Max Vec3
+}
+
+// EmptyAABB returns a box that contains nothing, so extending it by a point
+// yields a box containing only that point.
+func EmptyAABB() AABB {
+	inf := float32(stdmath.Inf(1))
+	return AABB{Min: Vec3{inf, inf, inf}, Max: Vec3{-inf, -inf, -inf}}
+}
+
+func (b AABB) IsEmpty() bool {
+	return b.Min.X > b.Max.X || b.Min.Y > b.Max.Y || b.Min.Z > b.Max.Z
+}
+
+func (b AABB) Center() Vec3 {
+	return b.Min.Add(b.Max).Scale(0.5)
+}
+
+// Extents returns half of the size of the box.
+func (b AABB) Extents() Vec3 {
+	return b.Max.Sub(b.Min).Scale(0.5)
+}
+
+func (b AABB) Size() Vec3 {
+	return b.Max.Sub(b.Min)
+}
+
+// Extend returns the smallest box containing b and the point.
+func (b AABB) Extend(point Vec3) AABB {
+	return AABB{Min: b.Min.Min(point), Max: b.Max.Max(point)}
+}
+
+// Union returns the smallest box containing b and c.
+func (b AABB) Union(c AABB) AABB {
+	return AABB{Min: b.Min.Min(c.Min), Max: b.Max.Max(c.Max)}
+}
+
+// Contains reports whether the point is inside the box or on its boundary.
+func (b AABB) Contains(point Vec3) bool {
+	return point.X >= b.Min.X && point.X <= b.Max.X &&
+		point.Y >= b.Min.Y && point.Y <= b.Max.Y &&
+		point.Z >= b.Min.Z && point.Z <= b.Max.Z
+}
+
+// Intersects reports whether the boxes overlap or touch.
+func (b AABB) Intersects(c AABB) bool {
+	return b.Min.X <= c.Max.X && b.Max.X >= c.Min.X &&
+		b.Min.Y <= c.Max.Y && b.Max.Y >= c.Min.Y &&
+		b.Min.Z <= c.Max.Z && b.Max.Z >= c.Min.Z
+}
+
+// Transform returns the smallest axis aligned box containing b transformed
+// by the affine transform m.
+func (b AABB) Transform(m Mat4) AABB {
+	center := m.MulPoint(b.Center())
+	extents := b.Extents()
+
+	// Every axis of the box contributes the absolute projection of its
+	// transformed extent
+	r := m.Mat3()
+	transformed := Vec3{
+		abs(r[0])*extents.X + abs(r[3])*extents.Y + abs(r[6])*extents.Z,
+		abs(r[1])*extents.X + abs(r[4])*extents.Y + abs(r[7])*extents.Z,
+		abs(r[2])*extents.X + abs(r[5])*extents.Y + abs(r[8])*extents.Z,
+	}
+
+	return AABB{Min: center.Sub(transformed), Max: center.Add(transformed)}
+}
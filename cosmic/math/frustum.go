@@ -0,0 +1,60 @@
+package math
+
+// Frustum is the volume a camera sees, bounded by planes facing inwards.
+type Frustum struct {
+	// Left, right, bottom, top, near and far
+	Planes [6]Plane
+}
+
+// FrustumFromMatrix extracts the frustum of a view projection matrix in
+// Vulkan clip space, where visible points have -w <= x, y <= w and
+// 0 <= z <= w. Reversed depth projections yield the same planes, with near
+// and far swapped.
+func FrustumFromMatrix(m Mat4) Frustum {
+	x, y, z, w := m.Row(0), m.Row(1), m.Row(2), m.Row(3)
+
+	var f Frustum
+	for i, row := range [6]Vec4{w.Add(x), w.Sub(x), w.Add(y), w.Sub(y), z, w.Sub(z)} {
+		f.Planes[i] = Plane{Normal: row.XYZ(), D: row.W}.Normalize()
+	}
+
+	return f
+}
+
+// Contains reports whether the point is inside the frustum or on its
+// boundary.
+func (f Frustum) Contains(point Vec3) bool {
+	for _, p := range f.Planes {
+		if p.Distance(point) < 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// IntersectsAABB reports whether the box may be visible. It is exact for
+// boxes outside of a single plane, but may report boxes near the corners of
+// the frustum as intersecting, which is the usual trade-off for culling.
+func (f Frustum) IntersectsAABB(b AABB) bool {
+	for _, p := range f.Planes {
+		// The corner furthest along the normal is the last to leave the
+		// plane
+		corner := Vec3{b.Min.X, b.Min.Y, b.Min.Z}
+		if p.Normal.X >= 0 {
+			corner.X = b.Max.X
+		}
+		if p.Normal.Y >= 0 {
+			corner.Y = b.Max.Y
+		}
+		if p.Normal.Z >= 0 {
+			corner.Z = b.Max.Z
+		}
+
+		if p.Distance(corner) < 0 {
+			return false
+		}
+	}
+
+	return true
+}
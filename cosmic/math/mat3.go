@@ -0,0 +1,92 @@
+package math
+
+// Mat3 is a 3x3 matrix stored in column-major order like Mat4, so element
+// (row, column) is at index column*3+row. It holds rotations and scales, and
+// the normal matrices of transforms.
+type Mat3 [9]float32
+
+func Identity3() Mat3 {
+	return Mat3{
+		1, 0, 0,
+		0, 1, 0,
+		0, 0, 1,
+	}
+}
+
+// At returns the element at the given row and column.
+func (m Mat3) At(row, column int) float32 {
+	return m[column*3+row]
+}
+
+func (m Mat3) Mul(n Mat3) Mat3 {
+	var result Mat3
+	for column := 0; column < 3; column++ {
+		for row := 0; row < 3; row++ {
+			var sum float32
+			for i := 0; i < 3; i++ {
+				sum += m[i*3+row] * n[column*3+i]
+			}
+			result[column*3+row] = sum
+		}
+	}
+
+	return result
+}
+
+func (m Mat3) MulVec3(v Vec3) Vec3 {
+	return Vec3{
+		m[0]*v.X + m[3]*v.Y + m[6]*v.Z,
+		m[1]*v.X + m[4]*v.Y + m[7]*v.Z,
+		m[2]*v.X + m[5]*v.Y + m[8]*v.Z,
+	}
+}
+
+func (m Mat3) Transpose() Mat3 {
+	return Mat3{
+		m[0], m[3], m[6],
+		m[1], m[4], m[7],
+		m[2], m[5], m[8],
+	}
+}
+
+func (m Mat3) Determinant() float32 {
+	return m[0]*(m[4]*m[8]-m[7]*m[5]) -
+		m[3]*(m[1]*m[8]-m[7]*m[2]) +
+		m[6]*(m[1]*m[5]-m[4]*m[2])
+}
+
+// Inverse returns the inverse of m, and false when m is singular.
+func (m Mat3) Inverse() (Mat3, bool) {
+	det := m.Determinant()
+	if det == 0 {
+		return Mat3{}, false
+	}
+	inv := 1 / det
+
+	return Mat3{
+		(m[4]*m[8] - m[7]*m[5]) * inv,
+		(m[7]*m[2] - m[1]*m[8]) * inv,
+		(m[1]*m[5] - m[4]*m[2]) * inv,
+		(m[6]*m[5] - m[3]*m[8]) * inv,
+		(m[0]*m[8] - m[6]*m[2]) * inv,
+		(m[3]*m[2] - m[0]*m[5]) * inv,
+		(m[3]*m[7] - m[6]*m[4]) * inv,
+		(m[6]*m[1] - m[0]*m[7]) * inv,
+		(m[0]*m[4] - m[3]*m[1]) * inv,
+	}, true
+}
+
+// Column returns the column with the given index.
+func (m Mat3) Column(column int) Vec3 {
+	return Vec3{m[column*3], m[column*3+1], m[column*3+2]}
+}
+
+// Mat4 returns m as the upper left part of an affine transform.
+func (m Mat3) Mat4() Mat4 {
+	return Mat4{
+		m[0], m[1], m[2], 0,
+		m[3], m[4], m[5], 0,
+		m[6], m[7], m[8], 0,
+		0, 0, 0, 1,
+	}
+}
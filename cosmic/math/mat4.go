@@ -0,0 +1,300 @@
+package math
+
+import stdmath "math"
+
+// Mat4 is a 4x4 matrix stored in column-major order, the layout shaders
+// expect, so element (row, column) is at index column*4+row. Matrices
+// transform column vectors, so in a.Mul(b) the transform b is applied first.
+type Mat4 [16]float32
+
+func Identity4() Mat4 {
+	return Mat4{
+		1, 0, 0, 0,
+		0, 1, 0, 0,
+		0, 0, 1, 0,
+		0, 0, 0, 1,
+	}
+}
+
+// At returns the element at the given row and column.
+func (m Mat4) At(row, column int) float32 {
+	return m[column*4+row]
+}
+
+func (m Mat4) Mul(n Mat4) Mat4 {
+	var result Mat4
+	for column := 0; column < 4; column++ {
+		for row := 0; row < 4; row++ {
+			var sum float32
+			for i := 0; i < 4; i++ {
+				sum += m[i*4+row] * n[column*4+i]
+			}
+			result[column*4+row] = sum
+		}
+	}
+
+	return result
+}
+
+func (m Mat4) MulVec4(v Vec4) Vec4 {
+	return Vec4{
+		m[0]*v.X + m[4]*v.Y + m[8]*v.Z + m[12]*v.W,
+		m[1]*v.X + m[5]*v.Y + m[9]*v.Z + m[13]*v.W,
+		m[2]*v.X + m[6]*v.Y + m[10]*v.Z + m[14]*v.W,
+		m[3]*v.X + m[7]*v.Y + m[11]*v.Z + m[15]*v.W,
+	}
+}
+
+// MulPoint transforms a point, ignoring the projective part of m.
+func (m Mat4) MulPoint(v Vec3) Vec3 {
+	return m.MulVec4(v.Vec4(1)).XYZ()
+}
+
+// MulDirection transforms a direction, which is not affected by translation.
+func (m Mat4) MulDirection(v Vec3) Vec3 {
+	return m.MulVec4(v.Vec4(0)).XYZ()
+}
+
+// Project transforms a point and divides it by the resulting w, which maps
+// points to normalized device coordinates with a view projection matrix.
+func (m Mat4) Project(v Vec3) Vec3 {
+	clip := m.MulVec4(v.Vec4(1))
+	return clip.XYZ().Scale(1 / clip.W)
+}
+
+// Row returns the row with the given index.
+func (m Mat4) Row(row int) Vec4 {
+	return Vec4{m[row], m[4+row], m[8+row], m[12+row]}
+}
+
+// Column returns the column with the given index.
+func (m Mat4) Column(column int) Vec4 {
+	return Vec4{m[column*4], m[column*4+1], m[column*4+2], m[column*4+3]}
+}
+
+func (m Mat4) Transpose() Mat4 {
+	return Mat4{
+		m[0], m[4], m[8], m[12],
+		m[1], m[5], m[9], m[13],
+		m[2], m[6], m[10], m[14],
+		m[3], m[7], m[11], m[15],
+	}
+}
+
+// Mat3 returns the upper left part of m, which holds the rotation and scale
+// of affine transforms.
+func (m Mat4) Mat3() Mat3 {
+	return Mat3{
+		m[0], m[1], m[2],
+		m[4], m[5], m[6],
+		m[8], m[9], m[10],
+	}
+}
+
+// NormalMatrix returns the matrix that transforms normals consistently with
+// the affine transform m, also when it scales non-uniformly.
+func (m Mat4) NormalMatrix() Mat3 {
+	inverse, _ := m.Mat3().Inverse()
+	return inverse.Transpose()
+}
+
+func (m Mat4) Determinant() float32 {
+	_, det := m.adjugate()
+	return det
+}
+
+// Inverse returns the inverse of m, and false when m is singular.
+func (m Mat4) Inverse() (Mat4, bool) {
+	adjugate, det := m.adjugate()
+	if det == 0 {
+		return Mat4{}, false
+	}
+
+	inv := 1 / det
+	for i := range adjugate {
+		adjugate[i] *= inv
+	}
+
+	return adjugate, true
+}
+
+// adjugate returns the transposed matrix of cofactors of m and its
+// determinant.
+func (m Mat4) adjugate() (Mat4, float32) {
+	var a Mat4
+	a[0] = m[5]*m[10]*m[15] - m[5]*m[11]*m[14] - m[9]*m[6]*m[15] + m[9]*m[7]*m[14] + m[13]*m[6]*m[11] - m[13]*m[7]*m[10]
+	a[4] = -m[4]*m[10]*m[15] + m[4]*m[11]*m[14] + m[8]*m[6]*m[15] - m[8]*m[7]*m[14] - m[12]*m[6]*m[11] + m[12]*m[7]*m[10]
+	a[8] = m[4]*m[9]*m[15] - m[4]*m[11]*m[13] - m[8]*m[5]*m[15] + m[8]*m[7]*m[13] + m[12]*m[5]*m[11] - m[12]*m[7]*m[9]
+	a[12] = -m[4]*m[9]*m[14] + m[4]*m[10]*m[13] + m[8]*m[5]*m[14] - m[8]*m[6]*m[13] - m[12]*m[5]*m[10] + m[12]*m[6]*m[9]
+	a[1] = -m[1]*m[10]*m[15] + m[1]*m[11]*m[14] + m[9]*m[2]*m[15] - m[9]*m[3]*m[14] - m[13]*m[2]*m[11] + m[13]*m[3]*m[10]
+	a[5] = m[0]*m[10]*m[15] - m[0]*m[11]*m[14] - m[8]*m[2]*m[15] + m[8]*m[3]*m[14] + m[12]*m[2]*m[11] - m[12]*m[3]*m[10]
+	a[9] = -m[0]*m[9]*m[15] + m[0]*m[11]*m[13] + m[8]*m[1]*m[15] - m[8]*m[3]*m[13] - m[12]*m[1]*m[11] + m[12]*m[3]*m[9]
+	a[13] = m[0]*m[9]*m[14] - m[0]*m[10]*m[13] - m[8]*m[1]*m[14] + m[8]*m[2]*m[13] + m[12]*m[1]*m[10] - m[12]*m[2]*m[9]
+	a[2] = m[1]*m[6]*m[15] - m[1]*m[7]*m[14] - m[5]*m[2]*m[15] + m[5]*m[3]*m[14] + m[13]*m[2]*m[7] - m[13]*m[3]*m[6]
+	a[6] = -m[0]*m[6]*m[15] + m[0]*m[7]*m[14] + m[4]*m[2]*m[15] - m[4]*m[3]*m[14] - m[12]*m[2]*m[7] + m[12]*m[3]*m[6]
+	a[10] = m[0]*m[5]*m[15] - m[0]*m[7]*m[13] - m[4]*m[1]*m[15] + m[4]*m[3]*m[13] + m[12]*m[1]*m[7] - m[12]*m[3]*m[5]
+	a[14] = -m[0]*m[5]*m[14] + m[0]*m[6]*m[13] + m[4]*m[1]*m[14] - m[4]*m[2]*m[13] - m[12]*m[1]*m[6] + m[12]*m[2]*m[5]
+	a[3] = -m[1]*m[6]*m[11] + m[1]*m[7]*m[10] + m[5]*m[2]*m[11] - m[5]*m[3]*m[10] - m[9]*m[2]*m[7] + m[9]*m[3]*m[6]
+	a[7] = m[0]*m[6]*m[11] - m[0]*m[7]*m[10] - m[4]*m[2]*m[11] + m[4]*m[3]*m[10] + m[8]*m[2]*m[7] - m[8]*m[3]*m[6]
+	a[11] = -m[0]*m[5]*m[11] + m[0]*m[7]*m[9] + m[4]*m[1]*m[11] - m[4]*m[3]*m[9] - m[8]*m[1]*m[7] + m[8]*m[3]*m[5]
+	a[15] = m[0]*m[5]*m[10] - m[0]*m[6]*m[9] - m[4]*m[1]*m[10] + m[4]*m[2]*m[9] + m[8]*m[1]*m[6] - m[8]*m[2]*m[5]
+
+	return a, m[0]*a[0] + m[1]*a[4] + m[2]*a[8] + m[3]*a[12]
+}
+
+func Translation(v Vec3) Mat4 {
+	m := Identity4()
+	m[12], m[13], m[14] = v.X, v.Y, v.Z
+
+	return m
+}
+
+func Translation2D(v Vec2) Mat4 {
+	m := Identity4()
+	m[12], m[13] = v.X, v.Y
+
+	return m
+}
+
+func Scaling(v Vec3) Mat4 {
+	m := Identity4()
+	m[0], m[5], m[10] = v.X, v.Y, v.Z
+
+	return m
+}
+
+// TRS returns the transform that scales, then rotates and then translates.
+func TRS(translation Vec3, rotation Quat, scale Vec3) Mat4 {
+	r := rotation.Mat3()
+
+	return Mat4{
+		r[0] * scale.X, r[1] * scale.X, r[2] * scale.X, 0,
+		r[3] * scale.Y, r[4] * scale.Y, r[5] * scale.Y, 0,
+		r[6] * scale.Z, r[7] * scale.Z, r[8] * scale.Z, 0,
+		translation.X, translation.Y, translation.Z, 1,
+	}
+}
+
+// Decompose splits an affine transform without shear into the arguments of
+// TRS. Mirroring transforms are returned with a negative x scale.
+func (m Mat4) Decompose() (translation Vec3, rotation Quat, scale Vec3) {
+	translation = Vec3{m[12], m[13], m[14]}
+
+	r := m.Mat3()
+	scale = Vec3{r.Column(0).Len(), r.Column(1).Len(), r.Column(2).Len()}
+	if r.Determinant() < 0 {
+		scale.X = -scale.X
+	}
+
+	for column, s := range [3]float32{scale.X, scale.Y, scale.Z} {
+		if s == 0 {
+			return translation, IdentityQuat(), scale
+		}
+		for row := 0; row < 3; row++ {
+			r[column*3+row] /= s
+		}
+	}
+
+	return translation, QuatFromMat3(r), scale
+}
+
+// RotationX rotates counter-clockwise around the x axis by the given angle in
+// radians.
+func RotationX(angle float32) Mat4 {
+	sin, cos := stdmath.Sincos(float64(angle))
+	s, c := float32(sin), float32(cos)
+
+	m := Identity4()
+	m[5], m[6] = c, s
+	m[9], m[10] = -s, c
+
+	return m
+}
+
+// RotationY rotates counter-clockwise around the y axis by the given angle in
+// radians.
+func RotationY(angle float32) Mat4 {
+	sin, cos := stdmath.Sincos(float64(angle))
+	s, c := float32(sin), float32(cos)
+
+	m := Identity4()
+	m[0], m[2] = c, -s
+	m[8], m[10] = s, c
+
+	return m
+}
+
+// RotationZ rotates counter-clockwise around the z axis by the given angle in
+// radians.
+func RotationZ(angle float32) Mat4 {
+	sin, cos := stdmath.Sincos(float64(angle))
+	s, c := float32(sin), float32(cos)
+
+	m := Identity4()
+	m[0], m[1] = c, s
+	m[4], m[5] = -s, c
+
+	return m
+}
+
+// Orthographic returns a projection of the box between the given planes to
+// Vulkan clip space: y points down in clip space, so top maps to -1 and the
+// image is not upside down, and depth ranges from 0 at the near plane to 1 at
+// the far plane. Like OpenGL, the view looks along -z, so near and far are
+// distances in front of the viewer.
+func Orthographic(left, right, bottom, top, near, far float32) Mat4 {
+	var m Mat4
+	m[0] = 2 / (right - left)
+	m[5] = -2 / (top - bottom)
+	m[10] = -1 / (far - near)
+	m[12] = -(right + left) / (right - left)
+	m[13] = (top + bottom) / (top - bottom)
+	m[14] = -near / (far - near)
+	m[15] = 1
+
+	return m
+}
+
+// Perspective returns a projection of the frustum with the given vertical
+// field of view in radians to Vulkan clip space, with the same conventions
+// as Orthographic.
+func Perspective(fieldOfView, aspect, near, far float32) Mat4 {
+	f := float32(1 / stdmath.Tan(float64(fieldOfView)/2))
+
+	var m Mat4
+	m[0] = f / aspect
+	m[5] = -f
+	m[10] = far / (near - far)
+	m[11] = -1
+	m[14] = near * far / (near - far)
+
+	return m
+}
+
+// ReverseDepth maps depth d to 1-d. Applied after a projection, it moves the
+// near plane to depth 1 and the far plane to depth 0, which spreads the
+// precision of floating point depth buffers more evenly over the distance.
+// Depth tests then have to use CompareGreater and clear the depth to 0.
+func ReverseDepth() Mat4 {
+	m := Identity4()
+	m[10] = -1
+	m[14] = 1
+
+	return m
+}
+
+// LookAt returns the view matrix of a viewer at eye looking at target, with
+// the up vector pointing up on screen. Like the projections, the view looks
+// along -z.
+func LookAt(eye, target, up Vec3) Mat4 {
+	f := target.Sub(eye).Normalize()
+	s := f.Cross(up).Normalize()
+	u := s.Cross(f)
+
+	return Mat4{
+		s.X, u.X, -f.X, 0,
+		s.Y, u.Y, -f.Y, 0,
+		s.Z, u.Z, -f.Z, 0,
+		-s.Dot(eye), -u.Dot(eye), f.Dot(eye), 1,
+	}
+}
@@ -0,0 +1,65 @@
+package math
+
+import "testing"
+
+func TestOrthographic(t *testing.T) {
+	m := Orthographic(-2, 2, -1, 1, -1, 1)
+
+	for _, test := range []struct {
+		point, expected Vec4
+	}{
+		{Vec4{-2, 1, 1, 1}, Vec4{-1, -1, 0, 1}},
+		{Vec4{2, -1, -1, 1}, Vec4{1, 1, 1, 1}},
+		{Vec4{0, 0, 0, 1}, Vec4{0, 0, 0.5, 1}},
+	} {
+		if got := m.MulVec4(test.point); got != test.expected {
+			t.Errorf("expected %v to project to %v, got %v", test.point, test.expected, got)
+		}
+	}
+}
+
+func TestMat4_Mul(t *testing.T) {
+	// Rotate a quarter turn, then translate
+	m := Translation2D(Vec2{1, 2}).Mul(RotationZ(1.5707964))
+	got := m.MulVec4(Vec4{1, 0, 0, 1})
+
+	if d := got.X - 1; d > 1e-6 || d < -1e-6 {
+		t.Errorf("expected x 1, got %f", got.X)
+	}
+	if d := got.Y - 3; d > 1e-6 || d < -1e-6 {
+		t.Errorf("expected y 3, got %f", got.Y)
+	}
+
+	if Identity4().Mul(m) != m {
+		t.Error("expected multiplying by the identity to return the matrix")
+	}
+}
+
+func TestPerspective(t *testing.T) {
+	m := Perspective(1.5707964, 2, 1, 10)
+
+	for _, test := range []struct {
+		point       Vec4
+		x, y, depth float32
+	}{
+		{Vec4{0, 0, -1, 1}, 0, 0, 0},
+		{Vec4{0, 0, -10, 1}, 0, 0, 1},
+		// The edges of the field of view
+		{Vec4{4, 2, -2, 1}, 1, -1, 0.5555556},
+	} {
+		clip := m.MulVec4(test.point)
+		x, y, depth := clip.X/clip.W, clip.Y/clip.W, clip.Z/clip.W
+		if !near(x, test.x) || !near(y, test.y) || !near(depth, test.depth) {
+			t.Errorf("expected %v to project to (%f, %f, %f), got (%f, %f, %f)", test.point, test.x, test.y, test.depth, x, y, depth)
+		}
+
+		reversed := ReverseDepth().Mul(m).MulVec4(test.point)
+		if depth := reversed.Z / reversed.W; !near(depth, 1-test.depth) {
+			t.Errorf("expected %v to have reversed depth %f, got %f", test.point, 1-test.depth, depth)
+		}
+	}
+}
+
+func near(a, b float32) bool {
+	return a-b < 1e-5 && b-a < 1e-5
+}
@@ -0,0 +1,42 @@
+package math
+
+// Plane is the set of points p where Normal.Dot(p) + D is 0. Points on the
+// side the normal points to are in front of the plane.
+type Plane struct {
+	Normal Vec3
+	D      float32
+}
+
+// PlaneFromPoint returns the plane through the point with the given normal.
+func PlaneFromPoint(point, normal Vec3) Plane {
+	normal = normal.Normalize()
+	return Plane{Normal: normal, D: -normal.Dot(point)}
+}
+
+// PlaneFromPoints returns the plane through three points, which faces the
+// side from which they are in counter-clockwise order.
+func PlaneFromPoints(a, b, c Vec3) Plane {
+	return PlaneFromPoint(a, b.Sub(a).Cross(c.Sub(a)))
+}
+
+// Normalize scales the plane equation so the normal has unit length, which
+// makes Distance return distances in world units.
+func (p Plane) Normalize() Plane {
+	l := p.Normal.Len()
+	if l == 0 {
+		return p
+	}
+
+	return Plane{Normal: p.Normal.Scale(1 / l), D: p.D / l}
+}
+
+// Distance returns the signed distance of the point to a normalized plane,
+// which is positive in front of the plane.
+func (p Plane) Distance(point Vec3) float32 {
+	return p.Normal.Dot(point) + p.D
+}
+
+// Project returns the point on a normalized plane closest to the given point.
+func (p Plane) Project(point Vec3) Vec3 {
+	return point.Sub(p.Normal.Scale(p.Distance(point)))
+}
@@ -0,0 +1,386 @@
+package math
+
+import (
+	stdmath "math"
+	"math/rand"
+	"reflect"
+	"testing"
+	"testing/quick"
+)
+
+// The generators keep values in ranges where float32 rounding errors stay
+// small, so properties can be checked with a fixed tolerance.
+
+type point Vec3
+
+func (point) Generate(r *rand.Rand, size int) reflect.Value {
+	return reflect.ValueOf(point{randFloat(r, -10, 10), randFloat(r, -10, 10), randFloat(r, -10, 10)})
+}
+
+type rotation Quat
+
+func (rotation) Generate(r *rand.Rand, size int) reflect.Value {
+	axis := Vec3{randFloat(r, -1, 1), randFloat(r, -1, 1), randFloat(r, -1, 1)}
+	if axis.Len() < 0.01 {
+		axis = Vec3{Y: 1}
+	}
+
+	return reflect.ValueOf(rotation(QuatAxisAngle(axis, randFloat(r, -stdmath.Pi, stdmath.Pi))))
+}
+
+// transform is the arguments of TRS, with a positive scale.
+type transform struct {
+	translation Vec3
+	rotation    Quat
+	scale       Vec3
+}
+
+func (transform) Generate(r *rand.Rand, size int) reflect.Value {
+	return reflect.ValueOf(transform{
+		translation: Vec3(point{}.Generate(r, size).Interface().(point)),
+		rotation:    Quat(rotation{}.Generate(r, size).Interface().(rotation)),
+		scale:       Vec3{randFloat(r, 0.25, 4), randFloat(r, 0.25, 4), randFloat(r, 0.25, 4)},
+	})
+}
+
+func (t transform) Mat4() Mat4 {
+	return TRS(t.translation, t.rotation, t.scale)
+}
+
+type fraction float32
+
+func (fraction) Generate(r *rand.Rand, size int) reflect.Value {
+	return reflect.ValueOf(fraction(r.Float32()))
+}
+
+func randFloat(r *rand.Rand, min, max float32) float32 {
+	return min + r.Float32()*(max-min)
+}
+
+func check(t *testing.T, property interface{}) {
+	t.Helper()
+	if err := quick.Check(property, &quick.Config{MaxCount: 500}); err != nil {
+		t.Error(err)
+	}
+}
+
+const tolerance = 1e-3
+
+func approx(a, b float32) bool {
+	return abs(a-b) <= tolerance*max(1, max(abs(a), abs(b)))
+}
+
+func approxVec3(a, b Vec3) bool {
+	return approx(a.X, b.X) && approx(a.Y, b.Y) && approx(a.Z, b.Z)
+}
+
+func approxMat4(a, b Mat4) bool {
+	for i := range a {
+		if !approx(a[i], b[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// sameRotation compares quaternions, which represent the same rotation when
+// negated.
+func sameRotation(a, b Quat) bool {
+	return approx(abs(a.Dot(b)), 1)
+}
+
+func TestVec3_properties(t *testing.T) {
+	t.Run("cross product is perpendicular", func(t *testing.T) {
+		check(t, func(a, b point) bool {
+			c := Vec3(a).Cross(Vec3(b))
+			scale := Vec3(a).Len() * Vec3(b).Len()
+			return approx(c.Dot(Vec3(a))/max(scale, 1), 0) && approx(c.Dot(Vec3(b))/max(scale, 1), 0)
+		})
+	})
+	t.Run("normalized vectors have unit length", func(t *testing.T) {
+		check(t, func(a point) bool {
+			return Vec3(a).Len() < 1e-3 || approx(Vec3(a).Normalize().Len(), 1)
+		})
+	})
+	t.Run("lerp hits both ends", func(t *testing.T) {
+		check(t, func(a, b point) bool {
+			return approxVec3(Vec3(a).Lerp(Vec3(b), 0), Vec3(a)) && approxVec3(Vec3(a).Lerp(Vec3(b), 1), Vec3(b))
+		})
+	})
+}
+
+func TestMat4_properties(t *testing.T) {
+	t.Run("inverse undoes the transform", func(t *testing.T) {
+		check(t, func(tr transform) bool {
+			m := tr.Mat4()
+			inverse, ok := m.Inverse()
+			return ok && approxMat4(m.Mul(inverse), Identity4()) && approxMat4(inverse.Mul(m), Identity4())
+		})
+	})
+	t.Run("determinant is multiplicative", func(t *testing.T) {
+		check(t, func(a, b transform) bool {
+			m, n := a.Mat4(), b.Mat4()
+			return approx(m.Mul(n).Determinant(), m.Determinant()*n.Determinant())
+		})
+	})
+	t.Run("transpose of a product", func(t *testing.T) {
+		check(t, func(a, b transform) bool {
+			m, n := a.Mat4(), b.Mat4()
+			return approxMat4(m.Mul(n).Transpose(), n.Transpose().Mul(m.Transpose()))
+		})
+	})
+	t.Run("decompose reverses TRS", func(t *testing.T) {
+		check(t, func(tr transform) bool {
+			translation, rotation, scale := tr.Mat4().Decompose()
+			return approxVec3(translation, tr.translation) && sameRotation(rotation, tr.rotation) && approxVec3(scale, tr.scale)
+		})
+	})
+	t.Run("TRS scales, rotates and translates", func(t *testing.T) {
+		check(t, func(tr transform, p point) bool {
+			expected := tr.rotation.Rotate(Vec3(p).Mul(tr.scale)).Add(tr.translation)
+			composed := Translation(tr.translation).Mul(tr.rotation.Mat4()).Mul(Scaling(tr.scale))
+			return approxVec3(tr.Mat4().MulPoint(Vec3(p)), expected) && approxMat4(composed, tr.Mat4())
+		})
+	})
+	t.Run("normal matrix keeps normals perpendicular", func(t *testing.T) {
+		check(t, func(tr transform, a, b point) bool {
+			tangent := Vec3(a)
+			normal := Vec3(b).Sub(tangent.Scale(Vec3(b).Dot(tangent) / max(tangent.Dot(tangent), 1e-6)))
+			transformed := tr.Mat4().NormalMatrix().MulVec3(normal)
+			return approx(transformed.Dot(tr.Mat4().MulDirection(tangent))/max(transformed.Len()*tangent.Len(), 1), 0)
+		})
+	})
+	t.Run("look at moves the target in front of the eye", func(t *testing.T) {
+		check(t, func(eye, target point) bool {
+			distance := Vec3(target).Distance(Vec3(eye))
+			forward := Vec3(target).Sub(Vec3(eye)).Normalize()
+			if distance < 0.1 || abs(forward.Y) > 0.99 {
+				return true
+			}
+
+			view := LookAt(Vec3(eye), Vec3(target), Vec3{Y: 1})
+			return approxVec3(view.MulPoint(Vec3(eye)), Vec3{}) &&
+				approxVec3(view.MulPoint(Vec3(target)), Vec3{Z: -distance})
+		})
+	})
+}
+
+func TestMat3_properties(t *testing.T) {
+	check(t, func(tr transform) bool {
+		m := tr.Mat4().Mat3()
+		inverse, ok := m.Inverse()
+		product := m.Mul(inverse)
+		for i := range product {
+			if !approx(product[i], Identity3()[i]) {
+				return false
+			}
+		}
+
+		return ok && approx(m.Determinant(), tr.Mat4().Determinant())
+	})
+}
+
+func TestQuat_properties(t *testing.T) {
+	t.Run("rotation preserves length", func(t *testing.T) {
+		check(t, func(q rotation, p point) bool {
+			return approx(Quat(q).Rotate(Vec3(p)).Len(), Vec3(p).Len())
+		})
+	})
+	t.Run("matrix rotates like the quaternion", func(t *testing.T) {
+		check(t, func(q rotation, p point) bool {
+			return approxVec3(Quat(q).Mat4().MulPoint(Vec3(p)), Quat(q).Rotate(Vec3(p)))
+		})
+	})
+	t.Run("matrix converts back", func(t *testing.T) {
+		check(t, func(q rotation) bool {
+			return sameRotation(QuatFromMat3(Quat(q).Mat3()), Quat(q))
+		})
+	})
+	t.Run("axis angle converts back", func(t *testing.T) {
+		check(t, func(q rotation) bool {
+			axis, angle := Quat(q).AxisAngle()
+			return sameRotation(QuatAxisAngle(axis, angle), Quat(q))
+		})
+	})
+	t.Run("slerp hits both ends at unit length", func(t *testing.T) {
+		check(t, func(a, b rotation, f fraction) bool {
+			q, r := Quat(a), Quat(b)
+			return sameRotation(q.Slerp(r, 0), q) && sameRotation(q.Slerp(r, 1), r) && approx(q.Slerp(r, float32(f)).Len(), 1)
+		})
+	})
+	t.Run("slerp moves at a constant angular velocity", func(t *testing.T) {
+		check(t, func(a, b rotation, f fraction) bool {
+			q, r := Quat(a), Quat(b)
+			total := angleBetween(q, r)
+			return abs(angleBetween(q, q.Slerp(r, float32(f)))-total*float32(f)) < 1e-2
+		})
+	})
+	t.Run("look rotation looks along -z", func(t *testing.T) {
+		check(t, func(p point) bool {
+			forward := Vec3(p).Normalize()
+			if Vec3(p).Len() < 0.1 || abs(forward.Y) > 0.99 {
+				return true
+			}
+
+			q := QuatLookRotation(forward, Vec3{Y: 1})
+			return approxVec3(q.Rotate(Vec3{Z: -1}), forward) && q.Rotate(Vec3{Y: 1}).Y > 0
+		})
+	})
+}
+
+func angleBetween(q, r Quat) float32 {
+	_, angle := r.Mul(q.Conjugate()).AxisAngle()
+	return angle
+}
+
+func TestAABB_properties(t *testing.T) {
+	t.Run("transformed boxes contain the transformed corners", func(t *testing.T) {
+		check(t, func(a, b point, tr transform) bool {
+			box := EmptyAABB().Extend(Vec3(a)).Extend(Vec3(b))
+			transformed := box.Transform(tr.Mat4())
+			grown := AABB{Min: transformed.Min.Sub(Vec3{1e-2, 1e-2, 1e-2}), Max: transformed.Max.Add(Vec3{1e-2, 1e-2, 1e-2})}
+			for _, corner := range box.corners() {
+				if !grown.Contains(tr.Mat4().MulPoint(corner)) {
+					return false
+				}
+			}
+
+			return true
+		})
+	})
+	t.Run("union contains both boxes", func(t *testing.T) {
+		check(t, func(a, b, c, d point) bool {
+			first := EmptyAABB().Extend(Vec3(a)).Extend(Vec3(b))
+			second := EmptyAABB().Extend(Vec3(c)).Extend(Vec3(d))
+			union := first.Union(second)
+			return union.Contains(first.Min) && union.Contains(first.Max) &&
+				union.Contains(second.Min) && union.Contains(second.Max) &&
+				union.Intersects(first) && union.Intersects(second)
+		})
+	})
+}
+
+func (b AABB) corners() [8]Vec3 {
+	var corners [8]Vec3
+	for i := range corners {
+		corners[i] = b.Min
+		if i&1 != 0 {
+			corners[i].X = b.Max.X
+		}
+		if i&2 != 0 {
+			corners[i].Y = b.Max.Y
+		}
+		if i&4 != 0 {
+			corners[i].Z = b.Max.Z
+		}
+	}
+
+	return corners
+}
+
+func TestRay_properties(t *testing.T) {
+	t.Run("hits are on the boundary of the box", func(t *testing.T) {
+		check(t, func(origin, target, a, b point) bool {
+			box := EmptyAABB().Extend(Vec3(a)).Extend(Vec3(b))
+			// Aim at a point inside the box, so the ray always hits
+			aim := box.Min.Lerp(box.Max, 0.5)
+			ray := Ray{Origin: Vec3(origin), Direction: aim.Sub(Vec3(origin)).Normalize()}
+			if box.Contains(ray.Origin) {
+				t, hit := ray.IntersectAABB(box)
+				return hit && t == 0
+			}
+
+			t, hit := ray.IntersectAABB(box)
+			grown := AABB{Min: box.Min.Sub(Vec3{1e-3, 1e-3, 1e-3}), Max: box.Max.Add(Vec3{1e-3, 1e-3, 1e-3})}
+			return hit && t > 0 && grown.Contains(ray.At(t)) && !box.Contains(ray.At(t*0.99))
+		})
+	})
+	t.Run("hits are on the plane", func(t *testing.T) {
+		check(t, func(origin, direction, point, normal point) bool {
+			plane := PlaneFromPoint(Vec3(point), Vec3(normal))
+			ray := Ray{Origin: Vec3(origin), Direction: Vec3(direction).Normalize()}
+
+			t, hit := ray.IntersectPlane(plane)
+			if !hit {
+				// Missing rays point away from the plane
+				return plane.Distance(ray.Origin)*plane.Normal.Dot(ray.Direction) >= 0
+			}
+
+			return approx(plane.Distance(ray.At(t))/max(t, 1), 0)
+		})
+	})
+}
+
+func TestPlane_properties(t *testing.T) {
+	check(t, func(a, b, c, p point) bool {
+		plane := PlaneFromPoints(Vec3(a), Vec3(b), Vec3(c))
+		if plane.Normal == (Vec3{}) {
+			return true
+		}
+
+		projected := plane.Project(Vec3(p))
+		return approx(plane.Distance(Vec3(a)), 0) && approx(plane.Distance(Vec3(c)), 0) && approx(plane.Distance(projected), 0)
+	})
+}
+
+func TestFrustum_properties(t *testing.T) {
+	view := LookAt(Vec3{0, 2, 10}, Vec3{}, Vec3{Y: 1})
+	for name, projection := range map[string]Mat4{
+		"perspective":  Perspective(1, 1.5, 0.5, 15),
+		"orthographic": Orthographic(-8, 8, -6, 6, 0.5, 15),
+		"reversed":     ReverseDepth().Mul(Perspective(1, 1.5, 0.5, 15)),
+	} {
+		m := projection.Mul(view)
+		frustum := FrustumFromMatrix(m)
+
+		t.Run(name, func(t *testing.T) {
+			t.Run("contains the points that project inside clip space", func(t *testing.T) {
+				check(t, func(p point) bool {
+					// Points close to the planes may go either way
+					clip := m.MulVec4(Vec3(p).Vec4(1))
+					margin := abs(clip.W) * 1e-3
+					inside := clip.W > 0 &&
+						abs(clip.X) < clip.W-margin && abs(clip.Y) < clip.W-margin &&
+						clip.Z > margin && clip.Z < clip.W-margin
+					outside := clip.W <= 0 ||
+						abs(clip.X) > clip.W+margin || abs(clip.Y) > clip.W+margin ||
+						clip.Z < -margin || clip.Z > clip.W+margin
+
+					return (!inside || frustum.Contains(Vec3(p))) && (!outside || !frustum.Contains(Vec3(p)))
+				})
+			})
+			t.Run("intersects the boxes around points it contains", func(t *testing.T) {
+				check(t, func(p, size point) bool {
+					box := EmptyAABB().Extend(Vec3(p)).Extend(Vec3(p).Add(Vec3(size).Scale(0.1)))
+					return !frustum.Contains(Vec3(p)) || frustum.IntersectsAABB(box)
+				})
+			})
+		})
+	}
+
+	frustum := FrustumFromMatrix(Perspective(1, 1, 1, 10))
+	if frustum.IntersectsAABB(AABB{Min: Vec3{-1, -1, 1}, Max: Vec3{1, 1, 2}}) {
+		t.Error("expected a box behind the viewer not to intersect the frustum")
+	}
+	if !frustum.IntersectsAABB(AABB{Min: Vec3{-100, -100, -5}, Max: Vec3{100, 100, -4}}) {
+		t.Error("expected a box larger than the frustum to intersect it")
+	}
+}
+
+func TestAllocations(t *testing.T) {
+	m := TRS(Vec3{1, 2, 3}, QuatAxisAngle(Vec3{Y: 1}, 1), Vec3{1, 1, 1})
+	frustum := FrustumFromMatrix(Perspective(1, 1, 0.1, 100).Mul(m))
+	box := AABB{Max: Vec3{1, 1, 1}}
+
+	allocations := testing.AllocsPerRun(100, func() {
+		inverse, _ := m.Inverse()
+		_, rotation, _ := inverse.Decompose()
+		_ = rotation.Slerp(IdentityQuat(), 0.5)
+		_ = frustum.IntersectsAABB(box.Transform(m))
+		_, _ = Ray{Direction: Vec3{Z: -1}}.IntersectAABB(box)
+	})
+	if allocations != 0 {
+		t.Errorf("expected no allocations, got %f", allocations)
+	}
+}
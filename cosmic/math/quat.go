@@ -0,0 +1,162 @@
+package math
+
+import stdmath "math"
+
+// Quat is a rotation quaternion. Rotations are only represented by quaternions
+// of unit length.
+type Quat struct {
+	X, Y, Z, W float32
+}
+
+func IdentityQuat() Quat {
+	return Quat{W: 1}
+}
+
+// QuatAxisAngle rotates counter-clockwise around the axis by the given angle
+// in radians, looking down the axis towards the origin.
+func QuatAxisAngle(axis Vec3, angle float32) Quat {
+	sin, cos := stdmath.Sincos(float64(angle) / 2)
+	v := axis.Normalize().Scale(float32(sin))
+
+	return Quat{v.X, v.Y, v.Z, float32(cos)}
+}
+
+// QuatFromMat3 returns the rotation of an orthonormal matrix.
+func QuatFromMat3(m Mat3) Quat {
+	// Derive the largest component first, the others are computed from it
+	// to stay accurate
+	trace := m[0] + m[4] + m[8]
+	switch {
+	case trace > 0:
+		s := sqrt(trace+1) * 2
+		return Quat{(m[5] - m[7]) / s, (m[6] - m[2]) / s, (m[1] - m[3]) / s, s / 4}
+	case m[0] > m[4] && m[0] > m[8]:
+		s := sqrt(1+m[0]-m[4]-m[8]) * 2
+		return Quat{s / 4, (m[3] + m[1]) / s, (m[6] + m[2]) / s, (m[5] - m[7]) / s}
+	case m[4] > m[8]:
+		s := sqrt(1+m[4]-m[0]-m[8]) * 2
+		return Quat{(m[3] + m[1]) / s, s / 4, (m[7] + m[5]) / s, (m[6] - m[2]) / s}
+	default:
+		s := sqrt(1+m[8]-m[0]-m[4]) * 2
+		return Quat{(m[6] + m[2]) / s, (m[7] + m[5]) / s, s / 4, (m[1] - m[3]) / s}
+	}
+}
+
+// QuatLookRotation returns the orientation of something looking in the given
+// direction along its -z axis, with its +y axis as close to up as possible.
+func QuatLookRotation(forward, up Vec3) Quat {
+	f := forward.Normalize()
+	s := f.Cross(up).Normalize()
+	u := s.Cross(f)
+
+	return QuatFromMat3(Mat3{
+		s.X, s.Y, s.Z,
+		u.X, u.Y, u.Z,
+		-f.X, -f.Y, -f.Z,
+	})
+}
+
+// Mul returns the rotation q applied after r.
+func (q Quat) Mul(r Quat) Quat {
+	return Quat{
+		q.W*r.X + q.X*r.W + q.Y*r.Z - q.Z*r.Y,
+		q.W*r.Y - q.X*r.Z + q.Y*r.W + q.Z*r.X,
+		q.W*r.Z + q.X*r.Y - q.Y*r.X + q.Z*r.W,
+		q.W*r.W - q.X*r.X - q.Y*r.Y - q.Z*r.Z,
+	}
+}
+
+// Conjugate returns the inverse rotation.
+func (q Quat) Conjugate() Quat {
+	return Quat{-q.X, -q.Y, -q.Z, q.W}
+}
+
+func (q Quat) Dot(r Quat) float32 {
+	return q.X*r.X + q.Y*r.Y + q.Z*r.Z + q.W*r.W
+}
+
+func (q Quat) Len() float32 {
+	return sqrt(q.Dot(q))
+}
+
+func (q Quat) Normalize() Quat {
+	l := q.Len()
+	if l == 0 {
+		return IdentityQuat()
+	}
+
+	return Quat{q.X / l, q.Y / l, q.Z / l, q.W / l}
+}
+
+// AxisAngle returns the axis and angle QuatAxisAngle creates q from. The
+// identity rotates around the x axis by 0.
+func (q Quat) AxisAngle() (axis Vec3, angle float32) {
+	if q.W < 0 {
+		q = Quat{-q.X, -q.Y, -q.Z, -q.W}
+	}
+
+	axis = Vec3{q.X, q.Y, q.Z}
+	l := axis.Len()
+	if l == 0 {
+		return Vec3{X: 1}, 0
+	}
+
+	return axis.Scale(1 / l), 2 * float32(stdmath.Atan2(float64(l), float64(q.W)))
+}
+
+// Slerp interpolates along the shortest arc from q at t = 0 to r at t = 1, at
+// a constant angular velocity.
+func (q Quat) Slerp(r Quat, t float32) Quat {
+	cos := q.Dot(r)
+	// q and -q are the same rotation, take the shortest way
+	if cos < 0 {
+		r = Quat{-r.X, -r.Y, -r.Z, -r.W}
+		cos = -cos
+	}
+
+	// Nearly equal rotations divide by a sine close to 0, interpolating
+	// linearly is accurate enough there
+	if cos > 0.9995 {
+		return Quat{
+			q.X + (r.X-q.X)*t,
+			q.Y + (r.Y-q.Y)*t,
+			q.Z + (r.Z-q.Z)*t,
+			q.W + (r.W-q.W)*t,
+		}.Normalize()
+	}
+
+	angle := stdmath.Acos(float64(cos))
+	sin := stdmath.Sin(angle)
+	a := float32(stdmath.Sin((1-float64(t))*angle) / sin)
+	b := float32(stdmath.Sin(float64(t)*angle) / sin)
+
+	return Quat{
+		q.X*a + r.X*b,
+		q.Y*a + r.Y*b,
+		q.Z*a + r.Z*b,
+		q.W*a + r.W*b,
+	}
+}
+
+func (q Quat) Rotate(v Vec3) Vec3 {
+	u := Vec3{q.X, q.Y, q.Z}
+	t := u.Cross(v).Scale(2)
+
+	return v.Add(t.Scale(q.W)).Add(u.Cross(t))
+}
+
+// Mat3 returns the rotation as a matrix.
+func (q Quat) Mat3() Mat3 {
+	x, y, z, w := q.X, q.Y, q.Z, q.W
+
+	return Mat3{
+		1 - 2*(y*y+z*z), 2 * (x*y + z*w), 2 * (x*z - y*w),
+		2 * (x*y - z*w), 1 - 2*(x*x+z*z), 2 * (y*z + x*w),
+		2 * (x*z + y*w), 2 * (y*z - x*w), 1 - 2*(x*x+y*y),
+	}
+}
+
+// Mat4 returns the rotation as a matrix.
+func (q Quat) Mat4() Mat4 {
+	return q.Mat3().Mat4()
+}
@@ -0,0 +1,34 @@
+package math
+
+import "testing"
+
+func TestQuat_Rotate(t *testing.T) {
+	q := QuatAxisAngle(Vec3{0, 1, 0}, 1.5707964)
+
+	// A quarter turn around y turns -z into -x
+	got := q.Rotate(Vec3{0, 0, -1})
+	if !near(got.X, -1) || !near(got.Y, 0) || !near(got.Z, 0) {
+		t.Errorf("expected (-1, 0, 0), got %v", got)
+	}
+
+	m := q.Mat4().MulVec4(Vec4{0, 0, -1, 1})
+	if !near(m.X, got.X) || !near(m.Y, got.Y) || !near(m.Z, got.Z) {
+		t.Errorf("expected the matrix to rotate to %v, got %v", got, m)
+	}
+
+	back := q.Conjugate().Rotate(got)
+	if !near(back.X, 0) || !near(back.Y, 0) || !near(back.Z, -1) {
+		t.Errorf("expected the conjugate to rotate back to (0, 0, -1), got %v", back)
+	}
+}
+
+func TestQuat_Mul(t *testing.T) {
+	x := QuatAxisAngle(Vec3{1, 0, 0}, 1.5707964)
+	y := QuatAxisAngle(Vec3{0, 1, 0}, 1.5707964)
+
+	// Rotating y to z around x first, then z to x around y
+	got := y.Mul(x).Rotate(Vec3{0, 1, 0})
+	if !near(got.X, 1) || !near(got.Y, 0) || !near(got.Z, 0) {
+		t.Errorf("expected (1, 0, 0), got %v", got)
+	}
+}
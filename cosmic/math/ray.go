@@ -0,0 +1,63 @@
+package math
+
+import stdmath "math"
+
+// Ray is a half-line starting at Origin. Intersections are returned as the
+// distance t along the ray, in units of the length of Direction.
+type Ray struct {
+	Origin    Vec3
+	Direction Vec3
+}
+
+// At returns the point at distance t along the ray.
+func (r Ray) At(t float32) Vec3 {
+	return r.Origin.Add(r.Direction.Scale(t))
+}
+
+// IntersectPlane returns where the ray hits the plane, and false when the ray
+// is parallel to the plane or points away from it.
+func (r Ray) IntersectPlane(p Plane) (float32, bool) {
+	denominator := p.Normal.Dot(r.Direction)
+	if denominator == 0 {
+		return 0, false
+	}
+
+	t := -p.Distance(r.Origin) / denominator
+	return t, t >= 0
+}
+
+// IntersectAABB returns where the ray enters the box, 0 when it starts inside
+// the box, and false when it misses the box.
+func (r Ray) IntersectAABB(b AABB) (float32, bool) {
+	enter, exit := float32(0), float32(stdmath.Inf(1))
+
+	origin := [3]float32{r.Origin.X, r.Origin.Y, r.Origin.Z}
+	direction := [3]float32{r.Direction.X, r.Direction.Y, r.Direction.Z}
+	lower := [3]float32{b.Min.X, b.Min.Y, b.Min.Z}
+	upper := [3]float32{b.Max.X, b.Max.Y, b.Max.Z}
+
+	// Clip the ray to the slab between the planes of each axis
+	for axis := 0; axis < 3; axis++ {
+		if direction[axis] == 0 {
+			if origin[axis] < lower[axis] || origin[axis] > upper[axis] {
+				return 0, false
+			}
+			continue
+		}
+
+		inverse := 1 / direction[axis]
+		t0 := (lower[axis] - origin[axis]) * inverse
+		t1 := (upper[axis] - origin[axis]) * inverse
+		if t0 > t1 {
+			t0, t1 = t1, t0
+		}
+
+		enter = max(enter, t0)
+		exit = min(exit, t1)
+		if enter > exit {
+			return 0, false
+		}
+	}
+
+	return enter, true
+}
@@ -0,0 +1,239 @@
+// Package math provides the vector, matrix and geometry types used by the
+// engine. All types are small values that are passed and returned by value,
+// so none of the operations allocate.
+//
+// The conventions match the renderer: coordinate systems are right handed,
+// matrices are column-major and transform column vectors, and projections
+// map to Vulkan clip space, where y points down and depth ranges from 0 to 1.
+package math
+
+import stdmath "math"
+
+type Vec2 struct {
+	X, Y float32
+}
+
+func (v Vec2) Add(u Vec2) Vec2 {
+	return Vec2{v.X + u.X, v.Y + u.Y}
+}
+
+func (v Vec2) Sub(u Vec2) Vec2 {
+	return Vec2{v.X - u.X, v.Y - u.Y}
+}
+
+func (v Vec2) Scale(s float32) Vec2 {
+	return Vec2{v.X * s, v.Y * s}
+}
+
+// Mul multiplies the components of v and u.
+func (v Vec2) Mul(u Vec2) Vec2 {
+	return Vec2{v.X * u.X, v.Y * u.Y}
+}
+
+func (v Vec2) Neg() Vec2 {
+	return Vec2{-v.X, -v.Y}
+}
+
+func (v Vec2) Dot(u Vec2) float32 {
+	return v.X*u.X + v.Y*u.Y
+}
+
+func (v Vec2) Len() float32 {
+	return float32(stdmath.Sqrt(float64(v.Dot(v))))
+}
+
+func (v Vec2) Distance(u Vec2) float32 {
+	return v.Sub(u).Len()
+}
+
+// Normalize returns v scaled to unit length, or the zero vector if v has no
+// length.
+func (v Vec2) Normalize() Vec2 {
+	l := v.Len()
+	if l == 0 {
+		return Vec2{}
+	}
+
+	return v.Scale(1 / l)
+}
+
+// Lerp interpolates linearly from v at t = 0 to u at t = 1.
+func (v Vec2) Lerp(u Vec2, t float32) Vec2 {
+	return v.Add(u.Sub(v).Scale(t))
+}
+
+// Min returns the smallest of each component of v and u.
+func (v Vec2) Min(u Vec2) Vec2 {
+	return Vec2{min(v.X, u.X), min(v.Y, u.Y)}
+}
+
+// Max returns the largest of each component of v and u.
+func (v Vec2) Max(u Vec2) Vec2 {
+	return Vec2{max(v.X, u.X), max(v.Y, u.Y)}
+}
+
+// Perp returns v rotated by 90 degrees counter-clockwise.
+func (v Vec2) Perp() Vec2 {
+	return Vec2{-v.Y, v.X}
+}
+
+// Rotate returns v rotated counter-clockwise by the given angle in radians.
+func (v Vec2) Rotate(angle float32) Vec2 {
+	sin, cos := stdmath.Sincos(float64(angle))
+	s, c := float32(sin), float32(cos)
+
+	return Vec2{v.X*c - v.Y*s, v.X*s + v.Y*c}
+}
+
+type Vec3 struct {
+	X, Y, Z float32
+}
+
+func (v Vec3) Add(u Vec3) Vec3 {
+	return Vec3{v.X + u.X, v.Y + u.Y, v.Z + u.Z}
+}
+
+func (v Vec3) Sub(u Vec3) Vec3 {
+	return Vec3{v.X - u.X, v.Y - u.Y, v.Z - u.Z}
+}
+
+func (v Vec3) Scale(s float32) Vec3 {
+	return Vec3{v.X * s, v.Y * s, v.Z * s}
+}
+
+// Mul multiplies the components of v and u.
+func (v Vec3) Mul(u Vec3) Vec3 {
+	return Vec3{v.X * u.X, v.Y * u.Y, v.Z * u.Z}
+}
+
+func (v Vec3) Neg() Vec3 {
+	return Vec3{-v.X, -v.Y, -v.Z}
+}
+
+func (v Vec3) Dot(u Vec3) float32 {
+	return v.X*u.X + v.Y*u.Y + v.Z*u.Z
+}
+
+// Cross returns the cross product, which follows the right hand rule.
+func (v Vec3) Cross(u Vec3) Vec3 {
+	return Vec3{
+		v.Y*u.Z - v.Z*u.Y,
+		v.Z*u.X - v.X*u.Z,
+		v.X*u.Y - v.Y*u.X,
+	}
+}
+
+func (v Vec3) Len() float32 {
+	return float32(stdmath.Sqrt(float64(v.Dot(v))))
+}
+
+func (v Vec3) Distance(u Vec3) float32 {
+	return v.Sub(u).Len()
+}
+
+// Normalize returns v scaled to unit length, or the zero vector if v has no
+// length.
+func (v Vec3) Normalize() Vec3 {
+	l := v.Len()
+	if l == 0 {
+		return Vec3{}
+	}
+
+	return v.Scale(1 / l)
+}
+
+// Lerp interpolates linearly from v at t = 0 to u at t = 1.
+func (v Vec3) Lerp(u Vec3, t float32) Vec3 {
+	return v.Add(u.Sub(v).Scale(t))
+}
+
+// Min returns the smallest of each component of v and u.
+func (v Vec3) Min(u Vec3) Vec3 {
+	return Vec3{min(v.X, u.X), min(v.Y, u.Y), min(v.Z, u.Z)}
+}
+
+// Max returns the largest of each component of v and u.
+func (v Vec3) Max(u Vec3) Vec3 {
+	return Vec3{max(v.X, u.X), max(v.Y, u.Y), max(v.Z, u.Z)}
+}
+
+func (v Vec3) XY() Vec2 {
+	return Vec2{v.X, v.Y}
+}
+
+// Vec4 extends v with the given w, 1 for points and 0 for directions.
+func (v Vec3) Vec4(w float32) Vec4 {
+	return Vec4{v.X, v.Y, v.Z, w}
+}
+
+type Vec4 struct {
+	X, Y, Z, W float32
+}
+
+func (v Vec4) Add(u Vec4) Vec4 {
+	return Vec4{v.X + u.X, v.Y + u.Y, v.Z + u.Z, v.W + u.W}
+}
+
+func (v Vec4) Sub(u Vec4) Vec4 {
+	return Vec4{v.X - u.X, v.Y - u.Y, v.Z - u.Z, v.W - u.W}
+}
+
+func (v Vec4) Scale(s float32) Vec4 {
+	return Vec4{v.X * s, v.Y * s, v.Z * s, v.W * s}
+}
+
+func (v Vec4) Dot(u Vec4) float32 {
+	return v.X*u.X + v.Y*u.Y + v.Z*u.Z + v.W*u.W
+}
+
+func (v Vec4) Len() float32 {
+	return float32(stdmath.Sqrt(float64(v.Dot(v))))
+}
+
+// Normalize returns v scaled to unit length, or the zero vector if v has no
+// length.
+func (v Vec4) Normalize() Vec4 {
+	l := v.Len()
+	if l == 0 {
+		return Vec4{}
+	}
+
+	return v.Scale(1 / l)
+}
+
+// Lerp interpolates linearly from v at t = 0 to u at t = 1.
+func (v Vec4) Lerp(u Vec4, t float32) Vec4 {
+	return v.Add(u.Sub(v).Scale(t))
+}
+
+func (v Vec4) XYZ() Vec3 {
+	return Vec3{v.X, v.Y, v.Z}
+}
+
+func min(a, b float32) float32 {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+func max(a, b float32) float32 {
+	if a > b {
+		return a
+	}
+
+	return b
+}
+
+func abs(a float32) float32 {
+	if a < 0 {
+		return -a
+	}
+
+	return a
+}
+
+func sqrt(a float32) float32 {
+	return float32(stdmath.Sqrt(float64(a)))
+}
@@ -0,0 +1,248 @@
+package mesh
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/lentus/cosmic-engine/cosmic/internal/binfmt"
+	"github.com/lentus/cosmic-engine/cosmic/math"
+	"io"
+	stdmath "math"
+)
+
+// BinaryExtension is the extension of models written by WriteBinary.
+const BinaryExtension = ".cmesh"
+
+// Binary models start with the magic and the format version, followed by the
+// meshes, materials, nodes and roots of the model. Integers are varints,
+// floats and indices little endian and strings and byte slices prefixed by
+// their length. Vertices are stored as encoded by Mesh.Encode, so they are
+// read without parsing.
+const (
+	binaryMagic   = "CMSH"
+	binaryVersion = 1
+)
+
+// maxBinaryLength limits the lengths read from a file, so a corrupt file does
+// not make the reader allocate huge buffers.
+const maxBinaryLength = 1 << 28
+
+func writeTexture(w *binfmt.Writer, t *Texture) {
+	w.Bool(t != nil)
+	if t != nil {
+		w.String(t.Path)
+		w.Bytes(t.Data)
+		w.String(t.MimeType)
+	}
+}
+
+// WriteBinary writes the model in the binary model format, which loads much
+// faster than OBJ or glTF since nothing has to be parsed or generated.
+func WriteBinary(out io.Writer, model *Model) error {
+	w := binfmt.NewWriter(bufio.NewWriter(out))
+	w.Write([]byte(binaryMagic))
+	w.Uvarint(binaryVersion)
+
+	w.Uvarint(uint64(len(model.Meshes)))
+	for i := range model.Meshes {
+		m := &model.Meshes[i]
+		w.String(m.Name)
+		w.Uvarint(uint64(len(m.Vertices)))
+		w.Write(m.Encode())
+
+		w.Uvarint(uint64(len(m.Indices)))
+		for _, index := range m.Indices {
+			w.Uint32(index)
+		}
+
+		w.Uvarint(uint64(len(m.Submeshes)))
+		for _, s := range m.Submeshes {
+			w.Uvarint(uint64(s.FirstIndex))
+			w.Uvarint(uint64(s.IndexCount))
+			w.Varint(int64(s.Material))
+		}
+	}
+
+	w.Uvarint(uint64(len(model.Materials)))
+	for _, m := range model.Materials {
+		w.String(m.Name)
+		w.Float32(m.BaseColor[:]...)
+		w.Float32(m.Metallic, m.Roughness, m.Emissive.X, m.Emissive.Y, m.Emissive.Z)
+		writeTexture(w, m.BaseColorTexture)
+		writeTexture(w, m.NormalTexture)
+		writeTexture(w, m.MetallicRoughnessTexture)
+		writeTexture(w, m.EmissiveTexture)
+		w.Uvarint(uint64(m.AlphaMode))
+		w.Float32(m.AlphaCutoff)
+		w.Bool(m.DoubleSided)
+	}
+
+	w.Uvarint(uint64(len(model.Nodes)))
+	for _, n := range model.Nodes {
+		w.String(n.Name)
+		w.Varint(int64(n.Mesh))
+		w.Uvarint(uint64(len(n.Children)))
+		for _, child := range n.Children {
+			w.Uvarint(uint64(child))
+		}
+		w.Float32(n.Translation.X, n.Translation.Y, n.Translation.Z)
+		w.Float32(n.Rotation.X, n.Rotation.Y, n.Rotation.Z, n.Rotation.W)
+		w.Float32(n.Scale.X, n.Scale.Y, n.Scale.Z)
+	}
+
+	w.Uvarint(uint64(len(model.Roots)))
+	for _, root := range model.Roots {
+		w.Uvarint(uint64(root))
+	}
+
+	return w.Flush()
+}
+
+func readTexture(r *binfmt.Reader) *Texture {
+	if !r.Bool() {
+		return nil
+	}
+
+	return &Texture{Path: r.String(), Data: r.Bytes(), MimeType: r.String()}
+}
+
+func readVertices(r *binfmt.Reader, n int) []Vertex {
+	data := make([]byte, VertexSize)
+	vertices := make([]Vertex, 0, binfmt.Capacity(n))
+	for i := 0; i < n; i++ {
+		if !r.ReadFull(data) {
+			break
+		}
+
+		f := func(j int) float32 {
+			return stdmath.Float32frombits(binary.LittleEndian.Uint32(data[j*4:]))
+		}
+		vertices = append(vertices, Vertex{
+			Position: math.Vec3{X: f(0), Y: f(1), Z: f(2)},
+			Normal:   math.Vec3{X: f(3), Y: f(4), Z: f(5)},
+			Tangent:  math.Vec4{X: f(6), Y: f(7), Z: f(8), W: f(9)},
+			UV:       math.Vec2{X: f(10), Y: f(11)},
+			Color:    [4]float32{f(12), f(13), f(14), f(15)},
+		})
+	}
+
+	return vertices
+}
+
+// ParseBinary reads a model written by WriteBinary.
+func ParseBinary(in io.Reader) (*Model, error) {
+	r := binfmt.NewReader(bufio.NewReader(in), maxBinaryLength)
+
+	magic := make([]byte, len(binaryMagic))
+	if !r.ReadFull(magic) || string(magic) != binaryMagic {
+		return nil, errors.New("not a binary model")
+	}
+	if version := r.Uvarint(); r.Err() == nil && version != binaryVersion {
+		return nil, fmt.Errorf("unsupported binary model version %d", version)
+	}
+
+	model := &Model{}
+	meshes := r.Length()
+	for i := 0; i < meshes && r.Err() == nil; i++ {
+		m := Mesh{Name: r.String()}
+		m.Vertices = readVertices(r, r.Length())
+
+		indices := r.Length()
+		m.Indices = make([]uint32, 0, binfmt.Capacity(indices))
+		for j := 0; j < indices && r.Err() == nil; j++ {
+			index := r.Uint32()
+			if int(index) >= len(m.Vertices) {
+				r.Fail(fmt.Errorf("mesh %s: index %d out of range", m.Name, index))
+			}
+			m.Indices = append(m.Indices, index)
+		}
+
+		submeshes := r.Length()
+		for j := 0; j < submeshes && r.Err() == nil; j++ {
+			m.Submeshes = append(m.Submeshes, Submesh{FirstIndex: r.Length(), IndexCount: r.Length(), Material: r.Varint()})
+		}
+
+		model.Meshes = append(model.Meshes, m)
+	}
+
+	materials := r.Length()
+	for i := 0; i < materials && r.Err() == nil; i++ {
+		var m Material
+		m.Name = r.String()
+		for j := range m.BaseColor {
+			m.BaseColor[j] = r.Float32()
+		}
+		m.Metallic, m.Roughness = r.Float32(), r.Float32()
+		m.Emissive = math.Vec3{X: r.Float32(), Y: r.Float32(), Z: r.Float32()}
+		m.BaseColorTexture = readTexture(r)
+		m.NormalTexture = readTexture(r)
+		m.MetallicRoughnessTexture = readTexture(r)
+		m.EmissiveTexture = readTexture(r)
+		m.AlphaMode = AlphaMode(r.Uvarint())
+		m.AlphaCutoff = r.Float32()
+		m.DoubleSided = r.Bool()
+
+		model.Materials = append(model.Materials, m)
+	}
+
+	nodes := r.Length()
+	for i := 0; i < nodes && r.Err() == nil; i++ {
+		n := Node{Name: r.String(), Mesh: r.Varint()}
+		children := r.Length()
+		for j := 0; j < children && r.Err() == nil; j++ {
+			n.Children = append(n.Children, r.Length())
+		}
+		n.Translation = math.Vec3{X: r.Float32(), Y: r.Float32(), Z: r.Float32()}
+		n.Rotation = math.Quat{X: r.Float32(), Y: r.Float32(), Z: r.Float32(), W: r.Float32()}
+		n.Scale = math.Vec3{X: r.Float32(), Y: r.Float32(), Z: r.Float32()}
+
+		model.Nodes = append(model.Nodes, n)
+	}
+
+	roots := r.Length()
+	for i := 0; i < roots && r.Err() == nil; i++ {
+		model.Roots = append(model.Roots, r.Length())
+	}
+
+	if r.Err() == nil {
+		r.Fail(model.validate())
+	}
+	if r.Err() != nil {
+		return nil, fmt.Errorf("invalid binary model: %s", r.Err().Error())
+	}
+	return model, nil
+}
+
+// validate checks the references between the parts of a model read from a
+// file.
+func (model *Model) validate() error {
+	for _, m := range model.Meshes {
+		for _, s := range m.Submeshes {
+			if s.FirstIndex+s.IndexCount > len(m.Indices) {
+				return fmt.Errorf("mesh %s: submesh out of range", m.Name)
+			}
+			if s.Material < -1 || s.Material >= len(model.Materials) {
+				return fmt.Errorf("mesh %s: invalid material %d", m.Name, s.Material)
+			}
+		}
+	}
+
+	for _, n := range model.Nodes {
+		if n.Mesh < -1 || n.Mesh >= len(model.Meshes) {
+			return fmt.Errorf("node %s: invalid mesh %d", n.Name, n.Mesh)
+		}
+		for _, child := range n.Children {
+			if child >= len(model.Nodes) {
+				return fmt.Errorf("node %s: invalid child %d", n.Name, child)
+			}
+		}
+	}
+	for _, root := range model.Roots {
+		if root >= len(model.Nodes) {
+			return fmt.Errorf("invalid root %d", root)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package mesh
+
+import "github.com/lentus/cosmic-engine/cosmic/math"
+
+// GenerateNormals sets the normal of every vertex to the average normal of
+// the triangles using it, weighted by their area. Vertices shared by
+// triangles are smoothed, duplicated vertices keep hard edges.
+func (m *Mesh) GenerateNormals() {
+	normals := make([]math.Vec3, len(m.Vertices))
+	m.eachTriangle(func(a, b, c uint32) {
+		p0, p1, p2 := m.Vertices[a].Position, m.Vertices[b].Position, m.Vertices[c].Position
+		// The length of the cross product is twice the area
+		normal := p1.Sub(p0).Cross(p2.Sub(p0))
+		normals[a] = normals[a].Add(normal)
+		normals[b] = normals[b].Add(normal)
+		normals[c] = normals[c].Add(normal)
+	})
+
+	for i := range m.Vertices {
+		m.Vertices[i].Normal = normals[i].Normalize()
+	}
+}
+
+// GenerateTangents derives tangents from the texture coordinates, so normal
+// maps can be applied. Tangents are averaged over the triangles using a
+// vertex and made perpendicular to its normal.
+func (m *Mesh) GenerateTangents() {
+	tangents := make([]math.Vec3, len(m.Vertices))
+	bitangents := make([]math.Vec3, len(m.Vertices))
+	m.eachTriangle(func(a, b, c uint32) {
+		v0, v1, v2 := m.Vertices[a], m.Vertices[b], m.Vertices[c]
+		e1, e2 := v1.Position.Sub(v0.Position), v2.Position.Sub(v0.Position)
+		d1, d2 := v1.UV.Sub(v0.UV), v2.UV.Sub(v0.UV)
+
+		det := d1.X*d2.Y - d2.X*d1.Y
+		if det == 0 {
+			return
+		}
+		r := 1 / det
+		tangent := e1.Scale(d2.Y).Sub(e2.Scale(d1.Y)).Scale(r)
+		bitangent := e2.Scale(d1.X).Sub(e1.Scale(d2.X)).Scale(r)
+
+		for _, i := range [3]uint32{a, b, c} {
+			tangents[i] = tangents[i].Add(tangent)
+			bitangents[i] = bitangents[i].Add(bitangent)
+		}
+	})
+
+	for i := range m.Vertices {
+		n := m.Vertices[i].Normal
+		t := tangents[i].Sub(n.Scale(n.Dot(tangents[i]))).Normalize()
+		if t == (math.Vec3{}) {
+			t = anyPerpendicular(n)
+		}
+
+		w := float32(1)
+		if n.Cross(t).Dot(bitangents[i]) < 0 {
+			w = -1
+		}
+		m.Vertices[i].Tangent = t.Vec4(w)
+	}
+}
+
+// anyPerpendicular returns a unit vector perpendicular to n, for vertices
+// whose texture coordinates do not define a tangent.
+func anyPerpendicular(n math.Vec3) math.Vec3 {
+	axis := math.Vec3{X: 1}
+	if n.X > 0.9 || n.X < -0.9 {
+		axis = math.Vec3{Y: 1}
+	}
+
+	return n.Cross(axis).Normalize()
+}
+
+func (m *Mesh) eachTriangle(f func(a, b, c uint32)) {
+	for i := 0; i+2 < len(m.Indices); i += 3 {
+		f(m.Indices[i], m.Indices[i+1], m.Indices[i+2])
+	}
+}
@@ -0,0 +1,741 @@
+package mesh
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/lentus/cosmic-engine/cosmic/math"
+	"io"
+	"io/ioutil"
+	stdmath "math"
+	"net/url"
+	"strings"
+)
+
+// The subset of the glTF 2.0 schema the loader uses.
+type gltfDocument struct {
+	Asset struct {
+		Version string `json:"version"`
+	} `json:"asset"`
+	ExtensionsRequired []string `json:"extensionsRequired"`
+
+	Scene  *int `json:"scene"`
+	Scenes []struct {
+		Nodes []int `json:"nodes"`
+	} `json:"scenes"`
+	Nodes []struct {
+		Name        string    `json:"name"`
+		Mesh        *int      `json:"mesh"`
+		Children    []int     `json:"children"`
+		Matrix      []float32 `json:"matrix"`
+		Translation []float32 `json:"translation"`
+		Rotation    []float32 `json:"rotation"`
+		Scale       []float32 `json:"scale"`
+	} `json:"nodes"`
+	Meshes []struct {
+		Name       string `json:"name"`
+		Primitives []struct {
+			Attributes map[string]int `json:"attributes"`
+			Indices    *int           `json:"indices"`
+			Material   *int           `json:"material"`
+			Mode       *int           `json:"mode"`
+		} `json:"primitives"`
+	} `json:"meshes"`
+	Materials []struct {
+		Name                 string `json:"name"`
+		PbrMetallicRoughness struct {
+			BaseColorFactor          []float32        `json:"baseColorFactor"`
+			BaseColorTexture         *gltfTextureInfo `json:"baseColorTexture"`
+			MetallicFactor           *float32         `json:"metallicFactor"`
+			RoughnessFactor          *float32         `json:"roughnessFactor"`
+			MetallicRoughnessTexture *gltfTextureInfo `json:"metallicRoughnessTexture"`
+		} `json:"pbrMetallicRoughness"`
+		NormalTexture   *gltfTextureInfo `json:"normalTexture"`
+		EmissiveTexture *gltfTextureInfo `json:"emissiveTexture"`
+		EmissiveFactor  []float32        `json:"emissiveFactor"`
+		AlphaMode       string           `json:"alphaMode"`
+		AlphaCutoff     *float32         `json:"alphaCutoff"`
+		DoubleSided     bool             `json:"doubleSided"`
+	} `json:"materials"`
+	Textures []struct {
+		Source *int `json:"source"`
+	} `json:"textures"`
+	Images []struct {
+		URI        string `json:"uri"`
+		MimeType   string `json:"mimeType"`
+		BufferView *int   `json:"bufferView"`
+	} `json:"images"`
+	Accessors []struct {
+		BufferView    *int            `json:"bufferView"`
+		ByteOffset    int             `json:"byteOffset"`
+		ComponentType int             `json:"componentType"`
+		Normalized    bool            `json:"normalized"`
+		Count         int             `json:"count"`
+		Type          string          `json:"type"`
+		Sparse        json.RawMessage `json:"sparse"`
+	} `json:"accessors"`
+	BufferViews []struct {
+		Buffer     int `json:"buffer"`
+		ByteOffset int `json:"byteOffset"`
+		ByteLength int `json:"byteLength"`
+		ByteStride int `json:"byteStride"`
+	} `json:"bufferViews"`
+	Buffers []struct {
+		URI        string `json:"uri"`
+		ByteLength int    `json:"byteLength"`
+	} `json:"buffers"`
+}
+
+type gltfTextureInfo struct {
+	Index int `json:"index"`
+}
+
+const (
+	glbMagic     = 0x46546C67
+	glbChunkJSON = 0x4E4F534A
+	glbChunkBIN  = 0x004E4942
+)
+
+const (
+	gltfModePoints = iota
+	gltfModeLines
+	gltfModeLineLoop
+	gltfModeLineStrip
+	gltfModeTriangles
+	gltfModeTriangleStrip
+	gltfModeTriangleFan
+)
+
+var gltfComponentSizes = map[int]int{
+	5120: 1, // byte
+	5121: 1, // unsigned byte
+	5122: 2, // short
+	5123: 2, // unsigned short
+	5125: 4, // unsigned int
+	5126: 4, // float
+}
+
+var gltfTypeComponents = map[string]int{
+	"SCALAR": 1,
+	"VEC2":   2,
+	"VEC3":   3,
+	"VEC4":   4,
+	"MAT2":   4,
+	"MAT3":   9,
+	"MAT4":   16,
+}
+
+type gltfParser struct {
+	document gltfDocument
+	buffers  [][]byte
+}
+
+// ParseGLTF parses a glTF 2.0 model, either as JSON or in the binary GLB
+// container. External buffers and images are opened with open, by their path
+// relative to the model. Only triangle primitives are loaded, points and lines
+// are skipped.
+func ParseGLTF(r io.Reader, open Opener) (*Model, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var binaryChunk []byte
+	if len(data) >= 4 && binary.LittleEndian.Uint32(data) == glbMagic {
+		if data, binaryChunk, err = parseGLB(data); err != nil {
+			return nil, err
+		}
+	}
+
+	p := &gltfParser{}
+	if err := json.Unmarshal(data, &p.document); err != nil {
+		return nil, fmt.Errorf("invalid glTF JSON: %s", err.Error())
+	}
+	if !strings.HasPrefix(p.document.Asset.Version, "2.") {
+		return nil, fmt.Errorf("unsupported glTF version %q", p.document.Asset.Version)
+	}
+	if len(p.document.ExtensionsRequired) > 0 {
+		return nil, fmt.Errorf("unsupported required extensions %s", strings.Join(p.document.ExtensionsRequired, ", "))
+	}
+
+	if err := p.loadBuffers(binaryChunk, open); err != nil {
+		return nil, err
+	}
+
+	model := &Model{}
+	for i := range p.document.Materials {
+		material, err := p.material(i, open)
+		if err != nil {
+			return nil, fmt.Errorf("material %d: %s", i, err.Error())
+		}
+		model.Materials = append(model.Materials, material)
+	}
+	for i := range p.document.Meshes {
+		mesh, err := p.mesh(i)
+		if err != nil {
+			return nil, fmt.Errorf("mesh %d: %s", i, err.Error())
+		}
+		model.Meshes = append(model.Meshes, mesh)
+	}
+	if err := p.nodes(model); err != nil {
+		return nil, err
+	}
+
+	return model, nil
+}
+
+// parseGLB splits a binary glTF file into its JSON and binary chunks.
+func parseGLB(data []byte) (document, binaryChunk []byte, err error) {
+	if len(data) < 12 {
+		return nil, nil, fmt.Errorf("truncated GLB header")
+	}
+	if version := binary.LittleEndian.Uint32(data[4:]); version != 2 {
+		return nil, nil, fmt.Errorf("unsupported GLB version %d", version)
+	}
+	length := int(binary.LittleEndian.Uint32(data[8:]))
+	if length > len(data) {
+		return nil, nil, fmt.Errorf("truncated GLB file, expected %d bytes, got %d", length, len(data))
+	}
+
+	for offset := 12; offset+8 <= length; {
+		chunkLength := int(binary.LittleEndian.Uint32(data[offset:]))
+		chunkType := binary.LittleEndian.Uint32(data[offset+4:])
+		offset += 8
+		if offset+chunkLength > length {
+			return nil, nil, fmt.Errorf("truncated GLB chunk")
+		}
+
+		chunk := data[offset : offset+chunkLength]
+		switch {
+		case chunkType == glbChunkJSON && document == nil:
+			document = chunk
+		case chunkType == glbChunkBIN && binaryChunk == nil:
+			binaryChunk = chunk
+		}
+		// Chunks are padded to 4 bytes
+		offset += (chunkLength + 3) &^ 3
+	}
+
+	if document == nil {
+		return nil, nil, fmt.Errorf("GLB file has no JSON chunk")
+	}
+
+	return document, binaryChunk, nil
+}
+
+func (p *gltfParser) loadBuffers(binaryChunk []byte, open Opener) error {
+	for i, b := range p.document.Buffers {
+		var data []byte
+		var err error
+		switch {
+		case b.URI == "" && i == 0 && binaryChunk != nil:
+			data = binaryChunk
+		case b.URI == "":
+			err = fmt.Errorf("no data")
+		default:
+			data, _, err = loadURI(b.URI, open)
+		}
+		if err != nil {
+			return fmt.Errorf("buffer %d: %s", i, err.Error())
+		}
+
+		if len(data) < b.ByteLength {
+			return fmt.Errorf("buffer %d: expected %d bytes, got %d", i, b.ByteLength, len(data))
+		}
+		p.buffers = append(p.buffers, data[:b.ByteLength])
+	}
+
+	return nil
+}
+
+// loadURI returns the data of an embedded data URI or of a relative file.
+func loadURI(uri string, open Opener) (data []byte, mimeType string, err error) {
+	if strings.HasPrefix(uri, "data:") {
+		separator := strings.Index(uri, ",")
+		if separator < 0 || !strings.HasSuffix(uri[:separator], ";base64") {
+			return nil, "", fmt.Errorf("unsupported data URI")
+		}
+
+		mimeType = strings.TrimSuffix(strings.TrimPrefix(uri[:separator], "data:"), ";base64")
+		data, err = base64.StdEncoding.DecodeString(uri[separator+1:])
+		return data, mimeType, err
+	}
+
+	name, err := url.PathUnescape(uri)
+	if err != nil {
+		return nil, "", err
+	}
+	file, err := open(name)
+	if err != nil {
+		return nil, "", err
+	}
+	defer file.Close()
+
+	data, err = ioutil.ReadAll(file)
+	return data, "", err
+}
+
+// bufferView returns the bytes of a buffer view and its stride.
+func (p *gltfParser) bufferView(index int) ([]byte, int, error) {
+	if index < 0 || index >= len(p.document.BufferViews) {
+		return nil, 0, fmt.Errorf("buffer view %d does not exist", index)
+	}
+
+	view := p.document.BufferViews[index]
+	if view.Buffer < 0 || view.Buffer >= len(p.buffers) {
+		return nil, 0, fmt.Errorf("buffer view %d: buffer %d does not exist", index, view.Buffer)
+	}
+	buffer := p.buffers[view.Buffer]
+	if view.ByteOffset < 0 || view.ByteLength < 0 || view.ByteOffset+view.ByteLength > len(buffer) {
+		return nil, 0, fmt.Errorf("buffer view %d is outside of its buffer", index)
+	}
+
+	return buffer[view.ByteOffset : view.ByteOffset+view.ByteLength], view.ByteStride, nil
+}
+
+// accessor returns the elements of an accessor as floats, normalizing
+// integer components when the accessor is normalized.
+func (p *gltfParser) accessor(index int) (values []float32, components int, err error) {
+	if index < 0 || index >= len(p.document.Accessors) {
+		return nil, 0, fmt.Errorf("accessor %d does not exist", index)
+	}
+
+	a := p.document.Accessors[index]
+	components, ok := gltfTypeComponents[a.Type]
+	if !ok {
+		return nil, 0, fmt.Errorf("accessor %d has invalid type %q", index, a.Type)
+	}
+	size, ok := gltfComponentSizes[a.ComponentType]
+	if !ok {
+		return nil, 0, fmt.Errorf("accessor %d has invalid component type %d", index, a.ComponentType)
+	}
+	if a.Sparse != nil {
+		return nil, 0, fmt.Errorf("accessor %d is sparse, which is not supported", index)
+	}
+
+	values = make([]float32, a.Count*components)
+	// Accessors without a buffer view are all zeros
+	if a.BufferView == nil {
+		return values, components, nil
+	}
+
+	data, stride, err := p.bufferView(*a.BufferView)
+	if err != nil {
+		return nil, 0, err
+	}
+	elementSize := components * size
+	if stride == 0 {
+		stride = elementSize
+	}
+	if a.Count > 0 && (a.ByteOffset < 0 || a.ByteOffset+stride*(a.Count-1)+elementSize > len(data)) {
+		return nil, 0, fmt.Errorf("accessor %d is outside of its buffer view", index)
+	}
+
+	for i := 0; i < a.Count; i++ {
+		element := data[a.ByteOffset+i*stride:]
+		for c := 0; c < components; c++ {
+			values[i*components+c] = readComponent(element[c*size:], a.ComponentType, a.Normalized)
+		}
+	}
+
+	return values, components, nil
+}
+
+func readComponent(data []byte, componentType int, normalized bool) float32 {
+	switch componentType {
+	case 5120:
+		v := float32(int8(data[0]))
+		if normalized {
+			return float32(stdmath.Max(float64(v)/127, -1))
+		}
+		return v
+	case 5121:
+		v := float32(data[0])
+		if normalized {
+			return v / 255
+		}
+		return v
+	case 5122:
+		v := float32(int16(binary.LittleEndian.Uint16(data)))
+		if normalized {
+			return float32(stdmath.Max(float64(v)/32767, -1))
+		}
+		return v
+	case 5123:
+		v := float32(binary.LittleEndian.Uint16(data))
+		if normalized {
+			return v / 65535
+		}
+		return v
+	case 5125:
+		return float32(binary.LittleEndian.Uint32(data))
+	default:
+		return stdmath.Float32frombits(binary.LittleEndian.Uint32(data))
+	}
+}
+
+// indices reads an index accessor exactly, indices above 2^24 do not
+// survive the conversion to float32.
+func (p *gltfParser) indices(index int) ([]uint32, error) {
+	if index < 0 || index >= len(p.document.Accessors) {
+		return nil, fmt.Errorf("accessor %d does not exist", index)
+	}
+
+	a := p.document.Accessors[index]
+	if a.Type != "SCALAR" || a.BufferView == nil {
+		return nil, fmt.Errorf("accessor %d cannot hold indices", index)
+	}
+	size := map[int]int{5121: 1, 5123: 2, 5125: 4}[a.ComponentType]
+	if size == 0 {
+		return nil, fmt.Errorf("accessor %d has invalid index component type %d", index, a.ComponentType)
+	}
+
+	data, stride, err := p.bufferView(*a.BufferView)
+	if err != nil {
+		return nil, err
+	}
+	if stride == 0 {
+		stride = size
+	}
+	if a.Count > 0 && (a.ByteOffset < 0 || a.ByteOffset+stride*(a.Count-1)+size > len(data)) {
+		return nil, fmt.Errorf("accessor %d is outside of its buffer view", index)
+	}
+
+	indices := make([]uint32, a.Count)
+	for i := range indices {
+		element := data[a.ByteOffset+i*stride:]
+		switch size {
+		case 1:
+			indices[i] = uint32(element[0])
+		case 2:
+			indices[i] = uint32(binary.LittleEndian.Uint16(element))
+		default:
+			indices[i] = binary.LittleEndian.Uint32(element)
+		}
+	}
+
+	return indices, nil
+}
+
+// mesh converts the triangle primitives of a mesh into submeshes of a single
+// mesh.
+func (p *gltfParser) mesh(index int) (Mesh, error) {
+	m := Mesh{Name: p.document.Meshes[index].Name}
+
+	for i, primitive := range p.document.Meshes[index].Primitives {
+		mode := gltfModeTriangles
+		if primitive.Mode != nil {
+			mode = *primitive.Mode
+		}
+		if mode < gltfModeTriangles || mode > gltfModeTriangleFan {
+			continue
+		}
+
+		part, err := p.primitive(primitive.Attributes, primitive.Indices, mode)
+		if err != nil {
+			return Mesh{}, fmt.Errorf("primitive %d: %s", i, err.Error())
+		}
+
+		material := -1
+		if primitive.Material != nil {
+			if *primitive.Material < 0 || *primitive.Material >= len(p.document.Materials) {
+				return Mesh{}, fmt.Errorf("primitive %d: material %d does not exist", i, *primitive.Material)
+			}
+			material = *primitive.Material
+		}
+
+		base := uint32(len(m.Vertices))
+		m.Submeshes = append(m.Submeshes, Submesh{FirstIndex: len(m.Indices), IndexCount: len(part.Indices), Material: material})
+		m.Vertices = append(m.Vertices, part.Vertices...)
+		for _, index := range part.Indices {
+			m.Indices = append(m.Indices, base+index)
+		}
+	}
+
+	return m, nil
+}
+
+func (p *gltfParser) primitive(attributes map[string]int, indicesAccessor *int, mode int) (Mesh, error) {
+	position, ok := attributes["POSITION"]
+	if !ok {
+		return Mesh{}, fmt.Errorf("no POSITION attribute")
+	}
+	positions, _, err := p.accessor(position)
+	if err != nil {
+		return Mesh{}, err
+	}
+	count := len(positions) / 3
+
+	var m Mesh
+	m.Vertices = make([]Vertex, count)
+	for i := range m.Vertices {
+		m.Vertices[i] = Vertex{
+			Position: math.Vec3{X: positions[i*3], Y: positions[i*3+1], Z: positions[i*3+2]},
+			Color:    [4]float32{1, 1, 1, 1},
+		}
+	}
+
+	attribute := func(name string, set func(v *Vertex, values []float32)) (bool, error) {
+		index, ok := attributes[name]
+		if !ok {
+			return false, nil
+		}
+		values, components, err := p.accessor(index)
+		if err != nil {
+			return false, fmt.Errorf("%s: %s", name, err.Error())
+		}
+		if len(values)/components != count {
+			return false, fmt.Errorf("%s has %d elements, POSITION %d", name, len(values)/components, count)
+		}
+		for i := range m.Vertices {
+			set(&m.Vertices[i], values[i*components:(i+1)*components])
+		}
+		return true, nil
+	}
+
+	hasNormals, err := attribute("NORMAL", func(v *Vertex, values []float32) {
+		v.Normal = math.Vec3{X: values[0], Y: values[1], Z: values[2]}.Normalize()
+	})
+	if err != nil {
+		return Mesh{}, err
+	}
+	hasTangents, err := attribute("TANGENT", func(v *Vertex, values []float32) {
+		v.Tangent = math.Vec4{X: values[0], Y: values[1], Z: values[2], W: values[3]}
+	})
+	if err != nil {
+		return Mesh{}, err
+	}
+	if _, err = attribute("TEXCOORD_0", func(v *Vertex, values []float32) {
+		v.UV = math.Vec2{X: values[0], Y: values[1]}
+	}); err != nil {
+		return Mesh{}, err
+	}
+	if _, err = attribute("COLOR_0", func(v *Vertex, values []float32) {
+		copy(v.Color[:], values)
+	}); err != nil {
+		return Mesh{}, err
+	}
+
+	var indices []uint32
+	if indicesAccessor != nil {
+		if indices, err = p.indices(*indicesAccessor); err != nil {
+			return Mesh{}, fmt.Errorf("indices: %s", err.Error())
+		}
+		for _, index := range indices {
+			if int(index) >= count {
+				return Mesh{}, fmt.Errorf("index %d refers to a vertex that does not exist", index)
+			}
+		}
+	} else {
+		indices = make([]uint32, count)
+		for i := range indices {
+			indices[i] = uint32(i)
+		}
+	}
+	m.Indices = triangleList(indices, mode)
+
+	if !hasNormals {
+		// Meshes without normals are flat shaded
+		m.unweld()
+		m.GenerateNormals()
+	}
+	if !hasTangents {
+		m.GenerateTangents()
+	}
+
+	return m, nil
+}
+
+// triangleList converts strips and fans to lists of triangles.
+func triangleList(indices []uint32, mode int) []uint32 {
+	var list []uint32
+	switch mode {
+	case gltfModeTriangleStrip:
+		for i := 0; i+2 < len(indices); i++ {
+			// Every other triangle is reversed to keep the winding order
+			if i%2 == 0 {
+				list = append(list, indices[i], indices[i+1], indices[i+2])
+			} else {
+				list = append(list, indices[i+1], indices[i], indices[i+2])
+			}
+		}
+	case gltfModeTriangleFan:
+		for i := 1; i+1 < len(indices); i++ {
+			list = append(list, indices[0], indices[i], indices[i+1])
+		}
+	default:
+		list = indices[:len(indices)/3*3]
+	}
+
+	return list
+}
+
+// unweld gives every triangle its own vertices, so generated normals are not
+// shared between triangles.
+func (m *Mesh) unweld() {
+	vertices := make([]Vertex, len(m.Indices))
+	for i, index := range m.Indices {
+		vertices[i] = m.Vertices[index]
+		m.Indices[i] = uint32(i)
+	}
+	m.Vertices = vertices
+}
+
+func (p *gltfParser) material(index int, open Opener) (Material, error) {
+	source := p.document.Materials[index]
+	material := DefaultMaterial()
+	material.Name = source.Name
+	// glTF defaults to a fully metallic material
+	material.Metallic = 1
+
+	pbr := source.PbrMetallicRoughness
+	if len(pbr.BaseColorFactor) == 4 {
+		copy(material.BaseColor[:], pbr.BaseColorFactor)
+	}
+	if pbr.MetallicFactor != nil {
+		material.Metallic = *pbr.MetallicFactor
+	}
+	if pbr.RoughnessFactor != nil {
+		material.Roughness = *pbr.RoughnessFactor
+	}
+	if len(source.EmissiveFactor) == 3 {
+		material.Emissive = math.Vec3{X: source.EmissiveFactor[0], Y: source.EmissiveFactor[1], Z: source.EmissiveFactor[2]}
+	}
+
+	switch source.AlphaMode {
+	case "", "OPAQUE":
+		material.AlphaMode = AlphaOpaque
+	case "MASK":
+		material.AlphaMode = AlphaMask
+	case "BLEND":
+		material.AlphaMode = AlphaBlend
+	default:
+		return Material{}, fmt.Errorf("invalid alpha mode %q", source.AlphaMode)
+	}
+	if source.AlphaCutoff != nil {
+		material.AlphaCutoff = *source.AlphaCutoff
+	}
+	material.DoubleSided = source.DoubleSided
+
+	for _, texture := range []struct {
+		info   *gltfTextureInfo
+		target **Texture
+	}{
+		{pbr.BaseColorTexture, &material.BaseColorTexture},
+		{pbr.MetallicRoughnessTexture, &material.MetallicRoughnessTexture},
+		{source.NormalTexture, &material.NormalTexture},
+		{source.EmissiveTexture, &material.EmissiveTexture},
+	} {
+		if texture.info == nil {
+			continue
+		}
+
+		t, err := p.texture(texture.info.Index, open)
+		if err != nil {
+			return Material{}, err
+		}
+		*texture.target = t
+	}
+
+	return material, nil
+}
+
+func (p *gltfParser) texture(index int, open Opener) (*Texture, error) {
+	if index < 0 || index >= len(p.document.Textures) {
+		return nil, fmt.Errorf("texture %d does not exist", index)
+	}
+	source := p.document.Textures[index].Source
+	if source == nil || *source < 0 || *source >= len(p.document.Images) {
+		return nil, fmt.Errorf("texture %d has no image", index)
+	}
+
+	image := p.document.Images[*source]
+	switch {
+	case image.BufferView != nil:
+		data, _, err := p.bufferView(*image.BufferView)
+		if err != nil {
+			return nil, fmt.Errorf("image %d: %s", *source, err.Error())
+		}
+		return &Texture{Data: data, MimeType: image.MimeType}, nil
+	case strings.HasPrefix(image.URI, "data:"):
+		data, mimeType, err := loadURI(image.URI, open)
+		if err != nil {
+			return nil, fmt.Errorf("image %d: %s", *source, err.Error())
+		}
+		return &Texture{Data: data, MimeType: mimeType}, nil
+	default:
+		// Image files are left to the caller, which may already have them
+		// loaded
+		name, err := url.PathUnescape(image.URI)
+		if err != nil {
+			return nil, fmt.Errorf("image %d: %s", *source, err.Error())
+		}
+		return &Texture{Path: name, MimeType: image.MimeType}, nil
+	}
+}
+
+func (p *gltfParser) nodes(model *Model) error {
+	hasParent := make([]bool, len(p.document.Nodes))
+
+	for i, source := range p.document.Nodes {
+		node := newNode(source.Name, -1)
+		if source.Mesh != nil {
+			if *source.Mesh < 0 || *source.Mesh >= len(model.Meshes) {
+				return fmt.Errorf("node %d: mesh %d does not exist", i, *source.Mesh)
+			}
+			node.Mesh = *source.Mesh
+		}
+
+		for _, child := range source.Children {
+			if child < 0 || child >= len(p.document.Nodes) || hasParent[child] || child == i {
+				return fmt.Errorf("node %d: invalid child %d", i, child)
+			}
+			hasParent[child] = true
+		}
+		node.Children = source.Children
+
+		switch {
+		case len(source.Matrix) == 16:
+			var m math.Mat4
+			copy(m[:], source.Matrix)
+			node.Translation, node.Rotation, node.Scale = m.Decompose()
+		default:
+			if len(source.Translation) == 3 {
+				node.Translation = math.Vec3{X: source.Translation[0], Y: source.Translation[1], Z: source.Translation[2]}
+			}
+			if len(source.Rotation) == 4 {
+				node.Rotation = math.Quat{X: source.Rotation[0], Y: source.Rotation[1], Z: source.Rotation[2], W: source.Rotation[3]}
+			}
+			if len(source.Scale) == 3 {
+				node.Scale = math.Vec3{X: source.Scale[0], Y: source.Scale[1], Z: source.Scale[2]}
+			}
+		}
+
+		model.Nodes = append(model.Nodes, node)
+	}
+
+	// The roots are the nodes of the default scene, or all nodes without a
+	// parent when the file has no scenes
+	scene := 0
+	if p.document.Scene != nil {
+		scene = *p.document.Scene
+	}
+	if scene >= 0 && scene < len(p.document.Scenes) {
+		for _, root := range p.document.Scenes[scene].Nodes {
+			if root < 0 || root >= len(model.Nodes) || hasParent[root] {
+				return fmt.Errorf("scene %d: invalid root node %d", scene, root)
+			}
+		}
+		model.Roots = p.document.Scenes[scene].Nodes
+		return nil
+	}
+
+	for i := range model.Nodes {
+		if !hasParent[i] {
+			model.Roots = append(model.Roots, i)
+		}
+	}
+
+	return nil
+}
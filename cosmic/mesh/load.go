@@ -0,0 +1,54 @@
+package mesh
+
+import (
+	"fmt"
+	"io"
+	stdmath "math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Opener opens a file a model refers to, like a material library or a
+// buffer, by its slash separated path relative to the model.
+type Opener func(name string) (io.ReadCloser, error)
+
+// DirOpener opens files relative to a directory.
+func DirOpener(directory string) Opener {
+	return func(name string) (io.ReadCloser, error) {
+		return os.Open(filepath.Join(directory, filepath.FromSlash(name)))
+	}
+}
+
+// Load loads a model from an OBJ, glTF, binary glTF or binary model file,
+// depending on its extension.
+func Load(path string) (*Model, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	open := DirOpener(filepath.Dir(path))
+
+	var model *Model
+	switch extension := strings.ToLower(filepath.Ext(path)); extension {
+	case ".obj":
+		model, err = ParseOBJ(file, open)
+	case ".gltf", ".glb":
+		model, err = ParseGLTF(file, open)
+	case BinaryExtension:
+		model, err = ParseBinary(file)
+	default:
+		return nil, fmt.Errorf("%s: unsupported model format %s", path, extension)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err.Error())
+	}
+
+	return model, nil
+}
+
+func sqrt(a float32) float32 {
+	return float32(stdmath.Sqrt(float64(a)))
+}
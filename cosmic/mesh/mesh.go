@@ -0,0 +1,162 @@
+// Package mesh loads 3D models from Wavefront OBJ and glTF 2.0 files into
+// engine vertex and index data, and stores them in a binary format that
+// loads without parsing. Parsing is pure Go, only Upload needs a graphics
+// context.
+package mesh
+
+import (
+	"encoding/binary"
+	"github.com/lentus/cosmic-engine/cosmic/graphics"
+	"github.com/lentus/cosmic-engine/cosmic/math"
+	stdmath "math"
+)
+
+// Vertex is the vertex format of loaded meshes. Texture coordinates have
+// their origin in the top left corner of the texture, like Vulkan.
+type Vertex struct {
+	Position math.Vec3
+	Normal   math.Vec3
+	// Tangent points along increasing u, and the bitangent, which is
+	// Normal.Cross(Tangent).Scale(W), along increasing v.
+	Tangent math.Vec4
+	UV      math.Vec2
+	// Linear color with straight alpha, white when the file has no colors.
+	Color [4]float32
+}
+
+// VertexSize is the size in bytes of an encoded Vertex.
+const VertexSize = 64
+
+// Submesh is a range of indices drawn with one material.
+type Submesh struct {
+	FirstIndex int
+	IndexCount int
+	// Index into Model.Materials, -1 for the default material.
+	Material int
+}
+
+type Mesh struct {
+	Name      string
+	Vertices  []Vertex
+	Indices   []uint32
+	Submeshes []Submesh
+}
+
+// Texture refers to an image file relative to the model, or holds the
+// encoded image when it is embedded in the model.
+type Texture struct {
+	Path     string
+	Data     []byte
+	MimeType string
+}
+
+type AlphaMode int
+
+const (
+	AlphaOpaque AlphaMode = iota
+	AlphaMask
+	AlphaBlend
+)
+
+// Material describes a surface with the metallic-roughness model of glTF.
+// Textures are nil when the material has none.
+type Material struct {
+	Name      string
+	BaseColor [4]float32
+	Metallic  float32
+	Roughness float32
+	Emissive  math.Vec3
+
+	BaseColorTexture         *Texture
+	NormalTexture            *Texture
+	MetallicRoughnessTexture *Texture
+	EmissiveTexture          *Texture
+
+	AlphaMode   AlphaMode
+	AlphaCutoff float32
+	DoubleSided bool
+}
+
+// DefaultMaterial is used by submeshes without a material.
+func DefaultMaterial() Material {
+	return Material{
+		Name:        "default",
+		BaseColor:   [4]float32{1, 1, 1, 1},
+		Metallic:    0,
+		Roughness:   1,
+		AlphaCutoff: 0.5,
+	}
+}
+
+// Node places a mesh, or only its children, in the model. Its transform is
+// relative to its parent.
+type Node struct {
+	Name string
+	// Index into Model.Meshes, -1 for nodes without a mesh.
+	Mesh     int
+	Children []int
+
+	Translation math.Vec3
+	Rotation    math.Quat
+	Scale       math.Vec3
+}
+
+// Local returns the transform of the node relative to its parent.
+func (n Node) Local() math.Mat4 {
+	return math.TRS(n.Translation, n.Rotation, n.Scale)
+}
+
+func newNode(name string, mesh int) Node {
+	return Node{
+		Name:     name,
+		Mesh:     mesh,
+		Rotation: math.IdentityQuat(),
+		Scale:    math.Vec3{X: 1, Y: 1, Z: 1},
+	}
+}
+
+type Model struct {
+	Meshes    []Mesh
+	Materials []Material
+	Nodes     []Node
+	// Roots are the indices of the nodes without a parent.
+	Roots []int
+}
+
+// Bounds returns the box containing all vertices of the mesh.
+func (m *Mesh) Bounds() math.AABB {
+	bounds := math.EmptyAABB()
+	for _, v := range m.Vertices {
+		bounds = bounds.Extend(v.Position)
+	}
+
+	return bounds
+}
+
+// Encode returns the vertices in the layout of Vertex, little endian and
+// tightly packed, as vertex buffers expect them.
+func (m *Mesh) Encode() []byte {
+	data := make([]byte, len(m.Vertices)*VertexSize)
+	for i, v := range m.Vertices {
+		putFloats(data[i*VertexSize:],
+			v.Position.X, v.Position.Y, v.Position.Z,
+			v.Normal.X, v.Normal.Y, v.Normal.Z,
+			v.Tangent.X, v.Tangent.Y, v.Tangent.Z, v.Tangent.W,
+			v.UV.X, v.UV.Y,
+			v.Color[0], v.Color[1], v.Color[2], v.Color[3],
+		)
+	}
+
+	return data
+}
+
+func putFloats(data []byte, values ...float32) {
+	for i, value := range values {
+		binary.LittleEndian.PutUint32(data[i*4:], stdmath.Float32bits(value))
+	}
+}
+
+// Upload copies the mesh to gpu memory.
+func (m *Mesh) Upload(uploader graphics.MeshUploader) graphics.MeshBuffers {
+	return uploader.UploadMesh(m.Encode(), VertexSize, m.Indices)
+}
@@ -0,0 +1,379 @@
+package mesh
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/lentus/cosmic-engine/cosmic/math"
+	stdmath "math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func near(a, b float32) bool {
+	return stdmath.Abs(float64(a-b)) < 1e-4
+}
+
+func nearVec3(a, b math.Vec3) bool {
+	return near(a.X, b.X) && near(a.Y, b.Y) && near(a.Z, b.Z)
+}
+
+func TestLoad_obj(t *testing.T) {
+	model, err := Load("testdata/quad.obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(model.Meshes) != 1 || len(model.Nodes) != 1 || len(model.Roots) != 1 {
+		t.Fatalf("expected 1 mesh, node and root, got %d, %d and %d", len(model.Meshes), len(model.Nodes), len(model.Roots))
+	}
+	m := model.Meshes[0]
+	if m.Name != "Quad" || model.Nodes[0].Name != "Quad" || model.Nodes[0].Mesh != 0 {
+		t.Errorf("unexpected mesh %q and node %+v", m.Name, model.Nodes[0])
+	}
+	// The vertices shared by both triangles are not duplicated
+	if len(m.Vertices) != 4 || len(m.Indices) != 6 {
+		t.Fatalf("expected 4 vertices and 6 indices, got %d and %d", len(m.Vertices), len(m.Indices))
+	}
+
+	expected := []Submesh{{0, 3, 0}, {3, 3, 1}}
+	if len(m.Submeshes) != 2 || m.Submeshes[0] != expected[0] || m.Submeshes[1] != expected[1] {
+		t.Errorf("expected submeshes %v, got %v", expected, m.Submeshes)
+	}
+
+	red, textured := model.Materials[0], model.Materials[1]
+	if red.Name != "red" || red.BaseColor != [4]float32{1, 0, 0, 1} || red.Roughness != 1 || red.AlphaMode != AlphaOpaque {
+		t.Errorf("unexpected material %+v", red)
+	}
+	if textured.BaseColor[3] != 0.5 || textured.AlphaMode != AlphaBlend || textured.Metallic != 1 {
+		t.Errorf("unexpected material %+v", textured)
+	}
+	if textured.BaseColorTexture == nil || textured.BaseColorTexture.Path != "textures/albedo.png" {
+		t.Errorf("expected texture textures/albedo.png, got %+v", textured.BaseColorTexture)
+	}
+
+	for _, v := range m.Vertices {
+		if !nearVec3(v.Normal, math.Vec3{Z: 1}) {
+			t.Errorf("expected generated normal (0, 0, 1), got %v", v.Normal)
+		}
+		// The v coordinate is flipped, so increasing v points down and the
+		// bitangent is -y
+		if !nearVec3(v.Tangent.XYZ(), math.Vec3{X: 1}) || v.Tangent.W != -1 {
+			t.Errorf("expected tangent (1, 0, 0, -1), got %v", v.Tangent)
+		}
+		if v.Position.X < 0 != (v.UV.X == 0) || v.Position.Y < 0 != (v.UV.Y == 1) {
+			t.Errorf("unexpected uv %v at %v", v.UV, v.Position)
+		}
+	}
+}
+
+func TestParseOBJ_normals(t *testing.T) {
+	source := `
+v 0 0 0
+v 1 0 0
+v 0 1 0
+vn 0 0 -2
+f 1//1 2 3
+`
+	model, err := ParseOBJ(strings.NewReader(source), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := model.Meshes[0]
+	// The given normal is kept and normalized, the others are generated
+	if !nearVec3(m.Vertices[0].Normal, math.Vec3{Z: -1}) {
+		t.Errorf("expected normal (0, 0, -1), got %v", m.Vertices[0].Normal)
+	}
+	if !nearVec3(m.Vertices[1].Normal, math.Vec3{Z: 1}) {
+		t.Errorf("expected normal (0, 0, 1), got %v", m.Vertices[1].Normal)
+	}
+	if m.Submeshes[0].Material != -1 {
+		t.Errorf("expected the default material, got %d", m.Submeshes[0].Material)
+	}
+}
+
+func TestParseOBJ_errors(t *testing.T) {
+	for _, source := range []string{
+		"v 0 0\n",
+		"v 0 0 0\nf 1 2 3\n",
+		"v 0 0 0\nv 0 0 0\nf 1 2\n",
+		"v 0 0 0\nf 1/a 1 1\n",
+	} {
+		if _, err := ParseOBJ(strings.NewReader(source), nil); err == nil {
+			t.Errorf("expected an error for %q", source)
+		}
+	}
+}
+
+// testGLTF returns a glTF document with one triangle, a buffer holding its
+// positions, texture coordinates and indices, and a node hierarchy.
+func testGLTF() (map[string]interface{}, []byte) {
+	var buffer bytes.Buffer
+	for _, f := range []float32{0, 0, 0, 1, 0, 0, 0, 1, 0} {
+		binary.Write(&buffer, binary.LittleEndian, f)
+	}
+	for _, f := range []float32{0, 1, 1, 1, 0, 0} {
+		binary.Write(&buffer, binary.LittleEndian, f)
+	}
+	for _, i := range []uint16{0, 1, 2, 0} {
+		binary.Write(&buffer, binary.LittleEndian, i)
+	}
+
+	document := map[string]interface{}{
+		"asset": map[string]interface{}{"version": "2.0"},
+		"scene": 0,
+		"scenes": []interface{}{
+			map[string]interface{}{"nodes": []int{0}},
+		},
+		"nodes": []interface{}{
+			map[string]interface{}{"name": "root", "children": []int{1}, "translation": []float32{1, 2, 3}},
+			map[string]interface{}{"name": "triangle", "mesh": 0, "matrix": []float32{
+				2, 0, 0, 0,
+				0, 2, 0, 0,
+				0, 0, 2, 0,
+				0, 0, 5, 1,
+			}},
+		},
+		"meshes": []interface{}{
+			map[string]interface{}{"name": "triangle", "primitives": []interface{}{
+				map[string]interface{}{
+					"attributes": map[string]int{"POSITION": 0, "TEXCOORD_0": 1},
+					"indices":    2,
+					"material":   0,
+				},
+			}},
+		},
+		"materials": []interface{}{
+			map[string]interface{}{
+				"name": "plastic",
+				"pbrMetallicRoughness": map[string]interface{}{
+					"baseColorFactor":  []float32{1, 0.5, 0.25, 1},
+					"roughnessFactor":  0.5,
+					"metallicFactor":   0,
+					"baseColorTexture": map[string]int{"index": 0},
+				},
+				"alphaMode":   "MASK",
+				"doubleSided": true,
+			},
+		},
+		"textures": []interface{}{map[string]int{"source": 0}},
+		"images":   []interface{}{map[string]string{"uri": "albedo%20map.png"}},
+		"accessors": []interface{}{
+			map[string]interface{}{"bufferView": 0, "componentType": 5126, "count": 3, "type": "VEC3"},
+			map[string]interface{}{"bufferView": 1, "componentType": 5126, "count": 3, "type": "VEC2"},
+			map[string]interface{}{"bufferView": 2, "componentType": 5123, "count": 3, "type": "SCALAR"},
+		},
+		"bufferViews": []interface{}{
+			map[string]int{"buffer": 0, "byteOffset": 0, "byteLength": 36},
+			map[string]int{"buffer": 0, "byteOffset": 36, "byteLength": 24},
+			map[string]int{"buffer": 0, "byteOffset": 60, "byteLength": 6},
+		},
+		"buffers": []interface{}{
+			map[string]interface{}{"byteLength": buffer.Len()},
+		},
+	}
+
+	return document, buffer.Bytes()
+}
+
+func checkGLTFModel(t *testing.T, model *Model) {
+	t.Helper()
+
+	if len(model.Meshes) != 1 || len(model.Nodes) != 2 || len(model.Roots) != 1 || model.Roots[0] != 0 {
+		t.Fatalf("unexpected model structure %+v", model)
+	}
+
+	m := model.Meshes[0]
+	if len(m.Vertices) != 3 || len(m.Indices) != 3 || len(m.Submeshes) != 1 || m.Submeshes[0].Material != 0 {
+		t.Fatalf("unexpected mesh %+v", m)
+	}
+	if m.Vertices[1].Position != (math.Vec3{X: 1}) || m.Vertices[1].UV != (math.Vec2{X: 1, Y: 1}) {
+		t.Errorf("unexpected vertex %+v", m.Vertices[1])
+	}
+	for _, v := range m.Vertices {
+		if !nearVec3(v.Normal, math.Vec3{Z: 1}) || !nearVec3(v.Tangent.XYZ(), math.Vec3{X: 1}) || v.Tangent.W != -1 {
+			t.Errorf("expected generated normal (0, 0, 1) and tangent (1, 0, 0, -1), got %v and %v", v.Normal, v.Tangent)
+		}
+		if v.Color != [4]float32{1, 1, 1, 1} {
+			t.Errorf("expected white vertex color, got %v", v.Color)
+		}
+	}
+
+	root, child := model.Nodes[0], model.Nodes[1]
+	if root.Mesh != -1 || len(root.Children) != 1 || root.Children[0] != 1 || root.Translation != (math.Vec3{X: 1, Y: 2, Z: 3}) {
+		t.Errorf("unexpected root node %+v", root)
+	}
+	if child.Mesh != 0 || !nearVec3(child.Translation, math.Vec3{Z: 5}) || !nearVec3(child.Scale, math.Vec3{X: 2, Y: 2, Z: 2}) {
+		t.Errorf("unexpected child node %+v", child)
+	}
+
+	material := model.Materials[0]
+	if material.BaseColor != [4]float32{1, 0.5, 0.25, 1} || material.Roughness != 0.5 || material.Metallic != 0 ||
+		material.AlphaMode != AlphaMask || !material.DoubleSided {
+		t.Errorf("unexpected material %+v", material)
+	}
+	if material.BaseColorTexture == nil || material.BaseColorTexture.Path != "albedo map.png" {
+		t.Errorf("expected texture albedo map.png, got %+v", material.BaseColorTexture)
+	}
+}
+
+func TestParseGLTF_embedded(t *testing.T) {
+	document, buffer := testGLTF()
+	document["buffers"].([]interface{})[0].(map[string]interface{})["uri"] =
+		"data:application/octet-stream;base64," + base64.StdEncoding.EncodeToString(buffer)
+
+	source, err := json.Marshal(document)
+	if err != nil {
+		t.Fatal(err)
+	}
+	model, err := ParseGLTF(bytes.NewReader(source), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkGLTFModel(t, model)
+}
+
+func TestParseGLTF_binary(t *testing.T) {
+	document, buffer := testGLTF()
+	source, err := json.Marshal(document)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pad := func(data []byte, padding byte) []byte {
+		for len(data)%4 != 0 {
+			data = append(data, padding)
+		}
+		return data
+	}
+	source, buffer = pad(source, ' '), pad(buffer, 0)
+
+	var glb bytes.Buffer
+	for _, value := range []uint32{glbMagic, 2, uint32(12 + 8 + len(source) + 8 + len(buffer))} {
+		binary.Write(&glb, binary.LittleEndian, value)
+	}
+	binary.Write(&glb, binary.LittleEndian, []uint32{uint32(len(source)), glbChunkJSON})
+	glb.Write(source)
+	binary.Write(&glb, binary.LittleEndian, []uint32{uint32(len(buffer)), glbChunkBIN})
+	glb.Write(buffer)
+
+	model, err := ParseGLTF(&glb, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkGLTFModel(t, model)
+}
+
+func TestParseGLTF_errors(t *testing.T) {
+	for _, modify := range []func(document map[string]interface{}){
+		func(document map[string]interface{}) {
+			document["asset"] = map[string]string{"version": "1.0"}
+		},
+		func(document map[string]interface{}) {
+			document["extensionsRequired"] = []string{"KHR_draco_mesh_compression"}
+		},
+		func(document map[string]interface{}) {
+			// The indices are read past the end of their buffer view
+			document["accessors"].([]interface{})[2].(map[string]interface{})["count"] = 4
+		},
+		func(document map[string]interface{}) {
+			document["nodes"].([]interface{})[1].(map[string]interface{})["children"] = []int{0}
+		},
+	} {
+		document, buffer := testGLTF()
+		document["buffers"].([]interface{})[0].(map[string]interface{})["uri"] =
+			"data:application/octet-stream;base64," + base64.StdEncoding.EncodeToString(buffer)
+		modify(document)
+
+		source, err := json.Marshal(document)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ParseGLTF(bytes.NewReader(source), nil); err == nil {
+			t.Errorf("expected an error for %s", source)
+		}
+	}
+}
+
+func TestTriangleList(t *testing.T) {
+	strip := triangleList([]uint32{0, 1, 2, 3, 4}, gltfModeTriangleStrip)
+	expected := []uint32{0, 1, 2, 2, 1, 3, 2, 3, 4}
+	if len(strip) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, strip)
+	}
+	for i := range expected {
+		if strip[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, strip)
+		}
+	}
+
+	fan := triangleList([]uint32{0, 1, 2, 3}, gltfModeTriangleFan)
+	expected = []uint32{0, 1, 2, 0, 2, 3}
+	for i := range expected {
+		if len(fan) != len(expected) || fan[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, fan)
+		}
+	}
+}
+
+func TestMesh_Encode(t *testing.T) {
+	m := Mesh{Vertices: []Vertex{{}, {
+		Position: math.Vec3{X: 1, Y: 2, Z: 3},
+		Color:    [4]float32{0.25, 0.5, 0.75, 1},
+	}}}
+
+	data := m.Encode()
+	if len(data) != 2*VertexSize {
+		t.Fatalf("expected %d bytes, got %d", 2*VertexSize, len(data))
+	}
+	float := func(offset int) float32 {
+		return stdmath.Float32frombits(binary.LittleEndian.Uint32(data[offset:]))
+	}
+	if float(VertexSize+4) != 2 || float(2*VertexSize-4) != 1 || float(2*VertexSize-12) != 0.5 {
+		t.Errorf("unexpected encoding %v", data[VertexSize:])
+	}
+}
+
+func TestWriteBinary(t *testing.T) {
+	document, buffer := testGLTF()
+	document["buffers"].([]interface{})[0].(map[string]interface{})["uri"] =
+		"data:application/octet-stream;base64," + base64.StdEncoding.EncodeToString(buffer)
+	source, _ := json.Marshal(document)
+	gltf, err := ParseGLTF(bytes.NewReader(source), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj, err := Load("testdata/quad.obj")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, model := range []*Model{gltf, obj} {
+		var encoded bytes.Buffer
+		if err := WriteBinary(&encoded, model); err != nil {
+			t.Fatal(err)
+		}
+		data := encoded.Bytes()
+
+		decoded, err := ParseBinary(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(decoded, model) {
+			t.Errorf("expected the model to be unchanged, got %+v instead of %+v", decoded, model)
+		}
+
+		if _, err := ParseBinary(bytes.NewReader(data[:len(data)-3])); err == nil {
+			t.Errorf("expected an error for a truncated model")
+		}
+	}
+
+	if _, err := ParseBinary(strings.NewReader("v 0 0 0\n")); err == nil {
+		t.Errorf("expected an error for a model in another format")
+	}
+}
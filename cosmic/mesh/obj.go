@@ -0,0 +1,424 @@
+package mesh
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/lentus/cosmic-engine/cosmic/math"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// objIndex refers to the position, texture coordinate and normal of a face
+// vertex, 0 when the face does not have one.
+type objIndex struct {
+	position, uv, normal int
+}
+
+// objParser builds a model from the statements of an OBJ file. Every object
+// becomes a mesh with a node, and every material used in an object a
+// submesh.
+type objParser struct {
+	open Opener
+
+	positions []math.Vec3
+	colors    [][4]float32
+	uvs       []math.Vec2
+	normals   []math.Vec3
+
+	model     *Model
+	materials map[string]int
+
+	mesh          *Mesh
+	vertices      map[objIndex]uint32
+	hasNormal     []bool
+	material      int
+	submeshStart  int
+	objectName    string
+	objectStarted bool
+}
+
+// ParseOBJ parses a Wavefront OBJ model. Material libraries are opened with
+// open, by their path relative to the model. Texture paths of materials are
+// relative to the model as well.
+func ParseOBJ(r io.Reader, open Opener) (*Model, error) {
+	p := &objParser{
+		open:      open,
+		model:     &Model{},
+		materials: make(map[string]int),
+		material:  -1,
+	}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		if err := p.parseLine(scanner.Text()); err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err.Error())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	p.finishObject()
+
+	return p.model, nil
+}
+
+func (p *objParser) parseLine(line string) error {
+	if i := strings.IndexByte(line, '#'); i >= 0 {
+		line = line[:i]
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	keyword, args := fields[0], fields[1:]
+	switch keyword {
+	case "v":
+		values, err := parseFloats(args, 3, 7)
+		if err != nil {
+			return err
+		}
+		p.positions = append(p.positions, math.Vec3{X: values[0], Y: values[1], Z: values[2]})
+
+		// A common extension appends a color to the position, instead of
+		// the rarely used w
+		color := [4]float32{1, 1, 1, 1}
+		if len(values) >= 6 {
+			copy(color[:3], values[3:6])
+		}
+		p.colors = append(p.colors, color)
+	case "vt":
+		values, err := parseFloats(args, 1, 3)
+		if err != nil {
+			return err
+		}
+		values = append(values, 0)
+		// OBJ texture coordinates start at the bottom left
+		p.uvs = append(p.uvs, math.Vec2{X: values[0], Y: 1 - values[1]})
+	case "vn":
+		values, err := parseFloats(args, 3, 3)
+		if err != nil {
+			return err
+		}
+		p.normals = append(p.normals, math.Vec3{X: values[0], Y: values[1], Z: values[2]}.Normalize())
+	case "f":
+		return p.parseFace(args)
+	case "o":
+		p.finishObject()
+		p.objectName = strings.Join(args, " ")
+	case "usemtl":
+		p.useMaterial(strings.Join(args, " "))
+	case "mtllib":
+		for _, name := range args {
+			if err := p.loadMaterials(name); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Groups, smoothing groups, lines and other statements do not affect
+	// the triangles of the model
+	return nil
+}
+
+func (p *objParser) parseFace(args []string) error {
+	if len(args) < 3 {
+		return fmt.Errorf("face with %d vertices", len(args))
+	}
+	p.startObject()
+
+	indices := make([]uint32, len(args))
+	for i, arg := range args {
+		index, err := p.parseFaceVertex(arg)
+		if err != nil {
+			return err
+		}
+		indices[i] = p.vertex(index)
+	}
+
+	// Polygons are assumed to be convex, and split into a fan
+	for i := 1; i+1 < len(indices); i++ {
+		p.mesh.Indices = append(p.mesh.Indices, indices[0], indices[i], indices[i+1])
+	}
+
+	return nil
+}
+
+func (p *objParser) parseFaceVertex(arg string) (objIndex, error) {
+	parts := strings.Split(arg, "/")
+	if len(parts) > 3 {
+		return objIndex{}, fmt.Errorf("invalid face vertex %q", arg)
+	}
+
+	var index objIndex
+	targets := []*int{&index.position, &index.uv, &index.normal}
+	counts := []int{len(p.positions), len(p.uvs), len(p.normals)}
+	for i, part := range parts {
+		if part == "" {
+			if i == 0 {
+				return objIndex{}, fmt.Errorf("face vertex %q has no position", arg)
+			}
+			continue
+		}
+
+		value, err := strconv.Atoi(part)
+		if err != nil {
+			return objIndex{}, fmt.Errorf("invalid face vertex %q", arg)
+		}
+		// Negative indices count back from the last element
+		if value < 0 {
+			value += counts[i] + 1
+		}
+		if value <= 0 || value > counts[i] {
+			return objIndex{}, fmt.Errorf("face vertex %q refers to an element that does not exist", arg)
+		}
+		*targets[i] = value
+	}
+
+	return index, nil
+}
+
+// vertex returns the index of the vertex in the current mesh, adding it when
+// the mesh does not have it yet.
+func (p *objParser) vertex(index objIndex) uint32 {
+	if i, ok := p.vertices[index]; ok {
+		return i
+	}
+
+	v := Vertex{
+		Position: p.positions[index.position-1],
+		Color:    p.colors[index.position-1],
+	}
+	if index.uv > 0 {
+		v.UV = p.uvs[index.uv-1]
+	}
+	if index.normal > 0 {
+		v.Normal = p.normals[index.normal-1]
+	}
+
+	i := uint32(len(p.mesh.Vertices))
+	p.mesh.Vertices = append(p.mesh.Vertices, v)
+	p.hasNormal = append(p.hasNormal, index.normal > 0)
+	p.vertices[index] = i
+
+	return i
+}
+
+func (p *objParser) startObject() {
+	if p.objectStarted {
+		return
+	}
+
+	p.objectStarted = true
+	p.mesh = &Mesh{Name: p.objectName}
+	p.vertices = make(map[objIndex]uint32)
+	p.hasNormal = p.hasNormal[:0]
+	p.submeshStart = 0
+}
+
+// finishObject adds the current object to the model, generating the
+// normals and tangents OBJ files do not provide.
+func (p *objParser) finishObject() {
+	if !p.objectStarted {
+		return
+	}
+	p.objectStarted = false
+	p.finishSubmesh()
+
+	mesh := p.mesh
+	if len(mesh.Indices) == 0 {
+		return
+	}
+
+	given := make([]math.Vec3, len(mesh.Vertices))
+	for i, v := range mesh.Vertices {
+		given[i] = v.Normal
+	}
+	mesh.GenerateNormals()
+	for i, hasNormal := range p.hasNormal {
+		if hasNormal {
+			mesh.Vertices[i].Normal = given[i]
+		}
+	}
+	mesh.GenerateTangents()
+
+	name := mesh.Name
+	p.model.Meshes = append(p.model.Meshes, *mesh)
+	p.model.Roots = append(p.model.Roots, len(p.model.Nodes))
+	p.model.Nodes = append(p.model.Nodes, newNode(name, len(p.model.Meshes)-1))
+}
+
+func (p *objParser) finishSubmesh() {
+	count := len(p.mesh.Indices) - p.submeshStart
+	if count > 0 {
+		p.mesh.Submeshes = append(p.mesh.Submeshes, Submesh{
+			FirstIndex: p.submeshStart,
+			IndexCount: count,
+			Material:   p.material,
+		})
+	}
+	p.submeshStart = len(p.mesh.Indices)
+}
+
+func (p *objParser) useMaterial(name string) {
+	if p.objectStarted {
+		p.finishSubmesh()
+	}
+
+	material, ok := p.materials[name]
+	if !ok {
+		// Materials missing from the libraries keep their name, so they can
+		// still be told apart
+		defaultMaterial := DefaultMaterial()
+		defaultMaterial.Name = name
+
+		material = len(p.model.Materials)
+		p.model.Materials = append(p.model.Materials, defaultMaterial)
+		p.materials[name] = material
+	}
+	p.material = material
+}
+
+func (p *objParser) loadMaterials(name string) error {
+	file, err := p.open(name)
+	if err != nil {
+		return fmt.Errorf("material library %s: %s", name, err.Error())
+	}
+	defer file.Close()
+
+	materials, err := parseMTL(file, path.Dir(name))
+	if err != nil {
+		return fmt.Errorf("material library %s: %s", name, err.Error())
+	}
+
+	for _, material := range materials {
+		p.materials[material.Name] = len(p.model.Materials)
+		p.model.Materials = append(p.model.Materials, material)
+	}
+
+	return nil
+}
+
+// parseMTL parses a material library. The Phong parameters of the format are
+// converted to the metallic-roughness model, and the physically based
+// extension of the format is used when present.
+func parseMTL(r io.Reader, directory string) ([]Material, error) {
+	var materials []Material
+	var current *Material
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+
+		keyword, args := fields[0], fields[1:]
+		if keyword == "newmtl" {
+			materials = append(materials, DefaultMaterial())
+			current = &materials[len(materials)-1]
+			current.Name = strings.Join(args, " ")
+			continue
+		}
+		if current == nil {
+			return nil, fmt.Errorf("line %d: %s before newmtl", line, keyword)
+		}
+
+		var err error
+		switch keyword {
+		case "Kd":
+			var values []float32
+			if values, err = parseFloats(args, 3, 3); err == nil {
+				copy(current.BaseColor[:3], values)
+			}
+		case "d":
+			var values []float32
+			if values, err = parseFloats(args, 1, 1); err == nil {
+				current.BaseColor[3] = values[0]
+			}
+		case "Tr":
+			var values []float32
+			if values, err = parseFloats(args, 1, 1); err == nil {
+				current.BaseColor[3] = 1 - values[0]
+			}
+		case "Ns":
+			var values []float32
+			if values, err = parseFloats(args, 1, 1); err == nil {
+				// Blinn-Phong exponents map to roughness by 2/(Ns+2) = a^2
+				current.Roughness = sqrt(2 / (values[0] + 2))
+			}
+		case "Pr":
+			var values []float32
+			if values, err = parseFloats(args, 1, 1); err == nil {
+				current.Roughness = values[0]
+			}
+		case "Pm":
+			var values []float32
+			if values, err = parseFloats(args, 1, 1); err == nil {
+				current.Metallic = values[0]
+			}
+		case "Ke":
+			var values []float32
+			if values, err = parseFloats(args, 3, 3); err == nil {
+				current.Emissive = math.Vec3{X: values[0], Y: values[1], Z: values[2]}
+			}
+		case "map_Kd":
+			current.BaseColorTexture = mtlTexture(args, directory)
+		case "map_Bump", "map_bump", "bump", "norm":
+			current.NormalTexture = mtlTexture(args, directory)
+		case "map_Ke":
+			current.EmissiveTexture = mtlTexture(args, directory)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err.Error())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range materials {
+		if materials[i].BaseColor[3] < 1 {
+			materials[i].AlphaMode = AlphaBlend
+		}
+	}
+
+	return materials, nil
+}
+
+// mtlTexture returns the texture of a map statement, whose file name follows
+// its options.
+func mtlTexture(args []string, directory string) *Texture {
+	if len(args) == 0 {
+		return nil
+	}
+
+	name := strings.ReplaceAll(args[len(args)-1], "\\", "/")
+	return &Texture{Path: path.Join(directory, name)}
+}
+
+func parseFloats(args []string, min, max int) ([]float32, error) {
+	if len(args) < min || len(args) > max {
+		if min == max {
+			return nil, fmt.Errorf("expected %d values, got %d", min, len(args))
+		}
+		return nil, fmt.Errorf("expected %d to %d values, got %d", min, max, len(args))
+	}
+
+	values := make([]float32, len(args))
+	for i, arg := range args {
+		value, err := strconv.ParseFloat(arg, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", arg)
+		}
+		values[i] = float32(value)
+	}
+
+	return values, nil
+}
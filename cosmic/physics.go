@@ -0,0 +1,25 @@
+package cosmic
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/event"
+	"github.com/lentus/cosmic-engine/cosmic/physics2d"
+)
+
+// Physics returns the 2D physics world of the application, which steps at
+// every tick after the layers received the AppTick event. Its collision and
+// trigger events are passed down the layer stack.
+func (app *Application) Physics() *physics2d.World {
+	if app.physics == nil {
+		app.physics = physics2d.NewWorld(physics2d.Options{Events: app.onEvent})
+	}
+
+	return app.physics
+}
+
+// tick simulates the game by a tick.
+func (app *Application) tick(delta float32) {
+	app.onEvent(&event.AppTick{Delta: delta})
+	if app.physics != nil {
+		app.physics.Step(delta)
+	}
+}
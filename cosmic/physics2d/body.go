@@ -0,0 +1,251 @@
+package physics2d
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/math"
+	stdmath "math"
+)
+
+type BodyType int
+
+const (
+	// BodyStatic never moves, like the ground.
+	BodyStatic BodyType = iota
+	// BodyKinematic moves with its velocity, set by the game, and pushes
+	// dynamic bodies without being pushed back, like a moving platform.
+	BodyKinematic
+	// BodyDynamic is moved by forces and collisions.
+	BodyDynamic
+)
+
+// Body is a rigid body in a world. Its position, angle and velocities can be
+// set by the game between steps.
+type Body struct {
+	// Position of the origin of the body, which its shapes are relative to
+	Position math.Vec2
+	// Angle in radians, counter-clockwise
+	Angle float32
+	// Velocity of the center of mass, in units per second
+	LinearVelocity math.Vec2
+	// Velocity of the rotation, in radians per second
+	AngularVelocity float32
+
+	// Damping slows the body down, from 0 for none.
+	LinearDamping  float32
+	AngularDamping float32
+	// Scales the gravity of the world for the body, 1 by default.
+	GravityScale float32
+	// Keeps dynamic bodies from rotating, like characters.
+	FixedRotation bool
+
+	UserData interface{}
+
+	kind   BodyType
+	world  *World
+	shapes []*Shape
+
+	mass, invMass       float32
+	inertia, invInertia float32
+	// Center of mass relative to the origin of the body
+	localCenter math.Vec2
+
+	force  math.Vec2
+	torque float32
+	// Center of mass in the world during a step
+	center math.Vec2
+}
+
+func (b *Body) Type() BodyType {
+	return b.kind
+}
+
+func (b *Body) Shapes() []*Shape {
+	return b.shapes
+}
+
+// Mass returns the mass of the body, 0 unless it is dynamic.
+func (b *Body) Mass() float32 {
+	return b.mass
+}
+
+// Inertia returns the rotational inertia of the body around its center of
+// mass, 0 unless it is dynamic.
+func (b *Body) Inertia() float32 {
+	return b.inertia
+}
+
+// WorldCenter returns the center of mass of the body in the world.
+func (b *Body) WorldCenter() math.Vec2 {
+	return b.transform().apply(b.localCenter)
+}
+
+// WorldPoint returns a point relative to the body in the world.
+func (b *Body) WorldPoint(local math.Vec2) math.Vec2 {
+	return b.transform().apply(local)
+}
+
+// LocalPoint returns a point of the world relative to the body.
+func (b *Body) LocalPoint(world math.Vec2) math.Vec2 {
+	t := b.transform()
+	return t.unrotate(world.Sub(t.position))
+}
+
+// AddShape adds a shape to the body, updating its mass.
+func (b *Body) AddShape(s *Shape) {
+	s.body = b
+	s.id = b.world.nextShape
+	b.world.nextShape++
+	b.shapes = append(b.shapes, s)
+	s.place(b.transform())
+	b.world.broadphase.add(s)
+	b.updateMass()
+}
+
+// RemoveShape removes a shape from the body, ending its contacts.
+func (b *Body) RemoveShape(s *Shape) {
+	for i, other := range b.shapes {
+		if other == s {
+			b.shapes = append(b.shapes[:i], b.shapes[i+1:]...)
+			b.world.broadphase.remove(s)
+			b.world.removeContacts(func(a, b *Shape) bool { return a == s || b == s })
+			s.body = nil
+			b.updateMass()
+			return
+		}
+	}
+}
+
+// ApplyForce applies a force at a point in the world until the next step,
+// which also turns the body when it is off its center of mass.
+func (b *Body) ApplyForce(force, point math.Vec2) {
+	if b.kind != BodyDynamic {
+		return
+	}
+	b.force = b.force.Add(force)
+	b.torque += cross(point.Sub(b.WorldCenter()), force)
+}
+
+// ApplyForceToCenter applies a force to the center of mass until the next
+// step.
+func (b *Body) ApplyForceToCenter(force math.Vec2) {
+	if b.kind == BodyDynamic {
+		b.force = b.force.Add(force)
+	}
+}
+
+// ApplyTorque applies a torque until the next step.
+func (b *Body) ApplyTorque(torque float32) {
+	if b.kind == BodyDynamic {
+		b.torque += torque
+	}
+}
+
+// ApplyLinearImpulse changes the velocity of the body at once, like a hit
+// at a point in the world.
+func (b *Body) ApplyLinearImpulse(impulse, point math.Vec2) {
+	if b.kind != BodyDynamic {
+		return
+	}
+	b.LinearVelocity = b.LinearVelocity.Add(impulse.Scale(b.invMass))
+	b.AngularVelocity += b.inverseInertia() * cross(point.Sub(b.WorldCenter()), impulse)
+}
+
+// ApplyAngularImpulse changes the angular velocity of the body at once.
+func (b *Body) ApplyAngularImpulse(impulse float32) {
+	if b.kind == BodyDynamic {
+		b.AngularVelocity += b.inverseInertia() * impulse
+	}
+}
+
+// updateMass sums the mass of the shapes of dynamic bodies. Dynamic bodies
+// without area weigh 1.
+func (b *Body) updateMass() {
+	b.mass, b.invMass, b.inertia, b.invInertia = 0, 0, 0, 0
+	b.localCenter = math.Vec2{}
+	if b.kind != BodyDynamic {
+		return
+	}
+
+	var center math.Vec2
+	var inertia float32
+	for _, s := range b.shapes {
+		if s.Sensor {
+			continue
+		}
+		mass, c, i := s.massData()
+		b.mass += mass
+		center = center.Add(c.Scale(mass))
+		inertia += i
+	}
+
+	if b.mass <= 0 {
+		b.mass, b.invMass = 1, 1
+		return
+	}
+	b.invMass = 1 / b.mass
+	b.localCenter = center.Scale(b.invMass)
+	// Move the inertia from the origin to the center of mass
+	b.inertia = inertia - b.mass*b.localCenter.Dot(b.localCenter)
+	if b.inertia > 0 {
+		b.invInertia = 1 / b.inertia
+	}
+}
+
+// inverseInertia returns the inverse inertia the solver uses, 0 for bodies
+// that do not rotate.
+func (b *Body) inverseInertia() float32 {
+	if b.FixedRotation {
+		return 0
+	}
+	return b.invInertia
+}
+
+// transform returns the position and rotation of the body.
+func (b *Body) transform() transform {
+	return newTransform(b.Position, b.Angle)
+}
+
+// transform is a position and rotation.
+type transform struct {
+	position math.Vec2
+	cos, sin float32
+}
+
+func newTransform(position math.Vec2, angle float32) transform {
+	sin, cos := stdmath.Sincos(float64(angle))
+	return transform{position: position, cos: float32(cos), sin: float32(sin)}
+}
+
+func (t transform) rotate(v math.Vec2) math.Vec2 {
+	return math.Vec2{X: t.cos*v.X - t.sin*v.Y, Y: t.sin*v.X + t.cos*v.Y}
+}
+
+func (t transform) unrotate(v math.Vec2) math.Vec2 {
+	return math.Vec2{X: t.cos*v.X + t.sin*v.Y, Y: -t.sin*v.X + t.cos*v.Y}
+}
+
+func (t transform) apply(v math.Vec2) math.Vec2 {
+	return t.rotate(v).Add(t.position)
+}
+
+// AABB is an axis aligned box in the world.
+type AABB struct {
+	Min, Max math.Vec2
+}
+
+func emptyAABB() AABB {
+	inf := float32(stdmath.Inf(1))
+	return AABB{Min: math.Vec2{X: inf, Y: inf}, Max: math.Vec2{X: -inf, Y: -inf}}
+}
+
+func (a AABB) extend(p math.Vec2) AABB {
+	return AABB{Min: a.Min.Min(p), Max: a.Max.Max(p)}
+}
+
+// Overlaps returns whether the boxes overlap or touch.
+func (a AABB) Overlaps(b AABB) bool {
+	return a.Min.X <= b.Max.X && b.Min.X <= a.Max.X && a.Min.Y <= b.Max.Y && b.Min.Y <= a.Max.Y
+}
+
+func (a AABB) Contains(p math.Vec2) bool {
+	return p.X >= a.Min.X && p.X <= a.Max.X && p.Y >= a.Min.Y && p.Y <= a.Max.Y
+}
@@ -0,0 +1,58 @@
+package physics2d
+
+// broadphase finds the shapes whose bounds overlap with sweep and prune: the
+// shapes are kept sorted by the left side of their bounds, so only those
+// starting before a shape ends can overlap it. As bodies move little between
+// steps, sorting again is close to linear.
+type broadphase struct {
+	shapes []*Shape
+}
+
+func (bp *broadphase) add(s *Shape) {
+	bp.shapes = append(bp.shapes, s)
+}
+
+func (bp *broadphase) remove(s *Shape) {
+	for i, other := range bp.shapes {
+		if other == s {
+			bp.shapes = append(bp.shapes[:i], bp.shapes[i+1:]...)
+			return
+		}
+	}
+}
+
+// sort sorts the shapes after they moved, with an insertion sort.
+func (bp *broadphase) sort() {
+	for i := 1; i < len(bp.shapes); i++ {
+		for j := i; j > 0 && bp.shapes[j].bounds.Min.X < bp.shapes[j-1].bounds.Min.X; j-- {
+			bp.shapes[j], bp.shapes[j-1] = bp.shapes[j-1], bp.shapes[j]
+		}
+	}
+}
+
+// pairs calls a function with every pair of shapes whose bounds overlap.
+func (bp *broadphase) pairs(f func(a, b *Shape)) {
+	for i, a := range bp.shapes {
+		for _, b := range bp.shapes[i+1:] {
+			if b.bounds.Min.X > a.bounds.Max.X {
+				break
+			}
+			if a.bounds.Min.Y <= b.bounds.Max.Y && b.bounds.Min.Y <= a.bounds.Max.Y {
+				f(a, b)
+			}
+		}
+	}
+}
+
+// query calls a function with the shapes whose bounds overlap a box, until
+// it returns false.
+func (bp *broadphase) query(box AABB, f func(s *Shape) bool) {
+	for _, s := range bp.shapes {
+		if s.bounds.Min.X > box.Max.X {
+			return
+		}
+		if s.bounds.Overlaps(box) && !f(s) {
+			return
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package physics2d
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/math"
+	stdmath "math"
+)
+
+// manifold is where two shapes touch, with a normal pointing from the first
+// shape to the second and up to two points.
+type manifold struct {
+	normal math.Vec2
+	points [2]manifoldPoint
+	count  int
+}
+
+type manifoldPoint struct {
+	// Point halfway between the surfaces, and their distance, negative when
+	// they overlap
+	point      math.Vec2
+	separation float32
+	// Features of the shapes the point comes from, to match it between steps
+	id uint32
+}
+
+// collide returns the manifold of two circles or polygons placed in the
+// world, chain segments being polygons of two vertices.
+func collide(a, b *Shape) manifold {
+	switch {
+	case a.kind == ShapeCircle && b.kind == ShapeCircle:
+		return collideCircles(a, b)
+	case a.kind == ShapeCircle:
+		m := collidePolygonCircle(b, a)
+		m.normal = m.normal.Neg()
+		return m
+	case b.kind == ShapeCircle:
+		return collidePolygonCircle(a, b)
+	}
+	return collidePolygons(a, b)
+}
+
+func collideCircles(a, b *Shape) manifold {
+	offset := b.worldCenter.Sub(a.worldCenter)
+	distance := offset.Len()
+	if distance > a.radius+b.radius {
+		return manifold{}
+	}
+
+	normal := math.Vec2{Y: 1}
+	if distance > epsilon {
+		normal = offset.Scale(1 / distance)
+	}
+	surfaceA := a.worldCenter.Add(normal.Scale(a.radius))
+	surfaceB := b.worldCenter.Sub(normal.Scale(b.radius))
+	m := manifold{normal: normal, count: 1}
+	m.points[0] = manifoldPoint{point: surfaceA.Lerp(surfaceB, 0.5), separation: distance - a.radius - b.radius}
+	return m
+}
+
+// collidePolygonCircle returns the manifold of a polygon and a circle, with
+// the normal pointing to the circle.
+func collidePolygonCircle(p, c *Shape) manifold {
+	center := c.worldCenter
+	separation := float32(stdmath.Inf(-1))
+	face := 0
+	for i, n := range p.worldNormals {
+		s := n.Dot(center.Sub(p.worldVertices[i]))
+		if s > c.radius {
+			return manifold{}
+		}
+		if s > separation {
+			separation, face = s, i
+		}
+	}
+
+	v1 := p.worldVertices[face]
+	v2 := p.worldVertices[(face+1)%len(p.worldVertices)]
+	normal := p.worldNormals[face]
+	closest := center.Sub(normal.Scale(separation))
+	id := uint32(face)
+	vertex := false
+	if separation >= epsilon {
+		// Outside the polygon the circle may be nearest to a vertex
+		if center.Sub(v1).Dot(v2.Sub(v1)) <= 0 {
+			closest, id, vertex = v1, uint32(face)|1<<8, true
+		} else if center.Sub(v2).Dot(v1.Sub(v2)) <= 0 {
+			closest, id, vertex = v2, uint32((face+1)%len(p.worldVertices))|1<<8, true
+		}
+	}
+	if vertex {
+		offset := center.Sub(closest)
+		distance := offset.Len()
+		if distance > c.radius {
+			return manifold{}
+		}
+		normal, separation = offset.Scale(1/distance), distance
+	}
+
+	m := manifold{normal: normal, count: 1}
+	surface := center.Sub(normal.Scale(c.radius))
+	m.points[0] = manifoldPoint{point: closest.Lerp(surface, 0.5), separation: separation - c.radius, id: id}
+	return m
+}
+
+// collidePolygons returns the manifold of two polygons with the separating
+// axis test, clipping the edge of one polygon against the face of the other
+// that separates them most.
+func collidePolygons(a, b *Shape) manifold {
+	separationA, edgeA := maxSeparation(a, b)
+	if separationA > 0 {
+		return manifold{}
+	}
+	separationB, edgeB := maxSeparation(b, a)
+	if separationB > 0 {
+		return manifold{}
+	}
+
+	// Prefer the first polygon as reference, so the manifold does not flip
+	// between steps
+	reference, incident, edge, flip := a, b, edgeA, uint32(0)
+	if separationB > separationA+0.1*linearSlop {
+		reference, incident, edge, flip = b, a, edgeB, 1
+	}
+
+	normal := reference.worldNormals[edge]
+	incidentEdge, lowest := 0, float32(stdmath.Inf(1))
+	for i, n := range incident.worldNormals {
+		if d := n.Dot(normal); d < lowest {
+			incidentEdge, lowest = i, d
+		}
+	}
+
+	v1 := reference.worldVertices[edge]
+	v2 := reference.worldVertices[(edge+1)%len(reference.worldVertices)]
+	tangent := v2.Sub(v1).Normalize()
+	points := [2]math.Vec2{
+		incident.worldVertices[incidentEdge],
+		incident.worldVertices[(incidentEdge+1)%len(incident.worldVertices)],
+	}
+
+	// Clip the incident edge to the sides of the reference face
+	count := 0
+	if points, count = clipSegment(points, tangent.Neg(), -tangent.Dot(v1)); count < 2 {
+		return manifold{}
+	}
+	if points, count = clipSegment(points, tangent, tangent.Dot(v2)); count < 2 {
+		return manifold{}
+	}
+
+	m := manifold{normal: normal}
+	if flip == 1 {
+		m.normal = normal.Neg()
+	}
+	for i, p := range points {
+		separation := normal.Dot(p.Sub(v1))
+		if separation > 0 {
+			continue
+		}
+		m.points[m.count] = manifoldPoint{
+			point:      p.Sub(normal.Scale(separation / 2)),
+			separation: separation,
+			id:         flip<<24 | uint32(edge)<<16 | uint32(incidentEdge)<<8 | uint32(i),
+		}
+		m.count++
+	}
+	return m
+}
+
+// maxSeparation returns the face of a polygon that separates another one the
+// most, and by how much.
+func maxSeparation(a, b *Shape) (float32, int) {
+	best, face := float32(stdmath.Inf(-1)), 0
+	for i, n := range a.worldNormals {
+		deepest := float32(stdmath.Inf(1))
+		for _, v := range b.worldVertices {
+			if s := n.Dot(v.Sub(a.worldVertices[i])); s < deepest {
+				deepest = s
+			}
+		}
+		if deepest > best {
+			best, face = deepest, i
+		}
+	}
+	return best, face
+}
+
+// clipSegment keeps the part of a segment behind a plane, where the dot
+// product with its normal is at most the offset.
+func clipSegment(points [2]math.Vec2, normal math.Vec2, offset float32) ([2]math.Vec2, int) {
+	var clipped [2]math.Vec2
+	count := 0
+	d0 := normal.Dot(points[0]) - offset
+	d1 := normal.Dot(points[1]) - offset
+	if d0 <= 0 {
+		clipped[count] = points[0]
+		count++
+	}
+	if d1 <= 0 {
+		clipped[count] = points[1]
+		count++
+	}
+	if d0*d1 < 0 {
+		clipped[count] = points[0].Lerp(points[1], d0/(d0-d1))
+		count++
+	}
+	return clipped, count
+}
+
+// contains returns whether a point is inside a circle or polygon placed in
+// the world.
+func contains(s *Shape, p math.Vec2) bool {
+	switch s.kind {
+	case ShapeCircle:
+		return p.Distance(s.worldCenter) <= s.radius
+	case ShapePolygon:
+		for i, n := range s.worldNormals {
+			if n.Dot(p.Sub(s.worldVertices[i])) > 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,159 @@
+package physics2d
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/log"
+	"github.com/lentus/cosmic-engine/cosmic/math"
+	stdmath "math"
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	log.Init(log.LevelWarn, log.LevelWarn)
+	os.Exit(m.Run())
+}
+
+func near(a, b, tolerance float32) bool {
+	return stdmath.Abs(float64(a-b)) <= float64(tolerance)
+}
+
+// placed places a shape at a position without a body.
+func placed(s *Shape, position math.Vec2, angle float32) *Shape {
+	s.place(newTransform(position, angle))
+	return s
+}
+
+func TestNewPolygon(t *testing.T) {
+	s, err := NewPolygon([]math.Vec2{{X: 1, Y: 1}, {X: -1, Y: -1}, {X: 0, Y: 0}, {X: 1, Y: -1}, {X: -1, Y: 1}})
+	if err != nil {
+		t.Fatalf("Failed to create polygon - %s", err.Error())
+	}
+	if len(s.vertices) != 4 {
+		t.Errorf("Expected the hull to drop the inner point, got %v", s.vertices)
+	}
+	for i, v := range s.vertices {
+		next := s.vertices[(i+1)%len(s.vertices)]
+		if cross(next.Sub(v), s.vertices[(i+2)%len(s.vertices)].Sub(next)) <= 0 {
+			t.Errorf("Expected counter-clockwise vertices, got %v", s.vertices)
+			break
+		}
+	}
+
+	mass, center, inertia := s.massData()
+	if !near(mass, 4, 1e-4) || !near(center.X, 0, 1e-4) || !near(center.Y, 0, 1e-4) {
+		t.Errorf("Expected a mass of 4 at the origin, got %g at %v", mass, center)
+	}
+	// A square of side 2 has an inertia of m(w²+h²)/12 around its center
+	if !near(inertia, 4*8/12.0, 1e-3) {
+		t.Errorf("Expected an inertia of %g, got %g", 4*8/12.0, inertia)
+	}
+
+	if _, err := NewPolygon([]math.Vec2{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 2, Y: 0}}); err == nil {
+		t.Errorf("Expected an error for collinear points")
+	}
+}
+
+func TestInvalidExtentsPanic(t *testing.T) {
+	for _, extent := range []float32{0, -1, float32(stdmath.NaN()), float32(stdmath.Inf(1))} {
+		for name, create := range map[string]func(){
+			"box":    func() { NewBox(1, extent) },
+			"circle": func() { NewCircle(math.Vec2{}, extent) },
+		} {
+			func() {
+				defer func() {
+					if recover() == nil {
+						t.Errorf("Expected a %s of extent %g to panic", name, extent)
+					}
+				}()
+				create()
+			}()
+		}
+	}
+}
+
+func TestThinBox(t *testing.T) {
+	box := placed(NewBox(1, 0.001), math.Vec2{}, 0)
+	if len(box.vertices) != 4 {
+		t.Fatalf("Expected a thin box to keep its 4 vertices, got %v", box.vertices)
+	}
+	mass, _, _ := box.massData()
+	if !near(mass, 0.004, 1e-5) {
+		t.Errorf("Expected a mass of 0.004, got %g", mass)
+	}
+
+	circle := placed(NewCircle(math.Vec2{}, 0.5), math.Vec2{Y: 0.4}, 0)
+	if m := collide(box, circle); m.count != 1 || !near(m.normal.Y, 1, 1e-5) {
+		t.Errorf("Expected the circle to touch the top of the thin box, got %+v", m)
+	}
+}
+
+func TestCollideCircles(t *testing.T) {
+	a := placed(NewCircle(math.Vec2{}, 1), math.Vec2{}, 0)
+	b := placed(NewCircle(math.Vec2{}, 1), math.Vec2{X: 1.5}, 0)
+	m := collide(a, b)
+	if m.count != 1 {
+		t.Fatalf("Expected 1 point, got %d", m.count)
+	}
+	if !near(m.normal.X, 1, 1e-5) || !near(m.points[0].separation, -0.5, 1e-5) || !near(m.points[0].point.X, 0.75, 1e-5) {
+		t.Errorf("Unexpected manifold %+v", m)
+	}
+
+	placed(b, math.Vec2{X: 2.5}, 0)
+	if m := collide(a, b); m.count != 0 {
+		t.Errorf("Expected separated circles not to touch, got %+v", m)
+	}
+}
+
+func TestCollidePolygonCircle(t *testing.T) {
+	box := placed(NewBox(1, 1), math.Vec2{}, 0)
+	circle := placed(NewCircle(math.Vec2{}, 0.5), math.Vec2{Y: 1.25}, 0)
+	m := collide(box, circle)
+	if m.count != 1 || !near(m.normal.Y, 1, 1e-5) || !near(m.points[0].separation, -0.25, 1e-5) {
+		t.Errorf("Expected the circle to overlap the top face, got %+v", m)
+	}
+
+	// The normal points from the first shape to the second
+	if m := collide(circle, box); m.count != 1 || !near(m.normal.Y, -1, 1e-5) {
+		t.Errorf("Expected the normal to flip, got %+v", m)
+	}
+
+	// Near a corner the normal points from the vertex
+	placed(circle, math.Vec2{X: 1.3, Y: 1.3}, 0)
+	m = collide(box, circle)
+	if m.count != 1 || !near(m.normal.X, m.normal.Y, 1e-5) || m.normal.X <= 0 {
+		t.Errorf("Expected the circle to touch the corner, got %+v", m)
+	}
+	placed(circle, math.Vec2{X: 1.4, Y: 1.4}, 0)
+	if m := collide(box, circle); m.count != 0 {
+		t.Errorf("Expected the circle to miss the corner, got %+v", m)
+	}
+}
+
+func TestCollidePolygons(t *testing.T) {
+	ground := placed(NewBox(5, 0.5), math.Vec2{}, 0)
+	box := placed(NewBox(0.5, 0.5), math.Vec2{Y: 0.9}, 0)
+	m := collide(ground, box)
+	if m.count != 2 {
+		t.Fatalf("Expected 2 points, got %+v", m)
+	}
+	if !near(m.normal.Y, 1, 1e-5) {
+		t.Errorf("Expected the normal to point up, got %v", m.normal)
+	}
+	for _, p := range m.points[:m.count] {
+		if !near(p.separation, -0.1, 1e-5) {
+			t.Errorf("Expected a separation of -0.1, got %g", p.separation)
+		}
+	}
+	if m.points[0].id == m.points[1].id {
+		t.Errorf("Expected the points to have distinct ids")
+	}
+
+	if m := collide(box, ground); m.count != 2 || !near(m.normal.Y, -1, 1e-5) {
+		t.Errorf("Expected the normal to point down, got %+v", m)
+	}
+
+	placed(box, math.Vec2{X: 2, Y: 1.5}, stdmath.Pi/4)
+	if m := collide(ground, box); m.count != 0 {
+		t.Errorf("Expected the boxes not to touch, got %+v", m)
+	}
+}
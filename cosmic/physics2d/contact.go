@@ -0,0 +1,318 @@
+package physics2d
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/event"
+	"github.com/lentus/cosmic-engine/cosmic/math"
+	stdmath "math"
+)
+
+// contactKey identifies the contact of two shapes, or of a shape and an edge
+// of a chain, which is always the first shape.
+type contactKey struct {
+	a, b  *Shape
+	child int
+}
+
+type shapePair struct {
+	a, b *Shape
+}
+
+// touch is a pair of shapes touching, for which events are sent when they
+// start and stop.
+type touch struct {
+	shapePair
+	sensor bool
+	// Step the shapes last touched at
+	step int
+	// Where they started touching
+	normal, point math.Vec2
+}
+
+// collide finds the contacts of the shapes, and the events of the pairs of
+// shapes that started and stopped touching.
+func (w *World) collide(events *[]event.Event) {
+	var began []*touch
+	w.active = w.active[:0]
+	w.broadphase.pairs(func(a, b *Shape) {
+		if !w.shouldCollide(a, b) {
+			return
+		}
+		if b.kind == ShapeChain || (a.kind != ShapeChain && b.id < a.id) {
+			a, b = b, a
+		}
+
+		if a.kind != ShapeChain {
+			w.touch(a, b, 0, collide(a, b), &began)
+			return
+		}
+		for i := 0; i < a.segments(); i++ {
+			if segment := a.segment(i); segment.bounds.Overlaps(b.bounds) {
+				w.touch(a, b, i, collide(segment, b), &began)
+			}
+		}
+	})
+
+	for key, c := range w.contacts {
+		if c.step != w.step {
+			delete(w.contacts, key)
+		}
+	}
+
+	touching := w.touching[:0]
+	for _, t := range w.touching {
+		if t.step == w.step {
+			touching = append(touching, t)
+			continue
+		}
+		delete(w.touches, t.shapePair)
+		*events = append(*events, t.end())
+	}
+	for _, t := range began {
+		*events = append(*events, t.begin())
+	}
+	w.touching = append(touching, began...)
+}
+
+// shouldCollide returns whether the contacts of two shapes whose bounds
+// overlap are computed.
+func (w *World) shouldCollide(a, b *Shape) bool {
+	switch {
+	case a.body == b.body:
+		return false
+	case a.Category&b.Mask == 0 || b.Category&a.Mask == 0:
+		return false
+	case a.kind == ShapeChain && b.kind == ShapeChain:
+		return false
+	case a.Sensor && b.Sensor:
+		return false
+	case a.Sensor || b.Sensor:
+		return a.body.kind != BodyStatic || b.body.kind != BodyStatic
+	case a.body.kind != BodyDynamic && b.body.kind != BodyDynamic:
+		return false
+	}
+	return !w.jointed(a.body, b.body)
+}
+
+// touch records that two shapes touch where the manifold says, if it has
+// points.
+func (w *World) touch(a, b *Shape, child int, m manifold, began *[]*touch) {
+	if m.count == 0 {
+		return
+	}
+
+	pair := shapePair{a, b}
+	t := w.touches[pair]
+	if t == nil {
+		t = &touch{shapePair: pair, sensor: a.Sensor || b.Sensor, normal: m.normal, point: m.points[0].point}
+		w.touches[pair] = t
+		*began = append(*began, t)
+	}
+	t.step = w.step
+	if t.sensor {
+		return
+	}
+
+	key := contactKey{a, b, child}
+	c := w.contacts[key]
+	if c == nil {
+		c = &contact{a: a, b: b}
+		w.contacts[key] = c
+	}
+	c.update(m)
+	c.step = w.step
+	w.active = append(w.active, c)
+}
+
+// removeContacts ends the contacts of the pairs of shapes that match, like
+// those of a shape that is removed.
+func (w *World) removeContacts(match func(a, b *Shape) bool) {
+	for key := range w.contacts {
+		if match(key.a, key.b) {
+			delete(w.contacts, key)
+		}
+	}
+	active := w.active[:0]
+	for _, c := range w.active {
+		if !match(c.a, c.b) {
+			active = append(active, c)
+		}
+	}
+	w.active = active
+
+	touching := w.touching[:0]
+	var ended []*touch
+	for _, t := range w.touching {
+		if match(t.a, t.b) {
+			delete(w.touches, t.shapePair)
+			ended = append(ended, t)
+			continue
+		}
+		touching = append(touching, t)
+	}
+	w.touching = touching
+
+	if w.events != nil {
+		for _, t := range ended {
+			w.events(t.end())
+		}
+	}
+}
+
+func (t *touch) begin() event.Event {
+	if t.sensor {
+		trigger, other := t.a, t.b
+		if !trigger.Sensor {
+			trigger, other = other, trigger
+		}
+		return &TriggerEnter{Trigger: trigger, Other: other}
+	}
+	return &CollisionBegin{A: t.a, B: t.b, Normal: t.normal, Point: t.point}
+}
+
+func (t *touch) end() event.Event {
+	if t.sensor {
+		trigger, other := t.a, t.b
+		if !trigger.Sensor {
+			trigger, other = other, trigger
+		}
+		return &TriggerExit{Trigger: trigger, Other: other}
+	}
+	return &CollisionEnd{A: t.a, B: t.b}
+}
+
+// contact pushes two shapes apart where they touch, and applies friction.
+type contact struct {
+	a, b   *Shape
+	normal math.Vec2
+	points [2]contactPoint
+	count  int
+
+	friction, restitution float32
+	// Step the contact was last updated at
+	step int
+}
+
+type contactPoint struct {
+	manifoldPoint
+
+	// Offsets of the point from the centers of mass of the bodies
+	rA, rB                  math.Vec2
+	normalMass, tangentMass float32
+	normalImpulse           float32
+	tangentImpulse          float32
+	// Velocity the solver aims for along the normal, to push overlapping
+	// shapes apart and bounce
+	bias float32
+}
+
+// update replaces the points of the contact, keeping the impulses of those
+// that persist to start the solver from.
+func (c *contact) update(m manifold) {
+	old, oldCount := c.points, c.count
+	c.normal, c.count = m.normal, m.count
+	for i := 0; i < m.count; i++ {
+		p := contactPoint{manifoldPoint: m.points[i]}
+		for j := 0; j < oldCount; j++ {
+			if old[j].id == p.id {
+				p.normalImpulse, p.tangentImpulse = old[j].normalImpulse, old[j].tangentImpulse
+			}
+		}
+		c.points[i] = p
+	}
+
+	c.friction = float32(stdmath.Sqrt(float64(c.a.Friction * c.b.Friction)))
+	c.restitution = c.a.Restitution
+	if c.b.Restitution > c.restitution {
+		c.restitution = c.b.Restitution
+	}
+}
+
+func (c *contact) tangent() math.Vec2 {
+	return math.Vec2{X: c.normal.Y, Y: -c.normal.X}
+}
+
+// prepare computes the masses and biases of the points, and applies the
+// impulses of the previous step.
+func (c *contact) prepare(delta float32) {
+	a, b := c.a.body, c.b.body
+	tangent := c.tangent()
+	for i := 0; i < c.count; i++ {
+		p := &c.points[i]
+		p.rA, p.rB = p.point.Sub(a.center), p.point.Sub(b.center)
+		p.normalMass = effectiveMass(a, b, p.rA, p.rB, c.normal)
+		p.tangentMass = effectiveMass(a, b, p.rA, p.rB, tangent)
+
+		p.bias = -baumgarte / delta * float32(stdmath.Min(0, float64(p.separation+linearSlop)))
+		if approach := c.normal.Dot(relativeVelocity(a, b, p.rA, p.rB)); approach < -restitutionThreshold {
+			if bounce := -c.restitution * approach; bounce > p.bias {
+				p.bias = bounce
+			}
+		}
+
+		applyImpulse(a, b, p.rA, p.rB, c.normal.Scale(p.normalImpulse).Add(tangent.Scale(p.tangentImpulse)))
+	}
+}
+
+// solve applies the impulses that keep the bodies from moving into each
+// other, and friction within the limit set by how hard they press together.
+func (c *contact) solve() {
+	a, b := c.a.body, c.b.body
+	tangent := c.tangent()
+	for i := 0; i < c.count; i++ {
+		p := &c.points[i]
+		speed := tangent.Dot(relativeVelocity(a, b, p.rA, p.rB))
+		limit := c.friction * p.normalImpulse
+		impulse := clamp(p.tangentImpulse-p.tangentMass*speed, -limit, limit)
+		applyImpulse(a, b, p.rA, p.rB, tangent.Scale(impulse-p.tangentImpulse))
+		p.tangentImpulse = impulse
+	}
+
+	for i := 0; i < c.count; i++ {
+		p := &c.points[i]
+		speed := c.normal.Dot(relativeVelocity(a, b, p.rA, p.rB))
+		impulse := p.normalImpulse + p.normalMass*(p.bias-speed)
+		if impulse < 0 {
+			impulse = 0
+		}
+		applyImpulse(a, b, p.rA, p.rB, c.normal.Scale(impulse-p.normalImpulse))
+		p.normalImpulse = impulse
+	}
+}
+
+// relativeVelocity returns the velocity of a point of the second body
+// relative to the same point of the first.
+func relativeVelocity(a, b *Body, rA, rB math.Vec2) math.Vec2 {
+	vA := a.LinearVelocity.Add(crossSV(a.AngularVelocity, rA))
+	vB := b.LinearVelocity.Add(crossSV(b.AngularVelocity, rB))
+	return vB.Sub(vA)
+}
+
+// effectiveMass returns the mass the bodies oppose to an impulse along a
+// direction at a point, 0 when neither moves.
+func effectiveMass(a, b *Body, rA, rB, direction math.Vec2) float32 {
+	rnA, rnB := cross(rA, direction), cross(rB, direction)
+	k := a.invMass + b.invMass + a.inverseInertia()*rnA*rnA + b.inverseInertia()*rnB*rnB
+	if k <= 0 {
+		return 0
+	}
+	return 1 / k
+}
+
+// applyImpulse pushes the second body with an impulse at a point, and the
+// first body back.
+func applyImpulse(a, b *Body, rA, rB, impulse math.Vec2) {
+	a.LinearVelocity = a.LinearVelocity.Sub(impulse.Scale(a.invMass))
+	a.AngularVelocity -= a.inverseInertia() * cross(rA, impulse)
+	b.LinearVelocity = b.LinearVelocity.Add(impulse.Scale(b.invMass))
+	b.AngularVelocity += b.inverseInertia() * cross(rB, impulse)
+}
+
+func clamp(v, min, max float32) float32 {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
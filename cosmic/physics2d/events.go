@@ -0,0 +1,102 @@
+package physics2d
+
+import (
+	"fmt"
+	"github.com/lentus/cosmic-engine/cosmic/event"
+	"github.com/lentus/cosmic-engine/cosmic/math"
+)
+
+// The events of a world, sent after the step in which two shapes started or
+// stopped touching. They live here rather than in package event as they
+// refer to shapes.
+
+type baseEvent struct {
+	handled bool
+}
+
+func (e *baseEvent) IsHandled() bool {
+	return e.handled
+}
+
+func (e *baseEvent) SetHandled() {
+	e.handled = true
+}
+
+// Signals that two shapes started touching
+type CollisionBegin struct {
+	baseEvent
+
+	A, B *Shape
+	// Normal pointing from A to B, and a point where they touch
+	Normal math.Vec2
+	Point  math.Vec2
+}
+
+func (e *CollisionBegin) Type() event.Type {
+	return event.TypeCollisionBegin
+}
+
+func (e *CollisionBegin) Category() event.Category {
+	return event.CategoryPhysics
+}
+
+func (e *CollisionBegin) String() string {
+	return fmt.Sprintf("CollisionBeginEvent [a=%d, b=%d, point=(%g, %g)]", e.A.id, e.B.id, e.Point.X, e.Point.Y)
+}
+
+// Signals that two shapes stopped touching, or that one of them was removed
+type CollisionEnd struct {
+	baseEvent
+
+	A, B *Shape
+}
+
+func (e *CollisionEnd) Type() event.Type {
+	return event.TypeCollisionEnd
+}
+
+func (e *CollisionEnd) Category() event.Category {
+	return event.CategoryPhysics
+}
+
+func (e *CollisionEnd) String() string {
+	return fmt.Sprintf("CollisionEndEvent [a=%d, b=%d]", e.A.id, e.B.id)
+}
+
+// Signals that a shape entered a sensor shape
+type TriggerEnter struct {
+	baseEvent
+
+	Trigger, Other *Shape
+}
+
+func (e *TriggerEnter) Type() event.Type {
+	return event.TypeTriggerEnter
+}
+
+func (e *TriggerEnter) Category() event.Category {
+	return event.CategoryPhysics
+}
+
+func (e *TriggerEnter) String() string {
+	return fmt.Sprintf("TriggerEnterEvent [trigger=%d, other=%d]", e.Trigger.id, e.Other.id)
+}
+
+// Signals that a shape left a sensor shape, or that one of them was removed
+type TriggerExit struct {
+	baseEvent
+
+	Trigger, Other *Shape
+}
+
+func (e *TriggerExit) Type() event.Type {
+	return event.TypeTriggerExit
+}
+
+func (e *TriggerExit) Category() event.Category {
+	return event.CategoryPhysics
+}
+
+func (e *TriggerExit) String() string {
+	return fmt.Sprintf("TriggerExitEvent [trigger=%d, other=%d]", e.Trigger.id, e.Other.id)
+}
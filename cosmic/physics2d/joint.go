@@ -0,0 +1,236 @@
+package physics2d
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/math"
+	stdmath "math"
+)
+
+// Joint constrains how two bodies move relative to each other. Joints are
+// created by the world, and solved with the contacts.
+type Joint interface {
+	Bodies() (*Body, *Body)
+	prepare(delta float32)
+	solve()
+	collideConnected() bool
+}
+
+// jointBodies is what every joint has: two bodies and an anchor on each.
+type jointBodies struct {
+	a, b                       *Body
+	localAnchorA, localAnchorB math.Vec2
+	// Lets the bodies of the joint collide with each other, which they do
+	// not by default.
+	CollideConnected bool
+
+	// Offsets of the anchors from the centers of mass, during a step
+	rA, rB math.Vec2
+}
+
+func newJointBodies(a, b *Body, anchorA, anchorB math.Vec2) jointBodies {
+	return jointBodies{a: a, b: b, localAnchorA: a.LocalPoint(anchorA), localAnchorB: b.LocalPoint(anchorB)}
+}
+
+func (j *jointBodies) Bodies() (*Body, *Body) {
+	return j.a, j.b
+}
+
+// Anchors returns the anchors of the joint in the world.
+func (j *jointBodies) Anchors() (math.Vec2, math.Vec2) {
+	return j.a.WorldPoint(j.localAnchorA), j.b.WorldPoint(j.localAnchorB)
+}
+
+func (j *jointBodies) collideConnected() bool {
+	return j.CollideConnected
+}
+
+// anchors computes the offsets of the anchors from the centers of mass, and
+// returns how far the second anchor is from the first.
+func (j *jointBodies) anchors() math.Vec2 {
+	j.rA = newTransform(math.Vec2{}, j.a.Angle).rotate(j.localAnchorA.Sub(j.a.localCenter))
+	j.rB = newTransform(math.Vec2{}, j.b.Angle).rotate(j.localAnchorB.Sub(j.b.localCenter))
+	return j.b.center.Add(j.rB).Sub(j.a.center.Add(j.rA))
+}
+
+// DistanceJoint keeps two anchors at a distance, like a rod.
+type DistanceJoint struct {
+	jointBodies
+	Length float32
+
+	direction math.Vec2
+	mass      float32
+	bias      float32
+	impulse   float32
+}
+
+// NewDistanceJoint connects anchors in the world on two bodies, at their
+// current distance.
+func (w *World) NewDistanceJoint(a, b *Body, anchorA, anchorB math.Vec2) *DistanceJoint {
+	j := &DistanceJoint{jointBodies: newJointBodies(a, b, anchorA, anchorB), Length: anchorA.Distance(anchorB)}
+	w.joints = append(w.joints, j)
+	return j
+}
+
+func (j *DistanceJoint) prepare(delta float32) {
+	offset := j.anchors()
+	length := offset.Len()
+	j.direction = math.Vec2{}
+	if length > linearSlop {
+		j.direction = offset.Scale(1 / length)
+	}
+	j.mass = effectiveMass(j.a, j.b, j.rA, j.rB, j.direction)
+	j.bias = -baumgarte / delta * (length - j.Length)
+	applyImpulse(j.a, j.b, j.rA, j.rB, j.direction.Scale(j.impulse))
+}
+
+func (j *DistanceJoint) solve() {
+	speed := j.direction.Dot(relativeVelocity(j.a, j.b, j.rA, j.rB))
+	impulse := j.mass * (j.bias - speed)
+	j.impulse += impulse
+	applyImpulse(j.a, j.b, j.rA, j.rB, j.direction.Scale(impulse))
+}
+
+// RevoluteJoint pins two bodies together at an anchor they rotate around,
+// like a hinge or a wheel. A motor can turn the second body relative to the
+// first.
+type RevoluteJoint struct {
+	jointBodies
+	EnableMotor bool
+	// Speed of the motor in radians per second, counter-clockwise
+	MotorSpeed float32
+	// Most torque the motor applies to reach its speed
+	MaxMotorTorque float32
+
+	point pointConstraint
+	motor angularConstraint
+	delta float32
+}
+
+// NewRevoluteJoint pins two bodies together at an anchor in the world.
+func (w *World) NewRevoluteJoint(a, b *Body, anchor math.Vec2) *RevoluteJoint {
+	j := &RevoluteJoint{jointBodies: newJointBodies(a, b, anchor, anchor)}
+	w.joints = append(w.joints, j)
+	return j
+}
+
+func (j *RevoluteJoint) prepare(delta float32) {
+	j.point.prepare(&j.jointBodies, delta)
+	j.delta = delta
+	if !j.EnableMotor {
+		j.motor.impulse = 0
+	}
+	j.motor.prepare(&j.jointBodies, 0)
+}
+
+func (j *RevoluteJoint) solve() {
+	if j.EnableMotor {
+		limit := j.MaxMotorTorque * j.delta
+		j.motor.solve(&j.jointBodies, j.MotorSpeed, -limit, limit)
+	}
+	j.point.solve(&j.jointBodies)
+}
+
+// WeldJoint glues two bodies together at an anchor, keeping the angle
+// between them.
+type WeldJoint struct {
+	jointBodies
+
+	point          pointConstraint
+	angle          angularConstraint
+	referenceAngle float32
+}
+
+// NewWeldJoint glues two bodies together at an anchor in the world.
+func (w *World) NewWeldJoint(a, b *Body, anchor math.Vec2) *WeldJoint {
+	j := &WeldJoint{jointBodies: newJointBodies(a, b, anchor, anchor), referenceAngle: b.Angle - a.Angle}
+	w.joints = append(w.joints, j)
+	return j
+}
+
+func (j *WeldJoint) prepare(delta float32) {
+	j.point.prepare(&j.jointBodies, delta)
+	j.angle.prepare(&j.jointBodies, -baumgarte/delta*(j.b.Angle-j.a.Angle-j.referenceAngle))
+}
+
+func (j *WeldJoint) solve() {
+	j.angle.solve(&j.jointBodies, 0, -stdmath.MaxFloat32, stdmath.MaxFloat32)
+	j.point.solve(&j.jointBodies)
+}
+
+// RemoveJoint removes a joint from the world.
+func (w *World) RemoveJoint(j Joint) {
+	for i, other := range w.joints {
+		if other == j {
+			w.joints = append(w.joints[:i], w.joints[i+1:]...)
+			return
+		}
+	}
+}
+
+func (w *World) Joints() []Joint {
+	return w.joints
+}
+
+// pointConstraint keeps the anchors of a joint together.
+type pointConstraint struct {
+	// Inverse of the 2x2 mass matrix, by rows
+	mass    [4]float32
+	bias    math.Vec2
+	impulse math.Vec2
+}
+
+func (c *pointConstraint) prepare(j *jointBodies, delta float32) {
+	offset := j.anchors()
+	a, b := j.a, j.b
+	mA, mB := a.invMass, b.invMass
+	iA, iB := a.inverseInertia(), b.inverseInertia()
+	rA, rB := j.rA, j.rB
+
+	k11 := mA + mB + iA*rA.Y*rA.Y + iB*rB.Y*rB.Y
+	k12 := -iA*rA.X*rA.Y - iB*rB.X*rB.Y
+	k22 := mA + mB + iA*rA.X*rA.X + iB*rB.X*rB.X
+	c.mass = [4]float32{}
+	if determinant := k11*k22 - k12*k12; determinant != 0 {
+		inverse := 1 / determinant
+		c.mass = [4]float32{inverse * k22, -inverse * k12, -inverse * k12, inverse * k11}
+	}
+	c.bias = offset.Scale(-baumgarte / delta)
+	applyImpulse(a, b, rA, rB, c.impulse)
+}
+
+func (c *pointConstraint) solve(j *jointBodies) {
+	v := c.bias.Sub(relativeVelocity(j.a, j.b, j.rA, j.rB))
+	impulse := math.Vec2{X: c.mass[0]*v.X + c.mass[1]*v.Y, Y: c.mass[2]*v.X + c.mass[3]*v.Y}
+	c.impulse = c.impulse.Add(impulse)
+	applyImpulse(j.a, j.b, j.rA, j.rB, impulse)
+}
+
+// angularConstraint sets the angular velocity of the second body of a joint
+// relative to the first.
+type angularConstraint struct {
+	mass    float32
+	bias    float32
+	impulse float32
+}
+
+func (c *angularConstraint) prepare(j *jointBodies, bias float32) {
+	c.mass = 0
+	if k := j.a.inverseInertia() + j.b.inverseInertia(); k > 0 {
+		c.mass = 1 / k
+	}
+	c.bias = bias
+	c.apply(j, c.impulse)
+}
+
+// solve moves the relative angular velocity towards a speed, with an
+// accumulated impulse within limits.
+func (c *angularConstraint) solve(j *jointBodies, speed, min, max float32) {
+	impulse := c.mass * (speed + c.bias - (j.b.AngularVelocity - j.a.AngularVelocity))
+	accumulated := clamp(c.impulse+impulse, min, max)
+	impulse, c.impulse = accumulated-c.impulse, accumulated
+	c.apply(j, impulse)
+}
+
+func (c *angularConstraint) apply(j *jointBodies, impulse float32) {
+	j.a.AngularVelocity -= j.a.inverseInertia() * impulse
+	j.b.AngularVelocity += j.b.inverseInertia() * impulse
+}
@@ -0,0 +1,200 @@
+package physics2d
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/math"
+	stdmath "math"
+	"sort"
+)
+
+// RayHit is where a ray hits a shape.
+type RayHit struct {
+	Shape  *Shape
+	Point  math.Vec2
+	Normal math.Vec2
+	// Fraction of the way from the start to the end of the ray
+	Fraction float32
+}
+
+// RayCast returns the first shape hit by a ray between two points, skipping
+// the shapes for which filter returns false when it is not nil. Rays starting
+// inside a shape do not hit it.
+func (w *World) RayCast(from, to math.Vec2, filter func(s *Shape) bool) (RayHit, bool) {
+	hits := w.RayCastAll(from, to, filter)
+	if len(hits) == 0 {
+		return RayHit{}, false
+	}
+	return hits[0], true
+}
+
+// RayCastAll returns every shape hit by a ray between two points, from the
+// nearest to the farthest, and the first hit of chains.
+func (w *World) RayCastAll(from, to math.Vec2, filter func(s *Shape) bool) []RayHit {
+	w.place()
+	box := AABB{Min: from.Min(to), Max: from.Max(to)}
+
+	var hits []RayHit
+	w.broadphase.query(box, func(s *Shape) bool {
+		if filter != nil && !filter(s) {
+			return true
+		}
+		if hit, ok := rayCast(s, from, to); ok {
+			hit.Shape = s
+			hits = append(hits, hit)
+		}
+		return true
+	})
+
+	sort.SliceStable(hits, func(i, j int) bool {
+		return hits[i].Fraction < hits[j].Fraction
+	})
+	return hits
+}
+
+// rayCast returns where a ray hits a shape placed in the world.
+func rayCast(s *Shape, from, to math.Vec2) (RayHit, bool) {
+	switch s.kind {
+	case ShapeCircle:
+		return rayCastCircle(s.worldCenter, s.radius, from, to)
+	case ShapePolygon:
+		return rayCastPolygon(s, from, to)
+	}
+
+	best := RayHit{Fraction: float32(stdmath.Inf(1))}
+	for i := 0; i < s.segments(); i++ {
+		v1 := s.worldVertices[i]
+		v2 := s.worldVertices[(i+1)%len(s.worldVertices)]
+		if hit, ok := rayCastSegment(v1, v2, from, to); ok && hit.Fraction < best.Fraction {
+			best = hit
+		}
+	}
+	return best, best.Fraction <= 1
+}
+
+func rayCastCircle(center math.Vec2, radius float32, from, to math.Vec2) (RayHit, bool) {
+	s := from.Sub(center)
+	d := to.Sub(from)
+	b := s.Dot(s) - radius*radius
+	c := s.Dot(d)
+	dd := d.Dot(d)
+	sigma := c*c - dd*b
+	if sigma < 0 || dd < epsilon {
+		return RayHit{}, false
+	}
+
+	a := -(c + float32(stdmath.Sqrt(float64(sigma))))
+	if a < 0 || a > dd {
+		return RayHit{}, false
+	}
+	fraction := a / dd
+	point := from.Add(d.Scale(fraction))
+	return RayHit{Point: point, Normal: point.Sub(center).Normalize(), Fraction: fraction}, true
+}
+
+// rayCastPolygon clips the ray to the inside of every face of the polygon.
+func rayCastPolygon(s *Shape, from, to math.Vec2) (RayHit, bool) {
+	d := to.Sub(from)
+	lower, upper := float32(0), float32(1)
+	face := -1
+	for i, n := range s.worldNormals {
+		numerator := n.Dot(s.worldVertices[i].Sub(from))
+		denominator := n.Dot(d)
+		switch {
+		case denominator == 0:
+			if numerator < 0 {
+				return RayHit{}, false
+			}
+		case denominator < 0 && numerator < lower*denominator:
+			lower, face = numerator/denominator, i
+		case denominator > 0 && numerator < upper*denominator:
+			upper = numerator / denominator
+		}
+		if upper < lower {
+			return RayHit{}, false
+		}
+	}
+
+	if face < 0 {
+		return RayHit{}, false
+	}
+	return RayHit{Point: from.Add(d.Scale(lower)), Normal: s.worldNormals[face], Fraction: lower}, true
+}
+
+// rayCastSegment returns where a ray crosses a segment, from either side.
+func rayCastSegment(v1, v2, from, to math.Vec2) (RayHit, bool) {
+	d := to.Sub(from)
+	edge := v2.Sub(v1)
+	normal := math.Vec2{X: edge.Y, Y: -edge.X}.Normalize()
+	denominator := normal.Dot(d)
+	if denominator == 0 {
+		return RayHit{}, false
+	}
+
+	fraction := normal.Dot(v1.Sub(from)) / denominator
+	if fraction < 0 || fraction > 1 {
+		return RayHit{}, false
+	}
+	point := from.Add(d.Scale(fraction))
+	if t := point.Sub(v1).Dot(edge) / edge.Dot(edge); t < 0 || t > 1 {
+		return RayHit{}, false
+	}
+	if denominator > 0 {
+		normal = normal.Neg()
+	}
+	return RayHit{Point: point, Normal: normal, Fraction: fraction}, true
+}
+
+// QueryAABB returns the shapes whose bounds overlap a box.
+func (w *World) QueryAABB(box AABB) []*Shape {
+	w.place()
+	var shapes []*Shape
+	w.broadphase.query(box, func(s *Shape) bool {
+		shapes = append(shapes, s)
+		return true
+	})
+	return shapes
+}
+
+// QueryPoint returns the circles and polygons containing a point.
+func (w *World) QueryPoint(point math.Vec2) []*Shape {
+	w.place()
+	var shapes []*Shape
+	w.broadphase.query(AABB{Min: point, Max: point}, func(s *Shape) bool {
+		if contains(s, point) {
+			shapes = append(shapes, s)
+		}
+		return true
+	})
+	return shapes
+}
+
+// Overlap returns the shapes overlapping a circle or polygon placed at a
+// position and angle in the world, like an area of effect. The shape is not
+// added to the world.
+func (w *World) Overlap(shape *Shape, position math.Vec2, angle float32) []*Shape {
+	if shape.kind == ShapeChain {
+		return nil
+	}
+	w.place()
+	shape.place(newTransform(position, angle))
+
+	var shapes []*Shape
+	w.broadphase.query(shape.bounds, func(s *Shape) bool {
+		if s == shape || shape.Category&s.Mask == 0 || s.Category&shape.Mask == 0 {
+			return true
+		}
+		if s.kind != ShapeChain {
+			if collide(shape, s).count > 0 {
+				shapes = append(shapes, s)
+			}
+			return true
+		}
+		for i := 0; i < s.segments(); i++ {
+			if segment := s.segment(i); segment.bounds.Overlaps(shape.bounds) && collide(segment, shape).count > 0 {
+				shapes = append(shapes, s)
+				break
+			}
+		}
+		return true
+	})
+	return shapes
+}
@@ -0,0 +1,78 @@
+package physics2d
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/math"
+	"testing"
+)
+
+func newQueryWorld() (*World, *Shape, *Shape, *Shape) {
+	w := NewWorld(Options{})
+	circle := NewCircle(math.Vec2{}, 1)
+	w.NewBody(BodyStatic, math.Vec2{X: 5}).AddShape(circle)
+	box := NewBox(1, 1)
+	w.NewBody(BodyDynamic, math.Vec2{X: 10}).AddShape(box)
+	chain, _ := NewChain([]math.Vec2{{X: 14, Y: -5}, {X: 14, Y: 5}}, false)
+	w.NewBody(BodyStatic, math.Vec2{}).AddShape(chain)
+	return w, circle, box, chain
+}
+
+func TestRayCast(t *testing.T) {
+	w, circle, box, chain := newQueryWorld()
+
+	hit, ok := w.RayCast(math.Vec2{}, math.Vec2{X: 20}, nil)
+	if !ok || hit.Shape != circle {
+		t.Fatalf("Expected the ray to hit the circle first, got %+v", hit)
+	}
+	if !near(hit.Point.X, 4, 1e-4) || !near(hit.Normal.X, -1, 1e-4) || !near(hit.Fraction, 0.2, 1e-4) {
+		t.Errorf("Unexpected hit %+v", hit)
+	}
+
+	hits := w.RayCastAll(math.Vec2{}, math.Vec2{X: 20}, nil)
+	if len(hits) != 3 || hits[1].Shape != box || hits[2].Shape != chain {
+		t.Fatalf("Expected the ray to hit the circle, box and chain in order, got %+v", hits)
+	}
+	if !near(hits[1].Point.X, 9, 1e-4) || !near(hits[1].Normal.X, -1, 1e-4) {
+		t.Errorf("Unexpected hit on the box %+v", hits[1])
+	}
+	if !near(hits[2].Point.X, 14, 1e-4) || !near(hits[2].Normal.X, -1, 1e-4) {
+		t.Errorf("Unexpected hit on the chain %+v", hits[2])
+	}
+
+	hit, ok = w.RayCast(math.Vec2{}, math.Vec2{X: 20}, func(s *Shape) bool {
+		return s.Body().Type() == BodyDynamic
+	})
+	if !ok || hit.Shape != box {
+		t.Errorf("Expected the filter to skip to the box, got %+v", hit)
+	}
+
+	if _, ok := w.RayCast(math.Vec2{Y: 2}, math.Vec2{X: 12, Y: 2}, nil); ok {
+		t.Errorf("Expected the ray to miss")
+	}
+	if _, ok := w.RayCast(math.Vec2{}, math.Vec2{X: 3.5}, nil); ok {
+		t.Errorf("Expected the ray to stop short of the circle")
+	}
+}
+
+func TestQueries(t *testing.T) {
+	w, circle, box, _ := newQueryWorld()
+
+	if shapes := w.QueryAABB(AABB{Min: math.Vec2{X: 3, Y: -1}, Max: math.Vec2{X: 9.5, Y: 1}}); len(shapes) != 2 {
+		t.Errorf("Expected the box to overlap 2 shapes, got %d", len(shapes))
+	}
+
+	if shapes := w.QueryPoint(math.Vec2{X: 5.5, Y: 0.5}); len(shapes) != 1 || shapes[0] != circle {
+		t.Errorf("Expected the point to be in the circle, got %v", shapes)
+	}
+	// Inside the bounds of the circle, but not the circle
+	if shapes := w.QueryPoint(math.Vec2{X: 5.9, Y: 0.9}); len(shapes) != 0 {
+		t.Errorf("Expected the point to be outside the circle, got %v", shapes)
+	}
+
+	area := NewCircle(math.Vec2{}, 2)
+	if shapes := w.Overlap(area, math.Vec2{X: 7.5}, 0); len(shapes) != 2 {
+		t.Errorf("Expected the area to overlap the circle and box, got %v", shapes)
+	}
+	if shapes := w.Overlap(area, math.Vec2{X: 12.5}, 0); len(shapes) != 2 || (shapes[0] != box && shapes[1] != box) {
+		t.Errorf("Expected the area to overlap the box and chain, got %v", shapes)
+	}
+}
@@ -0,0 +1,312 @@
+package physics2d
+
+import (
+	"errors"
+	"github.com/lentus/cosmic-engine/cosmic/log"
+	"github.com/lentus/cosmic-engine/cosmic/math"
+	stdmath "math"
+)
+
+type ShapeKind int
+
+const (
+	ShapeCircle ShapeKind = iota
+	ShapePolygon
+	// ShapeChain is a line through points, for the terrain of static bodies.
+	// Chains collide with circles and polygons on both sides, but not with
+	// other chains, and have no mass.
+	ShapeChain
+)
+
+// Most vertices of a polygon.
+const maxPolygonVertices = 16
+
+// Shape is the geometry of a body that collides, relative to the body.
+// Shapes are created with the constructors of each kind and added to a body
+// with Body.AddShape, after which their geometry does not change.
+type Shape struct {
+	Friction    float32
+	Restitution float32
+	// Mass per unit of area, which sets the mass of dynamic bodies when the
+	// shape is added
+	Density float32
+	// Sensor shapes detect overlaps without colliding, sending trigger
+	// events instead of collision events.
+	Sensor bool
+	// Shapes collide when the category of each is in the mask of the other.
+	Category uint32
+	Mask     uint32
+
+	UserData interface{}
+
+	kind   ShapeKind
+	center math.Vec2
+	radius float32
+	// Counter-clockwise vertices and outward normals of polygons, and the
+	// points of chains
+	vertices []math.Vec2
+	normals  []math.Vec2
+	loop     bool
+
+	body *Body
+	id   int
+	// Geometry in world space and bounds, updated with the body
+	worldCenter   math.Vec2
+	worldVertices []math.Vec2
+	worldNormals  []math.Vec2
+	bounds        AABB
+}
+
+func newShape(kind ShapeKind) *Shape {
+	return &Shape{Friction: 0.6, Density: 1, Category: 1, Mask: ^uint32(0), kind: kind}
+}
+
+// NewCircle returns a circle around a center relative to the body. It panics
+// unless the radius is positive and finite.
+func NewCircle(center math.Vec2, radius float32) *Shape {
+	if !validExtent(radius) {
+		log.PanicfCore("invalid circle radius %g", radius)
+	}
+
+	s := newShape(ShapeCircle)
+	s.center, s.radius = center, radius
+	return s
+}
+
+// NewBox returns a rectangle centered on the body. It panics unless both
+// half extents are positive and finite. Unlike NewPolygon, it keeps boxes too
+// thin to have an area after merging close points.
+func NewBox(halfWidth, halfHeight float32) *Shape {
+	if !validExtent(halfWidth) || !validExtent(halfHeight) {
+		log.PanicfCore("invalid box half extents %gx%g", halfWidth, halfHeight)
+	}
+
+	s := newShape(ShapePolygon)
+	s.vertices = []math.Vec2{
+		{X: -halfWidth, Y: -halfHeight},
+		{X: halfWidth, Y: -halfHeight},
+		{X: halfWidth, Y: halfHeight},
+		{X: -halfWidth, Y: halfHeight},
+	}
+	s.normals = []math.Vec2{{Y: -1}, {X: 1}, {Y: 1}, {X: -1}}
+	return s
+}
+
+func validExtent(extent float32) bool {
+	return extent > 0 && !stdmath.IsInf(float64(extent), 1)
+}
+
+// NewPolygon returns the convex hull of points relative to the body, of at
+// most 16 points.
+func NewPolygon(points []math.Vec2) (*Shape, error) {
+	if len(points) > maxPolygonVertices {
+		return nil, errors.New("polygon with more than 16 points")
+	}
+	hull := convexHull(points)
+	if len(hull) < 3 {
+		return nil, errors.New("polygon without area")
+	}
+
+	s := newShape(ShapePolygon)
+	s.vertices = hull
+	s.normals = make([]math.Vec2, len(hull))
+	for i, v := range hull {
+		edge := hull[(i+1)%len(hull)].Sub(v)
+		s.normals[i] = math.Vec2{X: edge.Y, Y: -edge.X}.Normalize()
+	}
+	s.center = centroid(hull)
+	return s, nil
+}
+
+// NewChain returns a line through points relative to the body, closed back
+// to the first point when it loops.
+func NewChain(points []math.Vec2, loop bool) (*Shape, error) {
+	if len(points) < 2 || (loop && len(points) < 3) {
+		return nil, errors.New("chain with too few points")
+	}
+	for i := 1; i < len(points); i++ {
+		if points[i].Distance(points[i-1]) < linearSlop {
+			return nil, errors.New("chain with points too close together")
+		}
+	}
+
+	s := newShape(ShapeChain)
+	s.vertices = append([]math.Vec2(nil), points...)
+	s.loop = loop
+	return s, nil
+}
+
+func (s *Shape) Kind() ShapeKind {
+	return s.kind
+}
+
+// Body returns the body of the shape, nil before it is added to one.
+func (s *Shape) Body() *Body {
+	return s.body
+}
+
+// Bounds returns the box around the shape in the world, as of the last step
+// or query.
+func (s *Shape) Bounds() AABB {
+	return s.bounds
+}
+
+// segments returns the number of edges of a chain.
+func (s *Shape) segments() int {
+	if s.loop {
+		return len(s.vertices)
+	}
+	return len(s.vertices) - 1
+}
+
+// segment returns an edge of a chain in world space, as a polygon of two
+// vertices with a normal on each side.
+func (s *Shape) segment(i int) *Shape {
+	v1 := s.worldVertices[i]
+	v2 := s.worldVertices[(i+1)%len(s.worldVertices)]
+	edge := v2.Sub(v1)
+	normal := math.Vec2{X: edge.Y, Y: -edge.X}.Normalize()
+	return &Shape{
+		kind:          ShapePolygon,
+		worldCenter:   v1.Lerp(v2, 0.5),
+		worldVertices: []math.Vec2{v1, v2},
+		worldNormals:  []math.Vec2{normal, normal.Neg()},
+		bounds:        AABB{Min: v1.Min(v2), Max: v1.Max(v2)},
+	}
+}
+
+// place moves the shape to a position and rotation in the world.
+func (s *Shape) place(t transform) {
+	s.worldCenter = t.apply(s.center)
+	switch s.kind {
+	case ShapeCircle:
+		r := math.Vec2{X: s.radius, Y: s.radius}
+		s.bounds = AABB{Min: s.worldCenter.Sub(r), Max: s.worldCenter.Add(r)}
+	default:
+		if len(s.worldVertices) != len(s.vertices) {
+			s.worldVertices = make([]math.Vec2, len(s.vertices))
+			s.worldNormals = make([]math.Vec2, len(s.normals))
+		}
+		s.bounds = emptyAABB()
+		for i, v := range s.vertices {
+			s.worldVertices[i] = t.apply(v)
+			s.bounds = s.bounds.extend(s.worldVertices[i])
+		}
+		for i, n := range s.normals {
+			s.worldNormals[i] = t.rotate(n)
+		}
+	}
+}
+
+// massData returns the mass of the shape, its center relative to the body
+// and its rotational inertia around the origin of the body.
+func (s *Shape) massData() (mass float32, center math.Vec2, inertia float32) {
+	switch s.kind {
+	case ShapeCircle:
+		mass = s.Density * stdmath.Pi * s.radius * s.radius
+		return mass, s.center, mass * (s.radius*s.radius/2 + s.center.Dot(s.center))
+	case ShapePolygon:
+		// Sum the triangles between the centroid and every edge
+		reference := s.vertices[0]
+		var area, i float32
+		var c math.Vec2
+		for k := 1; k+1 < len(s.vertices); k++ {
+			e1, e2 := s.vertices[k].Sub(reference), s.vertices[k+1].Sub(reference)
+			d := cross(e1, e2)
+			triangle := d / 2
+			area += triangle
+			c = c.Add(e1.Add(e2).Scale(triangle / 3))
+			i += d / 12 * (e1.X*e1.X + e2.X*e1.X + e2.X*e2.X + e1.Y*e1.Y + e2.Y*e1.Y + e2.Y*e2.Y)
+		}
+		mass = s.Density * area
+		c = c.Scale(1 / area)
+		center = c.Add(reference)
+		// Inertia around the reference, moved to the centroid and then to
+		// the origin of the body
+		inertia = s.Density*i + mass*(center.Dot(center)-c.Dot(c))
+		return mass, center, inertia
+	}
+	return 0, math.Vec2{}, 0
+}
+
+// convexHull returns the counter-clockwise convex hull of points, with the
+// gift wrapping algorithm.
+func convexHull(points []math.Vec2) []math.Vec2 {
+	// Drop points too close to others
+	var unique []math.Vec2
+	for _, p := range points {
+		duplicate := false
+		for _, q := range unique {
+			if p.Distance(q) < linearSlop/2 {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			unique = append(unique, p)
+		}
+	}
+	if len(unique) < 3 {
+		return nil
+	}
+
+	// Start at the rightmost point, lowest on ties
+	start := 0
+	for i, p := range unique {
+		if p.X > unique[start].X || (p.X == unique[start].X && p.Y < unique[start].Y) {
+			start = i
+		}
+	}
+
+	var hull []math.Vec2
+	for current := start; ; {
+		hull = append(hull, unique[current])
+		next := (current + 1) % len(unique)
+		for i, p := range unique {
+			if i == current {
+				continue
+			}
+			c := cross(unique[next].Sub(unique[current]), p.Sub(unique[current]))
+			// Take the point most clockwise, the farthest on collinear ones
+			if c < 0 || (c == 0 && p.Distance(unique[current]) > unique[next].Distance(unique[current])) {
+				next = i
+			}
+		}
+		current = next
+		if current == start || len(hull) > len(unique) {
+			break
+		}
+	}
+
+	// Collinear points leave no area
+	area := float32(0)
+	for i := range hull {
+		area += cross(hull[i], hull[(i+1)%len(hull)])
+	}
+	if area < linearSlop*linearSlop {
+		return nil
+	}
+	return hull
+}
+
+func centroid(vertices []math.Vec2) math.Vec2 {
+	var c math.Vec2
+	var area float32
+	for i, v := range vertices {
+		w := vertices[(i+1)%len(vertices)]
+		a := cross(v, w) / 2
+		area += a
+		c = c.Add(v.Add(w).Scale(a / 3))
+	}
+	return c.Scale(1 / area)
+}
+
+// cross returns the z component of the cross product of two vectors.
+func cross(a, b math.Vec2) float32 {
+	return a.X*b.Y - a.Y*b.X
+}
+
+// crossSV returns the cross product of a scalar, along z, with a vector.
+func crossSV(s float32, v math.Vec2) math.Vec2 {
+	return math.Vec2{X: -s * v.Y, Y: s * v.X}
+}
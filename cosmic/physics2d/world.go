@@ -0,0 +1,186 @@
+// Package physics2d simulates rigid bodies in 2D. Static, kinematic and
+// dynamic bodies collide through circles, boxes, convex polygons and chains
+// of edges. Overlapping shapes are found with a sweep and prune broadphase,
+// and their collisions resolved with sequential impulses, with friction and
+// restitution, together with the joints between bodies. Worlds step with a
+// fixed time, like the tick of the application, and report collisions and
+// triggers as engine events.
+package physics2d
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/event"
+	"github.com/lentus/cosmic-engine/cosmic/math"
+)
+
+// Tolerances of the solver, in world units.
+const (
+	// Overlap allowed between shapes, which keeps resting contacts stable
+	linearSlop = 0.005
+	epsilon    = 1e-6
+	// Share of the overlap corrected each step
+	baumgarte = 0.2
+	// Speed below which collisions do not bounce, in units per second
+	restitutionThreshold = 1
+)
+
+type Options struct {
+	Gravity math.Vec2
+	// Iterations of the solver per step, 8 by default. More iterations make
+	// stacks and chains of joints stiffer.
+	Iterations int
+	// Events receives the collision and trigger events of every step, after
+	// the bodies moved.
+	Events func(e event.Event)
+}
+
+// World holds the bodies and joints that are simulated together.
+type World struct {
+	Gravity    math.Vec2
+	Iterations int
+
+	events     func(e event.Event)
+	bodies     []*Body
+	joints     []Joint
+	broadphase broadphase
+
+	contacts map[contactKey]*contact
+	// Contacts of the last step, in the order they were found
+	active []*contact
+	// Pairs of shapes touching after the last step, in the order they
+	// started touching
+	touching []*touch
+	touches  map[shapePair]*touch
+	step     int
+
+	nextShape int
+}
+
+// NewWorld returns a world without bodies.
+func NewWorld(options Options) *World {
+	if options.Iterations <= 0 {
+		options.Iterations = 8
+	}
+	return &World{
+		Gravity:    options.Gravity,
+		Iterations: options.Iterations,
+		events:     options.Events,
+		contacts:   make(map[contactKey]*contact),
+		touches:    make(map[shapePair]*touch),
+	}
+}
+
+// NewBody adds a body without shapes at a position.
+func (w *World) NewBody(kind BodyType, position math.Vec2) *Body {
+	b := &Body{Position: position, GravityScale: 1, kind: kind, world: w}
+	b.updateMass()
+	w.bodies = append(w.bodies, b)
+	return b
+}
+
+// DestroyBody removes a body with its shapes and joints, ending its
+// contacts.
+func (w *World) DestroyBody(b *Body) {
+	for len(b.shapes) > 0 {
+		b.RemoveShape(b.shapes[len(b.shapes)-1])
+	}
+	for i := len(w.joints) - 1; i >= 0; i-- {
+		if a, other := w.joints[i].Bodies(); a == b || other == b {
+			w.RemoveJoint(w.joints[i])
+		}
+	}
+	for i, other := range w.bodies {
+		if other == b {
+			w.bodies = append(w.bodies[:i], w.bodies[i+1:]...)
+			break
+		}
+	}
+	b.world = nil
+}
+
+func (w *World) Bodies() []*Body {
+	return w.bodies
+}
+
+// Step advances the world by a time in seconds, which should be the same at
+// every step.
+func (w *World) Step(delta float32) {
+	if delta <= 0 {
+		return
+	}
+	w.step++
+
+	// Accelerate the bodies
+	for _, b := range w.bodies {
+		b.center = b.WorldCenter()
+		if b.kind != BodyDynamic {
+			continue
+		}
+		acceleration := w.Gravity.Scale(b.GravityScale).Add(b.force.Scale(b.invMass))
+		b.LinearVelocity = b.LinearVelocity.Add(acceleration.Scale(delta)).Scale(1 / (1 + delta*b.LinearDamping))
+		b.AngularVelocity += delta * b.inverseInertia() * b.torque
+		b.AngularVelocity /= 1 + delta*b.AngularDamping
+		if b.FixedRotation {
+			b.AngularVelocity = 0
+		}
+	}
+
+	var events []event.Event
+	w.place()
+	w.collide(&events)
+
+	// Solve the contacts and joints together
+	for _, c := range w.active {
+		c.prepare(delta)
+	}
+	for _, j := range w.joints {
+		j.prepare(delta)
+	}
+	for i := 0; i < w.Iterations; i++ {
+		for _, j := range w.joints {
+			j.solve()
+		}
+		for _, c := range w.active {
+			c.solve()
+		}
+	}
+
+	// Move the bodies
+	for _, b := range w.bodies {
+		if b.kind == BodyStatic {
+			continue
+		}
+		b.center = b.center.Add(b.LinearVelocity.Scale(delta))
+		b.Angle += b.AngularVelocity * delta
+		b.Position = b.center.Sub(newTransform(math.Vec2{}, b.Angle).rotate(b.localCenter))
+		b.force, b.torque = math.Vec2{}, 0
+	}
+	w.place()
+
+	if w.events != nil {
+		for _, e := range events {
+			w.events(e)
+		}
+	}
+}
+
+// place moves the shapes to their bodies.
+func (w *World) place() {
+	for _, b := range w.bodies {
+		t := b.transform()
+		for _, s := range b.shapes {
+			s.place(t)
+		}
+	}
+	w.broadphase.sort()
+}
+
+// jointed returns whether two bodies are connected by a joint that keeps
+// them from colliding.
+func (w *World) jointed(a, b *Body) bool {
+	for _, j := range w.joints {
+		if ja, jb := j.Bodies(); ((ja == a && jb == b) || (ja == b && jb == a)) && !j.collideConnected() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,314 @@
+package physics2d
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/event"
+	"github.com/lentus/cosmic-engine/cosmic/math"
+	stdmath "math"
+	"testing"
+)
+
+const tick = float32(1) / 60
+
+func newTestWorld(events *[]event.Event) *World {
+	options := Options{Gravity: math.Vec2{Y: -10}}
+	if events != nil {
+		options.Events = func(e event.Event) {
+			*events = append(*events, e)
+		}
+	}
+	return NewWorld(options)
+}
+
+func addGround(w *World) *Body {
+	ground := w.NewBody(BodyStatic, math.Vec2{Y: -0.5})
+	ground.AddShape(NewBox(20, 0.5))
+	return ground
+}
+
+func steps(w *World, n int) {
+	for i := 0; i < n; i++ {
+		w.Step(tick)
+	}
+}
+
+func TestBoxComesToRest(t *testing.T) {
+	w := newTestWorld(nil)
+	addGround(w)
+	box := w.NewBody(BodyDynamic, math.Vec2{Y: 3})
+	box.AddShape(NewBox(0.5, 0.5))
+
+	steps(w, 180)
+	if !near(box.Position.Y, 0.5, 2*linearSlop) {
+		t.Errorf("Expected the box to rest on the ground at 0.5, got %g", box.Position.Y)
+	}
+	if box.LinearVelocity.Len() > 0.01 || stdmath.Abs(float64(box.AngularVelocity)) > 0.01 {
+		t.Errorf("Expected the box to rest, got velocity %v and %g", box.LinearVelocity, box.AngularVelocity)
+	}
+	if !near(box.Angle, 0, 1e-3) {
+		t.Errorf("Expected the box not to turn, got %g", box.Angle)
+	}
+}
+
+func TestStack(t *testing.T) {
+	w := newTestWorld(nil)
+	addGround(w)
+	var boxes []*Body
+	for i := 0; i < 5; i++ {
+		box := w.NewBody(BodyDynamic, math.Vec2{Y: 0.5 + float32(i)*1.01})
+		box.AddShape(NewBox(0.5, 0.5))
+		boxes = append(boxes, box)
+	}
+
+	steps(w, 300)
+	for i, box := range boxes {
+		if !near(box.Position.X, 0, 0.05) || !near(box.Position.Y, 0.5+float32(i), 0.1) {
+			t.Errorf("Expected box %d to stay stacked, got %v", i, box.Position)
+		}
+	}
+}
+
+func TestRestitution(t *testing.T) {
+	bounce := func(restitution float32) float32 {
+		w := newTestWorld(nil)
+		addGround(w)
+		ball := w.NewBody(BodyDynamic, math.Vec2{Y: 5})
+		s := NewCircle(math.Vec2{}, 0.5)
+		s.Restitution = restitution
+		ball.AddShape(s)
+
+		highest, falling := float32(0), true
+		for i := 0; i < 240; i++ {
+			w.Step(tick)
+			if falling && ball.LinearVelocity.Y > 0 {
+				falling = false
+			}
+			if !falling && ball.Position.Y > highest {
+				highest = ball.Position.Y
+			}
+		}
+		return highest
+	}
+
+	if height := bounce(0); height > 0.6 {
+		t.Errorf("Expected the ball not to bounce, got to %g", height)
+	}
+	// Bouncing back at 0.8 times the speed reaches 0.64 times the height
+	if height := bounce(0.8); !near(height-0.5, 0.64*4.5, 0.4) {
+		t.Errorf("Expected the ball to bounce to about %g, got %g", 0.5+0.64*4.5, height)
+	}
+}
+
+func TestFriction(t *testing.T) {
+	slide := func(friction float32) float32 {
+		w := newTestWorld(nil)
+		ground := addGround(w)
+		ground.Shapes()[0].Friction = friction
+		box := w.NewBody(BodyDynamic, math.Vec2{Y: 0.5})
+		s := NewBox(0.5, 0.5)
+		s.Friction = friction
+		box.AddShape(s)
+		box.LinearVelocity = math.Vec2{X: 5}
+		steps(w, 120)
+		return box.Position.X
+	}
+
+	// Sliding at 5 against a deceleration of 10μ stops after 1.25/μ
+	if distance := slide(0.5); !near(distance, 2.5, 0.2) {
+		t.Errorf("Expected the box to slide about 2.5, got %g", distance)
+	}
+	if distance := slide(0); distance < 9.5 {
+		t.Errorf("Expected the box to slide freely, got %g", distance)
+	}
+}
+
+func TestChainGround(t *testing.T) {
+	w := newTestWorld(nil)
+	ground := w.NewBody(BodyStatic, math.Vec2{})
+	chain, err := NewChain([]math.Vec2{{X: -10, Y: 5}, {X: -5, Y: 0}, {X: 5, Y: 0}, {X: 10, Y: 5}}, false)
+	if err != nil {
+		t.Fatalf("Failed to create chain - %s", err.Error())
+	}
+	ground.AddShape(chain)
+	ball := w.NewBody(BodyDynamic, math.Vec2{Y: 2})
+	ball.AddShape(NewCircle(math.Vec2{}, 0.5))
+
+	steps(w, 120)
+	if !near(ball.Position.Y, 0.5, 2*linearSlop) {
+		t.Errorf("Expected the ball to rest on the chain at 0.5, got %g", ball.Position.Y)
+	}
+}
+
+func TestKinematicBody(t *testing.T) {
+	w := newTestWorld(nil)
+	platform := w.NewBody(BodyKinematic, math.Vec2{})
+	platform.AddShape(NewBox(2, 0.25))
+	platform.LinearVelocity = math.Vec2{X: 1}
+
+	steps(w, 60)
+	if !near(platform.Position.X, 1, 1e-3) || platform.Position.Y != 0 {
+		t.Errorf("Expected the platform to move without falling, got %v", platform.Position)
+	}
+}
+
+func TestCollisionEvents(t *testing.T) {
+	var events []event.Event
+	w := newTestWorld(&events)
+	ground := addGround(w)
+	ball := w.NewBody(BodyDynamic, math.Vec2{Y: 2})
+	ball.AddShape(NewCircle(math.Vec2{X: -0.25}, 0.5))
+	ball.AddShape(NewCircle(math.Vec2{X: 0.25}, 0.5))
+
+	steps(w, 60)
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 collisions to begin, got %v", events)
+	}
+	for _, e := range events {
+		begin, ok := e.(*CollisionBegin)
+		if !ok || e.Type() != event.TypeCollisionBegin || e.Category()&event.CategoryPhysics == 0 {
+			t.Fatalf("Expected a collision to begin, got %s", e)
+		}
+		if begin.A != ground.Shapes()[0] || begin.B.Body() != ball || !near(begin.Normal.Y, 1, 1e-4) {
+			t.Errorf("Unexpected collision %+v", begin)
+		}
+	}
+
+	events = nil
+	ball.LinearVelocity = math.Vec2{Y: 10}
+	steps(w, 5)
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 collisions to end, got %v", events)
+	}
+	for _, e := range events {
+		if _, ok := e.(*CollisionEnd); !ok {
+			t.Errorf("Expected a collision to end, got %s", e)
+		}
+	}
+}
+
+func TestTriggerEvents(t *testing.T) {
+	var events []event.Event
+	w := newTestWorld(&events)
+	zone := w.NewBody(BodyStatic, math.Vec2{})
+	trigger := NewBox(1, 1)
+	trigger.Sensor = true
+	zone.AddShape(trigger)
+	ball := w.NewBody(BodyDynamic, math.Vec2{Y: 3})
+	ball.AddShape(NewCircle(math.Vec2{}, 0.25))
+
+	steps(w, 120)
+	if ball.Position.Y > -3 {
+		t.Errorf("Expected the ball to fall through the trigger, got %v", ball.Position)
+	}
+	if len(events) != 2 {
+		t.Fatalf("Expected the ball to enter and exit, got %v", events)
+	}
+	if enter, ok := events[0].(*TriggerEnter); !ok || enter.Trigger != trigger || enter.Other.Body() != ball {
+		t.Errorf("Expected the ball to enter the trigger, got %s", events[0])
+	}
+	if exit, ok := events[1].(*TriggerExit); !ok || exit.Trigger != trigger || exit.Other.Body() != ball {
+		t.Errorf("Expected the ball to exit the trigger, got %s", events[1])
+	}
+}
+
+func TestDestroyBodyEndsContacts(t *testing.T) {
+	var events []event.Event
+	w := newTestWorld(&events)
+	addGround(w)
+	box := w.NewBody(BodyDynamic, math.Vec2{Y: 0.5})
+	box.AddShape(NewBox(0.5, 0.5))
+	steps(w, 2)
+
+	events = nil
+	w.DestroyBody(box)
+	if len(events) != 1 || events[0].Type() != event.TypeCollisionEnd {
+		t.Errorf("Expected the collision to end, got %v", events)
+	}
+	if len(w.Bodies()) != 1 || len(w.contacts) != 0 {
+		t.Errorf("Expected the box and its contacts to be removed")
+	}
+	steps(w, 2)
+}
+
+func TestDistanceJoint(t *testing.T) {
+	w := newTestWorld(nil)
+	anchor := w.NewBody(BodyStatic, math.Vec2{Y: 10})
+	ball := w.NewBody(BodyDynamic, math.Vec2{X: 3, Y: 10})
+	ball.AddShape(NewCircle(math.Vec2{}, 0.25))
+	w.NewDistanceJoint(anchor, ball, anchor.Position, ball.Position)
+
+	lowest := float32(10)
+	for i := 0; i < 240; i++ {
+		w.Step(tick)
+		if distance := ball.Position.Distance(anchor.Position); !near(distance, 3, 0.05) {
+			t.Fatalf("Expected the pendulum to keep its length of 3, got %g", distance)
+		}
+		if ball.Position.Y < lowest {
+			lowest = ball.Position.Y
+		}
+	}
+	if !near(lowest, 7, 0.05) {
+		t.Errorf("Expected the pendulum to swing down to 7, got %g", lowest)
+	}
+}
+
+func TestRevoluteJointMotor(t *testing.T) {
+	w := newTestWorld(nil)
+	w.Gravity = math.Vec2{}
+	axle := w.NewBody(BodyStatic, math.Vec2{})
+	wheel := w.NewBody(BodyDynamic, math.Vec2{})
+	wheel.AddShape(NewCircle(math.Vec2{}, 1))
+	j := w.NewRevoluteJoint(axle, wheel, math.Vec2{})
+	j.EnableMotor = true
+	j.MotorSpeed = stdmath.Pi
+	j.MaxMotorTorque = 1000
+
+	steps(w, 60)
+	if !near(wheel.AngularVelocity, stdmath.Pi, 1e-3) {
+		t.Errorf("Expected the wheel to turn at the speed of the motor, got %g", wheel.AngularVelocity)
+	}
+	if !near(wheel.Angle, stdmath.Pi, 0.1) || wheel.Position.Len() > 1e-3 {
+		t.Errorf("Expected the wheel to turn half around its axle, got %g at %v", wheel.Angle, wheel.Position)
+	}
+}
+
+func TestWeldJoint(t *testing.T) {
+	w := newTestWorld(nil)
+	wall := w.NewBody(BodyStatic, math.Vec2{})
+	beam := w.NewBody(BodyDynamic, math.Vec2{X: 1})
+	beam.AddShape(NewBox(1, 0.1))
+	w.NewWeldJoint(wall, beam, math.Vec2{})
+
+	steps(w, 120)
+	if !near(beam.Position.X, 1, 0.05) || !near(beam.Position.Y, 0, 0.05) || !near(beam.Angle, 0, 0.05) {
+		t.Errorf("Expected the beam to stay welded to the wall, got %v at %g", beam.Position, beam.Angle)
+	}
+}
+
+func TestDeterminism(t *testing.T) {
+	simulate := func() []math.Vec2 {
+		w := newTestWorld(nil)
+		addGround(w)
+		for i := 0; i < 10; i++ {
+			b := w.NewBody(BodyDynamic, math.Vec2{X: float32(i%3) * 0.7, Y: 1 + float32(i)})
+			if i%2 == 0 {
+				b.AddShape(NewCircle(math.Vec2{}, 0.4))
+			} else {
+				b.AddShape(NewBox(0.4, 0.3))
+			}
+		}
+		steps(w, 200)
+
+		var positions []math.Vec2
+		for _, b := range w.Bodies() {
+			positions = append(positions, b.Position)
+		}
+		return positions
+	}
+
+	first, second := simulate(), simulate()
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("Expected the same simulation twice, body %d ended at %v and %v", i, first[i], second[i])
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package renderer2d
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/graphics"
+	"github.com/lentus/cosmic-engine/cosmic/log"
+	"github.com/lentus/cosmic-engine/cosmic/math"
+	"image"
+	"image/draw"
+	"sort"
+)
+
+// Region is a rectangle of a texture in texture coordinates, where (0, 0) is
+// the top left corner and (1, 1) the bottom right corner.
+type Region struct {
+	Min, Max math.Vec2
+}
+
+// FullRegion covers a whole texture.
+var FullRegion = Region{Max: math.Vec2{X: 1, Y: 1}}
+
+// pixelRegion converts a rectangle in pixels to a region of a texture of the
+// given size.
+func pixelRegion(rect image.Rectangle, width, height int) Region {
+	return Region{
+		Min: math.Vec2{X: float32(rect.Min.X) / float32(width), Y: float32(rect.Min.Y) / float32(height)},
+		Max: math.Vec2{X: float32(rect.Max.X) / float32(width), Y: float32(rect.Max.Y) / float32(height)},
+	}
+}
+
+// Atlas is a texture containing many images, so sprites showing different
+// images can be drawn in the same batch.
+type Atlas struct {
+	Texture graphics.Texture
+	regions map[string]Region
+}
+
+func NewAtlas(texture graphics.Texture) *Atlas {
+	return &Atlas{Texture: texture, regions: make(map[string]Region)}
+}
+
+// Add names the given rectangle of the atlas texture, in pixels.
+func (a *Atlas) Add(name string, rect image.Rectangle) {
+	width, height := a.Texture.Size()
+	a.regions[name] = pixelRegion(rect, width, height)
+}
+
+func (a *Atlas) Region(name string) (Region, bool) {
+	region, ok := a.regions[name]
+	return region, ok
+}
+
+// Sprite returns a sprite showing the named region, with its other fields
+// left to the caller. It panics when the atlas has no such region.
+func (a *Atlas) Sprite(name string) Sprite {
+	region, ok := a.regions[name]
+	if !ok {
+		log.PanicfCore("atlas has no region named %q", name)
+	}
+
+	return Sprite{Texture: a.Texture, Region: region}
+}
+
+// Cell returns the region of the cell at the given column and row of an atlas
+// divided into a grid of equally sized cells, like a sprite sheet.
+func (a *Atlas) Cell(column, row, cellWidth, cellHeight int) Region {
+	width, height := a.Texture.Size()
+	min := image.Pt(column*cellWidth, row*cellHeight)
+
+	return pixelRegion(image.Rectangle{Min: min, Max: min.Add(image.Pt(cellWidth, cellHeight))}, width, height)
+}
+
+// atlasPadding is the number of transparent pixels between packed images, so
+// linear filtering does not blend neighbouring images at their edges.
+const atlasPadding = 1
+
+// PackAtlas packs the images into a single texture. The texture is square,
+// with a power of two size that fits all images, and each image is added as
+// a region with its name.
+func PackAtlas(drawer graphics.Drawer2D, images map[string]*image.RGBA, filter graphics.TextureFilter) *Atlas {
+	names := make([]string, 0, len(images))
+	sizes := make([]image.Point, 0, len(images))
+	for name := range images {
+		names = append(names, name)
+	}
+	// Map iteration order is random, sorting keeps the layout stable
+	sort.Strings(names)
+	for _, name := range names {
+		sizes = append(sizes, images[name].Rect.Size())
+	}
+
+	size, positions := packShelves(sizes)
+	pixels := image.NewRGBA(image.Rect(0, 0, size, size))
+	rects := make([]image.Rectangle, len(names))
+	for i, name := range names {
+		rects[i] = image.Rectangle{Min: positions[i], Max: positions[i].Add(sizes[i])}
+		draw.Draw(pixels, rects[i], images[name], images[name].Rect.Min, draw.Src)
+	}
+
+	atlas := NewAtlas(drawer.CreateTexture(pixels, filter))
+	for i, name := range names {
+		atlas.Add(name, rects[i])
+	}
+
+	return atlas
+}
+
+// packShelves places rectangles in rows, tallest first, in the smallest power
+// of two square they fit in. It returns the size of the square and the
+// position of every rectangle.
+func packShelves(sizes []image.Point) (int, []image.Point) {
+	order := make([]int, len(sizes))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return sizes[order[i]].Y > sizes[order[j]].Y
+	})
+
+	area := 0
+	for _, s := range sizes {
+		area += (s.X + atlasPadding) * (s.Y + atlasPadding)
+	}
+	size := 1
+	for size*size < area {
+		size *= 2
+	}
+
+	for {
+		if positions, ok := tryPackShelves(sizes, order, size); ok {
+			return size, positions
+		}
+		size *= 2
+	}
+}
+
+func tryPackShelves(sizes []image.Point, order []int, size int) ([]image.Point, bool) {
+	positions := make([]image.Point, len(sizes))
+	x, y, shelfHeight := 0, 0, 0
+	for _, i := range order {
+		s := sizes[i]
+		if s.X > size || s.Y > size {
+			return nil, false
+		}
+		if x+s.X > size {
+			x, y = 0, y+shelfHeight+atlasPadding
+			shelfHeight = 0
+		}
+		if y+s.Y > size {
+			return nil, false
+		}
+
+		positions[i] = image.Pt(x, y)
+		x += s.X + atlasPadding
+		if s.Y > shelfHeight {
+			shelfHeight = s.Y
+		}
+	}
+
+	return positions, true
+}
@@ -0,0 +1,345 @@
+// Package renderer2d draws sprites and shapes in batches. Everything drawn
+// between Begin and End is sorted by depth and merged into as few
+// graphics.Batch2D as the texture limit of a batch allows.
+package renderer2d
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/graphics"
+	"github.com/lentus/cosmic-engine/cosmic/log"
+	"github.com/lentus/cosmic-engine/cosmic/math"
+	"image"
+	stdmath "math"
+	"sort"
+)
+
+// Camera provides the matrix that transforms world coordinates to clip space
+// for a frame, like the cameras of package camera.
+type Camera interface {
+	ViewProjection() math.Mat4
+}
+
+// Color is a linear color with straight alpha.
+type Color [4]float32
+
+var (
+	White = Color{1, 1, 1, 1}
+	Black = Color{0, 0, 0, 1}
+)
+
+// maxBatchVertices bounds the size of a single batch, so the geometry buffers
+// of the backend stay reasonably small.
+const maxBatchVertices = 1 << 16
+
+// DefaultCircleSegments is the number of segments circles are tessellated
+// into when Renderer.CircleSegments is not set.
+const DefaultCircleSegments = 48
+
+// Sprite is a textured quad centered on its position.
+type Sprite struct {
+	Position math.Vec2
+	Size     math.Vec2
+	// Counter-clockwise rotation in radians around the position
+	Rotation float32
+	// Sprites with a larger Z are drawn on top, sprites with the same Z in
+	// the order they were drawn.
+	Z float32
+	// Tint multiplies the texels, the zero value draws them unmodified.
+	Tint Color
+	// Texture is nil for a quad of a single color.
+	Texture graphics.Texture
+	// Region is the part of the texture shown, the zero value shows the
+	// whole texture.
+	Region Region
+}
+
+// Stats describes the work done to draw a frame.
+type Stats struct {
+	Batches int
+	// Draw calls recorded for the batches, more than the batches when the
+	// drawer splits them
+	DrawCalls int
+	Quads     int
+	Vertices  int
+	Indices   int
+}
+
+// shape is a range of the vertices and indices drawn this frame. Indices are
+// relative to the first vertex of the shape.
+type shape struct {
+	z                     float32
+	texture               graphics.Texture
+	firstVertex, vertices int
+	firstIndex, indices   int
+}
+
+type Renderer struct {
+	// CircleSegments is the number of segments of a full circle, corners of
+	// rounded rectangles use a quarter of them.
+	CircleSegments int
+
+	drawer      graphics.Drawer2D
+	white       graphics.Texture
+	maxTextures int
+
+	drawing        bool
+	viewProjection math.Mat4
+	shapes         []shape
+	vertices       []graphics.Vertex2D
+	indices        []uint32
+	quads          int
+
+	stats Stats
+}
+
+func New(drawer graphics.Drawer2D) *Renderer {
+	white := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	copy(white.Pix, []uint8{255, 255, 255, 255})
+
+	return &Renderer{
+		CircleSegments: DefaultCircleSegments,
+		drawer:         drawer,
+		white:          drawer.CreateTexture(white, graphics.FilterNearest),
+		maxTextures:    drawer.MaxBatchTextures(),
+	}
+}
+
+func (r *Renderer) Destroy() {
+	r.white.Destroy()
+}
+
+// Begin starts a frame seen through the given camera.
+func (r *Renderer) Begin(camera Camera) {
+	if r.drawing {
+		log.PanicCore("renderer2d: Begin called twice without End")
+	}
+
+	r.drawing = true
+	r.viewProjection = camera.ViewProjection()
+	r.shapes = r.shapes[:0]
+	r.vertices = r.vertices[:0]
+	r.indices = r.indices[:0]
+	r.quads = 0
+}
+
+// End sorts everything drawn since Begin by depth and queues the resulting
+// batches for the next frame of the context.
+func (r *Renderer) End() {
+	if !r.drawing {
+		log.PanicCore("renderer2d: End called without Begin")
+	}
+	r.drawing = false
+
+	sort.SliceStable(r.shapes, func(i, j int) bool {
+		return r.shapes[i].z < r.shapes[j].z
+	})
+
+	r.stats = Stats{Quads: r.quads}
+
+	var batch graphics.Batch2D
+	flush := func() {
+		if len(batch.Indices) == 0 {
+			return
+		}
+
+		batch.ViewProjection = r.viewProjection
+		r.stats.Batches++
+		r.stats.DrawCalls += r.drawer.DrawBatch2D(batch)
+		r.stats.Vertices += len(batch.Vertices)
+		r.stats.Indices += len(batch.Indices)
+		batch = graphics.Batch2D{}
+	}
+
+	for _, s := range r.shapes {
+		if len(batch.Vertices)+s.vertices > maxBatchVertices {
+			flush()
+		}
+
+		slot := textureSlot(batch.Textures, s.texture)
+		if slot < 0 {
+			if len(batch.Textures) == r.maxTextures {
+				flush()
+			}
+			slot = len(batch.Textures)
+			batch.Textures = append(batch.Textures, s.texture)
+		}
+
+		base := uint32(len(batch.Vertices))
+		for _, v := range r.vertices[s.firstVertex : s.firstVertex+s.vertices] {
+			v.Texture = uint32(slot)
+			batch.Vertices = append(batch.Vertices, v)
+		}
+		for _, index := range r.indices[s.firstIndex : s.firstIndex+s.indices] {
+			batch.Indices = append(batch.Indices, base+index)
+		}
+	}
+	flush()
+}
+
+func textureSlot(textures []graphics.Texture, texture graphics.Texture) int {
+	for i, t := range textures {
+		if t == texture {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Stats returns the statistics of the last frame ended.
+func (r *Renderer) Stats() Stats {
+	return r.stats
+}
+
+func (r *Renderer) DrawSprite(sprite Sprite) {
+	tint := sprite.Tint
+	if tint == (Color{}) {
+		tint = White
+	}
+	texture := sprite.Texture
+	if texture == nil {
+		texture = r.white
+	}
+	region := sprite.Region
+	if region == (Region{}) {
+		region = FullRegion
+	}
+
+	half := sprite.Size.Scale(0.5)
+	corners := [4]math.Vec2{
+		{X: -half.X, Y: -half.Y},
+		{X: half.X, Y: -half.Y},
+		{X: half.X, Y: half.Y},
+		{X: -half.X, Y: half.Y},
+	}
+	// Texture coordinates point down, world coordinates up
+	uvs := [4]math.Vec2{
+		{X: region.Min.X, Y: region.Max.Y},
+		{X: region.Max.X, Y: region.Max.Y},
+		{X: region.Max.X, Y: region.Min.Y},
+		{X: region.Min.X, Y: region.Min.Y},
+	}
+
+	s := r.beginShape(sprite.Z, texture)
+	for i, corner := range corners {
+		if sprite.Rotation != 0 {
+			corner = corner.Rotate(sprite.Rotation)
+		}
+		r.vertices = append(r.vertices, graphics.Vertex2D{
+			Position: sprite.Position.Add(corner),
+			UV:       uvs[i],
+			Color:    tint,
+		})
+	}
+	r.indices = append(r.indices, 0, 1, 2, 2, 3, 0)
+	r.endShape(s)
+	r.quads++
+}
+
+// DrawRect draws an axis aligned rectangle centered on the position.
+func (r *Renderer) DrawRect(position, size math.Vec2, z float32, color Color) {
+	r.DrawSprite(Sprite{Position: position, Size: size, Z: z, Tint: color})
+}
+
+// DrawLine draws a line of the given thickness as a quad, without caps.
+func (r *Renderer) DrawLine(from, to math.Vec2, thickness, z float32, color Color) {
+	direction := to.Sub(from)
+	length := direction.Len()
+	if length == 0 {
+		return
+	}
+
+	r.DrawSprite(Sprite{
+		Position: from.Add(direction.Scale(0.5)),
+		Size:     math.Vec2{X: length, Y: thickness},
+		Rotation: float32(stdmath.Atan2(float64(direction.Y), float64(direction.X))),
+		Z:        z,
+		Tint:     color,
+	})
+}
+
+// DrawCircle draws a filled circle as a triangle fan.
+func (r *Renderer) DrawCircle(center math.Vec2, radius, z float32, color Color) {
+	segments := r.circleSegments()
+
+	s := r.beginShape(z, r.white)
+	r.vertices = append(r.vertices, graphics.Vertex2D{Position: center, Color: color})
+	for i := 0; i < segments; i++ {
+		angle := 2 * stdmath.Pi * float64(i) / float64(segments)
+		offset := math.Vec2{X: radius}.Rotate(float32(angle))
+		r.vertices = append(r.vertices, graphics.Vertex2D{Position: center.Add(offset), Color: color})
+	}
+	for i := 0; i < segments; i++ {
+		r.indices = append(r.indices, 0, uint32(1+i), uint32(1+(i+1)%segments))
+	}
+	r.endShape(s)
+}
+
+// DrawRoundedRect draws an axis aligned rectangle centered on the position,
+// with corners rounded by the given radius. The radius is limited to half of
+// the shortest side.
+func (r *Renderer) DrawRoundedRect(position, size math.Vec2, radius, z float32, color Color) {
+	half := size.Scale(0.5)
+	if limit := float32(stdmath.Min(float64(half.X), float64(half.Y))); radius > limit {
+		radius = limit
+	}
+	if radius <= 0 {
+		r.DrawRect(position, size, z, color)
+		return
+	}
+
+	cornerSegments := r.circleSegments() / 4
+	if cornerSegments < 1 {
+		cornerSegments = 1
+	}
+	inner := half.Sub(math.Vec2{X: radius, Y: radius})
+	centers := [4]math.Vec2{
+		{X: inner.X, Y: inner.Y},
+		{X: -inner.X, Y: inner.Y},
+		{X: -inner.X, Y: -inner.Y},
+		{X: inner.X, Y: -inner.Y},
+	}
+
+	// A fan around the center through the arcs of the corners, counter
+	// clockwise starting at the top right corner
+	s := r.beginShape(z, r.white)
+	r.vertices = append(r.vertices, graphics.Vertex2D{Position: position, Color: color})
+	for corner, center := range centers {
+		for i := 0; i <= cornerSegments; i++ {
+			angle := stdmath.Pi / 2 * (float64(corner) + float64(i)/float64(cornerSegments))
+			offset := math.Vec2{X: radius}.Rotate(float32(angle))
+			r.vertices = append(r.vertices, graphics.Vertex2D{Position: position.Add(center).Add(offset), Color: color})
+		}
+	}
+	outline := 4 * (cornerSegments + 1)
+	for i := 0; i < outline; i++ {
+		r.indices = append(r.indices, 0, uint32(1+i), uint32(1+(i+1)%outline))
+	}
+	r.endShape(s)
+}
+
+func (r *Renderer) circleSegments() int {
+	if r.CircleSegments < 3 {
+		return DefaultCircleSegments
+	}
+
+	return r.CircleSegments
+}
+
+func (r *Renderer) beginShape(z float32, texture graphics.Texture) shape {
+	if !r.drawing {
+		log.PanicCore("renderer2d: drawing outside of Begin and End")
+	}
+
+	return shape{
+		z:           z,
+		texture:     texture,
+		firstVertex: len(r.vertices),
+		firstIndex:  len(r.indices),
+	}
+}
+
+func (r *Renderer) endShape(s shape) {
+	s.vertices = len(r.vertices) - s.firstVertex
+	s.indices = len(r.indices) - s.firstIndex
+	r.shapes = append(r.shapes, s)
+}
@@ -0,0 +1,216 @@
+package renderer2d
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/camera"
+	"github.com/lentus/cosmic-engine/cosmic/graphics"
+	"github.com/lentus/cosmic-engine/cosmic/log"
+	"github.com/lentus/cosmic-engine/cosmic/math"
+	"image"
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	log.Init(log.LevelWarn, log.LevelWarn)
+	os.Exit(m.Run())
+}
+
+type fakeTexture struct {
+	width, height int
+}
+
+func (t *fakeTexture) Size() (width, height int) {
+	return t.width, t.height
+}
+
+func (t *fakeTexture) Destroy() {}
+
+// recorder records the batches drawn instead of drawing them.
+type recorder struct {
+	batches     []graphics.Batch2D
+	maxTextures int
+}
+
+func (r *recorder) CreateTexture(img *image.RGBA, filter graphics.TextureFilter, mipmaps ...*image.RGBA) graphics.Texture {
+	return &fakeTexture{img.Rect.Dx(), img.Rect.Dy()}
+}
+
+// DrawBatch2D takes a draw call per texture, like a drawer switching
+// textures between draw calls.
+func (r *recorder) DrawBatch2D(batch graphics.Batch2D) int {
+	r.batches = append(r.batches, batch)
+	return len(batch.Textures)
+}
+
+func (r *recorder) MaxBatchTextures() int {
+	return r.maxTextures
+}
+
+func newTestRenderer() (*Renderer, *recorder) {
+	drawer := &recorder{maxTextures: graphics.MaxBatchTextures}
+	return New(drawer), drawer
+}
+
+var testCamera = camera.NewOrthographic(2, 1, -1, 1)
+
+func TestRenderer_batchesByTexture(t *testing.T) {
+	renderer, drawer := newTestRenderer()
+
+	textures := make([]graphics.Texture, graphics.MaxBatchTextures+1)
+	for i := range textures {
+		textures[i] = &fakeTexture{1, 1}
+	}
+
+	renderer.Begin(testCamera)
+	for _, texture := range textures {
+		renderer.DrawSprite(Sprite{Size: math.Vec2{X: 1, Y: 1}, Texture: texture})
+		// Reusing a texture does not take another slot
+		renderer.DrawSprite(Sprite{Size: math.Vec2{X: 1, Y: 1}, Texture: texture})
+	}
+	renderer.End()
+
+	if len(drawer.batches) != 2 {
+		t.Fatalf("expected 2 batches, got %d", len(drawer.batches))
+	}
+	if n := len(drawer.batches[0].Textures); n != graphics.MaxBatchTextures {
+		t.Errorf("expected the first batch to use %d textures, got %d", graphics.MaxBatchTextures, n)
+	}
+	if n := len(drawer.batches[1].Indices); n != 12 {
+		t.Errorf("expected the second batch to draw 12 indices, got %d", n)
+	}
+
+	last := drawer.batches[1]
+	for _, index := range last.Indices {
+		if v := last.Vertices[index]; last.Textures[v.Texture] != textures[len(textures)-1] {
+			t.Fatalf("vertex %d samples texture slot %d, which is not the last texture", index, v.Texture)
+		}
+	}
+
+	expected := Stats{Batches: 2, DrawCalls: graphics.MaxBatchTextures + 1, Quads: 34, Vertices: 136, Indices: 204}
+	if stats := renderer.Stats(); stats != expected {
+		t.Errorf("expected stats %+v, got %+v", expected, stats)
+	}
+}
+
+func TestRenderer_drawerTextureLimit(t *testing.T) {
+	drawer := &recorder{maxTextures: 2 * graphics.MaxBatchTextures}
+	renderer := New(drawer)
+
+	renderer.Begin(testCamera)
+	for i := 0; i < 2*graphics.MaxBatchTextures+1; i++ {
+		renderer.DrawSprite(Sprite{Size: math.Vec2{X: 1, Y: 1}, Texture: &fakeTexture{1, 1}})
+	}
+	renderer.End()
+
+	if len(drawer.batches) != 2 {
+		t.Fatalf("expected 2 batches, got %d", len(drawer.batches))
+	}
+	if n := len(drawer.batches[0].Textures); n != 2*graphics.MaxBatchTextures {
+		t.Errorf("expected the first batch to use %d textures, got %d", 2*graphics.MaxBatchTextures, n)
+	}
+}
+
+func TestRenderer_sortsByZ(t *testing.T) {
+	renderer, drawer := newTestRenderer()
+
+	renderer.Begin(testCamera)
+	renderer.DrawRect(math.Vec2{}, math.Vec2{X: 1, Y: 1}, 2, Color{1, 0, 0, 1})
+	renderer.DrawRect(math.Vec2{}, math.Vec2{X: 1, Y: 1}, 1, Color{0, 1, 0, 1})
+	renderer.DrawRect(math.Vec2{}, math.Vec2{X: 1, Y: 1}, 2, Color{0, 0, 1, 1})
+	renderer.End()
+
+	if len(drawer.batches) != 1 {
+		t.Fatalf("expected 1 batch, got %d", len(drawer.batches))
+	}
+
+	batch := drawer.batches[0]
+	var colors []Color
+	for i := 0; i < len(batch.Indices); i += 6 {
+		colors = append(colors, batch.Vertices[batch.Indices[i]].Color)
+	}
+	expected := []Color{{0, 1, 0, 1}, {1, 0, 0, 1}, {0, 0, 1, 1}}
+	for i := range expected {
+		if colors[i] != expected[i] {
+			t.Errorf("expected quad %d to have color %v, got %v", i, expected[i], colors[i])
+		}
+	}
+}
+
+func TestRenderer_DrawSprite_rotation(t *testing.T) {
+	renderer, drawer := newTestRenderer()
+
+	renderer.Begin(testCamera)
+	renderer.DrawSprite(Sprite{
+		Position: math.Vec2{X: 5, Y: 5},
+		Size:     math.Vec2{X: 4, Y: 2},
+		Rotation: 3.14159265 / 2,
+	})
+	renderer.End()
+
+	// The bottom left corner ends up at the bottom right after a quarter turn
+	got := drawer.batches[0].Vertices[0].Position
+	if got.Sub(math.Vec2{X: 6, Y: 3}).Len() > 1e-5 {
+		t.Errorf("expected the first corner at (6, 3), got %v", got)
+	}
+}
+
+func TestRenderer_DrawCircle(t *testing.T) {
+	renderer, drawer := newTestRenderer()
+	renderer.CircleSegments = 8
+
+	renderer.Begin(testCamera)
+	renderer.DrawCircle(math.Vec2{X: 1, Y: 1}, 2, 0, White)
+	renderer.End()
+
+	batch := drawer.batches[0]
+	if len(batch.Vertices) != 9 || len(batch.Indices) != 24 {
+		t.Fatalf("expected 9 vertices and 24 indices, got %d and %d", len(batch.Vertices), len(batch.Indices))
+	}
+	for _, v := range batch.Vertices[1:] {
+		if d := v.Position.Sub(math.Vec2{X: 1, Y: 1}).Len(); d < 2-1e-5 || d > 2+1e-5 {
+			t.Errorf("expected outline vertices at distance 2 from the center, got %f", d)
+		}
+	}
+	if renderer.Stats().Quads != 0 {
+		t.Errorf("expected circles not to count as quads")
+	}
+}
+
+func TestPackShelves(t *testing.T) {
+	sizes := []image.Point{{10, 4}, {6, 8}, {16, 2}, {3, 3}, {5, 8}}
+	size, positions := packShelves(sizes)
+
+	if size != 16 {
+		t.Errorf("expected a 16x16 atlas, got %dx%d", size, size)
+	}
+
+	for i := range sizes {
+		a := image.Rectangle{Min: positions[i], Max: positions[i].Add(sizes[i])}
+		if !a.In(image.Rect(0, 0, size, size)) {
+			t.Errorf("rectangle %d at %v is outside of the atlas", i, a)
+		}
+		for j := range sizes[:i] {
+			b := image.Rectangle{Min: positions[j], Max: positions[j].Add(sizes[j])}
+			if a.Overlaps(b) {
+				t.Errorf("rectangle %d at %v overlaps rectangle %d at %v", i, a, j, b)
+			}
+		}
+	}
+}
+
+func TestPackAtlas(t *testing.T) {
+	drawer := &recorder{}
+	atlas := PackAtlas(drawer, map[string]*image.RGBA{
+		"a": image.NewRGBA(image.Rect(0, 0, 4, 4)),
+		"b": image.NewRGBA(image.Rect(0, 0, 2, 4)),
+	}, graphics.FilterNearest)
+
+	region, ok := atlas.Region("b")
+	if !ok {
+		t.Fatal("expected the atlas to have a region named b")
+	}
+	expected := Region{Min: math.Vec2{X: 5.0 / 8}, Max: math.Vec2{X: 7.0 / 8, Y: 4.0 / 8}}
+	if region != expected {
+		t.Errorf("expected region %v, got %v", expected, region)
+	}
+}
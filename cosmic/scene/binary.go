@@ -0,0 +1,200 @@
+package scene
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/lentus/cosmic-engine/cosmic/internal/binfmt"
+	stdmath "math"
+	"sort"
+)
+
+// Binary scene files start with the magic, followed by the document with
+// integers as varints, IDs and floats little endian and strings prefixed by
+// their length. Component data is encoded as tagged values.
+const binaryMagic = "CSCN"
+
+// Tags of the values in component data.
+const (
+	tagNull byte = iota
+	tagFalse
+	tagTrue
+	tagNumber
+	tagString
+	tagArray
+	tagObject
+)
+
+// maxBinaryLength limits the lengths read from a file, so a corrupt file does
+// not make the reader allocate huge buffers.
+const maxBinaryLength = 1 << 26
+
+func writeValue(w *binfmt.Writer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		w.Byte(tagNull)
+	case bool:
+		if v {
+			w.Byte(tagTrue)
+		} else {
+			w.Byte(tagFalse)
+		}
+	case float64:
+		w.Byte(tagNumber)
+		w.Uint64(stdmath.Float64bits(v))
+	case string:
+		w.Byte(tagString)
+		w.String(v)
+	case []interface{}:
+		w.Byte(tagArray)
+		w.Uvarint(uint64(len(v)))
+		for _, element := range v {
+			if err := writeValue(w, element); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		w.Byte(tagObject)
+		w.Uvarint(uint64(len(v)))
+
+		// Sorted keys keep the output of equal scenes equal
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			w.String(key)
+			if err := writeValue(w, v[key]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("cannot encode value of type %T", v)
+	}
+
+	return nil
+}
+
+func writeBinary(out *bufio.Writer, doc document) error {
+	w := binfmt.NewWriter(out)
+	w.Write([]byte(binaryMagic))
+	w.Uvarint(uint64(doc.Version))
+	w.String(doc.Name)
+	w.Uint64(uint64(doc.ActiveCamera))
+
+	w.Uvarint(uint64(len(doc.Nodes)))
+	for _, node := range doc.Nodes {
+		w.Uint64(uint64(node.ID))
+		w.Uint64(uint64(node.Parent))
+		w.String(node.Name)
+		for _, f := range node.Translation {
+			w.Float32(f)
+		}
+		for _, f := range node.Rotation {
+			w.Float32(f)
+		}
+		for _, f := range node.Scale {
+			w.Float32(f)
+		}
+
+		w.Uvarint(uint64(len(node.Components)))
+		for _, component := range node.Components {
+			w.String(component.Type)
+			w.Uvarint(uint64(component.Version))
+			if err := writeValue(w, component.Data); err != nil {
+				return fmt.Errorf("node %s (%s): %s: %s", node.Name, node.ID, component.Type, err.Error())
+			}
+		}
+	}
+
+	return nil
+}
+
+func readValue(r *binfmt.Reader, depth int) interface{} {
+	if depth > 64 {
+		r.Fail(fmt.Errorf("component data is nested too deeply"))
+		return nil
+	}
+
+	tag := r.Byte()
+	if r.Err() != nil {
+		return nil
+	}
+
+	switch tag {
+	case tagNull:
+		return nil
+	case tagFalse:
+		return false
+	case tagTrue:
+		return true
+	case tagNumber:
+		return stdmath.Float64frombits(r.Uint64())
+	case tagString:
+		return r.String()
+	case tagArray:
+		n := r.Length()
+		array := make([]interface{}, 0, binfmt.Capacity(n))
+		for i := 0; i < n && r.Err() == nil; i++ {
+			array = append(array, readValue(r, depth+1))
+		}
+		return array
+	case tagObject:
+		n := r.Length()
+		object := make(map[string]interface{}, binfmt.Capacity(n))
+		for i := 0; i < n && r.Err() == nil; i++ {
+			key := r.String()
+			object[key] = readValue(r, depth+1)
+		}
+		return object
+	default:
+		r.Fail(fmt.Errorf("invalid value tag %d", tag))
+		return nil
+	}
+}
+
+func readBinary(in *bufio.Reader) (document, error) {
+	r := binfmt.NewReader(in, maxBinaryLength)
+	if _, err := in.Discard(len(binaryMagic)); err != nil {
+		return document{}, err
+	}
+
+	doc := document{Format: formatName}
+	doc.Version = r.Length()
+	doc.Name = r.String()
+	doc.ActiveCamera = ID(r.Uint64())
+
+	nodes := r.Length()
+	doc.Nodes = make([]nodeDocument, 0, binfmt.Capacity(nodes))
+	for i := 0; i < nodes && r.Err() == nil; i++ {
+		var node nodeDocument
+		node.ID = ID(r.Uint64())
+		node.Parent = ID(r.Uint64())
+		node.Name = r.String()
+		for j := range node.Translation {
+			node.Translation[j] = r.Float32()
+		}
+		for j := range node.Rotation {
+			node.Rotation[j] = r.Float32()
+		}
+		for j := range node.Scale {
+			node.Scale[j] = r.Float32()
+		}
+
+		components := r.Length()
+		for j := 0; j < components && r.Err() == nil; j++ {
+			var component componentDocument
+			component.Type = r.String()
+			component.Version = r.Length()
+			component.Data = readValue(r, 0)
+			node.Components = append(node.Components, component)
+		}
+
+		doc.Nodes = append(doc.Nodes, node)
+	}
+
+	if r.Err() != nil {
+		return document{}, fmt.Errorf("invalid binary scene: %s", r.Err().Error())
+	}
+	return doc, nil
+}
@@ -0,0 +1,235 @@
+package scene
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/lentus/cosmic-engine/cosmic/camera"
+	"github.com/lentus/cosmic-engine/cosmic/event"
+	"github.com/lentus/cosmic-engine/cosmic/graphics"
+	"github.com/lentus/cosmic-engine/cosmic/math"
+	"github.com/lentus/cosmic-engine/cosmic/mesh"
+)
+
+// Component is data or behaviour attached to a node. Components may
+// implement Attacher, Updater and EventHandler to be told about the node and
+// the scene.
+type Component interface{}
+
+// Attacher is implemented by components that need to know when they are
+// attached to or detached from a node.
+type Attacher interface {
+	OnAttach(n *Node)
+	OnDetach(n *Node)
+}
+
+// Updater is implemented by components that update every frame.
+type Updater interface {
+	OnUpdate(n *Node, delta float32)
+}
+
+// EventHandler is implemented by components receiving the events of the
+// scene. Events marked as handled are not passed to later components.
+type EventHandler interface {
+	OnEvent(n *Node, e event.Event)
+}
+
+// AddComponent attaches the component to the node.
+func (n *Node) AddComponent(c Component) {
+	n.components = append(n.components, c)
+	if a, ok := c.(Attacher); ok {
+		a.OnAttach(n)
+	}
+}
+
+// RemoveComponent detaches the component from the node, if attached.
+func (n *Node) RemoveComponent(c Component) {
+	for i, component := range n.components {
+		if component == c {
+			n.components = append(n.components[:i], n.components[i+1:]...)
+			if a, ok := c.(Attacher); ok {
+				a.OnDetach(n)
+			}
+			return
+		}
+	}
+}
+
+// Components returns the components of the node, which must not be modified.
+func (n *Node) Components() []Component {
+	return n.components
+}
+
+// ComponentOf returns the first component of the node of type T.
+func ComponentOf[T Component](n *Node) (T, bool) {
+	for _, c := range n.components {
+		if t, ok := c.(T); ok {
+			return t, true
+		}
+	}
+
+	var zero T
+	return zero, false
+}
+
+// MeshRenderer draws a mesh at the node.
+type MeshRenderer struct {
+	// Model the mesh is loaded from when the scene is loaded, and the index
+	// of the mesh in the model.
+	Model     AssetRef `json:"model"`
+	MeshIndex int      `json:"mesh"`
+
+	Mesh *mesh.Mesh `json:"-"`
+	// Materials of the submeshes, indexed by Submesh.Material.
+	Materials []mesh.Material `json:"-"`
+	// Buffers holds the mesh in gpu memory, once uploaded.
+	Buffers graphics.MeshBuffers `json:"-"`
+
+	bounds    math.AABB
+	hasBounds bool
+}
+
+// Bounds returns the box containing the mesh, relative to the node.
+func (r *MeshRenderer) Bounds() math.AABB {
+	if !r.hasBounds {
+		r.bounds = r.Mesh.Bounds()
+		r.hasBounds = true
+	}
+
+	return r.bounds
+}
+
+// Material returns the material of a submesh.
+func (r *MeshRenderer) Material(submesh mesh.Submesh) mesh.Material {
+	if submesh.Material < 0 || submesh.Material >= len(r.Materials) {
+		return mesh.DefaultMaterial()
+	}
+
+	return r.Materials[submesh.Material]
+}
+
+// Camera views the scene from the node. The transform of the camera follows
+// the node every frame, so the camera is moved by moving the node.
+type Camera struct {
+	Camera camera.Camera
+}
+
+// cameraData is the saved form of a camera, whose transform is not saved as
+// it follows the node.
+type cameraData struct {
+	Projection  string  `json:"projection"`
+	FieldOfView float32 `json:"fieldOfView,omitempty"`
+	Height      float32 `json:"height,omitempty"`
+	Aspect      float32 `json:"aspect"`
+	Near        float32 `json:"near"`
+	Far         float32 `json:"far"`
+	ReversedZ   bool    `json:"reversedZ,omitempty"`
+}
+
+func (c *Camera) MarshalJSON() ([]byte, error) {
+	var data cameraData
+	switch projection := c.Camera.(type) {
+	case *camera.Perspective:
+		data = cameraData{"perspective", projection.FieldOfView, 0, projection.Aspect, projection.Near, projection.Far, projection.ReversedZ}
+	case *camera.Orthographic:
+		data = cameraData{"orthographic", 0, projection.Height, projection.Aspect, projection.Near, projection.Far, projection.ReversedZ}
+	default:
+		return nil, fmt.Errorf("cannot save camera of type %T", c.Camera)
+	}
+
+	return json.Marshal(data)
+}
+
+func (c *Camera) UnmarshalJSON(text []byte) error {
+	var data cameraData
+	if err := json.Unmarshal(text, &data); err != nil {
+		return err
+	}
+
+	switch data.Projection {
+	case "perspective":
+		perspective := camera.NewPerspective(data.FieldOfView, data.Aspect, data.Near, data.Far)
+		perspective.ReversedZ = data.ReversedZ
+		c.Camera = perspective
+	case "orthographic":
+		orthographic := camera.NewOrthographic(data.Height, data.Aspect, data.Near, data.Far)
+		orthographic.ReversedZ = data.ReversedZ
+		c.Camera = orthographic
+	default:
+		return fmt.Errorf("invalid camera projection %q", data.Projection)
+	}
+
+	return nil
+}
+
+// sync moves the camera to the node, ignoring any scale of the node.
+func (c *Camera) sync(n *Node) {
+	translation, rotation, _ := n.World().Decompose()
+	transform := c.Camera.GetTransform()
+	transform.Position = translation
+	transform.Orientation = rotation
+}
+
+type LightType int
+
+const (
+	// Directional lights shine along the forward direction of their node,
+	// from infinitely far away.
+	Directional LightType = iota
+	// Point lights shine in all directions from the position of their node.
+	Point
+	// Spot lights shine in a cone around the forward direction of their
+	// node.
+	Spot
+)
+
+var lightTypeNames = []string{"directional", "point", "spot"}
+
+func (t LightType) MarshalText() ([]byte, error) {
+	if t < 0 || int(t) >= len(lightTypeNames) {
+		return nil, fmt.Errorf("invalid light type %d", t)
+	}
+	return []byte(lightTypeNames[t]), nil
+}
+
+func (t *LightType) UnmarshalText(text []byte) error {
+	for i, name := range lightTypeNames {
+		if string(text) == name {
+			*t = LightType(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid light type %q", text)
+}
+
+// Light illuminates the scene from the node.
+type Light struct {
+	Type LightType `json:"type"`
+	// Linear color of the light
+	Color     math.Vec3 `json:"color"`
+	Intensity float32   `json:"intensity"`
+	// Distance beyond which point and spot lights have no effect.
+	Range float32 `json:"range,omitempty"`
+	// Angles in radians between the direction of a spot light and the edges
+	// of its inner, fully lit cone and its outer cone.
+	InnerAngle float32 `json:"innerAngle,omitempty"`
+	OuterAngle float32 `json:"outerAngle,omitempty"`
+}
+
+// Script runs game logic for the node every frame.
+type Script struct {
+	Update func(n *Node, delta float32)
+	// Event is called for events reaching the scene, nil to ignore them.
+	Event func(n *Node, e event.Event)
+}
+
+func (s *Script) OnUpdate(n *Node, delta float32) {
+	if s.Update != nil {
+		s.Update(n, delta)
+	}
+}
+
+func (s *Script) OnEvent(n *Node, e event.Event) {
+	if s.Event != nil {
+		s.Event(n, e)
+	}
+}
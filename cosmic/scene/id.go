@@ -0,0 +1,50 @@
+package scene
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+)
+
+// ID identifies a node across saves of its scene. IDs are random, so nodes
+// created independently, like in two copies of a level, do not collide when
+// merged. The zero ID refers to no node.
+type ID uint64
+
+func newID() ID {
+	var data [8]byte
+	for {
+		if _, err := rand.Read(data[:]); err != nil {
+			panic(fmt.Sprintf("failed to generate a node ID - %s", err.Error()))
+		}
+		if id := ID(binary.LittleEndian.Uint64(data[:])); id != 0 {
+			return id
+		}
+	}
+}
+
+// String formats the ID as 16 hexadecimal digits.
+func (id ID) String() string {
+	return fmt.Sprintf("%016x", uint64(id))
+}
+
+func ParseID(s string) (ID, error) {
+	id, err := strconv.ParseUint(s, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid node ID %q", s)
+	}
+
+	return ID(id), nil
+}
+
+// IDs are text in scene files, as JSON numbers cannot hold 64 bit integers.
+func (id ID) MarshalText() ([]byte, error) {
+	return []byte(id.String()), nil
+}
+
+func (id *ID) UnmarshalText(text []byte) error {
+	parsed, err := ParseID(string(text))
+	*id = parsed
+	return err
+}
@@ -0,0 +1,199 @@
+// Package scene organizes a world as a tree of nodes with transforms relative
+// to their parent. Components attached to nodes give them meshes, cameras,
+// lights and behaviour, and a scene is run by pushing it onto the layer stack
+// of the application.
+package scene
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/math"
+)
+
+// Node is a transform in the tree of a scene. World matrices are computed
+// when needed, and only again after the node or one of its ancestors moved.
+type Node struct {
+	// ID is kept when the scene is saved and loaded.
+	ID   ID
+	Name string
+
+	translation math.Vec3
+	rotation    math.Quat
+	scale       math.Vec3
+
+	local      math.Mat4
+	world      math.Mat4
+	localDirty bool
+	// A dirty node has only dirty descendants, so invalidating a subtree
+	// stops at nodes that are already dirty.
+	worldDirty bool
+
+	parent     *Node
+	children   []*Node
+	components []Component
+}
+
+func NewNode(name string) *Node {
+	return &Node{
+		ID:         newID(),
+		Name:       name,
+		rotation:   math.IdentityQuat(),
+		scale:      math.Vec3{X: 1, Y: 1, Z: 1},
+		localDirty: true,
+		worldDirty: true,
+	}
+}
+
+func (n *Node) Translation() math.Vec3 {
+	return n.translation
+}
+
+func (n *Node) Rotation() math.Quat {
+	return n.rotation
+}
+
+func (n *Node) Scale() math.Vec3 {
+	return n.scale
+}
+
+func (n *Node) SetTranslation(translation math.Vec3) {
+	n.translation = translation
+	n.invalidate()
+}
+
+func (n *Node) SetRotation(rotation math.Quat) {
+	n.rotation = rotation
+	n.invalidate()
+}
+
+func (n *Node) SetScale(scale math.Vec3) {
+	n.scale = scale
+	n.invalidate()
+}
+
+// SetLocal sets the transform relative to the parent from a matrix, which
+// must not contain shear.
+func (n *Node) SetLocal(m math.Mat4) {
+	n.translation, n.rotation, n.scale = m.Decompose()
+	n.invalidate()
+}
+
+// Local returns the transform relative to the parent.
+func (n *Node) Local() math.Mat4 {
+	if n.localDirty {
+		n.local = math.TRS(n.translation, n.rotation, n.scale)
+		n.localDirty = false
+	}
+
+	return n.local
+}
+
+// World returns the transform relative to the root of the tree.
+func (n *Node) World() math.Mat4 {
+	if n.worldDirty {
+		if n.parent != nil {
+			n.world = n.parent.World().Mul(n.Local())
+		} else {
+			n.world = n.Local()
+		}
+		n.worldDirty = false
+	}
+
+	return n.world
+}
+
+// WorldPosition returns the origin of the node in world space.
+func (n *Node) WorldPosition() math.Vec3 {
+	return n.World().Column(3).XYZ()
+}
+
+// Forward returns the -z axis of the node in world space, the direction
+// cameras and lights point in.
+func (n *Node) Forward() math.Vec3 {
+	return n.World().MulDirection(math.Vec3{Z: -1}).Normalize()
+}
+
+func (n *Node) invalidate() {
+	n.localDirty = true
+	n.invalidateWorld()
+}
+
+func (n *Node) invalidateWorld() {
+	if n.worldDirty {
+		return
+	}
+
+	n.worldDirty = true
+	for _, child := range n.children {
+		child.invalidateWorld()
+	}
+}
+
+func (n *Node) Parent() *Node {
+	return n.parent
+}
+
+// Children returns the children of the node, which must not be modified.
+func (n *Node) Children() []*Node {
+	return n.children
+}
+
+// AddChild makes child a child of the node, removing it from its previous
+// parent. Its local transform is kept, so it moves along with its new parent.
+func (n *Node) AddChild(child *Node) {
+	for ancestor := n; ancestor != nil; ancestor = ancestor.parent {
+		if ancestor == child {
+			panic("cannot add a node to its own subtree")
+		}
+	}
+
+	child.Detach()
+	child.parent = n
+	n.children = append(n.children, child)
+	child.invalidateWorld()
+}
+
+// Detach removes the node from its parent, making it the root of its
+// subtree.
+func (n *Node) Detach() {
+	if n.parent == nil {
+		return
+	}
+
+	siblings := n.parent.children
+	for i, sibling := range siblings {
+		if sibling == n {
+			copy(siblings[i:], siblings[i+1:])
+			siblings[len(siblings)-1] = nil
+			n.parent.children = siblings[:len(siblings)-1]
+			break
+		}
+	}
+
+	n.parent = nil
+	n.invalidateWorld()
+}
+
+// Walk calls f for the node and its descendants, depth first with parents
+// before their children. The children of a node are skipped when f returns
+// false for it.
+func (n *Node) Walk(f func(n *Node) bool) {
+	if !f(n) {
+		return
+	}
+
+	for _, child := range n.children {
+		child.Walk(f)
+	}
+}
+
+// Find returns the first node in the subtree with the name, or nil.
+func (n *Node) Find(name string) *Node {
+	var found *Node
+	n.Walk(func(node *Node) bool {
+		if found == nil && node.Name == name {
+			found = node
+		}
+		return found == nil
+	})
+
+	return found
+}
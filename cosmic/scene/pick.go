@@ -0,0 +1,94 @@
+package scene
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/math"
+	"github.com/lentus/cosmic-engine/cosmic/mesh"
+)
+
+// Hit is where a ray hits a mesh of the scene.
+type Hit struct {
+	Node     *Node
+	Renderer *MeshRenderer
+	// Distance along the ray, in units of the length of its direction.
+	Distance float32
+	Point    math.Vec3
+}
+
+// Pick returns the closest mesh triangle hit by the ray, and false when the
+// ray hits nothing. Both sides of triangles are hit.
+func (s *Scene) Pick(ray math.Ray) (Hit, bool) {
+	var closest Hit
+	found := false
+
+	s.Root.Walk(func(n *Node) bool {
+		for _, c := range n.components {
+			r, ok := c.(*MeshRenderer)
+			if !ok || r.Mesh == nil {
+				continue
+			}
+
+			world := n.World()
+			enter, ok := ray.IntersectAABB(r.Bounds().Transform(world))
+			if !ok || found && enter > closest.Distance {
+				continue
+			}
+
+			// Intersecting in the space of the mesh keeps distances along the
+			// ray, as the direction is transformed without normalizing it
+			inverse, ok := world.Inverse()
+			if !ok {
+				continue
+			}
+			local := math.Ray{Origin: inverse.MulPoint(ray.Origin), Direction: inverse.MulDirection(ray.Direction)}
+			if t, ok := intersectMesh(local, r.Mesh.Vertices, r.Mesh.Indices); ok && (!found || t < closest.Distance) {
+				closest = Hit{Node: n, Renderer: r, Distance: t, Point: ray.At(t)}
+				found = true
+			}
+		}
+		return true
+	})
+
+	return closest, found
+}
+
+// intersectMesh returns the distance to the closest triangle hit by the ray.
+func intersectMesh(ray math.Ray, vertices []mesh.Vertex, indices []uint32) (float32, bool) {
+	var closest float32
+	found := false
+	for i := 0; i+2 < len(indices); i += 3 {
+		t, ok := intersectTriangle(ray, vertices[indices[i]].Position, vertices[indices[i+1]].Position, vertices[indices[i+2]].Position)
+		if ok && (!found || t < closest) {
+			closest, found = t, true
+		}
+	}
+
+	return closest, found
+}
+
+// intersectTriangle implements the Möller-Trumbore algorithm.
+func intersectTriangle(ray math.Ray, p0, p1, p2 math.Vec3) (float32, bool) {
+	const epsilon = 1e-7
+
+	e1, e2 := p1.Sub(p0), p2.Sub(p0)
+	p := ray.Direction.Cross(e2)
+	det := e1.Dot(p)
+	if det > -epsilon && det < epsilon {
+		return 0, false
+	}
+	inverse := 1 / det
+
+	s := ray.Origin.Sub(p0)
+	u := s.Dot(p) * inverse
+	if u < 0 || u > 1 {
+		return 0, false
+	}
+
+	q := s.Cross(e1)
+	v := ray.Direction.Dot(q) * inverse
+	if v < 0 || u+v > 1 {
+		return 0, false
+	}
+
+	t := e2.Dot(q) * inverse
+	return t, t >= 0
+}
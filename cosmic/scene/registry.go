@@ -0,0 +1,97 @@
+package scene
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// AssetRef refers to an asset a component uses, by the path of its file or by
+// a GUID that stays the same when the file is moved. Assets are resolved when
+// a scene is loaded, see LoadOptions.
+type AssetRef struct {
+	Path string `json:"path,omitempty"`
+	GUID string `json:"guid,omitempty"`
+}
+
+func (r AssetRef) IsZero() bool {
+	return r.Path == "" && r.GUID == ""
+}
+
+func (r AssetRef) String() string {
+	if r.GUID != "" {
+		return r.GUID
+	}
+	return r.Path
+}
+
+// ComponentType describes how components of a type are saved. Components
+// are saved as JSON with encoding/json, so their exported fields and
+// json.Marshaler implementations determine what is saved.
+type ComponentType struct {
+	// Name identifies the type in scene files, and must not change.
+	Name string
+	// Version of the saved form of the component, starting at 1. It is
+	// incremented when fields are renamed or change meaning.
+	Version int
+	// New returns a pointer to a new component to load into.
+	New func() Component
+	// Migrate converts the data of a component saved with an older version
+	// to the current version. The data is decoded JSON: maps, slices,
+	// strings, float64s, bools and nils.
+	Migrate func(version int, data interface{}) (interface{}, error)
+}
+
+var registry struct {
+	mutex  sync.RWMutex
+	byName map[string]*ComponentType
+	byType map[reflect.Type]*ComponentType
+}
+
+// RegisterComponent makes components of a type savable. It panics when the
+// name or the type is registered already.
+func RegisterComponent(t ComponentType) {
+	if t.Name == "" || t.Version < 1 || t.New == nil {
+		panic(fmt.Sprintf("component type %q needs a name, a version of at least 1 and a New function", t.Name))
+	}
+	goType := reflect.TypeOf(t.New())
+
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	if registry.byName == nil {
+		registry.byName = make(map[string]*ComponentType)
+		registry.byType = make(map[reflect.Type]*ComponentType)
+	}
+	if _, ok := registry.byName[t.Name]; ok {
+		panic(fmt.Sprintf("component type %q is registered already", t.Name))
+	}
+	if _, ok := registry.byType[goType]; ok {
+		panic(fmt.Sprintf("component type %s is registered already", goType))
+	}
+
+	registry.byName[t.Name] = &t
+	registry.byType[goType] = &t
+}
+
+func componentTypeByName(name string) (*ComponentType, bool) {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+
+	t, ok := registry.byName[name]
+	return t, ok
+}
+
+func componentTypeOf(c Component) (*ComponentType, bool) {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+
+	t, ok := registry.byType[reflect.TypeOf(c)]
+	return t, ok
+}
+
+func init() {
+	RegisterComponent(ComponentType{Name: "mesh", Version: 1, New: func() Component { return &MeshRenderer{} }})
+	RegisterComponent(ComponentType{Name: "camera", Version: 1, New: func() Component { return &Camera{} }})
+	RegisterComponent(ComponentType{Name: "light", Version: 1, New: func() Component { return &Light{} }})
+}
@@ -0,0 +1,212 @@
+package scene
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/event"
+	"github.com/lentus/cosmic-engine/cosmic/math"
+	"github.com/lentus/cosmic-engine/cosmic/mesh"
+	"time"
+)
+
+// Scene is a tree of nodes, updated as a layer. Pushing a scene onto the
+// layer stack of the application passes it updates and events, which it
+// forwards to the components of its nodes.
+type Scene struct {
+	Name string
+	Root *Node
+	// ActiveCamera is the camera the scene is rendered with.
+	ActiveCamera *Camera
+
+	last time.Time
+}
+
+func New(name string) *Scene {
+	return &Scene{
+		Name: name,
+		Root: NewNode(name),
+	}
+}
+
+// Add adds a node to the root of the scene.
+func (s *Scene) Add(n *Node) {
+	s.Root.AddChild(n)
+}
+
+// Find returns the first node with the name, or nil.
+func (s *Scene) Find(name string) *Node {
+	return s.Root.Find(name)
+}
+
+func (s *Scene) OnAttach() {
+	s.last = time.Time{}
+}
+
+func (s *Scene) OnDetach() {}
+
+// OnUpdate updates the scene with the time since the previous frame.
+func (s *Scene) OnUpdate() {
+	now := time.Now()
+	var delta float32
+	if !s.last.IsZero() {
+		delta = float32(now.Sub(s.last).Seconds())
+	}
+	s.last = now
+
+	s.Update(delta)
+}
+
+// Update calls the updaters of all nodes, parents before their children,
+// and then moves the cameras to their nodes.
+func (s *Scene) Update(delta float32) {
+	var updaters []Updater
+	var nodes []*Node
+	s.Root.Walk(func(n *Node) bool {
+		for _, c := range n.components {
+			if u, ok := c.(Updater); ok {
+				updaters = append(updaters, u)
+				nodes = append(nodes, n)
+			}
+		}
+		return true
+	})
+
+	// Updaters may change the tree, so they are collected first
+	for i, u := range updaters {
+		u.OnUpdate(nodes[i], delta)
+	}
+
+	s.Root.Walk(func(n *Node) bool {
+		for _, c := range n.components {
+			if c, ok := c.(*Camera); ok {
+				c.sync(n)
+			}
+		}
+		return true
+	})
+}
+
+// OnEvent resizes the cameras of the scene with the window, and passes the
+// event to the event handlers of its nodes until it is handled.
+func (s *Scene) OnEvent(e event.Event) {
+	if resize, ok := e.(*event.WindowResize); ok && resize.Width > 0 && resize.Height > 0 {
+		aspect := float32(resize.Width) / float32(resize.Height)
+		s.Root.Walk(func(n *Node) bool {
+			for _, c := range n.components {
+				if c, ok := c.(*Camera); ok {
+					c.Camera.SetAspect(aspect)
+				}
+			}
+			return true
+		})
+	}
+
+	s.Root.Walk(func(n *Node) bool {
+		for _, c := range n.components {
+			if e.IsHandled() {
+				return false
+			}
+			if h, ok := c.(EventHandler); ok {
+				h.OnEvent(n, e)
+			}
+		}
+		return !e.IsHandled()
+	})
+}
+
+// Renderable is a mesh to draw with its world transform.
+type Renderable struct {
+	Node     *Node
+	Renderer *MeshRenderer
+	World    math.Mat4
+}
+
+// Renderables returns the meshes of the scene visible to a camera with the
+// view projection matrix, leaving out the ones outside of its frustum.
+func (s *Scene) Renderables(viewProjection math.Mat4) []Renderable {
+	frustum := math.FrustumFromMatrix(viewProjection)
+
+	var renderables []Renderable
+	s.Root.Walk(func(n *Node) bool {
+		for _, c := range n.components {
+			r, ok := c.(*MeshRenderer)
+			if !ok || r.Mesh == nil {
+				continue
+			}
+
+			world := n.World()
+			if frustum.IntersectsAABB(r.Bounds().Transform(world)) {
+				renderables = append(renderables, Renderable{Node: n, Renderer: r, World: world})
+			}
+		}
+		return true
+	})
+
+	return renderables
+}
+
+// Visible returns the meshes visible to the active camera, none when the
+// scene has no active camera.
+func (s *Scene) Visible() []Renderable {
+	if s.ActiveCamera == nil {
+		return nil
+	}
+
+	return s.Renderables(s.ActiveCamera.Camera.ViewProjection())
+}
+
+// LightInstance is a light placed in the world.
+type LightInstance struct {
+	Node      *Node
+	Light     *Light
+	Position  math.Vec3
+	Direction math.Vec3
+}
+
+// Lights returns the lights of the scene.
+func (s *Scene) Lights() []LightInstance {
+	var lights []LightInstance
+	s.Root.Walk(func(n *Node) bool {
+		for _, c := range n.components {
+			if l, ok := c.(*Light); ok {
+				lights = append(lights, LightInstance{
+					Node:      n,
+					Light:     l,
+					Position:  n.WorldPosition(),
+					Direction: n.Forward(),
+				})
+			}
+		}
+		return true
+	})
+
+	return lights
+}
+
+// NodeFromModel builds the node hierarchy of a model, with mesh renderers for
+// its meshes. Models with several roots get a node with the name as their
+// parent.
+func NodeFromModel(name string, model *mesh.Model) *Node {
+	nodes := make([]*Node, len(model.Nodes))
+	for i, source := range model.Nodes {
+		n := NewNode(source.Name)
+		n.translation, n.rotation, n.scale = source.Translation, source.Rotation, source.Scale
+		if source.Mesh >= 0 {
+			n.AddComponent(&MeshRenderer{MeshIndex: source.Mesh, Mesh: &model.Meshes[source.Mesh], Materials: model.Materials})
+		}
+		nodes[i] = n
+	}
+	for i, source := range model.Nodes {
+		for _, child := range source.Children {
+			nodes[i].AddChild(nodes[child])
+		}
+	}
+
+	if len(model.Roots) == 1 {
+		return nodes[model.Roots[0]]
+	}
+
+	root := NewNode(name)
+	for _, i := range model.Roots {
+		root.AddChild(nodes[i])
+	}
+	return root
+}
@@ -0,0 +1,276 @@
+package scene
+
+import (
+	"github.com/lentus/cosmic-engine/cosmic/camera"
+	"github.com/lentus/cosmic-engine/cosmic/event"
+	"github.com/lentus/cosmic-engine/cosmic/input"
+	"github.com/lentus/cosmic-engine/cosmic/layer"
+	"github.com/lentus/cosmic-engine/cosmic/math"
+	"github.com/lentus/cosmic-engine/cosmic/mesh"
+	stdmath "math"
+	"testing"
+)
+
+// The scene is pushed onto layer stacks.
+var _ layer.Layer = &Scene{}
+
+func nearVec3(a, b math.Vec3) bool {
+	return a.Sub(b).Len() < 1e-4
+}
+
+// quad returns a mesh with a 2x2 quad in the xy plane, facing +z.
+func quad() *mesh.Mesh {
+	return &mesh.Mesh{
+		Vertices: []mesh.Vertex{
+			{Position: math.Vec3{X: -1, Y: -1}},
+			{Position: math.Vec3{X: 1, Y: -1}},
+			{Position: math.Vec3{X: 1, Y: 1}},
+			{Position: math.Vec3{X: -1, Y: 1}},
+		},
+		Indices:   []uint32{0, 1, 2, 0, 2, 3},
+		Submeshes: []mesh.Submesh{{FirstIndex: 0, IndexCount: 6, Material: -1}},
+	}
+}
+
+func TestNode_World(t *testing.T) {
+	parent, child, grandchild := NewNode("parent"), NewNode("child"), NewNode("grandchild")
+	parent.AddChild(child)
+	child.AddChild(grandchild)
+
+	parent.SetTranslation(math.Vec3{X: 10})
+	parent.SetRotation(math.QuatAxisAngle(math.Vec3{Z: 1}, stdmath.Pi/2))
+	child.SetTranslation(math.Vec3{X: 1})
+	child.SetScale(math.Vec3{X: 2, Y: 2, Z: 2})
+	grandchild.SetTranslation(math.Vec3{X: 1})
+
+	// The child is rotated onto +y, and the grandchild scaled away from it
+	if p := grandchild.WorldPosition(); !nearVec3(p, math.Vec3{X: 10, Y: 3}) {
+		t.Errorf("expected grandchild at (10, 3, 0), got %v", p)
+	}
+	expected, world := child.World().Mul(grandchild.Local()), grandchild.World()
+	for i := range expected {
+		if stdmath.Abs(float64(expected[i]-world[i])) > 1e-5 {
+			t.Fatalf("expected the world matrix to be the parent world times the local matrix")
+		}
+	}
+
+	// Moving an ancestor invalidates the subtree only
+	parent.World()
+	child.World()
+	grandchild.World()
+	sibling := NewNode("sibling")
+	parent.AddChild(sibling)
+	sibling.World()
+
+	child.SetTranslation(math.Vec3{X: 2})
+	if parent.worldDirty || sibling.worldDirty || !child.worldDirty || !grandchild.worldDirty {
+		t.Errorf("expected only the child and grandchild to be dirty")
+	}
+	if p := grandchild.WorldPosition(); !nearVec3(p, math.Vec3{X: 10, Y: 4}) {
+		t.Errorf("expected grandchild at (10, 4, 0), got %v", p)
+	}
+	if child.worldDirty || grandchild.worldDirty {
+		t.Errorf("expected world matrices to be cached")
+	}
+}
+
+func TestNode_hierarchy(t *testing.T) {
+	a, b, c := NewNode("a"), NewNode("b"), NewNode("c")
+	a.AddChild(b)
+	b.AddChild(c)
+	b.SetTranslation(math.Vec3{Y: 1})
+
+	if a.Find("c") != c || a.Find("d") != nil {
+		t.Errorf("expected to find c only")
+	}
+	if p := c.WorldPosition(); !nearVec3(p, math.Vec3{Y: 1}) {
+		t.Errorf("expected c at (0, 1, 0), got %v", p)
+	}
+
+	// Reparenting keeps the local transform
+	a.AddChild(c)
+	if c.Parent() != a || len(b.Children()) != 0 || len(a.Children()) != 2 {
+		t.Errorf("expected c to move from b to a")
+	}
+	if p := c.WorldPosition(); !nearVec3(p, math.Vec3{}) {
+		t.Errorf("expected c at the origin, got %v", p)
+	}
+
+	var order []string
+	a.Walk(func(n *Node) bool {
+		order = append(order, n.Name)
+		return n != b
+	})
+	if len(order) != 3 || order[0] != "a" || order[1] != "b" || order[2] != "c" {
+		t.Errorf("expected walk order a, b, c, got %v", order)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a cycle to panic")
+		}
+	}()
+	b.AddChild(a)
+}
+
+type attachCounter struct {
+	attached, detached int
+}
+
+func (c *attachCounter) OnAttach(n *Node) { c.attached++ }
+func (c *attachCounter) OnDetach(n *Node) { c.detached++ }
+
+func TestNode_components(t *testing.T) {
+	n := NewNode("n")
+	counter := &attachCounter{}
+	light := &Light{Type: Point}
+	n.AddComponent(light)
+	n.AddComponent(counter)
+
+	if l, ok := ComponentOf[*Light](n); !ok || l != light {
+		t.Errorf("expected to find the light")
+	}
+	if _, ok := ComponentOf[*Camera](n); ok {
+		t.Errorf("expected no camera")
+	}
+
+	n.RemoveComponent(counter)
+	n.RemoveComponent(counter)
+	if counter.attached != 1 || counter.detached != 1 || len(n.Components()) != 1 {
+		t.Errorf("expected the counter to be attached and detached once, got %+v", counter)
+	}
+}
+
+func TestScene_layer(t *testing.T) {
+	s := New("level")
+	player := NewNode("player")
+	eye := NewNode("eye")
+	s.Add(player)
+	player.AddChild(eye)
+	eye.SetTranslation(math.Vec3{Y: 2})
+
+	cam := &Camera{Camera: camera.NewPerspective(1, 1, 0.1, 100)}
+	eye.AddComponent(cam)
+	s.ActiveCamera = cam
+
+	var updates int
+	var keys []input.Key
+	player.AddComponent(&Script{
+		Update: func(n *Node, delta float32) {
+			updates++
+			n.SetTranslation(n.Translation().Add(math.Vec3{X: delta}))
+		},
+		Event: func(n *Node, e event.Event) {
+			if e, ok := e.(*event.KeyPressed); ok {
+				keys = append(keys, e.Key)
+				e.SetHandled()
+			}
+		},
+	})
+	second := &Script{Event: func(n *Node, e event.Event) {
+		t.Errorf("expected %s to be handled before reaching the second script", e)
+	}}
+	eye.AddComponent(second)
+
+	stack := layer.Stack{}
+	stack.Push(s)
+	s.Update(0.5)
+	stack.Top().Get().OnEvent(&event.KeyPressed{Key: input.KeyW})
+	eye.RemoveComponent(second)
+	s.OnEvent(&event.WindowResize{Width: 200, Height: 100})
+
+	if updates != 1 || len(keys) != 1 || keys[0] != input.KeyW {
+		t.Errorf("expected 1 update and a W press, got %d and %v", updates, keys)
+	}
+	// The camera follows its node after the scripts moved it
+	if p := cam.Camera.GetTransform().Position; !nearVec3(p, math.Vec3{X: 0.5, Y: 2}) {
+		t.Errorf("expected camera at (0.5, 2, 0), got %v", p)
+	}
+	if aspect := cam.Camera.(*camera.Perspective).Aspect; aspect != 2 {
+		t.Errorf("expected aspect 2, got %v", aspect)
+	}
+}
+
+func TestScene_Renderables(t *testing.T) {
+	s := New("level")
+	cam := &Camera{Camera: camera.NewPerspective(stdmath.Pi/2, 1, 0.1, 100)}
+	eye := NewNode("eye")
+	eye.AddComponent(cam)
+	eye.SetTranslation(math.Vec3{Z: 5})
+	s.Add(eye)
+	s.ActiveCamera = cam
+
+	for i, position := range []math.Vec3{{}, {Z: 10}, {X: 50}, {Z: -90}} {
+		n := NewNode(string(rune('a' + i)))
+		n.SetTranslation(position)
+		n.AddComponent(&MeshRenderer{Mesh: quad()})
+		s.Add(n)
+	}
+	light := NewNode("sun")
+	light.SetRotation(math.QuatAxisAngle(math.Vec3{X: 1}, -stdmath.Pi/2))
+	light.AddComponent(&Light{Type: Directional, Intensity: 1})
+	s.Add(light)
+	s.Update(0)
+
+	// b is behind the camera and c far to the side
+	visible := s.Visible()
+	if len(visible) != 2 || visible[0].Node.Name != "a" || visible[1].Node.Name != "d" {
+		t.Errorf("expected a and d to be visible, got %v", visible)
+	}
+
+	lights := s.Lights()
+	if len(lights) != 1 || !nearVec3(lights[0].Direction, math.Vec3{Y: -1}) {
+		t.Errorf("expected a light pointing down, got %+v", lights)
+	}
+}
+
+func TestScene_Pick(t *testing.T) {
+	s := New("level")
+	near, far := NewNode("near"), NewNode("far")
+	near.SetTranslation(math.Vec3{X: 1.5, Z: -2})
+	far.SetTranslation(math.Vec3{Z: -5})
+	far.SetScale(math.Vec3{X: 3, Y: 3, Z: 3})
+	near.AddComponent(&MeshRenderer{Mesh: quad()})
+	far.AddComponent(&MeshRenderer{Mesh: quad()})
+	s.Add(near)
+	s.Add(far)
+
+	hit, ok := s.Pick(math.Ray{Direction: math.Vec3{Z: -1}})
+	if !ok || hit.Node != far || !nearVec3(hit.Point, math.Vec3{Z: -5}) {
+		t.Errorf("expected to hit far at (0, 0, -5), got %+v", hit)
+	}
+
+	hit, ok = s.Pick(math.Ray{Origin: math.Vec3{X: 1}, Direction: math.Vec3{Z: -2}})
+	if !ok || hit.Node != near || hit.Distance != 1 {
+		t.Errorf("expected to hit near at distance 1, got %+v", hit)
+	}
+
+	if _, ok := s.Pick(math.Ray{Direction: math.Vec3{Z: 1}}); ok {
+		t.Errorf("expected to hit nothing behind the ray")
+	}
+}
+
+func TestNodeFromModel(t *testing.T) {
+	model := &mesh.Model{
+		Meshes:    []mesh.Mesh{*quad()},
+		Materials: []mesh.Material{mesh.DefaultMaterial()},
+		Nodes: []mesh.Node{
+			{Name: "body", Mesh: -1, Children: []int{1}, Translation: math.Vec3{Y: 1}, Rotation: math.IdentityQuat(), Scale: math.Vec3{X: 1, Y: 1, Z: 1}},
+			{Name: "wheel", Mesh: 0, Translation: math.Vec3{X: 1}, Rotation: math.IdentityQuat(), Scale: math.Vec3{X: 1, Y: 1, Z: 1}},
+			{Name: "shadow", Mesh: 0, Rotation: math.IdentityQuat(), Scale: math.Vec3{X: 1, Y: 1, Z: 1}},
+		},
+		Roots: []int{0, 2},
+	}
+
+	root := NodeFromModel("car", model)
+	if root.Name != "car" || len(root.Children()) != 2 {
+		t.Fatalf("expected a car node with 2 children")
+	}
+	wheel := root.Find("wheel")
+	if wheel == nil || !nearVec3(wheel.WorldPosition(), math.Vec3{X: 1, Y: 1}) {
+		t.Errorf("expected wheel at (1, 1, 0)")
+	}
+	if r, ok := ComponentOf[*MeshRenderer](wheel); !ok || r.Mesh != &model.Meshes[0] || r.Material(r.Mesh.Submeshes[0]).Name != "default" {
+		t.Errorf("expected wheel to render the mesh of the model")
+	}
+}
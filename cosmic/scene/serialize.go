@@ -0,0 +1,319 @@
+package scene
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/lentus/cosmic-engine/cosmic/math"
+	"github.com/lentus/cosmic-engine/cosmic/mesh"
+	"io"
+	"os"
+)
+
+// Format is the encoding of a saved scene.
+type Format int
+
+const (
+	// Text is indented JSON, meant to be edited and diffed.
+	Text Format = iota
+	// Binary is smaller and faster to load, meant for shipped games.
+	Binary
+)
+
+const (
+	formatName = "cosmic-scene"
+	// formatVersion is incremented when the layout of scene files changes.
+	formatVersion = 1
+)
+
+// document is the saved form of a scene. Nodes are listed parents first,
+// with the root first of all.
+type document struct {
+	Format       string         `json:"format"`
+	Version      int            `json:"version"`
+	Name         string         `json:"name"`
+	ActiveCamera ID             `json:"activeCamera,omitempty"`
+	Nodes        []nodeDocument `json:"nodes"`
+}
+
+type nodeDocument struct {
+	ID          ID                  `json:"id"`
+	Parent      ID                  `json:"parent,omitempty"`
+	Name        string              `json:"name"`
+	Translation [3]float32          `json:"translation"`
+	Rotation    [4]float32          `json:"rotation"`
+	Scale       [3]float32          `json:"scale"`
+	Components  []componentDocument `json:"components,omitempty"`
+}
+
+type componentDocument struct {
+	Type    string      `json:"type"`
+	Version int         `json:"version"`
+	Data    interface{} `json:"data"`
+}
+
+// Save writes the scene in the format. All components must have a registered
+// type, see RegisterComponent.
+func Save(w io.Writer, s *Scene, format Format) error {
+	doc, err := newDocument(s)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case Text:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(doc)
+	case Binary:
+		buffered := bufio.NewWriter(w)
+		if err := writeBinary(buffered, doc); err != nil {
+			return err
+		}
+		return buffered.Flush()
+	default:
+		return fmt.Errorf("invalid scene format %d", format)
+	}
+}
+
+func SaveFile(path string, s *Scene, format Format) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := Save(file, s, format); err != nil {
+		file.Close()
+		return fmt.Errorf("%s: %s", path, err.Error())
+	}
+
+	return file.Close()
+}
+
+// LoadOptions controls how the assets of a loaded scene are resolved.
+type LoadOptions struct {
+	// ResolveModel loads the model a mesh renderer refers to. Mesh renderers
+	// are loaded without a mesh when it is nil, which is enough to validate
+	// scene files.
+	ResolveModel func(ref AssetRef) (*mesh.Model, error)
+}
+
+// Load reads a scene saved in either format. Components saved with an older
+// version of their type are migrated.
+func Load(r io.Reader, options LoadOptions) (*Scene, error) {
+	buffered := bufio.NewReader(r)
+
+	var doc document
+	if magic, err := buffered.Peek(len(binaryMagic)); err == nil && bytes.Equal(magic, []byte(binaryMagic)) {
+		if doc, err = readBinary(buffered); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := json.NewDecoder(buffered).Decode(&doc); err != nil {
+			return nil, fmt.Errorf("invalid scene JSON: %s", err.Error())
+		}
+		if doc.Format != formatName {
+			return nil, fmt.Errorf("not a scene file")
+		}
+	}
+
+	if doc.Version > formatVersion {
+		return nil, fmt.Errorf("scene file version %d is newer than the supported version %d", doc.Version, formatVersion)
+	}
+
+	return doc.scene(options)
+}
+
+func LoadFile(path string, options LoadOptions) (*Scene, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	s, err := Load(file, options)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err.Error())
+	}
+
+	return s, nil
+}
+
+func newDocument(s *Scene) (document, error) {
+	doc := document{Format: formatName, Version: formatVersion, Name: s.Name}
+
+	var err error
+	s.Root.Walk(func(n *Node) bool {
+		if err != nil {
+			return false
+		}
+
+		node := nodeDocument{
+			ID:          n.ID,
+			Name:        n.Name,
+			Translation: [3]float32{n.translation.X, n.translation.Y, n.translation.Z},
+			Rotation:    [4]float32{n.rotation.X, n.rotation.Y, n.rotation.Z, n.rotation.W},
+			Scale:       [3]float32{n.scale.X, n.scale.Y, n.scale.Z},
+		}
+		if n.parent != nil {
+			node.Parent = n.parent.ID
+		}
+
+		for _, c := range n.components {
+			if s.ActiveCamera != nil && c == Component(s.ActiveCamera) {
+				doc.ActiveCamera = n.ID
+			}
+
+			var component componentDocument
+			if component, err = saveComponent(c); err != nil {
+				err = fmt.Errorf("node %s (%s): %s", n.Name, n.ID, err.Error())
+				return false
+			}
+			node.Components = append(node.Components, component)
+		}
+
+		doc.Nodes = append(doc.Nodes, node)
+		return true
+	})
+
+	return doc, err
+}
+
+func saveComponent(c Component) (componentDocument, error) {
+	t, ok := componentTypeOf(c)
+	if !ok {
+		return componentDocument{}, fmt.Errorf("component type %T is not registered", c)
+	}
+
+	// Components are converted to generic values, so both formats can encode
+	// them and migrations can work on them
+	text, err := json.Marshal(c)
+	if err != nil {
+		return componentDocument{}, fmt.Errorf("%s: %s", t.Name, err.Error())
+	}
+	var data interface{}
+	if err := json.Unmarshal(text, &data); err != nil {
+		return componentDocument{}, fmt.Errorf("%s: %s", t.Name, err.Error())
+	}
+
+	return componentDocument{Type: t.Name, Version: t.Version, Data: data}, nil
+}
+
+func loadComponent(doc componentDocument) (Component, error) {
+	t, ok := componentTypeByName(doc.Type)
+	if !ok {
+		return nil, fmt.Errorf("unknown component type %q", doc.Type)
+	}
+
+	data := doc.Data
+	switch {
+	case doc.Version > t.Version:
+		return nil, fmt.Errorf("%s version %d is newer than the supported version %d", t.Name, doc.Version, t.Version)
+	case doc.Version < t.Version:
+		if t.Migrate == nil {
+			return nil, fmt.Errorf("%s version %d cannot be migrated to version %d", t.Name, doc.Version, t.Version)
+		}
+
+		var err error
+		if data, err = t.Migrate(doc.Version, data); err != nil {
+			return nil, fmt.Errorf("migrating %s from version %d: %s", t.Name, doc.Version, err.Error())
+		}
+	}
+
+	text, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", t.Name, err.Error())
+	}
+	c := t.New()
+	if err := json.Unmarshal(text, c); err != nil {
+		return nil, fmt.Errorf("%s: %s", t.Name, err.Error())
+	}
+
+	return c, nil
+}
+
+// scene builds the scene the document describes.
+func (doc *document) scene(options LoadOptions) (*Scene, error) {
+	if len(doc.Nodes) == 0 || doc.Nodes[0].Parent != 0 {
+		return nil, fmt.Errorf("scene has no root node")
+	}
+
+	models := make(map[AssetRef]*mesh.Model)
+	nodes := make(map[ID]*Node, len(doc.Nodes))
+	s := &Scene{Name: doc.Name}
+
+	for i, source := range doc.Nodes {
+		if source.ID == 0 {
+			return nil, fmt.Errorf("node %s has no ID", source.Name)
+		}
+		if _, ok := nodes[source.ID]; ok {
+			return nil, fmt.Errorf("node ID %s is used twice", source.ID)
+		}
+
+		n := NewNode(source.Name)
+		n.ID = source.ID
+		n.translation = math.Vec3{X: source.Translation[0], Y: source.Translation[1], Z: source.Translation[2]}
+		n.rotation = math.Quat{X: source.Rotation[0], Y: source.Rotation[1], Z: source.Rotation[2], W: source.Rotation[3]}
+		n.scale = math.Vec3{X: source.Scale[0], Y: source.Scale[1], Z: source.Scale[2]}
+
+		// Parents are listed before their children, which rules out cycles
+		if i == 0 {
+			s.Root = n
+		} else if parent, ok := nodes[source.Parent]; !ok {
+			return nil, fmt.Errorf("node %s (%s) has no parent listed before it", source.Name, source.ID)
+		} else {
+			parent.AddChild(n)
+		}
+		nodes[source.ID] = n
+
+		for _, component := range source.Components {
+			c, err := loadComponent(component)
+			if err != nil {
+				return nil, fmt.Errorf("node %s (%s): %s", source.Name, source.ID, err.Error())
+			}
+			if err := resolve(c, options, models); err != nil {
+				return nil, fmt.Errorf("node %s (%s): %s", source.Name, source.ID, err.Error())
+			}
+			n.AddComponent(c)
+		}
+	}
+
+	if doc.ActiveCamera != 0 {
+		n, ok := nodes[doc.ActiveCamera]
+		if !ok {
+			return nil, fmt.Errorf("active camera node %s does not exist", doc.ActiveCamera)
+		}
+		if s.ActiveCamera, ok = ComponentOf[*Camera](n); !ok {
+			return nil, fmt.Errorf("active camera node %s has no camera", doc.ActiveCamera)
+		}
+	}
+
+	return s, nil
+}
+
+// resolve loads the assets a component refers to. Models are loaded once for
+// all components using them.
+func resolve(c Component, options LoadOptions, models map[AssetRef]*mesh.Model) error {
+	r, ok := c.(*MeshRenderer)
+	if !ok || r.Model.IsZero() || options.ResolveModel == nil {
+		return nil
+	}
+
+	model, ok := models[r.Model]
+	if !ok {
+		var err error
+		if model, err = options.ResolveModel(r.Model); err != nil {
+			return fmt.Errorf("model %s: %s", r.Model, err.Error())
+		}
+		models[r.Model] = model
+	}
+
+	if r.MeshIndex < 0 || r.MeshIndex >= len(model.Meshes) {
+		return fmt.Errorf("model %s has no mesh %d", r.Model, r.MeshIndex)
+	}
+	r.Mesh = &model.Meshes[r.MeshIndex]
+	r.Materials = model.Materials
+
+	return nil
+}
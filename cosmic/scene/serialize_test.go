@@ -0,0 +1,234 @@
+package scene
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/lentus/cosmic-engine/cosmic/camera"
+	"github.com/lentus/cosmic-engine/cosmic/math"
+	"github.com/lentus/cosmic-engine/cosmic/mesh"
+	"strings"
+	"testing"
+)
+
+// health is a game component whose saved form changed: version 1 stored a
+// percentage as "hp", version 2 stores a fraction as "fraction".
+type health struct {
+	Fraction float32 `json:"fraction"`
+}
+
+func init() {
+	RegisterComponent(ComponentType{
+		Name:    "test.health",
+		Version: 2,
+		New:     func() Component { return &health{} },
+		Migrate: func(version int, data interface{}) (interface{}, error) {
+			fields, ok := data.(map[string]interface{})
+			if !ok || version != 1 {
+				return nil, fmt.Errorf("unexpected data")
+			}
+			return map[string]interface{}{"fraction": fields["hp"].(float64) / 100}, nil
+		},
+	})
+}
+
+func testScene() *Scene {
+	s := New("level")
+	player := NewNode("player")
+	player.SetTranslation(math.Vec3{X: 1, Y: 2, Z: 3})
+	player.SetRotation(math.QuatAxisAngle(math.Vec3{Y: 1}, 0.5))
+	player.AddComponent(&health{Fraction: 0.75})
+	s.Add(player)
+
+	eye := NewNode("eye")
+	eye.SetScale(math.Vec3{X: 1, Y: 2, Z: 1})
+	cam := &Camera{Camera: camera.NewOrthographic(10, 2, -1, 1)}
+	cam.Camera.(*camera.Orthographic).ReversedZ = true
+	eye.AddComponent(cam)
+	s.ActiveCamera = cam
+	player.AddChild(eye)
+
+	crate := NewNode("crate")
+	crate.AddComponent(&MeshRenderer{Model: AssetRef{Path: "models/crate.obj"}, MeshIndex: 1})
+	crate.AddComponent(&Light{Type: Spot, Color: math.Vec3{X: 1, Y: 1, Z: 1}, Intensity: 2, InnerAngle: 0.2, OuterAngle: 0.4})
+	s.Add(crate)
+
+	return s
+}
+
+func compareNodes(t *testing.T, expected, got *Node) {
+	t.Helper()
+
+	if expected.ID != got.ID || expected.Name != got.Name || expected.Translation() != got.Translation() ||
+		expected.Rotation() != got.Rotation() || expected.Scale() != got.Scale() {
+		t.Errorf("expected node %s (%s), got %s (%s)", expected.Name, expected.ID, got.Name, got.ID)
+	}
+	if len(expected.Components()) != len(got.Components()) || len(expected.Children()) != len(got.Children()) {
+		t.Fatalf("expected %s to have %d components and %d children, got %d and %d", expected.Name,
+			len(expected.Components()), len(expected.Children()), len(got.Components()), len(got.Children()))
+	}
+
+	for i, c := range expected.Components() {
+		switch c := c.(type) {
+		case *Camera:
+			if *c.Camera.(*camera.Orthographic) != *got.Components()[i].(*Camera).Camera.(*camera.Orthographic) {
+				t.Errorf("expected camera %+v, got %+v", c.Camera, got.Components()[i].(*Camera).Camera)
+			}
+		case *MeshRenderer:
+			r := got.Components()[i].(*MeshRenderer)
+			if c.Model != r.Model || c.MeshIndex != r.MeshIndex {
+				t.Errorf("expected mesh renderer %+v, got %+v", c, r)
+			}
+		default:
+			if fmt.Sprint(c) != fmt.Sprint(got.Components()[i]) {
+				t.Errorf("expected component %+v, got %+v", c, got.Components()[i])
+			}
+		}
+	}
+	for i, child := range expected.Children() {
+		compareNodes(t, child, got.Children()[i])
+	}
+}
+
+func TestSave(t *testing.T) {
+	for _, format := range []Format{Text, Binary} {
+		s := testScene()
+		var buffer bytes.Buffer
+		if err := Save(&buffer, s, format); err != nil {
+			t.Fatal(err)
+		}
+		saved := buffer.String()
+
+		loaded, err := Load(&buffer, LoadOptions{})
+		if err != nil {
+			t.Fatalf("format %d: %s", format, err.Error())
+		}
+		if loaded.Name != "level" || loaded.ActiveCamera == nil || loaded.ActiveCamera != loaded.Find("eye").Components()[0] {
+			t.Errorf("format %d: expected scene level with the camera of eye active", format)
+		}
+		compareNodes(t, s.Root, loaded.Root)
+
+		// Saving again gives the same file
+		buffer.Reset()
+		if err := Save(&buffer, loaded, format); err != nil {
+			t.Fatal(err)
+		}
+		if buffer.String() != saved {
+			t.Errorf("format %d: expected saving a loaded scene to give the same file", format)
+		}
+	}
+}
+
+func TestSave_text(t *testing.T) {
+	var buffer bytes.Buffer
+	if err := Save(&buffer, testScene(), Text); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		`"format": "cosmic-scene"`,
+		`"name": "crate"`,
+		`"type": "light"`,
+		`"type": "spot"`,
+		`"path": "models/crate.obj"`,
+		`"projection": "orthographic"`,
+	} {
+		if !strings.Contains(buffer.String(), expected) {
+			t.Errorf("expected the scene file to contain %s, got\n%s", expected, buffer.String())
+		}
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	var resolved []AssetRef
+	model := &mesh.Model{Meshes: []mesh.Mesh{*quad()}, Materials: []mesh.Material{mesh.DefaultMaterial()}}
+
+	s, err := LoadFile("testdata/level.scene", LoadOptions{
+		ResolveModel: func(ref AssetRef) (*mesh.Model, error) {
+			resolved = append(resolved, ref)
+			return model, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crate := s.Find("crate")
+	if crate == nil || crate.ID != 0xa1 || crate.Scale() != (math.Vec3{X: 2, Y: 2, Z: 2}) {
+		t.Fatalf("expected crate a1 scaled by 2")
+	}
+	if len(resolved) != 1 || resolved[0].Path != "models/crate.obj" {
+		t.Errorf("expected models/crate.obj to be resolved, got %v", resolved)
+	}
+	if r, ok := ComponentOf[*MeshRenderer](crate); !ok || r.Mesh != &model.Meshes[0] {
+		t.Errorf("expected the crate to render the resolved mesh")
+	}
+	if l, ok := ComponentOf[*Light](crate); !ok || l.Type != Point || l.Color != (math.Vec3{X: 1, Y: 0.5}) || l.Range != 5 {
+		t.Errorf("expected an orange point light, got %+v", l)
+	}
+	if s.ActiveCamera == nil || s.ActiveCamera.Camera.(*camera.Perspective).Aspect != 1.5 {
+		t.Errorf("expected a perspective camera with aspect 1.5")
+	}
+
+	// Scenes load without resolving assets, like when validating them
+	if _, err := LoadFile("testdata/level.scene", LoadOptions{}); err != nil {
+		t.Errorf("expected the scene to load without a resolver, got %s", err.Error())
+	}
+}
+
+func TestLoad_migration(t *testing.T) {
+	source := `{"format": "cosmic-scene", "version": 1, "name": "old", "nodes": [{
+		"id": "1", "name": "old", "rotation": [0, 0, 0, 1], "scale": [1, 1, 1],
+		"components": [{"type": "test.health", "version": 1, "data": {"hp": 40}}]
+	}]}`
+
+	s, err := Load(strings.NewReader(source), LoadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h, ok := ComponentOf[*health](s.Root); !ok || h.Fraction != 0.4 {
+		t.Errorf("expected health to be migrated to 0.4, got %+v", h)
+	}
+}
+
+func TestLoad_errors(t *testing.T) {
+	node := func(id, parent, components string) string {
+		return fmt.Sprintf(`{"id": "%s", "parent": "%s", "name": "n", "rotation": [0, 0, 0, 1], "scale": [1, 1, 1], "components": [%s]}`, id, parent, components)
+	}
+	scene := func(nodes ...string) string {
+		return `{"format": "cosmic-scene", "version": 1, "name": "broken", "nodes": [` + strings.Join(nodes, ",") + `]}`
+	}
+
+	for name, source := range map[string]string{
+		"not a scene":       `{"nodes": []}`,
+		"newer format":      strings.Replace(scene(node("1", "0", "")), `"version": 1`, `"version": 2`, 1),
+		"no root":           scene(),
+		"duplicate ID":      scene(node("1", "0", ""), node("1", "1", "")),
+		"unknown parent":    scene(node("1", "0", ""), node("2", "3", "")),
+		"child before root": scene(node("1", "0", ""), node("2", "3", ""), node("3", "1", "")),
+		"unknown component": scene(node("1", "0", `{"type": "sound", "version": 1, "data": {}}`)),
+		"newer component":   scene(node("1", "0", `{"type": "light", "version": 2, "data": {}}`)),
+		"invalid component": scene(node("1", "0", `{"type": "light", "version": 1, "data": {"type": "laser"}}`)),
+		"camera without":    strings.Replace(scene(node("1", "0", "")), `"nodes"`, `"activeCamera": "1", "nodes"`, 1),
+	} {
+		if _, err := Load(strings.NewReader(source), LoadOptions{}); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	// Truncated binary files are reported, not loaded partially
+	var buffer bytes.Buffer
+	if err := Save(&buffer, testScene(), Binary); err != nil {
+		t.Fatal(err)
+	}
+	for _, length := range []int{len(binaryMagic) + 1, buffer.Len() / 2, buffer.Len() - 1} {
+		if _, err := Load(bytes.NewReader(buffer.Bytes()[:length]), LoadOptions{}); err == nil {
+			t.Errorf("expected an error for a binary file truncated to %d bytes", length)
+		}
+	}
+
+	s := New("scripted")
+	s.Root.AddComponent(&Script{})
+	if err := Save(&buffer, s, Text); err == nil {
+		t.Errorf("expected an error saving an unregistered component")
+	}
+}
@@ -0,0 +1,200 @@
+// Package texture stores images in a container that is ready to be copied to
+// the gpu, with their mipmaps computed in advance.
+package texture
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+)
+
+// Extension is the extension of files written by Encode.
+const Extension = ".ctex"
+
+// Texture files start with a header of the magic, the format version, the
+// pixel format and the size of the first level and the number of levels,
+// all little endian. It is followed by the pixels of each level, largest
+// first, in rows without padding.
+const (
+	magic   = "CTEX"
+	version = 1
+)
+
+// Format is the layout of the pixels in a texture file.
+type Format uint16
+
+const (
+	// FormatRGBA8 has 8 bits per channel, with premultiplied alpha like
+	// image.RGBA.
+	FormatRGBA8 Format = iota
+)
+
+const headerSize = 20
+
+// maxSize limits the size of textures read from a file, so a corrupt file
+// does not make the reader allocate huge buffers.
+const maxSize = 1 << 15
+
+// Mipmaps returns the image followed by each of its mip levels, every one
+// half the size of the previous one, down to a single pixel. Each pixel of a
+// level is the average of the pixels it covers in the previous level.
+func Mipmaps(img *image.RGBA) []*image.RGBA {
+	if img.Rect.Min != (image.Point{}) {
+		// Levels start at the origin, like the ones made here
+		moved := image.NewRGBA(image.Rect(0, 0, img.Rect.Dx(), img.Rect.Dy()))
+		for y := 0; y < img.Rect.Dy(); y++ {
+			copy(moved.Pix[y*moved.Stride:], img.Pix[img.PixOffset(img.Rect.Min.X, img.Rect.Min.Y+y):][:img.Rect.Dx()*4])
+		}
+		img = moved
+	}
+
+	levels := []*image.RGBA{img}
+	for img.Rect.Dx() > 1 || img.Rect.Dy() > 1 {
+		img = downsample(img)
+		levels = append(levels, img)
+	}
+
+	return levels
+}
+
+// downsample halves the size of an image with a box filter. The last row or
+// column of an odd sized image is averaged into the one before it.
+func downsample(src *image.RGBA) *image.RGBA {
+	width, height := src.Rect.Dx(), src.Rect.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, max(width/2, 1), max(height/2, 1)))
+
+	for y := 0; y < dst.Rect.Dy(); y++ {
+		y0, y1 := span(y, height, dst.Rect.Dy())
+		for x := 0; x < dst.Rect.Dx(); x++ {
+			x0, x1 := span(x, width, dst.Rect.Dx())
+
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					p := src.Pix[sy*src.Stride+sx*4:]
+					for c := range sum {
+						sum[c] += int(p[c])
+					}
+				}
+			}
+
+			count := (y1 - y0) * (x1 - x0)
+			p := dst.Pix[y*dst.Stride+x*4:]
+			for c := range sum {
+				p[c] = uint8((sum[c] + count/2) / count)
+			}
+		}
+	}
+
+	return dst
+}
+
+// span returns the range of source pixels covered by pixel i of a level with
+// n pixels, when the source has size pixels.
+func span(i, size, n int) (start, end int) {
+	start = i * size / n
+	end = (i + 1) * size / n
+	if i == n-1 {
+		end = size
+	}
+
+	return start, end
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// Encode writes the levels of a texture, as returned by Mipmaps, as a texture
+// file.
+func Encode(out io.Writer, levels []*image.RGBA) error {
+	if len(levels) == 0 {
+		return errors.New("texture has no levels")
+	}
+	width, height := levels[0].Rect.Dx(), levels[0].Rect.Dy()
+	for i, level := range levels {
+		w, h := levelSize(width, height, i)
+		if level.Rect != image.Rect(0, 0, w, h) {
+			return fmt.Errorf("level %d has size %v, expected %dx%d", i, level.Rect, w, h)
+		}
+	}
+
+	w := bufio.NewWriter(out)
+	header := make([]byte, headerSize)
+	copy(header, magic)
+	binary.LittleEndian.PutUint16(header[4:], version)
+	binary.LittleEndian.PutUint16(header[6:], uint16(FormatRGBA8))
+	binary.LittleEndian.PutUint32(header[8:], uint32(width))
+	binary.LittleEndian.PutUint32(header[12:], uint32(height))
+	binary.LittleEndian.PutUint32(header[16:], uint32(len(levels)))
+	w.Write(header)
+
+	for _, level := range levels {
+		for y := 0; y < level.Rect.Dy(); y++ {
+			w.Write(level.Pix[y*level.Stride:][:level.Rect.Dx()*4])
+		}
+	}
+
+	return w.Flush()
+}
+
+// Decode reads the levels of a texture file.
+func Decode(in io.Reader) ([]*image.RGBA, error) {
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(in, header); err != nil || string(header[:4]) != magic {
+		return nil, errors.New("not a texture file")
+	}
+	if v := binary.LittleEndian.Uint16(header[4:]); v != version {
+		return nil, fmt.Errorf("unsupported texture file version %d", v)
+	}
+	if format := Format(binary.LittleEndian.Uint16(header[6:])); format != FormatRGBA8 {
+		return nil, fmt.Errorf("unsupported texture format %d", format)
+	}
+
+	width := int(binary.LittleEndian.Uint32(header[8:]))
+	height := int(binary.LittleEndian.Uint32(header[12:]))
+	count := int(binary.LittleEndian.Uint32(header[16:]))
+	if width < 1 || height < 1 || width > maxSize || height > maxSize {
+		return nil, fmt.Errorf("invalid texture size %dx%d", width, height)
+	}
+	if count < 1 || count > levelCount(width, height) {
+		return nil, fmt.Errorf("invalid number of levels %d", count)
+	}
+
+	r := bufio.NewReader(in)
+	levels := make([]*image.RGBA, count)
+	for i := range levels {
+		w, h := levelSize(width, height, i)
+		levels[i] = image.NewRGBA(image.Rect(0, 0, w, h))
+		if _, err := io.ReadFull(r, levels[i].Pix); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, fmt.Errorf("level %d: %s", i, err.Error())
+		}
+	}
+
+	return levels, nil
+}
+
+// levelSize returns the size of a mip level of a texture.
+func levelSize(width, height, level int) (int, int) {
+	return max(width>>level, 1), max(height>>level, 1)
+}
+
+// levelCount returns the number of levels of a full mip chain.
+func levelCount(width, height int) int {
+	count := 1
+	for width > 1 || height > 1 {
+		width, height = max(width/2, 1), max(height/2, 1)
+		count++
+	}
+
+	return count
+}
@@ -0,0 +1,77 @@
+package texture
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestMipmaps(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 5, 2))
+	for x := 0; x < 5; x++ {
+		img.SetRGBA(x, 0, color.RGBA{R: 200, A: 255})
+		img.SetRGBA(x, 1, color.RGBA{B: 100, A: 255})
+	}
+
+	levels := Mipmaps(img)
+	sizes := []image.Point{{5, 2}, {2, 1}, {1, 1}}
+	if len(levels) != len(sizes) {
+		t.Fatalf("expected %d levels, got %d", len(sizes), len(levels))
+	}
+	for i, size := range sizes {
+		if levels[i].Rect.Size() != size {
+			t.Errorf("expected level %d to be %v, got %v", i, size, levels[i].Rect.Size())
+		}
+	}
+	if c := levels[1].RGBAAt(1, 0); c != (color.RGBA{R: 100, B: 50, A: 255}) {
+		t.Errorf("expected the average of the covered pixels, got %v", c)
+	}
+
+	// Images not at the origin are moved there
+	sub := img.SubImage(image.Rect(1, 1, 3, 2)).(*image.RGBA)
+	if levels := Mipmaps(sub); levels[0].Rect != image.Rect(0, 0, 2, 1) || levels[0].RGBAAt(0, 0).B != 100 {
+		t.Errorf("expected the sub image at the origin, got %v", levels[0].Rect)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	img.SetRGBA(3, 3, color.RGBA{G: 255, A: 255})
+	levels := Mipmaps(img)
+
+	var encoded bytes.Buffer
+	if err := Encode(&encoded, levels); err != nil {
+		t.Fatal(err)
+	}
+	if expected := headerSize + (16+4+1)*4; encoded.Len() != expected {
+		t.Errorf("expected %d bytes, got %d", expected, encoded.Len())
+	}
+	data := encoded.Bytes()
+
+	decoded, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 3 {
+		t.Fatalf("expected 3 levels, got %d", len(decoded))
+	}
+	for i := range levels {
+		if decoded[i].Rect != levels[i].Rect || !bytes.Equal(decoded[i].Pix, levels[i].Pix) {
+			t.Errorf("expected level %d to be unchanged", i)
+		}
+	}
+
+	if err := Encode(&encoded, []*image.RGBA{img, img}); err == nil {
+		t.Errorf("expected an error for levels of the wrong size")
+	}
+	for name, data := range map[string][]byte{
+		"truncated": data[:len(data)-1],
+		"png":       []byte("\x89PNG\r\n\x1a\n"),
+		"levels":    append(append([]byte{}, data[:16]...), 9, 0, 0, 0),
+	} {
+		if _, err := Decode(bytes.NewReader(data)); err == nil {
+			t.Errorf("expected an error for a %s file", name)
+		}
+	}
+}
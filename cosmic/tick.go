@@ -0,0 +1,50 @@
+package cosmic
+
+import (
+	"time"
+)
+
+// Rate the game is simulated at when the application sets none, in ticks per
+// second.
+const defaultTickRate = 60
+
+// Most ticks run in one frame. A frame that takes longer, like one stalled
+// by loading, slows the game down rather than running ever more ticks to
+// catch up.
+const maxTicksPerFrame = 5
+
+// fixedTick counts the ticks of a fixed length that fit in the time between
+// frames, carrying the remainder over to the next frame.
+type fixedTick struct {
+	length      time.Duration
+	accumulated time.Duration
+	last        time.Time
+}
+
+func newFixedTick(rate int, now time.Time) fixedTick {
+	if rate <= 0 {
+		rate = defaultTickRate
+	}
+	return fixedTick{length: time.Second / time.Duration(rate), last: now}
+}
+
+// advance returns how many ticks to run for the time passed since the last
+// frame.
+func (t *fixedTick) advance(now time.Time) int {
+	t.accumulated += now.Sub(t.last)
+	t.last = now
+
+	ticks := int(t.accumulated / t.length)
+	if ticks > maxTicksPerFrame {
+		ticks = maxTicksPerFrame
+		t.accumulated = 0
+		return ticks
+	}
+	t.accumulated -= time.Duration(ticks) * t.length
+	return ticks
+}
+
+// delta returns the length of a tick in seconds.
+func (t *fixedTick) delta() float32 {
+	return float32(t.length.Seconds())
+}
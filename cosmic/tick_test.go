@@ -0,0 +1,33 @@
+package cosmic
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFixedTick(t *testing.T) {
+	start := time.Now()
+	ticks := newFixedTick(0, start)
+	if delta := ticks.delta(); delta < 0.0166 || delta > 0.0167 {
+		t.Errorf("Expected ticks of 1/60s by default, got %g", delta)
+	}
+
+	ticks = newFixedTick(100, start)
+	for _, test := range []struct {
+		elapsed time.Duration
+		ticks   int
+	}{
+		{5 * time.Millisecond, 0},
+		{10 * time.Millisecond, 1},
+		// The remainder of 5ms carries over to the next frame
+		{25 * time.Millisecond, 1},
+		{40 * time.Millisecond, 2},
+		// Long frames run at most maxTicksPerFrame ticks, dropping the rest
+		{time.Second, maxTicksPerFrame},
+		{time.Second + 10*time.Millisecond, 1},
+	} {
+		if n := ticks.advance(start.Add(test.elapsed)); n != test.ticks {
+			t.Errorf("At %s: expected %d ticks, got %d", test.elapsed, test.ticks, n)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package vfs
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// dirInfo describes a directory that only exists in the FS, like the
+// directories leading to a mount point.
+type dirInfo string
+
+func (d dirInfo) Name() string       { return string(d) }
+func (d dirInfo) Size() int64        { return 0 }
+func (d dirInfo) Mode() fs.FileMode  { return fs.ModeDir | 0555 }
+func (d dirInfo) ModTime() time.Time { return time.Time{} }
+func (d dirInfo) IsDir() bool        { return true }
+func (d dirInfo) Sys() interface{}   { return nil }
+
+// namedInfo renames a file.
+type namedInfo struct {
+	fs.FileInfo
+	name string
+}
+
+func (i namedInfo) Name() string { return i.name }
+
+// dirFile is an open directory with entries listed in advance.
+type dirFile struct {
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *dirFile) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *dirFile) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.Name(), Err: fs.ErrInvalid}
+}
+
+func (d *dirFile) Close() error {
+	return nil
+}
+
+func (d *dirFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	remaining := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return remaining, nil
+	}
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+
+	if n > len(remaining) {
+		n = len(remaining)
+	}
+	d.offset += n
+	return remaining[:n], nil
+}
+
+type memInfo struct {
+	name string
+	size int64
+}
+
+func (i memInfo) Name() string       { return i.name }
+func (i memInfo) Size() int64        { return i.size }
+func (i memInfo) Mode() fs.FileMode  { return 0444 }
+func (i memInfo) ModTime() time.Time { return time.Time{} }
+func (i memInfo) IsDir() bool        { return false }
+func (i memInfo) Sys() interface{}   { return nil }
+
+type memFile struct {
+	*bytes.Reader
+	info memInfo
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *memFile) Close() error {
+	return nil
+}
+
+// memFS is a read-only file system of files held in memory.
+type memFS map[string][]byte
+
+// Bindata returns the files embedded by go-bindata as a file system, given
+// the generated Asset function and the names of AssetNames.
+func Bindata(asset func(name string) ([]byte, error), names []string) (fs.FS, error) {
+	files := make(memFS, len(names))
+	for _, name := range names {
+		data, err := asset(name)
+		if err != nil {
+			return nil, err
+		}
+		files[strings.TrimPrefix(path.Clean("/"+name), "/")] = data
+	}
+
+	return files, nil
+}
+
+func (files memFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if data, ok := files[name]; ok {
+		return &memFile{bytes.NewReader(data), memInfo{path.Base(name), int64(len(data))}}, nil
+	}
+
+	// Directories exist when files are in them
+	prefix := name + "/"
+	if name == "." {
+		prefix = ""
+	}
+	children := make(map[string]fs.DirEntry)
+	for file, data := range files {
+		if !strings.HasPrefix(file, prefix) {
+			continue
+		}
+
+		child := file[len(prefix):]
+		if i := strings.IndexByte(child, '/'); i >= 0 {
+			children[child[:i]] = fs.FileInfoToDirEntry(dirInfo(child[:i]))
+		} else {
+			children[child] = fs.FileInfoToDirEntry(memInfo{child, int64(len(data))})
+		}
+	}
+	if len(children) == 0 && name != "." {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	entries := make([]fs.DirEntry, 0, len(children))
+	for _, entry := range children {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	return &dirFile{info: dirInfo(path.Base(name)), entries: entries}, nil
+}
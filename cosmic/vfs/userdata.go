@@ -0,0 +1,27 @@
+package vfs
+
+import (
+	"errors"
+	"path/filepath"
+)
+
+// UserDataDir returns the directory in which the application stores data of
+// the user, like settings and saved games:
+//
+//   - $XDG_DATA_HOME/<application>, or ~/.local/share/<application>, on Linux
+//   - %APPDATA%\<application> on Windows
+//   - ~/Library/Application Support/<application> on macOS
+//
+// The directory is not created.
+func UserDataDir(application string) (string, error) {
+	if application == "" || filepath.Base(application) != application {
+		return "", errors.New("invalid application name for a user data directory")
+	}
+
+	base, err := userDataBase()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(base, application), nil
+}
@@ -0,0 +1,14 @@
+package vfs
+
+import (
+	"os"
+	"path/filepath"
+)
+
+func userDataBase() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, "Library", "Application Support"), nil
+}
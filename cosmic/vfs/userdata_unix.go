@@ -0,0 +1,21 @@
+//go:build !windows && !darwin
+// +build !windows,!darwin
+
+package vfs
+
+import (
+	"os"
+	"path/filepath"
+)
+
+func userDataBase() (string, error) {
+	if dir := os.Getenv("XDG_DATA_HOME"); filepath.IsAbs(dir) {
+		return dir, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "share"), nil
+}
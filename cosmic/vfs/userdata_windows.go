@@ -0,0 +1,14 @@
+package vfs
+
+import (
+	"errors"
+	"os"
+)
+
+func userDataBase() (string, error) {
+	dir := os.Getenv("APPDATA")
+	if dir == "" {
+		return "", errors.New("%APPDATA% is not set")
+	}
+	return dir, nil
+}
@@ -0,0 +1,437 @@
+// Package vfs combines directories, archives and embedded files into one
+// file system.
+package vfs
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrReadOnly is returned when writing to a path no writable mount covers.
+var ErrReadOnly = errors.New("read-only file system")
+
+type MountOptions struct {
+	// Files of mounts with a higher priority override those of mounts with a
+	// lower priority, like mods overriding the files of the base game. Of
+	// mounts with the same priority, the one mounted last wins.
+	Priority int
+
+	// Files written through the file system are written to the writable
+	// mount with the highest priority. Only directories can be writable.
+	Writable bool
+}
+
+// Mount is a file system mounted into a FS.
+type Mount struct {
+	// Slash separated path the file system is mounted at, empty for the root.
+	Point string
+	MountOptions
+
+	fs fs.FS
+	// Directory of a mounted directory, which writes go to.
+	directory string
+	closer    io.Closer
+	order     int
+}
+
+// Directory returns the absolute directory of a mounted directory, and an
+// empty string for other mounts.
+func (m *Mount) Directory() string {
+	return m.directory
+}
+
+// relative returns the path of a file of the FS within the mount.
+func (m *Mount) relative(name string) (string, bool) {
+	switch {
+	case m.Point == "":
+		return name, true
+	case name == m.Point:
+		return ".", true
+	case strings.HasPrefix(name, m.Point+"/"):
+		return name[len(m.Point)+1:], true
+	default:
+		return "", false
+	}
+}
+
+// FS combines file systems mounted at paths within it into one, so the
+// engine reads files the same way whether they come from a directory, a zip
+// archive or the binary. Files in mounts of a higher priority override those
+// in lower ones, and the entries of directories in several mounts are merged.
+//
+// A FS is safe for concurrent use.
+type FS struct {
+	mutex sync.RWMutex
+	// Sorted from the highest priority to the lowest
+	mounts []*Mount
+	order  int
+}
+
+func New() *FS {
+	return &FS{}
+}
+
+func cleanPoint(point string) (string, error) {
+	point = strings.Trim(point, "/")
+	if point == "" || point == "." {
+		return "", nil
+	}
+	if !fs.ValidPath(point) {
+		return "", fmt.Errorf("invalid mount point %q", point)
+	}
+
+	return point, nil
+}
+
+func (v *FS) mount(point string, files fs.FS, directory string, closer io.Closer, options MountOptions) (*Mount, error) {
+	point, err := cleanPoint(point)
+	if err != nil {
+		return nil, err
+	}
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	v.order++
+	m := &Mount{Point: point, MountOptions: options, fs: files, directory: directory, closer: closer, order: v.order}
+	v.mounts = append(v.mounts, m)
+	sort.SliceStable(v.mounts, func(i, j int) bool {
+		if v.mounts[i].Priority != v.mounts[j].Priority {
+			return v.mounts[i].Priority > v.mounts[j].Priority
+		}
+		return v.mounts[i].order > v.mounts[j].order
+	})
+
+	return m, nil
+}
+
+// Mount mounts a file system, like an embed.FS or a Bindata file system, at
+// the slash separated point. It cannot be writable.
+func (v *FS) Mount(point string, files fs.FS, options MountOptions) (*Mount, error) {
+	if options.Writable {
+		return nil, fmt.Errorf("%s: only directories can be mounted writable", point)
+	}
+
+	return v.mount(point, files, "", nil, options)
+}
+
+// MountDir mounts a directory of the operating system at the point.
+func (v *FS) MountDir(point, directory string, options MountOptions) (*Mount, error) {
+	info, err := os.Stat(directory)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", directory)
+	}
+	if directory, err = filepath.Abs(directory); err != nil {
+		return nil, err
+	}
+
+	return v.mount(point, os.DirFS(directory), directory, nil, options)
+}
+
+// MountZip mounts a zip archive, like a pak file of the game or a mod, at
+// the point. The archive is closed when it is unmounted.
+func (v *FS) MountZip(point, archive string, options MountOptions) (*Mount, error) {
+	if options.Writable {
+		return nil, fmt.Errorf("%s: only directories can be mounted writable", archive)
+	}
+
+	reader, err := zip.OpenReader(archive)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := v.mount(point, reader, "", reader, options)
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Unmount removes a mount from the file system.
+func (v *FS) Unmount(m *Mount) error {
+	v.mutex.Lock()
+	for i, mount := range v.mounts {
+		if mount == m {
+			v.mounts = append(v.mounts[:i:i], v.mounts[i+1:]...)
+			break
+		}
+	}
+	v.mutex.Unlock()
+
+	if m.closer != nil {
+		return m.closer.Close()
+	}
+	return nil
+}
+
+// Close unmounts all mounts.
+func (v *FS) Close() error {
+	var err error
+	for _, m := range v.Mounts() {
+		if unmountErr := v.Unmount(m); unmountErr != nil && err == nil {
+			err = unmountErr
+		}
+	}
+
+	return err
+}
+
+// Mounts returns the mounts from the highest priority to the lowest.
+func (v *FS) Mounts() []*Mount {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+
+	return append([]*Mount(nil), v.mounts...)
+}
+
+// Open opens the file of the mount with the highest priority containing it.
+// Directories list the entries of the directory in all mounts.
+func (v *FS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	mounts := v.Mounts()
+
+	var dir fs.FileInfo
+	for _, m := range mounts {
+		relative, ok := m.relative(name)
+		if !ok {
+			continue
+		}
+
+		f, err := m.fs.Open(relative)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+
+		info, err := f.Stat()
+		if err != nil || !info.IsDir() {
+			if dir != nil {
+				// Shadowed by a directory of a higher priority
+				f.Close()
+				continue
+			}
+			if err != nil {
+				f.Close()
+				return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+			}
+			return f, nil
+		}
+
+		f.Close()
+		if dir == nil {
+			// The root of a mount is named after its mount point
+			dir = namedInfo{info, path.Base(name)}
+		}
+	}
+
+	if dir == nil && (name == "." || containsMountPoint(mounts, name)) {
+		dir = dirInfo(path.Base(name))
+	}
+	if dir == nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return &dirFile{info: dir, entries: readDir(mounts, name)}, nil
+}
+
+// containsMountPoint returns whether the directory contains a mount point,
+// which makes it exist even when no mount has it.
+func containsMountPoint(mounts []*Mount, dir string) bool {
+	for _, m := range mounts {
+		if m.Point != "" && (dir == "." || strings.HasPrefix(m.Point, dir+"/")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readDir merges the entries of the directory in all mounts, including the
+// directories leading to mount points.
+func readDir(mounts []*Mount, dir string) []fs.DirEntry {
+	merged := make(map[string]fs.DirEntry)
+	for _, m := range mounts {
+		if relative, ok := m.relative(dir); ok {
+			// Mounts with a file in the way of the directory add nothing
+			entries, _ := fs.ReadDir(m.fs, relative)
+			for _, entry := range entries {
+				if _, ok := merged[entry.Name()]; !ok {
+					merged[entry.Name()] = entry
+				}
+			}
+			continue
+		}
+
+		child := m.Point
+		if dir != "." {
+			if !strings.HasPrefix(m.Point, dir+"/") {
+				continue
+			}
+			child = m.Point[len(dir)+1:]
+		}
+		if i := strings.IndexByte(child, '/'); i >= 0 {
+			child = child[:i]
+		}
+		if _, ok := merged[child]; !ok {
+			merged[child] = fs.FileInfoToDirEntry(dirInfo(child))
+		}
+	}
+
+	entries := make([]fs.DirEntry, 0, len(merged))
+	for _, entry := range merged {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	return entries
+}
+
+// NameOf returns the name in the FS of a file of the operating system, when
+// it is in a mounted directory. The file may be overridden by another mount.
+func (v *FS) NameOf(file string) (string, bool) {
+	file, err := filepath.Abs(file)
+	if err != nil {
+		return "", false
+	}
+
+	for _, m := range v.Mounts() {
+		if m.directory == "" {
+			continue
+		}
+
+		relative, err := filepath.Rel(m.directory, file)
+		if err != nil || relative == "." || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+			continue
+		}
+		return path.Join(m.Point, filepath.ToSlash(relative)), true
+	}
+
+	return "", false
+}
+
+// Stat returns information about the file the FS opens for the name.
+func (v *FS) Stat(name string) (fs.FileInfo, error) {
+	f, err := v.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return f.Stat()
+}
+
+// ReadDir returns the entries of the directory in all mounts, sorted by
+// name.
+func (v *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	f, err := v.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dir, ok := f.(*dirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+
+	return dir.entries, nil
+}
+
+// writePath returns the path of the operating system that a file is written
+// to.
+func (v *FS) writePath(op, name string) (string, error) {
+	if !fs.ValidPath(name) || name == "." {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	for _, m := range v.Mounts() {
+		if relative, ok := m.relative(name); ok && m.Writable {
+			return filepath.Join(m.directory, filepath.FromSlash(relative)), nil
+		}
+	}
+
+	return "", &fs.PathError{Op: op, Path: name, Err: ErrReadOnly}
+}
+
+// Create creates or truncates a file in the writable mount, creating the
+// directories leading to it.
+func (v *FS) Create(name string) (*os.File, error) {
+	target, err := v.writePath("create", name)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return nil, err
+	}
+
+	return os.Create(target)
+}
+
+// WriteFile replaces a file in the writable mount. The file is written next
+// to it first, so it is never left half written.
+func (v *FS) WriteFile(name string, data []byte) error {
+	target, err := v.writePath("write", name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(target), ".cosmic-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(temp.Name(), target)
+}
+
+// MkdirAll creates a directory and its parents in the writable mount.
+func (v *FS) MkdirAll(name string) error {
+	target, err := v.writePath("mkdir", name)
+	if err != nil {
+		return err
+	}
+
+	return os.MkdirAll(target, 0755)
+}
+
+// Remove removes a file or empty directory from the writable mount. Files of
+// read-only mounts cannot be removed.
+func (v *FS) Remove(name string) error {
+	target, err := v.writePath("remove", name)
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(target)
+}
@@ -0,0 +1,208 @@
+package vfs
+
+import (
+	"archive/zip"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func readString(t *testing.T, files fs.FS, name string) string {
+	t.Helper()
+
+	data, err := fs.ReadFile(files, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func writeZip(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	archive := filepath.Join(t.TempDir(), "mod.zip")
+	file, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	w := zip.NewWriter(file)
+	for name, contents := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(contents))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return archive
+}
+
+func testFS(t *testing.T) (*FS, string) {
+	base := fstest.MapFS{
+		"textures/grass.png": {Data: []byte("base grass")},
+		"textures/stone.png": {Data: []byte("base stone")},
+		"config.json":        {Data: []byte("base config")},
+	}
+	user := t.TempDir()
+
+	v := New()
+	for _, err := range []error{
+		mountErr(v.Mount("", base, MountOptions{})),
+		mountErr(v.MountZip("", writeZip(t, map[string]string{"textures/grass.png": "mod grass", "textures/flower.png": "mod flower"}), MountOptions{Priority: 10})),
+		mountErr(v.MountDir("", user, MountOptions{Priority: 20, Writable: true})),
+		mountErr(v.Mount("engine/shaders", fstest.MapFS{"vert.spv": {Data: []byte("engine vert")}}, MountOptions{Priority: -10})),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return v, user
+}
+
+func mountErr(_ *Mount, err error) error {
+	return err
+}
+
+func TestFS(t *testing.T) {
+	v, user := testFS(t)
+	defer v.Close()
+
+	if err := fstest.TestFS(v, "textures/grass.png", "textures/flower.png", "config.json", "engine/shaders/vert.spv"); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, expected := range map[string]string{
+		"textures/grass.png":      "mod grass",
+		"textures/stone.png":      "base stone",
+		"textures/flower.png":     "mod flower",
+		"engine/shaders/vert.spv": "engine vert",
+	} {
+		if contents := readString(t, v, name); contents != expected {
+			t.Errorf("expected %s to contain %q, got %q", name, expected, contents)
+		}
+	}
+
+	entries, err := v.ReadDir("textures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if strings.Join(names, " ") != "flower.png grass.png stone.png" {
+		t.Errorf("expected the textures of all mounts, got %v", names)
+	}
+
+	// Files written to the user data directory override the others
+	if err := v.WriteFile("config.json", []byte("user config")); err != nil {
+		t.Fatal(err)
+	}
+	if contents := readString(t, v, "config.json"); contents != "user config" {
+		t.Errorf("expected the user config, got %q", contents)
+	}
+	if contents := readString(t, os.DirFS(user), "config.json"); contents != "user config" {
+		t.Errorf("expected the config to be written to the user directory, got %q", contents)
+	}
+	if err := v.Remove("config.json"); err != nil {
+		t.Fatal(err)
+	}
+	if contents := readString(t, v, "config.json"); contents != "base config" {
+		t.Errorf("expected the base config once the user config is removed, got %q", contents)
+	}
+
+	if name, ok := v.NameOf(filepath.Join(user, "saves", "1.sav")); !ok || name != "saves/1.sav" {
+		t.Errorf("expected the user directory to be mounted at the root, got %s", name)
+	}
+	if _, ok := v.NameOf(filepath.Dir(user)); ok {
+		t.Errorf("expected no name for a directory outside of the mounts")
+	}
+
+	if _, err := v.Open("textures/missing.png"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected a missing file not to exist, got %v", err)
+	}
+	if _, err := v.Open("../outside"); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("expected paths outside the file system to be invalid, got %v", err)
+	}
+}
+
+func TestFS_readOnly(t *testing.T) {
+	v := New()
+	defer v.Close()
+
+	if _, err := v.Mount("", fstest.MapFS{}, MountOptions{Writable: true}); err == nil {
+		t.Errorf("expected only directories to be writable")
+	}
+	if _, err := v.MountDir("saves", t.TempDir(), MountOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v.WriteFile("saves/1.sav", nil); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("expected writing to a read-only mount to fail, got %v", err)
+	}
+	if _, err := v.Create("other/1.sav"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("expected writing outside of mounts to fail, got %v", err)
+	}
+}
+
+func TestFS_Unmount(t *testing.T) {
+	v, _ := testFS(t)
+	defer v.Close()
+
+	mods := v.Mounts()[1]
+	if err := v.Unmount(mods); err != nil {
+		t.Fatal(err)
+	}
+	if contents := readString(t, v, "textures/grass.png"); contents != "base grass" {
+		t.Errorf("expected the base texture once the mod is unmounted, got %q", contents)
+	}
+	if _, err := v.Stat("textures/flower.png"); err == nil {
+		t.Errorf("expected the files of the mod to be gone")
+	}
+}
+
+func TestBindata(t *testing.T) {
+	files := map[string]string{"vert.spv": "vert", "sprites/frag.spv": "frag"}
+	asset := func(name string) ([]byte, error) {
+		if contents, ok := files[name]; ok {
+			return []byte(contents), nil
+		}
+		return nil, errors.New("not found")
+	}
+
+	bindata, err := Bindata(asset, []string{"vert.spv", "sprites/frag.spv"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(bindata, "vert.spv", "sprites/frag.spv"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Bindata(asset, []string{"missing.spv"}); err == nil {
+		t.Errorf("expected an error for a missing asset")
+	}
+}
+
+func TestUserDataDir(t *testing.T) {
+	dir, err := UserDataDir("cosmic-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(dir) != "cosmic-test" || !filepath.IsAbs(dir) {
+		t.Errorf("expected an absolute directory named after the application, got %s", dir)
+	}
+
+	if _, err := UserDataDir("../escape"); err == nil {
+		t.Errorf("expected an error for an application name with a path")
+	}
+}
@@ -0,0 +1,158 @@
+package watch
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const inotifyMask = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_CREATE
+
+// notifier watches directories with inotify, which reports changes as they
+// happen instead of at an interval.
+type notifier struct {
+	fd   int
+	file *os.File
+
+	mutex sync.Mutex
+	// Directories by watch descriptor
+	watches map[int32]string
+
+	changes chan string
+	stop    chan struct{}
+	stopped sync.WaitGroup
+	once    sync.Once
+}
+
+func newNotifier() (Watcher, error) {
+	// A non-blocking descriptor lets the runtime poller wait for events, so
+	// closing the file ends a pending read
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+
+	n := &notifier{
+		fd:      fd,
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		watches: make(map[int32]string),
+		changes: make(chan string, 64),
+		stop:    make(chan struct{}),
+	}
+
+	n.stopped.Add(1)
+	go n.run()
+
+	return n, nil
+}
+
+func (n *notifier) Add(directory string) error {
+	_, err := n.addTree(directory)
+	return err
+}
+
+// addTree watches a directory and its subdirectories, and returns the files
+// in them.
+func (n *notifier) addTree(directory string) (files []string, err error) {
+	err = filepath.WalkDir(directory, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if name != directory {
+				return nil
+			}
+			return err
+		}
+		if !entry.IsDir() {
+			files = append(files, name)
+			return nil
+		}
+
+		wd, err := syscall.InotifyAddWatch(n.fd, name, inotifyMask)
+		if err != nil {
+			return &fs.PathError{Op: "watch", Path: name, Err: err}
+		}
+
+		n.mutex.Lock()
+		n.watches[int32(wd)] = name
+		n.mutex.Unlock()
+		return nil
+	})
+
+	return files, err
+}
+
+func (n *notifier) Changes() <-chan string {
+	return n.changes
+}
+
+func (n *notifier) Close() error {
+	var err error
+	n.once.Do(func() {
+		close(n.stop)
+		err = n.file.Close()
+		n.stopped.Wait()
+		close(n.changes)
+	})
+
+	return err
+}
+
+func (n *notifier) run() {
+	defer n.stopped.Done()
+
+	buffer := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		length, err := n.file.Read(buffer)
+		if err != nil {
+			return
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= length; {
+			e := (*syscall.InotifyEvent)(unsafe.Pointer(&buffer[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			name := string(bytes.TrimRight(buffer[nameStart:nameStart+int(e.Len)], "\x00"))
+			offset = nameStart + int(e.Len)
+
+			for _, changed := range n.handle(e.Wd, e.Mask, name) {
+				select {
+				case n.changes <- changed:
+				case <-n.stop:
+					return
+				}
+			}
+		}
+	}
+}
+
+// handle returns the files changed according to an event.
+func (n *notifier) handle(wd int32, mask uint32, name string) []string {
+	n.mutex.Lock()
+	directory, ok := n.watches[wd]
+	if mask&syscall.IN_IGNORED != 0 {
+		delete(n.watches, wd)
+	}
+	n.mutex.Unlock()
+
+	if !ok || name == "" {
+		return nil
+	}
+	path := filepath.Join(directory, name)
+
+	if mask&syscall.IN_ISDIR != 0 {
+		// Files may have been put in a new directory before it was watched
+		if mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+			files, _ := n.addTree(path)
+			return files
+		}
+		return nil
+	}
+
+	// New files are reported once written
+	if mask&(syscall.IN_CLOSE_WRITE|syscall.IN_MOVED_TO) != 0 {
+		return []string{path}
+	}
+	return nil
+}
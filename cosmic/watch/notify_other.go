@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package watch
+
+import "errors"
+
+func newNotifier() (Watcher, error) {
+	return nil, errors.New("file system notifications are not supported")
+}
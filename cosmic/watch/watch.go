@@ -0,0 +1,175 @@
+// Package watch reports changes to the files in directories, for reloading
+// them while the engine runs.
+package watch
+
+import (
+	"io/fs"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Watcher reports files that are written, created or moved into watched
+// directories and their subdirectories. Removed files are not reported.
+type Watcher interface {
+	// Add watches a directory and all directories in it, including those
+	// created later.
+	Add(directory string) error
+	// Changes receives the paths of changed files, which may be reported more
+	// than once per change. It is closed when the watcher is closed.
+	Changes() <-chan string
+	Close() error
+}
+
+// New returns a watcher using the file system notifications of the operating
+// system where available, inotify on Linux, and otherwise one polling the
+// directories at the interval.
+func New(interval time.Duration) Watcher {
+	if w, err := newNotifier(); err == nil {
+		return w
+	}
+
+	return NewPoller(interval)
+}
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// poller finds changes by comparing the modification times and sizes of the
+// files in the watched directories at an interval.
+type poller struct {
+	mutex       sync.Mutex
+	directories []string
+	files       map[string]fileState
+
+	changes chan string
+	stop    chan struct{}
+	stopped sync.WaitGroup
+	once    sync.Once
+}
+
+// NewPoller returns a watcher that polls the directories at the interval,
+// which works on every file system, including network shares.
+func NewPoller(interval time.Duration) Watcher {
+	p := &poller{
+		files:   make(map[string]fileState),
+		changes: make(chan string, 64),
+		stop:    make(chan struct{}),
+	}
+
+	p.stopped.Add(1)
+	go p.run(interval)
+
+	return p
+}
+
+func (p *poller) Add(directory string) error {
+	files, err := scan(directory)
+	if err != nil {
+		return err
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.directories = append(p.directories, directory)
+	for name, state := range files {
+		p.files[name] = state
+	}
+
+	return nil
+}
+
+func (p *poller) Changes() <-chan string {
+	return p.changes
+}
+
+func (p *poller) Close() error {
+	p.once.Do(func() {
+		close(p.stop)
+		p.stopped.Wait()
+		close(p.changes)
+	})
+
+	return nil
+}
+
+func (p *poller) run(interval time.Duration) {
+	defer p.stopped.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			for _, name := range p.poll() {
+				select {
+				case p.changes <- name:
+				case <-p.stop:
+					return
+				}
+			}
+		}
+	}
+}
+
+// poll scans the directories and returns the files that changed since the
+// last scan.
+func (p *poller) poll() (changed []string) {
+	p.mutex.Lock()
+	directories := append([]string(nil), p.directories...)
+	p.mutex.Unlock()
+
+	current := make(map[string]fileState)
+	for _, directory := range directories {
+		// Directories that disappear are watched again once they are back
+		files, _ := scan(directory)
+		for name, state := range files {
+			current[name] = state
+		}
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for name, state := range current {
+		if previous, ok := p.files[name]; !ok || previous != state {
+			changed = append(changed, name)
+		}
+	}
+	p.files = current
+
+	return changed
+}
+
+// scan returns the state of all files in the directory and its
+// subdirectories.
+func scan(directory string) (map[string]fileState, error) {
+	files := make(map[string]fileState)
+	err := filepath.WalkDir(directory, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// Files removed during the scan are skipped
+			if name != directory {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		files[name] = fileState{info.ModTime(), info.Size()}
+		return nil
+	})
+
+	return files, err
+}
@@ -0,0 +1,75 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// expectChange waits for the file to be reported as changed.
+func expectChange(t *testing.T, w Watcher, file string) {
+	t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case changed := <-w.Changes():
+			if changed == file {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("expected %s to be reported as changed", file)
+		}
+	}
+}
+
+func testWatcher(t *testing.T, w Watcher) {
+	defer w.Close()
+
+	directory := t.TempDir()
+	existing := filepath.Join(directory, "existing.png")
+	if err := os.WriteFile(existing, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Add(directory); err != nil {
+		t.Fatal(err)
+	}
+
+	// The poller needs a scan before the change to notice it
+	time.Sleep(50 * time.Millisecond)
+	if err := os.WriteFile(existing, []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expectChange(t, w, existing)
+
+	// Files in new directories are reported, even when moved in
+	nested := filepath.Join(directory, "textures", "nested")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	temp := filepath.Join(t.TempDir(), "temp")
+	if err := os.WriteFile(temp, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	moved := filepath.Join(nested, "moved.png")
+	if err := os.Rename(temp, moved); err != nil {
+		t.Skipf("cannot move files between directories: %s", err.Error())
+	}
+	expectChange(t, w, moved)
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for range w.Changes() {
+	}
+}
+
+func TestNew(t *testing.T) {
+	testWatcher(t, New(10*time.Millisecond))
+}
+
+func TestNewPoller(t *testing.T) {
+	testWatcher(t, NewPoller(10*time.Millisecond))
+}
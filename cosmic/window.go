@@ -25,6 +25,7 @@ type window interface {
 	IsVSync() bool
 	SetVSync(vsync bool)
 	GetNativeWindow() interface{}
+	GetContext() graphics.Context
 
 	SetEventCallback(func(e event.Event))
 }
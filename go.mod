@@ -1,9 +1,8 @@
 module github.com/lentus/cosmic-engine
 
-go 1.13
+go 1.18
 
 require (
-	github.com/go-bindata/go-bindata v3.1.2+incompatible // indirect
 	github.com/op/go-logging v0.0.0-20160315200505-970db520ece7
 	github.com/vulkan-go/glfw v0.0.0-20190520160600-32f33e359ff2
 	github.com/vulkan-go/vulkan v0.0.0-20181015060211-df48e8cc1538